@@ -16,6 +16,9 @@ import (
 	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
 	"github.com/projuktisheba/erp-mini-api/internal/driver"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+	"github.com/projuktisheba/erp-mini-api/internal/printing"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
 )
 
 // application is the receiver for the various parts of the application
@@ -87,17 +90,7 @@ func RunServer(ctx context.Context) error {
 	}
 
 	// Connection to database
-	var dbConn *pgxpool.Pool
-	var connectedDB string
-	if cfg.Env == "live" {
-		dbConn, err = driver.NewPgxPool(cfg.DB.DSN)
-		connectedDB = cfg.DB.DSN
-	} else {
-		//connect to dev database
-		dbConn, err = driver.NewPgxPool(cfg.DB.DEVDSN)
-		connectedDB = cfg.DB.DEVDSN
-	}
-
+	dbConn, connectedDB, err := connectDB(cfg)
 	if err != nil {
 		errorLog.Println(err)
 		return err
@@ -107,13 +100,36 @@ func RunServer(ctx context.Context) error {
 	dbRepo := dbrepo.NewDBRepository(dbConn)
 	infoLog.Println("Connected to database ", connectedDB)
 
+	// File storage (local disk or S3-compatible)
+	files, err := storage.New(cfg.Storage)
+	if err != nil {
+		errorLog.Println(err)
+		return err
+	}
+	if cfg.Storage.Backend != "s3" && cfg.Storage.URLSecret == "" {
+		infoLog.Println("STORAGE_URL_SECRET is not set; signed file links will stop working on restart")
+	}
+
+	// Fonts of printed documents (invoices in Arabic need them)
+	fonts, err := printing.LoadFonts(cfg.Print)
+	if err != nil {
+		errorLog.Println(err)
+		return err
+	}
+	if !fonts.Arabic() {
+		infoLog.Println("No font with Arabic glyphs found; set PRINT_FONT to print Arabic invoices")
+	}
+
+	// Amounts in JSON replies
+	money.SetJSONStrings(cfg.Money.JSON == "string")
+
 	//Initiate handlers
 	app = &application{
 		config:   cfg,
 		infoLog:  infoLog,
 		errorLog: errorLog,
 		version:  "1.0.0",
-		Handlers: api.NewHandlerRepo(dbRepo, cfg.JWT, infoLog, errorLog),
+		Handlers: api.NewHandlerRepo(dbRepo, cfg.JWT, files, fonts, infoLog, errorLog),
 		DB:       dbRepo,
 		ctx:      ctx,
 	}
@@ -136,6 +152,17 @@ func RunServer(ctx context.Context) error {
 	return app.ShutdownServer()
 }
 
+// connectDB opens the live or dev database depending on cfg.Env
+func connectDB(cfg models.Config) (*pgxpool.Pool, string, error) {
+	if cfg.Env == "live" {
+		dbConn, err := driver.NewPgxPool(cfg.DB.DSN)
+		return dbConn, cfg.DB.DSN, err
+	}
+	//connect to dev database
+	dbConn, err := driver.NewPgxPool(cfg.DB.DEVDSN)
+	return dbConn, cfg.DB.DEVDSN, err
+}
+
 // Stop server from outer module
 func StopServer() error {
 	return app.ShutdownServer()
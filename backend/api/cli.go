@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/config"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
+)
+
+// cliUsage lists the maintenance subcommands
+const cliUsage = `Usage: erp-mini-api <command> [flags]
+
+Commands:
+  rebuild-aggregates   Recompute top_sheet and employees_progress from source documents
+                       -branch ID -from YYYY-MM-DD -to YYYY-MM-DD [-apply]
+  migrate-storage      Copy files from a local directory into the configured store
+                       (STORAGE_BACKEND) and point avatar_link values at /api/v1/files
+                       [-from ./data] [-apply]
+
+Run without a command to start the HTTP server.`
+
+// RunCLI runs a maintenance subcommand against the configured database
+func RunCLI(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(cliUsage)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	dbConn, _, err := connectDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+	dbRepo := dbrepo.NewDBRepository(dbConn)
+
+	switch args[0] {
+	case "rebuild-aggregates":
+		return rebuildAggregatesCmd(ctx, dbRepo, args[1:])
+	case "migrate-storage":
+		files, err := storage.New(cfg.Storage)
+		if err != nil {
+			return err
+		}
+		return migrateStorageCmd(ctx, dbRepo, files, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(cliUsage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], cliUsage)
+	}
+}
+
+// rebuildAggregatesCmd prints the differences as JSON and overwrites only with -apply
+func rebuildAggregatesCmd(ctx context.Context, db *dbrepo.DBRepository, args []string) error {
+	fs := flag.NewFlagSet("rebuild-aggregates", flag.ContinueOnError)
+	branchID := fs.Int64("branch", 0, "branch id")
+	from := fs.String("from", "", "start date (YYYY-MM-DD)")
+	to := fs.String("to", "", "end date (YYYY-MM-DD)")
+	apply := fs.Bool("apply", false, "overwrite stored aggregates (default: report differences only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *branchID <= 0 {
+		return errors.New("-branch is required")
+	}
+	startDate, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		return errors.New("-from must be YYYY-MM-DD")
+	}
+	endDate, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		return errors.New("-to must be YYYY-MM-DD")
+	}
+	if endDate.Before(startDate) {
+		return errors.New("-to cannot be before -from")
+	}
+
+	result, err := db.AggregateRepo.RebuildAggregates(ctx, *branchID, startDate, endDate, *apply)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		return err
+	}
+	if result.Applied {
+		fmt.Fprintf(os.Stderr, "%d differences overwritten\n", len(result.Diffs))
+	} else {
+		fmt.Fprintf(os.Stderr, "%d differences found; re-run with -apply to overwrite\n", len(result.Diffs))
+	}
+	return nil
+}
+
+// migrateStorageCmd uploads every file under -from to the configured store
+// under its relative path (the key attachments and pictures are saved with),
+// then rewrites legacy avatar links. Source files are left in place. Without
+// -apply it only reports what would be done.
+func migrateStorageCmd(ctx context.Context, db *dbrepo.DBRepository, files storage.Store, args []string) error {
+	fset := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	from := fset.String("from", filepath.Join(".", "data"), "local directory holding the files")
+	apply := fset.Bool("apply", false, "copy files and rewrite links (default: report only)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	// the local store already reads from -from; only the links need rewriting
+	sameDir := false
+	if local, ok := files.(*storage.Local); ok {
+		src, err1 := filepath.Abs(*from)
+		dst, err2 := filepath.Abs(local.Root)
+		sameDir = err1 == nil && err2 == nil && src == dst
+	}
+
+	var count, size int64
+	if !sameDir {
+		err := filepath.WalkDir(*from, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(*from, name)
+			if err != nil {
+				return err
+			}
+			key := filepath.ToSlash(rel)
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			count++
+			size += int64(len(data))
+			if !*apply {
+				fmt.Println(key)
+				return nil
+			}
+			if err := files.Put(ctx, key, data, http.DetectContentType(data)); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			fmt.Println("copied", key)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	links, err := db.EmployeeRepo.RewriteAvatarLinks(ctx, *apply)
+	if err != nil {
+		return err
+	}
+
+	if *apply {
+		fmt.Fprintf(os.Stderr, "%d files (%d bytes) copied, %d avatar links rewritten\n", count, size, links)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d files (%d bytes) to copy, %d avatar links to rewrite; re-run with -apply\n", count, size, links)
+	}
+	return nil
+}
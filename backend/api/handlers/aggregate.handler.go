@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+type AggregateHandler struct {
+	DB       *dbrepo.AggregateRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewAggregateHandler(db *dbrepo.AggregateRepo, infoLog *log.Logger, errorLog *log.Logger) *AggregateHandler {
+	return &AggregateHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// RebuildAggregates recomputes top_sheet and employees_progress for the branch.
+// Body: {"start_date": "2025-01-01", "end_date": "2025-01-31", "apply": false}
+// With apply=false (default) only the differences are reported.
+func (h *AggregateHandler) RebuildAggregates(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_RebuildAggregates: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var input struct {
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+		Apply     bool   `json:"apply"`
+	}
+	if err := utils.ReadJSON(w, r, &input); err != nil {
+		h.errorLog.Println("ERROR_02_RebuildAggregates:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	startDate, err := time.Parse("2006-01-02", input.StartDate)
+	if err != nil {
+		utils.BadRequest(w, errors.New("invalid start_date format, expected YYYY-MM-DD"))
+		return
+	}
+	endDate, err := time.Parse("2006-01-02", input.EndDate)
+	if err != nil {
+		utils.BadRequest(w, errors.New("invalid end_date format, expected YYYY-MM-DD"))
+		return
+	}
+	if endDate.Before(startDate) {
+		utils.BadRequest(w, errors.New("end_date cannot be before start_date"))
+		return
+	}
+
+	result, err := h.DB.RebuildAggregates(r.Context(), branchID, startDate, endDate, input.Apply)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_RebuildAggregates:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	if result.Applied {
+		h.infoLog.Printf("Aggregates rebuilt for branch %d from %s to %s: %d differences overwritten",
+			branchID, input.StartDate, input.EndDate, len(result.Diffs))
+	}
+
+	message := "Differences computed; nothing was changed"
+	if result.Applied {
+		message = "Aggregates rebuilt successfully"
+	}
+	resp := struct {
+		Error   bool                           `json:"error"`
+		Status  string                         `json:"status"`
+		Message string                         `json:"message"`
+		Result  *models.AggregateRebuildResult `json:"result"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: message,
+		Result:  result,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// authorizeManagerApproval checks that the signed-in user may approve what
+// needs a manager (a credit override, a large discount) and that a reason was
+// given. It returns the id of the approving user.
+func authorizeManagerApproval(r *http.Request, reason string) (approvedBy int64, err error) {
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		return 0, errors.New("a signed-in manager is required")
+	}
+	if !utils.HasAccess(utils.Role(user.Role), utils.RoleManager) {
+		return 0, errors.New("only a manager can approve it")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return 0, errors.New("a reason is required")
+	}
+	return user.ID, nil
+}
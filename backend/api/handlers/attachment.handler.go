@@ -0,0 +1,382 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/attachment"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// signedURLTTL is how long a signed download link stays valid
+const signedURLTTL = 15 * time.Minute
+
+type AttachmentHandler struct {
+	DB       *dbrepo.AttachmentRepo
+	Files    storage.Store
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewAttachmentHandler(db *dbrepo.AttachmentRepo, files storage.Store, infoLog *log.Logger, errorLog *log.Logger) *AttachmentHandler {
+	return &AttachmentHandler{
+		DB:       db,
+		Files:    files,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// UploadAttachment handles POST /attachments
+// Multipart form: "file", "entity_type" (order, order_item, customer, purchase, expense),
+// "entity_id" and an optional "caption".
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_UploadAttachment: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	// --- Step 1: Parse the form; the body may hold one file plus the form fields ---
+	r.Body = http.MaxBytesReader(w, r.Body, attachment.MaxSize+1<<20)
+	if err := r.ParseMultipartForm(attachment.MaxSize); err != nil {
+		h.errorLog.Println("ERROR_02_UploadAttachment:", err)
+		utils.BadRequest(w, attachment.ErrTooLarge)
+		return
+	}
+	entityType := strings.TrimSpace(r.FormValue("entity_type"))
+	entityID, err := strconv.ParseInt(r.FormValue("entity_id"), 10, 64)
+	if err != nil || entityID <= 0 {
+		utils.BadRequest(w, errors.New("invalid entity_id"))
+		return
+	}
+	if err := h.DB.CheckEntity(r.Context(), branchID, entityType, entityID); err != nil {
+		h.errorLog.Println("ERROR_03_UploadAttachment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	// --- Step 2: Read the file and check what it really is ---
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		h.errorLog.Println("ERROR_04_UploadAttachment:", err)
+		utils.BadRequest(w, errors.New("file field is required"))
+		return
+	}
+	defer file.Close()
+	data, contentType, err := attachment.Read(file)
+	if err != nil {
+		h.errorLog.Println("ERROR_05_UploadAttachment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	thumb, err := attachment.Thumbnail(data, contentType)
+	if err != nil {
+		// a broken image is rejected rather than stored without a preview
+		h.errorLog.Println("ERROR_06_UploadAttachment:", err)
+		utils.BadRequest(w, errors.New("the image could not be read"))
+		return
+	}
+
+	// --- Step 3: Store the file and its thumbnail ---
+	filePath, thumbPath, err := attachment.NewPath(branchID, entityType, entityID, contentType)
+	if err != nil {
+		h.errorLog.Println("ERROR_07_UploadAttachment:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	if err := h.Files.Put(r.Context(), filePath, data, contentType); err != nil {
+		h.errorLog.Println("ERROR_08_UploadAttachment:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	att := &models.Attachment{
+		BranchID:    branchID,
+		EntityType:  entityType,
+		EntityID:    entityID,
+		FileName:    path.Base(filepath.ToSlash(header.Filename)),
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+		Caption:     strings.TrimSpace(r.FormValue("caption")),
+		UploadedBy:  signedInEmployee(r),
+		StoragePath: filePath,
+	}
+	if thumb != nil {
+		if err := h.Files.Put(r.Context(), thumbPath, thumb, "image/jpeg"); err != nil {
+			h.removeFiles(r.Context(), att)
+			h.errorLog.Println("ERROR_09_UploadAttachment:", err)
+			utils.ServerError(w, err)
+			return
+		}
+		att.ThumbPath = &thumbPath
+	}
+
+	// --- Step 4: Record it within the branch quota ---
+	if err := h.DB.CreateAttachment(r.Context(), att); err != nil {
+		h.removeFiles(r.Context(), att)
+		h.errorLog.Println("ERROR_10_UploadAttachment:", err)
+		if errors.Is(err, dbrepo.ErrAttachmentQuotaExceeded) {
+			utils.BadRequest(w, err)
+			return
+		}
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error      bool               `json:"error"`
+		Status     string             `json:"status"`
+		Message    string             `json:"message"`
+		Attachment *models.Attachment `json:"attachment"`
+	}{
+		Error:      false,
+		Status:     "success",
+		Message:    "File uploaded successfully",
+		Attachment: att,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// removeFiles deletes the stored file and thumbnail of an attachment; failures are only logged
+func (h *AttachmentHandler) removeFiles(ctx context.Context, att *models.Attachment) {
+	if err := h.Files.Delete(ctx, att.StoragePath); err != nil {
+		h.errorLog.Println("removeFiles:", err)
+	}
+	if att.ThumbPath != nil {
+		if err := h.Files.Delete(ctx, *att.ThumbPath); err != nil {
+			h.errorLog.Println("removeFiles:", err)
+		}
+	}
+}
+
+// ListAttachments handles GET /attachments?entity_type=order&entity_id=5
+func (h *AttachmentHandler) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListAttachments: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	entityType := strings.TrimSpace(r.URL.Query().Get("entity_type"))
+	entityID, err := strconv.ParseInt(r.URL.Query().Get("entity_id"), 10, 64)
+	if entityType == "" || err != nil {
+		utils.BadRequest(w, errors.New("entity_type and entity_id are required"))
+		return
+	}
+
+	list, err := h.DB.ListAttachments(r.Context(), branchID, entityType, entityID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListAttachments:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error       bool                 `json:"error"`
+		Status      string               `json:"status"`
+		Attachments []*models.Attachment `json:"attachments"`
+	}{
+		Error:       false,
+		Status:      "success",
+		Attachments: list,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// DownloadAttachment handles GET /attachments/{id}
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, false)
+}
+
+// DownloadThumbnail handles GET /attachments/{id}/thumbnail
+func (h *AttachmentHandler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, true)
+}
+
+// attachmentFor loads the attachment named in the URL from the request's branch
+func (h *AttachmentHandler) attachmentFor(w http.ResponseWriter, r *http.Request, fn string) (*models.Attachment, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if id == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid attachment id"))
+		return nil, false
+	}
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_" + fn + ": Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return nil, false
+	}
+
+	att, err := h.DB.GetAttachment(r.Context(), branchID, id)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_"+fn+":", err)
+		utils.NotFound(w, err.Error())
+		return nil, false
+	}
+	return att, true
+}
+
+// serve writes the file (or thumbnail) of an attachment of the request's branch
+func (h *AttachmentHandler) serve(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	att, ok := h.attachmentFor(w, r, "DownloadAttachment")
+	if !ok {
+		return
+	}
+	key, contentType, name := att.StoragePath, att.ContentType, att.FileName
+	if thumbnail {
+		if att.ThumbPath == nil {
+			utils.NotFound(w, "attachment has no thumbnail")
+			return
+		}
+		key, contentType, name = *att.ThumbPath, "image/jpeg", "thumbnail.jpg"
+	}
+	serveObject(w, r, h.Files, key, contentType, name, h.errorLog)
+}
+
+// GetSignedURL handles GET /attachments/{id}/url[?thumbnail=true]
+// It returns a link that downloads the file without the Authorization header
+// (e.g. for <img src>) until it expires.
+func (h *AttachmentHandler) GetSignedURL(w http.ResponseWriter, r *http.Request) {
+	att, ok := h.attachmentFor(w, r, "GetSignedURL")
+	if !ok {
+		return
+	}
+	key := att.StoragePath
+	if r.URL.Query().Get("thumbnail") == "true" {
+		if att.ThumbPath == nil {
+			utils.NotFound(w, "attachment has no thumbnail")
+			return
+		}
+		key = *att.ThumbPath
+	}
+
+	link, err := h.Files.SignedURL(key, signedURLTTL)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_GetSignedURL:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error     bool      `json:"error"`
+		Status    string    `json:"status"`
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{
+		Error:     false,
+		Status:    "success",
+		URL:       link,
+		ExpiresAt: time.Now().Add(signedURLTTL),
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// DeleteAttachment handles DELETE /attachments/{id}
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if id == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid attachment id"))
+		return
+	}
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_DeleteAttachment: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	att, err := h.DB.DeleteAttachment(r.Context(), branchID, id)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_DeleteAttachment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	// the record is gone; files left behind are only logged
+	h.removeFiles(r.Context(), att)
+
+	resp := struct {
+		Error   bool   `json:"error"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Attachment deleted successfully",
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetUsage handles GET /attachments/usage
+func (h *AttachmentHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetUsage: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	usage, err := h.DB.GetUsage(r.Context(), branchID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetUsage:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error  bool                    `json:"error"`
+		Status string                  `json:"status"`
+		Usage  *models.AttachmentUsage `json:"usage"`
+	}{
+		Error:  false,
+		Status: "success",
+		Usage:  usage,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// SetQuota handles PUT /admin/branches/{id}/attachment-quota
+// Body: {"quota_mb": 2048}
+func (h *AttachmentHandler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if branchID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid branch id"))
+		return
+	}
+	var req struct {
+		QuotaMB int64 `json:"quota_mb"`
+	}
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.errorLog.Println("ERROR_01_SetQuota:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.SetQuota(r.Context(), branchID, req.QuotaMB); err != nil {
+		h.errorLog.Println("ERROR_02_SetQuota:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool   `json:"error"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Attachment quota updated successfully",
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -13,6 +14,8 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+	"github.com/projuktisheba/erp-mini-api/internal/printing"
 	"github.com/projuktisheba/erp-mini-api/internal/utils"
 )
 
@@ -395,35 +398,419 @@ func (c *CustomerHandler) GetCustomersWithDueHandler(w http.ResponseWriter, r *h
 	})
 }
 
-// -------------------- Deduct Customer Due Amount --------------------
-func (c *CustomerHandler) DeductCustomerDueAmount(w http.ResponseWriter, r *http.Request) {
+// -------------------- Receive Customer Payment --------------------
+// Body: {"customer_id": 7, "account_id": 1, "payment_date": "2025-02-03T00:00:00Z", "amount": 500,
+// "allocations": [{"document_type": "order", "document_id": 12, "amount": 300}, ...]}
+// Without allocations the payment settles the oldest open orders and sales first.
+func (c *CustomerHandler) ReceivePayment(w http.ResponseWriter, r *http.Request) {
 	branchID := utils.GetBranchID(r)
 	if branchID == 0 {
-		c.errorLog.Println("ERROR_01_DeductCustomerDueAmount: Branch id not found")
+		c.errorLog.Println("ERROR_01_ReceivePayment: Branch id not found")
 		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
 		return
 	}
-	var requestBody struct {
-		CustomerID int64   `json:"customer_id"`
-		Amount     float64 `json:"amount"`
+
+	var payment models.CustomerPayment
+	if err := utils.ReadJSON(w, r, &payment); err != nil {
+		c.errorLog.Println("ERROR_02_ReceivePayment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	payment.BranchID = branchID
+	if payment.PaymentDate.IsZero() {
+		payment.PaymentDate = utils.Today()
+	}
+
+	result, err := c.DB.ReceivePayment(r.Context(), &payment)
+	if err != nil {
+		c.errorLog.Println("ERROR_03_ReceivePayment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                          `json:"error"`
+		Status  string                        `json:"status"`
+		Message string                        `json:"message"`
+		Payment *models.CustomerPaymentResult `json:"payment"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Amount received successfully",
+		Payment: result,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// -------------------- Get Customer Open Documents --------------------
+func (c *CustomerHandler) GetOpenDocuments(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		c.errorLog.Println("ERROR_01_GetOpenDocuments: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if customerID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid customer id"))
+		return
+	}
+
+	docs, err := c.DB.GetOpenDocuments(r.Context(), branchID, customerID)
+	if err != nil {
+		c.errorLog.Println("ERROR_02_GetOpenDocuments:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error     bool                   `json:"error"`
+		Status    string                 `json:"status"`
+		Documents []*models.OpenDocument `json:"documents"`
+	}{
+		Error:     false,
+		Status:    "success",
+		Documents: docs,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// -------------------- Customer Statement --------------------
+// GetCustomerStatement query: start_date, end_date (default: current month), format (json|pdf|csv)
+// Example: GET /api/v1/customer/7/statement?start_date=2025-01-01&end_date=2025-03-31&format=pdf
+func (c *CustomerHandler) GetCustomerStatement(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		c.errorLog.Println("ERROR_01_GetCustomerStatement: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if customerID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid customer id"))
+		return
+	}
+
+	const dateLayout = "2006-01-02"
+	var startDate, endDate time.Time
+	startDateStr := utils.GetURLParam(r, "start_date")
+	endDateStr := utils.GetURLParam(r, "end_date")
+	if startDateStr == "" || endDateStr == "" {
+		now := time.Now()
+		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		endDate = startDate.AddDate(0, 1, -1)
+	} else {
+		if startDate, err = time.Parse(dateLayout, startDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid start_date format, expected YYYY-MM-DD"))
+			return
+		}
+		if endDate, err = time.Parse(dateLayout, endDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid end_date format, expected YYYY-MM-DD"))
+			return
+		}
 	}
-	c.infoLog.Println(branchID, requestBody)
-	err := utils.ReadJSON(w, r, &requestBody)
+	if endDate.Before(startDate) {
+		utils.BadRequest(w, errors.New("end_date cannot be before start_date"))
+		return
+	}
+
+	format := strings.ToLower(utils.GetURLParam(r, "format"))
+	if format != "" && format != "json" && format != "pdf" && format != "csv" {
+		utils.BadRequest(w, errors.New("format must be json, pdf or csv"))
+		return
+	}
+
+	statement, err := c.DB.GetCustomerStatement(r.Context(), branchID, customerID, startDate, endDate)
 	if err != nil {
-		c.errorLog.Println("ERROR_01_DeductCustomerDueAmount:", err)
+		c.errorLog.Println("ERROR_02_GetCustomerStatement:", err)
 		utils.BadRequest(w, err)
 		return
 	}
 
-	err = c.DB.DeductCustomerDueAmount(r.Context(), requestBody.CustomerID, branchID, requestBody.Amount)
+	fileName := fmt.Sprintf("statement-%d-%s-%s", customerID, startDate.Format(dateLayout), endDate.Format(dateLayout))
+	switch format {
+	case "pdf":
+		data, err := printing.CustomerStatementPDF(statement)
+		if err != nil {
+			c.errorLog.Println("ERROR_03_GetCustomerStatement:", err)
+			utils.ServerError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`.pdf"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`.csv"`)
+		w.WriteHeader(http.StatusOK)
+		if err := printing.WriteCustomerStatementCSV(w, statement); err != nil {
+			c.errorLog.Println("ERROR_04_GetCustomerStatement:", err)
+		}
+	default:
+		resp := struct {
+			Error     bool                      `json:"error"`
+			Status    string                    `json:"status"`
+			Statement *models.CustomerStatement `json:"statement"`
+		}{
+			Error:     false,
+			Status:    "success",
+			Statement: statement,
+		}
+		utils.WriteJSON(w, http.StatusOK, resp)
+	}
+}
+
+// authorizeCreditOverride stamps an order or sale credit override with the
+// signed-in manager who approved it.
+func authorizeCreditOverride(r *http.Request, override *models.CreditOverride) error {
+	if override == nil {
+		return nil
+	}
+	approvedBy, err := authorizeManagerApproval(r, override.Reason)
 	if err != nil {
-		c.errorLog.Println("ERROR_02_DeductCustomerDueAmount:", err)
+		return fmt.Errorf("credit override: %w", err)
+	}
+	override.ApprovedBy = approvedBy
+	return nil
+}
+
+// -------------------- Credit Limits --------------------
+// SetCustomerCreditLimit sets the customer's own credit limit (manager only).
+// Body: {"credit_limit": 5000}; null falls back to the branch default.
+func (c *CustomerHandler) SetCustomerCreditLimit(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		c.errorLog.Println("ERROR_01_SetCustomerCreditLimit: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if customerID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid customer id"))
+		return
+	}
+	var body struct {
+		CreditLimit *money.Amount `json:"credit_limit"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		c.errorLog.Println("ERROR_02_SetCustomerCreditLimit:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := c.DB.SetCustomerCreditLimit(r.Context(), branchID, customerID, body.CreditLimit); err != nil {
+		c.errorLog.Println("ERROR_03_SetCustomerCreditLimit:", err)
 		utils.BadRequest(w, err)
 		return
 	}
 
 	var resp models.Response
 	resp.Error = false
-	resp.Message = "Amount received successfully"
+	resp.Message = "Credit limit updated successfully"
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// SetBranchCreditLimit sets the default credit limit of a branch (chairman only).
+// Body: {"credit_limit": 3000}; null removes the default.
+func (c *CustomerHandler) SetBranchCreditLimit(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if branchID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid branch id"))
+		return
+	}
+	var body struct {
+		CreditLimit *money.Amount `json:"credit_limit"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		c.errorLog.Println("ERROR_01_SetBranchCreditLimit:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := c.DB.SetBranchCreditLimit(r.Context(), branchID, body.CreditLimit); err != nil {
+		c.errorLog.Println("ERROR_02_SetBranchCreditLimit:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	var resp models.Response
+	resp.Error = false
+	resp.Message = "Branch credit limit updated successfully"
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// -------------------- Store Credit --------------------
+// GetStoreCredit query: start_date, end_date (default: current month)
+// Example: GET /api/v1/customer/7/store-credit?start_date=2025-01-01&end_date=2025-03-31
+func (c *CustomerHandler) GetStoreCredit(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		c.errorLog.Println("ERROR_01_GetStoreCredit: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if customerID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid customer id"))
+		return
+	}
+
+	const dateLayout = "2006-01-02"
+	var startDate, endDate time.Time
+	startDateStr := utils.GetURLParam(r, "start_date")
+	endDateStr := utils.GetURLParam(r, "end_date")
+	if startDateStr == "" || endDateStr == "" {
+		now := time.Now()
+		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		endDate = startDate.AddDate(0, 1, -1)
+	} else {
+		if startDate, err = time.Parse(dateLayout, startDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid start_date format, expected YYYY-MM-DD"))
+			return
+		}
+		if endDate, err = time.Parse(dateLayout, endDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid end_date format, expected YYYY-MM-DD"))
+			return
+		}
+	}
+	if endDate.Before(startDate) {
+		utils.BadRequest(w, errors.New("end_date cannot be before start_date"))
+		return
+	}
+
+	history, err := c.DB.GetStoreCredit(r.Context(), branchID, customerID, startDate, endDate)
+	if err != nil {
+		c.errorLog.Println("ERROR_02_GetStoreCredit:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error       bool                       `json:"error"`
+		Status      string                     `json:"status"`
+		StoreCredit *models.StoreCreditHistory `json:"store_credit"`
+	}{
+		Error:       false,
+		Status:      "success",
+		StoreCredit: history,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// TopUpStoreCredit receives money into an account as store credit.
+// Body: {"customer_id": 7, "account_id": 1, "amount": 500, "entry_date": "2025-02-03T00:00:00Z", "notes": ""}
+func (c *CustomerHandler) TopUpStoreCredit(w http.ResponseWriter, r *http.Request) {
+	c.postStoreCredit(w, r, "TopUpStoreCredit", "Store credit added successfully", c.DB.TopUpStoreCredit)
+}
+
+// WithdrawStoreCredit pays store credit back to the customer from an account.
+// Body: {"customer_id": 7, "account_id": 1, "amount": 200}
+func (c *CustomerHandler) WithdrawStoreCredit(w http.ResponseWriter, r *http.Request) {
+	c.postStoreCredit(w, r, "WithdrawStoreCredit", "Store credit paid out successfully", c.DB.WithdrawStoreCredit)
+}
+
+// RefundToStoreCredit returns money paid on an order or sale as store credit.
+// Body: {"customer_id": 7, "document_type": "order", "document_id": 12, "amount": 300}
+func (c *CustomerHandler) RefundToStoreCredit(w http.ResponseWriter, r *http.Request) {
+	c.postStoreCredit(w, r, "RefundToStoreCredit", "Amount refunded to store credit successfully", c.DB.RefundToStoreCredit)
+}
+
+func (c *CustomerHandler) postStoreCredit(w http.ResponseWriter, r *http.Request, name, message string,
+	post func(context.Context, *models.StoreCreditRequest) (*models.StoreCreditEntry, error)) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		c.errorLog.Println("ERROR_01_" + name + ": Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var req models.StoreCreditRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		c.errorLog.Println("ERROR_02_"+name+":", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	req.BranchID = branchID
+	if req.EntryDate.IsZero() {
+		req.EntryDate = utils.Today()
+	}
+
+	entry, err := post(r.Context(), &req)
+	if err != nil {
+		c.errorLog.Println("ERROR_03_"+name+":", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                     `json:"error"`
+		Status  string                   `json:"status"`
+		Message string                   `json:"message"`
+		Entry   *models.StoreCreditEntry `json:"entry"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: message,
+		Entry:   entry,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// -------------------- Loyalty Points --------------------
+// GetLoyaltyPoints query: start_date, end_date (default: current month)
+// Example: GET /api/v1/customer/7/loyalty?start_date=2025-01-01&end_date=2025-03-31
+func (c *CustomerHandler) GetLoyaltyPoints(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		c.errorLog.Println("ERROR_01_GetLoyaltyPoints: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if customerID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid customer id"))
+		return
+	}
+
+	const dateLayout = "2006-01-02"
+	var startDate, endDate time.Time
+	startDateStr := utils.GetURLParam(r, "start_date")
+	endDateStr := utils.GetURLParam(r, "end_date")
+	if startDateStr == "" || endDateStr == "" {
+		now := time.Now()
+		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		endDate = startDate.AddDate(0, 1, -1)
+	} else {
+		if startDate, err = time.Parse(dateLayout, startDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid start_date format, expected YYYY-MM-DD"))
+			return
+		}
+		if endDate, err = time.Parse(dateLayout, endDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid end_date format, expected YYYY-MM-DD"))
+			return
+		}
+	}
+	if endDate.Before(startDate) {
+		utils.BadRequest(w, errors.New("end_date cannot be before start_date"))
+		return
+	}
+
+	history, err := c.DB.GetLoyaltyPoints(r.Context(), branchID, customerID, startDate, endDate)
+	if err != nil {
+		c.errorLog.Println("ERROR_02_GetLoyaltyPoints:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                   `json:"error"`
+		Status  string                 `json:"status"`
+		Loyalty *models.LoyaltyHistory `json:"loyalty"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Loyalty: history,
+	}
 	utils.WriteJSON(w, http.StatusOK, resp)
 }
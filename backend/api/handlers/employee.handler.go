@@ -3,20 +3,19 @@ package api
 import (
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
-	"os"
-
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/attachment"
 	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
 	"github.com/projuktisheba/erp-mini-api/internal/utils"
 )
 
@@ -30,13 +29,15 @@ var RoleMap = map[string]bool{
 
 type EmployeeHandler struct {
 	DB       *dbrepo.EmployeeRepo
+	Files    storage.Store // profile pictures
 	infoLog  *log.Logger
 	errorLog *log.Logger
 }
 
-func NewEmployeeHandler(db *dbrepo.EmployeeRepo, infoLog *log.Logger, errorLog *log.Logger) *EmployeeHandler {
+func NewEmployeeHandler(db *dbrepo.EmployeeRepo, files storage.Store, infoLog *log.Logger, errorLog *log.Logger) *EmployeeHandler {
 	return &EmployeeHandler{
 		DB:       db,
+		Files:    files,
 		infoLog:  infoLog,
 		errorLog: errorLog,
 	}
@@ -374,7 +375,7 @@ func (e *EmployeeHandler) UploadEmployeeProfilePicture(w http.ResponseWriter, r
 	}
 
 	// --- Step 3: Get file from form field "profile_picture" ---
-	file, handler, err := r.FormFile("profile_picture")
+	file, _, err := r.FormFile("profile_picture")
 	if err != nil {
 		e.errorLog.Println("ERROR_04_UploadEmployeeProfilePicture:", err)
 		utils.BadRequest(w, errors.New("profile_picture field is required"))
@@ -382,46 +383,25 @@ func (e *EmployeeHandler) UploadEmployeeProfilePicture(w http.ResponseWriter, r
 	}
 	defer file.Close()
 
-	// --- Step 4: Validate file extension (only jpg, jpeg, png allowed) ---
-	ext := strings.ToLower(filepath.Ext(handler.Filename))
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
-		e.errorLog.Println("ERROR_05_UploadEmployeeProfilePicture: Invalid file type")
-		utils.BadRequest(w, errors.New("only jpg, jpeg, png files are allowed"))
-		return
-	}
-
-	// --- Step 5: Build directory path ./data/images/employee_{id} ---
-	uploadDir := filepath.Join(".", "data", "images", fmt.Sprintf("employee_%d", id))
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		e.errorLog.Println("ERROR_06_UploadEmployeeProfilePicture:", err)
-		utils.BadRequest(w, err)
-		return
+	// --- Step 4: Read the file; only jpg and png content is allowed ---
+	data, contentType, err := attachment.Read(file)
+	if err == nil && contentType != "image/jpeg" && contentType != "image/png" {
+		err = errors.New("only jpg, jpeg, png files are allowed")
 	}
-
-	// --- Step 6: Build final file path ./data/images/employee_{id}/profile{ext} ---
-	filePath := filepath.Join(uploadDir, "profile"+ext)
-	dst, err := os.Create(filePath)
 	if err != nil {
-		e.errorLog.Println("ERROR_07_UploadEmployeeProfilePicture:", err)
-		utils.BadRequest(w, err)
-		return
-	}
-	defer dst.Close()
-
-	// --- Step 7: Copy file content to destination ---
-	if _, err := io.Copy(dst, file); err != nil {
-		e.errorLog.Println("ERROR_08_UploadEmployeeProfilePicture:", err)
+		e.errorLog.Println("ERROR_05_UploadEmployeeProfilePicture:", err)
 		utils.BadRequest(w, err)
 		return
 	}
 
-	// --- Step 8: check whether profile picture is saved ---
-	if _, err := os.Stat(filePath); err != nil {
-		e.errorLog.Println("ERROR_09_UploadEmployeeProfilePicture: File not saved", err)
-		utils.BadRequest(w, errors.New("profile picture not saved"))
+	// --- Step 5: Store as images/employee_{id}/profile{ext} ---
+	key := fmt.Sprintf("images/employee_%d/profile%s", id, attachment.Ext(contentType))
+	if err := e.Files.Put(r.Context(), key, data, contentType); err != nil {
+		e.errorLog.Println("ERROR_06_UploadEmployeeProfilePicture:", err)
+		utils.ServerError(w, err)
 		return
 	}
-	avatarLink := fmt.Sprintf("/images/employee_%d/profile%s", id, ext) ///images/employee_1/profile.png
+	avatarLink := storage.FilesPath + key // /api/v1/files/images/employee_1/profile.png
 
 	err = e.DB.UpdateEmployeeAvatarLink(r.Context(), id, avatarLink)
 	if err != nil {
@@ -449,10 +429,10 @@ func (e *EmployeeHandler) UploadEmployeeProfilePicture(w http.ResponseWriter, r
 // SaveSalaryRecord record employee salary
 func (e *EmployeeHandler) SaveSalaryRecord(w http.ResponseWriter, r *http.Request) {
 	var salary struct {
-		EmployeeID       int64     `json:"employee_id"`
-		PaymentAccountID int64     `json:"payment_account_id"`
-		Amount           float64   `json:"amount"`
-		PaymentDate      time.Time `json:"payment_date"`
+		EmployeeID       int64        `json:"employee_id"`
+		PaymentAccountID int64        `json:"payment_account_id"`
+		Amount           money.Amount `json:"amount"`
+		PaymentDate      time.Time    `json:"payment_date"`
 	}
 	err := utils.ReadJSON(w, r, &salary)
 	if err != nil {
@@ -505,10 +485,10 @@ func (e *EmployeeHandler) UpdateSalaryRecord(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	var salary struct {
-		EmployeeID       int64     `json:"employee_id"`
-		Amount           float64   `json:"amount"`
-		PaymentAccountID int64     `json:"payment_account_id"`
-		PaymentDate      time.Time `json:"payment_date"`
+		EmployeeID       int64        `json:"employee_id"`
+		Amount           money.Amount `json:"amount"`
+		PaymentAccountID int64        `json:"payment_account_id"`
+		PaymentDate      time.Time    `json:"payment_date"`
 	}
 	err = utils.ReadJSON(w, r, &salary)
 	if err != nil {
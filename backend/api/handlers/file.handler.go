@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// FileHandler serves stored files by key: employee pictures through stable
+// links such as avatar_link, and the local store's signed links
+type FileHandler struct {
+	Files    storage.Store
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewFileHandler(files storage.Store, infoLog *log.Logger, errorLog *log.Logger) *FileHandler {
+	return &FileHandler{
+		Files:    files,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// publicKeyPrefix is the part of the store any signed-in user may read by key.
+// Attachments are read through /attachments/{id}, which checks the branch.
+const publicKeyPrefix = "images/"
+
+// serveObject copies a stored file to the response
+func serveObject(w http.ResponseWriter, r *http.Request, files storage.Store, key, contentType, name string, errorLog *log.Logger) {
+	obj, err := files.Open(r.Context(), key)
+	if err != nil {
+		errorLog.Println("serveObject:", err)
+		if errors.Is(err, storage.ErrNotFound) {
+			utils.NotFound(w, "file not found")
+			return
+		}
+		utils.ServerError(w, err)
+		return
+	}
+	defer obj.Close()
+
+	if contentType == "" {
+		contentType = obj.ContentType
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if obj.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	if !obj.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", `inline; filename="`+strings.ReplaceAll(name, `"`, "")+`"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, obj); err != nil {
+		errorLog.Println("serveObject:", err)
+	}
+}
+
+// ServeSignedFile handles GET /files/{key}?expires=…&signature=… for links
+// made by the local store; it needs no Authorization header
+func (h *FileHandler) ServeSignedFile(w http.ResponseWriter, r *http.Request) {
+	local, ok := h.Files.(*storage.Local)
+	if !ok {
+		utils.NotFound(w, "")
+		return
+	}
+	key := chi.URLParam(r, "*")
+	q := r.URL.Query()
+	if err := local.Verify(key, q.Get("expires"), q.Get("signature")); err != nil {
+		h.errorLog.Println("ERROR_01_ServeSignedFile:", err)
+		utils.WriteJSON(w, http.StatusForbidden, struct {
+			Error   bool   `json:"error"`
+			Message string `json:"message"`
+		}{Error: true, Message: err.Error()})
+		return
+	}
+	serveObject(w, r, h.Files, key, "", path.Base(key), h.errorLog)
+}
+
+// RedirectToFile handles GET /files/images/… for signed-in users: it sends them
+// on to a short-lived signed link of the file, so stored links keep working
+// whichever store holds it
+func (h *FileHandler) RedirectToFile(w http.ResponseWriter, r *http.Request) {
+	h.redirect(w, r, chi.URLParam(r, "*"))
+}
+
+// RedirectImage handles GET /images/… links saved before files moved into the store
+func (h *FileHandler) RedirectImage(w http.ResponseWriter, r *http.Request) {
+	h.redirect(w, r, publicKeyPrefix+chi.URLParam(r, "*"))
+}
+
+func (h *FileHandler) redirect(w http.ResponseWriter, r *http.Request, key string) {
+	key, err := storage.CleanKey(key)
+	if err != nil || !strings.HasPrefix(key, publicKeyPrefix) {
+		utils.NotFound(w, "")
+		return
+	}
+	link, err := h.Files.SignedURL(key, signedURLTTL)
+	if err != nil {
+		h.errorLog.Println("ERROR_01_RedirectToFile:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	http.Redirect(w, r, link, http.StatusFound)
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/printing"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
 )
 
 type HandlerRepo struct {
@@ -18,19 +20,45 @@ type HandlerRepo struct {
 	Report *ReportHandler
 	Supplier *SupplierHandler
 	Purchase *PurchaseHandler
+	Reconciliation *ReconciliationHandler
+	Aggregate *AggregateHandler
+	Period *PeriodHandler
+	Measurement *MeasurementHandler
+	Attachment *AttachmentHandler
+	File *FileHandler
+	Invoice *InvoiceHandler
+	PrintJob *PrintJobHandler
+	Memo *MemoHandler
+	Promotion *PromotionHandler
+	Tax *TaxHandler
+	Voucher *VoucherHandler
+	Loyalty *LoyaltyHandler
 }
 
-func NewHandlerRepo( db *dbrepo.DBRepository,JWT models.JWTConfig, infoLog *log.Logger, errorLog *log.Logger) *HandlerRepo {
+func NewHandlerRepo( db *dbrepo.DBRepository,JWT models.JWTConfig, files storage.Store, fonts *printing.Fonts, infoLog *log.Logger, errorLog *log.Logger) *HandlerRepo {
 	return &HandlerRepo{
-		Employee: *NewEmployeeHandler(db.EmployeeRepo, infoLog, errorLog),
+		Employee: *NewEmployeeHandler(db.EmployeeRepo, files, infoLog, errorLog),
 		Auth: *NewAuthHandler( db,JWT, infoLog, errorLog),
 		Customer: *NewCustomerHandler(db.CustomerRepo, infoLog, errorLog),
-		Order: *NewOrderHandler(db.OrderRepo, infoLog, errorLog),
+		Order: *NewOrderHandler(db.OrderRepo, files, fonts, infoLog, errorLog),
 		Transaction: *NewTransactionHandler(db.TransactionRepo, infoLog, errorLog),
 		Account: NewAccountHandler(db.AccountRepo,infoLog,errorLog),
 		Product: NewProductHandler(db.ProductRepo, infoLog, errorLog),
 		Report: NewReportHandler(db.ReportRepo, infoLog, errorLog),
 		Supplier: NewSupplierHandler(db.SupplierRepo, infoLog, errorLog),
 		Purchase: NewPurchaseHandler(db.PurchaseRepo, infoLog, errorLog),
+		Reconciliation: NewReconciliationHandler(db.ReconciliationRepo, infoLog, errorLog),
+		Aggregate: NewAggregateHandler(db.AggregateRepo, infoLog, errorLog),
+		Period: NewPeriodHandler(db.PeriodRepo, infoLog, errorLog),
+		Measurement: NewMeasurementHandler(db.MeasurementRepo, infoLog, errorLog),
+		Attachment: NewAttachmentHandler(db.AttachmentRepo, files, infoLog, errorLog),
+		File: NewFileHandler(files, infoLog, errorLog),
+		Invoice: NewInvoiceHandler(db.InvoiceRepo, files, fonts, infoLog, errorLog),
+		PrintJob: NewPrintJobHandler(db.PrintJobRepo, db.InvoiceRepo, fonts, infoLog, errorLog),
+		Memo: NewMemoHandler(db.MemoRepo, infoLog, errorLog),
+		Promotion: NewPromotionHandler(db.PromotionRepo, infoLog, errorLog),
+		Tax: NewTaxHandler(db.TaxRepo, infoLog, errorLog),
+		Voucher: NewVoucherHandler(db.VoucherRepo, infoLog, errorLog),
+		Loyalty: NewLoyaltyHandler(db.LoyaltyRepo, infoLog, errorLog),
 	}
 }
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// installmentPlan reads the request into the installments of a plan; equal
+// installments are left without an amount for the repo to share the due
+func installmentPlan(req *models.InstallmentPlanRequest) ([]models.Installment, error) {
+	var plan []models.Installment
+	for _, in := range req.Installments {
+		dueDate, err := time.Parse("2006-01-02", strings.TrimSpace(in.DueDate))
+		if err != nil {
+			return nil, errors.New("invalid due_date format, expected YYYY-MM-DD")
+		}
+		plan = append(plan, models.Installment{DueDate: dueDate, Amount: in.Amount, Notes: in.Notes})
+	}
+	if len(plan) > 0 {
+		return plan, nil
+	}
+
+	if req.Count <= 0 || req.Count > 60 {
+		return nil, errors.New("send installments, or a count between 1 and 60 with first_due_date")
+	}
+	first, err := time.Parse("2006-01-02", strings.TrimSpace(req.FirstDueDate))
+	if err != nil {
+		return nil, errors.New("invalid first_due_date format, expected YYYY-MM-DD")
+	}
+	interval := req.IntervalMonths
+	if interval <= 0 {
+		interval = 1
+	}
+	for i := 0; i < req.Count; i++ {
+		plan = append(plan, models.Installment{DueDate: first.AddDate(0, i*interval, 0)})
+	}
+	return plan, nil
+}
+
+// GetInstallments handles GET /orders/{id}/installments
+func (o *OrderHandler) GetInstallments(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if orderID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("invalid order ID"))
+		return
+	}
+
+	installments, err := o.DB.GetInstallments(r.Context(), orderID)
+	if err != nil {
+		o.errorLog.Println("GetInstallments_DB:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error        bool                 `json:"error"`
+		Installments []models.Installment `json:"installments"`
+	}{
+		Error:        false,
+		Installments: installments,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// SetInstallmentPlan handles PUT /orders/{id}/installments and schedules what
+// is still due on the order, replacing any plan it had.
+// Body: {"installments":[{"due_date":"2026-03-01","amount":500},{"due_date":"2026-04-01"}]}
+// or {"count":3,"first_due_date":"2026-03-01","interval_months":1} for equal installments
+func (o *OrderHandler) SetInstallmentPlan(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		o.errorLog.Println("ERROR_01_SetInstallmentPlan: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if orderID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("invalid order ID"))
+		return
+	}
+	var req models.InstallmentPlanRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		o.errorLog.Println("ERROR_02_SetInstallmentPlan:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	plan, err := installmentPlan(&req)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	installments, err := o.DB.SetInstallmentPlan(r.Context(), branchID, orderID, plan)
+	if err != nil {
+		o.errorLog.Println("ERROR_03_SetInstallmentPlan:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error        bool                 `json:"error"`
+		Message      string               `json:"message"`
+		Installments []models.Installment `json:"installments"`
+	}{
+		Error:        false,
+		Message:      "Installment plan saved successfully",
+		Installments: installments,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// ReceiveInstallment handles POST /orders/{id}/payments and records money paid
+// on an order before or between deliveries.
+// Body: {"payment_date":"2026-03-01T00:00:00Z","payments":[{"account_id":1,"amount":300},{"account_id":2,"amount":200,"reference":"TRX-889"}]}
+func (o *OrderHandler) ReceiveInstallment(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		o.errorLog.Println("ERROR_01_ReceiveInstallment: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if orderID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("invalid order ID"))
+		return
+	}
+	var payment models.InstallmentPayment
+	if err := utils.ReadJSON(w, r, &payment); err != nil {
+		o.errorLog.Println("ERROR_02_ReceiveInstallment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	payment.OrderID = orderID
+	payment.BranchID = branchID
+	if payment.PaymentDate.IsZero() {
+		payment.PaymentDate = utils.Today()
+	}
+
+	result, err := o.DB.ReceiveInstallment(r.Context(), &payment)
+	if err != nil {
+		o.errorLog.Println("ERROR_03_ReceiveInstallment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                             `json:"error"`
+		Message string                           `json:"message"`
+		Payment *models.InstallmentPaymentResult `json:"payment"`
+	}{
+		Error:   false,
+		Message: "Payment recorded successfully",
+		Payment: result,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/printing"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// InvoiceHandler prints invoices, delivery notes and refund receipts
+type InvoiceHandler struct {
+	DB       *dbrepo.InvoiceRepo
+	Files    storage.Store
+	Fonts    *printing.Fonts
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewInvoiceHandler(db *dbrepo.InvoiceRepo, files storage.Store, fonts *printing.Fonts, infoLog *log.Logger, errorLog *log.Logger) *InvoiceHandler {
+	return &InvoiceHandler{
+		DB:       db,
+		Files:    files,
+		Fonts:    fonts,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// maxLogoSize is the largest logo read for the letterhead
+const maxLogoSize = 2 << 20
+
+// branchLogo reads the logo printed on the letterhead from logo_link: a link
+// into the file store (/api/v1/files/…, /api/v1/images/…) or an http(s) URL.
+// A logo that cannot be read is left out.
+func (h *InvoiceHandler) branchLogo(ctx context.Context, link string) image.Image {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return nil
+	}
+	var rc io.ReadCloser
+	switch {
+	case strings.HasPrefix(link, "http://"), strings.HasPrefix(link, "https://"):
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+		if err != nil {
+			h.errorLog.Println("branchLogo:", err)
+			return nil
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			h.errorLog.Println("branchLogo:", err)
+			return nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			h.errorLog.Println("branchLogo:", link, resp.Status)
+			return nil
+		}
+		rc = resp.Body
+	default:
+		key := strings.TrimPrefix(link, storage.FilesPath)
+		if rest, ok := strings.CutPrefix(link, "/api/v1/images/"); ok {
+			key = "images/" + rest
+		} else if rest, ok := strings.CutPrefix(link, "/images/"); ok {
+			key = "images/" + rest
+		}
+		obj, err := h.Files.Open(ctx, key)
+		if err != nil {
+			h.errorLog.Println("branchLogo:", err)
+			return nil
+		}
+		rc = obj
+	}
+	defer rc.Close()
+	img, _, err := image.Decode(io.LimitReader(rc, maxLogoSize))
+	if err != nil {
+		h.errorLog.Println("branchLogo:", err)
+		return nil
+	}
+	return img
+}
+
+// writeInvoice renders inv in the language asked for (?lang=en|ar) and sends it
+func (h *InvoiceHandler) writeInvoice(w http.ResponseWriter, r *http.Request, inv *models.Invoice, caller string) {
+	lang := utils.GetURLParam(r, "lang")
+	if lang == "" {
+		lang = models.INVOICE_ENGLISH
+	}
+	data, err := printing.InvoicePDF(inv, lang, h.Fonts, h.branchLogo(r.Context(), inv.Branch.LogoLink))
+	if errors.Is(err, printing.ErrNoArabicFont) {
+		h.errorLog.Println("ERROR_03_"+caller+":", err)
+		utils.ServerError(w, err)
+		return
+	}
+	if err != nil {
+		h.errorLog.Println("ERROR_03_"+caller+":", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	name := inv.Kind + "-" + inv.MemoNo
+	if inv.Reference != "" {
+		name += "-" + inv.Reference
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s-%s.pdf"`, strings.ReplaceAll(name, `"`, ""), lang))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// invoiceQuery reads ?type= (defaulting to def) and ?transaction_id=
+func invoiceQuery(r *http.Request, def string) (kind string, txID int64, err error) {
+	kind = utils.GetURLParam(r, "type")
+	if kind == "" {
+		kind = def
+	}
+	if v := utils.GetURLParam(r, "transaction_id"); v != "" {
+		if txID, err = strconv.ParseInt(v, 10, 64); err != nil || txID <= 0 {
+			return "", 0, errors.New("invalid transaction_id")
+		}
+	}
+	return kind, txID, nil
+}
+
+// GetOrderInvoice handles GET /orders/{id}/invoice.pdf
+// Query: type=order|delivery|refund (default order), transaction_id (delivery
+// or refund to print, default the latest), lang=en|ar (default en)
+func (h *InvoiceHandler) GetOrderInvoice(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if orderID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid order id"))
+		return
+	}
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetOrderInvoice: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	kind, txID, err := invoiceQuery(r, models.INVOICE_ORDER)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	inv, err := h.DB.OrderInvoice(r.Context(), orderID, kind, txID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetOrderInvoice:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if inv.Branch.ID != branchID {
+		utils.BadRequest(w, errors.New("order not found in this branch"))
+		return
+	}
+	h.writeInvoice(w, r, inv, "GetOrderInvoice")
+}
+
+// GetSaleInvoice handles GET /sales/details/{sale_id}/invoice.pdf
+// Query: type=sale|refund (default sale), transaction_id (refund to print,
+// default the latest), lang=en|ar (default en)
+func (h *InvoiceHandler) GetSaleInvoice(w http.ResponseWriter, r *http.Request) {
+	saleID, err := strconv.ParseInt(chi.URLParam(r, "sale_id"), 10, 64)
+	if saleID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid sale id"))
+		return
+	}
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetSaleInvoice: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	kind, txID, err := invoiceQuery(r, models.INVOICE_SALE)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	inv, err := h.DB.SaleInvoice(r.Context(), saleID, kind, txID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetSaleInvoice:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if inv.Branch.ID != branchID {
+		utils.BadRequest(w, errors.New("sale not found in this branch"))
+		return
+	}
+	h.writeInvoice(w, r, inv, "GetSaleInvoice")
+}
+
+// documentInvoice loads an order's or sale's invoice, checking that the
+// document belongs to the branch
+func documentInvoice(ctx context.Context, db *dbrepo.InvoiceRepo, branchID int64, docType string, docID int64, kind string, txID int64) (*models.Invoice, error) {
+	var inv *models.Invoice
+	var err error
+	switch docType {
+	case models.PRINT_DOCUMENT_ORDER:
+		if kind == "" {
+			kind = models.INVOICE_ORDER
+		}
+		inv, err = db.OrderInvoice(ctx, docID, kind, txID)
+	case models.PRINT_DOCUMENT_SALE:
+		if kind == "" {
+			kind = models.INVOICE_SALE
+		}
+		inv, err = db.SaleInvoice(ctx, docID, kind, txID)
+	default:
+		return nil, fmt.Errorf("receipts are printed for an %s or a %s", models.PRINT_DOCUMENT_ORDER, models.PRINT_DOCUMENT_SALE)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if inv.Branch.ID != branchID {
+		return nil, fmt.Errorf("%s not found in this branch", docType)
+	}
+	return inv, nil
+}
+
+// receiptQuery reads ?lang= and ?paper= (width in mm, default 80)
+func receiptQuery(r *http.Request) (lang string, paper int, err error) {
+	lang = utils.GetURLParam(r, "lang")
+	if lang == "" {
+		lang = models.INVOICE_ENGLISH
+	}
+	paper = printing.Receipt80mm
+	if v := utils.GetURLParam(r, "paper"); v != "" {
+		if paper, err = strconv.Atoi(v); err != nil {
+			return "", 0, errors.New("invalid paper width")
+		}
+	}
+	return lang, paper, nil
+}
+
+// writeReceipt renders a document as an ESC/POS thermal receipt and sends it
+func (h *InvoiceHandler) writeReceipt(w http.ResponseWriter, r *http.Request, docType, param, caller string) {
+	docID, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if docID == 0 || err != nil {
+		utils.BadRequest(w, fmt.Errorf("Invalid %s id", docType))
+		return
+	}
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_" + caller + ": Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	kind, txID, err := invoiceQuery(r, "")
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+	lang, paper, err := receiptQuery(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	inv, err := documentInvoice(r.Context(), h.DB, branchID, docType, docID, kind, txID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_"+caller+":", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	data, err := printing.ReceiptESCPOS(inv, lang, h.Fonts, paper)
+	if errors.Is(err, printing.ErrNoArabicFont) {
+		h.errorLog.Println("ERROR_03_"+caller+":", err)
+		utils.ServerError(w, err)
+		return
+	}
+	if err != nil {
+		h.errorLog.Println("ERROR_03_"+caller+":", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-%s.bin"`, inv.Kind, strings.ReplaceAll(inv.MemoNo, `"`, ""), lang))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// GetOrderReceipt handles GET /orders/{id}/receipt.escpos
+// Query: as GetOrderInvoice, and paper=80|58 (mm, default 80)
+func (h *InvoiceHandler) GetOrderReceipt(w http.ResponseWriter, r *http.Request) {
+	h.writeReceipt(w, r, models.PRINT_DOCUMENT_ORDER, "id", "GetOrderReceipt")
+}
+
+// GetSaleReceipt handles GET /sales/details/{sale_id}/receipt.escpos
+// Query: as GetSaleInvoice, and paper=80|58 (mm, default 80)
+func (h *InvoiceHandler) GetSaleReceipt(w http.ResponseWriter, r *http.Request) {
+	h.writeReceipt(w, r, models.PRINT_DOCUMENT_SALE, "sale_id", "GetSaleReceipt")
+}
+
+// SetInvoiceTerms sets the terms printed under a branch's invoices (chairman only).
+// Body: {"invoice_terms": "...", "invoice_terms_ar": "..."}
+func (h *InvoiceHandler) SetInvoiceTerms(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if branchID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid branch id"))
+		return
+	}
+	var body struct {
+		InvoiceTerms   string `json:"invoice_terms"`
+		InvoiceTermsAr string `json:"invoice_terms_ar"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_01_SetInvoiceTerms:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.SetInvoiceTerms(r.Context(), branchID, body.InvoiceTerms, body.InvoiceTermsAr); err != nil {
+		h.errorLog.Println("ERROR_02_SetInvoiceTerms:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	var resp models.Response
+	resp.Error = false
+	resp.Message = "Invoice terms updated successfully"
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
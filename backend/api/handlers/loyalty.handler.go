@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// LoyaltyHandler manages the rules customers earn and redeem loyalty points under
+type LoyaltyHandler struct {
+	DB       *dbrepo.LoyaltyRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewLoyaltyHandler(db *dbrepo.LoyaltyRepo, infoLog *log.Logger, errorLog *log.Logger) *LoyaltyHandler {
+	return &LoyaltyHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// loyaltyRuleRequest is the body of a new or changed loyalty rule
+type loyaltyRuleRequest struct {
+	Name            string       `json:"name"`
+	AmountPerPoint  money.Amount `json:"amount_per_point"`
+	PointValue      money.Amount `json:"point_value"`
+	ExpiryMonths    int          `json:"expiry_months"`
+	MinRedeemPoints int64        `json:"min_redeem_points"`
+	StartsOn        string       `json:"starts_on"`
+	Active          *bool        `json:"active"`       // default true
+	AllBranches     bool         `json:"all_branches"` // chairman only
+}
+
+// loyaltyRule reads the request into a loyalty rule of the branch
+func (req *loyaltyRuleRequest) loyaltyRule(r *http.Request, branchID int64) (*models.LoyaltyRule, error) {
+	l := &models.LoyaltyRule{
+		BranchID:        &branchID,
+		Name:            req.Name,
+		AmountPerPoint:  req.AmountPerPoint,
+		PointValue:      req.PointValue,
+		ExpiryMonths:    req.ExpiryMonths,
+		MinRedeemPoints: req.MinRedeemPoints,
+		Active:          req.Active == nil || *req.Active,
+	}
+	var err error
+	if l.StartsOn, err = time.Parse("2006-01-02", req.StartsOn); err != nil {
+		return nil, errors.New("invalid starts_on format, expected YYYY-MM-DD")
+	}
+	if req.AllBranches {
+		if user, ok := utils.UserFromContext(r.Context()); !ok || utils.Role(user.Role) != utils.RoleChairman {
+			return nil, errors.New("only the chairman can set a loyalty rule for every branch")
+		}
+		l.BranchID = nil
+	}
+	return l, nil
+}
+
+// ListLoyaltyRules returns the loyalty rules that apply in the branch.
+// Example: GET /api/v1/loyalty-rules
+func (h *LoyaltyHandler) ListLoyaltyRules(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListLoyaltyRules: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	rules, err := h.DB.ListLoyaltyRules(r.Context(), branchID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListLoyaltyRules:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error        bool                  `json:"error"`
+		LoyaltyRules []*models.LoyaltyRule `json:"loyalty_rules"`
+	}{
+		Error:        false,
+		LoyaltyRules: rules,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// CreateLoyaltyRule adds a loyalty rule to the branch, or to every branch (chairman only).
+// Body: {"name":"Standard","amount_per_point":100,"point_value":1,"expiry_months":12,"min_redeem_points":50,"starts_on":"2026-01-01"}
+func (h *LoyaltyHandler) CreateLoyaltyRule(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_CreateLoyaltyRule: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	var req loyaltyRuleRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.errorLog.Println("ERROR_02_CreateLoyaltyRule:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	rule, err := req.loyaltyRule(r, branchID)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.CreateLoyaltyRule(r.Context(), rule); err != nil {
+		h.errorLog.Println("ERROR_03_CreateLoyaltyRule:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error       bool                `json:"error"`
+		Message     string              `json:"message"`
+		LoyaltyRule *models.LoyaltyRule `json:"loyalty_rule"`
+	}{
+		Error:       false,
+		Message:     "Loyalty rule created successfully",
+		LoyaltyRule: rule,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// UpdateLoyaltyRule changes a loyalty rule; the body is the one of
+// CreateLoyaltyRule. Points already earned keep their expiry.
+func (h *LoyaltyHandler) UpdateLoyaltyRule(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_UpdateLoyaltyRule: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if ruleID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid loyalty rule id"))
+		return
+	}
+	var req loyaltyRuleRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.errorLog.Println("ERROR_02_UpdateLoyaltyRule:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	rule, err := req.loyaltyRule(r, branchID)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+	rule.ID = ruleID
+
+	if err := h.DB.UpdateLoyaltyRule(r.Context(), branchID, rule); err != nil {
+		h.errorLog.Println("ERROR_03_UpdateLoyaltyRule:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error       bool                `json:"error"`
+		Message     string              `json:"message"`
+		LoyaltyRule *models.LoyaltyRule `json:"loyalty_rule"`
+	}{
+		Error:       false,
+		Message:     "Loyalty rule updated successfully",
+		LoyaltyRule: rule,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
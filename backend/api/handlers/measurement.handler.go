@@ -0,0 +1,387 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+type MeasurementHandler struct {
+	DB       *dbrepo.MeasurementRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewMeasurementHandler(db *dbrepo.MeasurementRepo, infoLog *log.Logger, errorLog *log.Logger) *MeasurementHandler {
+	return &MeasurementHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// signedInEmployee returns the id of the signed-in user, if any
+func signedInEmployee(r *http.Request) *int64 {
+	if user, ok := utils.UserFromContext(r.Context()); ok {
+		return &user.ID
+	}
+	return nil
+}
+
+// -------------------- Garment Types --------------------
+// ListGarmentTypes returns the garment types of the branch and their measurement fields
+func (h *MeasurementHandler) ListGarmentTypes(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListGarmentTypes: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	types, err := h.DB.ListGarmentTypes(r.Context(), branchID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListGarmentTypes:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error        bool                  `json:"error"`
+		Status       string                `json:"status"`
+		GarmentTypes []*models.GarmentType `json:"garment_types"`
+	}{
+		Error:        false,
+		Status:       "success",
+		GarmentTypes: types,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// CreateGarmentType adds a garment type.
+// Body: {"name": "Abaya", "fields": [{"key": "length", "label": "Length", "unit": "inch", "required": true}, ...]}
+func (h *MeasurementHandler) CreateGarmentType(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_CreateGarmentType: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var g models.GarmentType
+	if err := utils.ReadJSON(w, r, &g); err != nil {
+		h.errorLog.Println("ERROR_02_CreateGarmentType:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	g.BranchID = branchID
+
+	if err := h.DB.CreateGarmentType(r.Context(), &g); err != nil {
+		h.errorLog.Println("ERROR_03_CreateGarmentType:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error       bool                `json:"error"`
+		Status      string              `json:"status"`
+		Message     string              `json:"message"`
+		GarmentType *models.GarmentType `json:"garment_type"`
+	}{
+		Error:       false,
+		Status:      "success",
+		Message:     "Garment type added successfully",
+		GarmentType: &g,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// UpdateGarmentType replaces the name, fields and status of a garment type.
+// Body: {"name": "Abaya", "fields": [...], "status": true}
+func (h *MeasurementHandler) UpdateGarmentType(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_UpdateGarmentType: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if id == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid garment type id"))
+		return
+	}
+
+	var g models.GarmentType
+	if err := utils.ReadJSON(w, r, &g); err != nil {
+		h.errorLog.Println("ERROR_02_UpdateGarmentType:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	g.ID = id
+	g.BranchID = branchID
+
+	if err := h.DB.UpdateGarmentType(r.Context(), &g); err != nil {
+		h.errorLog.Println("ERROR_03_UpdateGarmentType:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error       bool                `json:"error"`
+		Status      string              `json:"status"`
+		Message     string              `json:"message"`
+		GarmentType *models.GarmentType `json:"garment_type"`
+	}{
+		Error:       false,
+		Status:      "success",
+		Message:     "Garment type updated successfully",
+		GarmentType: &g,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// -------------------- Measurement Profiles --------------------
+// ListProfiles returns the measurement profiles of a customer with their current measurements
+func (h *MeasurementHandler) ListProfiles(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListProfiles: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if customerID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid customer id"))
+		return
+	}
+
+	profiles, err := h.DB.ListProfiles(r.Context(), branchID, customerID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListProfiles:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error    bool                         `json:"error"`
+		Status   string                       `json:"status"`
+		Profiles []*models.MeasurementProfile `json:"profiles"`
+	}{
+		Error:    false,
+		Status:   "success",
+		Profiles: profiles,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// CreateProfile adds a measurement profile to a customer.
+// Body: {"name": "Daughter - Mariam", "garment_type_id": 2, "is_default": false, "notes": "",
+// "measurements": {"length": "52", "shoulder": "14"}}
+func (h *MeasurementHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_CreateProfile: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	customerID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if customerID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid customer id"))
+		return
+	}
+
+	var req models.MeasurementProfileRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.errorLog.Println("ERROR_02_CreateProfile:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	req.BranchID = branchID
+	req.CustomerID = customerID
+	req.CreatedBy = signedInEmployee(r)
+
+	profile, err := h.DB.CreateProfile(r.Context(), &req)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_CreateProfile:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                       `json:"error"`
+		Status  string                     `json:"status"`
+		Message string                     `json:"message"`
+		Profile *models.MeasurementProfile `json:"profile"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Measurement profile added successfully",
+		Profile: profile,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// GetProfile returns one measurement profile with its current measurements
+func (h *MeasurementHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetProfile: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	profileID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if profileID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid profile id"))
+		return
+	}
+
+	profile, err := h.DB.GetProfile(r.Context(), branchID, profileID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetProfile:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                       `json:"error"`
+		Status  string                     `json:"status"`
+		Profile *models.MeasurementProfile `json:"profile"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Profile: profile,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// UpdateProfile renames a profile, makes it the default or (de)activates it.
+// Body: {"name": "Self", "notes": "", "is_default": true, "status": true}
+func (h *MeasurementHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_UpdateProfile: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	profileID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if profileID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid profile id"))
+		return
+	}
+
+	var body struct {
+		Name      string `json:"name"`
+		Notes     string `json:"notes"`
+		IsDefault bool   `json:"is_default"`
+		Status    bool   `json:"status"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_02_UpdateProfile:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	profile, err := h.DB.UpdateProfile(r.Context(), branchID, profileID, body.Name, body.Notes, body.IsDefault, body.Status)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_UpdateProfile:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                       `json:"error"`
+		Status  string                     `json:"status"`
+		Message string                     `json:"message"`
+		Profile *models.MeasurementProfile `json:"profile"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Measurement profile updated successfully",
+		Profile: profile,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// AddVersion records new measurements on a profile; earlier versions are kept.
+// Body: {"measurements": {"length": "53", "shoulder": "14"}, "notes": "re-measured"}
+func (h *MeasurementHandler) AddVersion(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_AddVersion: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	profileID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if profileID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid profile id"))
+		return
+	}
+
+	var body struct {
+		Measurements map[string]string `json:"measurements"`
+		Notes        string            `json:"notes"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_02_AddVersion:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	version, err := h.DB.AddVersion(r.Context(), branchID, profileID, body.Measurements, body.Notes, signedInEmployee(r))
+	if err != nil {
+		h.errorLog.Println("ERROR_03_AddVersion:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                       `json:"error"`
+		Status  string                     `json:"status"`
+		Message string                     `json:"message"`
+		Version *models.MeasurementVersion `json:"version"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Measurements recorded successfully",
+		Version: version,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// GetProfileHistory lists every recorded version of a profile, newest first
+func (h *MeasurementHandler) GetProfileHistory(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetProfileHistory: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	profileID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if profileID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid profile id"))
+		return
+	}
+
+	versions, err := h.DB.GetProfileHistory(r.Context(), branchID, profileID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetProfileHistory:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error    bool                         `json:"error"`
+		Status   string                       `json:"status"`
+		Versions []*models.MeasurementVersion `json:"versions"`
+	}{
+		Error:    false,
+		Status:   "success",
+		Versions: versions,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// MemoHandler lets the chairman see and change how each branch numbers its
+// documents
+type MemoHandler struct {
+	DB       *dbrepo.MemoRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewMemoHandler(db *dbrepo.MemoRepo, infoLog *log.Logger, errorLog *log.Logger) *MemoHandler {
+	return &MemoHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// ListMemoSequences returns the numbering of every document type of a branch
+// with the memo number the next document will get
+func (h *MemoHandler) ListMemoSequences(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if branchID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid branch id"))
+		return
+	}
+
+	sequences, err := h.DB.ListSequences(r.Context(), branchID)
+	if err != nil {
+		h.errorLog.Println("ERROR_01_ListMemoSequences:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error     bool                   `json:"error"`
+		Sequences []*models.MemoSequence `json:"sequences"`
+	}{
+		Error:     false,
+		Sequences: sequences,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// SetMemoSequence changes the numbering of one document type of a branch.
+// Body: {"prefix": "DIVA-OR", "padding": 6, "yearly": true}; padding defaults
+// to 6 and yearly to true
+func (h *MemoHandler) SetMemoSequence(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if branchID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid branch id"))
+		return
+	}
+	docType := chi.URLParam(r, "type")
+	if _, ok := models.MemoDocumentCodes[docType]; !ok {
+		utils.BadRequest(w, errors.New("Unknown document type"))
+		return
+	}
+	var body struct {
+		Prefix  string `json:"prefix"`
+		Padding int    `json:"padding"`
+		Yearly  *bool  `json:"yearly"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_01_SetMemoSequence:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if body.Padding == 0 {
+		body.Padding = 6
+	}
+	yearly := body.Yearly == nil || *body.Yearly
+
+	sequence, err := h.DB.SetSequence(r.Context(), branchID, docType, body.Prefix, body.Padding, yearly)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_SetMemoSequence:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error    bool                 `json:"error"`
+		Sequence *models.MemoSequence `json:"sequence"`
+	}{
+		Error:    false,
+		Sequence: sequence,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -2,25 +2,33 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/printing"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
 	"github.com/projuktisheba/erp-mini-api/internal/utils"
 )
 
 type OrderHandler struct {
 	DB       *dbrepo.OrderRepo
+	Files    storage.Store   // reference photos printed on work tickets
+	Fonts    *printing.Fonts // text of job sheets, for names in Arabic
 	infoLog  *log.Logger
 	errorLog *log.Logger
 }
 
-func NewOrderHandler(db *dbrepo.OrderRepo, infoLog *log.Logger, errorLog *log.Logger) *OrderHandler {
+func NewOrderHandler(db *dbrepo.OrderRepo, files storage.Store, fonts *printing.Fonts, infoLog *log.Logger, errorLog *log.Logger) *OrderHandler {
 	return &OrderHandler{
 		DB:       db,
+		Files:    files,
+		Fonts:    fonts,
 		infoLog:  infoLog,
 		errorLog: errorLog,
 	}
@@ -41,12 +49,27 @@ func (o *OrderHandler) AddOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	orderDetails.BranchID = branchID
+	if err := authorizeCreditOverride(r, orderDetails.CreditOverride); err != nil {
+		o.errorLog.Println("AddOrder_CreditOverride:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if err := authorizeDiscountApproval(r, orderDetails.DiscountApproval); err != nil {
+		o.errorLog.Println("AddOrder_DiscountApproval:", err)
+		utils.BadRequest(w, err)
+		return
+	}
 
 	o.infoLog.Printf("Received order data: %+v\n", orderDetails)
 
 	orderID, err := o.DB.CreateOrder(r.Context(), &orderDetails);
 	if err != nil {
 		o.errorLog.Println("AddOrder_DB:", err)
+		if errors.Is(err, dbrepo.ErrCreditLimitExceeded) || errors.Is(err, dbrepo.ErrInsufficientStoreCredit) ||
+			errors.Is(err, dbrepo.ErrDiscountApprovalRequired) {
+			utils.BadRequest(w, err)
+			return
+		}
 		if utils.IsUniqueViolation(err, "orders_memo_no_branch_id_key") {
 			utils.BadRequest(w, errors.New("duplicate memo number not allowed"))
 			return
@@ -60,6 +83,8 @@ func (o *OrderHandler) AddOrder(w http.ResponseWriter, r *http.Request) {
 		"status":   "success",
 		"message":  "Order added successfully",
 		"order_id": orderID,
+		// one sheet per item for the cutting room
+		"job_sheets_url": fmt.Sprintf("/api/v1/products/orders/%d/job-sheets.pdf", orderID),
 	}
 	utils.WriteJSON(w, http.StatusCreated, resp)
 }
@@ -84,6 +109,17 @@ func (o *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 	}
 	orderDetails.BranchID = branchID
 
+	if err := authorizeCreditOverride(r, orderDetails.CreditOverride); err != nil {
+		o.errorLog.Println("UpdateOrder_CreditOverride:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if err := authorizeDiscountApproval(r, orderDetails.DiscountApproval); err != nil {
+		o.errorLog.Println("UpdateOrder_DiscountApproval:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
 	o.infoLog.Printf("Received order data: %+v\n", orderDetails)
 
 	// load old data
@@ -96,6 +132,10 @@ func (o *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 	err = o.DB.UpdateOrder(r.Context(), &orderDetails, oldOrderDetails);
 	if err != nil {
 		o.errorLog.Println("UpdateOrder_DB:", err)
+		if errors.Is(err, dbrepo.ErrCreditLimitExceeded) || errors.Is(err, dbrepo.ErrDiscountApprovalRequired) {
+			utils.BadRequest(w, err)
+			return
+		}
 		utils.ServerError(w, err)
 		return
 	}
@@ -108,39 +148,43 @@ func (o *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusCreated, resp)
 }
 
-// CancelOrder handles DELETE /orders/cancel/{id}
+// CancelOrder handles DELETE /orders/cancel/{id}?reason=...
+// Money already paid on the order is kept as the customer's store credit.
 func (o *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
-	orderID, err:= strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if orderID == 0 || err != nil {
 		utils.BadRequest(w, errors.New("Invalid order id"))
 		return
 	}
-	
+
 	branchID := utils.GetBranchID(r)
 	if branchID == 0 {
 		utils.BadRequest(w, errors.New("Branch ID not found. Include 'X-Branch-ID' header"))
 		return
 	}
-	// load old data
-	oldOrderDetails, err := o.DB.GetOrderDetailsByID(r.Context(), orderID);
-	if err != nil {
-		o.errorLog.Println("UpdateOrder_DB:", err)
-		utils.ServerError(w, err)
-		return
-	}
-	err = o.DB.CancelOrder(r.Context(), oldOrderDetails);
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+
+	credit, err := o.DB.CancelOrder(r.Context(), branchID, orderID, utils.Today(), reason)
 	if err != nil {
 		o.errorLog.Println("CancelOrder_DB:", err)
-		utils.ServerError(w, err)
+		switch {
+		case errors.Is(err, dbrepo.ErrOrderNotFound):
+			utils.NotFound(w, err.Error())
+		case errors.Is(err, dbrepo.ErrOrderNotCancellable), errors.Is(err, models.ErrPeriodClosed):
+			utils.BadRequest(w, err) // a closed period answers 409
+		default:
+			utils.ServerError(w, err)
+		}
 		return
 	}
 
 	resp := map[string]any{
-		"error":    false,
-		"status":   "success",
-		"message":  "Order cancelled successfully",
+		"error":        false,
+		"status":       "success",
+		"message":      "Order cancelled successfully",
+		"store_credit": credit,
 	}
-	utils.WriteJSON(w, http.StatusCreated, resp)
+	utils.WriteJSON(w, http.StatusOK, resp)
 }
 // UpdateOder handles POST /orders/delivery
 func (o *OrderHandler) OrderDelivery(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+type PeriodHandler struct {
+	DB       *dbrepo.PeriodRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewPeriodHandler(db *dbrepo.PeriodRepo, infoLog *log.Logger, errorLog *log.Logger) *PeriodHandler {
+	return &PeriodHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// ListPeriods returns the closed (and re-opened) months of the branch
+func (h *PeriodHandler) ListPeriods(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListPeriods: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	periods, err := h.DB.ListPeriods(r.Context(), branchID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListPeriods:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                       `json:"error"`
+		Status  string                     `json:"status"`
+		Message string                     `json:"message"`
+		Periods []*models.AccountingPeriod `json:"periods"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Accounting periods fetched successfully",
+		Periods: periods,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetPeriodAudit returns who closed and re-opened which month, and why
+func (h *PeriodHandler) GetPeriodAudit(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetPeriodAudit: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	audit, err := h.DB.GetPeriodAudit(r.Context(), branchID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetPeriodAudit:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                            `json:"error"`
+		Status  string                          `json:"status"`
+		Message string                          `json:"message"`
+		Audit   []*models.AccountingPeriodAudit `json:"audit"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Period audit fetched successfully",
+		Audit:   audit,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// ClosePeriod closes a month of the branch (chairman only).
+// Body: {"month": "2025-01", "reason": "January reported to the owner"}
+func (h *PeriodHandler) ClosePeriod(w http.ResponseWriter, r *http.Request) {
+	h.setPeriodStatus(w, r, models.PERIOD_CLOSED, "ClosePeriod")
+}
+
+// ReopenPeriod re-opens a closed month of the branch (chairman only). The reason is required.
+// Body: {"month": "2025-01", "reason": "Supplier invoice was booked twice"}
+func (h *PeriodHandler) ReopenPeriod(w http.ResponseWriter, r *http.Request) {
+	h.setPeriodStatus(w, r, models.PERIOD_OPEN, "ReopenPeriod")
+}
+
+func (h *PeriodHandler) setPeriodStatus(w http.ResponseWriter, r *http.Request, status, funcName string) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Printf("ERROR_01_%s: Branch id not found\n", funcName)
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var input struct {
+		Month  string `json:"month"`
+		Reason string `json:"reason"`
+	}
+	if err := utils.ReadJSON(w, r, &input); err != nil {
+		h.errorLog.Printf("ERROR_02_%s: %v\n", funcName, err)
+		utils.BadRequest(w, err)
+		return
+	}
+	month, err := time.Parse("2006-01", input.Month)
+	if err != nil {
+		utils.BadRequest(w, errors.New("invalid month format, expected YYYY-MM"))
+		return
+	}
+
+	var employeeID int64
+	var employeeName string
+	if user, ok := utils.UserFromContext(r.Context()); ok {
+		employeeID, employeeName = user.ID, user.Name
+	}
+
+	var period *models.AccountingPeriod
+	message := "Period closed successfully"
+	if status == models.PERIOD_CLOSED {
+		period, err = h.DB.ClosePeriod(r.Context(), branchID, month, employeeID, employeeName, input.Reason)
+	} else {
+		period, err = h.DB.ReopenPeriod(r.Context(), branchID, month, employeeID, employeeName, input.Reason)
+		message = "Period re-opened successfully"
+	}
+	if err != nil {
+		h.errorLog.Printf("ERROR_03_%s: %v\n", funcName, err)
+		utils.BadRequest(w, err)
+		return
+	}
+	h.infoLog.Printf("Period %s of branch %d set to %s by employee %d\n", input.Month, branchID, status, employeeID)
+
+	resp := struct {
+		Error   bool                     `json:"error"`
+		Status  string                   `json:"status"`
+		Message string                   `json:"message"`
+		Period  *models.AccountingPeriod `json:"period"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: message,
+		Period:  period,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// PostAdjustment books a correction of a closed-period document in an open period.
+// Body: {"adjustment_date": "2025-02-03T00:00:00Z", "reference": "PR-42", "from_type": "suppliers",
+// "from_id": 3, "to_type": "accounts", "to_id": 1, "amount": 150, "notes": "overcharged in January"}
+func (h *PeriodHandler) PostAdjustment(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_PostAdjustment: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var adj models.PeriodAdjustment
+	if err := utils.ReadJSON(w, r, &adj); err != nil {
+		h.errorLog.Println("ERROR_02_PostAdjustment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	adj.BranchID = branchID
+	if adj.AdjustmentDate.IsZero() {
+		adj.AdjustmentDate = utils.Today()
+	}
+	user, ok := utils.UserFromContext(r.Context())
+	if !ok {
+		utils.BadRequest(w, errors.New("signed-in employee not found"))
+		return
+	}
+	adj.EmployeeID, adj.EmployeeName = user.ID, user.Name
+
+	t, err := h.DB.PostAdjustment(r.Context(), &adj)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_PostAdjustment:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error       bool                `json:"error"`
+		Status      string              `json:"status"`
+		Message     string              `json:"message"`
+		Transaction *models.Transaction `json:"transaction"`
+	}{
+		Error:       false,
+		Status:      "success",
+		Message:     "Adjustment posted successfully",
+		Transaction: t,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// ListAdjustments returns the adjustments posted in the branch with who posted them
+func (h *PeriodHandler) ListAdjustments(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListAdjustments: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	adjustments, err := h.DB.ListAdjustments(r.Context(), branchID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListAdjustments:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error       bool                             `json:"error"`
+		Status      string                           `json:"status"`
+		Adjustments []*models.PeriodAdjustmentRecord `json:"adjustments"`
+	}{
+		Error:       false,
+		Status:      "success",
+		Adjustments: adjustments,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
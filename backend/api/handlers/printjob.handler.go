@@ -0,0 +1,255 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/printing"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// PrintJobHandler queues thermal receipts for the POS clients of a branch,
+// which poll for them and send them to their local printer
+type PrintJobHandler struct {
+	DB       *dbrepo.PrintJobRepo
+	Invoices *dbrepo.InvoiceRepo
+	Fonts    *printing.Fonts
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewPrintJobHandler(db *dbrepo.PrintJobRepo, invoices *dbrepo.InvoiceRepo, fonts *printing.Fonts, infoLog *log.Logger, errorLog *log.Logger) *PrintJobHandler {
+	return &PrintJobHandler{
+		DB:       db,
+		Invoices: invoices,
+		Fonts:    fonts,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// printJobResponse is the reply carrying a single job
+type printJobResponse struct {
+	Error bool             `json:"error"`
+	Job   *models.PrintJob `json:"job"`
+}
+
+// CreatePrintJob renders a receipt and queues it for the branch's printer.
+// Body: {"document_type": "order|sale", "document_id": 12, "type": "delivery",
+// "transaction_id": 0, "lang": "en|ar", "paper": 80, "printer": ""}
+func (h *PrintJobHandler) CreatePrintJob(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_CreatePrintJob: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	var body struct {
+		DocumentType  string `json:"document_type"`
+		DocumentID    int64  `json:"document_id"`
+		Type          string `json:"type"`
+		TransactionID int64  `json:"transaction_id"`
+		Lang          string `json:"lang"`
+		Paper         int    `json:"paper"`
+		Printer       string `json:"printer"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_02_CreatePrintJob:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if body.DocumentID <= 0 {
+		utils.BadRequest(w, errors.New("document_id is required"))
+		return
+	}
+	if body.Lang == "" {
+		body.Lang = models.INVOICE_ENGLISH
+	}
+	if body.Paper == 0 {
+		body.Paper = printing.Receipt80mm
+	}
+
+	inv, err := documentInvoice(r.Context(), h.Invoices, branchID, body.DocumentType, body.DocumentID, body.Type, body.TransactionID)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_CreatePrintJob:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	data, err := printing.ReceiptESCPOS(inv, body.Lang, h.Fonts, body.Paper)
+	if errors.Is(err, printing.ErrNoArabicFont) {
+		h.errorLog.Println("ERROR_04_CreatePrintJob:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	if err != nil {
+		h.errorLog.Println("ERROR_04_CreatePrintJob:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	job, err := h.DB.CreateJob(r.Context(), &models.PrintJob{
+		BranchID:     branchID,
+		Printer:      body.Printer,
+		DocumentType: body.DocumentType,
+		DocumentID:   body.DocumentID,
+		Kind:         inv.Kind,
+		MemoNo:       inv.MemoNo,
+		Payload:      data,
+		CreatedBy:    signedInEmployee(r),
+	})
+	if err != nil {
+		h.errorLog.Println("ERROR_05_CreatePrintJob:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, printJobResponse{Job: job})
+}
+
+// ListPrintJobs returns the latest print jobs of the branch
+// Query: status=queued|printing|done|failed, limit (default 50)
+func (h *PrintJobHandler) ListPrintJobs(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListPrintJobs: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 500 {
+			utils.BadRequest(w, errors.New("limit must be between 1 and 500"))
+			return
+		}
+		limit = n
+	}
+
+	jobs, err := h.DB.ListJobs(r.Context(), branchID, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListPrintJobs:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error bool               `json:"error"`
+		Jobs  []*models.PrintJob `json:"jobs"`
+	}{
+		Error: false,
+		Jobs:  jobs,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// NextPrintJob hands the next waiting job to a polling POS client, or answers
+// 204 No Content when there is none. The client must report back with done or
+// failed; a job not reported on is handed out again after a while.
+// Query: printer (the client's printer name), raw=true to get the ESC/POS
+// bytes as the body with the job id in the X-Print-Job-ID header
+func (h *PrintJobHandler) NextPrintJob(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_NextPrintJob: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	job, err := h.DB.ClaimNext(r.Context(), branchID, r.URL.Query().Get("printer"))
+	if err != nil {
+		h.errorLog.Println("ERROR_02_NextPrintJob:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	if job == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.URL.Query().Get("raw") == "true" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Print-Job-ID", strconv.FormatInt(job.ID, 10))
+		w.WriteHeader(http.StatusOK)
+		w.Write(job.Payload)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, printJobResponse{Job: job})
+}
+
+// printJobID reads the job id from the URL and the branch from the header
+func (h *PrintJobHandler) printJobID(w http.ResponseWriter, r *http.Request, fn string) (branchID, jobID int64, ok bool) {
+	jobID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if jobID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid print job id"))
+		return 0, 0, false
+	}
+	branchID = utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_" + fn + ": Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return 0, 0, false
+	}
+	return branchID, jobID, true
+}
+
+// PrintJobDone handles POST /print-jobs/{id}/done, sent once the receipt is printed
+func (h *PrintJobHandler) PrintJobDone(w http.ResponseWriter, r *http.Request) {
+	branchID, jobID, ok := h.printJobID(w, r, "PrintJobDone")
+	if !ok {
+		return
+	}
+	if err := h.DB.MarkDone(r.Context(), branchID, jobID); err != nil {
+		h.errorLog.Println("ERROR_02_PrintJobDone:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	var resp models.Response
+	resp.Error = false
+	resp.Message = "Print job completed"
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// PrintJobFailed handles POST /print-jobs/{id}/failed. The job is queued again
+// unless it has been tried too often. Body: {"error": "paper out"}
+func (h *PrintJobHandler) PrintJobFailed(w http.ResponseWriter, r *http.Request) {
+	branchID, jobID, ok := h.printJobID(w, r, "PrintJobFailed")
+	if !ok {
+		return
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_02_PrintJobFailed:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	job, err := h.DB.MarkFailed(r.Context(), branchID, jobID, body.Error)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_PrintJobFailed:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, printJobResponse{Job: job})
+}
+
+// RetryPrintJob handles POST /print-jobs/{id}/retry, queueing a failed job again
+func (h *PrintJobHandler) RetryPrintJob(w http.ResponseWriter, r *http.Request) {
+	branchID, jobID, ok := h.printJobID(w, r, "RetryPrintJob")
+	if !ok {
+		return
+	}
+	job, err := h.DB.Retry(r.Context(), branchID, jobID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_RetryPrintJob:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, printJobResponse{Job: job})
+}
@@ -65,7 +65,6 @@ func (h *ProductHandler) RestockProducts(w http.ResponseWriter, r *http.Request)
 	}
 	var requestBody struct {
 		Date     time.Time        `json:"date"`
-		MemoNo   string           `json:"memo_no"`
 		Products []models.Product `json:"products"`
 	}
 
@@ -78,7 +77,7 @@ func (h *ProductHandler) RestockProducts(w http.ResponseWriter, r *http.Request)
 
 	h.infoLog.Println(requestBody)
 
-	memoNo, err := h.DB.RestockProducts(r.Context(), requestBody.Date, requestBody.MemoNo, branchID, requestBody.Products)
+	memoNo, err := h.DB.RestockProducts(r.Context(), requestBody.Date, branchID, requestBody.Products)
 	if err != nil {
 		h.errorLog.Println("ERROR_02_RestockProducts: Unable to update stocks => ", err)
 		utils.BadRequest(w, err)
@@ -218,12 +217,27 @@ func (o *ProductHandler) AddSale(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	saleDetails.BranchID = branchID
+	if err := authorizeCreditOverride(r, saleDetails.CreditOverride); err != nil {
+		o.errorLog.Println("AddSale_CreditOverride:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if err := authorizeDiscountApproval(r, saleDetails.DiscountApproval); err != nil {
+		o.errorLog.Println("AddSale_DiscountApproval:", err)
+		utils.BadRequest(w, err)
+		return
+	}
 
 	o.infoLog.Printf("Received sale data: %+v\n", saleDetails)
 
 	saleID, err := o.DB.SaleProducts(r.Context(), &saleDetails)
 	if err != nil {
 		o.errorLog.Println("AddSale_DB:", err)
+		if errors.Is(err, dbrepo.ErrCreditLimitExceeded) || errors.Is(err, dbrepo.ErrInsufficientStoreCredit) ||
+			errors.Is(err, dbrepo.ErrDiscountApprovalRequired) {
+			utils.BadRequest(w, err)
+			return
+		}
 		if utils.IsUniqueViolation(err, "sales_memo_no_branch_id_key") {
 			utils.BadRequest(w, errors.New("duplicate memo number not allowed"))
 			return
@@ -262,6 +276,17 @@ func (o *ProductHandler) UpdateSale(w http.ResponseWriter, r *http.Request) {
 	}
 	saleDetails.BranchID = branchID
 
+	if err := authorizeCreditOverride(r, saleDetails.CreditOverride); err != nil {
+		o.errorLog.Println("UpdateSale_CreditOverride:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if err := authorizeDiscountApproval(r, saleDetails.DiscountApproval); err != nil {
+		o.errorLog.Println("UpdateSale_DiscountApproval:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
 	o.infoLog.Printf("Received sale data: %+v\n", saleDetails)
 
 	// load old data
@@ -274,6 +299,10 @@ func (o *ProductHandler) UpdateSale(w http.ResponseWriter, r *http.Request) {
 	err = o.DB.UpdateSale(r.Context(), &saleDetails, oldSaleDetails)
 	if err != nil {
 		o.errorLog.Println("UpdateSale_DB:", err)
+		if errors.Is(err, dbrepo.ErrCreditLimitExceeded) || errors.Is(err, dbrepo.ErrDiscountApprovalRequired) {
+			utils.BadRequest(w, err)
+			return
+		}
 		utils.ServerError(w, err)
 		return
 	}
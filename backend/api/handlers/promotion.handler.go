@@ -0,0 +1,349 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// PromotionHandler manages promotions, their coupon codes and the discount
+// approval threshold of the branches
+type PromotionHandler struct {
+	DB       *dbrepo.PromotionRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewPromotionHandler(db *dbrepo.PromotionRepo, infoLog *log.Logger, errorLog *log.Logger) *PromotionHandler {
+	return &PromotionHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// authorizeDiscountApproval stamps the discount approval of an order or sale
+// with the signed-in manager who gave it.
+func authorizeDiscountApproval(r *http.Request, approval *models.DiscountApproval) error {
+	if approval == nil {
+		return nil
+	}
+	approvedBy, err := authorizeManagerApproval(r, approval.Reason)
+	if err != nil {
+		return fmt.Errorf("discount approval: %w", err)
+	}
+	approval.ApprovedBy = approvedBy
+	return nil
+}
+
+// promotionRequest is the body of a new or changed promotion
+type promotionRequest struct {
+	Name           string       `json:"name"`
+	DiscountType   string       `json:"discount_type"`
+	DiscountValue  money.Amount `json:"discount_value"`
+	StartsOn       string       `json:"starts_on"`
+	EndsOn         string       `json:"ends_on"`
+	RequiresCoupon bool         `json:"requires_coupon"`
+	Active         *bool        `json:"active"`       // default true
+	AllBranches    bool         `json:"all_branches"` // chairman only
+}
+
+// promotion reads the request into a promotion of the branch
+func (req *promotionRequest) promotion(r *http.Request, branchID int64) (*models.Promotion, error) {
+	p := &models.Promotion{
+		BranchID:       &branchID,
+		Name:           req.Name,
+		DiscountType:   req.DiscountType,
+		DiscountValue:  req.DiscountValue,
+		RequiresCoupon: req.RequiresCoupon,
+		Active:         req.Active == nil || *req.Active,
+	}
+	var err error
+	if p.StartsOn, err = time.Parse("2006-01-02", req.StartsOn); err != nil {
+		return nil, errors.New("invalid starts_on format, expected YYYY-MM-DD")
+	}
+	if p.EndsOn, err = time.Parse("2006-01-02", req.EndsOn); err != nil {
+		return nil, errors.New("invalid ends_on format, expected YYYY-MM-DD")
+	}
+	user, ok := utils.UserFromContext(r.Context())
+	if ok {
+		p.CreatedBy = &user.ID
+	}
+	if req.AllBranches {
+		if !ok || utils.Role(user.Role) != utils.RoleChairman {
+			return nil, errors.New("only the chairman can run a promotion in every branch")
+		}
+		p.BranchID = nil
+	}
+	return p, nil
+}
+
+// ListPromotions returns the promotions that run in the branch.
+// Example: GET /api/v1/promotions?active_on=2025-03-30 for the ones that can be given that day
+func (h *PromotionHandler) ListPromotions(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListPromotions: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	var activeOn *time.Time
+	if s := strings.TrimSpace(r.URL.Query().Get("active_on")); s != "" {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			utils.BadRequest(w, errors.New("invalid active_on format, expected YYYY-MM-DD"))
+			return
+		}
+		activeOn = &d
+	}
+
+	promotions, err := h.DB.ListPromotions(r.Context(), branchID, activeOn)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListPromotions:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error      bool                `json:"error"`
+		Promotions []*models.Promotion `json:"promotions"`
+	}{
+		Error:      false,
+		Promotions: promotions,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetPromotion returns a promotion with its coupon codes and how often each was used
+func (h *PromotionHandler) GetPromotion(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetPromotion: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	promotionID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if promotionID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid promotion id"))
+		return
+	}
+
+	promotion, err := h.DB.GetPromotion(r.Context(), branchID, promotionID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetPromotion:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error     bool              `json:"error"`
+		Promotion *models.Promotion `json:"promotion"`
+	}{
+		Error:     false,
+		Promotion: promotion,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// CreatePromotion adds a promotion to the branch, or to every branch.
+// Body: {"name":"Eid sale","discount_type":"percent","discount_value":15,
+// "starts_on":"2025-03-25","ends_on":"2025-04-05","requires_coupon":false,"all_branches":false}
+func (h *PromotionHandler) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_CreatePromotion: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	var req promotionRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.errorLog.Println("ERROR_02_CreatePromotion:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	promotion, err := req.promotion(r, branchID)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.CreatePromotion(r.Context(), promotion); err != nil {
+		h.errorLog.Println("ERROR_03_CreatePromotion:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error     bool              `json:"error"`
+		Message   string            `json:"message"`
+		Promotion *models.Promotion `json:"promotion"`
+	}{
+		Error:     false,
+		Message:   "Promotion created successfully",
+		Promotion: promotion,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// UpdatePromotion changes a promotion; the body is the one of CreatePromotion.
+// Orders and sales that already got the promotion keep their discount.
+func (h *PromotionHandler) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_UpdatePromotion: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	promotionID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if promotionID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid promotion id"))
+		return
+	}
+	var req promotionRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.errorLog.Println("ERROR_02_UpdatePromotion:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	promotion, err := req.promotion(r, branchID)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+	promotion.ID = promotionID
+
+	if err := h.DB.UpdatePromotion(r.Context(), branchID, promotion); err != nil {
+		h.errorLog.Println("ERROR_03_UpdatePromotion:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error     bool              `json:"error"`
+		Message   string            `json:"message"`
+		Promotion *models.Promotion `json:"promotion"`
+	}{
+		Error:     false,
+		Message:   "Promotion updated successfully",
+		Promotion: promotion,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// AddCoupon adds a coupon code to a promotion.
+// Body: {"code":"EID25","max_uses":100,"max_uses_per_customer":1}; limits left out are unlimited
+func (h *PromotionHandler) AddCoupon(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_AddCoupon: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	promotionID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if promotionID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid promotion id"))
+		return
+	}
+	coupon := models.Coupon{PromotionID: promotionID, Active: true}
+	if err := utils.ReadJSON(w, r, &coupon); err != nil {
+		h.errorLog.Println("ERROR_02_AddCoupon:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	coupon.PromotionID = promotionID
+
+	if err := h.DB.AddCoupon(r.Context(), branchID, &coupon); err != nil {
+		h.errorLog.Println("ERROR_03_AddCoupon:", err)
+		if utils.IsUniqueViolation(err, "coupons_code_key") {
+			utils.BadRequest(w, errors.New("coupon code already exists"))
+			return
+		}
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool           `json:"error"`
+		Message string         `json:"message"`
+		Coupon  *models.Coupon `json:"coupon"`
+	}{
+		Error:   false,
+		Message: "Coupon created successfully",
+		Coupon:  &coupon,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// SetCouponActive turns a coupon code on or off. Body: {"active": false}
+func (h *PromotionHandler) SetCouponActive(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_SetCouponActive: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	couponID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if couponID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid coupon id"))
+		return
+	}
+	var body struct {
+		Active bool `json:"active"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_02_SetCouponActive:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.SetCouponActive(r.Context(), branchID, couponID, body.Active); err != nil {
+		h.errorLog.Println("ERROR_03_SetCouponActive:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	var resp models.Response
+	resp.Error = false
+	resp.Message = "Coupon updated successfully"
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// SetBranchDiscountApproval sets the share of the gross above which discounts
+// given by hand need a manager (chairman only).
+// Body: {"approval_percent": 10}; null never asks for approval.
+func (h *PromotionHandler) SetBranchDiscountApproval(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if branchID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid branch id"))
+		return
+	}
+	var body struct {
+		ApprovalPercent *money.Amount `json:"approval_percent"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_01_SetBranchDiscountApproval:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.SetBranchDiscountApproval(r.Context(), branchID, body.ApprovalPercent); err != nil {
+		h.errorLog.Println("ERROR_02_SetBranchDiscountApproval:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	var resp models.Response
+	resp.Error = false
+	resp.Message = "Discount approval threshold updated successfully"
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -100,7 +100,6 @@ func (h *PurchaseHandler) UpdatePurchase(w http.ResponseWriter, r *http.Request)
 	//update the fields
 	purchase.ID = id
 	purchase.BranchID = branchID
-	purchase.MemoNo = utils.GetPurchaseMemo(purchase.ID)
 	if purchase.Notes == ""{
 		purchase.Notes = fmt.Sprintf("Payment for Material Purchase %s", purchase.Notes)
 	}
@@ -243,3 +242,84 @@ func (h *PurchaseHandler) GetPurchaseReport(w http.ResponseWriter, r *http.Reque
 
 	utils.WriteJSON(w, http.StatusOK, resp)
 }
+
+// =========================
+// PaySupplier
+// =========================
+// PaySupplier records a payment to a supplier against its open purchases.
+// Body: {"supplier_id":3,"account_id":1,"payment_date":"2026-02-10T00:00:00Z","amount":500,
+// "allocations":[{"purchase_id":12,"amount":500}]}; without allocations the oldest purchases are paid first.
+func (h *PurchaseHandler) PaySupplier(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_PaySupplier: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var payment models.SupplierPayment
+	if err := utils.ReadJSON(w, r, &payment); err != nil {
+		h.errorLog.Println("ERROR_02_PaySupplier:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	payment.BranchID = branchID
+	if payment.PaymentDate.IsZero() {
+		payment.PaymentDate = utils.Today()
+	}
+
+	result, err := h.DB.PaySupplier(r.Context(), &payment)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_PaySupplier:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                          `json:"error"`
+		Status  string                        `json:"status"`
+		Message string                        `json:"message"`
+		Payment *models.SupplierPaymentResult `json:"payment"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Supplier paid successfully",
+		Payment: result,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// =========================
+// GetOpenPurchases
+// =========================
+func (h *PurchaseHandler) GetOpenPurchases(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetOpenPurchases: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	supplierID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if supplierID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid supplier id"))
+		return
+	}
+
+	purchases, err := h.DB.GetOpenPurchases(r.Context(), branchID, supplierID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetOpenPurchases:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error     bool                   `json:"error"`
+		Status    string                 `json:"status"`
+		Purchases []*models.OpenPurchase `json:"purchases"`
+	}{
+		Error:     false,
+		Status:    "success",
+		Purchases: purchases,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,564 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/bankstatement"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+type ReconciliationHandler struct {
+	DB       *dbrepo.ReconciliationRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewReconciliationHandler(db *dbrepo.ReconciliationRepo, infoLog *log.Logger, errorLog *log.Logger) *ReconciliationHandler {
+	return &ReconciliationHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// -------------------- CSV Mappings --------------------
+
+// AddCSVMapping saves the column layout of a bank's CSV export
+func (h *ReconciliationHandler) AddCSVMapping(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_AddCSVMapping: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var mapping models.BankCSVMapping
+	if err := utils.ReadJSON(w, r, &mapping); err != nil {
+		h.errorLog.Println("ERROR_02_AddCSVMapping:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	mapping.Name = strings.TrimSpace(mapping.Name)
+	if mapping.Name == "" || mapping.DateColumn == "" {
+		utils.BadRequest(w, errors.New("name and date_column are required"))
+		return
+	}
+	if mapping.AmountColumn == "" && mapping.DebitColumn == "" && mapping.CreditColumn == "" {
+		utils.BadRequest(w, errors.New("amount_column or debit_column/credit_column is required"))
+		return
+	}
+	if len([]rune(mapping.Delimiter)) > 1 {
+		utils.BadRequest(w, errors.New("delimiter must be a single character"))
+		return
+	}
+	switch mapping.DecimalSeparator {
+	case "", ".", ",":
+	default:
+		utils.BadRequest(w, errors.New(`decimal_separator must be "." or ","`))
+		return
+	}
+	mapping.BranchID = branchID
+
+	if err := h.DB.CreateCSVMapping(r.Context(), &mapping); err != nil {
+		h.errorLog.Println("ERROR_03_AddCSVMapping:", err)
+		if utils.IsUniqueViolation(err, "bank_csv_mappings_branch_id_name_key") {
+			utils.BadRequest(w, errors.New("a mapping with this name already exists"))
+			return
+		}
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                   `json:"error"`
+		Status  string                 `json:"status"`
+		Message string                 `json:"message"`
+		Mapping *models.BankCSVMapping `json:"mapping"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "CSV mapping saved successfully",
+		Mapping: &mapping,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// GetCSVMappings lists the CSV mappings of the branch
+func (h *ReconciliationHandler) GetCSVMappings(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetCSVMappings: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	mappings, err := h.DB.GetCSVMappings(r.Context(), branchID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetCSVMappings:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error    bool                     `json:"error"`
+		Status   string                   `json:"status"`
+		Message  string                   `json:"message"`
+		Mappings []*models.BankCSVMapping `json:"mappings"`
+	}{
+		Error:    false,
+		Status:   "success",
+		Message:  "CSV mappings fetched successfully",
+		Mappings: mappings,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// -------------------- Statement Import --------------------
+
+// ImportStatement accepts a multipart upload with fields:
+// file, account_id, format (csv|ofx|camt053) and mapping_id (csv only)
+func (h *ReconciliationHandler) ImportStatement(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ImportStatement: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	// --- Step 1: Parse multipart form (5 MB limit) ---
+	if err := r.ParseMultipartForm(5 << 20); err != nil {
+		h.errorLog.Println("ERROR_02_ImportStatement:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	accountID, err := strconv.ParseInt(r.FormValue("account_id"), 10, 64)
+	if err != nil || accountID <= 0 {
+		utils.BadRequest(w, errors.New("valid account_id is required"))
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		h.errorLog.Println("ERROR_03_ImportStatement:", err)
+		utils.BadRequest(w, errors.New("file field is required"))
+		return
+	}
+	defer file.Close()
+
+	// --- Step 2: Detect format ---
+	format := strings.ToLower(strings.TrimSpace(r.FormValue("format")))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(header.Filename)) {
+		case ".csv", ".txt":
+			format = models.BANK_FORMAT_CSV
+		case ".ofx", ".qfx":
+			format = models.BANK_FORMAT_OFX
+		case ".xml":
+			format = models.BANK_FORMAT_CAMT053
+		}
+	}
+
+	// --- Step 3: Load CSV mapping ---
+	var mapping *models.BankCSVMapping
+	if format == models.BANK_FORMAT_CSV {
+		mappingID, err := strconv.ParseInt(r.FormValue("mapping_id"), 10, 64)
+		if err != nil || mappingID <= 0 {
+			utils.BadRequest(w, errors.New("mapping_id is required for csv statements"))
+			return
+		}
+		mapping, err = h.DB.GetCSVMappingByID(r.Context(), branchID, mappingID)
+		if err != nil {
+			h.errorLog.Println("ERROR_04_ImportStatement:", err)
+			utils.BadRequest(w, err)
+			return
+		}
+		if mapping.AccountID != nil && *mapping.AccountID != accountID {
+			utils.BadRequest(w, errors.New("mapping belongs to a different account"))
+			return
+		}
+	}
+
+	// --- Step 4: Parse (hashing the file on the way to catch re-imports) ---
+	hash := sha256.New()
+	st, err := bankstatement.Parse(format, io.TeeReader(file, hash), mapping)
+	if err != nil {
+		h.errorLog.Println("ERROR_05_ImportStatement:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	// --- Step 5: Store & auto-match ---
+	// the parsers may stop before the end of the file; hash the rest too
+	if _, err := io.Copy(hash, file); err != nil {
+		h.errorLog.Println("ERROR_05_ImportStatement:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	fileHash := hex.EncodeToString(hash.Sum(nil))
+	statement, err := h.DB.ImportStatement(r.Context(), branchID, accountID, format, header.Filename, fileHash, st)
+	if err != nil {
+		h.errorLog.Println("ERROR_06_ImportStatement:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error     bool                  `json:"error"`
+		Status    string                `json:"status"`
+		Message   string                `json:"message"`
+		Statement *models.BankStatement `json:"statement"`
+	}{
+		Error:     false,
+		Status:    "success",
+		Message:   "Bank statement imported successfully",
+		Statement: statement,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// ListStatements lists imported statements; optional query: account_id
+func (h *ReconciliationHandler) ListStatements(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListStatements: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	accountID, _ := strconv.ParseInt(utils.GetURLParam(r, "account_id"), 10, 64)
+
+	statements, err := h.DB.ListStatements(r.Context(), branchID, accountID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListStatements:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error      bool                    `json:"error"`
+		Status     string                  `json:"status"`
+		Message    string                  `json:"message"`
+		Statements []*models.BankStatement `json:"statements"`
+	}{
+		Error:      false,
+		Status:     "success",
+		Message:    "Bank statements fetched successfully",
+		Statements: statements,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetStatementLines lists the lines of a statement; optional query: status
+func (h *ReconciliationHandler) GetStatementLines(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetStatementLines: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	statementID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || statementID <= 0 {
+		utils.BadRequest(w, errors.New("invalid statement id"))
+		return
+	}
+
+	status := utils.GetURLParam(r, "status")
+	switch status {
+	case "", models.BANK_LINE_UNMATCHED, models.BANK_LINE_MATCHED, models.BANK_LINE_CREATED, models.BANK_LINE_IGNORED:
+	default:
+		utils.BadRequest(w, errors.New("invalid status"))
+		return
+	}
+
+	lines, err := h.DB.GetStatementLines(r.Context(), branchID, statementID, status)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetStatementLines:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                        `json:"error"`
+		Status  string                      `json:"status"`
+		Message string                      `json:"message"`
+		Lines   []*models.BankStatementLine `json:"lines"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Statement lines fetched successfully",
+		Lines:   lines,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// AutoMatchStatement re-runs auto-matching on a statement
+func (h *ReconciliationHandler) AutoMatchStatement(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_AutoMatchStatement: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	statementID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || statementID <= 0 {
+		utils.BadRequest(w, errors.New("invalid statement id"))
+		return
+	}
+
+	matched, err := h.DB.AutoMatchStatement(r.Context(), branchID, statementID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_AutoMatchStatement:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]any{
+		"error":   false,
+		"status":  "success",
+		"message": "Auto-match completed",
+		"matched": matched,
+	})
+}
+
+// -------------------- Line Actions --------------------
+
+// GetMatchCandidates lists book transactions a line can be matched to
+func (h *ReconciliationHandler) GetMatchCandidates(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetMatchCandidates: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	lineID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || lineID <= 0 {
+		utils.BadRequest(w, errors.New("invalid line id"))
+		return
+	}
+
+	candidates, err := h.DB.GetMatchCandidates(r.Context(), branchID, lineID)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetMatchCandidates:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error        bool                  `json:"error"`
+		Status       string                `json:"status"`
+		Message      string                `json:"message"`
+		Transactions []*models.Transaction `json:"transactions"`
+	}{
+		Error:        false,
+		Status:       "success",
+		Message:      "Match candidates fetched successfully",
+		Transactions: candidates,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// MatchLine reconciles a line with a book transaction. Body: {"transaction_id": 12}
+func (h *ReconciliationHandler) MatchLine(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_MatchLine: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	lineID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || lineID <= 0 {
+		utils.BadRequest(w, errors.New("invalid line id"))
+		return
+	}
+
+	var input struct {
+		TransactionID int64 `json:"transaction_id"`
+	}
+	if err := utils.ReadJSON(w, r, &input); err != nil {
+		h.errorLog.Println("ERROR_02_MatchLine:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if input.TransactionID <= 0 {
+		utils.BadRequest(w, errors.New("transaction_id is required"))
+		return
+	}
+
+	if err := h.DB.MatchLine(r.Context(), branchID, lineID, input.TransactionID); err != nil {
+		h.errorLog.Println("ERROR_03_MatchLine:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.Response{Error: false, Status: "success", Message: "Statement line matched successfully"})
+}
+
+// UnmatchLine reverts a matched or ignored line
+func (h *ReconciliationHandler) UnmatchLine(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_UnmatchLine: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	lineID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || lineID <= 0 {
+		utils.BadRequest(w, errors.New("invalid line id"))
+		return
+	}
+
+	if err := h.DB.UnmatchLine(r.Context(), branchID, lineID); err != nil {
+		h.errorLog.Println("ERROR_02_UnmatchLine:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.Response{Error: false, Status: "success", Message: "Statement line unmatched successfully"})
+}
+
+// IgnoreLine marks a line as needing no book entry
+func (h *ReconciliationHandler) IgnoreLine(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_IgnoreLine: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	lineID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || lineID <= 0 {
+		utils.BadRequest(w, errors.New("invalid line id"))
+		return
+	}
+
+	if err := h.DB.IgnoreLine(r.Context(), branchID, lineID); err != nil {
+		h.errorLog.Println("ERROR_02_IgnoreLine:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, models.Response{Error: false, Status: "success", Message: "Statement line ignored"})
+}
+
+// CreateEntryFromLine books an unmatched line as a new transaction.
+// Body: {"entity_type": "suppliers", "entity_id": 3, "transaction_type": "Payment", "notes": "..."}
+func (h *ReconciliationHandler) CreateEntryFromLine(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_CreateEntryFromLine: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	lineID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || lineID <= 0 {
+		utils.BadRequest(w, errors.New("invalid line id"))
+		return
+	}
+
+	var input struct {
+		EntityType      string `json:"entity_type"`
+		EntityID        int64  `json:"entity_id"`
+		TransactionType string `json:"transaction_type"`
+		Notes           string `json:"notes"`
+	}
+	if err := utils.ReadJSON(w, r, &input); err != nil {
+		h.errorLog.Println("ERROR_02_CreateEntryFromLine:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	if input.EntityID <= 0 {
+		utils.BadRequest(w, errors.New("entity_id is required"))
+		return
+	}
+	switch input.TransactionType {
+	case "", models.PAYMENT, models.REFUND, models.ADJUSTMENT:
+	default:
+		utils.BadRequest(w, errors.New("transaction_type must be Payment, Refund or Adjustment"))
+		return
+	}
+
+	transactionID, err := h.DB.CreateEntryFromLine(r.Context(), branchID, lineID, input.EntityType, input.EntityID, input.TransactionType, input.Notes)
+	if err != nil {
+		h.errorLog.Println("ERROR_03_CreateEntryFromLine:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]any{
+		"error":          false,
+		"status":         "success",
+		"message":        "Transaction created from statement line",
+		"transaction_id": transactionID,
+	})
+}
+
+// -------------------- Report --------------------
+
+// GetReconciliationReport query: account_id, start_date, end_date (default: current month)
+func (h *ReconciliationHandler) GetReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_GetReconciliationReport: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	accountID, err := strconv.ParseInt(utils.GetURLParam(r, "account_id"), 10, 64)
+	if err != nil || accountID <= 0 {
+		utils.BadRequest(w, errors.New("valid account_id is required"))
+		return
+	}
+
+	const dateLayout = "2006-01-02"
+	var startDate, endDate time.Time
+	startDateStr := utils.GetURLParam(r, "start_date")
+	endDateStr := utils.GetURLParam(r, "end_date")
+	if startDateStr == "" || endDateStr == "" {
+		now := time.Now()
+		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		endDate = startDate.AddDate(0, 1, -1)
+	} else {
+		if startDate, err = time.Parse(dateLayout, startDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid start_date format, expected YYYY-MM-DD"))
+			return
+		}
+		if endDate, err = time.Parse(dateLayout, endDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid end_date format, expected YYYY-MM-DD"))
+			return
+		}
+	}
+	if endDate.Before(startDate) {
+		utils.BadRequest(w, errors.New("end_date cannot be before start_date"))
+		return
+	}
+
+	report, err := h.DB.GetReconciliationReport(r.Context(), branchID, accountID, startDate, endDate)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_GetReconciliationReport:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                             `json:"error"`
+		Status  string                           `json:"status"`
+		Message string                           `json:"message"`
+		Report  *models.BankReconciliationReport `json:"report"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Reconciliation report generated successfully",
+		Report:  report,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -375,3 +375,341 @@ func (rp *ReportHandler) GetBranchReport(w http.ResponseWriter, r *http.Request)
 
 	utils.WriteJSON(w, http.StatusOK, resp)
 }
+
+// GetProfitAndLoss returns the income statement of the branch for a period,
+// compared with the period of equal length right before it.
+// Example: GET /api/v1/reports/profit-loss?start_date=2025-01-01&end_date=2025-01-31
+func (rp *ReportHandler) GetProfitAndLoss(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		rp.errorLog.Println("ERROR_01_GetProfitAndLoss: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	rp.writeProfitAndLoss(w, r, branchID, "GetProfitAndLoss")
+}
+
+// GetConsolidatedProfitAndLoss returns the income statement of all branches
+// together with a per-branch breakdown (chairman only).
+// Example: GET /api/v1/admin/reports/profit-loss?start_date=2025-01-01&end_date=2025-01-31
+func (rp *ReportHandler) GetConsolidatedProfitAndLoss(w http.ResponseWriter, r *http.Request) {
+	rp.writeProfitAndLoss(w, r, 0, "GetConsolidatedProfitAndLoss")
+}
+
+func (rp *ReportHandler) writeProfitAndLoss(w http.ResponseWriter, r *http.Request, branchID int64, funcName string) {
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	report, err := rp.DB.GetProfitAndLoss(r.Context(), branchID, startDate, endDate)
+	if err != nil {
+		rp.errorLog.Printf("ERROR_02_%s: %v\n", funcName, err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                  `json:"error"`
+		Message string                `json:"message"`
+		Report  *models.ProfitAndLoss `json:"report"`
+	}{
+		Error:   false,
+		Message: "Profit and loss statement generated successfully",
+		Report:  report,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetBalanceSheet returns the financial position of the branch at the end of a date.
+// Example: GET /api/v1/reports/balance-sheet?as_of=2025-01-31
+func (rp *ReportHandler) GetBalanceSheet(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		rp.errorLog.Println("ERROR_01_GetBalanceSheet: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	rp.writeBalanceSheet(w, r, branchID, "GetBalanceSheet")
+}
+
+// GetConsolidatedBalanceSheet returns the financial position of all branches (chairman only).
+// Example: GET /api/v1/admin/reports/balance-sheet?as_of=2025-01-31
+func (rp *ReportHandler) GetConsolidatedBalanceSheet(w http.ResponseWriter, r *http.Request) {
+	rp.writeBalanceSheet(w, r, 0, "GetConsolidatedBalanceSheet")
+}
+
+// GetTrialBalance returns the ledger balances of the branch at the end of a date.
+// Example: GET /api/v1/reports/trial-balance?as_of=2025-01-31
+func (rp *ReportHandler) GetTrialBalance(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		rp.errorLog.Println("ERROR_01_GetTrialBalance: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	rp.writeTrialBalance(w, r, branchID, "GetTrialBalance")
+}
+
+// GetConsolidatedTrialBalance returns the ledger balances of all branches (chairman only).
+// Example: GET /api/v1/admin/reports/trial-balance?as_of=2025-01-31
+func (rp *ReportHandler) GetConsolidatedTrialBalance(w http.ResponseWriter, r *http.Request) {
+	rp.writeTrialBalance(w, r, 0, "GetConsolidatedTrialBalance")
+}
+
+func (rp *ReportHandler) writeBalanceSheet(w http.ResponseWriter, r *http.Request, branchID int64, funcName string) {
+	asOf, err := parseAsOfDate(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	report, err := rp.DB.GetBalanceSheet(r.Context(), branchID, asOf)
+	if err != nil {
+		rp.errorLog.Printf("ERROR_02_%s: %v\n", funcName, err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                 `json:"error"`
+		Message string               `json:"message"`
+		Report  *models.BalanceSheet `json:"report"`
+	}{
+		Error:   false,
+		Message: "Balance sheet generated successfully",
+		Report:  report,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (rp *ReportHandler) writeTrialBalance(w http.ResponseWriter, r *http.Request, branchID int64, funcName string) {
+	asOf, err := parseAsOfDate(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	report, err := rp.DB.GetTrialBalance(r.Context(), branchID, asOf)
+	if err != nil {
+		rp.errorLog.Printf("ERROR_02_%s: %v\n", funcName, err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                 `json:"error"`
+		Message string               `json:"message"`
+		Report  *models.TrialBalance `json:"report"`
+	}{
+		Error:   false,
+		Message: "Trial balance generated successfully",
+		Report:  report,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetReceivablesAging buckets the unpaid orders and sales of the branch by days past due.
+// Query: as_of (default today), salesperson_id, customer_id (drill-down), details=true (documents of every customer)
+// Example: GET /api/v1/reports/receivables-aging?as_of=2025-01-31&salesperson_id=4&details=true
+func (rp *ReportHandler) GetReceivablesAging(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		rp.errorLog.Println("ERROR_01_GetReceivablesAging: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	asOf, err := parseAsOfDate(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	var filter dbrepo.AgingFilter
+	if v := strings.TrimSpace(q.Get("salesperson_id")); v != "" {
+		if filter.SalespersonID, err = strconv.ParseInt(v, 10, 64); err != nil || filter.SalespersonID < 0 {
+			utils.BadRequest(w, errors.New("invalid salesperson_id"))
+			return
+		}
+	}
+	if v := strings.TrimSpace(q.Get("customer_id")); v != "" {
+		if filter.CustomerID, err = strconv.ParseInt(v, 10, 64); err != nil || filter.CustomerID < 0 {
+			utils.BadRequest(w, errors.New("invalid customer_id"))
+			return
+		}
+	}
+	filter.Details = q.Get("details") == "true"
+
+	report, err := rp.DB.GetReceivablesAging(r.Context(), branchID, asOf, filter)
+	if err != nil {
+		rp.errorLog.Println("ERROR_02_GetReceivablesAging:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                     `json:"error"`
+		Status  string                   `json:"status"`
+		Message string                   `json:"message"`
+		Report  *models.ReceivablesAging `json:"report"`
+	}{
+		Error:   false,
+		Status:  "success",
+		Message: "Receivables aging generated successfully",
+		Report:  report,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// parseAsOfDate reads the as_of query param (YYYY-MM-DD), defaulting to today
+func parseAsOfDate(r *http.Request) (time.Time, error) {
+	asOfStr := strings.TrimSpace(r.URL.Query().Get("as_of"))
+	if asOfStr == "" {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	asOf, err := time.Parse("2006-01-02", asOfStr)
+	if err != nil {
+		return time.Time{}, errors.New("invalid as_of format, expected YYYY-MM-DD")
+	}
+	return asOf, nil
+}
+
+// parseDateRange reads the start_date and end_date query params (YYYY-MM-DD),
+// defaulting to the current month
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	startDateStr := strings.TrimSpace(q.Get("start_date"))
+	endDateStr := strings.TrimSpace(q.Get("end_date"))
+
+	if startDateStr == "" || endDateStr == "" {
+		now := time.Now()
+		startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return startDate, startDate.AddDate(0, 1, -1), nil
+	}
+	startDate, err := time.Parse("2006-01-02", startDateStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start_date format, expected YYYY-MM-DD")
+	}
+	endDate, err := time.Parse("2006-01-02", endDateStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end_date format, expected YYYY-MM-DD")
+	}
+	if endDate.Before(startDate) {
+		return time.Time{}, time.Time{}, errors.New("end_date cannot be before start_date")
+	}
+	return startDate, endDate, nil
+}
+
+// GetDiscountReport returns gross, discount and net sales of the branch for a
+// period, with what each promotion gave away.
+// Example: GET /api/v1/reports/discounts?start_date=2025-01-01&end_date=2025-01-31
+func (rp *ReportHandler) GetDiscountReport(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		rp.errorLog.Println("ERROR_01_GetDiscountReport: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	report, err := rp.DB.GetDiscountReport(r.Context(), branchID, startDate, endDate)
+	if err != nil {
+		rp.errorLog.Println("ERROR_02_GetDiscountReport:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                   `json:"error"`
+		Message string                 `json:"message"`
+		Report  *models.DiscountReport `json:"report"`
+	}{
+		Error:   false,
+		Message: "Discount report generated successfully",
+		Report:  report,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetTaxSummary returns the tax charged on the sales and orders of the branch
+// in a period against the tax paid on its purchases, by tax and rate.
+// Example: GET /api/v1/reports/tax-summary?start_date=2025-01-01&end_date=2025-03-31
+func (rp *ReportHandler) GetTaxSummary(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		rp.errorLog.Println("ERROR_01_GetTaxSummary: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	summary, err := rp.DB.GetTaxSummary(r.Context(), branchID, startDate, endDate)
+	if err != nil {
+		rp.errorLog.Println("ERROR_02_GetTaxSummary:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool               `json:"error"`
+		Message string             `json:"message"`
+		Report  *models.TaxSummary `json:"report"`
+	}{
+		Error:   false,
+		Message: "Tax summary generated successfully",
+		Report:  summary,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetUpcomingInstallments returns the unpaid installments of the branch falling
+// due in the next days (default 30), with the overdue ones.
+// Example: GET /api/v1/reports/upcoming-installments?days=14
+func (rp *ReportHandler) GetUpcomingInstallments(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		rp.errorLog.Println("ERROR_01_GetUpcomingInstallments: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	days := 30
+	if s := strings.TrimSpace(r.URL.Query().Get("days")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 366 {
+			utils.BadRequest(w, errors.New("days must be a number between 0 and 366"))
+			return
+		}
+		days = n
+	}
+	y, m, d := time.Now().Date()
+	asOf := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	report, err := rp.DB.GetUpcomingInstallments(r.Context(), branchID, asOf, asOf.AddDate(0, 0, days))
+	if err != nil {
+		rp.errorLog.Println("ERROR_02_GetUpcomingInstallments:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                         `json:"error"`
+		Message string                       `json:"message"`
+		Report  *models.UpcomingInstallments `json:"report"`
+	}{
+		Error:   false,
+		Message: "Upcoming installments generated successfully",
+		Report:  report,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
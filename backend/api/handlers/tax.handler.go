@@ -0,0 +1,260 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// TaxHandler manages tax rates, the tax settings of the branches and the
+// tax categories of products
+type TaxHandler struct {
+	DB       *dbrepo.TaxRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewTaxHandler(db *dbrepo.TaxRepo, infoLog *log.Logger, errorLog *log.Logger) *TaxHandler {
+	return &TaxHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// taxRateRequest is the body of a new or changed tax rate
+type taxRateRequest struct {
+	AppliesTo   string       `json:"applies_to"` // default sales
+	Category    string       `json:"category"`   // default standard
+	Name        string       `json:"name"`
+	Rate        money.Amount `json:"rate"`
+	StartsOn    string       `json:"starts_on"`
+	EndsOn      string       `json:"ends_on"` // empty: until further notice
+	Active      *bool        `json:"active"`  // default true
+	AllBranches bool         `json:"all_branches"`
+}
+
+// taxRate reads the request into a tax rate of the branch
+func (req *taxRateRequest) taxRate(branchID int64) (*models.TaxRate, error) {
+	t := &models.TaxRate{
+		BranchID:  &branchID,
+		AppliesTo: req.AppliesTo,
+		Category:  req.Category,
+		Name:      req.Name,
+		Rate:      req.Rate,
+		Active:    req.Active == nil || *req.Active,
+	}
+	if t.AppliesTo == "" {
+		t.AppliesTo = models.TAX_ON_SALES
+	}
+	if strings.TrimSpace(t.Category) == "" {
+		t.Category = models.TAX_CATEGORY_STANDARD
+	}
+	var err error
+	if t.StartsOn, err = time.Parse("2006-01-02", req.StartsOn); err != nil {
+		return nil, errors.New("invalid starts_on format, expected YYYY-MM-DD")
+	}
+	if s := strings.TrimSpace(req.EndsOn); s != "" {
+		endsOn, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return nil, errors.New("invalid ends_on format, expected YYYY-MM-DD")
+		}
+		t.EndsOn = &endsOn
+	}
+	if req.AllBranches {
+		t.BranchID = nil
+	}
+	return t, nil
+}
+
+// ListTaxRates returns the tax rates that apply in the branch.
+// Example: GET /api/v1/tax-rates?active_on=2025-03-30 for the ones in force that day
+func (h *TaxHandler) ListTaxRates(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_ListTaxRates: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	var activeOn *time.Time
+	if s := strings.TrimSpace(r.URL.Query().Get("active_on")); s != "" {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			utils.BadRequest(w, errors.New("invalid active_on format, expected YYYY-MM-DD"))
+			return
+		}
+		activeOn = &d
+	}
+
+	rates, err := h.DB.ListTaxRates(r.Context(), branchID, activeOn)
+	if err != nil {
+		h.errorLog.Println("ERROR_02_ListTaxRates:", err)
+		utils.ServerError(w, err)
+		return
+	}
+
+	resp := struct {
+		Error    bool              `json:"error"`
+		TaxRates []*models.TaxRate `json:"tax_rates"`
+	}{
+		Error:    false,
+		TaxRates: rates,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// CreateTaxRate adds a tax rate to the branch, or to every branch (chairman only).
+// Body: {"applies_to":"sales","category":"standard","name":"VAT","rate":5,"starts_on":"2026-01-01","all_branches":true}
+func (h *TaxHandler) CreateTaxRate(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_CreateTaxRate: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	var req taxRateRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.errorLog.Println("ERROR_02_CreateTaxRate:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	rate, err := req.taxRate(branchID)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.CreateTaxRate(r.Context(), rate); err != nil {
+		h.errorLog.Println("ERROR_03_CreateTaxRate:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool            `json:"error"`
+		Message string          `json:"message"`
+		TaxRate *models.TaxRate `json:"tax_rate"`
+	}{
+		Error:   false,
+		Message: "Tax rate created successfully",
+		TaxRate: rate,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// UpdateTaxRate changes a tax rate (chairman only); the body is the one of
+// CreateTaxRate. Documents already taxed keep their tax.
+func (h *TaxHandler) UpdateTaxRate(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_UpdateTaxRate: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	rateID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if rateID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid tax rate id"))
+		return
+	}
+	var req taxRateRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.errorLog.Println("ERROR_02_UpdateTaxRate:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	rate, err := req.taxRate(branchID)
+	if err != nil {
+		utils.BadRequest(w, err)
+		return
+	}
+	rate.ID = rateID
+
+	if err := h.DB.UpdateTaxRate(r.Context(), branchID, rate); err != nil {
+		h.errorLog.Println("ERROR_03_UpdateTaxRate:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool            `json:"error"`
+		Message string          `json:"message"`
+		TaxRate *models.TaxRate `json:"tax_rate"`
+	}{
+		Error:   false,
+		Message: "Tax rate updated successfully",
+		TaxRate: rate,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// SetBranchTaxSettings sets the tax id of a branch and whether its prices
+// include tax (chairman only).
+// Body: {"tax_id":"300123456700003","prices_include_tax":true}
+func (h *TaxHandler) SetBranchTaxSettings(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if branchID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid branch id"))
+		return
+	}
+	var settings models.TaxSettings
+	if err := utils.ReadJSON(w, r, &settings); err != nil {
+		h.errorLog.Println("ERROR_01_SetBranchTaxSettings:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.SetBranchTaxSettings(r.Context(), branchID, &settings); err != nil {
+		h.errorLog.Println("ERROR_02_SetBranchTaxSettings:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	var resp models.Response
+	resp.Error = false
+	resp.Message = "Tax settings updated successfully"
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// SetProductTaxCategory puts a product of the branch in a tax category.
+// Body: {"tax_category":"standard"}
+func (h *TaxHandler) SetProductTaxCategory(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		h.errorLog.Println("ERROR_01_SetProductTaxCategory: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	productID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if productID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid product id"))
+		return
+	}
+	var body struct {
+		TaxCategory string `json:"tax_category"`
+	}
+	if err := utils.ReadJSON(w, r, &body); err != nil {
+		h.errorLog.Println("ERROR_02_SetProductTaxCategory:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	if err := h.DB.SetProductTaxCategory(r.Context(), branchID, productID, body.TaxCategory); err != nil {
+		h.errorLog.Println("ERROR_03_SetProductTaxCategory:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	var resp models.Response
+	resp.Error = false
+	resp.Message = "Product tax category updated successfully"
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
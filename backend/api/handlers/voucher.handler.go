@@ -0,0 +1,194 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/dbrepo"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// VoucherHandler sells gift vouchers, redeems them on orders and sales of any
+// branch and reports their movements
+type VoucherHandler struct {
+	DB       *dbrepo.VoucherRepo
+	infoLog  *log.Logger
+	errorLog *log.Logger
+}
+
+func NewVoucherHandler(db *dbrepo.VoucherRepo, infoLog *log.Logger, errorLog *log.Logger) *VoucherHandler {
+	return &VoucherHandler{
+		DB:       db,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// SellVoucher handles POST /vouchers/new.
+// Body: {"face_value": 1000, "account_id": 1, "customer_id": 7, "expires_on": "2027-04-30T00:00:00Z", "code": ""}
+func (v *VoucherHandler) SellVoucher(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		v.errorLog.Println("ERROR_01_SellVoucher: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var req models.VoucherSaleRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		v.errorLog.Println("ERROR_02_SellVoucher:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	req.BranchID = branchID
+	if req.SaleDate.IsZero() {
+		req.SaleDate = utils.Today()
+	}
+	if req.AccountID == 0 {
+		utils.BadRequest(w, errors.New("account_id is required"))
+		return
+	}
+
+	voucher, err := v.DB.SellVoucher(r.Context(), &req)
+	if err != nil {
+		v.errorLog.Println("ERROR_03_SellVoucher:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                `json:"error"`
+		Message string              `json:"message"`
+		Voucher *models.GiftVoucher `json:"voucher"`
+	}{
+		Error:   false,
+		Message: "Gift voucher sold successfully",
+		Voucher: voucher,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// GetVoucher handles GET /vouchers/{code}; vouchers are looked up in every branch
+func (v *VoucherHandler) GetVoucher(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+	if code == "" {
+		utils.BadRequest(w, errors.New("voucher code is required"))
+		return
+	}
+
+	voucher, err := v.DB.GetVoucher(r.Context(), code)
+	if err != nil {
+		v.errorLog.Println("ERROR_01_GetVoucher:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                `json:"error"`
+		Voucher *models.GiftVoucher `json:"voucher"`
+	}{
+		Error:   false,
+		Voucher: voucher,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// RedeemVoucher handles POST /vouchers/redeem and pays an order or sale of the
+// branch already recorded with a voucher.
+// Body: {"code": "GV-7KQM-X2RD", "document_type": "order", "document_id": 12, "amount": 300}
+func (v *VoucherHandler) RedeemVoucher(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		v.errorLog.Println("ERROR_01_RedeemVoucher: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	var req models.VoucherRedeemRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		v.errorLog.Println("ERROR_02_RedeemVoucher:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+	req.BranchID = branchID
+	if req.EntryDate.IsZero() {
+		req.EntryDate = utils.Today()
+	}
+
+	entry, err := v.DB.RedeemVoucher(r.Context(), &req)
+	if err != nil {
+		v.errorLog.Println("ERROR_03_RedeemVoucher:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error   bool                 `json:"error"`
+		Message string               `json:"message"`
+		Entry   *models.VoucherEntry `json:"entry"`
+	}{
+		Error:   false,
+		Message: "Gift voucher redeemed successfully",
+		Entry:   entry,
+	}
+	utils.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// GetVoucherLedger query: code, start_date, end_date (default: current month).
+// Without a code it lists the voucher movements of the branch.
+// Example: GET /api/v1/vouchers/ledger?start_date=2026-03-01&end_date=2026-03-31
+func (v *VoucherHandler) GetVoucherLedger(w http.ResponseWriter, r *http.Request) {
+	code := utils.GetURLParam(r, "code")
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 && code == "" {
+		v.errorLog.Println("ERROR_01_GetVoucherLedger: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	const dateLayout = "2006-01-02"
+	var startDate, endDate time.Time
+	var err error
+	startDateStr := utils.GetURLParam(r, "start_date")
+	endDateStr := utils.GetURLParam(r, "end_date")
+	if startDateStr == "" || endDateStr == "" {
+		now := time.Now()
+		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		endDate = startDate.AddDate(0, 1, -1)
+	} else {
+		if startDate, err = time.Parse(dateLayout, startDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid start_date format, expected YYYY-MM-DD"))
+			return
+		}
+		if endDate, err = time.Parse(dateLayout, endDateStr); err != nil {
+			utils.BadRequest(w, errors.New("invalid end_date format, expected YYYY-MM-DD"))
+			return
+		}
+	}
+	if endDate.Before(startDate) {
+		utils.BadRequest(w, errors.New("end_date cannot be before start_date"))
+		return
+	}
+
+	ledger, err := v.DB.GetVoucherLedger(r.Context(), branchID, code, startDate, endDate)
+	if err != nil {
+		v.errorLog.Println("ERROR_02_GetVoucherLedger:", err)
+		utils.BadRequest(w, err)
+		return
+	}
+
+	resp := struct {
+		Error  bool                  `json:"error"`
+		Status string                `json:"status"`
+		Ledger *models.VoucherLedger `json:"ledger"`
+	}{
+		Error:  false,
+		Status: "success",
+		Ledger: ledger,
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/printing"
+	"github.com/projuktisheba/erp-mini-api/internal/storage"
+	"github.com/projuktisheba/erp-mini-api/internal/utils"
+)
+
+// ticketPhotos reads the photos printed on a work ticket, preferring their thumbnails
+func ticketPhotos(ctx context.Context, files storage.Store) func(models.Attachment) (io.ReadCloser, error) {
+	return func(photo models.Attachment) (io.ReadCloser, error) {
+		key := photo.StoragePath
+		if photo.ThumbPath != nil {
+			key = *photo.ThumbPath
+		}
+		return files.Open(ctx, key)
+	}
+}
+
+// GetOrderWorkTicket handles GET /orders/{id}/work-ticket.pdf
+func (o *OrderHandler) GetOrderWorkTicket(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if orderID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid order id"))
+		return
+	}
+
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		o.errorLog.Println("ERROR_01_GetOrderWorkTicket: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+
+	order, err := o.DB.GetOrderDetailsByID(r.Context(), orderID)
+	if err != nil {
+		o.errorLog.Println("ERROR_02_GetOrderWorkTicket:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	if order.BranchID != branchID {
+		utils.BadRequest(w, errors.New("order not found in this branch"))
+		return
+	}
+
+	data, err := printing.OrderWorkTicketPDF(order, ticketPhotos(r.Context(), o.Files))
+	if err != nil {
+		o.errorLog.Println("ERROR_03_GetOrderWorkTicket:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="work-ticket-`+order.MemoNo+`.pdf"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// writeJobSheets renders job sheets of orders and sends them
+func (o *OrderHandler) writeJobSheets(w http.ResponseWriter, orders []*models.OrderDB, name, caller string) {
+	data, err := printing.JobSheetsPDF(orders, o.Fonts)
+	if err != nil {
+		o.errorLog.Println("ERROR_03_"+caller+":", err)
+		utils.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+name+`.pdf"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// GetOrderJobSheets handles GET /orders/{id}/job-sheets.pdf
+// The cutting room's sheets of an order, one per item; ?item_id= prints one item.
+func (o *OrderHandler) GetOrderJobSheets(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if orderID == 0 || err != nil {
+		utils.BadRequest(w, errors.New("Invalid order id"))
+		return
+	}
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		o.errorLog.Println("ERROR_01_GetOrderJobSheets: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	var itemID int64
+	if v := r.URL.Query().Get("item_id"); v != "" {
+		if itemID, err = strconv.ParseInt(v, 10, 64); err != nil || itemID <= 0 {
+			utils.BadRequest(w, errors.New("Invalid item id"))
+			return
+		}
+	}
+
+	order, err := o.DB.GetOrderDetailsByID(r.Context(), orderID)
+	if err != nil {
+		o.errorLog.Println("ERROR_02_GetOrderJobSheets:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	if order.BranchID != branchID {
+		utils.BadRequest(w, errors.New("order not found in this branch"))
+		return
+	}
+	name := "job-sheets-" + order.MemoNo
+	if itemID != 0 {
+		var items []models.OrderItemDB
+		for _, it := range order.Items {
+			if it.ID == itemID {
+				items = append(items, it)
+			}
+		}
+		if len(items) == 0 {
+			utils.BadRequest(w, errors.New("item not found in this order"))
+			return
+		}
+		order.Items = items
+		name = printing.JobTag(itemID)
+	}
+	o.writeJobSheets(w, []*models.OrderDB{order}, name, "GetOrderJobSheets")
+}
+
+// GetDueJobSheets handles GET /orders/job-sheets.pdf
+// Job sheets of every item of the branch's undelivered orders due in a week,
+// Monday to Sunday. Query: week=YYYY-MM-DD (any day of the week, default today)
+func (o *OrderHandler) GetDueJobSheets(w http.ResponseWriter, r *http.Request) {
+	branchID := utils.GetBranchID(r)
+	if branchID == 0 {
+		o.errorLog.Println("ERROR_01_GetDueJobSheets: Branch id not found")
+		utils.BadRequest(w, errors.New("Branch ID not found. Please include 'X-Branch-ID' header, e.g., X-Branch-ID: 1"))
+		return
+	}
+	const dateLayout = "2006-01-02"
+	day := time.Now()
+	if v := r.URL.Query().Get("week"); v != "" {
+		var err error
+		if day, err = time.Parse(dateLayout, v); err != nil {
+			utils.BadRequest(w, errors.New("invalid week, use YYYY-MM-DD"))
+			return
+		}
+	}
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	start := day.AddDate(0, 0, -(int(day.Weekday())+6)%7) // Monday
+	end := start.AddDate(0, 0, 6)
+
+	orders, err := o.DB.GetOrdersDue(r.Context(), branchID, start, end)
+	if err != nil {
+		o.errorLog.Println("ERROR_02_GetDueJobSheets:", err)
+		utils.ServerError(w, err)
+		return
+	}
+	o.writeJobSheets(w, orders, "job-sheets-"+start.Format(dateLayout), "GetDueJobSheets")
+}
@@ -11,18 +11,15 @@ import (
 	"github.com/projuktisheba/erp-mini-api/internal/utils"
 )
 
-type Role string
+type Role = utils.Role
 
 const (
-	RoleAdmin    Role = "admin"
-	RoleManager  Role = "manager"
-	RoleEmployee Role = "employee"
+	RoleChairman = utils.RoleChairman
+	RoleAdmin    = utils.RoleAdmin
+	RoleManager  = utils.RoleManager
+	RoleEmployee = utils.RoleEmployee
 )
 
-// consistent context key used everywhere
-type contextKey string
-const userContextKey = contextKey("user")
-
 // ========================= AUTH USER ==============================
 // AuthUser: validates JWT, attaches *models.JWT to context.
 // Important: skips OPTIONS (CORS preflight) so preflight won't be blocked.
@@ -118,34 +115,30 @@ func (app *application) AuthUser(next http.Handler) http.Handler {
 		}
 
 		// attach user to context using consistent key
-		ctx := context.WithValue(r.Context(), userContextKey, tokenUser)
+		ctx := utils.ContextWithUser(r.Context(), tokenUser)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// OptionalAuthUser: like AuthUser when an Authorization header is sent,
+// otherwise lets the request through without a user in the context.
+func (app *application) OptionalAuthUser(next http.Handler) http.Handler {
+	auth := app.AuthUser(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth.ServeHTTP(w, r)
+	})
+}
+
 // ========================= CONTEXT HELPERS ==============================
 func (app *application) UserFromContext(ctx context.Context) (*models.JWT, bool) {
-	u, ok := ctx.Value(userContextKey).(*models.JWT)
-	if !ok || u == nil {
-		return nil, false
-	}
-	return u, true
+	return utils.UserFromContext(ctx)
 }
 
 // ========================= ACCESS CONTROL ==============================
-func HasAccess(userRole, required Role) bool {
-	switch required {
-	case RoleAdmin:
-		return userRole == RoleAdmin
-	case RoleManager:
-		return userRole == RoleAdmin || userRole == RoleManager
-	case RoleEmployee:
-		return false
-	default:
-		return false
-	}
-}
-
 func (app *application) RequireRole(required Role) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -159,7 +152,7 @@ func (app *application) RequireRole(required Role) func(next http.Handler) http.
 			}
 
 			userRole := Role(user.Role)
-			if !HasAccess(userRole, required) {
+			if !utils.HasAccess(userRole, required) {
 				utils.WriteJSON(w, http.StatusForbidden, models.Response{
 					Error:   true,
 					Message: "Forbidden: Insufficient permissions",
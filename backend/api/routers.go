@@ -3,7 +3,6 @@ package api
 import (
 	"net"
 	"net/http"
-	"path/filepath"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
@@ -26,10 +25,18 @@ func (app *application) routes() http.Handler {
 	// --- Public Routes ---
 	mux.Post("/api/v1/signin", app.Handlers.Auth.Signin)
 
-	// --- Static file serving for images ---
-	imageDir := filepath.Join(".", "data", "images")
-	fs := http.StripPrefix("/api/v1/images/", http.FileServer(http.Dir(imageDir)))
-	mux.Handle("/api/v1/images/*", fs)
+	// --- Stored files ---
+	// Signed links (?expires=…&signature=…) need no token; otherwise signed-in
+	// users are redirected to a fresh signed link of an employee picture.
+	mux.Get("/api/v1/files/*", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("signature") {
+			app.Handlers.File.ServeSignedFile(w, r)
+			return
+		}
+		app.AuthUser(http.HandlerFunc(app.Handlers.File.RedirectToFile)).ServeHTTP(w, r)
+	})
+	// links saved before files moved into the store
+	mux.With(app.AuthUser).Get("/api/v1/images/*", app.Handlers.File.RedirectImage)
 
 	// --- Health check ---
 	mux.Get("/api/v1/ping", func(w http.ResponseWriter, r *http.Request) {
@@ -102,7 +109,21 @@ func (app *application) routes() http.Handler {
 		//update customer
 		r.Put("/customer/update/{id}", app.Handlers.Customer.UpdateCustomerInfo)
 
-		// r.Put("/customer/due/deduct", app.Handlers.Customer.DeductCustomerDueAmount)
+		// receive payment and allocate it to open orders and sales
+		r.Post("/customer/payment", app.Handlers.Customer.ReceivePayment)
+		r.Get("/customer/{id}/open-documents", app.Handlers.Customer.GetOpenDocuments)
+		// statement of account; query {start_date, end_date, format: json|pdf|csv}
+		r.Get("/customer/{id}/statement", app.Handlers.Customer.GetCustomerStatement)
+		// store credit wallet; history query {start_date, end_date}
+		r.Get("/customer/{id}/store-credit", app.Handlers.Customer.GetStoreCredit)
+		r.Post("/customer/store-credit/topup", app.Handlers.Customer.TopUpStoreCredit)
+		r.Post("/customer/store-credit/withdraw", app.Handlers.Customer.WithdrawStoreCredit)
+		r.Post("/customer/store-credit/refund", app.Handlers.Customer.RefundToStoreCredit)
+		// loyalty points ledger; query {start_date, end_date}
+		r.Get("/customer/{id}/loyalty", app.Handlers.Customer.GetLoyaltyPoints)
+		// credit limit; body {"credit_limit": 5000 | null}
+		r.With(app.AuthUser, app.RequireRole(RoleManager)).Put("/customer/{id}/credit-limit", app.Handlers.Customer.SetCustomerCreditLimit)
+
 		// r.Put("/customer/status", app.Handlers.Customer.UpdateCustomerStatus)
 
 		r.Get("/customers", app.Handlers.Customer.GetCustomers) //query {branchID, limit, page}
@@ -123,21 +144,40 @@ func (app *application) routes() http.Handler {
 		r.Post("/stock/add", app.Handlers.Product.RestockProducts)
 		r.Get("/stocks", app.Handlers.Product.GetProductStockReportHandler)
 		r.Delete("/stocks/delete/{id}", app.Handlers.Product.DeleteStockProducts)
-		r.Post("/sales/new", app.Handlers.Product.AddSale)
-		r.Patch("/sales/update/{id}", app.Handlers.Product.UpdateSale)
+		// Example: PUT /api/v1/products/7/tax-category {"tax_category":"standard"}
+		r.With(app.AuthUser, app.RequireRole(RoleManager)).Put("/{id}/tax-category", app.Handlers.Tax.SetProductTaxCategory)
+		// a signed-in manager may send credit_override to go over the customer's credit limit,
+		// and discount_approval for discounts above the branch threshold
+		r.With(app.OptionalAuthUser).Post("/sales/new", app.Handlers.Product.AddSale)
+		r.With(app.OptionalAuthUser).Patch("/sales/update/{id}", app.Handlers.Product.UpdateSale)
 		r.Get("/sales/details/{sale_id}", app.Handlers.Product.GetSaleDetailsByID)
+		r.Get("/sales/details/{sale_id}/invoice.pdf", app.Handlers.Invoice.GetSaleInvoice)    // ?type=sale|refund&lang=en|ar
+		r.Get("/sales/details/{sale_id}/receipt.escpos", app.Handlers.Invoice.GetSaleReceipt) // thermal receipt; also &paper=80|58
 		r.Get("/sales/list", app.Handlers.Product.GetSalesHandler)
 
 		// -------------------- Order Routes --------------------
-		r.Post("/orders/new", app.Handlers.Order.AddOrder)
+		// a signed-in manager may send credit_override to go over the customer's credit limit,
+		// and discount_approval for discounts above the branch threshold
+		r.With(app.OptionalAuthUser).Post("/orders/new", app.Handlers.Order.AddOrder)
 
 		// r.Get("/orders/search", app.Handlers.Order.SearchOrders)
 		r.Get("/orders", app.Handlers.Order.GetOrdersHandler)
 		r.Get("/orders/{id}", app.Handlers.Order.GetOrderDetailsByID)
-		r.Patch("/orders/update/{id}", app.Handlers.Order.UpdateOrder)
-		// r.Delete("orders/cancel/{id}", app.Handlers.Order.CancelOrder)
+		r.Get("/orders/{id}/work-ticket.pdf", app.Handlers.Order.GetOrderWorkTicket)
+		r.Get("/orders/{id}/job-sheets.pdf", app.Handlers.Order.GetOrderJobSheets) // ?item_id= for one item
+		// job sheets of every order due in the week; ?week=2025-01-15 (default this week)
+		r.Get("/orders/job-sheets.pdf", app.Handlers.Order.GetDueJobSheets)
+		r.Get("/orders/{id}/invoice.pdf", app.Handlers.Invoice.GetOrderInvoice)    // ?type=order|delivery|refund&lang=en|ar
+		r.Get("/orders/{id}/receipt.escpos", app.Handlers.Invoice.GetOrderReceipt) // thermal receipt; also &paper=80|58
+		r.With(app.OptionalAuthUser).Patch("/orders/update/{id}", app.Handlers.Order.UpdateOrder)
+		// money paid on a cancelled order is kept as store credit; query {reason}
+		r.Delete("/orders/cancel/{id}", app.Handlers.Order.CancelOrder)
 		// r.Patch("/checkout", app.Handlers.Order.CheckoutOrder)
 		r.Post("/orders/delivery", app.Handlers.Order.OrderDelivery)
+		// installment plan of the balance, and money paid on it before or between deliveries
+		r.Get("/orders/{id}/installments", app.Handlers.Order.GetInstallments)
+		r.Put("/orders/{id}/installments", app.Handlers.Order.SetInstallmentPlan)
+		r.Post("/orders/{id}/payments", app.Handlers.Order.ReceiveInstallment)
 		// r.Get("/", app.Handlers.Order.GetOrderDetailsByID)
 		// r.Get("/items", app.Handlers.Order.GetOrderItemsByMemoNo)
 		// r.Get("/list", app.Handlers.Order.ListOrders)
@@ -153,6 +193,9 @@ func (app *application) routes() http.Handler {
 		r.Patch("/update/{id}", app.Handlers.Purchase.UpdatePurchase)
 		r.Delete("/delete/{id}", app.Handlers.Purchase.DeletePurchase)
 		r.Get("/list", app.Handlers.Purchase.GetPurchaseReport)
+		// pay a supplier later and allocate it to open purchases
+		r.Post("/supplier-payment", app.Handlers.Purchase.PaySupplier)
+		r.Get("/supplier/{id}/open", app.Handlers.Purchase.GetOpenPurchases)
 	})
 
 	// -------------------- Account & Transaction Routes --------------------
@@ -166,6 +209,27 @@ func (app *application) routes() http.Handler {
 		r.Get("/list", app.Handlers.Transaction.ListTransactionsPaginatedHandler)
 	})
 
+	// -------------------- Bank Reconciliation Routes --------------------
+	protected.Route("/api/v1/bank", func(r chi.Router) {
+		r.Post("/csv-mappings/new", app.Handlers.Reconciliation.AddCSVMapping)
+		r.Get("/csv-mappings", app.Handlers.Reconciliation.GetCSVMappings)
+
+		// multipart: file, account_id, format (csv|ofx|camt053), mapping_id
+		r.Post("/statements/import", app.Handlers.Reconciliation.ImportStatement)
+		r.Get("/statements", app.Handlers.Reconciliation.ListStatements)
+		r.Get("/statements/{id}/lines", app.Handlers.Reconciliation.GetStatementLines)
+		r.Post("/statements/{id}/auto-match", app.Handlers.Reconciliation.AutoMatchStatement)
+
+		r.Get("/lines/{id}/candidates", app.Handlers.Reconciliation.GetMatchCandidates)
+		r.Post("/lines/{id}/match", app.Handlers.Reconciliation.MatchLine)
+		r.Post("/lines/{id}/unmatch", app.Handlers.Reconciliation.UnmatchLine)
+		r.Post("/lines/{id}/ignore", app.Handlers.Reconciliation.IgnoreLine)
+		r.Post("/lines/{id}/create-entry", app.Handlers.Reconciliation.CreateEntryFromLine)
+
+		// Example: GET /api/v1/bank/reconciliation?account_id=2&start_date=2025-01-01&end_date=2025-01-31
+		r.Get("/reconciliation", app.Handlers.Reconciliation.GetReconciliationReport)
+	})
+
 	// -------------------- Report Routes --------------------
 	protected.Route("/api/v1/reports", func(r chi.Router) {
 		r.Get("/dashboard/orders/overview", app.Handlers.Report.GetOrderOverView)
@@ -173,6 +237,175 @@ func (app *application) routes() http.Handler {
 		r.Get("/employee/salary", app.Handlers.Report.GetEmployeeSalaryReport)
 		r.Get("/worker/progress", app.Handlers.Report.GetWorkerProgressReport)
 		r.Get("/branch", app.Handlers.Report.GetBranchReport)
+		// Example: GET /api/v1/reports/profit-loss?start_date=2025-01-01&end_date=2025-01-31
+		r.Get("/profit-loss", app.Handlers.Report.GetProfitAndLoss)
+		// Example: GET /api/v1/reports/balance-sheet?as_of=2025-01-31
+		r.Get("/balance-sheet", app.Handlers.Report.GetBalanceSheet)
+		// Example: GET /api/v1/reports/trial-balance?as_of=2025-01-31
+		r.Get("/trial-balance", app.Handlers.Report.GetTrialBalance)
+		// Example: GET /api/v1/reports/receivables-aging?as_of=2025-01-31&salesperson_id=4&details=true
+		r.Get("/receivables-aging", app.Handlers.Report.GetReceivablesAging)
+		// gross, discount and net sales with what each promotion gave away
+		// Example: GET /api/v1/reports/discounts?start_date=2025-01-01&end_date=2025-01-31
+		r.Get("/discounts", app.Handlers.Report.GetDiscountReport)
+		// tax charged on sales and orders against tax paid on purchases
+		// Example: GET /api/v1/reports/tax-summary?start_date=2025-01-01&end_date=2025-03-31
+		r.Get("/tax-summary", app.Handlers.Report.GetTaxSummary)
+		// unpaid installments due in the next days, with the overdue ones
+		// Example: GET /api/v1/reports/upcoming-installments?days=14
+		r.Get("/upcoming-installments", app.Handlers.Report.GetUpcomingInstallments)
+	})
+
+	// -------------------- Tax Rate Routes --------------------
+	protected.Route("/api/v1/tax-rates", func(r chi.Router) {
+		// Example: GET /api/v1/tax-rates?active_on=2026-01-01
+		r.Get("/", app.Handlers.Tax.ListTaxRates)
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.AuthUser, app.RequireRole(RoleChairman))
+			// Example: POST /api/v1/tax-rates {"applies_to":"sales","category":"standard","name":"VAT","rate":5,"starts_on":"2026-01-01","all_branches":true}
+			r.Post("/", app.Handlers.Tax.CreateTaxRate)
+			r.Put("/{id}", app.Handlers.Tax.UpdateTaxRate)
+		})
+	})
+
+	// -------------------- Promotion Routes --------------------
+	protected.Route("/api/v1/promotions", func(r chi.Router) {
+		// Example: GET /api/v1/promotions?active_on=2025-03-30
+		r.Get("/", app.Handlers.Promotion.ListPromotions)
+		r.Get("/{id}", app.Handlers.Promotion.GetPromotion)
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.AuthUser, app.RequireRole(RoleManager))
+			// Example: POST /api/v1/promotions {"name":"Eid sale","discount_type":"percent","discount_value":15,"starts_on":"2025-03-25","ends_on":"2025-04-05"}
+			r.Post("/", app.Handlers.Promotion.CreatePromotion)
+			r.Put("/{id}", app.Handlers.Promotion.UpdatePromotion)
+			// Example: POST /api/v1/promotions/3/coupons {"code":"EID25","max_uses":100,"max_uses_per_customer":1}
+			r.Post("/{id}/coupons", app.Handlers.Promotion.AddCoupon)
+			r.Put("/coupons/{id}/active", app.Handlers.Promotion.SetCouponActive)
+		})
+	})
+
+	// -------------------- Loyalty Rule Routes --------------------
+	protected.Route("/api/v1/loyalty-rules", func(r chi.Router) {
+		// Example: GET /api/v1/loyalty-rules
+		r.Get("/", app.Handlers.Loyalty.ListLoyaltyRules)
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.AuthUser, app.RequireRole(RoleManager))
+			// Example: POST /api/v1/loyalty-rules {"name":"Standard","amount_per_point":100,"point_value":1,"expiry_months":12,"starts_on":"2026-01-01"}
+			r.Post("/", app.Handlers.Loyalty.CreateLoyaltyRule)
+			r.Put("/{id}", app.Handlers.Loyalty.UpdateLoyaltyRule)
+		})
+	})
+
+	// -------------------- Gift Voucher Routes --------------------
+	protected.Route("/api/v1/vouchers", func(r chi.Router) {
+		// Example: POST /api/v1/vouchers/new {"face_value":1000,"account_id":1,"expires_on":"2027-04-30T00:00:00Z"}
+		r.Post("/new", app.Handlers.Voucher.SellVoucher)
+		// Example: POST /api/v1/vouchers/redeem {"code":"GV-7KQM-X2RD","document_type":"sale","document_id":31,"amount":250}
+		r.Post("/redeem", app.Handlers.Voucher.RedeemVoucher)
+		// Example: GET /api/v1/vouchers/ledger?code=GV-7KQM-X2RD&start_date=2026-03-01&end_date=2026-03-31
+		r.Get("/ledger", app.Handlers.Voucher.GetVoucherLedger)
+		// Example: GET /api/v1/vouchers/GV-7KQM-X2RD
+		r.Get("/{code}", app.Handlers.Voucher.GetVoucher)
+	})
+
+	// -------------------- Measurement Routes --------------------
+	protected.Route("/api/v1/measurements", func(r chi.Router) {
+		// garment types and the measurements each one needs
+		r.Get("/garment-types", app.Handlers.Measurement.ListGarmentTypes)
+		r.Post("/garment-types", app.Handlers.Measurement.CreateGarmentType)
+		r.Put("/garment-types/{id}", app.Handlers.Measurement.UpdateGarmentType)
+
+		// customer profiles; every change of measurements is kept as a version
+		r.Get("/customers/{id}/profiles", app.Handlers.Measurement.ListProfiles)
+		r.With(app.OptionalAuthUser).Post("/customers/{id}/profiles", app.Handlers.Measurement.CreateProfile)
+		r.Get("/profiles/{id}", app.Handlers.Measurement.GetProfile)
+		r.Put("/profiles/{id}", app.Handlers.Measurement.UpdateProfile)
+		r.With(app.OptionalAuthUser).Post("/profiles/{id}/versions", app.Handlers.Measurement.AddVersion)
+		r.Get("/profiles/{id}/history", app.Handlers.Measurement.GetProfileHistory)
+	})
+
+	// -------------------- Accounting Period Routes --------------------
+	protected.Route("/api/v1/periods", func(r chi.Router) {
+		r.Get("/", app.Handlers.Period.ListPeriods)
+		r.Get("/audit", app.Handlers.Period.GetPeriodAudit)
+		// Corrections of closed months are posted in an open period by a manager
+		r.With(app.AuthUser, app.RequireRole(RoleManager)).Post("/adjustments", app.Handlers.Period.PostAdjustment)
+		r.Get("/adjustments", app.Handlers.Period.ListAdjustments)
+	})
+
+	// -------------------- Attachment Routes --------------------
+	protected.Route("/api/v1/attachments", func(r chi.Router) {
+		r.Use(app.AuthUser)
+
+		// Upload a file linked to an order, order item, customer, purchase or expense
+		// Example: POST /api/v1/attachments (multipart: file, entity_type=order, entity_id=5, caption)
+		r.Post("/", app.Handlers.Attachment.UploadAttachment)
+		// Example: GET /api/v1/attachments?entity_type=order&entity_id=5
+		r.Get("/", app.Handlers.Attachment.ListAttachments)
+		// Space used by the branch against its quota
+		r.Get("/usage", app.Handlers.Attachment.GetUsage)
+		r.Get("/{id}", app.Handlers.Attachment.DownloadAttachment)
+		r.Get("/{id}/thumbnail", app.Handlers.Attachment.DownloadThumbnail)
+		// Short-lived link usable without the token, e.g. in <img src>
+		// Example: GET /api/v1/attachments/7/url?thumbnail=true
+		r.Get("/{id}/url", app.Handlers.Attachment.GetSignedURL)
+		r.Delete("/{id}", app.Handlers.Attachment.DeleteAttachment)
+	})
+
+	// -------------------- Receipt Print Queue Routes --------------------
+	protected.Route("/api/v1/print-jobs", func(r chi.Router) {
+		// Example: POST /api/v1/print-jobs {"document_type":"order","document_id":12,"type":"delivery","lang":"ar","paper":80}
+		r.With(app.OptionalAuthUser).Post("/", app.Handlers.PrintJob.CreatePrintJob)
+		// Example: GET /api/v1/print-jobs?status=failed
+		r.Get("/", app.Handlers.PrintJob.ListPrintJobs)
+
+		// Polled by the POS client; 204 when nothing is waiting
+		// Example: GET /api/v1/print-jobs/next?printer=counter-1&raw=true
+		r.Get("/next", app.Handlers.PrintJob.NextPrintJob)
+		r.Post("/{id}/done", app.Handlers.PrintJob.PrintJobDone)
+		// body {"error": "paper out"}
+		r.Post("/{id}/failed", app.Handlers.PrintJob.PrintJobFailed)
+		r.Post("/{id}/retry", app.Handlers.PrintJob.RetryPrintJob)
+	})
+
+	// -------------------- Admin Routes (chairman only) --------------------
+	protected.Route("/api/v1/admin", func(r chi.Router) {
+		r.Use(app.AuthUser, app.RequireRole(RoleChairman))
+
+		// Recompute top_sheet and employees_progress from source documents
+		// Example: POST /api/v1/admin/aggregates/rebuild {"start_date":"2025-01-01","end_date":"2025-01-31","apply":false}
+		r.Post("/aggregates/rebuild", app.Handlers.Aggregate.RebuildAggregates)
+
+		// Month close / re-open per branch (audited)
+		// Example: POST /api/v1/admin/periods/close {"month":"2025-01","reason":"reported"}
+		r.Post("/periods/close", app.Handlers.Period.ClosePeriod)
+		r.Post("/periods/reopen", app.Handlers.Period.ReopenPeriod)
+
+		// Default credit limit of a branch's customers; body {"credit_limit": 3000 | null}
+		r.Put("/branches/{id}/credit-limit", app.Handlers.Customer.SetBranchCreditLimit)
+		// Discounts given by hand above this share of the gross need a manager; body {"approval_percent": 10 | null}
+		r.Put("/branches/{id}/discount-approval", app.Handlers.Promotion.SetBranchDiscountApproval)
+		// Tax id printed on tax invoices and whether prices include tax; body {"tax_id": "...", "prices_include_tax": true}
+		r.Put("/branches/{id}/tax-settings", app.Handlers.Tax.SetBranchTaxSettings)
+		// Space a branch may use for attachments; body {"quota_mb": 2048}
+		r.Put("/branches/{id}/attachment-quota", app.Handlers.Attachment.SetQuota)
+		// Terms printed under the branch's invoices; body {"invoice_terms": "...", "invoice_terms_ar": "..."}
+		r.Put("/branches/{id}/invoice-terms", app.Handlers.Invoice.SetInvoiceTerms)
+		// Memo numbering per document type (order, sale, purchase, salary, refund, transfer, ...)
+		// Example: PUT /api/v1/admin/branches/1/memo-sequences/order {"prefix":"DIVA-OR","padding":6,"yearly":true}
+		r.Get("/branches/{id}/memo-sequences", app.Handlers.Memo.ListMemoSequences)
+		r.Put("/branches/{id}/memo-sequences/{type}", app.Handlers.Memo.SetMemoSequence)
+
+		// Consolidated profit and loss of all branches
+		// Example: GET /api/v1/admin/reports/profit-loss?start_date=2025-01-01&end_date=2025-01-31
+		r.Get("/reports/profit-loss", app.Handlers.Report.GetConsolidatedProfitAndLoss)
+		// Consolidated balance sheet and trial balance
+		// Example: GET /api/v1/admin/reports/balance-sheet?as_of=2025-01-31
+		r.Get("/reports/balance-sheet", app.Handlers.Report.GetConsolidatedBalanceSheet)
+		r.Get("/reports/trial-balance", app.Handlers.Report.GetConsolidatedTrialBalance)
 	})
 
 	// Mount protected routes
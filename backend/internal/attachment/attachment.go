@@ -0,0 +1,138 @@
+// Package attachment checks uploaded files, makes their thumbnails and names
+// them in the file store.
+package attachment
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // decode uploads for thumbnails
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+)
+
+// MaxSize is the largest file accepted
+const MaxSize = 10 << 20
+
+// ThumbSide is the longer side of a thumbnail in pixels
+const ThumbSide = 256
+
+// MaxThumbPixels is the largest image (width × height) a thumbnail is made of;
+// a small file can declare a huge image that would take gigabytes to decode
+const MaxThumbPixels = 40_000_000
+
+var (
+	ErrTooLarge        = fmt.Errorf("file is larger than %d MB", MaxSize>>20)
+	ErrUnsupportedType = errors.New("only jpg, png, gif, webp and pdf files are allowed")
+)
+
+// allowed maps the accepted content types to the extension files are saved with
+var allowed = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// Read reads an upload of at most MaxSize bytes and sniffs its content type
+// from the content; the name and header the client sent are not trusted.
+func Read(r io.Reader) (data []byte, contentType string, err error) {
+	data, err = io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("read upload failed: %w", err)
+	}
+	if len(data) > MaxSize {
+		return nil, "", ErrTooLarge
+	}
+	contentType = http.DetectContentType(data)
+	if _, ok := allowed[contentType]; !ok {
+		return nil, "", ErrUnsupportedType
+	}
+	return data, contentType, nil
+}
+
+// Thumbnail returns a JPEG preview of an image no larger than ThumbSide on
+// either side, or nil for types that cannot be previewed (pdf, webp) and for
+// images of more than MaxThumbPixels.
+func Thumbnail(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image failed: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxThumbPixels {
+		return nil, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image failed: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(img, ThumbSide), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("encode thumbnail failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale shrinks img so its longer side is at most maxSide, averaging the
+// source pixels that fall on each target pixel. Transparent areas become white.
+func downscale(img image.Image, maxSide int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			w, h = maxSide, max(1, h*maxSide/w)
+		} else {
+			w, h = max(1, w*maxSide/h), maxSide
+		}
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var r, g, bl, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					// composite on white
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			out.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), 0xff})
+		}
+	}
+	return out
+}
+
+// NewPath returns a fresh storage key for a file of an entity, e.g.
+// attachments/branch_1/order_5/9f2c….jpg, and the key of its thumbnail
+func NewPath(branchID int64, entityType string, entityID int64, contentType string) (file, thumb string, err error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", "", fmt.Errorf("generate file name failed: %w", err)
+	}
+	name := hex.EncodeToString(b[:])
+	dir := path.Join("attachments", fmt.Sprintf("branch_%d", branchID), fmt.Sprintf("%s_%d", entityType, entityID))
+	return path.Join(dir, name+Ext(contentType)), path.Join(dir, name+"_thumb.jpg"), nil
+}
+
+// Ext returns the extension files of an accepted content type are saved with
+func Ext(contentType string) string {
+	return allowed[contentType]
+}
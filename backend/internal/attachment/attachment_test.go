@@ -0,0 +1,64 @@
+package attachment
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnailDownscales(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 512))
+	for y := 0; y < 512; y++ {
+		for x := 0; x < 1024; x++ {
+			img.Set(x, y, color.RGBA{0x20, 0x40, 0x80, 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	thumb, err := Thumbnail(buf.Bytes(), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != ThumbSide || cfg.Height != ThumbSide/2 {
+		t.Errorf("thumbnail is %dx%d, want %dx%d", cfg.Width, cfg.Height, ThumbSide, ThumbSide/2)
+	}
+}
+
+// a GIF of a few bytes whose header declares a 65535x65535 screen
+func TestThumbnailSkipsHugeImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.White}), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	copy(data[6:10], []byte{0xff, 0xff, 0xff, 0xff})
+
+	thumb, err := Thumbnail(data, "image/gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb != nil {
+		t.Error("expected no thumbnail for an image over MaxThumbPixels")
+	}
+}
+
+func TestThumbnailOtherTypes(t *testing.T) {
+	thumb, err := Thumbnail([]byte("%PDF-1.4"), "application/pdf")
+	if thumb != nil || err != nil {
+		t.Errorf("Thumbnail(pdf) = %v, %v, want nil, nil", thumb, err)
+	}
+	if _, err := Thumbnail([]byte("not an image"), "image/png"); err == nil {
+		t.Error("expected an error for a broken image")
+	}
+}
@@ -0,0 +1,152 @@
+package bankstatement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// camt.053 (ISO 20022 BankToCustomerStatement). Only the elements used for
+// reconciliation are mapped; namespaces are ignored so any camt.053 version works.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	FromDateTime string        `xml:"FrToDt>FrDtTm"`
+	ToDateTime   string        `xml:"FrToDt>ToDtTm"`
+	Balances     []camtBalance `xml:"Bal"`
+	Entries      []camtEntry   `xml:"Ntry"`
+}
+
+type camtBalance struct {
+	Code   string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount camtAmount `xml:"Amt"`
+	CdtDbt string     `xml:"CdtDbtInd"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtEntry struct {
+	Amount      camtAmount `xml:"Amt"`
+	CdtDbt      string     `xml:"CdtDbtInd"`
+	Reversal    bool       `xml:"RvslInd"`
+	BookingDate string     `xml:"BookgDt>Dt"`
+	BookingDtTm string     `xml:"BookgDt>DtTm"`
+	ValueDate   string     `xml:"ValDt>Dt"`
+	EntryRef    string     `xml:"NtryRef"`
+	ServicerRef string     `xml:"AcctSvcrRef"`
+	AddtlInfo   string     `xml:"AddtlNtryInf"`
+	Details     []struct {
+		EndToEndID string   `xml:"Refs>EndToEndId"`
+		Unstruct   []string `xml:"RmtInf>Ustrd"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+// ParseCAMT053 reads an ISO 20022 camt.053 statement. Multiple <Stmt> blocks are merged.
+func ParseCAMT053(r io.Reader) (*Statement, error) {
+	var doc camtDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("read camt.053 failed: %w", err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, fmt.Errorf("file is not a camt.053 statement")
+	}
+
+	st := &Statement{}
+	for _, s := range doc.Statements {
+		if t, err := parseCAMTDate(s.FromDateTime); err == nil && (st.PeriodStart.IsZero() || t.Before(st.PeriodStart)) {
+			st.PeriodStart = t
+		}
+		if t, err := parseCAMTDate(s.ToDateTime); err == nil && t.After(st.PeriodEnd) {
+			st.PeriodEnd = t
+		}
+
+		// -------------------- Balances --------------------
+		for _, b := range s.Balances {
+			v, err := parseAmount(b.Amount.Value, '.')
+			if err != nil {
+				continue
+			}
+			if strings.EqualFold(b.CdtDbt, "DBIT") {
+				v = -v
+			}
+			switch strings.ToUpper(b.Code) {
+			case "OPBD", "PRCD":
+				if st.OpeningBalance == nil {
+					st.OpeningBalance = &v
+				}
+			case "CLBD":
+				st.ClosingBalance = &v
+			}
+		}
+
+		// -------------------- Entries --------------------
+		for i, e := range s.Entries {
+			amount, err := parseAmount(e.Amount.Value, '.')
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", i+1, err)
+			}
+			debit := strings.EqualFold(e.CdtDbt, "DBIT")
+			if e.Reversal {
+				debit = !debit
+			}
+			if debit {
+				amount = -amount
+			}
+
+			dateStr := e.BookingDate
+			if dateStr == "" {
+				dateStr = e.BookingDtTm
+			}
+			if dateStr == "" {
+				dateStr = e.ValueDate
+			}
+			date, err := parseCAMTDate(dateStr)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", i+1, err)
+			}
+
+			memo := []string{}
+			if e.AddtlInfo != "" {
+				memo = append(memo, e.AddtlInfo)
+			}
+			ref := e.ServicerRef
+			if ref == "" {
+				ref = e.EntryRef
+			}
+			for _, d := range e.Details {
+				memo = append(memo, d.Unstruct...)
+				if ref == "" && d.EndToEndID != "" && d.EndToEndID != "NOTPROVIDED" {
+					ref = d.EndToEndID
+				}
+			}
+
+			st.Lines = append(st.Lines, Line{
+				Date:      date,
+				Amount:    amount,
+				Memo:      strings.TrimSpace(strings.Join(memo, " ")),
+				Reference: ref,
+			})
+		}
+	}
+	return st, nil
+}
+
+// parseCAMTDate accepts ISODate and ISODateTime values
+func parseCAMTDate(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if len(v) < 10 {
+		return time.Time{}, fmt.Errorf("invalid date %q", v)
+	}
+	t, err := time.Parse("2006-01-02", v[:10])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", v)
+	}
+	return t, nil
+}
@@ -0,0 +1,153 @@
+package bankstatement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ParseCSV reads a CSV statement using the given column mapping
+func ParseCSV(r io.Reader, m *models.BankCSVMapping) (*Statement, error) {
+	if m.DateColumn == "" {
+		return nil, errors.New("mapping has no date column")
+	}
+	if m.AmountColumn == "" && m.DebitColumn == "" && m.CreditColumn == "" {
+		return nil, errors.New("mapping needs an amount column or debit/credit columns")
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if m.Delimiter != "" {
+		reader.Comma = []rune(m.Delimiter)[0]
+	}
+	decimalSep := '.'
+	if m.DecimalSeparator == "," {
+		decimalSep = ','
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read csv failed: %w", err)
+	}
+	if m.SkipRows > 0 {
+		if m.SkipRows >= len(records) {
+			return nil, errors.New("csv has no rows after skipped rows")
+		}
+		records = records[m.SkipRows:]
+	}
+
+	var header []string
+	if m.HasHeader {
+		if len(records) == 0 {
+			return nil, errors.New("csv is empty")
+		}
+		header = records[0]
+		records = records[1:]
+	}
+
+	// -------------------- Resolve column positions --------------------
+	resolve := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")), strings.TrimSpace(name)) {
+				return i, nil
+			}
+		}
+		if n, err := strconv.Atoi(name); err == nil && n > 0 {
+			return n - 1, nil
+		}
+		return -1, fmt.Errorf("column %q not found in csv", name)
+	}
+
+	dateCol, err := resolve(m.DateColumn)
+	if err != nil {
+		return nil, err
+	}
+	amountCol, err := resolve(m.AmountColumn)
+	if err != nil {
+		return nil, err
+	}
+	debitCol, err := resolve(m.DebitColumn)
+	if err != nil {
+		return nil, err
+	}
+	creditCol, err := resolve(m.CreditColumn)
+	if err != nil {
+		return nil, err
+	}
+	memoCol, err := resolve(m.MemoColumn)
+	if err != nil {
+		return nil, err
+	}
+	refCol, err := resolve(m.ReferenceColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := m.DateFormat
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+	field := func(rec []string, col int) string {
+		if col < 0 || col >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[col])
+	}
+
+	// -------------------- Read rows --------------------
+	st := &Statement{}
+	for i, rec := range records {
+		rawDate := field(rec, dateCol)
+		if rawDate == "" {
+			// blank or summary rows at the end of many bank exports
+			continue
+		}
+		date, err := time.Parse(layout, rawDate)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid date %q for format %q", i+1, rawDate, layout)
+		}
+
+		var amount money.Amount
+		if amountCol >= 0 {
+			if amount, err = parseAmount(field(rec, amountCol), decimalSep); err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+1, err)
+			}
+		} else {
+			debit, err := parseAmount(field(rec, debitCol), decimalSep)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+1, err)
+			}
+			credit, err := parseAmount(field(rec, creditCol), decimalSep)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+1, err)
+			}
+			// banks print debits either signed or unsigned
+			if debit < 0 {
+				debit = -debit
+			}
+			amount = credit - debit
+		}
+		if amount == 0 {
+			continue
+		}
+
+		st.Lines = append(st.Lines, Line{
+			Date:      truncateDate(date),
+			Amount:    amount,
+			Memo:      field(rec, memoCol),
+			Reference: field(rec, refCol),
+		})
+	}
+	return st, nil
+}
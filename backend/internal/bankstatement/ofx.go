@@ -0,0 +1,117 @@
+package bankstatement
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ParseOFX reads OFX 1.x (SGML, unclosed tags) and OFX 2.x (XML) bank statements.
+// Only the fields needed for reconciliation are read, so a tolerant tag scanner is used
+// instead of a full SGML parser.
+func ParseOFX(r io.Reader) (*Statement, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read ofx failed: %w", err)
+	}
+	body := string(data)
+	upper := strings.ToUpper(body)
+	if !strings.Contains(upper, "<OFX>") {
+		return nil, fmt.Errorf("file is not an OFX statement")
+	}
+
+	st := &Statement{}
+
+	// -------------------- Statement period --------------------
+	if list := ofxBlock(body, upper, "BANKTRANLIST", 0); list != "" {
+		if t, err := parseOFXDate(ofxValue(list, "DTSTART")); err == nil {
+			st.PeriodStart = t
+		}
+		if t, err := parseOFXDate(ofxValue(list, "DTEND")); err == nil {
+			st.PeriodEnd = t
+		}
+	}
+
+	// -------------------- Closing balance --------------------
+	if bal := ofxBlock(body, upper, "LEDGERBAL", 0); bal != "" {
+		if v, err := parseAmount(ofxValue(bal, "BALAMT"), '.'); err == nil && ofxValue(bal, "BALAMT") != "" {
+			st.ClosingBalance = &v
+		}
+	}
+
+	// -------------------- Transactions --------------------
+	pos := 0
+	for {
+		start := strings.Index(upper[pos:], "<STMTTRN>")
+		if start < 0 {
+			break
+		}
+		start += pos
+		block := ofxBlock(body, upper, "STMTTRN", start)
+		pos = start + len("<STMTTRN>")
+
+		date, err := parseOFXDate(ofxValue(block, "DTPOSTED"))
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", len(st.Lines)+1, err)
+		}
+		amount, err := parseAmount(ofxValue(block, "TRNAMT"), '.')
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", len(st.Lines)+1, err)
+		}
+
+		memo := strings.TrimSpace(ofxValue(block, "NAME") + " " + ofxValue(block, "MEMO"))
+		ref := ofxValue(block, "CHECKNUM")
+		if ref == "" {
+			ref = ofxValue(block, "REFNUM")
+		}
+		if ref == "" {
+			ref = ofxValue(block, "FITID")
+		}
+
+		st.Lines = append(st.Lines, Line{Date: date, Amount: amount, Memo: memo, Reference: ref})
+	}
+	return st, nil
+}
+
+// ofxBlock returns the content between <TAG> and </TAG> starting at or after from.
+// Aggregates are always closed in OFX 1.x, so this works for both versions.
+func ofxBlock(body, upper, tag string, from int) string {
+	open := "<" + tag + ">"
+	start := strings.Index(upper[from:], open)
+	if start < 0 {
+		return ""
+	}
+	start += from + len(open)
+	end := strings.Index(upper[start:], "</"+tag+">")
+	if end < 0 {
+		return body[start:]
+	}
+	return body[start : start+end]
+}
+
+// ofxValue returns the value of an element; the value ends at the next tag or line break
+func ofxValue(block, tag string) string {
+	open := "<" + tag + ">"
+	i := strings.Index(strings.ToUpper(block), open)
+	if i < 0 {
+		return ""
+	}
+	v := block[i+len(open):]
+	if j := strings.IndexAny(v, "<\r\n"); j >= 0 {
+		v = v[:j]
+	}
+	return strings.TrimSpace(v)
+}
+
+// parseOFXDate reads YYYYMMDD[HHMMSS[.XXX]][TZ] and keeps the date part
+func parseOFXDate(v string) (time.Time, error) {
+	if len(v) < 8 {
+		return time.Time{}, fmt.Errorf("invalid OFX date %q", v)
+	}
+	t, err := time.Parse("20060102", v[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid OFX date %q", v)
+	}
+	return t, nil
+}
@@ -0,0 +1,140 @@
+// Package bankstatement parses bank statement exports (CSV, OFX and CAMT.053)
+// into a common set of statement lines.
+package bankstatement
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// Line is a single movement on the bank account. Amount is positive for money in.
+type Line struct {
+	Date      time.Time
+	Amount    money.Amount
+	Memo      string
+	Reference string
+}
+
+// Statement holds the parsed lines plus the period and balances when the file carries them
+type Statement struct {
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	OpeningBalance *money.Amount
+	ClosingBalance *money.Amount
+	Lines          []Line
+}
+
+// Parse reads a statement in the given format. mapping is only used for CSV.
+func Parse(format string, r io.Reader, mapping *models.BankCSVMapping) (*Statement, error) {
+	var (
+		st  *Statement
+		err error
+	)
+	switch format {
+	case models.BANK_FORMAT_CSV:
+		if mapping == nil {
+			return nil, errors.New("csv import requires a column mapping")
+		}
+		st, err = ParseCSV(r, mapping)
+	case models.BANK_FORMAT_OFX:
+		st, err = ParseOFX(r)
+	case models.BANK_FORMAT_CAMT053:
+		st, err = ParseCAMT053(r)
+	default:
+		return nil, fmt.Errorf("unsupported statement format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(st.Lines) == 0 {
+		return nil, errors.New("statement contains no transactions")
+	}
+	st.fillPeriod()
+	return st, nil
+}
+
+// fillPeriod derives the statement period from the line dates when the file did not state it
+func (s *Statement) fillPeriod() {
+	for _, l := range s.Lines {
+		if s.PeriodStart.IsZero() || l.Date.Before(s.PeriodStart) {
+			s.PeriodStart = l.Date
+		}
+		if s.PeriodEnd.IsZero() || l.Date.After(s.PeriodEnd) {
+			s.PeriodEnd = l.Date
+		}
+	}
+}
+
+// parseAmount accepts the formats banks commonly export: "1,234.50", "(25.00)",
+// "25.00-", "25.00 DR", "QAR 1,000.00". decimalSep is '.' or ','; the other one
+// groups thousands and is refused after the decimal separator, so "1.234,50"
+// read with '.' is an error rather than 1.23.
+func parseAmount(raw string, decimalSep rune) (money.Amount, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return 0, nil
+	}
+	negative := false
+	upper := strings.ToUpper(s)
+	switch {
+	case strings.HasSuffix(upper, "DR"):
+		negative = true
+		s = strings.TrimSpace(s[:len(s)-2])
+	case strings.HasSuffix(upper, "CR"):
+		s = strings.TrimSpace(s[:len(s)-2])
+	}
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	if strings.HasSuffix(s, "-") {
+		negative = true
+		s = s[:len(s)-1]
+	}
+
+	groupSep := ','
+	if decimalSep == ',' {
+		groupSep = '.'
+	}
+	var b strings.Builder
+	decimals := false
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == decimalSep:
+			if decimals {
+				return 0, fmt.Errorf("invalid amount %q", raw)
+			}
+			decimals = true
+			b.WriteRune('.')
+		case c == groupSep:
+			if decimals {
+				return 0, fmt.Errorf("invalid amount %q: %q after the decimal separator %q", raw, groupSep, decimalSep)
+			}
+		case c == '-':
+			negative = !negative
+		}
+	}
+	if b.Len() == 0 {
+		return 0, fmt.Errorf("invalid amount %q", raw)
+	}
+	v, err := money.Parse(b.String())
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", raw)
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,314 @@
+package bankstatement
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func checkLines(t *testing.T, got, want []Line) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !got[i].Date.Equal(want[i].Date) || got[i].Amount != want[i].Amount ||
+			got[i].Memo != want[i].Memo || got[i].Reference != want[i].Reference {
+			t.Errorf("line %d = %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    money.Amount
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"25", 2500, false},
+		{"-25.5", -2550, false},
+		{"1,234.50", 123450, false},
+		{"(25.00)", -2500, false},
+		{"25.00-", -2500, false},
+		{"25.00 DR", -2500, false},
+		{"25.00 cr", 2500, false},
+		{"QAR 1,000.00", 100000, false},
+		{"0.125", 13, false},
+		{"abc", 0, true},
+		{"1.2.3", 0, true},
+		{"1.234,50", 0, true}, // a decimal comma read with '.'
+		{"1,234.50,00", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.in, '.')
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAmount(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAmount(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseAmountDecimalComma(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    money.Amount
+		wantErr bool
+	}{
+		{"1.234,50", 123450, false},
+		{"-25,5", -2550, false},
+		{"1 000,00 DR", -100000, false},
+		{"(0,75)", -75, false},
+		{"1,234.50", 0, true}, // a decimal point read with ','
+		{"1,2,3", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.in, ',')
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAmount(%q, ',') error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAmount(%q, ',') = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSVAmountColumn(t *testing.T) {
+	in := "\ufeffDate,Details,Amount,Ref\n" +
+		"2025-03-01,Opening cash deposit,\"1,500.00\",D-1\n" +
+		"2025-03-02,Rent,(800.00),CHQ 12\n" +
+		"2025-03-02,Zero fee,0.00,\n" +
+		",Closing balance,700.00,\n"
+	st, err := Parse(models.BANK_FORMAT_CSV, strings.NewReader(in), &models.BankCSVMapping{
+		DateColumn:      "date",
+		AmountColumn:    "Amount",
+		MemoColumn:      "Details",
+		ReferenceColumn: "Ref",
+		HasHeader:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, st.Lines, []Line{
+		{Date: date("2025-03-01"), Amount: 150000, Memo: "Opening cash deposit", Reference: "D-1"},
+		{Date: date("2025-03-02"), Amount: -80000, Memo: "Rent", Reference: "CHQ 12"},
+	})
+	if !st.PeriodStart.Equal(date("2025-03-01")) || !st.PeriodEnd.Equal(date("2025-03-02")) {
+		t.Errorf("period = %v..%v, want 2025-03-01..2025-03-02", st.PeriodStart, st.PeriodEnd)
+	}
+}
+
+func TestParseCSVDebitCreditColumns(t *testing.T) {
+	in := "Statement of account\n" +
+		"01/03/2025;Transfer in;;250.75\n" +
+		"02/03/2025;Card;-40.00;\n" +
+		"03/03/2025;Fee;5.00;\n"
+	st, err := ParseCSV(strings.NewReader(in), &models.BankCSVMapping{
+		DateColumn:   "1",
+		MemoColumn:   "2",
+		DebitColumn:  "3",
+		CreditColumn: "4",
+		DateFormat:   "02/01/2006",
+		Delimiter:    ";",
+		SkipRows:     1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, st.Lines, []Line{
+		{Date: date("2025-03-01"), Amount: 25075, Memo: "Transfer in"},
+		{Date: date("2025-03-02"), Amount: -4000, Memo: "Card"},
+		{Date: date("2025-03-03"), Amount: -500, Memo: "Fee"},
+	})
+}
+
+func TestParseCSVDecimalComma(t *testing.T) {
+	in := "Datum;Omschrijving;Bedrag\n" +
+		"01.03.2025;Storting;\"1.234,50\"\n" +
+		"02.03.2025;Huur;-800,00\n"
+	st, err := ParseCSV(strings.NewReader(in), &models.BankCSVMapping{
+		DateColumn:       "Datum",
+		AmountColumn:     "Bedrag",
+		MemoColumn:       "Omschrijving",
+		DateFormat:       "02.01.2006",
+		Delimiter:        ";",
+		DecimalSeparator: ",",
+		HasHeader:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, st.Lines, []Line{
+		{Date: date("2025-03-01"), Amount: 123450, Memo: "Storting"},
+		{Date: date("2025-03-02"), Amount: -80000, Memo: "Huur"},
+	})
+
+	// the same file read with the default decimal point is refused
+	if _, err := ParseCSV(strings.NewReader(in), &models.BankCSVMapping{
+		DateColumn: "Datum", AmountColumn: "Bedrag", DateFormat: "02.01.2006", Delimiter: ";", HasHeader: true,
+	}); err == nil {
+		t.Error("expected an error reading 1.234,50 with a decimal point")
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		mapping models.BankCSVMapping
+	}{
+		{"no amount columns", "Date\n2025-03-01\n", models.BankCSVMapping{DateColumn: "Date", HasHeader: true}},
+		{"missing column", "Date,Amount\n2025-03-01,1\n", models.BankCSVMapping{DateColumn: "Date", AmountColumn: "Value", HasHeader: true}},
+		{"bad date", "Date,Amount\n03/01/2025,1\n", models.BankCSVMapping{DateColumn: "Date", AmountColumn: "Amount", HasHeader: true}},
+		{"bad amount", "Date,Amount\n2025-03-01,n/a\n", models.BankCSVMapping{DateColumn: "Date", AmountColumn: "Amount", HasHeader: true}},
+		{"all rows skipped", "Date,Amount\n", models.BankCSVMapping{DateColumn: "1", AmountColumn: "2", SkipRows: 1}},
+	}
+	for _, tt := range tests {
+		if _, err := ParseCSV(strings.NewReader(tt.in), &tt.mapping); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestParseOFXSGML(t *testing.T) {
+	in := `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<BANKTRANLIST>
+<DTSTART>20250301000000[+3:AST]
+<DTEND>20250331235959[+3:AST]
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20250305120000[+3:AST]
+<TRNAMT>1200.00
+<FITID>9001
+<NAME>CUSTOMER TRANSFER
+<MEMO>MEMO 2025-0042
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CHECK
+<DTPOSTED>20250310
+<TRNAMT>-350.5
+<FITID>9002
+<CHECKNUM>000123
+</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>849.50
+<DTASOF>20250331
+</LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+	st, err := Parse(models.BANK_FORMAT_OFX, strings.NewReader(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, st.Lines, []Line{
+		{Date: date("2025-03-05"), Amount: 120000, Memo: "CUSTOMER TRANSFER MEMO 2025-0042", Reference: "9001"},
+		{Date: date("2025-03-10"), Amount: -35050, Reference: "000123"},
+	})
+	if !st.PeriodStart.Equal(date("2025-03-01")) || !st.PeriodEnd.Equal(date("2025-03-31")) {
+		t.Errorf("period = %v..%v, want 2025-03-01..2025-03-31", st.PeriodStart, st.PeriodEnd)
+	}
+	if st.ClosingBalance == nil || *st.ClosingBalance != 84950 {
+		t.Errorf("closing balance = %v, want 849.50", st.ClosingBalance)
+	}
+}
+
+func TestParseOFXErrors(t *testing.T) {
+	if _, err := ParseOFX(strings.NewReader("not a statement")); err == nil {
+		t.Error("expected an error for a file without <OFX>")
+	}
+	in := "<OFX><STMTTRN><DTPOSTED>2025<TRNAMT>1</STMTTRN></OFX>"
+	if _, err := ParseOFX(strings.NewReader(in)); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+	if _, err := Parse(models.BANK_FORMAT_OFX, strings.NewReader("<OFX></OFX>"), nil); err == nil {
+		t.Error("expected an error for a statement without transactions")
+	}
+}
+
+func TestParseCAMT053(t *testing.T) {
+	in := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+ <BkToCstmrStmt>
+  <Stmt>
+   <FrToDt><FrDtTm>2025-03-01T00:00:00</FrDtTm><ToDtTm>2025-03-31T23:59:59</ToDtTm></FrToDt>
+   <Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="QAR">100.00</Amt><CdtDbtInd>DBIT</CdtDbtInd></Bal>
+   <Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="QAR">400.00</Amt><CdtDbtInd>CRDT</CdtDbtInd></Bal>
+   <Ntry>
+    <Amt Ccy="QAR">600.00</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+    <BookgDt><Dt>2025-03-04</Dt></BookgDt>
+    <AcctSvcrRef>BANK-1</AcctSvcrRef>
+    <NtryDtls><TxDtls><Refs><EndToEndId>E2E-1</EndToEndId></Refs><RmtInf><Ustrd>Order 17</Ustrd></RmtInf></TxDtls></NtryDtls>
+   </Ntry>
+   <Ntry>
+    <Amt Ccy="QAR">50.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><RvslInd>true</RvslInd>
+    <BookgDt><DtTm>2025-03-06T10:00:00</DtTm></BookgDt>
+    <AddtlNtryInf>Reversed transfer</AddtlNtryInf>
+    <NtryDtls><TxDtls><Refs><EndToEndId>E2E-2</EndToEndId></Refs></TxDtls></NtryDtls>
+   </Ntry>
+   <Ntry>
+    <Amt Ccy="QAR">50.00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+    <ValDt><Dt>2025-03-07</Dt></ValDt>
+   </Ntry>
+  </Stmt>
+ </BkToCstmrStmt>
+</Document>`
+	st, err := Parse(models.BANK_FORMAT_CAMT053, strings.NewReader(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLines(t, st.Lines, []Line{
+		{Date: date("2025-03-04"), Amount: 60000, Memo: "Order 17", Reference: "BANK-1"},
+		{Date: date("2025-03-06"), Amount: -5000, Memo: "Reversed transfer", Reference: "E2E-2"},
+		{Date: date("2025-03-07"), Amount: -5000},
+	})
+	if st.OpeningBalance == nil || *st.OpeningBalance != -10000 {
+		t.Errorf("opening balance = %v, want -100.00", st.OpeningBalance)
+	}
+	if st.ClosingBalance == nil || *st.ClosingBalance != 40000 {
+		t.Errorf("closing balance = %v, want 400.00", st.ClosingBalance)
+	}
+	if !st.PeriodStart.Equal(date("2025-03-01")) || !st.PeriodEnd.Equal(date("2025-03-31")) {
+		t.Errorf("period = %v..%v, want 2025-03-01..2025-03-31", st.PeriodStart, st.PeriodEnd)
+	}
+}
+
+func TestParseCAMT053Errors(t *testing.T) {
+	if _, err := ParseCAMT053(strings.NewReader("<Document></Document>")); err == nil {
+		t.Error("expected an error for a document without statements")
+	}
+	in := `<Document><BkToCstmrStmt><Stmt><Ntry><Amt>1</Amt><CdtDbtInd>CRDT</CdtDbtInd></Ntry></Stmt></BkToCstmrStmt></Document>`
+	if _, err := ParseCAMT053(strings.NewReader(in)); err == nil {
+		t.Error("expected an error for an entry without a date")
+	}
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	if _, err := Parse("qif", strings.NewReader(""), nil); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+	if _, err := Parse(models.BANK_FORMAT_CSV, strings.NewReader(""), nil); err == nil {
+		t.Error("expected an error for csv without a mapping")
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"time"
@@ -57,5 +58,39 @@ func Load() (models.Config, error) {
 	cfg.DB.DSN = os.Getenv("DB_DSN")
 	cfg.DB.DEVDSN = os.Getenv("DB_DSN_DEV")
 
+	// File storage; see models.StorageConfig
+	cfg.Storage.Backend = os.Getenv("STORAGE_BACKEND")
+	cfg.Storage.LocalRoot = os.Getenv("STORAGE_LOCAL_ROOT")
+	cfg.Storage.URLSecret = os.Getenv("STORAGE_URL_SECRET")
+	// anyone knowing the secret can sign download links for every stored file
+	if (cfg.Storage.Backend == "" || cfg.Storage.Backend == "local") && cfg.Storage.URLSecret == "" && cfg.Env != "dev" {
+		return cfg, fmt.Errorf("STORAGE_URL_SECRET is required for the local file store unless ENV=dev")
+	}
+	cfg.Storage.S3Endpoint = os.Getenv("S3_ENDPOINT")
+	cfg.Storage.S3PublicEndpoint = os.Getenv("S3_PUBLIC_ENDPOINT")
+	cfg.Storage.S3Region = os.Getenv("S3_REGION")
+	cfg.Storage.S3Bucket = os.Getenv("S3_BUCKET")
+	cfg.Storage.S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	cfg.Storage.S3SecretKey = os.Getenv("S3_SECRET_KEY")
+	if pathStyle := os.Getenv("S3_PATH_STYLE"); pathStyle != "" {
+		v, err := strconv.ParseBool(pathStyle)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Storage.S3PathStyle = v
+	}
+
+	// Fonts of printed documents; see models.PrintConfig
+	cfg.Print.Font = os.Getenv("PRINT_FONT")
+	cfg.Print.BoldFont = os.Getenv("PRINT_FONT_BOLD")
+
+	// Amounts in JSON; see models.MoneyConfig
+	cfg.Money.JSON = os.Getenv("MONEY_JSON")
+	switch cfg.Money.JSON {
+	case "", "number", "string":
+	default:
+		return cfg, fmt.Errorf("MONEY_JSON must be number or string, not %q", cfg.Money.JSON)
+	}
+
 	return cfg, nil
 }
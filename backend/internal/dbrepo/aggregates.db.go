@@ -0,0 +1,492 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// AggregateRepo recomputes the running counters in top_sheet and employees_progress
+// from the source documents (orders, sales, purchases and salary transactions).
+type AggregateRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAggregateRepo(db *pgxpool.Pool) *AggregateRepo {
+	return &AggregateRepo{db: db}
+}
+
+// employeeDay identifies an employees_progress row
+type employeeDay struct {
+	date       string
+	employeeID int64
+}
+
+// RebuildAggregates recomputes top_sheet and employees_progress for a branch and date range and
+// returns every counter that differs from what is stored. Nothing is written unless apply is true.
+//
+// Recomputed columns:
+//   - top_sheet: order_count, delivery, cancelled, ready_made, sales_amount, cash, bank, expense
+//   - employees_progress: sale_amount, order_count, advance_payment, salary
+//
+// production_units, overtime_hours and sale_return_amount are entered directly on
+// employees_progress, have no other source and are left untouched.
+func (r *AggregateRepo) RebuildAggregates(ctx context.Context, branchID int64, startDate, endDate time.Time, apply bool) (*models.AggregateRebuildResult, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Block concurrent writers so the diff and the applied values are the same snapshot
+	if apply {
+		// closed months keep the figures that were reported
+		var months []time.Time
+		for m := periodMonth(startDate); !m.After(endDate); m = m.AddDate(0, 1, 0) {
+			months = append(months, m)
+		}
+		if err := EnsurePeriodOpenTx(ctx, tx, branchID, months...); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `LOCK TABLE top_sheet, employees_progress IN EXCLUSIVE MODE`); err != nil {
+			return nil, fmt.Errorf("lock aggregate tables failed: %w", err)
+		}
+	}
+
+	// --------------------
+	// 1. Recompute from source documents
+	// --------------------
+	rebuiltSheets, err := rebuildTopSheetTx(ctx, tx, branchID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	rebuiltProgress, err := rebuildEmployeeProgressTx(ctx, tx, branchID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// 2. Load stored values
+	// --------------------
+	storedSheets := map[string]*models.TopSheetDB{}
+	rows, err := tx.Query(ctx, `
+		SELECT sheet_date, expense, cash, bank, order_count, delivery, cancelled, ready_made, sales_amount
+		FROM top_sheet
+		WHERE branch_id = $1 AND sheet_date BETWEEN $2 AND $3
+	`, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("query top sheet failed: %w", err)
+	}
+	for rows.Next() {
+		ts := &models.TopSheetDB{BranchID: branchID}
+		if err := rows.Scan(&ts.SheetDate, &ts.Expense, &ts.Cash, &ts.Bank, &ts.OrderCount,
+			&ts.Delivery, &ts.Cancelled, &ts.ReadyMade, &ts.SalesAmount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan top sheet failed: %w", err)
+		}
+		storedSheets[ts.SheetDate.Format("2006-01-02")] = ts
+	}
+	rows.Close()
+
+	storedProgress := map[employeeDay]*models.EmployeeProgressDB{}
+	rows, err = tx.Query(ctx, `
+		SELECT sheet_date, employee_id, sale_amount, order_count, advance_payment, salary
+		FROM employees_progress
+		WHERE branch_id = $1 AND sheet_date BETWEEN $2 AND $3
+	`, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("query employee progress failed: %w", err)
+	}
+	for rows.Next() {
+		ep := &models.EmployeeProgressDB{BranchID: branchID}
+		if err := rows.Scan(&ep.SheetDate, &ep.EmployeeID, &ep.SaleAmount, &ep.OrderCount,
+			&ep.AdvancePayment, &ep.Salary); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan employee progress failed: %w", err)
+		}
+		storedProgress[employeeDay{ep.SheetDate.Format("2006-01-02"), ep.EmployeeID}] = ep
+	}
+	rows.Close()
+
+	// --------------------
+	// 3. Diff
+	// --------------------
+	result := &models.AggregateRebuildResult{
+		BranchID:             branchID,
+		StartDate:            startDate,
+		EndDate:              endDate,
+		TopSheetRows:         len(rebuiltSheets),
+		EmployeeProgressRows: len(rebuiltProgress),
+		Diffs:                []*models.AggregateDiff{},
+	}
+
+	for _, day := range unionKeys(storedSheets, rebuiltSheets) {
+		cur, reb := storedSheets[day], rebuiltSheets[day]
+		if cur == nil {
+			cur = &models.TopSheetDB{}
+		}
+		if reb == nil {
+			reb = &models.TopSheetDB{}
+		}
+		date, _ := time.Parse("2006-01-02", day)
+		addAmount := func(field string, c, n money.Amount) {
+			if c != n {
+				result.Diffs = append(result.Diffs, &models.AggregateDiff{Table: "top_sheet", SheetDate: date, Field: field, Current: &c, Rebuilt: &n})
+			}
+		}
+		addCount := func(field string, c, n int64) {
+			if c != n {
+				result.Diffs = append(result.Diffs, &models.AggregateDiff{Table: "top_sheet", SheetDate: date, Field: field, CurrentCount: &c, RebuiltCount: &n})
+			}
+		}
+		addAmount("expense", cur.Expense, reb.Expense)
+		addAmount("cash", cur.Cash, reb.Cash)
+		addAmount("bank", cur.Bank, reb.Bank)
+		addCount("order_count", cur.OrderCount, reb.OrderCount)
+		addCount("delivery", cur.Delivery, reb.Delivery)
+		addCount("cancelled", cur.Cancelled, reb.Cancelled)
+		addCount("ready_made", cur.ReadyMade, reb.ReadyMade)
+		addAmount("sales_amount", cur.SalesAmount, reb.SalesAmount)
+	}
+
+	for _, key := range unionKeys(storedProgress, rebuiltProgress) {
+		cur, reb := storedProgress[key], rebuiltProgress[key]
+		if cur == nil {
+			cur = &models.EmployeeProgressDB{}
+		}
+		if reb == nil {
+			reb = &models.EmployeeProgressDB{}
+		}
+		date, _ := time.Parse("2006-01-02", key.date)
+		addAmount := func(field string, c, n money.Amount) {
+			if c != n {
+				result.Diffs = append(result.Diffs, &models.AggregateDiff{Table: "employees_progress", SheetDate: date, EmployeeID: key.employeeID, Field: field, Current: &c, Rebuilt: &n})
+			}
+		}
+		addCount := func(field string, c, n int64) {
+			if c != n {
+				result.Diffs = append(result.Diffs, &models.AggregateDiff{Table: "employees_progress", SheetDate: date, EmployeeID: key.employeeID, Field: field, CurrentCount: &c, RebuiltCount: &n})
+			}
+		}
+		addAmount("sale_amount", cur.SaleAmount, reb.SaleAmount)
+		addCount("order_count", cur.OrderCount, reb.OrderCount)
+		addAmount("advance_payment", cur.AdvancePayment, reb.AdvancePayment)
+		addAmount("salary", cur.Salary, reb.Salary)
+	}
+
+	if !apply {
+		return result, nil
+	}
+
+	// --------------------
+	// 4. Overwrite: zero the recomputed columns in range, then write absolute values.
+	// Rows are kept (not deleted) because salary/advance memos reference employees_progress ids.
+	// --------------------
+	_, err = tx.Exec(ctx, `
+		UPDATE top_sheet
+		SET expense = 0, cash = 0, bank = 0, order_count = 0, delivery = 0, cancelled = 0, ready_made = 0, sales_amount = 0
+		WHERE branch_id = $1 AND sheet_date BETWEEN $2 AND $3
+	`, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("reset top sheet failed: %w", err)
+	}
+	for _, ts := range rebuiltSheets {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO top_sheet (
+				sheet_date, branch_id, expense, cash, bank, order_count, delivery, cancelled, ready_made, sales_amount
+			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+			ON CONFLICT (sheet_date, branch_id) DO UPDATE SET
+				expense      = EXCLUDED.expense,
+				cash         = EXCLUDED.cash,
+				bank         = EXCLUDED.bank,
+				order_count  = EXCLUDED.order_count,
+				delivery     = EXCLUDED.delivery,
+				cancelled    = EXCLUDED.cancelled,
+				ready_made   = EXCLUDED.ready_made,
+				sales_amount = EXCLUDED.sales_amount
+		`, ts.SheetDate, branchID, ts.Expense, ts.Cash, ts.Bank,
+			ts.OrderCount, ts.Delivery, ts.Cancelled, ts.ReadyMade, ts.SalesAmount)
+		if err != nil {
+			return nil, fmt.Errorf("write top sheet failed: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE employees_progress
+		SET sale_amount = 0, order_count = 0, advance_payment = 0, salary = 0
+		WHERE branch_id = $1 AND sheet_date BETWEEN $2 AND $3
+	`, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("reset employee progress failed: %w", err)
+	}
+	for _, ep := range rebuiltProgress {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO employees_progress (
+				sheet_date, branch_id, employee_id, sale_amount, order_count, advance_payment, salary
+			) VALUES ($1,$2,$3,$4,$5,$6,$7)
+			ON CONFLICT (sheet_date, employee_id) DO UPDATE SET
+				sale_amount     = EXCLUDED.sale_amount,
+				order_count     = EXCLUDED.order_count,
+				advance_payment = EXCLUDED.advance_payment,
+				salary          = EXCLUDED.salary
+		`, ep.SheetDate, branchID, ep.EmployeeID, ep.SaleAmount, ep.OrderCount, ep.AdvancePayment, ep.Salary)
+		if err != nil {
+			return nil, fmt.Errorf("write employee progress failed: %w", err)
+		}
+	}
+
+	result.Applied = true
+	return result, tx.Commit(ctx)
+}
+
+// rebuildTopSheetTx derives the daily branch counters:
+//   - order_count: items on orders placed that day
+//   - cancelled:   items on orders cancelled that day
+//   - delivery:    items handed over that day (order_transactions)
+//   - ready_made / sales_amount: ready-made sales that day
+//   - cash / bank: money received on orders, sales, store credit and gift vouchers sold, split by the
+//     receiving account type
+//   - expense:     purchases, salaries and salary advances
+func rebuildTopSheetTx(ctx context.Context, tx pgx.Tx, branchID int64, startDate, endDate time.Time) (map[string]*models.TopSheetDB, error) {
+	sheets := map[string]*models.TopSheetDB{}
+	sheet := func(d time.Time) *models.TopSheetDB {
+		key := d.Format("2006-01-02")
+		if sheets[key] == nil {
+			sheets[key] = &models.TopSheetDB{SheetDate: d, BranchID: branchID}
+		}
+		return sheets[key]
+	}
+
+	query := `
+		-- orders placed
+		SELECT order_date, 'order_count', 0::numeric, SUM(total_products)::bigint
+		FROM orders
+		WHERE branch_id = $1 AND order_date BETWEEN $2 AND $3
+		GROUP BY order_date
+
+		UNION ALL
+		-- orders cancelled (older cancellations are dated by their last update)
+		SELECT COALESCE(cancelled_at, updated_at::date), 'cancelled', 0, SUM(total_products)::bigint
+		FROM orders
+		WHERE branch_id = $1 AND status = 'cancelled' AND COALESCE(cancelled_at, updated_at::date) BETWEEN $2 AND $3
+		GROUP BY COALESCE(cancelled_at, updated_at::date)
+
+		UNION ALL
+		-- deliveries and order payments
+		SELECT ot.transaction_date, 'delivery', 0, SUM(ot.quantity_delivered)::bigint
+		FROM order_transactions ot
+		JOIN orders o ON o.id = ot.order_id
+		WHERE o.branch_id = $1 AND ot.transaction_date BETWEEN $2 AND $3
+		GROUP BY ot.transaction_date
+
+		UNION ALL
+		SELECT p.transaction_date, CASE WHEN a.type = 'bank' THEN 'bank' ELSE 'cash' END,
+		       SUM(CASE WHEN p.transaction_type = 'Refund' THEN -p.amount ELSE p.amount END), 0
+		FROM (
+			SELECT ot.transaction_date, ot.payment_account_id, ot.amount, ot.transaction_type
+			FROM order_transactions ot
+			JOIN orders o ON o.id = ot.order_id
+			WHERE o.branch_id = $1 AND ot.payment_account_id IS NOT NULL
+			UNION ALL
+			SELECT st.transaction_date, st.payment_account_id, st.amount, st.transaction_type
+			FROM sale_transactions st
+			JOIN sales s ON s.id = st.sale_id
+			WHERE s.branch_id = $1 AND st.payment_account_id IS NOT NULL
+			UNION ALL
+			-- store credit paid in or out (top-ups, overpayments, withdrawals)
+			SELECT l.entry_date, l.account_id, ABS(l.amount),
+			       CASE WHEN l.amount < 0 THEN 'Refund' ELSE 'Payment' END
+			FROM store_credit_ledger l
+			WHERE l.branch_id = $1 AND l.account_id IS NOT NULL
+			UNION ALL
+			-- gift vouchers sold (redemptions move no money)
+			SELECT v.entry_date, v.account_id, v.amount, 'Payment'
+			FROM voucher_ledger v
+			WHERE v.branch_id = $1 AND v.entry_type = 'issue' AND v.account_id IS NOT NULL
+			UNION ALL
+			-- period adjustments with customers (bank statement entries never reach top_sheet)
+			SELECT t.transaction_date,
+			       CASE WHEN t.to_entity_type = 'accounts' THEN t.to_entity_id ELSE t.from_entity_id END,
+			       t.amount,
+			       CASE WHEN t.to_entity_type = 'accounts' THEN 'Payment' ELSE 'Refund' END
+			FROM transactions t
+			WHERE t.branch_id = $1 AND t.transaction_type = 'Adjustment'
+			  AND 'customers' IN (t.from_entity_type, t.to_entity_type)
+			  AND NOT EXISTS (SELECT 1 FROM bank_statement_lines l WHERE l.transaction_id = t.transaction_id)
+		) p
+		LEFT JOIN accounts a ON a.id = p.payment_account_id
+		WHERE p.transaction_date BETWEEN $2 AND $3
+		GROUP BY p.transaction_date, 2
+
+		UNION ALL
+		-- ready-made sales
+		SELECT sale_date, 'ready_made', 0, SUM(total_products)::bigint
+		FROM sales
+		WHERE branch_id = $1 AND status <> 'cancelled' AND sale_date BETWEEN $2 AND $3
+		GROUP BY sale_date
+
+		UNION ALL
+		SELECT sale_date, 'sales_amount', SUM(total_amount), 0
+		FROM sales
+		WHERE branch_id = $1 AND status <> 'cancelled' AND sale_date BETWEEN $2 AND $3
+		GROUP BY sale_date
+
+		UNION ALL
+		-- expenses
+		SELECT purchase_date, 'expense', SUM(total_amount), 0
+		FROM purchase
+		WHERE branch_id = $1 AND purchase_date BETWEEN $2 AND $3
+		GROUP BY purchase_date
+
+		UNION ALL
+		SELECT transaction_date, 'expense', SUM(amount), 0
+		FROM transactions
+		WHERE branch_id = $1 AND to_entity_type = 'employees'
+		  AND transaction_type IN ('Salary', 'Advance Payment')
+		  AND transaction_date BETWEEN $2 AND $3
+		GROUP BY transaction_date
+
+		UNION ALL
+		-- period adjustments with suppliers and employees
+		SELECT t.transaction_date, 'expense',
+		       SUM(CASE WHEN t.to_entity_type IN ('suppliers', 'employees') THEN t.amount ELSE -t.amount END), 0
+		FROM transactions t
+		WHERE t.branch_id = $1 AND t.transaction_type = 'Adjustment'
+		  AND (t.to_entity_type IN ('suppliers', 'employees') OR t.from_entity_type IN ('suppliers', 'employees'))
+		  AND NOT EXISTS (SELECT 1 FROM bank_statement_lines l WHERE l.transaction_id = t.transaction_id)
+		  AND t.transaction_date BETWEEN $2 AND $3
+		GROUP BY t.transaction_date
+	`
+	rows, err := tx.Query(ctx, query, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("rebuild top sheet query failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			day   time.Time
+			field string
+			value money.Amount
+			count int64
+		)
+		if err := rows.Scan(&day, &field, &value, &count); err != nil {
+			return nil, fmt.Errorf("scan rebuilt top sheet failed: %w", err)
+		}
+		ts := sheet(day)
+		switch field {
+		case "order_count":
+			ts.OrderCount += count
+		case "cancelled":
+			ts.Cancelled += count
+		case "delivery":
+			ts.Delivery += count
+		case "ready_made":
+			ts.ReadyMade += count
+		case "sales_amount":
+			ts.SalesAmount += value
+		case "cash":
+			ts.Cash += value
+		case "bank":
+			ts.Bank += value
+		case "expense":
+			ts.Expense += value
+		}
+	}
+	return sheets, rows.Err()
+}
+
+// rebuildEmployeeProgressTx derives the per-employee daily counters:
+//   - sale_amount / order_count: orders and sales credited to the salesperson; orders
+//     cancelled with a cancel date are taken back on that date
+//   - salary / advance_payment:  Salary and Advance Payment transactions paid to the employee
+func rebuildEmployeeProgressTx(ctx context.Context, tx pgx.Tx, branchID int64, startDate, endDate time.Time) (map[employeeDay]*models.EmployeeProgressDB, error) {
+	progress := map[employeeDay]*models.EmployeeProgressDB{}
+
+	query := `
+		SELECT order_date, salesperson_id, 'order', SUM(total_amount), SUM(total_products)::bigint
+		FROM orders
+		WHERE branch_id = $1 AND (status <> 'cancelled' OR cancelled_at IS NOT NULL)
+		  AND order_date BETWEEN $2 AND $3
+		GROUP BY order_date, salesperson_id
+
+		UNION ALL
+		SELECT cancelled_at, salesperson_id, 'order', -SUM(total_amount), -SUM(total_products)::bigint
+		FROM orders
+		WHERE branch_id = $1 AND status = 'cancelled' AND cancelled_at BETWEEN $2 AND $3
+		GROUP BY cancelled_at, salesperson_id
+
+		UNION ALL
+		SELECT sale_date, salesperson_id, 'sale', SUM(total_amount), 0
+		FROM sales
+		WHERE branch_id = $1 AND status <> 'cancelled' AND sale_date BETWEEN $2 AND $3
+		GROUP BY sale_date, salesperson_id
+
+		UNION ALL
+		SELECT transaction_date, to_entity_id, transaction_type, SUM(amount), 0
+		FROM transactions
+		WHERE branch_id = $1 AND to_entity_type = 'employees'
+		  AND transaction_type IN ('Salary', 'Advance Payment')
+		  AND transaction_date BETWEEN $2 AND $3
+		GROUP BY transaction_date, to_entity_id, transaction_type
+	`
+	rows, err := tx.Query(ctx, query, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("rebuild employee progress query failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			day        time.Time
+			employeeID int64
+			source     string
+			amount     money.Amount
+			items      int64
+		)
+		if err := rows.Scan(&day, &employeeID, &source, &amount, &items); err != nil {
+			return nil, fmt.Errorf("scan rebuilt employee progress failed: %w", err)
+		}
+		key := employeeDay{day.Format("2006-01-02"), employeeID}
+		ep := progress[key]
+		if ep == nil {
+			ep = &models.EmployeeProgressDB{SheetDate: day, BranchID: branchID, EmployeeID: employeeID}
+			progress[key] = ep
+		}
+		switch source {
+		case "order":
+			ep.SaleAmount += amount
+			ep.OrderCount += items
+		case "sale":
+			ep.SaleAmount += amount
+		case models.SALARY:
+			ep.Salary += amount
+		case models.ADVANCE_PAYMENT:
+			ep.AdvancePayment += amount
+		}
+	}
+	return progress, rows.Err()
+}
+
+// unionKeys returns the keys present in either map, sorted for a stable diff
+func unionKeys[K comparable, V any](a, b map[K]V) []K {
+	keys := make([]K, 0, len(a)+len(b))
+	seen := map[K]bool{}
+	for k := range a {
+		seen[k] = true
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+	return keys
+}
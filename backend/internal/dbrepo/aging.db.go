@@ -0,0 +1,168 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// AgingFilter narrows the receivables aging report. Zero values mean no filter.
+type AgingFilter struct {
+	SalespersonID int64
+	CustomerID    int64
+	Details       bool // include the documents of every customer
+}
+
+// GetReceivablesAging buckets the unpaid part of every order and sale of a
+// branch by days past due at the end of asOf. Payments are counted up to asOf,
+// so the report can be rerun for an earlier month end.
+func (r *ReportRepo) GetReceivablesAging(ctx context.Context, branchID int64, asOf time.Time, filter AgingFilter) (*models.ReceivablesAging, error) {
+	branches, err := r.reportBranches(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.ReceivablesAging{
+		BranchID:      branchID,
+		BranchName:    branches[0].name,
+		AsOf:          asOf,
+		SalespersonID: filter.SalespersonID,
+		Customers:     []*models.CustomerAging{},
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT d.document_type, d.document_id, d.memo_no, d.document_date, d.due_date, d.status,
+		       d.salesperson_id, COALESCE(e.name, ''),
+		       d.customer_id, c.name, c.mobile,
+		       d.total_amount, d.received
+		FROM (
+			SELECT 'order' AS document_type, o.id AS document_id, o.memo_no, o.order_date AS document_date,
+			       COALESCE(o.delivery_date, o.order_date) AS due_date, o.status,
+			       o.salesperson_id, o.customer_id, o.total_amount,
+			       COALESCE(ot.received, 0) AS received
+			FROM orders o
+			LEFT JOIN (
+				SELECT order_id, SUM(CASE WHEN transaction_type = 'Refund' THEN -amount ELSE amount END) AS received
+				FROM order_transactions
+				WHERE transaction_date <= $2::date
+				GROUP BY order_id
+			) ot ON ot.order_id = o.id
+			WHERE o.branch_id = $1
+			  AND o.status NOT IN ('cancelled', 'returned')
+			  AND o.order_date <= $2::date
+
+			UNION ALL
+			SELECT 'sale', s.id, s.memo_no, s.sale_date, s.sale_date, s.status,
+			       s.salesperson_id, s.customer_id, s.total_amount,
+			       COALESCE(st.received, 0)
+			FROM sales s
+			LEFT JOIN (
+				SELECT sale_id, SUM(CASE WHEN transaction_type = 'Refund' THEN -amount ELSE amount END) AS received
+				FROM sale_transactions
+				WHERE transaction_date <= $2::date
+				GROUP BY sale_id
+			) st ON st.sale_id = s.id
+			WHERE s.branch_id = $1
+			  AND s.status NOT IN ('cancelled', 'returned')
+			  AND s.sale_date <= $2::date
+		) d
+		JOIN customers c ON c.id = d.customer_id
+		LEFT JOIN employees e ON e.id = d.salesperson_id
+		WHERE d.total_amount - d.received > 0.005
+		  AND ($3::bigint = 0 OR d.salesperson_id = $3)
+		  AND ($4::bigint = 0 OR d.customer_id = $4)
+		ORDER BY d.due_date, d.document_id
+	`, branchID, asOf, filter.SalespersonID, filter.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("aging query failed: %w", err)
+	}
+	defer rows.Close()
+
+	customers := make(map[int64]*models.CustomerAging)
+	for rows.Next() {
+		var (
+			doc  models.AgingDocument
+			cust models.CustomerAging
+		)
+		err := rows.Scan(
+			&doc.DocumentType, &doc.DocumentID, &doc.MemoNo, &doc.DocumentDate, &doc.DueDate, &doc.Status,
+			&doc.SalespersonID, &doc.SalespersonName,
+			&cust.CustomerID, &cust.CustomerName, &cust.CustomerMobile,
+			&doc.TotalAmount, &doc.ReceivedAmount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan aging document failed: %w", err)
+		}
+		doc.DueAmount = doc.TotalAmount - doc.ReceivedAmount
+		doc.DaysOverdue = int(asOf.Sub(doc.DueDate).Hours() / 24)
+		doc.Bucket = agingBucket(doc.DaysOverdue)
+
+		c, ok := customers[cust.CustomerID]
+		if !ok {
+			c = &cust
+			c.OldestDueDate = doc.DueDate
+			customers[c.CustomerID] = c
+			report.Customers = append(report.Customers, c)
+		}
+		addAging(&c.Buckets, doc.Bucket, doc.DueAmount)
+		addAging(&report.Totals, doc.Bucket, doc.DueAmount)
+		if filter.Details || filter.CustomerID != 0 {
+			d := doc
+			c.Documents = append(c.Documents, &d)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("aging rows failed: %w", err)
+	}
+
+	// most overdue money first
+	sort.SliceStable(report.Customers, func(i, j int) bool {
+		a, b := report.Customers[i].Buckets, report.Customers[j].Buckets
+		if a.Over90 != b.Over90 {
+			return a.Over90 > b.Over90
+		}
+		if a.Days61To90 != b.Days61To90 {
+			return a.Days61To90 > b.Days61To90
+		}
+		if a.Days31To60 != b.Days31To60 {
+			return a.Days31To60 > b.Days31To60
+		}
+		return a.Total > b.Total
+	})
+	return report, nil
+}
+
+// agingBucket maps days past due to its bucket; documents not yet due are current
+func agingBucket(days int) string {
+	switch {
+	case days <= 0:
+		return models.AGING_CURRENT
+	case days <= 30:
+		return models.AGING_1_30
+	case days <= 60:
+		return models.AGING_31_60
+	case days <= 90:
+		return models.AGING_61_90
+	default:
+		return models.AGING_OVER_90
+	}
+}
+
+func addAging(b *models.AgingBuckets, bucket string, amount money.Amount) {
+	switch bucket {
+	case models.AGING_CURRENT:
+		b.Current += amount
+	case models.AGING_1_30:
+		b.Days1To30 += amount
+	case models.AGING_31_60:
+		b.Days31To60 += amount
+	case models.AGING_61_90:
+		b.Days61To90 += amount
+	default:
+		b.Over90 += amount
+	}
+	b.Total += amount
+}
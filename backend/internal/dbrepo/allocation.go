@@ -0,0 +1,63 @@
+package dbrepo
+
+import (
+	"fmt"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// allocationLine is the part of a payment put on one open document. ref names
+// the document in errors, e.g. "order 12".
+type allocationLine struct {
+	key    string
+	ref    string
+	amount money.Amount
+}
+
+// dueDocument is an open document a payment can be put on
+type dueDocument struct {
+	memoNo string
+	due    money.Amount
+}
+
+// checkAllocations validates the allocations given with a payment against the
+// open documents of the customer or supplier (owner) and returns their total.
+// Each document may be named once, with an amount above zero and up to its due.
+func checkAllocations(lines []allocationLine, open map[string]dueDocument, owner string) (money.Amount, error) {
+	var total money.Amount
+	seen := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		doc, ok := open[l.key]
+		if !ok {
+			return 0, fmt.Errorf("%s is not an open document of this %s", l.ref, owner)
+		}
+		if seen[l.key] {
+			return 0, fmt.Errorf("%s is allocated more than once", l.ref)
+		}
+		seen[l.key] = true
+		if l.amount <= 0 {
+			return 0, fmt.Errorf("allocation to %s must be greater than zero", l.ref)
+		}
+		if l.amount > doc.due {
+			return 0, fmt.Errorf("allocation to %s (%s) exceeds its due amount %s", l.ref, doc.memoNo, doc.due)
+		}
+		total += l.amount
+	}
+	return total, nil
+}
+
+// spreadOldestFirst puts amount on due amounts listed oldest first, settling
+// each in full before the next. It returns the part put on each document and
+// stops at the first one the money does not reach.
+func spreadOldestFirst(amount money.Amount, dues []money.Amount) []money.Amount {
+	var parts []money.Amount
+	for _, due := range dues {
+		if amount <= 0 {
+			break
+		}
+		part := min(due, amount)
+		parts = append(parts, part)
+		amount -= part
+	}
+	return parts
+}
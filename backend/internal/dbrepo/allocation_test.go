@@ -0,0 +1,58 @@
+package dbrepo
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+func TestSpreadOldestFirst(t *testing.T) {
+	dues := []money.Amount{3000, 5000, 7000}
+	tests := []struct {
+		amount money.Amount
+		want   []money.Amount
+	}{
+		{0, nil},
+		{2000, []money.Amount{2000}},
+		{3000, []money.Amount{3000}},
+		{4000, []money.Amount{3000, 1000}},
+		{15000, []money.Amount{3000, 5000, 7000}},
+		{20000, []money.Amount{3000, 5000, 7000}},
+	}
+	for _, tt := range tests {
+		if got := spreadOldestFirst(tt.amount, dues); !slices.Equal(got, tt.want) {
+			t.Errorf("spreadOldestFirst(%s) = %v, want %v", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestCheckAllocations(t *testing.T) {
+	open := map[string]dueDocument{
+		"sale-2":  {memoNo: "S-2", due: 3000},
+		"order-9": {memoNo: "O-9", due: 7000},
+	}
+	total, err := checkAllocations([]allocationLine{
+		{key: "order-9", ref: "order 9", amount: 7000},
+		{key: "sale-2", ref: "sale 2", amount: 1000},
+	}, open, "customer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 8000 {
+		t.Errorf("total = %s, want 80.00", total)
+	}
+
+	bad := map[string][]allocationLine{
+		"unknown":  {{key: "sale-4", ref: "sale 4", amount: 100}},
+		"twice":    {{key: "sale-2", ref: "sale 2", amount: 100}, {key: "sale-2", ref: "sale 2", amount: 100}},
+		"zero":     {{key: "sale-2", ref: "sale 2", amount: 0}},
+		"negative": {{key: "sale-2", ref: "sale 2", amount: -100}},
+		"over due": {{key: "sale-2", ref: "sale 2", amount: 3001}},
+	}
+	for name, lines := range bad {
+		if _, err := checkAllocations(lines, open, "customer"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// ErrAttachmentQuotaExceeded is returned when an upload would take the branch
+// over its attachment quota
+var ErrAttachmentQuotaExceeded = errors.New("attachment quota exceeded")
+
+// ============================== Attachment Repository ==============================
+type AttachmentRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAttachmentRepo(db *pgxpool.Pool) *AttachmentRepo {
+	return &AttachmentRepo{db: db}
+}
+
+const attachmentColumns = `
+	id, branch_id, entity_type, entity_id, file_name, content_type, size_bytes,
+	caption, uploaded_by, created_at, storage_path, thumb_path`
+
+func scanAttachment(row pgx.Row) (*models.Attachment, error) {
+	a := &models.Attachment{}
+	err := row.Scan(&a.ID, &a.BranchID, &a.EntityType, &a.EntityID, &a.FileName, &a.ContentType, &a.SizeBytes,
+		&a.Caption, &a.UploadedBy, &a.CreatedAt, &a.StoragePath, &a.ThumbPath)
+	if err != nil {
+		return nil, err
+	}
+	setAttachmentURLs(a)
+	return a, nil
+}
+
+// setAttachmentURLs fills in where the file and its thumbnail are downloaded from
+func setAttachmentURLs(a *models.Attachment) {
+	a.DownloadURL = fmt.Sprintf("/api/v1/attachments/%d", a.ID)
+	if a.ThumbPath != nil {
+		a.ThumbnailURL = fmt.Sprintf("/api/v1/attachments/%d/thumbnail", a.ID)
+	}
+}
+
+// attachmentEntityExists checks that the entity an attachment is linked to
+// exists in the branch
+func attachmentEntityExists(ctx context.Context, q rowQueryer, branchID int64, entityType string, entityID int64) error {
+	var query string
+	switch entityType {
+	case models.ATTACHMENT_ORDER:
+		query = `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1 AND branch_id = $2)`
+	case models.ATTACHMENT_ORDER_ITEM:
+		query = `SELECT EXISTS (SELECT 1 FROM order_items oi JOIN orders o ON o.id = oi.order_id WHERE oi.id = $1 AND o.branch_id = $2)`
+	case models.ATTACHMENT_CUSTOMER:
+		query = `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1 AND branch_id = $2)`
+	case models.ATTACHMENT_PURCHASE:
+		query = `SELECT EXISTS (SELECT 1 FROM purchase WHERE id = $1 AND branch_id = $2)`
+	case models.ATTACHMENT_EXPENSE:
+		query = `SELECT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = $1 AND branch_id = $2)`
+	default:
+		return fmt.Errorf("attachments cannot be linked to %q", entityType)
+	}
+	var ok bool
+	if err := q.QueryRow(ctx, query, entityID, branchID).Scan(&ok); err != nil {
+		return fmt.Errorf("check attachment entity failed: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("%s with id %d not found in this branch", entityType, entityID)
+	}
+	return nil
+}
+
+// CheckEntity verifies that an upload may be linked to the entity before the
+// file is stored
+func (a *AttachmentRepo) CheckEntity(ctx context.Context, branchID int64, entityType string, entityID int64) error {
+	return attachmentEntityExists(ctx, a.db, branchID, entityType, entityID)
+}
+
+// CreateAttachment records an uploaded file. The branch is locked while its
+// usage is checked against the quota so concurrent uploads cannot overrun it.
+func (a *AttachmentRepo) CreateAttachment(ctx context.Context, att *models.Attachment) error {
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// --------------------
+	// Step 1: Check the entity and the quota
+	// --------------------
+	if err := attachmentEntityExists(ctx, tx, att.BranchID, att.EntityType, att.EntityID); err != nil {
+		return err
+	}
+	var quotaMB int64
+	err = tx.QueryRow(ctx, `SELECT attachment_quota_mb FROM branches WHERE id = $1 FOR UPDATE`, att.BranchID).Scan(&quotaMB)
+	if err != nil {
+		return fmt.Errorf("load attachment quota failed: %w", err)
+	}
+	var used int64
+	err = tx.QueryRow(ctx, `SELECT COALESCE(SUM(size_bytes), 0) FROM attachments WHERE branch_id = $1`, att.BranchID).Scan(&used)
+	if err != nil {
+		return fmt.Errorf("load attachment usage failed: %w", err)
+	}
+	if quota := quotaMB << 20; used+att.SizeBytes > quota {
+		return fmt.Errorf("%w: %d of %d MB used", ErrAttachmentQuotaExceeded, used>>20, quotaMB)
+	}
+
+	// --------------------
+	// Step 2: Insert
+	// --------------------
+	err = tx.QueryRow(ctx, `
+		INSERT INTO attachments (branch_id, entity_type, entity_id, file_name, content_type, size_bytes,
+			storage_path, thumb_path, caption, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`, att.BranchID, att.EntityType, att.EntityID, att.FileName, att.ContentType, att.SizeBytes,
+		att.StoragePath, att.ThumbPath, att.Caption, att.UploadedBy,
+	).Scan(&att.ID, &att.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert attachment failed: %w", err)
+	}
+	setAttachmentURLs(att)
+	return tx.Commit(ctx)
+}
+
+// GetAttachment returns one attachment of the branch
+func (a *AttachmentRepo) GetAttachment(ctx context.Context, branchID, id int64) (*models.Attachment, error) {
+	att, err := scanAttachment(a.db.QueryRow(ctx,
+		`SELECT `+attachmentColumns+` FROM attachments WHERE id = $1 AND branch_id = $2`, id, branchID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("attachment with id %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load attachment failed: %w", err)
+	}
+	return att, nil
+}
+
+// ListAttachments returns the attachments of an entity, oldest first
+func (a *AttachmentRepo) ListAttachments(ctx context.Context, branchID int64, entityType string, entityID int64) ([]*models.Attachment, error) {
+	rows, err := a.db.Query(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE branch_id = $1 AND entity_type = $2 AND entity_id = $3
+		ORDER BY id
+	`, branchID, entityType, entityID)
+	if err != nil {
+		return nil, fmt.Errorf("list attachments failed: %w", err)
+	}
+	defer rows.Close()
+
+	list := []*models.Attachment{}
+	for rows.Next() {
+		att, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan attachment failed: %w", err)
+		}
+		list = append(list, att)
+	}
+	return list, rows.Err()
+}
+
+// DeleteAttachment removes the record and returns it so its files can be removed
+func (a *AttachmentRepo) DeleteAttachment(ctx context.Context, branchID, id int64) (*models.Attachment, error) {
+	att, err := scanAttachment(a.db.QueryRow(ctx,
+		`DELETE FROM attachments WHERE id = $1 AND branch_id = $2 RETURNING `+attachmentColumns, id, branchID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("attachment with id %d not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("delete attachment failed: %w", err)
+	}
+	return att, nil
+}
+
+// GetUsage returns the space the branch's attachments take and its quota
+func (a *AttachmentRepo) GetUsage(ctx context.Context, branchID int64) (*models.AttachmentUsage, error) {
+	u := &models.AttachmentUsage{BranchID: branchID}
+	err := a.db.QueryRow(ctx, `
+		SELECT b.attachment_quota_mb::bigint << 20,
+		       (SELECT COUNT(*) FROM attachments WHERE branch_id = b.id),
+		       (SELECT COALESCE(SUM(size_bytes), 0) FROM attachments WHERE branch_id = b.id)::bigint
+		FROM branches b
+		WHERE b.id = $1
+	`, branchID).Scan(&u.QuotaBytes, &u.Files, &u.UsedBytes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("branch %d not found", branchID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load attachment usage failed: %w", err)
+	}
+	return u, nil
+}
+
+// SetQuota sets the space the branch may use for attachments
+func (a *AttachmentRepo) SetQuota(ctx context.Context, branchID int64, quotaMB int64) error {
+	if quotaMB < 0 {
+		return errors.New("attachment quota cannot be negative")
+	}
+	tag, err := a.db.Exec(ctx, `UPDATE branches SET attachment_quota_mb = $1 WHERE id = $2`, quotaMB, branchID)
+	if err != nil {
+		return fmt.Errorf("update attachment quota failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("branch %d not found", branchID)
+	}
+	return nil
+}
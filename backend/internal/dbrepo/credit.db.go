@@ -0,0 +1,88 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ErrCreditLimitExceeded is returned when a new order or sale would take the
+// customer's due over the credit limit without a manager override.
+var ErrCreditLimitExceeded = errors.New("credit limit exceeded")
+
+// checkCreditLimitTx locks the customer and verifies that existing due plus
+// newDue stays within the customer's limit (or the branch default). It returns
+// the override to record with the document, which is nil when none was needed.
+func checkCreditLimitTx(ctx context.Context, tx pgx.Tx, branchID, customerID int64, newDue money.Amount, override *models.CreditOverride) (*models.CreditOverride, error) {
+	var (
+		due   money.Amount
+		limit *money.Amount
+	)
+	err := tx.QueryRow(ctx, `
+		SELECT c.due_amount, COALESCE(c.credit_limit, b.default_credit_limit)
+		FROM customers c
+		JOIN branches b ON b.id = $2
+		WHERE c.id = $1 AND c.branch_id = $2
+		FOR UPDATE OF c
+	`, customerID, branchID).Scan(&due, &limit)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("customer with id %d not found in this branch", customerID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load credit limit failed: %w", err)
+	}
+
+	if limit == nil || newDue <= 0 || due+newDue <= *limit {
+		return nil, nil
+	}
+	if override == nil || override.ApprovedBy == 0 {
+		return nil, fmt.Errorf("%w: customer owes %s, this adds %s and the limit is %s; a manager override is required",
+			ErrCreditLimitExceeded, due, newDue, *limit)
+	}
+	return override, nil
+}
+
+// creditOverrideColumns splits an override into the values stored on orders and sales
+func creditOverrideColumns(o *models.CreditOverride) (approvedBy *int64, reason *string) {
+	if o == nil {
+		return nil, nil
+	}
+	return &o.ApprovedBy, &o.Reason
+}
+
+// SetCustomerCreditLimit sets the customer's own limit; nil falls back to the branch default.
+func (s *CustomerRepo) SetCustomerCreditLimit(ctx context.Context, branchID, customerID int64, limit *money.Amount) error {
+	if limit != nil && *limit < 0 {
+		return errors.New("credit limit cannot be negative")
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE customers SET credit_limit = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND branch_id = $3`,
+		limit, customerID, branchID,
+	)
+	if err != nil {
+		return fmt.Errorf("update credit limit failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("customer with id %d not found in this branch", customerID)
+	}
+	return nil
+}
+
+// SetBranchCreditLimit sets the default limit of the branch's customers; nil removes it.
+func (s *CustomerRepo) SetBranchCreditLimit(ctx context.Context, branchID int64, limit *money.Amount) error {
+	if limit != nil && *limit < 0 {
+		return errors.New("credit limit cannot be negative")
+	}
+	tag, err := s.db.Exec(ctx, `UPDATE branches SET default_credit_limit = $1 WHERE id = $2`, limit, branchID)
+	if err != nil {
+		return fmt.Errorf("update branch credit limit failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("branch %d not found", branchID)
+	}
+	return nil
+}
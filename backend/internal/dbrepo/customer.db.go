@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
 )
 
 // ============================== Customer Repository ==============================
@@ -21,8 +24,15 @@ func NewCustomerRepo(db *pgxpool.Pool) *CustomerRepo {
 	return &CustomerRepo{db: db}
 }
 
-// 1. CreateNewCustomer adds a new customer to the database.
+// 1. CreateNewCustomer adds a new customer to the database. Measurements given
+// with the customer start the customer's default measurement profile.
 func (s *CustomerRepo) CreateNewCustomer(ctx context.Context, customer *models.Customer) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 		INSERT INTO customers 
 		(name, mobile, address, tax_id, branch_id,
@@ -48,7 +58,7 @@ func (s *CustomerRepo) CreateNewCustomer(ctx context.Context, customer *models.C
 		customer.RoundWidth,
 	}
 
-	err := s.db.QueryRow(ctx, query, args...).Scan(
+	err = tx.QueryRow(ctx, query, args...).Scan(
 		&customer.ID,
 		&customer.Status,
 		&customer.DueAmount,
@@ -68,11 +78,22 @@ func (s *CustomerRepo) CreateNewCustomer(ctx context.Context, customer *models.C
 		}
 		return fmt.Errorf("error creating customer: %w", err)
 	}
-	return nil
+
+	if err := syncDefaultProfileTx(ctx, tx, customer); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// 2. UpdateCustomerInfo updates a customer's basic information.
+// 2. UpdateCustomerInfo updates a customer's basic information. Changed
+// measurements are recorded as a new version of the default measurement profile.
 func (s *CustomerRepo) UpdateCustomerInfo(ctx context.Context, customer *models.Customer) (*time.Time, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 		UPDATE customers
 		SET name = $1, mobile = $2, address = $3, tax_id = $4,
@@ -80,15 +101,15 @@ func (s *CustomerRepo) UpdateCustomerInfo(ctx context.Context, customer *models.
 		    arm_hole = $10, sleeve_length = $11, sleeve_width = $12, round_width = $13,
 		    updated_at = NOW()
 		WHERE id = $14
-		RETURNING updated_at;`
+		RETURNING branch_id, updated_at;`
 
 	var updatedAt time.Time
-	err := s.db.QueryRow(ctx, query,
+	err = tx.QueryRow(ctx, query,
 		customer.Name, customer.Mobile, customer.Address, customer.TaxID,
 		customer.Length, customer.Shoulder, customer.Bust, customer.Waist, customer.Hip,
 		customer.ArmHole, customer.SleeveLength, customer.SleeveWidth, customer.RoundWidth,
 		customer.ID,
-	).Scan(&updatedAt)
+	).Scan(&customer.BranchID, &updatedAt)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -106,35 +127,358 @@ func (s *CustomerRepo) UpdateCustomerInfo(ctx context.Context, customer *models.
 		return nil, fmt.Errorf("error updating customer info: %w", err)
 	}
 
-	return &updatedAt, nil
+	if err := syncDefaultProfileTx(ctx, tx, customer); err != nil {
+		return nil, err
+	}
+	return &updatedAt, tx.Commit(ctx)
 }
 
-// 3. DeductCustomerDueAmount deducts the due amount of a customer.
-func (s *CustomerRepo) DeductCustomerDueAmount(ctx context.Context, customerID, branchID int64, deductedAmount float64) error {
+// 3. ReceivePayment records money received from a customer into a cash or bank
+// account and settles it against the customer's open orders and sales. Whatever
+// is left unallocated is kept as the customer's store credit.
+func (s *CustomerRepo) ReceivePayment(ctx context.Context, payment *models.CustomerPayment) (*models.CustomerPaymentResult, error) {
+	if payment.Amount <= 0 {
+		return nil, errors.New("payment amount must be greater than zero")
+	}
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	query := `UPDATE customers SET due_amount = due_amount - $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2;`
+	defer tx.Rollback(ctx)
 
-	res, err := tx.Exec(ctx, query, deductedAmount, customerID)
+	result, err := receivePaymentTx(ctx, tx, payment)
 	if err != nil {
-		return fmt.Errorf("error updating due amount: %w", err)
+		return nil, err
 	}
+	return result, tx.Commit(ctx)
+}
 
-	if res.RowsAffected() == 0 {
-		return fmt.Errorf("customer with id %d not found", customerID)
+// receivePaymentTx books a customer payment inside tx, see ReceivePayment
+func receivePaymentTx(ctx context.Context, tx pgx.Tx, payment *models.CustomerPayment) (*models.CustomerPaymentResult, error) {
+	if err := EnsurePeriodOpenTx(ctx, tx, payment.BranchID, payment.PaymentDate); err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// 1. Lock customer and account
+	// --------------------
+	var dueAmount money.Amount
+	err := tx.QueryRow(ctx,
+		`SELECT due_amount FROM customers WHERE id = $1 AND branch_id = $2 FOR UPDATE`,
+		payment.CustomerID, payment.BranchID,
+	).Scan(&dueAmount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("customer with id %d not found in this branch", payment.CustomerID)
+		}
+		return nil, fmt.Errorf("lock customer failed: %w", err)
+	}
+
+	var acctType string
+	err = tx.QueryRow(ctx,
+		`SELECT type FROM accounts WHERE id = $1 AND branch_id = $2 FOR UPDATE`,
+		payment.AccountID, payment.BranchID,
+	).Scan(&acctType)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("account with id %d not found in this branch", payment.AccountID)
+		}
+		return nil, fmt.Errorf("lock account failed: %w", err)
+	}
+
+	// --------------------
+	// 2. Allocate across open documents
+	// --------------------
+	_, err = tx.Exec(ctx, `
+		SELECT id FROM orders WHERE customer_id = $1 AND branch_id = $2 FOR UPDATE;
+	`, payment.CustomerID, payment.BranchID)
+	if err != nil {
+		return nil, fmt.Errorf("lock orders failed: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		SELECT id FROM sales WHERE customer_id = $1 AND branch_id = $2 FOR UPDATE;
+	`, payment.CustomerID, payment.BranchID)
+	if err != nil {
+		return nil, fmt.Errorf("lock sales failed: %w", err)
 	}
 
-	err = SaveTopSheetTx(tx, ctx, &models.TopSheetDB{
-		SheetDate:     time.Now(),
-		BranchID: branchID,
-		Cash:     deductedAmount,
+	docs, err := getOpenDocuments(ctx, tx, payment.BranchID, payment.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := allocatePayment(payment, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	memoNo, err := NextMemoNoTx(ctx, tx, payment.BranchID, models.MEMO_PAYMENT, payment.PaymentDate)
+	if err != nil {
+		return nil, err
+	}
+	var allocated money.Amount
+	for _, a := range allocations {
+		doc := docs[openDocumentKey(a.DocumentType, a.DocumentID)]
+		a.MemoNo = doc.MemoNo
+		allocated += a.Amount
+
+		switch a.DocumentType {
+		case models.DOCUMENT_ORDER:
+			_, err = tx.Exec(ctx, `
+				UPDATE orders SET
+					received_amount = received_amount + $1,
+					status = CASE
+						WHEN delivered_products >= total_products AND received_amount + $1 >= total_amount THEN $2
+						ELSE status
+					END,
+					updated_at = CURRENT_TIMESTAMP
+				WHERE id = $3
+			`, a.Amount, models.ORDER_DELIVERY, a.DocumentID)
+			if err != nil {
+				return nil, fmt.Errorf("update order %d failed: %w", a.DocumentID, err)
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO order_transactions(
+					order_id, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
+					amount, transaction_type
+				)
+				VALUES ($1,$2,$3,$4,$5,0,$6,$7)
+			`, a.DocumentID, payment.PaymentDate, payment.AccountID, memoNo, doc.salespersonID, a.Amount, models.PAYMENT)
+			if err != nil {
+				return nil, fmt.Errorf("insert order payment failed: %w", err)
+			}
+		case models.DOCUMENT_SALE:
+			_, err = tx.Exec(ctx, `
+				UPDATE sales SET received_amount = received_amount + $1, updated_at = CURRENT_TIMESTAMP
+				WHERE id = $2
+			`, a.Amount, a.DocumentID)
+			if err != nil {
+				return nil, fmt.Errorf("update sale %d failed: %w", a.DocumentID, err)
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO sale_transactions(
+					sale_id, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
+					amount, transaction_type
+				)
+				VALUES ($1,$2,$3,$4,$5,0,$6,$7)
+			`, a.DocumentID, payment.PaymentDate, payment.AccountID, memoNo, doc.salespersonID, a.Amount, models.PAYMENT)
+			if err != nil {
+				return nil, fmt.Errorf("insert sale payment failed: %w", err)
+			}
+		}
+	}
+
+	// --------------------
+	// 3. Global transaction, account balance and customer due
+	// --------------------
+	notes := payment.Notes
+	if notes == "" {
+		notes = "Payment received from customer"
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: payment.PaymentDate,
+		MemoNo:          memoNo,
+		BranchID:        payment.BranchID,
+		FromID:          payment.CustomerID,
+		FromType:        models.ENTITY_CUSTOMER,
+		ToID:            payment.AccountID,
+		ToType:          models.ENTITY_ACCOUNT,
+		Amount:          payment.Amount,
+		TransactionType: models.PAYMENT,
+		Notes:           notes,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return tx.Commit(ctx)
+
+	_, err = tx.Exec(ctx,
+		`UPDATE accounts SET current_balance = current_balance + $1 WHERE id = $2`,
+		payment.Amount, payment.AccountID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update account balance failed: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE customers SET due_amount = due_amount - $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		allocated, payment.CustomerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update customer due failed: %w", err)
+	}
+
+	// the part not settled against documents becomes store credit
+	overpaid := payment.Amount - allocated
+	if overpaid > 0 {
+		err = postStoreCreditTx(ctx, tx, &models.StoreCreditEntry{
+			BranchID:      payment.BranchID,
+			CustomerID:    payment.CustomerID,
+			EntryDate:     payment.PaymentDate,
+			EntryType:     models.STORE_CREDIT_OVERPAYMENT,
+			Amount:        overpaid,
+			AccountID:     &payment.AccountID,
+			TransactionID: &transactionID,
+			MemoNo:        memoNo,
+			Notes:         "Unallocated part of payment " + memoNo,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// --------------------
+	// 4. Top sheet
+	// --------------------
+	topSheet := &models.TopSheetDB{
+		SheetDate: payment.PaymentDate,
+		BranchID:  payment.BranchID,
+	}
+	if acctType == models.ACCOUNT_BANK {
+		topSheet.Bank = payment.Amount
+	} else {
+		topSheet.Cash = payment.Amount
+	}
+	if err := SaveTopSheetTx(tx, ctx, topSheet); err != nil {
+		return nil, fmt.Errorf("save top sheet failed: %w", err)
+	}
+
+	// the payment may earn points on the documents it settles
+	for _, a := range allocations {
+		if err := syncLoyaltyTx(ctx, tx, a.DocumentType, a.DocumentID, payment.PaymentDate); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &models.CustomerPaymentResult{
+		MemoNo:        memoNo,
+		TransactionID: transactionID,
+		CustomerID:    payment.CustomerID,
+		Amount:        payment.Amount,
+		Allocations:   allocations,
+		RemainingDue:  dueAmount - allocated,
+		StoreCredit:   overpaid,
+	}
+	return result, nil
+}
+
+// GetOpenDocuments lists the orders and sales of a customer that still have
+// money due, oldest first.
+func (s *CustomerRepo) GetOpenDocuments(ctx context.Context, branchID, customerID int64) ([]*models.OpenDocument, error) {
+	docs, err := getOpenDocuments(ctx, s.db, branchID, customerID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*models.OpenDocument, 0, len(docs))
+	for _, d := range docs {
+		list = append(list, &d.OpenDocument)
+	}
+	sort.Slice(list, func(i, j int) bool { return openDocumentBefore(list[i], list[j]) })
+	return list, nil
+}
+
+type openDocument struct {
+	models.OpenDocument
+	salespersonID int64
+}
+
+// queryer is satisfied by both the pool and a transaction
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func openDocumentKey(docType string, id int64) string {
+	return docType + "-" + strconv.FormatInt(id, 10)
+}
+
+func openDocumentBefore(a, b *models.OpenDocument) bool {
+	if !a.DocumentDate.Equal(b.DocumentDate) {
+		return a.DocumentDate.Before(b.DocumentDate)
+	}
+	if a.DocumentType != b.DocumentType {
+		return a.DocumentType == models.DOCUMENT_ORDER
+	}
+	return a.DocumentID < b.DocumentID
+}
+
+func getOpenDocuments(ctx context.Context, q queryer, branchID, customerID int64) (map[string]*openDocument, error) {
+	rows, err := q.Query(ctx, `
+		SELECT 'order', id, memo_no, order_date, status, salesperson_id, total_amount, received_amount
+		FROM orders
+		WHERE customer_id = $1 AND branch_id = $2
+		  AND status NOT IN ('cancelled', 'returned')
+		  AND total_amount - received_amount > 0
+		UNION ALL
+		SELECT 'sale', id, memo_no, sale_date, status, salesperson_id, total_amount, received_amount
+		FROM sales
+		WHERE customer_id = $1 AND branch_id = $2
+		  AND status NOT IN ('cancelled', 'returned')
+		  AND total_amount - received_amount > 0
+	`, customerID, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("load open documents failed: %w", err)
+	}
+	defer rows.Close()
+
+	docs := make(map[string]*openDocument)
+	for rows.Next() {
+		d := &openDocument{}
+		err := rows.Scan(
+			&d.DocumentType, &d.DocumentID, &d.MemoNo, &d.DocumentDate, &d.Status,
+			&d.salespersonID, &d.TotalAmount, &d.ReceivedAmount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan open document failed: %w", err)
+		}
+		d.DueAmount = d.TotalAmount - d.ReceivedAmount
+		docs[openDocumentKey(d.DocumentType, d.DocumentID)] = d
+	}
+	return docs, rows.Err()
+}
+
+// allocatePayment validates explicit allocations, or spreads the payment over
+// the open documents oldest first when none are given.
+func allocatePayment(payment *models.CustomerPayment, docs map[string]*openDocument) ([]*models.PaymentAllocation, error) {
+	if len(payment.Allocations) > 0 {
+		open := make(map[string]dueDocument, len(docs))
+		for key, d := range docs {
+			open[key] = dueDocument{memoNo: d.MemoNo, due: d.DueAmount}
+		}
+		lines := make([]allocationLine, len(payment.Allocations))
+		for i, a := range payment.Allocations {
+			lines[i] = allocationLine{
+				key:    openDocumentKey(a.DocumentType, a.DocumentID),
+				ref:    fmt.Sprintf("%s %d", a.DocumentType, a.DocumentID),
+				amount: a.Amount,
+			}
+		}
+		total, err := checkAllocations(lines, open, "customer")
+		if err != nil {
+			return nil, err
+		}
+		if total > payment.Amount {
+			return nil, fmt.Errorf("allocations total %s exceeds payment amount %s", total, payment.Amount)
+		}
+		return payment.Allocations, nil
+	}
+
+	list := make([]*models.OpenDocument, 0, len(docs))
+	for _, d := range docs {
+		list = append(list, &d.OpenDocument)
+	}
+	sort.Slice(list, func(i, j int) bool { return openDocumentBefore(list[i], list[j]) })
+
+	dues := make([]money.Amount, len(list))
+	for i, d := range list {
+		dues[i] = d.DueAmount
+	}
+	var allocations []*models.PaymentAllocation
+	for i, amount := range spreadOldestFirst(payment.Amount, dues) {
+		allocations = append(allocations, &models.PaymentAllocation{
+			DocumentType: list[i].DocumentType,
+			DocumentID:   list[i].DocumentID,
+			Amount:       amount,
+		})
+	}
+	return allocations, nil
 }
 
 // 4. UpdateCustomerStatus updates active/inactive status.
@@ -170,18 +514,23 @@ func (s *CustomerRepo) GetCustomerByTaxID(ctx context.Context, taxID string) (*m
 // getCustomerBy helper
 func (s *CustomerRepo) getCustomerBy(ctx context.Context, field string, value any) (*models.Customer, error) {
 	query := fmt.Sprintf(`
-		SELECT id, name, mobile, address, tax_id, branch_id, due_amount, status,
-		       length, shoulder, bust, waist, hip, arm_hole,
-		       sleeve_length, sleeve_width, round_width,
-		       created_at, updated_at
-		FROM customers
-		WHERE %s = $1;`, field)
+		SELECT c.id, c.name, c.mobile, c.address, c.tax_id, c.branch_id, c.due_amount, c.store_credit,
+		       `+loyaltyBalanceSQL+`, c.status,
+		       c.length, c.shoulder, c.bust, c.waist, c.hip, c.arm_hole,
+		       c.sleeve_length, c.sleeve_width, c.round_width,
+		       c.credit_limit, COALESCE(c.credit_limit, b.default_credit_limit),
+		       c.created_at, c.updated_at
+		FROM customers c
+		LEFT JOIN branches b ON b.id = c.branch_id
+		WHERE c.%s = $1;`, field)
 
 	c := &models.Customer{}
 	err := s.db.QueryRow(ctx, query, value).Scan(
-		&c.ID, &c.Name, &c.Mobile, &c.Address, &c.TaxID, &c.BranchID, &c.DueAmount, &c.Status,
+		&c.ID, &c.Name, &c.Mobile, &c.Address, &c.TaxID, &c.BranchID, &c.DueAmount, &c.StoreCredit,
+		&c.LoyaltyPoints, &c.Status,
 		&c.Length, &c.Shoulder, &c.Bust, &c.Waist, &c.Hip, &c.ArmHole,
 		&c.SleeveLength, &c.SleeveWidth, &c.RoundWidth,
+		&c.CreditLimit, &c.EffectiveCreditLimit,
 		&c.CreatedAt, &c.UpdatedAt,
 	)
 	if err != nil {
@@ -190,13 +539,17 @@ func (s *CustomerRepo) getCustomerBy(ctx context.Context, field string, value an
 		}
 		return nil, fmt.Errorf("error fetching customer by %s: %w", field, err)
 	}
+	if c.EffectiveCreditLimit != nil {
+		remaining := *c.EffectiveCreditLimit - c.DueAmount
+		c.RemainingCredit = &remaining
+	}
 	return c, nil
 }
 
 // 6. FilterCustomersByName (ILIKE search)
 func (s *CustomerRepo) FilterCustomersByName(ctx context.Context, branchID int64, name string) ([]*models.Customer, error) {
 	query := `
-		SELECT id, name, mobile, address, tax_id, branch_id, due_amount, status,
+		SELECT id, name, mobile, address, tax_id, branch_id, due_amount, store_credit, status,
 		       length, shoulder, bust, waist, hip, arm_hole,
 		       sleeve_length, sleeve_width, round_width,
 		       created_at, updated_at
@@ -214,7 +567,7 @@ func (s *CustomerRepo) FilterCustomersByName(ctx context.Context, branchID int64
 	for rows.Next() {
 		var c models.Customer
 		if err := rows.Scan(
-			&c.ID, &c.Name, &c.Mobile, &c.Address, &c.TaxID, &c.BranchID, &c.DueAmount, &c.Status,
+			&c.ID, &c.Name, &c.Mobile, &c.Address, &c.TaxID, &c.BranchID, &c.DueAmount, &c.StoreCredit, &c.Status,
 			&c.Length, &c.Shoulder, &c.Bust, &c.Waist, &c.Hip, &c.ArmHole,
 			&c.SleeveLength, &c.SleeveWidth, &c.RoundWidth,
 			&c.CreatedAt, &c.UpdatedAt,
@@ -243,7 +596,7 @@ func (s *CustomerRepo) GetCustomers(ctx context.Context, page, limit int, branch
 
 	if limit == -1 {
 		query = `
-			SELECT id, name, mobile, address, tax_id, branch_id, due_amount, status,
+			SELECT id, name, mobile, address, tax_id, branch_id, due_amount, store_credit, status,
 			       length, shoulder, bust, waist, hip, arm_hole,
 			       sleeve_length, sleeve_width, round_width,
 			       created_at, updated_at
@@ -254,7 +607,7 @@ func (s *CustomerRepo) GetCustomers(ctx context.Context, page, limit int, branch
 	} else {
 		offset := (page - 1) * limit
 		query = `
-			SELECT id, name, mobile, address, tax_id, branch_id, due_amount, status,
+			SELECT id, name, mobile, address, tax_id, branch_id, due_amount, store_credit, status,
 			       length, shoulder, bust, waist, hip, arm_hole,
 			       sleeve_length, sleeve_width, round_width,
 			       created_at, updated_at
@@ -274,7 +627,7 @@ func (s *CustomerRepo) GetCustomers(ctx context.Context, page, limit int, branch
 	for rows.Next() {
 		var c models.Customer
 		if err := rows.Scan(
-			&c.ID, &c.Name, &c.Mobile, &c.Address, &c.TaxID, &c.BranchID, &c.DueAmount, &c.Status,
+			&c.ID, &c.Name, &c.Mobile, &c.Address, &c.TaxID, &c.BranchID, &c.DueAmount, &c.StoreCredit, &c.Status,
 			&c.Length, &c.Shoulder, &c.Bust, &c.Waist, &c.Hip, &c.ArmHole,
 			&c.SleeveLength, &c.SleeveWidth, &c.RoundWidth,
 			&c.CreatedAt, &c.UpdatedAt,
@@ -317,7 +670,7 @@ func (s *CustomerRepo) GetCustomersNameAndID(ctx context.Context, branchID int64
 // 9. GetCustomersWithDue
 func (s *CustomerRepo) GetCustomersWithDue(ctx context.Context, branchID int64) ([]*models.Customer, error) {
 	query := `
-		SELECT id, name, mobile, address, tax_id, branch_id, due_amount, status,
+		SELECT id, name, mobile, address, tax_id, branch_id, due_amount, store_credit, status,
 		       length, shoulder, bust, waist, hip, arm_hole,
 		       sleeve_length, sleeve_width, round_width,
 		       created_at, updated_at
@@ -335,7 +688,7 @@ func (s *CustomerRepo) GetCustomersWithDue(ctx context.Context, branchID int64)
 	for rows.Next() {
 		var c models.Customer
 		if err := rows.Scan(
-			&c.ID, &c.Name, &c.Mobile, &c.Address, &c.TaxID, &c.BranchID, &c.DueAmount, &c.Status,
+			&c.ID, &c.Name, &c.Mobile, &c.Address, &c.TaxID, &c.BranchID, &c.DueAmount, &c.StoreCredit, &c.Status,
 			&c.Length, &c.Shoulder, &c.Bust, &c.Waist, &c.Hip, &c.ArmHole,
 			&c.SleeveLength, &c.SleeveWidth, &c.RoundWidth,
 			&c.CreatedAt, &c.UpdatedAt,
@@ -346,3 +699,104 @@ func (s *CustomerRepo) GetCustomersWithDue(ctx context.Context, branchID int64)
 	}
 	return customers, nil
 }
+
+// customerLedgerQuery lists what a customer was charged (orders and sales that
+// were not cancelled or returned) and the money that moved between the
+// customer and the branch. $1 customer, $2 branch, $3 entity type of customers.
+const customerLedgerQuery = `
+	WITH entries AS (
+		SELECT o.order_date AS entry_date, 1 AS seq, o.id AS entry_id, 'order' AS kind,
+		       o.memo_no AS reference,
+		       'Order of ' || o.total_products || ' item(s)' AS description,
+		       o.total_amount AS debit, 0::numeric AS credit
+		FROM orders o
+		WHERE o.customer_id = $1 AND o.branch_id = $2
+		  AND o.status NOT IN ('cancelled', 'returned')
+		UNION ALL
+		SELECT s.sale_date, 1, s.id, 'sale',
+		       s.memo_no,
+		       'Sale of ' || s.total_products || ' item(s)',
+		       s.total_amount, 0
+		FROM sales s
+		WHERE s.customer_id = $1 AND s.branch_id = $2
+		  AND s.status NOT IN ('cancelled', 'returned')
+		UNION ALL
+		SELECT t.transaction_date, 2, t.transaction_id,
+		       CASE t.transaction_type WHEN 'Refund' THEN 'refund' WHEN 'Adjustment' THEN 'adjustment' ELSE 'payment' END,
+		       t.memo_no,
+		       COALESCE(t.notes, ''),
+		       CASE WHEN t.to_entity_type = $3 AND t.to_entity_id = $1 THEN t.amount ELSE 0 END,
+		       CASE WHEN t.from_entity_type = $3 AND t.from_entity_id = $1 THEN t.amount ELSE 0 END
+		FROM transactions t
+		WHERE t.branch_id = $2
+		  AND ((t.from_entity_type = $3 AND t.from_entity_id = $1)
+		    OR (t.to_entity_type = $3 AND t.to_entity_id = $1))
+	)`
+
+// GetCustomerStatement builds the statement of account of a customer between
+// start and end (inclusive) with opening, running and closing balances.
+func (s *CustomerRepo) GetCustomerStatement(ctx context.Context, branchID, customerID int64, start, end time.Time) (*models.CustomerStatement, error) {
+	customer, err := s.GetCustomerByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil || customer.BranchID != branchID {
+		return nil, fmt.Errorf("customer with id %d not found in this branch", customerID)
+	}
+
+	st := &models.CustomerStatement{
+		Customer:    customer,
+		StartDate:   start,
+		EndDate:     end,
+		Lines:       []*models.StatementLine{},
+		GeneratedAt: time.Now(),
+	}
+	err = s.db.QueryRow(ctx, `SELECT name FROM branches WHERE id = $1`, branchID).Scan(&st.BranchName)
+	if err != nil {
+		return nil, fmt.Errorf("load branch failed: %w", err)
+	}
+
+	err = s.db.QueryRow(ctx, customerLedgerQuery+`
+		SELECT COALESCE(SUM(debit - credit), 0) FROM entries WHERE entry_date < $4
+	`, customerID, branchID, models.ENTITY_CUSTOMER, start).Scan(&st.OpeningBalance)
+	if err != nil {
+		return nil, fmt.Errorf("opening balance failed: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, customerLedgerQuery+`
+		SELECT entry_date, kind, reference, description, debit, credit
+		FROM entries
+		WHERE entry_date BETWEEN $4 AND $5
+		ORDER BY entry_date, seq, entry_id
+	`, customerID, branchID, models.ENTITY_CUSTOMER, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("load statement failed: %w", err)
+	}
+	defer rows.Close()
+
+	balance := st.OpeningBalance
+	for rows.Next() {
+		line := &models.StatementLine{}
+		err := rows.Scan(&line.Date, &line.Type, &line.Reference, &line.Description, &line.Debit, &line.Credit)
+		if err != nil {
+			return nil, fmt.Errorf("scan statement line failed: %w", err)
+		}
+		balance += line.Debit - line.Credit
+		line.Balance = balance
+		st.TotalDebit += line.Debit
+		st.TotalCredit += line.Credit
+		st.Lines = append(st.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("statement rows failed: %w", err)
+	}
+
+	st.ClosingBalance = st.OpeningBalance + st.TotalDebit - st.TotalCredit
+
+	// payments above what was charged sit in store credit; show how it moved
+	st.StoreCredit, err = s.GetStoreCredit(ctx, branchID, customerID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
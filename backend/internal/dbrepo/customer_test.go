@@ -0,0 +1,97 @@
+package dbrepo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+func openDocuments() map[string]*openDocument {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	list := []models.OpenDocument{
+		{DocumentType: models.DOCUMENT_SALE, DocumentID: 4, MemoNo: "S-4", DocumentDate: day(2), DueAmount: 5000},
+		{DocumentType: models.DOCUMENT_ORDER, DocumentID: 9, MemoNo: "O-9", DocumentDate: day(2), DueAmount: 7000},
+		{DocumentType: models.DOCUMENT_SALE, DocumentID: 2, MemoNo: "S-2", DocumentDate: day(1), DueAmount: 3000},
+	}
+	docs := make(map[string]*openDocument)
+	for _, d := range list {
+		docs[openDocumentKey(d.DocumentType, d.DocumentID)] = &openDocument{OpenDocument: d}
+	}
+	return docs
+}
+
+func TestAllocatePaymentOldestFirst(t *testing.T) {
+	got, err := allocatePayment(&models.CustomerPayment{Amount: 12000}, openDocuments())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// on the same day orders come before sales
+	want := []models.PaymentAllocation{
+		{DocumentType: models.DOCUMENT_SALE, DocumentID: 2, Amount: 3000},
+		{DocumentType: models.DOCUMENT_ORDER, DocumentID: 9, Amount: 7000},
+		{DocumentType: models.DOCUMENT_SALE, DocumentID: 4, Amount: 2000},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d allocations, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("allocation %d = %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+}
+
+func TestAllocatePaymentLeavesTheRest(t *testing.T) {
+	got, err := allocatePayment(&models.CustomerPayment{Amount: 20000}, openDocuments())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total money.Amount
+	for _, a := range got {
+		total += a.Amount
+	}
+	if len(got) != 3 || total != 15000 {
+		t.Errorf("allocated %s over %d documents, want 150.00 over 3", total, len(got))
+	}
+}
+
+func TestAllocatePaymentExplicit(t *testing.T) {
+	payment := &models.CustomerPayment{
+		Amount: 6000,
+		Allocations: []*models.PaymentAllocation{
+			{DocumentType: models.DOCUMENT_SALE, DocumentID: 4, Amount: 5000},
+		},
+	}
+	got, err := allocatePayment(payment, openDocuments())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Amount != 5000 {
+		t.Errorf("allocations = %+v, want the one given", got)
+	}
+}
+
+func TestAllocatePaymentErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      money.Amount
+		allocations []*models.PaymentAllocation
+	}{
+		{"unknown document", 100, []*models.PaymentAllocation{{DocumentType: models.DOCUMENT_ORDER, DocumentID: 4, Amount: 100}}},
+		{"allocated twice", 200, []*models.PaymentAllocation{
+			{DocumentType: models.DOCUMENT_SALE, DocumentID: 2, Amount: 100},
+			{DocumentType: models.DOCUMENT_SALE, DocumentID: 2, Amount: 100},
+		}},
+		{"zero allocation", 100, []*models.PaymentAllocation{{DocumentType: models.DOCUMENT_SALE, DocumentID: 2, Amount: 0}}},
+		{"over the due", 3001, []*models.PaymentAllocation{{DocumentType: models.DOCUMENT_SALE, DocumentID: 2, Amount: 3001}}},
+		{"over the payment", 1000, []*models.PaymentAllocation{{DocumentType: models.DOCUMENT_SALE, DocumentID: 2, Amount: 2000}}},
+	}
+	for _, tt := range tests {
+		payment := &models.CustomerPayment{Amount: tt.amount, Allocations: tt.allocations}
+		if _, err := allocatePayment(payment, openDocuments()); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ErrDiscountApprovalRequired is returned when the discounts given by hand on
+// an order or sale go over the branch threshold without a manager's approval.
+var ErrDiscountApprovalRequired = errors.New("discount approval required")
+
+// pricedLine is an item of an order or sale as far as discounts go
+type pricedLine struct {
+	subtotal money.Amount
+	discount *models.Discount
+}
+
+// validateDiscount checks the kind and value of a discount given by staff
+func validateDiscount(d *models.Discount) error {
+	if d == nil {
+		return nil
+	}
+	switch d.Type {
+	case models.DISCOUNT_PERCENT:
+		if d.Value < 0 || d.Value > money.FromInt(100) {
+			return fmt.Errorf("discount percentage must be between 0 and 100")
+		}
+	case models.DISCOUNT_FIXED:
+		if d.Value < 0 {
+			return fmt.Errorf("discount cannot be negative")
+		}
+	default:
+		return fmt.Errorf("discount type must be %q or %q", models.DISCOUNT_PERCENT, models.DISCOUNT_FIXED)
+	}
+	return nil
+}
+
+// discountOf returns what d takes off base; a fixed discount never exceeds base
+func discountOf(base money.Amount, d *models.Discount) money.Amount {
+	if d == nil || base <= 0 {
+		return 0
+	}
+	if d.Type == models.DISCOUNT_PERCENT {
+		// the percentage is kept in hundredths, like an amount
+		return base.MulFrac(d.Value.Cents(), 100*100)
+	}
+	return money.Min(d.Value, base)
+}
+
+// applyDiscountsTx works out the discounts of an order or sale of a branch
+// and returns the discount of every line and the net total. total is the
+// total amount as sent, kept when no discount is given at all.
+//
+// The promotion (or the coupon that names it) is checked against its dates,
+// branch and usage limits. On an edit, old holds the discounts recorded with
+// the document: its promotion and coupon stay and are not checked again.
+// Promotions are set by managers beforehand and do not count towards the
+// approval threshold; line and document discounts do.
+func applyDiscountsTx(ctx context.Context, tx pgx.Tx, branchID, customerID int64, date time.Time, d *models.DocumentDiscounts, lines []pricedLine, total money.Amount, old *models.DocumentDiscounts) ([]money.Amount, money.Amount, error) {
+	if old != nil {
+		d.PromotionID, d.CouponID, d.CouponCode = old.PromotionID, old.CouponID, old.CouponCode
+	}
+	d.CouponCode = strings.TrimSpace(d.CouponCode)
+
+	// --------------------
+	// 1. Line discounts
+	// --------------------
+	var gross money.Amount
+	discounted := d.Discount != nil || d.PromotionID != nil || d.CouponCode != ""
+	lineAmounts := make([]money.Amount, len(lines))
+	for i, l := range lines {
+		if err := validateDiscount(l.discount); err != nil {
+			return nil, 0, err
+		}
+		if l.subtotal < 0 {
+			return nil, 0, fmt.Errorf("item subtotal cannot be negative")
+		}
+		gross += l.subtotal
+		lineAmounts[i] = discountOf(l.subtotal, l.discount)
+		discounted = discounted || l.discount != nil
+	}
+	if err := validateDiscount(d.Discount); err != nil {
+		return nil, 0, err
+	}
+
+	d.LineDiscount, d.DocumentDiscount, d.PromotionDiscount = 0, 0, 0
+	if !discounted {
+		d.GrossAmount, d.DiscountAmount, d.DiscountApproval = total, 0, nil
+		return lineAmounts, total, nil
+	}
+	if gross == 0 {
+		return nil, 0, fmt.Errorf("item subtotals are required to give a discount")
+	}
+	for _, a := range lineAmounts {
+		d.LineDiscount += a
+	}
+
+	// --------------------
+	// 2. Document discount
+	// --------------------
+	d.DocumentDiscount = discountOf(gross-d.LineDiscount, d.Discount)
+	remaining := gross - d.LineDiscount - d.DocumentDiscount
+
+	// --------------------
+	// 3. Coupon and promotion
+	// --------------------
+	if d.CouponCode != "" && old == nil {
+		couponID, promotionID, err := checkCouponTx(ctx, tx, customerID, d.CouponCode)
+		if err != nil {
+			return nil, 0, err
+		}
+		if d.PromotionID != nil && *d.PromotionID != promotionID {
+			return nil, 0, fmt.Errorf("coupon %s is not part of promotion %d", d.CouponCode, *d.PromotionID)
+		}
+		d.CouponID, d.PromotionID = &couponID, &promotionID
+	}
+	if d.PromotionID != nil {
+		var (
+			p       models.Promotion
+			scopeID *int64
+		)
+		err := tx.QueryRow(ctx, `
+			SELECT name, branch_id, discount_type, discount_value, starts_on, ends_on, requires_coupon, active
+			FROM promotions
+			WHERE id = $1
+		`, *d.PromotionID).Scan(&p.Name, &scopeID, &p.DiscountType, &p.DiscountValue, &p.StartsOn, &p.EndsOn, &p.RequiresCoupon, &p.Active)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, 0, fmt.Errorf("promotion with id %d not found", *d.PromotionID)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("load promotion failed: %w", err)
+		}
+		if old == nil {
+			switch {
+			case !p.Active:
+				return nil, 0, fmt.Errorf("promotion %s is not active", p.Name)
+			case scopeID != nil && *scopeID != branchID:
+				return nil, 0, fmt.Errorf("promotion %s does not run in this branch", p.Name)
+			case date.Before(p.StartsOn) || date.After(p.EndsOn):
+				return nil, 0, fmt.Errorf("promotion %s runs from %s to %s", p.Name,
+					p.StartsOn.Format("2006-01-02"), p.EndsOn.Format("2006-01-02"))
+			case p.RequiresCoupon && d.CouponID == nil:
+				return nil, 0, fmt.Errorf("promotion %s needs a coupon code", p.Name)
+			}
+		}
+		d.PromotionDiscount = discountOf(remaining, &models.Discount{Type: p.DiscountType, Value: p.DiscountValue})
+	}
+
+	d.GrossAmount = gross
+	d.DiscountAmount = d.LineDiscount + d.DocumentDiscount + d.PromotionDiscount
+
+	// --------------------
+	// 4. Manager approval above the branch threshold
+	// --------------------
+	var threshold *money.Amount
+	err := tx.QueryRow(ctx, `SELECT discount_approval_percent FROM branches WHERE id = $1`, branchID).Scan(&threshold)
+	if err != nil {
+		return nil, 0, fmt.Errorf("load discount threshold failed: %w", err)
+	}
+	manual := d.LineDiscount + d.DocumentDiscount
+	if d.DiscountApproval == nil && old != nil && old.DiscountApproval != nil && manual <= old.LineDiscount+old.DocumentDiscount {
+		// an edit that gives no more than was approved keeps the approval
+		d.DiscountApproval = old.DiscountApproval
+	}
+	if threshold == nil || manual == 0 || manual <= discountOf(gross, &models.Discount{Type: models.DISCOUNT_PERCENT, Value: *threshold}) {
+		d.DiscountApproval = nil
+	} else if d.DiscountApproval == nil || d.DiscountApproval.ApprovedBy == 0 {
+		return nil, 0, fmt.Errorf("%w: %s off %s is more than %s%%; a manager must approve it",
+			ErrDiscountApprovalRequired, manual, gross, *threshold)
+	}
+
+	return lineAmounts, gross - d.DiscountAmount, nil
+}
+
+// applyOrderDiscountsTx works out the discounts of an order and sets its
+// line discounts and total; oldOrder is the order being edited, if any
+func applyOrderDiscountsTx(ctx context.Context, tx pgx.Tx, order, oldOrder *models.OrderDB) error {
+	lines := make([]pricedLine, len(order.Items))
+	for i, item := range order.Items {
+		lines[i] = pricedLine{subtotal: item.Subtotal, discount: item.Discount}
+	}
+	var old *models.DocumentDiscounts
+	if oldOrder != nil {
+		old = &oldOrder.DocumentDiscounts
+	}
+	amounts, total, err := applyDiscountsTx(ctx, tx, order.BranchID, order.CustomerID, order.OrderDate,
+		&order.DocumentDiscounts, lines, order.TotalAmount, old)
+	if err != nil {
+		return err
+	}
+	for i := range order.Items {
+		order.Items[i].DiscountAmount = amounts[i]
+	}
+	order.TotalAmount = total
+	return nil
+}
+
+// applySaleDiscountsTx works out the discounts of a sale and sets its line
+// discounts and total; oldSale is the sale being edited, if any
+func applySaleDiscountsTx(ctx context.Context, tx pgx.Tx, sale, oldSale *models.SaleDB) error {
+	lines := make([]pricedLine, len(sale.Items))
+	for i, item := range sale.Items {
+		lines[i] = pricedLine{subtotal: item.Subtotal, discount: item.Discount}
+	}
+	var old *models.DocumentDiscounts
+	if oldSale != nil {
+		old = &oldSale.DocumentDiscounts
+	}
+	amounts, total, err := applyDiscountsTx(ctx, tx, sale.BranchID, sale.CustomerID, sale.SaleDate,
+		&sale.DocumentDiscounts, lines, sale.TotalAmount, old)
+	if err != nil {
+		return err
+	}
+	for i := range sale.Items {
+		sale.Items[i].DiscountAmount = amounts[i]
+	}
+	sale.TotalAmount = total
+	return nil
+}
+
+// checkCouponTx locks a coupon by its code and verifies that it can still be
+// used by the customer. It returns the coupon and its promotion.
+func checkCouponTx(ctx context.Context, tx pgx.Tx, customerID int64, code string) (int64, int64, error) {
+	var (
+		couponID, promotionID      int64
+		active                     bool
+		maxUses, maxUsesByCustomer *int
+	)
+	err := tx.QueryRow(ctx, `
+		SELECT id, promotion_id, active, max_uses, max_uses_per_customer
+		FROM coupons
+		WHERE UPPER(code) = UPPER($1)
+		FOR UPDATE
+	`, code).Scan(&couponID, &promotionID, &active, &maxUses, &maxUsesByCustomer)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, fmt.Errorf("coupon %s not found", code)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("load coupon failed: %w", err)
+	}
+	if !active {
+		return 0, 0, fmt.Errorf("coupon %s is no longer valid", code)
+	}
+
+	var used, usedByCustomer int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE customer_id = $2)
+		FROM coupon_redemptions
+		WHERE coupon_id = $1
+	`, couponID, customerID).Scan(&used, &usedByCustomer)
+	if err != nil {
+		return 0, 0, fmt.Errorf("count coupon uses failed: %w", err)
+	}
+	if maxUses != nil && used >= *maxUses {
+		return 0, 0, fmt.Errorf("coupon %s has been used up", code)
+	}
+	if maxUsesByCustomer != nil && usedByCustomer >= *maxUsesByCustomer {
+		return 0, 0, fmt.Errorf("coupon %s was already used by this customer", code)
+	}
+	return couponID, promotionID, nil
+}
+
+// saveDocumentDiscountsTx writes the discounts of an order or sale and
+// records (or updates) the use of its coupon
+func saveDocumentDiscountsTx(ctx context.Context, tx pgx.Tx, docType string, docID, branchID, customerID int64, memoNo string, date time.Time, d *models.DocumentDiscounts) error {
+	table := "orders"
+	if docType == models.DOCUMENT_SALE {
+		table = "sales"
+	}
+	var (
+		discountType  *string
+		discountValue *money.Amount
+		approvedBy    *int64
+		reason        *string
+	)
+	if d.Discount != nil {
+		discountType, discountValue = &d.Discount.Type, &d.Discount.Value
+	}
+	if d.DiscountApproval != nil {
+		approvedBy, reason = &d.DiscountApproval.ApprovedBy, &d.DiscountApproval.Reason
+	}
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		UPDATE %s SET
+			gross_amount = $2, discount_type = $3, discount_value = $4,
+			line_discount = $5, document_discount = $6,
+			promotion_id = $7, promotion_discount = $8, coupon_id = $9,
+			discount_amount = $10, discount_approved_by = $11, discount_approval_reason = $12
+		WHERE id = $1
+	`, table), docID, d.GrossAmount, discountType, discountValue,
+		d.LineDiscount, d.DocumentDiscount,
+		d.PromotionID, d.PromotionDiscount, d.CouponID,
+		d.DiscountAmount, approvedBy, reason,
+	)
+	if err != nil {
+		return fmt.Errorf("save %s discounts failed: %w", docType, err)
+	}
+
+	if d.CouponID == nil {
+		return nil
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO coupon_redemptions (coupon_id, branch_id, customer_id, document_type, document_id, memo_no, discount_amount, redeemed_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (document_type, document_id) DO UPDATE
+		SET customer_id = EXCLUDED.customer_id, memo_no = EXCLUDED.memo_no,
+		    discount_amount = EXCLUDED.discount_amount, redeemed_on = EXCLUDED.redeemed_on
+	`, *d.CouponID, branchID, customerID, docType, docID, memoNo, d.PromotionDiscount, date)
+	if err != nil {
+		return fmt.Errorf("record coupon use failed: %w", err)
+	}
+	return nil
+}
+
+// releaseCouponTx frees the coupon use of a cancelled order or sale
+func releaseCouponTx(ctx context.Context, tx pgx.Tx, docType string, docID int64) error {
+	_, err := tx.Exec(ctx, `DELETE FROM coupon_redemptions WHERE document_type = $1 AND document_id = $2`, docType, docID)
+	if err != nil {
+		return fmt.Errorf("release coupon failed: %w", err)
+	}
+	return nil
+}
+
+// loadDocumentDiscounts reads the discounts recorded with an order or sale
+func loadDocumentDiscounts(ctx context.Context, q rowQueryer, docType string, docID int64, d *models.DocumentDiscounts) error {
+	table := "orders"
+	if docType == models.DOCUMENT_SALE {
+		table = "sales"
+	}
+	var (
+		discountType  *string
+		discountValue *money.Amount
+		approvedBy    *int64
+		reason        *string
+		couponCode    *string
+	)
+	err := q.QueryRow(ctx, fmt.Sprintf(`
+		SELECT d.gross_amount, d.discount_type, d.discount_value,
+		       d.line_discount, d.document_discount,
+		       d.promotion_id, d.promotion_discount, d.coupon_id, c.code,
+		       d.discount_amount, d.discount_approved_by, d.discount_approval_reason
+		FROM %s d
+		LEFT JOIN coupons c ON c.id = d.coupon_id
+		WHERE d.id = $1
+	`, table), docID).Scan(&d.GrossAmount, &discountType, &discountValue,
+		&d.LineDiscount, &d.DocumentDiscount,
+		&d.PromotionID, &d.PromotionDiscount, &d.CouponID, &couponCode,
+		&d.DiscountAmount, &approvedBy, &reason,
+	)
+	if err != nil {
+		return fmt.Errorf("load %s discounts failed: %w", docType, err)
+	}
+	d.Discount = itemDiscount(discountType, discountValue)
+	if approvedBy != nil {
+		d.DiscountApproval = &models.DiscountApproval{ApprovedBy: *approvedBy, Reason: *reason}
+	}
+	if couponCode != nil {
+		d.CouponCode = *couponCode
+	}
+	return nil
+}
+
+// itemDiscount rebuilds a discount from its nullable columns
+func itemDiscount(discountType *string, value *money.Amount) *models.Discount {
+	if discountType == nil || value == nil {
+		return nil
+	}
+	return &models.Discount{Type: *discountType, Value: *value}
+}
+
+// discountColumns splits a discount into the values stored on items
+func discountColumns(d *models.Discount) (discountType *string, value *money.Amount) {
+	if d == nil {
+		return nil, nil
+	}
+	return &d.Type, &d.Value
+}
+
+// GetDiscountReport sums the gross, discount and net amounts of the sales and
+// orders of a branch made in a period, with what each promotion gave away.
+// Cancelled and returned documents are left out.
+func (r *ReportRepo) GetDiscountReport(ctx context.Context, branchID int64, startDate, endDate time.Time) (*models.DiscountReport, error) {
+	report := &models.DiscountReport{
+		BranchID:   branchID,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		Promotions: []*models.PromotionUsage{},
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT 'sale', COUNT(*), COALESCE(SUM(gross_amount), 0), COALESCE(SUM(line_discount), 0),
+		       COALESCE(SUM(document_discount), 0), COALESCE(SUM(promotion_discount), 0),
+		       COALESCE(SUM(discount_amount), 0), COALESCE(SUM(total_amount), 0),
+		       COUNT(discount_approved_by)
+		FROM sales
+		WHERE branch_id = $1
+		  AND status NOT IN ('cancelled', 'returned')
+		  AND sale_date BETWEEN $2::date AND $3::date
+
+		UNION ALL
+		SELECT 'order', COUNT(*), COALESCE(SUM(gross_amount), 0), COALESCE(SUM(line_discount), 0),
+		       COALESCE(SUM(document_discount), 0), COALESCE(SUM(promotion_discount), 0),
+		       COALESCE(SUM(discount_amount), 0), COALESCE(SUM(total_amount), 0),
+		       COUNT(discount_approved_by)
+		FROM orders
+		WHERE branch_id = $1
+		  AND status NOT IN ('cancelled', 'returned')
+		  AND order_date BETWEEN $2::date AND $3::date
+	`, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("discount report query failed: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			kind     string
+			t        models.DiscountTotals
+			approved int64
+		)
+		err := rows.Scan(&kind, &t.Documents, &t.GrossAmount, &t.LineDiscount,
+			&t.DocumentDiscount, &t.PromotionDiscount, &t.DiscountAmount, &t.NetAmount, &approved)
+		if err != nil {
+			return nil, fmt.Errorf("scan discount totals failed: %w", err)
+		}
+		if kind == "sale" {
+			report.Sales = t
+		} else {
+			report.Orders = t
+		}
+		report.Approved += approved
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("discount report rows failed: %w", err)
+	}
+	rows.Close()
+
+	s, o := report.Sales, report.Orders
+	report.Total = models.DiscountTotals{
+		Documents:         s.Documents + o.Documents,
+		GrossAmount:       s.GrossAmount + o.GrossAmount,
+		LineDiscount:      s.LineDiscount + o.LineDiscount,
+		DocumentDiscount:  s.DocumentDiscount + o.DocumentDiscount,
+		PromotionDiscount: s.PromotionDiscount + o.PromotionDiscount,
+		DiscountAmount:    s.DiscountAmount + o.DiscountAmount,
+		NetAmount:         s.NetAmount + o.NetAmount,
+	}
+
+	rows, err = r.db.Query(ctx, `
+		SELECT p.id, p.name, COUNT(*), COUNT(d.coupon_id), SUM(d.promotion_discount)
+		FROM (
+			SELECT promotion_id, coupon_id, promotion_discount
+			FROM sales
+			WHERE branch_id = $1
+			  AND status NOT IN ('cancelled', 'returned')
+			  AND sale_date BETWEEN $2::date AND $3::date
+			UNION ALL
+			SELECT promotion_id, coupon_id, promotion_discount
+			FROM orders
+			WHERE branch_id = $1
+			  AND status NOT IN ('cancelled', 'returned')
+			  AND order_date BETWEEN $2::date AND $3::date
+		) d
+		JOIN promotions p ON p.id = d.promotion_id
+		GROUP BY p.id, p.name
+		ORDER BY SUM(d.promotion_discount) DESC, p.name
+	`, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("promotion usage query failed: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u models.PromotionUsage
+		if err := rows.Scan(&u.PromotionID, &u.Name, &u.Documents, &u.CouponUses, &u.DiscountAmount); err != nil {
+			return nil, fmt.Errorf("scan promotion usage failed: %w", err)
+		}
+		report.Promotions = append(report.Promotions, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("promotion usage rows failed: %w", err)
+	}
+	return report, nil
+}
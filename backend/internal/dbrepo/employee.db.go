@@ -10,7 +10,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
-	"github.com/projuktisheba/erp-mini-api/internal/utils"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
 )
 
 // ============================== Employee Repository ==============================
@@ -194,10 +194,61 @@ func (user *EmployeeRepo) UpdateEmployeeAvatarLink(ctx context.Context, id int,
 	return err
 }
 
+// legacyAvatarLink matches avatar links saved before pictures moved into the
+// file store: /images/… or /api/v1/images/…
+const legacyAvatarLink = `^(/api/v1)?/images/`
+
+// RewriteAvatarLinks points legacy avatar links at /api/v1/files/images/….
+// Without apply it only counts them.
+func (user *EmployeeRepo) RewriteAvatarLinks(ctx context.Context, apply bool) (int64, error) {
+	if !apply {
+		var n int64
+		err := user.db.QueryRow(ctx, `SELECT COUNT(*) FROM employees WHERE avatar_link ~ $1`, legacyAvatarLink).Scan(&n)
+		if err != nil {
+			return 0, fmt.Errorf("count avatar links failed: %w", err)
+		}
+		return n, nil
+	}
+	tag, err := user.db.Exec(ctx, `
+		UPDATE employees
+		SET avatar_link = regexp_replace(avatar_link, $1, '/api/v1/files/images/'), updated_at = CURRENT_TIMESTAMP
+		WHERE avatar_link ~ $1
+	`, legacyAvatarLink)
+	if err != nil {
+		return 0, fmt.Errorf("rewrite avatar links failed: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// progressMemoTx returns the memo number the salary or advance payments of an
+// employees_progress row are recorded under, taking the next salary number the
+// first time. column is salary_memo_no or advance_memo_no.
+func progressMemoTx(ctx context.Context, tx pgx.Tx, progressID int64, column string) (string, error) {
+	var memoNo *string
+	var branchID int64
+	var sheetDate time.Time
+	err := tx.QueryRow(ctx, `SELECT `+column+`, branch_id, sheet_date FROM employees_progress WHERE id=$1 FOR UPDATE`, progressID).
+		Scan(&memoNo, &branchID, &sheetDate)
+	if err != nil {
+		return "", fmt.Errorf("load progress memo: %w", err)
+	}
+	if memoNo != nil && *memoNo != "" {
+		return *memoNo, nil
+	}
+	next, err := NextMemoNoTx(ctx, tx, branchID, models.MEMO_SALARY, sheetDate)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE employees_progress SET `+column+`=$1 WHERE id=$2`, next, progressID); err != nil {
+		return "", fmt.Errorf("save progress memo: %w", err)
+	}
+	return next, nil
+}
+
 // (V2)
 // SaveSalaryRecord generates and give employee salary
 // Call this function if the role of the token user is Admin
-func (user *EmployeeRepo) SaveSalaryRecord(ctx context.Context, salaryDate time.Time, employeeID, branchID, accountID int64, amount float64) error {
+func (user *EmployeeRepo) SaveSalaryRecord(ctx context.Context, salaryDate time.Time, employeeID, branchID, accountID int64, amount money.Amount) error {
 	//using pgxpool begin a transaction
 	tx, err := user.db.Begin(ctx)
 	if err != nil {
@@ -205,6 +256,10 @@ func (user *EmployeeRepo) SaveSalaryRecord(ctx context.Context, salaryDate time.
 	}
 	defer tx.Rollback(ctx)
 
+	if err := EnsurePeriodOpenTx(ctx, tx, branchID, salaryDate); err != nil {
+		return err
+	}
+
 	employeeSalary := &models.EmployeeProgressDB{
 		SheetDate:  salaryDate,
 		BranchID:   branchID,
@@ -228,10 +283,14 @@ func (user *EmployeeRepo) SaveSalaryRecord(ctx context.Context, salaryDate time.
 		return fmt.Errorf("save topsheet: %w", err)
 	}
 
+	memoNo, err := progressMemoTx(ctx, tx, id, "salary_memo_no")
+	if err != nil {
+		return err
+	}
 	//insert transaction
 	transaction := &models.Transaction{
 		TransactionDate: salaryDate,
-		MemoNo:          utils.GetSalaryMemo(id),
+		MemoNo:          memoNo,
 		BranchID:        branchID,
 		FromID:          accountID,
 		FromType:        models.ENTITY_ACCOUNT,
@@ -254,7 +313,7 @@ func (user *EmployeeRepo) SaveSalaryRecord(ctx context.Context, salaryDate time.
 // (V2)
 // UpdateSalaryRecord generates and give employee salary
 // Call this function if the role of the token user is Admin
-func (user *EmployeeRepo) UpdateSalaryRecord(ctx context.Context, salaryDate time.Time, salaryID, employeeID, branchID, accountID int64, amount float64) error {
+func (user *EmployeeRepo) UpdateSalaryRecord(ctx context.Context, salaryDate time.Time, salaryID, employeeID, branchID, accountID int64, amount money.Amount) error {
 	//using pgxpool begin a transaction
 	tx, err := user.db.Begin(ctx)
 	if err != nil {
@@ -273,6 +332,15 @@ func (user *EmployeeRepo) UpdateSalaryRecord(ctx context.Context, salaryDate tim
 		&oldSalaryInfo.EmployeeID,
 		&oldSalaryInfo.TotalSalary,
 	)
+	if err != nil {
+		return fmt.Errorf("load salary record: %w", err)
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, oldSalaryInfo.BranchID, oldSalaryInfo.SheetDate); err != nil {
+		return err
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, branchID, salaryDate); err != nil {
+		return err
+	}
 	//-------------------------------------
 	// 2. Employee Progress Table
 	//-------------------------------------
@@ -326,12 +394,16 @@ func (user *EmployeeRepo) UpdateSalaryRecord(ctx context.Context, salaryDate tim
 	}
 
 	//delete old transaction
-	err = DeleteTransactionByBranchMemoTx(ctx, tx, utils.GetSalaryMemo(oldSalaryInfo.ID), oldSalaryInfo.BranchID)
+	memoNo, err := progressMemoTx(ctx, tx, oldSalaryInfo.ID, "salary_memo_no")
+	if err != nil {
+		return err
+	}
+	err = DeleteTransactionByBranchMemoTx(ctx, tx, memoNo, oldSalaryInfo.BranchID)
 	//insert new transaction if amount > 0
 	if amount > 0 {
 		transaction := &models.Transaction{
 			TransactionDate: salaryDate,
-			MemoNo:          utils.GetSalaryMemo(oldSalaryInfo.ID),
+			MemoNo:          memoNo,
 			BranchID:        branchID,
 			FromID:          accountID,
 			FromType:        models.ENTITY_ACCOUNT,
@@ -359,6 +431,10 @@ func (e *EmployeeRepo) SaveWorkerProgress(ctx context.Context, workerProgress mo
 	}
 	defer tx.Rollback(ctx)
 
+	if err := EnsurePeriodOpenTx(ctx, tx, workerProgress.BranchID, workerProgress.SheetDate); err != nil {
+		return err
+	}
+
 	workerProgressDB := &models.EmployeeProgressDB{
 		SheetDate:       workerProgress.SheetDate,
 		BranchID:        workerProgress.BranchID,
@@ -383,11 +459,15 @@ func (e *EmployeeRepo) SaveWorkerProgress(ctx context.Context, workerProgress mo
 			return err
 		}
 
+		memoNo, err := progressMemoTx(ctx, tx, id, "advance_memo_no")
+		if err != nil {
+			return err
+		}
 		//insert transaction
 		transaction := &models.Transaction{
 			TransactionDate: workerProgress.SheetDate,
 			BranchID:        workerProgress.BranchID,
-			MemoNo:          utils.GetAdvanceSalaryMemo(id),
+			MemoNo:          memoNo,
 			FromID:          workerProgress.BranchID,
 			FromType:        models.ENTITY_ACCOUNT,
 			ToID:            workerProgress.EmployeeID,
@@ -425,6 +505,15 @@ func (user *EmployeeRepo) UpdateWorkerProgress(ctx context.Context, progressID i
 		&oldProgressRecord.OvertimeHours,
 		&oldProgressRecord.ProductionUnits,
 	)
+	if err != nil {
+		return fmt.Errorf("load progress record: %w", err)
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, oldProgressRecord.BranchID, oldProgressRecord.SheetDate); err != nil {
+		return err
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, newProgressRecord.BranchID, newProgressRecord.SheetDate); err != nil {
+		return err
+	}
 	//-------------------------------------
 	// 2. Employee Progress Table
 	//-------------------------------------
@@ -480,15 +569,21 @@ func (user *EmployeeRepo) UpdateWorkerProgress(ctx context.Context, progressID i
 	}
 
 	//delete old transaction
+	var memoNo string
+	if oldProgressRecord.AdvancePayment > 0 || newProgressRecord.AdvancePayment > 0 {
+		if memoNo, err = progressMemoTx(ctx, tx, oldProgressRecord.ID, "advance_memo_no"); err != nil {
+			return err
+		}
+	}
 	if oldProgressRecord.AdvancePayment > 0 {
-		err = DeleteTransactionByBranchMemoTx(ctx, tx, utils.GetAdvanceSalaryMemo(oldProgressRecord.ID), oldProgressRecord.BranchID)
+		err = DeleteTransactionByBranchMemoTx(ctx, tx, memoNo, oldProgressRecord.BranchID)
 	}
 
 	//insert new transaction if amount > 0
 	if newProgressRecord.AdvancePayment > 0 {
 		transaction := &models.Transaction{
 			TransactionDate: newProgressRecord.SheetDate,
-			MemoNo:          utils.GetAdvanceSalaryMemo(oldProgressRecord.ID),
+			MemoNo:          memoNo,
 			BranchID:        newProgressRecord.BranchID,
 			FromID:          newProgressRecord.PaymentAccountID,
 			FromType:        models.ENTITY_ACCOUNT,
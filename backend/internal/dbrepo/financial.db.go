@@ -0,0 +1,780 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// GetProfitAndLoss builds the accrual-basis income statement of a branch for the
+// given period, together with the period of equal length right before it.
+// branchID 0 gives the consolidated statement with a per-branch breakdown.
+func (r *ReportRepo) GetProfitAndLoss(ctx context.Context, branchID int64, startDate, endDate time.Time) (*models.ProfitAndLoss, error) {
+	prevEnd := startDate.AddDate(0, 0, -1)
+	prevStart := prevEnd.Add(-endDate.Sub(startDate))
+
+	current, err := r.profitAndLossByBranch(ctx, branchID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := r.profitAndLossByBranch(ctx, branchID, prevStart, prevEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	branches, err := r.reportBranches(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// Single branch
+	// --------------------
+	if branchID != 0 {
+		return newProfitAndLoss(branchID, branches[0].name,
+			periodOrEmpty(current[branchID], startDate, endDate),
+			periodOrEmpty(previous[branchID], prevStart, prevEnd),
+		), nil
+	}
+
+	// --------------------
+	// Consolidated
+	// --------------------
+	var breakdown []*models.ProfitAndLoss
+	totalCur := &models.ProfitAndLossPeriod{StartDate: startDate, EndDate: endDate}
+	totalPrev := &models.ProfitAndLossPeriod{StartDate: prevStart, EndDate: prevEnd}
+	for _, b := range branches {
+		cur := periodOrEmpty(current[b.id], startDate, endDate)
+		prev := periodOrEmpty(previous[b.id], prevStart, prevEnd)
+		addProfitAndLossPeriod(totalCur, cur)
+		addProfitAndLossPeriod(totalPrev, prev)
+		breakdown = append(breakdown, newProfitAndLoss(b.id, b.name, cur, prev))
+	}
+
+	pl := newProfitAndLoss(0, consolidatedBranchName, finishProfitAndLossPeriod(totalCur), finishProfitAndLossPeriod(totalPrev))
+	pl.Branches = breakdown
+	return pl, nil
+}
+
+// consolidatedBranchName labels reports that cover every branch
+const consolidatedBranchName = "All branches"
+
+// reportBranch identifies a branch on a financial report
+type reportBranch struct {
+	id   int64
+	name string
+}
+
+// reportBranches loads the branch (or every branch when branchID is 0) a report covers
+func (r *ReportRepo) reportBranches(ctx context.Context, branchID int64) ([]reportBranch, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, name FROM branches WHERE ($1::bigint = 0 OR id = $1) ORDER BY id`, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("load branches failed: %w", err)
+	}
+	defer rows.Close()
+
+	var branches []reportBranch
+	for rows.Next() {
+		var b reportBranch
+		if err := rows.Scan(&b.id, &b.name); err != nil {
+			return nil, fmt.Errorf("scan branch failed: %w", err)
+		}
+		branches = append(branches, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("branch rows failed: %w", err)
+	}
+	if branchID != 0 && len(branches) == 0 {
+		return nil, fmt.Errorf("branch %d not found", branchID)
+	}
+	return branches, nil
+}
+
+// profitAndLossByBranch computes the income statement of every branch (or only
+// branchID when it is not 0) for one period.
+//
+//   - sales revenue: ready-made sales that were not cancelled or returned, by sale date
+//   - order revenue: the share of the order value delivered on each delivery date
+//   - discounts: given on that revenue, shared out the same way; revenue is net of them
+//   - tax charged on sales and orders and paid on purchases is left out of revenue and costs
+//   - cost of goods: material purchases plus sold units x product unit cost (where known)
+//   - expenses: purchases other than material and stock, by category, plus
+//     adjustments with suppliers and employees
+//   - salaries: salaries and advances paid to employees
+func (r *ReportRepo) profitAndLossByBranch(ctx context.Context, branchID int64, startDate, endDate time.Time) (map[int64]*models.ProfitAndLossPeriod, error) {
+	query := `
+		SELECT branch_id, 'sales', '', SUM(total_amount - tax_amount)::numeric, 0::bigint
+		FROM sales
+		WHERE ($1::bigint = 0 OR branch_id = $1)
+		  AND status NOT IN ('cancelled', 'returned')
+		  AND sale_date BETWEEN $2::date AND $3::date
+		GROUP BY branch_id
+
+		UNION ALL
+		SELECT o.branch_id, 'orders', '',
+		       ROUND(SUM((o.total_amount - o.tax_amount) * ot.quantity_delivered / NULLIF(o.total_products, 0)), 2), 0::bigint
+		FROM order_transactions ot
+		JOIN orders o ON o.id = ot.order_id
+		WHERE ($1::bigint = 0 OR o.branch_id = $1)
+		  AND o.status NOT IN ('cancelled', 'returned')
+		  AND ot.quantity_delivered > 0
+		  AND ot.transaction_date BETWEEN $2::date AND $3::date
+		GROUP BY o.branch_id
+
+		UNION ALL
+		SELECT branch_id, 'discounts', '', SUM(discount_amount)::numeric, 0::bigint
+		FROM sales
+		WHERE ($1::bigint = 0 OR branch_id = $1)
+		  AND status NOT IN ('cancelled', 'returned')
+		  AND sale_date BETWEEN $2::date AND $3::date
+		GROUP BY branch_id
+
+		UNION ALL
+		SELECT o.branch_id, 'discounts', '',
+		       ROUND(SUM(o.discount_amount * ot.quantity_delivered / NULLIF(o.total_products, 0)), 2), 0::bigint
+		FROM order_transactions ot
+		JOIN orders o ON o.id = ot.order_id
+		WHERE ($1::bigint = 0 OR o.branch_id = $1)
+		  AND o.status NOT IN ('cancelled', 'returned')
+		  AND o.discount_amount > 0
+		  AND ot.quantity_delivered > 0
+		  AND ot.transaction_date BETWEEN $2::date AND $3::date
+		GROUP BY o.branch_id
+
+		UNION ALL
+		SELECT s.branch_id, 'stock_cost', '',
+		       COALESCE(SUM(si.quantity * p.unit_cost), 0)::numeric,
+		       COALESCE(SUM(si.quantity) FILTER (WHERE p.unit_cost IS NULL), 0)::bigint
+		FROM sale_items si
+		JOIN sales s ON s.id = si.sale_id
+		JOIN products p ON p.id = si.product_id
+		WHERE ($1::bigint = 0 OR s.branch_id = $1)
+		  AND s.status NOT IN ('cancelled', 'returned')
+		  AND s.sale_date BETWEEN $2::date AND $3::date
+		GROUP BY s.branch_id
+
+		UNION ALL
+		SELECT branch_id, 'purchase', category, SUM(total_amount - tax_amount)::numeric, 0::bigint
+		FROM purchase
+		WHERE ($1::bigint = 0 OR branch_id = $1)
+		  AND category <> 'stock'
+		  AND purchase_date BETWEEN $2::date AND $3::date
+		GROUP BY branch_id, category
+
+		UNION ALL
+		SELECT branch_id, 'salaries', '', SUM(amount)::numeric, 0::bigint
+		FROM transactions
+		WHERE ($1::bigint = 0 OR branch_id = $1)
+		  AND to_entity_type = 'employees'
+		  AND transaction_type IN ('Salary', 'Advance Payment')
+		  AND transaction_date BETWEEN $2::date AND $3::date
+		GROUP BY branch_id
+
+		UNION ALL
+		SELECT branch_id, 'purchase', 'adjustment',
+		       SUM(CASE WHEN to_entity_type IN ('suppliers', 'employees') THEN amount ELSE -amount END)::numeric, 0::bigint
+		FROM transactions
+		WHERE ($1::bigint = 0 OR branch_id = $1)
+		  AND transaction_type = 'Adjustment'
+		  AND (to_entity_type IN ('suppliers', 'employees') OR from_entity_type IN ('suppliers', 'employees'))
+		  AND transaction_date BETWEEN $2::date AND $3::date
+		GROUP BY branch_id
+	`
+	rows, err := r.db.Query(ctx, query, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("profit and loss query failed: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[int64]*models.ProfitAndLossPeriod)
+	expenses := make(map[int64]map[string]money.Amount)
+	for rows.Next() {
+		var (
+			id       int64
+			kind     string
+			category string
+			amount   money.Amount
+			units    int64
+		)
+		if err := rows.Scan(&id, &kind, &category, &amount, &units); err != nil {
+			return nil, fmt.Errorf("scan profit and loss failed: %w", err)
+		}
+		p := result[id]
+		if p == nil {
+			p = &models.ProfitAndLossPeriod{StartDate: startDate, EndDate: endDate}
+			result[id] = p
+		}
+		switch kind {
+		case "sales":
+			p.SalesRevenue += amount
+		case "orders":
+			p.OrderRevenue += amount
+		case "discounts":
+			p.Discounts += amount
+		case "stock_cost":
+			p.StockCost += amount
+			p.UncostedUnits += units
+		case "purchase":
+			if category == models.PURCHASE_CATEGORY_MATERIAL {
+				p.MaterialCost += amount
+				continue
+			}
+			if expenses[id] == nil {
+				expenses[id] = make(map[string]money.Amount)
+			}
+			expenses[id][category] += amount
+		case "salaries":
+			p.Salaries += amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("profit and loss rows failed: %w", err)
+	}
+
+	for id, p := range result {
+		for category, amount := range expenses[id] {
+			p.Expenses = append(p.Expenses, &models.ExpenseLine{Category: category, Amount: amount})
+		}
+		finishProfitAndLossPeriod(p)
+	}
+	return result, nil
+}
+
+// addProfitAndLossPeriod adds the source lines of src into dst; totals are
+// recomputed by finishProfitAndLossPeriod
+func addProfitAndLossPeriod(dst, src *models.ProfitAndLossPeriod) {
+	dst.SalesRevenue += src.SalesRevenue
+	dst.OrderRevenue += src.OrderRevenue
+	dst.Discounts += src.Discounts
+	dst.MaterialCost += src.MaterialCost
+	dst.StockCost += src.StockCost
+	dst.UncostedUnits += src.UncostedUnits
+	dst.Salaries += src.Salaries
+	for _, e := range src.Expenses {
+		found := false
+		for _, d := range dst.Expenses {
+			if d.Category == e.Category {
+				d.Amount += e.Amount
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst.Expenses = append(dst.Expenses, &models.ExpenseLine{Category: e.Category, Amount: e.Amount})
+		}
+	}
+}
+
+// finishProfitAndLossPeriod sorts the expense lines and fills in the totals
+func finishProfitAndLossPeriod(p *models.ProfitAndLossPeriod) *models.ProfitAndLossPeriod {
+	if p.Expenses == nil {
+		p.Expenses = []*models.ExpenseLine{}
+	}
+	sort.Slice(p.Expenses, func(i, j int) bool { return p.Expenses[i].Category < p.Expenses[j].Category })
+
+	p.TotalExpenses = 0
+	for _, e := range p.Expenses {
+		p.TotalExpenses += e.Amount
+	}
+	p.TotalRevenue = p.SalesRevenue + p.OrderRevenue
+	p.GrossSales = p.TotalRevenue + p.Discounts
+	p.CostOfGoods = p.MaterialCost + p.StockCost
+	p.GrossProfit = p.TotalRevenue - p.CostOfGoods
+	p.NetProfit = p.GrossProfit - p.TotalExpenses - p.Salaries
+	return p
+}
+
+// periodOrEmpty returns p, or an empty statement when the branch had no activity
+func periodOrEmpty(p *models.ProfitAndLossPeriod, startDate, endDate time.Time) *models.ProfitAndLossPeriod {
+	if p != nil {
+		return p
+	}
+	return finishProfitAndLossPeriod(&models.ProfitAndLossPeriod{StartDate: startDate, EndDate: endDate})
+}
+
+// newProfitAndLoss pairs two periods and computes the change between them
+func newProfitAndLoss(branchID int64, branchName string, cur, prev *models.ProfitAndLossPeriod) *models.ProfitAndLoss {
+	pl := &models.ProfitAndLoss{
+		BranchID:        branchID,
+		BranchName:      branchName,
+		Current:         cur,
+		Previous:        prev,
+		RevenueChange:   cur.TotalRevenue - prev.TotalRevenue,
+		NetProfitChange: cur.NetProfit - prev.NetProfit,
+	}
+	if prev.NetProfit != 0 {
+		pct := math.Round(pl.NetProfitChange.Float64()/prev.NetProfit.Abs().Float64()*10000) / 100
+		pl.NetProfitChangePct = &pct
+	}
+	return pl
+}
+
+// GetBalanceSheet builds the financial position of a branch at the end of asOf.
+// branchID 0 gives the consolidated balance sheet with a per-branch breakdown.
+func (r *ReportRepo) GetBalanceSheet(ctx context.Context, branchID int64, asOf time.Time) (*models.BalanceSheet, error) {
+	sheets, ytd, err := r.financialPositionByBranch(ctx, branchID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := r.reportBranches(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	if branchID != 0 {
+		return balanceSheetOrEmpty(sheets[branchID], ytd[branchID], branchID, branches[0].name, asOf), nil
+	}
+
+	total := &models.BalanceSheet{BranchName: consolidatedBranchName, AsOf: asOf, Accounts: []*models.AccountBalance{}}
+	for _, b := range branches {
+		bs := balanceSheetOrEmpty(sheets[b.id], ytd[b.id], b.id, b.name, asOf)
+		addBalanceSheet(total, bs)
+		total.Branches = append(total.Branches, bs)
+	}
+	finishBalanceSheet(total)
+	return total, nil
+}
+
+// GetTrialBalance lists the ledger balances of a branch at the end of asOf, with
+// income and expenses from the start of the calendar year. The owner equity line
+// is the balancing figure, as opening capital is not recorded.
+// branchID 0 gives the consolidated trial balance.
+func (r *ReportRepo) GetTrialBalance(ctx context.Context, branchID int64, asOf time.Time) (*models.TrialBalance, error) {
+	sheets, ytd, err := r.financialPositionByBranch(ctx, branchID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	branches, err := r.reportBranches(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	yearStart := time.Date(asOf.Year(), 1, 1, 0, 0, 0, 0, asOf.Location())
+	bs := &models.BalanceSheet{AsOf: asOf, Accounts: []*models.AccountBalance{}}
+	pl := &models.ProfitAndLossPeriod{StartDate: yearStart, EndDate: asOf}
+	name := consolidatedBranchName
+	if branchID != 0 {
+		name = branches[0].name
+	}
+	for _, b := range branches {
+		addBalanceSheet(bs, balanceSheetOrEmpty(sheets[b.id], ytd[b.id], b.id, b.name, asOf))
+		addProfitAndLossPeriod(pl, periodOrEmpty(ytd[b.id], yearStart, asOf))
+	}
+	finishBalanceSheet(bs)
+	finishProfitAndLossPeriod(pl)
+
+	tb := &models.TrialBalance{
+		BranchID:   branchID,
+		BranchName: name,
+		AsOf:       asOf,
+		YearStart:  yearStart,
+	}
+	add := func(account, accountType string, amount money.Amount, debitNormal bool) {
+		line := &models.TrialBalanceLine{Account: account, Type: accountType}
+		// a negative balance moves to the other side
+		if (amount >= 0) == debitNormal {
+			line.Debit = amount.Abs()
+		} else {
+			line.Credit = amount.Abs()
+		}
+		tb.TotalDebit += line.Debit
+		tb.TotalCredit += line.Credit
+		tb.Lines = append(tb.Lines, line)
+	}
+
+	add("Cash", "asset", bs.Cash, true)
+	add("Bank", "asset", bs.Bank, true)
+	add("Accounts receivable", "asset", bs.Receivables, true)
+	add("Inventory", "asset", bs.Inventory, true)
+	add("Supplier payables", "liability", bs.SupplierPayables, false)
+	add("Customer advances", "liability", bs.CustomerAdvances, false)
+	add("Customer store credit", "liability", bs.StoreCredit, false)
+	add("Gift vouchers", "liability", bs.GiftVouchers, false)
+	add("Salaries payable", "liability", bs.SalariesPayable, false)
+	add("Tax payable", "liability", bs.TaxPayable, false)
+	add("Owner equity", "equity", bs.OwnerEquity, false)
+	add("Sales revenue", "revenue", pl.SalesRevenue, false)
+	add("Order revenue", "revenue", pl.OrderRevenue, false)
+	add("Cost of goods sold", "expense", pl.CostOfGoods, true)
+	for _, e := range pl.Expenses {
+		add("Expense: "+e.Category, "expense", e.Amount, true)
+	}
+	add("Salaries", "expense", pl.Salaries, true)
+
+	return tb, nil
+}
+
+// financialPositionByBranch computes the balance sheet of every branch (or only
+// branchID when it is not 0) at the end of asOf, along with the year-to-date
+// income statement that feeds the current year profit.
+//
+//   - cash and bank: the money moved into less the money moved out of each account
+//     up to asOf. accounts.current_balance is not used as purchases, salaries and
+//     supplier payments do not update it.
+//   - receivables and advances: per order, the delivered share of the order value
+//     against the money received; per sale, the sale total against the money received
+//   - inventory: product stock rolled back to asOf, valued at the product unit cost
+//   - store credit: the store credit ledger up to asOf
+//   - supplier payables: purchase totals not paid by asOf, when booked or by supplier payments
+//   - tax payable: tax charged on sales and orders less tax paid on purchases
+//   - salaries payable: base salary earned this month less salaries and advances paid
+func (r *ReportRepo) financialPositionByBranch(ctx context.Context, branchID int64, asOf time.Time) (map[int64]*models.BalanceSheet, map[int64]*models.ProfitAndLossPeriod, error) {
+	sheets := make(map[int64]*models.BalanceSheet)
+	sheet := func(id int64) *models.BalanceSheet {
+		if sheets[id] == nil {
+			sheets[id] = &models.BalanceSheet{BranchID: id, AsOf: asOf, Accounts: []*models.AccountBalance{}}
+		}
+		return sheets[id]
+	}
+
+	// --------------------
+	// Cash and bank
+	// --------------------
+	rows, err := r.db.Query(ctx, `
+		SELECT a.branch_id, a.id, a.name, a.type, COALESCE(m.balance, 0)
+		FROM accounts a
+		LEFT JOIN (
+			SELECT account_id, SUM(amount) AS balance
+			FROM (
+				SELECT to_entity_id AS account_id, amount
+				FROM transactions
+				WHERE to_entity_type = 'accounts' AND transaction_date <= $2::date
+				UNION ALL
+				SELECT from_entity_id, -amount
+				FROM transactions
+				WHERE from_entity_type = 'accounts' AND transaction_date <= $2::date
+			) mv
+			GROUP BY account_id
+		) m ON m.account_id = a.id
+		WHERE ($1::bigint = 0 OR a.branch_id = $1)
+		ORDER BY a.branch_id, a.id
+	`, branchID, asOf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("account balances query failed: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		ab := &models.AccountBalance{}
+		if err := rows.Scan(&id, &ab.AccountID, &ab.AccountName, &ab.AccountType, &ab.Balance); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan account balance failed: %w", err)
+		}
+		bs := sheet(id)
+		if ab.AccountType == models.ACCOUNT_BANK {
+			bs.Bank += ab.Balance
+		} else {
+			bs.Cash += ab.Balance
+		}
+		bs.Accounts = append(bs.Accounts, ab)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("account balance rows failed: %w", err)
+	}
+
+	// --------------------
+	// Receivables and customer advances
+	// --------------------
+	rows, err = r.db.Query(ctx, `
+		SELECT branch_id,
+		       COALESCE(SUM(GREATEST(earned - received, 0)), 0)::numeric,
+		       COALESCE(SUM(GREATEST(received - earned, 0)), 0)::numeric
+		FROM (
+			SELECT o.branch_id,
+			       COALESCE(o.total_amount * LEAST(ot.delivered, o.total_products) / NULLIF(o.total_products, 0), 0) AS earned,
+			       COALESCE(ot.received, 0) AS received
+			FROM orders o
+			LEFT JOIN (
+				SELECT order_id,
+				       SUM(quantity_delivered) AS delivered,
+				       SUM(CASE WHEN transaction_type = 'Refund' THEN -amount ELSE amount END) AS received
+				FROM order_transactions
+				WHERE transaction_date <= $2::date
+				GROUP BY order_id
+			) ot ON ot.order_id = o.id
+			WHERE ($1::bigint = 0 OR o.branch_id = $1)
+			  AND o.status NOT IN ('cancelled', 'returned')
+			  AND o.order_date <= $2::date
+
+			UNION ALL
+			SELECT s.branch_id, s.total_amount, COALESCE(st.received, 0)
+			FROM sales s
+			LEFT JOIN (
+				SELECT sale_id, SUM(CASE WHEN transaction_type = 'Refund' THEN -amount ELSE amount END) AS received
+				FROM sale_transactions
+				WHERE transaction_date <= $2::date
+				GROUP BY sale_id
+			) st ON st.sale_id = s.id
+			WHERE ($1::bigint = 0 OR s.branch_id = $1)
+			  AND s.status NOT IN ('cancelled', 'returned')
+			  AND s.sale_date <= $2::date
+		) d
+		GROUP BY branch_id
+	`, branchID, asOf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("receivables query failed: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var receivable, advance money.Amount
+		if err := rows.Scan(&id, &receivable, &advance); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan receivables failed: %w", err)
+		}
+		bs := sheet(id)
+		bs.Receivables += receivable
+		bs.CustomerAdvances += advance
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("receivables rows failed: %w", err)
+	}
+
+	// adjustments settle (or add to) customer dues outside orders and sales
+	rows, err = r.db.Query(ctx, `
+		SELECT branch_id, COALESCE(SUM(CASE WHEN from_entity_type = 'customers' THEN amount ELSE -amount END), 0)::numeric
+		FROM transactions
+		WHERE ($1::bigint = 0 OR branch_id = $1)
+		  AND transaction_type = 'Adjustment'
+		  AND 'customers' IN (from_entity_type, to_entity_type)
+		  AND transaction_date <= $2::date
+		GROUP BY branch_id
+	`, branchID, asOf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("customer adjustments query failed: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var settled money.Amount
+		if err := rows.Scan(&id, &settled); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan customer adjustments failed: %w", err)
+		}
+		sheet(id).Receivables -= settled
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("customer adjustments rows failed: %w", err)
+	}
+
+	// money held for customers as store credit
+	rows, err = r.db.Query(ctx, `
+		SELECT branch_id, COALESCE(SUM(amount), 0)::numeric
+		FROM store_credit_ledger
+		WHERE ($1::bigint = 0 OR branch_id = $1)
+		  AND entry_date <= $2::date
+		GROUP BY branch_id
+	`, branchID, asOf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("store credit query failed: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var held money.Amount
+		if err := rows.Scan(&id, &held); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan store credit failed: %w", err)
+		}
+		sheet(id).StoreCredit += held
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("store credit rows failed: %w", err)
+	}
+
+	// vouchers sold and not yet redeemed; a branch redeeming vouchers sold
+	// elsewhere carries a negative balance here
+	rows, err = r.db.Query(ctx, `
+		SELECT branch_id, COALESCE(SUM(amount), 0)::numeric
+		FROM voucher_ledger
+		WHERE ($1::bigint = 0 OR branch_id = $1)
+		  AND entry_date <= $2::date
+		GROUP BY branch_id
+	`, branchID, asOf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("gift voucher query failed: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var held money.Amount
+		if err := rows.Scan(&id, &held); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan gift vouchers failed: %w", err)
+		}
+		sheet(id).GiftVouchers += held
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("gift voucher rows failed: %w", err)
+	}
+
+	// --------------------
+	// Inventory
+	// --------------------
+	rows, err = r.db.Query(ctx, `
+		SELECT p.branch_id,
+		       COALESCE(SUM(q.qty * p.unit_cost) FILTER (WHERE p.unit_cost IS NOT NULL), 0)::numeric,
+		       COALESCE(SUM(q.qty) FILTER (WHERE p.unit_cost IS NULL), 0)::bigint
+		FROM products p
+		CROSS JOIN LATERAL (
+			SELECT GREATEST(p.quantity
+				- COALESCE((SELECT SUM(r.quantity) FROM product_stock_registry r
+				            WHERE r.product_id = p.id AND r.stock_date > $2::date), 0)
+				+ COALESCE((SELECT SUM(si.quantity) FROM sale_items si
+				            JOIN sales s ON s.id = si.sale_id
+				            WHERE si.product_id = p.id AND s.sale_date > $2::date
+				              AND s.status NOT IN ('cancelled', 'returned')), 0), 0) AS qty
+		) q
+		WHERE ($1::bigint = 0 OR p.branch_id = $1)
+		GROUP BY p.branch_id
+	`, branchID, asOf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inventory query failed: %w", err)
+	}
+	for rows.Next() {
+		var id, units int64
+		var value money.Amount
+		if err := rows.Scan(&id, &value, &units); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan inventory failed: %w", err)
+		}
+		bs := sheet(id)
+		bs.Inventory += value
+		bs.UncostedUnits += units
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("inventory rows failed: %w", err)
+	}
+
+	// --------------------
+	// Supplier payables and salaries payable
+	// --------------------
+	monthStart := time.Date(asOf.Year(), asOf.Month(), 1, 0, 0, 0, 0, asOf.Location())
+	daysInMonth := monthStart.AddDate(0, 1, -1).Day()
+	earnedShare := float64(asOf.Day()) / float64(daysInMonth)
+
+	rows, err = r.db.Query(ctx, `
+		SELECT p.branch_id, 'payables', COALESCE(SUM(p.total_amount - p.paid_amount + COALESCE(pp.after, 0)), 0)::numeric
+		FROM purchase p
+		LEFT JOIN (
+			SELECT purchase_id, SUM(amount) AS after
+			FROM purchase_payments
+			WHERE payment_date > $2::date
+			GROUP BY purchase_id
+		) pp ON pp.purchase_id = p.id
+		WHERE ($1::bigint = 0 OR p.branch_id = $1)
+		  AND p.purchase_date <= $2::date
+		GROUP BY p.branch_id
+
+		UNION ALL
+		SELECT dt.branch_id, 'tax',
+		       COALESCE(SUM(CASE WHEN dt.document_type = 'purchase' THEN -dt.tax_amount ELSE dt.tax_amount END), 0)::numeric
+		FROM document_taxes dt
+		LEFT JOIN orders o ON dt.document_type = 'order' AND o.id = dt.document_id
+		LEFT JOIN sales s ON dt.document_type = 'sale' AND s.id = dt.document_id
+		WHERE ($1::bigint = 0 OR dt.branch_id = $1)
+		  AND dt.document_date <= $2::date
+		  AND COALESCE(o.status, s.status, '') NOT IN ('cancelled', 'returned')
+		GROUP BY dt.branch_id
+
+		UNION ALL
+		SELECT e.branch_id, 'salaries',
+		       COALESCE(SUM(GREATEST(COALESCE(e.base_salary, 0) * $3::numeric - COALESCE(t.paid, 0), 0)), 0)::numeric
+		FROM employees e
+		LEFT JOIN (
+			SELECT to_entity_id, SUM(amount) AS paid
+			FROM transactions
+			WHERE to_entity_type = 'employees'
+			  AND transaction_type IN ('Salary', 'Advance Payment')
+			  AND transaction_date BETWEEN $4::date AND $2::date
+			GROUP BY to_entity_id
+		) t ON t.to_entity_id = e.id
+		WHERE ($1::bigint = 0 OR e.branch_id = $1)
+		  AND e.status = 'active'
+		  AND e.role <> 'chairman'
+		  AND e.joining_date::date <= $2::date
+		GROUP BY e.branch_id
+	`, branchID, asOf, earnedShare, monthStart)
+	if err != nil {
+		return nil, nil, fmt.Errorf("payables query failed: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var kind string
+		var amount money.Amount
+		if err := rows.Scan(&id, &kind, &amount); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan payables failed: %w", err)
+		}
+		switch kind {
+		case "payables":
+			sheet(id).SupplierPayables += amount
+		case "tax":
+			sheet(id).TaxPayable += amount
+		default:
+			sheet(id).SalariesPayable += amount
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("payables rows failed: %w", err)
+	}
+
+	// --------------------
+	// Current year profit
+	// --------------------
+	yearStart := time.Date(asOf.Year(), 1, 1, 0, 0, 0, 0, asOf.Location())
+	ytd, err := r.profitAndLossByBranch(ctx, branchID, yearStart, asOf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sheets, ytd, nil
+}
+
+// balanceSheetOrEmpty names the branch balance sheet (or an empty one when the
+// branch has no records) and fills in the equity and totals
+func balanceSheetOrEmpty(bs *models.BalanceSheet, ytd *models.ProfitAndLossPeriod, branchID int64, branchName string, asOf time.Time) *models.BalanceSheet {
+	if bs == nil {
+		bs = &models.BalanceSheet{AsOf: asOf, Accounts: []*models.AccountBalance{}}
+	}
+	bs.BranchID = branchID
+	bs.BranchName = branchName
+	if ytd != nil {
+		bs.CurrentYearProfit = ytd.NetProfit
+	}
+	return finishBalanceSheet(bs)
+}
+
+// addBalanceSheet adds the source lines of src into dst; totals are recomputed
+// by finishBalanceSheet
+func addBalanceSheet(dst, src *models.BalanceSheet) {
+	dst.Cash += src.Cash
+	dst.Bank += src.Bank
+	dst.Receivables += src.Receivables
+	dst.Inventory += src.Inventory
+	dst.UncostedUnits += src.UncostedUnits
+	dst.SupplierPayables += src.SupplierPayables
+	dst.CustomerAdvances += src.CustomerAdvances
+	dst.StoreCredit += src.StoreCredit
+	dst.GiftVouchers += src.GiftVouchers
+	dst.SalariesPayable += src.SalariesPayable
+	dst.TaxPayable += src.TaxPayable
+	dst.CurrentYearProfit += src.CurrentYearProfit
+	dst.Accounts = append(dst.Accounts, src.Accounts...)
+}
+
+// finishBalanceSheet rounds the lines and fills in the totals; owner equity is
+// whatever the assets leave after liabilities and the current year profit
+func finishBalanceSheet(bs *models.BalanceSheet) *models.BalanceSheet {
+	bs.TotalAssets = bs.Cash + bs.Bank + bs.Receivables + bs.Inventory
+	bs.TotalLiabilities = bs.SupplierPayables + bs.CustomerAdvances + bs.StoreCredit + bs.GiftVouchers + bs.SalariesPayable + bs.TaxPayable
+	bs.TotalEquity = bs.TotalAssets - bs.TotalLiabilities
+	bs.OwnerEquity = bs.TotalEquity - bs.CurrentYearProfit
+	return bs
+}
@@ -0,0 +1,399 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// settleInstallments works out what is paid on each installment of an order.
+// The part of the total outside the plan, the advance, is settled first and
+// the rest of the money received goes to the installments in order. An
+// installment not fully paid after its due date is overdue on asOf.
+func settleInstallments(list []models.Installment, total, received money.Amount, asOf time.Time) {
+	var planTotal money.Amount
+	for _, in := range list {
+		planTotal += in.Amount
+	}
+	covered := max(received-(total-planTotal), 0)
+	for i := range list {
+		in := &list[i]
+		in.PaidAmount = min(in.Amount, covered)
+		covered -= in.PaidAmount
+		in.DueAmount = in.Amount - in.PaidAmount
+		in.Overdue = in.DueAmount > 0 && in.DueDate.Before(asOf)
+		switch {
+		case in.DueAmount == 0:
+			in.Status = models.INSTALLMENT_PAID
+		case in.Overdue:
+			in.Status = models.INSTALLMENT_OVERDUE
+		case in.PaidAmount > 0:
+			in.Status = models.INSTALLMENT_PARTIAL
+		default:
+			in.Status = models.INSTALLMENT_DUE
+		}
+	}
+}
+
+// today is the date installments fall overdue against, at midnight UTC as
+// the due dates are read
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// loadInstallments returns the installments of an order, in order
+func loadInstallments(ctx context.Context, q queryer, orderID int64) ([]models.Installment, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, order_id, installment_no, due_date, amount, notes
+		FROM order_installments
+		WHERE order_id = $1
+		ORDER BY installment_no
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("load installments failed: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.Installment
+	for rows.Next() {
+		var in models.Installment
+		if err := rows.Scan(&in.ID, &in.OrderID, &in.InstallmentNo, &in.DueDate, &in.Amount, &in.Notes); err != nil {
+			return nil, fmt.Errorf("scan installment failed: %w", err)
+		}
+		list = append(list, in)
+	}
+	return list, rows.Err()
+}
+
+// GetInstallments returns the installment plan of an order with what is paid
+// on each installment today
+func (r *OrderRepo) GetInstallments(ctx context.Context, orderID int64) ([]models.Installment, error) {
+	var total, received money.Amount
+	err := r.db.QueryRow(ctx, `SELECT total_amount, received_amount FROM orders WHERE id = $1`, orderID).Scan(&total, &received)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("order %d not found", orderID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load order failed: %w", err)
+	}
+	list, err := loadInstallments(ctx, r.db, orderID)
+	if err != nil {
+		return nil, err
+	}
+	settleInstallments(list, total, received, today())
+	return list, nil
+}
+
+// SetInstallmentPlan schedules what is still due on an order, replacing any
+// plan it had. Installments without an amount share what the others leave
+// equally; together they must come to the amount due.
+func (r *OrderRepo) SetInstallmentPlan(ctx context.Context, branchID, orderID int64, plan []models.Installment) ([]models.Installment, error) {
+	if len(plan) == 0 {
+		return nil, errors.New("an installment plan needs at least one installment")
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		orderDate       time.Time
+		status          string
+		total, received money.Amount
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT order_date, status, total_amount, received_amount
+		FROM orders
+		WHERE id = $1 AND branch_id = $2
+		FOR UPDATE
+	`, orderID, branchID).Scan(&orderDate, &status, &total, &received)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("order %d not found in this branch", orderID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock order failed: %w", err)
+	}
+	if status == models.ORDER_CANCELLED {
+		return nil, errors.New("a cancelled order has no installments")
+	}
+	due := total - received
+	if due <= 0 {
+		return nil, errors.New("the order is already paid in full")
+	}
+
+	// amounts left out share the rest of the due equally
+	var fixed money.Amount
+	var open []int
+	for i := range plan {
+		if plan[i].Amount < 0 {
+			return nil, errors.New("installment amount cannot be negative")
+		}
+		if plan[i].Amount == 0 {
+			open = append(open, i)
+		}
+		fixed += plan[i].Amount
+	}
+	if len(open) > 0 {
+		if fixed >= due {
+			return nil, fmt.Errorf("installments of %s leave nothing for the ones without an amount", fixed)
+		}
+		for k, part := range (due - fixed).Split(len(open)) {
+			plan[open[k]].Amount = part
+		}
+		fixed = due
+	}
+	if fixed != due {
+		return nil, fmt.Errorf("installments total %s but %s is due on the order", fixed, due)
+	}
+
+	sort.SliceStable(plan, func(i, j int) bool { return plan[i].DueDate.Before(plan[j].DueDate) })
+	if plan[0].DueDate.Before(orderDate) {
+		return nil, errors.New("an installment cannot fall due before the order date")
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM order_installments WHERE order_id = $1`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("delete old installments failed: %w", err)
+	}
+	for i := range plan {
+		in := &plan[i]
+		in.OrderID = orderID
+		in.InstallmentNo = i + 1
+		in.Notes = strings.TrimSpace(in.Notes)
+		err = tx.QueryRow(ctx, `
+			INSERT INTO order_installments (order_id, branch_id, installment_no, due_date, amount, notes)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		`, orderID, branchID, in.InstallmentNo, in.DueDate, in.Amount, in.Notes).Scan(&in.ID)
+		if err != nil {
+			return nil, fmt.Errorf("insert installment failed: %w", err)
+		}
+	}
+	settleInstallments(plan, total, received, today())
+	return plan, tx.Commit(ctx)
+}
+
+// ReceiveInstallment records money paid on an order between its creation and
+// delivery. Each payment is posted to its own account, the order and the
+// customer's due go down and the payment gets a receipt number of its own.
+func (r *OrderRepo) ReceiveInstallment(ctx context.Context, payment *models.InstallmentPayment) (*models.InstallmentPaymentResult, error) {
+	var (
+		accountID int64
+		amount    money.Amount
+	)
+	payments, err := normalizePayments(&accountID, &amount, payment.Payments)
+	if err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 {
+		return nil, errors.New("at least one payment is required")
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := EnsurePeriodOpenTx(ctx, tx, payment.BranchID, payment.PaymentDate); err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// 1. Lock the order
+	// --------------------
+	var (
+		memoNo                   string
+		status                   string
+		customerID, salesperson  int64
+		total, received          money.Amount
+		totalItems, deliveredQty int64
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT memo_no, status, customer_id, salesperson_id, total_amount, received_amount,
+			total_products, delivered_products
+		FROM orders
+		WHERE id = $1 AND branch_id = $2
+		FOR UPDATE
+	`, payment.OrderID, payment.BranchID).Scan(&memoNo, &status, &customerID, &salesperson, &total, &received,
+		&totalItems, &deliveredQty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("order %d not found in this branch", payment.OrderID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock order failed: %w", err)
+	}
+	if status == models.ORDER_CANCELLED {
+		return nil, errors.New("cannot receive payment on a cancelled order")
+	}
+	if amount > total-received {
+		return nil, fmt.Errorf("payment of %s exceeds the %s due on order %s", amount, total-received, memoNo)
+	}
+
+	// --------------------
+	// 2. Post the payments
+	// --------------------
+	receiptNo, err := NextMemoNoTx(ctx, tx, payment.BranchID, models.MEMO_PAYMENT, payment.PaymentDate)
+	if err != nil {
+		return nil, err
+	}
+	notes := strings.TrimSpace(payment.Notes)
+	if notes == "" {
+		notes = "Installment received on order " + memoNo
+	}
+	topSheet := &models.TopSheetDB{
+		SheetDate: payment.PaymentDate,
+		BranchID:  payment.BranchID,
+	}
+	_, err = postPaymentsTx(ctx, tx, paymentPosting{
+		docType:     models.DOCUMENT_ORDER,
+		docID:       payment.OrderID,
+		branchID:    payment.BranchID,
+		customerID:  customerID,
+		date:        payment.PaymentDate,
+		memoNo:      receiptNo,
+		deliveredBy: salesperson,
+		txType:      models.PAYMENT,
+		notes:       notes,
+		txMemoNo:    receiptNo,
+	}, payments, nil, topSheet)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveTopSheetTx(tx, ctx, topSheet); err != nil {
+		return nil, fmt.Errorf("save top sheet failed: %w", err)
+	}
+
+	// --------------------
+	// 3. Order and customer due
+	// --------------------
+	received += amount
+	status = models.ORDER_PENDING
+	if deliveredQty > 0 {
+		status = models.ORDER_PARTIAL_DELIVERY
+	}
+	if deliveredQty >= totalItems && received >= total {
+		status = models.ORDER_DELIVERY
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE orders SET received_amount = $1, status = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, received, status, payment.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("update order failed: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE customers SET due_amount = due_amount - $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		amount, customerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update customer due failed: %w", err)
+	}
+
+	if err := syncLoyaltyTx(ctx, tx, models.DOCUMENT_ORDER, payment.OrderID, payment.PaymentDate); err != nil {
+		return nil, err
+	}
+
+	installments, err := loadInstallments(ctx, tx, payment.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	settleInstallments(installments, total, received, today())
+
+	result := &models.InstallmentPaymentResult{
+		MemoNo:       receiptNo,
+		OrderID:      payment.OrderID,
+		Amount:       amount,
+		RemainingDue: total - received,
+		Installments: installments,
+	}
+	return result, tx.Commit(ctx)
+}
+
+// GetUpcomingInstallments lists the unpaid installments of the branch falling
+// due up to endDate, the overdue ones first, as they stand on asOf
+func (r *ReportRepo) GetUpcomingInstallments(ctx context.Context, branchID int64, asOf, endDate time.Time) (*models.UpcomingInstallments, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT i.id, i.order_id, i.installment_no, i.due_date, i.amount, i.notes,
+			o.memo_no, o.total_amount, o.received_amount,
+			c.id, c.name, c.mobile
+		FROM order_installments i
+		JOIN orders o ON o.id = i.order_id
+		JOIN customers c ON c.id = o.customer_id
+		WHERE i.branch_id = $1
+		  AND o.status NOT IN ('cancelled', 'returned')
+		  AND o.total_amount > o.received_amount
+		ORDER BY i.order_id, i.installment_no
+	`, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("load installments failed: %w", err)
+	}
+	defer rows.Close()
+
+	type orderPlan struct {
+		total, received money.Amount
+		lines           []*models.UpcomingInstallment
+	}
+	var plans []*orderPlan
+	var last *orderPlan
+	for rows.Next() {
+		var (
+			u               models.UpcomingInstallment
+			total, received money.Amount
+		)
+		err := rows.Scan(&u.ID, &u.OrderID, &u.InstallmentNo, &u.DueDate, &u.Amount, &u.Notes,
+			&u.MemoNo, &total, &received, &u.CustomerID, &u.CustomerName, &u.CustomerMobile)
+		if err != nil {
+			return nil, fmt.Errorf("scan installment failed: %w", err)
+		}
+		if last == nil || last.lines[0].OrderID != u.OrderID {
+			last = &orderPlan{total: total, received: received}
+			plans = append(plans, last)
+		}
+		last.lines = append(last.lines, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &models.UpcomingInstallments{
+		BranchID:     branchID,
+		AsOf:         asOf,
+		EndDate:      endDate,
+		Installments: []*models.UpcomingInstallment{},
+	}
+	for _, p := range plans {
+		list := make([]models.Installment, len(p.lines))
+		for i, u := range p.lines {
+			list[i] = u.Installment
+		}
+		settleInstallments(list, p.total, p.received, asOf)
+		for i, u := range p.lines {
+			u.Installment = list[i]
+			if u.DueAmount == 0 || u.DueDate.After(endDate) {
+				continue
+			}
+			if u.Overdue {
+				u.DaysOverdue = int(asOf.Sub(u.DueDate).Hours() / 24)
+				report.OverdueCount++
+				report.OverdueTotal += u.DueAmount
+			} else {
+				report.UpcomingDue += u.DueAmount
+			}
+			report.Installments = append(report.Installments, u)
+		}
+	}
+	sort.SliceStable(report.Installments, func(i, j int) bool {
+		return report.Installments[i].DueDate.Before(report.Installments[j].DueDate)
+	})
+	return report, nil
+}
@@ -0,0 +1,64 @@
+package dbrepo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+func TestSettleInstallments(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	plan := func() []models.Installment {
+		return []models.Installment{
+			{InstallmentNo: 1, DueDate: day(10), Amount: 30000},
+			{InstallmentNo: 2, DueDate: day(20), Amount: 30000},
+			{InstallmentNo: 3, DueDate: day(30), Amount: 40000},
+		}
+	}
+	type result struct {
+		paid   money.Amount
+		status string
+	}
+	// the order total is 1200.00 of which 200.00 is outside the plan
+	tests := []struct {
+		name     string
+		received money.Amount
+		asOf     time.Time
+		want     []result
+	}{
+		{"advance only", 20000, day(1), []result{
+			{0, models.INSTALLMENT_DUE}, {0, models.INSTALLMENT_DUE}, {0, models.INSTALLMENT_DUE},
+		}},
+		{"advance not fully paid", 10000, day(1), []result{
+			{0, models.INSTALLMENT_DUE}, {0, models.INSTALLMENT_DUE}, {0, models.INSTALLMENT_DUE},
+		}},
+		{"first paid, second partly", 65000, day(15), []result{
+			{30000, models.INSTALLMENT_PAID}, {15000, models.INSTALLMENT_PARTIAL}, {0, models.INSTALLMENT_DUE},
+		}},
+		{"overdue after its date", 65000, day(21), []result{
+			{30000, models.INSTALLMENT_PAID}, {15000, models.INSTALLMENT_OVERDUE}, {0, models.INSTALLMENT_DUE},
+		}},
+		{"due on its date is not overdue", 20000, day(10), []result{
+			{0, models.INSTALLMENT_DUE}, {0, models.INSTALLMENT_DUE}, {0, models.INSTALLMENT_DUE},
+		}},
+		{"paid in full", 120000, day(31), []result{
+			{30000, models.INSTALLMENT_PAID}, {30000, models.INSTALLMENT_PAID}, {40000, models.INSTALLMENT_PAID},
+		}},
+	}
+	for _, tt := range tests {
+		list := plan()
+		settleInstallments(list, 120000, tt.received, tt.asOf)
+		for i, want := range tt.want {
+			in := list[i]
+			if in.PaidAmount != want.paid || in.Status != want.status {
+				t.Errorf("%s: installment %d paid %s (%s), want %s (%s)",
+					tt.name, in.InstallmentNo, in.PaidAmount, in.Status, want.paid, want.status)
+			}
+			if in.DueAmount != in.Amount-in.PaidAmount {
+				t.Errorf("%s: installment %d due %s, want %s", tt.name, in.InstallmentNo, in.DueAmount, in.Amount-in.PaidAmount)
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// InvoiceRepo gathers what is printed on invoices, delivery notes and refund receipts
+type InvoiceRepo struct {
+	db     *pgxpool.Pool
+	orders *OrderRepo
+	sales  *ProductRepo
+}
+
+func NewInvoiceRepo(db *pgxpool.Pool) *InvoiceRepo {
+	return &InvoiceRepo{db: db, orders: NewOrderRepo(db), sales: NewProductRepo(db)}
+}
+
+// GetBranch returns the details a branch prints on its documents
+func (r *InvoiceRepo) GetBranch(ctx context.Context, branchID int64) (*models.Branch, error) {
+	b := &models.Branch{ID: branchID}
+	err := r.db.QueryRow(ctx, `
+		SELECT name, slogan, mobile, telephone, email, website, address, city, country, logo_link,
+			tax_id, invoice_terms, invoice_terms_ar
+		FROM branches
+		WHERE id = $1
+	`, branchID).Scan(&b.Name, &b.Slogan, &b.Mobile, &b.Telephone, &b.Email, &b.Website, &b.Address, &b.City, &b.Country,
+		&b.LogoLink, &b.TaxID, &b.InvoiceTerms, &b.InvoiceTermsAr)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("branch %d not found", branchID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetch branch failed: %w", err)
+	}
+	return b, nil
+}
+
+// SetInvoiceTerms sets the terms printed under a branch's invoices
+func (r *InvoiceRepo) SetInvoiceTerms(ctx context.Context, branchID int64, terms, termsAr string) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE branches SET invoice_terms = $1, invoice_terms_ar = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, strings.TrimSpace(terms), strings.TrimSpace(termsAr), branchID)
+	if err != nil {
+		return fmt.Errorf("update invoice terms failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("branch %d not found", branchID)
+	}
+	return nil
+}
+
+// documentTx is an order or sale transaction as the invoices need it
+type documentTx struct {
+	id       int64
+	tx       models.InvoicePayment
+	quantity int64
+	txType   string
+}
+
+// pickTx returns the transaction printed on a delivery note or refund receipt:
+// the one with txID, or the latest of its kind when txID is 0
+func pickTx(txs []documentTx, kind string, txID int64) (*documentTx, error) {
+	var found *documentTx
+	for i := range txs {
+		t := &txs[i]
+		match := t.txType == models.REFUND
+		if kind == models.INVOICE_DELIVERY {
+			match = t.quantity > 0
+		}
+		if txID != 0 && t.id == txID {
+			if !match {
+				return nil, fmt.Errorf("transaction %d is not a %s", txID, kind)
+			}
+			return t, nil
+		}
+		if txID == 0 && match {
+			found = t
+		}
+	}
+	if found == nil {
+		if txID != 0 {
+			return nil, fmt.Errorf("transaction %d not found on this document", txID)
+		}
+		return nil, fmt.Errorf("no %s recorded on this document", kind)
+	}
+	return found, nil
+}
+
+// deliveryAmount is the money received with the delivery t: its own payment
+// and the further payments recorded with it, which carry no quantity
+func deliveryAmount(txs []documentTx, t *documentTx) money.Amount {
+	amount := t.tx.Amount
+	after := false
+	for _, o := range txs {
+		if o.id == t.id {
+			after = true
+			continue
+		}
+		if !after {
+			continue
+		}
+		if o.quantity != 0 || o.txType != t.txType || o.tx.MemoNo != t.tx.MemoNo {
+			break
+		}
+		amount += o.tx.Amount
+	}
+	return amount
+}
+
+// payments lists the money received on a document; refunds are negative
+func payments(txs []documentTx) []models.InvoicePayment {
+	var out []models.InvoicePayment
+	for _, t := range txs {
+		if t.tx.Amount == 0 {
+			continue
+		}
+		p := t.tx
+		if t.txType == models.REFUND {
+			p.Amount = -p.Amount
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func invoiceTx(id int64, p models.InvoicePayment, accountID int64, quantity int64, txType string) documentTx {
+	if accountID == 0 {
+		p.Account = "" // store credit, a gift voucher or loyalty points
+	}
+	return documentTx{id: id, tx: p, quantity: quantity, txType: txType}
+}
+
+// sortTxs orders transactions as they were recorded
+func sortTxs(txs []documentTx) {
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].id < txs[j].id })
+}
+
+// OrderInvoice returns the booking invoice, a delivery note or a refund
+// receipt of an order. txID picks the delivery or refund; 0 takes the latest.
+func (r *InvoiceRepo) OrderInvoice(ctx context.Context, orderID int64, kind string, txID int64) (*models.Invoice, error) {
+	if kind != models.INVOICE_ORDER && kind != models.INVOICE_DELIVERY && kind != models.INVOICE_REFUND {
+		return nil, fmt.Errorf("an order prints as %s, %s or %s", models.INVOICE_ORDER, models.INVOICE_DELIVERY, models.INVOICE_REFUND)
+	}
+	order, err := r.orders.GetOrderDetailsByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	branch, err := r.GetBranch(ctx, order.BranchID)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &models.Invoice{
+		Kind:           kind,
+		Branch:         *branch,
+		MemoNo:         order.MemoNo,
+		Date:           order.OrderDate,
+		Status:         order.Status,
+		CustomerName:   order.Customer.Name,
+		CustomerMobile: order.Customer.Mobile,
+		Salesperson:    order.Salesperson.Name,
+		Subtotal:       order.GrossAmount,
+		Discount:       order.DiscountAmount,
+		Net:            order.NetAmount,
+		Taxes:          order.Taxes,
+		Tax:            order.TaxAmount,
+		Total:          order.TotalAmount,
+		Paid:           order.ReceivedAmount,
+		Due:            order.TotalAmount - order.ReceivedAmount,
+		PointsEarned:   order.PointsEarned,
+	}
+	if inv.PointsBalance, err = customerPoints(ctx, r.db, order.CustomerID); err != nil {
+		return nil, err
+	}
+	if !order.DeliveryDate.IsZero() {
+		inv.DeliveryDate = &order.DeliveryDate
+	}
+	if order.Customer.TaxID != nil {
+		inv.CustomerTaxID = *order.Customer.TaxID
+	}
+	if order.Notes != nil {
+		inv.Notes = *order.Notes
+	}
+	for _, it := range order.Items {
+		inv.Items = append(inv.Items, models.InvoiceItem{Name: it.ProductName, Quantity: it.Quantity, Amount: it.Subtotal})
+	}
+
+	txs := make([]documentTx, 0, len(order.OrderTransactions))
+	for _, t := range order.OrderTransactions {
+		txs = append(txs, invoiceTx(t.TransactionID, models.InvoicePayment{
+			Date: t.TransactionDate, MemoNo: t.MemoNo, Account: t.PaymentAccountName, Reference: t.Reference, Voucher: t.VoucherCode, Points: t.LoyaltyPoints, Amount: t.Amount,
+		}, t.PaymentAccountID, t.QuantityDelivered, t.TransactionType))
+	}
+	sortTxs(txs)
+	inv.Payments = payments(txs)
+	if kind == models.INVOICE_ORDER {
+		return inv, nil
+	}
+
+	t, err := pickTx(txs, kind, txID)
+	if err != nil {
+		return nil, err
+	}
+	inv.Reference = t.tx.MemoNo
+	inv.Date = t.tx.Date
+	inv.Amount = deliveryAmount(txs, t)
+	inv.Quantity = t.quantity
+	for _, o := range txs {
+		if o.id <= t.id {
+			inv.Delivered += o.quantity
+		}
+	}
+	inv.Remaining = order.TotalItems - inv.Delivered
+	return inv, nil
+}
+
+// SaleInvoice returns the invoice or a refund receipt of a sale. txID picks
+// the refund; 0 takes the latest.
+func (r *InvoiceRepo) SaleInvoice(ctx context.Context, saleID int64, kind string, txID int64) (*models.Invoice, error) {
+	if kind != models.INVOICE_SALE && kind != models.INVOICE_REFUND {
+		return nil, fmt.Errorf("a sale prints as %s or %s", models.INVOICE_SALE, models.INVOICE_REFUND)
+	}
+	sale, err := r.sales.GetSaleDetailsByID(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	branch, err := r.GetBranch(ctx, sale.BranchID)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &models.Invoice{
+		Kind:           kind,
+		Branch:         *branch,
+		MemoNo:         sale.MemoNo,
+		Date:           sale.SaleDate,
+		Status:         sale.Status,
+		CustomerName:   sale.Customer.Name,
+		CustomerMobile: sale.Customer.Mobile,
+		Salesperson:    sale.Salesperson.Name,
+		Subtotal:       sale.GrossAmount,
+		Discount:       sale.DiscountAmount,
+		Net:            sale.NetAmount,
+		Taxes:          sale.Taxes,
+		Tax:            sale.TaxAmount,
+		Total:          sale.TotalAmount,
+		Paid:           sale.ReceivedAmount,
+		Due:            sale.TotalAmount - sale.ReceivedAmount,
+		PointsEarned:   sale.PointsEarned,
+	}
+	if inv.PointsBalance, err = customerPoints(ctx, r.db, sale.CustomerID); err != nil {
+		return nil, err
+	}
+	if sale.Customer.TaxID != nil {
+		inv.CustomerTaxID = *sale.Customer.TaxID
+	}
+	if sale.Notes != nil {
+		inv.Notes = *sale.Notes
+	}
+	for _, it := range sale.Items {
+		inv.Items = append(inv.Items, models.InvoiceItem{Name: it.ProductName, Quantity: it.Quantity, Amount: it.Subtotal})
+	}
+
+	txs := make([]documentTx, 0, len(sale.SaleTransactions))
+	for _, t := range sale.SaleTransactions {
+		txs = append(txs, invoiceTx(t.TransactionID, models.InvoicePayment{
+			Date: t.TransactionDate, MemoNo: t.MemoNo, Account: t.PaymentAccountName, Reference: t.Reference, Voucher: t.VoucherCode, Points: t.LoyaltyPoints, Amount: t.Amount,
+		}, t.PaymentAccountID, t.QuantityDelivered, t.TransactionType))
+	}
+	sortTxs(txs)
+	inv.Payments = payments(txs)
+	if kind == models.INVOICE_SALE {
+		return inv, nil
+	}
+
+	t, err := pickTx(txs, kind, txID)
+	if err != nil {
+		return nil, err
+	}
+	inv.Reference = t.tx.MemoNo
+	inv.Date = t.tx.Date
+	inv.Amount = t.tx.Amount
+	return inv, nil
+}
@@ -0,0 +1,666 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ErrInsufficientPoints is returned when a customer redeems more points than
+// they hold.
+var ErrInsufficientPoints = errors.New("insufficient loyalty points")
+
+// Loyalty points are earned on what a customer actually paid for a sale or a
+// fully delivered order, under the rule in force on the document's date.
+// Every change to a document brings its points up to date (syncLoyaltyTx), so
+// refunds, returns and cancellations take back what it had earned. Points
+// earned are used oldest first and whatever is left of them expires after
+// the months of the rule.
+
+// defaultLoyaltyExpiryMonths is how long points given back keep when no rule
+// is in force any more
+const defaultLoyaltyExpiryMonths = 12
+
+// loyaltyBalanceSQL is the points customer c can redeem today: the stored
+// balance less points that expired since it was last brought up to date
+const loyaltyBalanceSQL = `c.loyalty_points - COALESCE((
+	SELECT SUM(l.remaining) FROM loyalty_ledger l
+	WHERE l.customer_id = c.id AND l.entry_type IN ('earn', 'restore') AND l.expires_on < CURRENT_DATE), 0)`
+
+// ============================== Loyalty Rules ==============================
+type LoyaltyRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewLoyaltyRepo(db *pgxpool.Pool) *LoyaltyRepo {
+	return &LoyaltyRepo{db: db}
+}
+
+// validateLoyaltyRule checks a loyalty rule before it is saved
+func validateLoyaltyRule(l *models.LoyaltyRule) error {
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" {
+		return errors.New("rule name is required")
+	}
+	if l.AmountPerPoint <= 0 {
+		return errors.New("amount per point must be greater than zero")
+	}
+	if l.PointValue <= 0 {
+		return errors.New("point value must be greater than zero")
+	}
+	if l.ExpiryMonths <= 0 {
+		return errors.New("points must expire after at least one month")
+	}
+	if l.MinRedeemPoints < 0 {
+		return errors.New("minimum points to redeem cannot be negative")
+	}
+	if l.StartsOn.IsZero() {
+		return errors.New("rule start date is required")
+	}
+	return nil
+}
+
+const loyaltyRuleColumns = `
+	id, branch_id, name, amount_per_point, point_value, expiry_months, min_redeem_points,
+	starts_on, active, created_at, updated_at`
+
+func scanLoyaltyRule(row pgx.Row) (*models.LoyaltyRule, error) {
+	var l models.LoyaltyRule
+	err := row.Scan(&l.ID, &l.BranchID, &l.Name, &l.AmountPerPoint, &l.PointValue, &l.ExpiryMonths, &l.MinRedeemPoints,
+		&l.StartsOn, &l.Active, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ListLoyaltyRules returns the loyalty rules that apply in a branch, latest first
+func (r *LoyaltyRepo) ListLoyaltyRules(ctx context.Context, branchID int64) ([]*models.LoyaltyRule, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+loyaltyRuleColumns+`
+		FROM loyalty_rules
+		WHERE branch_id IS NULL OR branch_id = $1
+		ORDER BY starts_on DESC, id DESC
+	`, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("list loyalty rules failed: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*models.LoyaltyRule{}
+	for rows.Next() {
+		l, err := scanLoyaltyRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan loyalty rule failed: %w", err)
+		}
+		rules = append(rules, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loyalty rule rows failed: %w", err)
+	}
+	return rules, nil
+}
+
+// CreateLoyaltyRule saves a new loyalty rule; a nil BranchID applies it in every branch
+func (r *LoyaltyRepo) CreateLoyaltyRule(ctx context.Context, l *models.LoyaltyRule) error {
+	if err := validateLoyaltyRule(l); err != nil {
+		return err
+	}
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO loyalty_rules (branch_id, name, amount_per_point, point_value, expiry_months, min_redeem_points, starts_on, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`, l.BranchID, l.Name, l.AmountPerPoint, l.PointValue, l.ExpiryMonths, l.MinRedeemPoints, l.StartsOn, l.Active,
+	).Scan(&l.ID, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert loyalty rule failed: %w", err)
+	}
+	return nil
+}
+
+// UpdateLoyaltyRule changes a loyalty rule that applies in the branch. Points
+// already earned keep their expiry; documents changed later are rewarded
+// under the rule as it is then.
+func (r *LoyaltyRepo) UpdateLoyaltyRule(ctx context.Context, branchID int64, l *models.LoyaltyRule) error {
+	if err := validateLoyaltyRule(l); err != nil {
+		return err
+	}
+	err := r.db.QueryRow(ctx, `
+		UPDATE loyalty_rules SET
+			branch_id = $3, name = $4, amount_per_point = $5, point_value = $6, expiry_months = $7,
+			min_redeem_points = $8, starts_on = $9, active = $10, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (branch_id IS NULL OR branch_id = $2)
+		RETURNING created_at, updated_at
+	`, l.ID, branchID, l.BranchID, l.Name, l.AmountPerPoint, l.PointValue, l.ExpiryMonths,
+		l.MinRedeemPoints, l.StartsOn, l.Active,
+	).Scan(&l.CreatedAt, &l.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("loyalty rule with id %d not found", l.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("update loyalty rule failed: %w", err)
+	}
+	return nil
+}
+
+// loyaltyRuleTx returns the rule in force in the branch on date, nil when
+// there is none. A rule of the branch takes the place of one for every branch.
+func loyaltyRuleTx(ctx context.Context, q rowQueryer, branchID int64, date time.Time) (*models.LoyaltyRule, error) {
+	l, err := scanLoyaltyRule(q.QueryRow(ctx, `
+		SELECT `+loyaltyRuleColumns+`
+		FROM loyalty_rules
+		WHERE active AND starts_on <= $2 AND (branch_id IS NULL OR branch_id = $1)
+		ORDER BY branch_id IS NULL, starts_on DESC, id DESC
+		LIMIT 1
+	`, branchID, date))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load loyalty rule failed: %w", err)
+	}
+	return l, nil
+}
+
+// ============================== Points ==============================
+
+// lockLoyaltyTx locks the customer's points, writes off those that expired
+// before asOf and returns the balance left
+func lockLoyaltyTx(ctx context.Context, tx pgx.Tx, customerID int64, asOf time.Time) (int64, error) {
+	var balance int64
+	err := tx.QueryRow(ctx, `SELECT loyalty_points FROM customers WHERE id = $1 FOR UPDATE`, customerID).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("customer with id %d not found", customerID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("lock customer points failed: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, branch_id, remaining, expires_on
+		FROM loyalty_ledger
+		WHERE customer_id = $1 AND entry_type IN ('earn', 'restore') AND remaining > 0 AND expires_on < $2
+		ORDER BY expires_on, id
+	`, customerID, asOf)
+	if err != nil {
+		return 0, fmt.Errorf("load expired points failed: %w", err)
+	}
+	var expired []*models.LoyaltyEntry
+	for rows.Next() {
+		lot := &models.LoyaltyEntry{}
+		if err := rows.Scan(&lot.ID, &lot.BranchID, &lot.Remaining, &lot.ExpiresOn); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan expired points failed: %w", err)
+		}
+		expired = append(expired, lot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("expired points rows failed: %w", err)
+	}
+
+	for _, lot := range expired {
+		if _, err := tx.Exec(ctx, `UPDATE loyalty_ledger SET remaining = 0 WHERE id = $1`, lot.ID); err != nil {
+			return 0, fmt.Errorf("expire points failed: %w", err)
+		}
+		err := postLoyaltyTx(ctx, tx, &models.LoyaltyEntry{
+			CustomerID: customerID,
+			BranchID:   lot.BranchID,
+			EntryDate:  lot.ExpiresOn.AddDate(0, 0, 1),
+			EntryType:  models.LOYALTY_EXPIRE,
+			Points:     -lot.Remaining,
+			Notes:      "Points expired on " + lot.ExpiresOn.Format("2006-01-02"),
+		})
+		if err != nil {
+			return 0, err
+		}
+		balance -= lot.Remaining
+	}
+	return balance, nil
+}
+
+// postLoyaltyTx records a movement of a customer's points and moves their balance
+func postLoyaltyTx(ctx context.Context, tx pgx.Tx, e *models.LoyaltyEntry) error {
+	err := tx.QueryRow(ctx, `
+		INSERT INTO loyalty_ledger(
+			customer_id, branch_id, entry_date, entry_type, points, amount, remaining, expires_on,
+			document_type, document_id, transaction_id, memo_no, notes
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+		RETURNING id, created_at
+	`,
+		e.CustomerID, e.BranchID, e.EntryDate, e.EntryType, e.Points, e.Amount, e.Remaining, e.ExpiresOn,
+		e.DocumentType, e.DocumentID, e.TransactionID, e.MemoNo, e.Notes,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert loyalty entry failed: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE customers SET loyalty_points = loyalty_points + $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, e.Points, e.CustomerID)
+	if err != nil {
+		return fmt.Errorf("update customer points failed: %w", err)
+	}
+	return nil
+}
+
+// grantLoyaltyTx adds points that expire after months. A customer whose
+// balance is below zero pays that off first; only the rest can be used.
+func grantLoyaltyTx(ctx context.Context, tx pgx.Tx, e *models.LoyaltyEntry, months int) error {
+	balance, err := lockLoyaltyTx(ctx, tx, e.CustomerID, e.EntryDate)
+	if err != nil {
+		return err
+	}
+	expiresOn := e.EntryDate.AddDate(0, months, 0)
+	e.ExpiresOn = &expiresOn
+	e.Remaining = max(0, e.Points+min(0, balance))
+	return postLoyaltyTx(ctx, tx, e)
+}
+
+// useLoyaltyTx takes points from what is left of the customer's earned
+// points, oldest first. Points earned on docType docID go first when given.
+func useLoyaltyTx(ctx context.Context, tx pgx.Tx, customerID, points int64, docType *string, docID *int64) error {
+	rows, err := tx.Query(ctx, `
+		SELECT id, remaining
+		FROM loyalty_ledger
+		WHERE customer_id = $1 AND entry_type IN ('earn', 'restore') AND remaining > 0
+		ORDER BY (document_type = $2 AND document_id = $3) IS TRUE DESC, expires_on, id
+		FOR UPDATE
+	`, customerID, docType, docID)
+	if err != nil {
+		return fmt.Errorf("load points failed: %w", err)
+	}
+	type lot struct{ id, used int64 }
+	var lots []lot
+	for rows.Next() && points > 0 {
+		var l lot
+		var remaining int64
+		if err := rows.Scan(&l.id, &remaining); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan points failed: %w", err)
+		}
+		l.used = min(remaining, points)
+		points -= l.used
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("points rows failed: %w", err)
+	}
+
+	for _, l := range lots {
+		if _, err := tx.Exec(ctx, `UPDATE loyalty_ledger SET remaining = remaining - $1 WHERE id = $2`, l.used, l.id); err != nil {
+			return fmt.Errorf("use points failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// takeBackLoyaltyTx takes back points a document earned, from those still
+// left first; points already used leave the balance below zero
+func takeBackLoyaltyTx(ctx context.Context, tx pgx.Tx, e *models.LoyaltyEntry) error {
+	balance, err := lockLoyaltyTx(ctx, tx, e.CustomerID, e.EntryDate)
+	if err != nil {
+		return err
+	}
+	if err := useLoyaltyTx(ctx, tx, e.CustomerID, min(-e.Points, max(balance, 0)), e.DocumentType, e.DocumentID); err != nil {
+		return err
+	}
+	return postLoyaltyTx(ctx, tx, e)
+}
+
+// loyaltyPaidTx returns the points redeemed on an order or sale and what they paid
+func loyaltyPaidTx(ctx context.Context, q rowQueryer, docType string, docID int64) (int64, money.Amount, error) {
+	var (
+		points int64
+		amount money.Amount
+	)
+	table, column := documentTransactionsTable(docType)
+	err := q.QueryRow(ctx, fmt.Sprintf(`
+		SELECT COALESCE(SUM(loyalty_points), 0), COALESCE(SUM(amount), 0)
+		FROM %s
+		WHERE %s = $1 AND loyalty_points IS NOT NULL
+	`, table, column), docID).Scan(&points, &amount)
+	if err != nil {
+		return 0, 0, fmt.Errorf("load points paid on %s failed: %w", docType, err)
+	}
+	return points, amount, nil
+}
+
+// syncLoyaltyTx brings the points an order or sale earned in line with what
+// the customer paid on it: a sale earns on the money paid, an order once all
+// of it is delivered, and neither once cancelled or returned. Points paid
+// with points earn nothing. Points earned by another customer before the
+// document changed hands are taken back from them.
+func syncLoyaltyTx(ctx context.Context, tx pgx.Tx, docType string, docID int64, date time.Time) error {
+	dateColumn, delivered := "order_date", "delivered_products >= total_products"
+	if docType == models.DOCUMENT_SALE {
+		dateColumn, delivered = "sale_date", "TRUE"
+	}
+	var (
+		branchID, customerID int64
+		memoNo, status       string
+		docDate              time.Time
+		received             money.Amount
+		isDelivered          bool
+	)
+	err := tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT branch_id, customer_id, memo_no, %s, status, received_amount, %s
+		FROM %s
+		WHERE id = $1
+	`, dateColumn, delivered, documentTable(docType)), docID).Scan(
+		&branchID, &customerID, &memoNo, &docDate, &status, &received, &isDelivered)
+	if err != nil {
+		return fmt.Errorf("load %s for loyalty points failed: %w", docType, err)
+	}
+
+	// --------------------
+	// 1. Points the document should have earned
+	// --------------------
+	var (
+		target int64
+		rule   *models.LoyaltyRule
+	)
+	if isDelivered && status != models.ORDER_CANCELLED && status != models.SALE_RETURNED {
+		if rule, err = loyaltyRuleTx(ctx, tx, branchID, docDate); err != nil {
+			return err
+		}
+		_, paidWithPoints, err := loyaltyPaidTx(ctx, tx, docType, docID)
+		if err != nil {
+			return err
+		}
+		if base := received - paidWithPoints; rule != nil && base > 0 {
+			target = int64(base) / int64(rule.AmountPerPoint)
+		}
+	}
+
+	// --------------------
+	// 2. Points it earned so far, by customer
+	// --------------------
+	rows, err := tx.Query(ctx, `
+		SELECT customer_id, SUM(points)
+		FROM loyalty_ledger
+		WHERE document_type = $1 AND document_id = $2 AND entry_type IN ('earn', 'reverse')
+		GROUP BY customer_id
+		ORDER BY customer_id
+	`, docType, docID)
+	if err != nil {
+		return fmt.Errorf("load points earned on %s failed: %w", docType, err)
+	}
+	earned := make(map[int64]int64)
+	var others []int64
+	for rows.Next() {
+		var id, points int64
+		if err := rows.Scan(&id, &points); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan points earned failed: %w", err)
+		}
+		earned[id] = points
+		if id != customerID && points != 0 {
+			others = append(others, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("points earned rows failed: %w", err)
+	}
+
+	// --------------------
+	// 3. Post the difference
+	// --------------------
+	entry := func(customer, points int64, entryType, notes string) *models.LoyaltyEntry {
+		return &models.LoyaltyEntry{
+			CustomerID:   customer,
+			BranchID:     branchID,
+			EntryDate:    date,
+			EntryType:    entryType,
+			Points:       points,
+			DocumentType: &docType,
+			DocumentID:   &docID,
+			MemoNo:       memoNo,
+			Notes:        fmt.Sprintf(notes, docType, memoNo),
+		}
+	}
+	for _, id := range others {
+		if err := takeBackLoyaltyTx(ctx, tx, entry(id, -earned[id], models.LOYALTY_REVERSE, "Taken back from %s %s")); err != nil {
+			return err
+		}
+	}
+	switch diff := target - earned[customerID]; {
+	case diff > 0:
+		return grantLoyaltyTx(ctx, tx, entry(customerID, diff, models.LOYALTY_EARN, "Earned on %s %s"), rule.ExpiryMonths)
+	case diff < 0:
+		return takeBackLoyaltyTx(ctx, tx, entry(customerID, diff, models.LOYALTY_REVERSE, "Taken back from %s %s"))
+	}
+	return nil
+}
+
+// loyaltyPaymentTx checks that the customer can pay with points in the
+// branch on date and returns what they are worth
+func loyaltyPaymentTx(ctx context.Context, tx pgx.Tx, branchID, customerID, points int64, date time.Time) (money.Amount, error) {
+	if points < 0 {
+		return 0, errors.New("loyalty points cannot be negative")
+	}
+	if points == 0 {
+		return 0, nil
+	}
+	rule, err := loyaltyRuleTx(ctx, tx, branchID, date)
+	if err != nil {
+		return 0, err
+	}
+	if rule == nil {
+		return 0, errors.New("no loyalty rule is in force in this branch")
+	}
+	if points < rule.MinRedeemPoints {
+		return 0, fmt.Errorf("at least %d loyalty points must be redeemed at a time", rule.MinRedeemPoints)
+	}
+	balance, err := lockLoyaltyTx(ctx, tx, customerID, date)
+	if err != nil {
+		return 0, err
+	}
+	if points > balance {
+		return 0, fmt.Errorf("%w: the customer has %d, %d requested", ErrInsufficientPoints, max(balance, 0), points)
+	}
+	return rule.PointValue * money.Amount(points), nil
+}
+
+// redeemLoyaltyTx pays amount of a new order or sale with points, after
+// loyaltyPaymentTx priced them. The caller adds amount to received_amount.
+func redeemLoyaltyTx(ctx context.Context, tx pgx.Tx, branchID, customerID int64, docType string, docID int64, docMemo string, date time.Time, deliveredBy, points int64, amount money.Amount) error {
+	if points == 0 {
+		return nil
+	}
+	memoNo, err := NextMemoNoTx(ctx, tx, branchID, models.MEMO_LOYALTY, date)
+	if err != nil {
+		return err
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: date,
+		MemoNo:          memoNo,
+		BranchID:        branchID,
+		FromID:          customerID,
+		FromType:        models.ENTITY_LOYALTY,
+		ToID:            docID,
+		ToType:          documentEntity(docType),
+		Amount:          amount,
+		TransactionType: models.PAYMENT,
+		Notes:           fmt.Sprintf("%d loyalty points applied to %s %s", points, docType, docMemo),
+	})
+	if err != nil {
+		return err
+	}
+
+	table, column := documentTransactionsTable(docType)
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s(
+			%s, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
+			amount, transaction_type, loyalty_points
+		)
+		VALUES ($1,$2,NULL,$3,$4,0,$5,$6,$7)
+	`, table, column), docID, date, memoNo, deliveredBy, amount, models.PAYMENT, points)
+	if err != nil {
+		return fmt.Errorf("insert %s points payment failed: %w", docType, err)
+	}
+
+	if err := useLoyaltyTx(ctx, tx, customerID, points, nil, nil); err != nil {
+		return err
+	}
+	return postLoyaltyTx(ctx, tx, &models.LoyaltyEntry{
+		CustomerID:    customerID,
+		BranchID:      branchID,
+		EntryDate:     date,
+		EntryType:     models.LOYALTY_REDEEM,
+		Points:        -points,
+		Amount:        amount,
+		DocumentType:  &docType,
+		DocumentID:    &docID,
+		TransactionID: &transactionID,
+		MemoNo:        memoNo,
+		Notes:         fmt.Sprintf("Paid %s %s", docType, docMemo),
+	})
+}
+
+// restoreLoyaltyTx gives back the points redeemed on a cancelled order and
+// returns what they paid, which is not handed back as store credit
+func restoreLoyaltyTx(ctx context.Context, tx pgx.Tx, branchID, customerID int64, docType string, docID int64, docMemo string, date time.Time) (money.Amount, error) {
+	points, amount, err := loyaltyPaidTx(ctx, tx, docType, docID)
+	if err != nil || points == 0 {
+		return 0, err
+	}
+	rule, err := loyaltyRuleTx(ctx, tx, branchID, date)
+	if err != nil {
+		return 0, err
+	}
+	months := defaultLoyaltyExpiryMonths
+	if rule != nil {
+		months = rule.ExpiryMonths
+	}
+	err = grantLoyaltyTx(ctx, tx, &models.LoyaltyEntry{
+		CustomerID:   customerID,
+		BranchID:     branchID,
+		EntryDate:    date,
+		EntryType:    models.LOYALTY_RESTORE,
+		Points:       points,
+		Amount:       amount,
+		DocumentType: &docType,
+		DocumentID:   &docID,
+		MemoNo:       docMemo,
+		Notes:        fmt.Sprintf("Redeemed on cancelled %s %s", docType, docMemo),
+	}, months)
+	if err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
+
+// documentPointsEarned is what an order or sale earned, less what was taken back
+func documentPointsEarned(ctx context.Context, q rowQueryer, docType string, docID int64) (int64, error) {
+	var points int64
+	err := q.QueryRow(ctx, `
+		SELECT COALESCE(SUM(points), 0)
+		FROM loyalty_ledger
+		WHERE document_type = $1 AND document_id = $2 AND entry_type IN ('earn', 'reverse')
+	`, docType, docID).Scan(&points)
+	if err != nil {
+		return 0, fmt.Errorf("load points earned on %s failed: %w", docType, err)
+	}
+	return points, nil
+}
+
+// customerPoints is the points the customer can redeem today
+func customerPoints(ctx context.Context, q rowQueryer, customerID int64) (int64, error) {
+	var points int64
+	err := q.QueryRow(ctx, `SELECT `+loyaltyBalanceSQL+` FROM customers c WHERE c.id = $1`, customerID).Scan(&points)
+	if err != nil {
+		return 0, fmt.Errorf("load customer points failed: %w", err)
+	}
+	return points, nil
+}
+
+// GetLoyaltyPoints lists a customer's points movements between start and end
+// (inclusive) with running balances, after writing off points that expired.
+func (s *CustomerRepo) GetLoyaltyPoints(ctx context.Context, branchID, customerID int64, start, end time.Time) (*models.LoyaltyHistory, error) {
+	h := &models.LoyaltyHistory{
+		CustomerID: customerID,
+		StartDate:  start,
+		EndDate:    end,
+		Entries:    []*models.LoyaltyEntry{},
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var found bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1 AND branch_id = $2)`,
+		customerID, branchID).Scan(&found)
+	if err != nil {
+		return nil, fmt.Errorf("load customer failed: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("customer with id %d not found in this branch", customerID)
+	}
+	if h.Balance, err = lockLoyaltyTx(ctx, tx, customerID, today()); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	rule, err := loyaltyRuleTx(ctx, s.db, branchID, today())
+	if err != nil {
+		return nil, err
+	}
+	if rule != nil {
+		h.PointValue = rule.PointValue
+	}
+	err = s.db.QueryRow(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(points) FROM loyalty_ledger WHERE customer_id = $1 AND entry_date < $2), 0),
+			COALESCE((SELECT SUM(remaining) FROM loyalty_ledger
+			          WHERE customer_id = $1 AND entry_type IN ('earn', 'restore')
+			            AND expires_on BETWEEN $3 AND $3::date + 30), 0)
+	`, customerID, start, today()).Scan(&h.OpeningBalance, &h.ExpiringSoon)
+	if err != nil {
+		return nil, fmt.Errorf("load opening points failed: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, customer_id, branch_id, entry_date, entry_type, points, amount, remaining, expires_on,
+		       document_type, document_id, transaction_id, memo_no, notes, created_at
+		FROM loyalty_ledger
+		WHERE customer_id = $1 AND entry_date BETWEEN $2 AND $3
+		ORDER BY entry_date, id
+	`, customerID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("load loyalty entries failed: %w", err)
+	}
+	defer rows.Close()
+
+	balance := h.OpeningBalance
+	for rows.Next() {
+		e := &models.LoyaltyEntry{}
+		err := rows.Scan(&e.ID, &e.CustomerID, &e.BranchID, &e.EntryDate, &e.EntryType, &e.Points, &e.Amount,
+			&e.Remaining, &e.ExpiresOn, &e.DocumentType, &e.DocumentID, &e.TransactionID, &e.MemoNo, &e.Notes, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan loyalty entry failed: %w", err)
+		}
+		balance += e.Points
+		e.Balance = balance
+		h.Entries = append(h.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loyalty rows failed: %w", err)
+	}
+	h.ClosingBalance = balance
+	return h, nil
+}
@@ -0,0 +1,700 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// ============================== Measurement Repository ==============================
+type MeasurementRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewMeasurementRepo(db *pgxpool.Pool) *MeasurementRepo {
+	return &MeasurementRepo{db: db}
+}
+
+// defaultProfileName is given to the profile created from the customer record
+const defaultProfileName = "Default"
+
+// ============================== Garment Types ==============================
+
+// cleanMeasurementFields trims the field definitions and rejects empty or repeated keys
+func cleanMeasurementFields(fields []models.MeasurementField) ([]models.MeasurementField, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("garment type needs at least one measurement field")
+	}
+	seen := make(map[string]bool)
+	out := make([]models.MeasurementField, 0, len(fields))
+	for _, f := range fields {
+		f.Key = strings.ToLower(strings.TrimSpace(f.Key))
+		f.Label = strings.TrimSpace(f.Label)
+		f.Unit = strings.TrimSpace(f.Unit)
+		if f.Key == "" {
+			return nil, errors.New("measurement field key is required")
+		}
+		if seen[f.Key] {
+			return nil, fmt.Errorf("measurement field %q is listed twice", f.Key)
+		}
+		seen[f.Key] = true
+		if f.Label == "" {
+			f.Label = f.Key
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// ListGarmentTypes returns the garment types of a branch
+func (m *MeasurementRepo) ListGarmentTypes(ctx context.Context, branchID int64) ([]*models.GarmentType, error) {
+	rows, err := m.db.Query(ctx, `
+		SELECT id, branch_id, name, fields, status, created_at, updated_at
+		FROM garment_types
+		WHERE branch_id = $1
+		ORDER BY name
+	`, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("list garment types failed: %w", err)
+	}
+	defer rows.Close()
+
+	types := []*models.GarmentType{}
+	for rows.Next() {
+		g := &models.GarmentType{}
+		if err := rows.Scan(&g.ID, &g.BranchID, &g.Name, &g.Fields, &g.Status, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan garment type failed: %w", err)
+		}
+		types = append(types, g)
+	}
+	return types, rows.Err()
+}
+
+// CreateGarmentType adds a garment type with its measurement fields
+func (m *MeasurementRepo) CreateGarmentType(ctx context.Context, g *models.GarmentType) error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		return errors.New("garment type name is required")
+	}
+	fields, err := cleanMeasurementFields(g.Fields)
+	if err != nil {
+		return err
+	}
+	g.Fields = fields
+
+	err = m.db.QueryRow(ctx, `
+		INSERT INTO garment_types (branch_id, name, fields)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, created_at, updated_at
+	`, g.BranchID, g.Name, g.Fields).Scan(&g.ID, &g.Status, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("garment type %q already exists", g.Name)
+		}
+		return fmt.Errorf("create garment type failed: %w", err)
+	}
+	return nil
+}
+
+// UpdateGarmentType renames a garment type, replaces its fields or (de)activates it.
+// Recorded versions keep the measurements they were taken with.
+func (m *MeasurementRepo) UpdateGarmentType(ctx context.Context, g *models.GarmentType) error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		return errors.New("garment type name is required")
+	}
+	fields, err := cleanMeasurementFields(g.Fields)
+	if err != nil {
+		return err
+	}
+	g.Fields = fields
+
+	err = m.db.QueryRow(ctx, `
+		UPDATE garment_types
+		SET name = $1, fields = $2, status = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND branch_id = $5
+		RETURNING created_at, updated_at
+	`, g.Name, g.Fields, g.Status, g.ID, g.BranchID).Scan(&g.CreatedAt, &g.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("garment type with id %d not found in this branch", g.ID)
+	}
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("garment type %q already exists", g.Name)
+		}
+		return fmt.Errorf("update garment type failed: %w", err)
+	}
+	return nil
+}
+
+// measurementFieldsTx returns the fields of a garment type, or the standard
+// customer measurements when garmentTypeID is nil
+func measurementFieldsTx(ctx context.Context, tx pgx.Tx, branchID int64, garmentTypeID *int64) ([]models.MeasurementField, error) {
+	if garmentTypeID == nil {
+		return models.StandardMeasurementFields, nil
+	}
+	var (
+		fields []models.MeasurementField
+		active bool
+	)
+	err := tx.QueryRow(ctx,
+		`SELECT fields, status FROM garment_types WHERE id = $1 AND branch_id = $2`,
+		*garmentTypeID, branchID,
+	).Scan(&fields, &active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("garment type with id %d not found in this branch", *garmentTypeID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load garment type failed: %w", err)
+	}
+	if !active {
+		return nil, fmt.Errorf("garment type with id %d is inactive", *garmentTypeID)
+	}
+	return fields, nil
+}
+
+// cleanMeasurements trims the values, drops the empty ones and checks them
+// against the fields
+func cleanMeasurements(fields []models.MeasurementField, measurements map[string]string) (map[string]string, error) {
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.Key] = true
+	}
+	out := make(map[string]string, len(measurements))
+	for k, v := range measurements {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !known[k] {
+			return nil, fmt.Errorf("unknown measurement %q", k)
+		}
+		if v = strings.TrimSpace(v); v != "" {
+			out[k] = v
+		}
+	}
+	for _, f := range fields {
+		if f.Required && out[f.Key] == "" {
+			return nil, fmt.Errorf("measurement %q is required", f.Label)
+		}
+	}
+	return out, nil
+}
+
+// ============================== Profiles ==============================
+
+const measurementProfileColumns = `
+	p.id, p.branch_id, p.customer_id, p.name, p.garment_type_id, COALESCE(g.name, ''),
+	p.is_default, p.status, p.notes, p.current_version,
+	COALESCE(v.measurements, '{}'::jsonb), p.created_at, p.updated_at`
+
+const measurementProfileFrom = `
+	FROM measurement_profiles p
+	LEFT JOIN garment_types g ON g.id = p.garment_type_id
+	LEFT JOIN measurement_versions v ON v.profile_id = p.id AND v.version = p.current_version`
+
+func scanMeasurementProfile(row pgx.Row) (*models.MeasurementProfile, error) {
+	p := &models.MeasurementProfile{}
+	err := row.Scan(&p.ID, &p.BranchID, &p.CustomerID, &p.Name, &p.GarmentTypeID, &p.GarmentTypeName,
+		&p.IsDefault, &p.Status, &p.Notes, &p.CurrentVersion,
+		&p.Measurements, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// ListProfiles returns the measurement profiles of a customer, default first
+func (m *MeasurementRepo) ListProfiles(ctx context.Context, branchID, customerID int64) ([]*models.MeasurementProfile, error) {
+	rows, err := m.db.Query(ctx, `SELECT `+measurementProfileColumns+measurementProfileFrom+`
+		WHERE p.customer_id = $1 AND p.branch_id = $2
+		ORDER BY p.is_default DESC, p.status DESC, p.name
+	`, customerID, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("list measurement profiles failed: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := []*models.MeasurementProfile{}
+	for rows.Next() {
+		p, err := scanMeasurementProfile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan measurement profile failed: %w", err)
+		}
+		profiles = append(profiles, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.attachFields(ctx, profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// GetProfile returns one measurement profile with its current measurements
+func (m *MeasurementRepo) GetProfile(ctx context.Context, branchID, profileID int64) (*models.MeasurementProfile, error) {
+	p, err := scanMeasurementProfile(m.db.QueryRow(ctx, `SELECT `+measurementProfileColumns+measurementProfileFrom+`
+		WHERE p.id = $1 AND p.branch_id = $2
+	`, profileID, branchID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("measurement profile with id %d not found in this branch", profileID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load measurement profile failed: %w", err)
+	}
+	if err := m.attachFields(ctx, []*models.MeasurementProfile{p}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// attachFields fills in the measurement fields of each profile's garment type
+func (m *MeasurementRepo) attachFields(ctx context.Context, profiles []*models.MeasurementProfile) error {
+	var ids []int64
+	for _, p := range profiles {
+		if p.GarmentTypeID == nil {
+			p.Fields = models.StandardMeasurementFields
+		} else {
+			ids = append(ids, *p.GarmentTypeID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	rows, err := m.db.Query(ctx, `SELECT id, fields FROM garment_types WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return fmt.Errorf("load garment type fields failed: %w", err)
+	}
+	defer rows.Close()
+	fields := make(map[int64][]models.MeasurementField)
+	for rows.Next() {
+		var id int64
+		var f []models.MeasurementField
+		if err := rows.Scan(&id, &f); err != nil {
+			return fmt.Errorf("scan garment type fields failed: %w", err)
+		}
+		fields[id] = f
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		if p.GarmentTypeID != nil {
+			p.Fields = fields[*p.GarmentTypeID]
+		}
+	}
+	return nil
+}
+
+// CreateProfile adds a measurement profile to a customer with its first version
+func (m *MeasurementRepo) CreateProfile(ctx context.Context, req *models.MeasurementProfileRequest) (*models.MeasurementProfile, error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1 AND branch_id = $2)`,
+		req.CustomerID, req.BranchID,
+	).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("load customer failed: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("customer with id %d not found in this branch", req.CustomerID)
+	}
+
+	profileID, err := createProfileTx(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.IsDefault && req.GarmentTypeID == nil {
+		if err := mirrorDefaultProfileTx(ctx, tx, req.CustomerID, req.Measurements); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return m.GetProfile(ctx, req.BranchID, profileID)
+}
+
+// createProfileTx inserts the profile and records req.Measurements as version 1
+func createProfileTx(ctx context.Context, tx pgx.Tx, req *models.MeasurementProfileRequest) (int64, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return 0, errors.New("profile name is required")
+	}
+	fields, err := measurementFieldsTx(ctx, tx, req.BranchID, req.GarmentTypeID)
+	if err != nil {
+		return 0, err
+	}
+	measurements, err := cleanMeasurements(fields, req.Measurements)
+	if err != nil {
+		return 0, err
+	}
+	req.Measurements = measurements
+
+	if req.IsDefault {
+		_, err = tx.Exec(ctx,
+			`UPDATE measurement_profiles SET is_default = FALSE, updated_at = CURRENT_TIMESTAMP WHERE customer_id = $1 AND is_default`,
+			req.CustomerID,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("clear default profile failed: %w", err)
+		}
+	}
+
+	var profileID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO measurement_profiles (branch_id, customer_id, name, garment_type_id, is_default, notes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, req.BranchID, req.CustomerID, req.Name, req.GarmentTypeID, req.IsDefault, req.Notes).Scan(&profileID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, fmt.Errorf("customer already has a profile named %q", req.Name)
+		}
+		return 0, fmt.Errorf("create measurement profile failed: %w", err)
+	}
+
+	if _, err := insertMeasurementVersionTx(ctx, tx, profileID, measurements, "", req.CreatedBy); err != nil {
+		return 0, err
+	}
+	return profileID, nil
+}
+
+// UpdateProfile renames a profile, makes it the default or (de)activates it.
+// Measurements are changed through AddVersion.
+func (m *MeasurementRepo) UpdateProfile(ctx context.Context, branchID, profileID int64, name, notes string, isDefault, status bool) (*models.MeasurementProfile, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("profile name is required")
+	}
+	if isDefault && !status {
+		return nil, errors.New("the default profile cannot be inactive")
+	}
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	p, err := lockProfileTx(ctx, tx, branchID, profileID)
+	if err != nil {
+		return nil, err
+	}
+	if isDefault && !p.IsDefault {
+		_, err = tx.Exec(ctx,
+			`UPDATE measurement_profiles SET is_default = FALSE, updated_at = CURRENT_TIMESTAMP WHERE customer_id = $1 AND is_default`,
+			p.CustomerID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("clear default profile failed: %w", err)
+		}
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE measurement_profiles
+		SET name = $1, notes = $2, is_default = $3, status = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`, name, notes, isDefault, status, profileID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("customer already has a profile named %q", name)
+		}
+		return nil, fmt.Errorf("update measurement profile failed: %w", err)
+	}
+	if isDefault && !p.IsDefault && p.GarmentTypeID == nil {
+		if err := mirrorDefaultProfileTx(ctx, tx, p.CustomerID, p.Measurements); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return m.GetProfile(ctx, branchID, profileID)
+}
+
+// lockProfileTx locks a profile and loads its current measurements
+func lockProfileTx(ctx context.Context, tx pgx.Tx, branchID, profileID int64) (*models.MeasurementProfile, error) {
+	p := &models.MeasurementProfile{ID: profileID, BranchID: branchID}
+	err := tx.QueryRow(ctx, `
+		SELECT p.customer_id, p.garment_type_id, p.is_default, p.status, p.current_version,
+		       COALESCE((SELECT v.measurements FROM measurement_versions v
+		                 WHERE v.profile_id = p.id AND v.version = p.current_version), '{}'::jsonb)
+		FROM measurement_profiles p
+		WHERE p.id = $1 AND p.branch_id = $2
+		FOR UPDATE
+	`, profileID, branchID).Scan(&p.CustomerID, &p.GarmentTypeID, &p.IsDefault, &p.Status, &p.CurrentVersion, &p.Measurements)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("measurement profile with id %d not found in this branch", profileID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock measurement profile failed: %w", err)
+	}
+	return p, nil
+}
+
+// ============================== Versions ==============================
+
+// AddVersion records new measurements on a profile. The earlier versions are
+// kept; orders made from them still point at them.
+func (m *MeasurementRepo) AddVersion(ctx context.Context, branchID, profileID int64, measurements map[string]string, notes string, createdBy *int64) (*models.MeasurementVersion, error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	p, err := lockProfileTx(ctx, tx, branchID, profileID)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Status {
+		return nil, fmt.Errorf("measurement profile with id %d is inactive", profileID)
+	}
+	fields, err := measurementFieldsTx(ctx, tx, branchID, p.GarmentTypeID)
+	if err != nil {
+		return nil, err
+	}
+	measurements, err = cleanMeasurements(fields, measurements)
+	if err != nil {
+		return nil, err
+	}
+	v, err := insertMeasurementVersionTx(ctx, tx, profileID, measurements, notes, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	if p.IsDefault && p.GarmentTypeID == nil {
+		if err := mirrorDefaultProfileTx(ctx, tx, p.CustomerID, measurements); err != nil {
+			return nil, err
+		}
+	}
+	return v, tx.Commit(ctx)
+}
+
+// insertMeasurementVersionTx appends the next version of a profile and makes it current
+func insertMeasurementVersionTx(ctx context.Context, tx pgx.Tx, profileID int64, measurements map[string]string, notes string, createdBy *int64) (*models.MeasurementVersion, error) {
+	v := &models.MeasurementVersion{ProfileID: profileID, Measurements: measurements, Notes: notes, CreatedBy: createdBy}
+	err := tx.QueryRow(ctx, `
+		UPDATE measurement_profiles
+		SET current_version = current_version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING current_version
+	`, profileID).Scan(&v.Version)
+	if err != nil {
+		return nil, fmt.Errorf("bump profile version failed: %w", err)
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO measurement_versions (profile_id, version, measurements, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, profileID, v.Version, measurements, notes, createdBy).Scan(&v.ID, &v.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert measurement version failed: %w", err)
+	}
+	return v, nil
+}
+
+// GetProfileHistory lists every version of a profile, newest first
+func (m *MeasurementRepo) GetProfileHistory(ctx context.Context, branchID, profileID int64) ([]*models.MeasurementVersion, error) {
+	rows, err := m.db.Query(ctx, `
+		SELECT v.id, v.profile_id, p.name, v.version, v.measurements, v.notes, v.created_by, v.created_at
+		FROM measurement_versions v
+		JOIN measurement_profiles p ON p.id = v.profile_id
+		WHERE v.profile_id = $1 AND p.branch_id = $2
+		ORDER BY v.version DESC
+	`, profileID, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("load measurement history failed: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*models.MeasurementVersion{}
+	for rows.Next() {
+		v := &models.MeasurementVersion{}
+		err := rows.Scan(&v.ID, &v.ProfileID, &v.ProfileName, &v.Version, &v.Measurements, &v.Notes, &v.CreatedBy, &v.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan measurement version failed: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("measurement profile with id %d not found in this branch", profileID)
+	}
+	return versions, nil
+}
+
+// rowQueryer is a pool or a transaction
+type rowQueryer interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// getMeasurementVersion loads one version with its profile name
+func getMeasurementVersion(ctx context.Context, q rowQueryer, versionID int64) (*models.MeasurementVersion, error) {
+	v := &models.MeasurementVersion{}
+	err := q.QueryRow(ctx, `
+		SELECT v.id, v.profile_id, p.name, v.version, v.measurements, v.notes, v.created_by, v.created_at
+		FROM measurement_versions v
+		JOIN measurement_profiles p ON p.id = v.profile_id
+		WHERE v.id = $1
+	`, versionID).Scan(&v.ID, &v.ProfileID, &v.ProfileName, &v.Version, &v.Measurements, &v.Notes, &v.CreatedBy, &v.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("load measurement version failed: %w", err)
+	}
+	return v, nil
+}
+
+// ============================== Customer record ==============================
+
+// customerMeasurements reads the measurement columns of the customer record
+func customerMeasurements(c *models.Customer) map[string]string {
+	values := map[string]string{
+		"length":        c.Length,
+		"shoulder":      c.Shoulder,
+		"bust":          c.Bust,
+		"waist":         c.Waist,
+		"hip":           c.Hip,
+		"arm_hole":      c.ArmHole,
+		"sleeve_length": c.SleeveLength,
+		"sleeve_width":  c.SleeveWidth,
+		"round_width":   c.RoundWidth,
+	}
+	out := make(map[string]string)
+	for k, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// mirrorDefaultProfileTx copies the default profile's measurements to the
+// customer record, which older screens still read
+func mirrorDefaultProfileTx(ctx context.Context, tx pgx.Tx, customerID int64, measurements map[string]string) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE customers
+		SET length = $1, shoulder = $2, bust = $3, waist = $4, hip = $5,
+		    arm_hole = $6, sleeve_length = $7, sleeve_width = $8, round_width = $9,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $10
+	`,
+		measurements["length"], measurements["shoulder"], measurements["bust"], measurements["waist"], measurements["hip"],
+		measurements["arm_hole"], measurements["sleeve_length"], measurements["sleeve_width"], measurements["round_width"],
+		customerID,
+	)
+	if err != nil {
+		return fmt.Errorf("update customer measurements failed: %w", err)
+	}
+	return nil
+}
+
+// syncDefaultProfileTx records the measurements saved on the customer record as
+// a new version of the customer's default profile, creating the profile the
+// first time. Nothing is recorded when they did not change.
+func syncDefaultProfileTx(ctx context.Context, tx pgx.Tx, c *models.Customer) error {
+	measurements := customerMeasurements(c)
+
+	var (
+		profileID     int64
+		garmentTypeID *int64
+		current       map[string]string
+	)
+	err := tx.QueryRow(ctx, `
+		SELECT p.id, p.garment_type_id,
+		       COALESCE((SELECT v.measurements FROM measurement_versions v
+		                 WHERE v.profile_id = p.id AND v.version = p.current_version), '{}'::jsonb)
+		FROM measurement_profiles p
+		WHERE p.customer_id = $1 AND p.is_default
+		FOR UPDATE
+	`, c.ID).Scan(&profileID, &garmentTypeID, &current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if len(measurements) == 0 {
+			return nil
+		}
+		_, err = createProfileTx(ctx, tx, &models.MeasurementProfileRequest{
+			BranchID:     c.BranchID,
+			CustomerID:   c.ID,
+			Name:         defaultProfileName,
+			IsDefault:    true,
+			Measurements: measurements,
+		})
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("load default profile failed: %w", err)
+	}
+	// a default profile of another garment type is not kept on the customer record
+	if garmentTypeID != nil || maps.Equal(current, measurements) {
+		return nil
+	}
+	_, err = insertMeasurementVersionTx(ctx, tx, profileID, measurements, "Updated from the customer record", nil)
+	return err
+}
+
+// ============================== Orders ==============================
+
+// resolveOrderMeasurementTx picks the measurements an order is made from: the
+// given version, the current version of the given profile, or else the current
+// version of the customer's default profile. Both ids are nil when the
+// customer has no measurements.
+func resolveOrderMeasurementTx(ctx context.Context, tx pgx.Tx, branchID, customerID int64, profileID, versionID *int64) (*int64, *int64, error) {
+	var (
+		pID, vID int64
+		err      error
+	)
+	switch {
+	case versionID != nil:
+		err = tx.QueryRow(ctx, `
+			SELECT p.id, v.id
+			FROM measurement_versions v
+			JOIN measurement_profiles p ON p.id = v.profile_id
+			WHERE v.id = $1 AND p.customer_id = $2 AND p.branch_id = $3
+		`, *versionID, customerID, branchID).Scan(&pID, &vID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, fmt.Errorf("measurement version with id %d does not belong to this customer", *versionID)
+		}
+		if err == nil && profileID != nil && *profileID != pID {
+			return nil, nil, fmt.Errorf("measurement version with id %d is not from profile %d", *versionID, *profileID)
+		}
+	case profileID != nil:
+		var active bool
+		err = tx.QueryRow(ctx, `
+			SELECT p.id, v.id, p.status
+			FROM measurement_profiles p
+			JOIN measurement_versions v ON v.profile_id = p.id AND v.version = p.current_version
+			WHERE p.id = $1 AND p.customer_id = $2 AND p.branch_id = $3
+		`, *profileID, customerID, branchID).Scan(&pID, &vID, &active)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, fmt.Errorf("measurement profile with id %d does not belong to this customer", *profileID)
+		}
+		if err == nil && !active {
+			return nil, nil, fmt.Errorf("measurement profile with id %d is inactive", *profileID)
+		}
+	default:
+		err = tx.QueryRow(ctx, `
+			SELECT p.id, v.id
+			FROM measurement_profiles p
+			JOIN measurement_versions v ON v.profile_id = p.id AND v.version = p.current_version
+			WHERE p.customer_id = $1 AND p.branch_id = $2 AND p.is_default
+		`, customerID, branchID).Scan(&pID, &vID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, nil
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve order measurements failed: %w", err)
+	}
+	return &pID, &vID, nil
+}
@@ -0,0 +1,168 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// ============================== Memo Sequences ==============================
+type MemoRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewMemoRepo(db *pgxpool.Pool) *MemoRepo {
+	return &MemoRepo{db: db}
+}
+
+// memoPrefix is what a sequence prefix may hold
+var memoPrefix = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9/_-]{0,29}$`)
+
+// formatMemoNo writes number n of a sequence
+func formatMemoNo(s *models.MemoSequence, year int, n int64) string {
+	if s.Yearly {
+		return fmt.Sprintf("%s-%04d-%0*d", s.Prefix, year, s.Padding, n)
+	}
+	return fmt.Sprintf("%s-%0*d", s.Prefix, s.Padding, n)
+}
+
+// counterYear is the counter a document dated date draws from
+func counterYear(s *models.MemoSequence, date time.Time) int {
+	if s.Yearly {
+		return date.Year()
+	}
+	return 0
+}
+
+// dbExecer runs statements on the pool or in a transaction
+type dbExecer interface {
+	rowQueryer
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// memoSequenceTx loads how the branch numbers docType, creating the default
+// sequence (the branch's first word and the document code, e.g. DIVA-OR) the
+// first time it is used
+func memoSequenceTx(ctx context.Context, q dbExecer, branchID int64, docType string) (*models.MemoSequence, error) {
+	code, ok := models.MemoDocumentCodes[docType]
+	if !ok {
+		return nil, fmt.Errorf("no memo sequence for %q", docType)
+	}
+	_, err := q.Exec(ctx, `
+		INSERT INTO memo_sequences (branch_id, document_type, prefix)
+		SELECT id, $2, upper(split_part(btrim(name), ' ', 1)) || '-' || $3
+		FROM branches
+		WHERE id = $1
+		ON CONFLICT (branch_id, document_type) DO NOTHING
+	`, branchID, docType, code)
+	if err != nil {
+		return nil, fmt.Errorf("create memo sequence failed: %w", err)
+	}
+
+	s := &models.MemoSequence{BranchID: branchID, DocumentType: docType}
+	err = q.QueryRow(ctx, `
+		SELECT prefix, padding, yearly, updated_at
+		FROM memo_sequences
+		WHERE branch_id = $1 AND document_type = $2
+	`, branchID, docType).Scan(&s.Prefix, &s.Padding, &s.Yearly, &s.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("branch %d not found", branchID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load memo sequence failed: %w", err)
+	}
+	return s, nil
+}
+
+// NextMemoNoTx takes the next number of the branch's docType sequence for a
+// document dated date. The counter stays locked until tx ends and goes back
+// if tx rolls back, so numbers are given out in order without gaps.
+func NextMemoNoTx(ctx context.Context, tx pgx.Tx, branchID int64, docType string, date time.Time) (string, error) {
+	s, err := memoSequenceTx(ctx, tx, branchID, docType)
+	if err != nil {
+		return "", err
+	}
+	year := counterYear(s, date)
+	var n int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO memo_counters (branch_id, document_type, year, last_value)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (branch_id, document_type, year)
+		DO UPDATE SET last_value = memo_counters.last_value + 1
+		RETURNING last_value
+	`, branchID, docType, year).Scan(&n)
+	if err != nil {
+		return "", fmt.Errorf("take memo number failed: %w", err)
+	}
+	return formatMemoNo(s, date.Year(), n), nil
+}
+
+// ListSequences returns how the branch numbers each type of document, with
+// the number the next document dated today would get
+func (m *MemoRepo) ListSequences(ctx context.Context, branchID int64) ([]*models.MemoSequence, error) {
+	out := make([]*models.MemoSequence, 0, len(models.MemoDocumentCodes))
+	for _, docType := range []string{
+		models.MEMO_ORDER, models.MEMO_SALE, models.MEMO_PURCHASE, models.MEMO_SALARY, models.MEMO_REFUND,
+		models.MEMO_TRANSFER, models.MEMO_PAYMENT, models.MEMO_STORE_CREDIT, models.MEMO_RESTOCK, models.MEMO_VOUCHER,
+		models.MEMO_LOYALTY, models.MEMO_SUPPLIER_PAYMENT,
+	} {
+		s, err := m.sequence(ctx, branchID, docType)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// sequence loads one sequence with its counter for today
+func (m *MemoRepo) sequence(ctx context.Context, branchID int64, docType string) (*models.MemoSequence, error) {
+	s, err := memoSequenceTx(ctx, m.db, branchID, docType)
+	if err != nil {
+		return nil, err
+	}
+	today := time.Now()
+	err = m.db.QueryRow(ctx, `
+		SELECT COALESCE((
+			SELECT last_value FROM memo_counters
+			WHERE branch_id = $1 AND document_type = $2 AND year = $3
+		), 0)
+	`, branchID, docType, counterYear(s, today)).Scan(&s.LastValue)
+	if err != nil {
+		return nil, fmt.Errorf("load memo counter failed: %w", err)
+	}
+	s.NextMemoNo = formatMemoNo(s, today.Year(), s.LastValue+1)
+	return s, nil
+}
+
+// SetSequence changes how the branch numbers docType. The count carries on;
+// numbers already given out keep their old form.
+func (m *MemoRepo) SetSequence(ctx context.Context, branchID int64, docType, prefix string, padding int, yearly bool) (*models.MemoSequence, error) {
+	prefix = strings.TrimSpace(prefix)
+	if !memoPrefix.MatchString(prefix) {
+		return nil, errors.New("prefix must be 1 to 30 letters, digits, '-', '_' or '/'")
+	}
+	if padding < 1 || padding > 12 {
+		return nil, errors.New("padding must be between 1 and 12 digits")
+	}
+	if _, err := memoSequenceTx(ctx, m.db, branchID, docType); err != nil {
+		return nil, err
+	}
+	_, err := m.db.Exec(ctx, `
+		UPDATE memo_sequences
+		SET prefix = $3, padding = $4, yearly = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE branch_id = $1 AND document_type = $2
+	`, branchID, docType, prefix, padding, yearly)
+	if err != nil {
+		return nil, fmt.Errorf("update memo sequence failed: %w", err)
+	}
+	return m.sequence(ctx, branchID, docType)
+}
@@ -2,12 +2,15 @@ package dbrepo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
 )
 
 type OrderRepo struct {
@@ -18,6 +21,13 @@ func NewOrderRepo(db *pgxpool.Pool) *OrderRepo {
 	return &OrderRepo{db: db}
 }
 
+var (
+	// ErrOrderNotFound is returned when the order does not exist in the branch
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderNotCancellable is returned when the order or the cancel date does not allow cancelling it
+	ErrOrderNotCancellable = errors.New("order cannot be cancelled")
+)
+
 // CreateOrder inserts an order, its items, payment transaction,
 // updates top sheet, customer due, and salesperson progress.
 func (r *OrderRepo) CreateOrder(ctx context.Context, order *models.OrderDB) (int64, error) {
@@ -33,13 +43,52 @@ func (r *OrderRepo) CreateOrder(ctx context.Context, order *models.OrderDB) (int
 	if len(order.Items) == 0 {
 		return 0, fmt.Errorf("order must contain at least one item")
 	}
-	if order.ReceivedAmount < 0 {
+	if err := applyOrderDiscountsTx(ctx, tx, order, nil); err != nil {
+		return 0, err
+	}
+	if err := applyOrderTaxesTx(ctx, tx, order, nil); err != nil {
+		return 0, err
+	}
+	if order.ReceivedAmount < 0 || order.StoreCreditAmount < 0 {
 		return 0, fmt.Errorf("received amount cannot be negative")
 	}
-	if order.ReceivedAmount > order.TotalAmount {
-		return 0, fmt.Errorf("received amount cannot exceed total amount")
+	payments, err := normalizePayments(&order.PaymentAccountID, &order.ReceivedAmount, order.Payments)
+	if err != nil {
+		return 0, err
+	}
+	if order.StoreCreditAmount > order.TotalAmount {
+		return 0, fmt.Errorf("store credit cannot exceed total amount")
+	}
+	voucherAmount, err := voucherTotal(order.Vouchers)
+	if err != nil {
+		return 0, err
+	}
+	loyaltyAmount, err := loyaltyPaymentTx(ctx, tx, order.BranchID, order.CustomerID, order.LoyaltyPoints, order.OrderDate)
+	if err != nil {
+		return 0, err
+	}
+	if order.StoreCreditAmount+voucherAmount+loyaltyAmount > order.TotalAmount {
+		return 0, fmt.Errorf("store credit, gift vouchers and loyalty points cannot exceed total amount")
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, order.BranchID, order.OrderDate); err != nil {
+		return 0, err
 	}
 
+	// money received beyond the order total is kept as store credit
+	appliedAmount := min(order.ReceivedAmount, order.TotalAmount-order.StoreCreditAmount-voucherAmount-loyaltyAmount)
+	order.ReceivedAmount = appliedAmount + order.StoreCreditAmount + voucherAmount + loyaltyAmount
+
+	override, err := checkCreditLimitTx(ctx, tx, order.BranchID, order.CustomerID, order.TotalAmount-order.ReceivedAmount, order.CreditOverride)
+	if err != nil {
+		return 0, err
+	}
+	order.MeasurementProfileID, order.MeasurementVersionID, err = resolveOrderMeasurementTx(ctx, tx,
+		order.BranchID, order.CustomerID, order.MeasurementProfileID, order.MeasurementVersionID)
+	if err != nil {
+		return 0, err
+	}
+	overrideBy, overrideReason := creditOverrideColumns(override)
+
 	// --------------------
 	// Calculate total items
 	// --------------------
@@ -47,6 +96,11 @@ func (r *OrderRepo) CreateOrder(ctx context.Context, order *models.OrderDB) (int
 		order.TotalItems += int64(item.Quantity)
 	}
 
+	// always the next memo number of the branch; one sent by the client is ignored
+	if order.MemoNo, err = NextMemoNoTx(ctx, tx, order.BranchID, models.MEMO_ORDER, order.OrderDate); err != nil {
+		return 0, err
+	}
+
 	// --------------------
 	// Step 1: Insert order
 	// --------------------
@@ -56,9 +110,11 @@ func (r *OrderRepo) CreateOrder(ctx context.Context, order *models.OrderDB) (int
 			branch_id, memo_no, order_date, delivery_date,
 			salesperson_id, customer_id,
 			total_products, delivered_products, total_amount, received_amount,
-			status, notes, created_at, updated_at
+			status, notes, created_at, updated_at,
+			credit_override_by, credit_override_reason,
+			measurement_profile_id, measurement_version_id
 		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)
 		RETURNING id
 	`,
 		order.BranchID,
@@ -75,6 +131,10 @@ func (r *OrderRepo) CreateOrder(ctx context.Context, order *models.OrderDB) (int
 		order.Notes,
 		order.CreatedAt,
 		order.UpdatedAt,
+		overrideBy,
+		overrideReason,
+		order.MeasurementProfileID,
+		order.MeasurementVersionID,
 	).Scan(&orderID)
 	if err != nil {
 		return 0, fmt.Errorf("insert order failed: %w", err)
@@ -83,19 +143,20 @@ func (r *OrderRepo) CreateOrder(ctx context.Context, order *models.OrderDB) (int
 	// --------------------
 	// Step 2: Insert order items
 	// --------------------
-	for _, item := range order.Items {
-		_, err := tx.Exec(ctx, `
-			INSERT INTO order_items(order_id, product_id, quantity, subtotal)
-			VALUES ($1,$2,$3,$4)
-		`,
-			orderID,
-			item.ProductID,
-			item.Quantity,
-			item.Subtotal,
-		)
-		if err != nil {
-			return 0, fmt.Errorf("insert order item failed: %w", err)
-		}
+	order.ID = orderID
+	for i := range order.Items {
+		order.Items[i].ID = 0
+	}
+	if err := saveOrderItemsTx(ctx, tx, order); err != nil {
+		return 0, err
+	}
+	err = saveDocumentDiscountsTx(ctx, tx, models.DOCUMENT_ORDER, order.ID, order.BranchID, order.CustomerID,
+		order.MemoNo, order.OrderDate, &order.DocumentDiscounts)
+	if err != nil {
+		return 0, err
+	}
+	if err := saveDocumentTaxesTx(ctx, tx, models.DOCUMENT_ORDER, order.ID, order.BranchID, order.OrderDate, &order.DocumentTax); err != nil {
+		return 0, err
 	}
 
 	// --------------------
@@ -107,21 +168,51 @@ func (r *OrderRepo) CreateOrder(ctx context.Context, order *models.OrderDB) (int
 		OrderCount: order.TotalItems, // total items ordered
 	}
 
-	var acctType string
-	if order.ReceivedAmount > 0 {
-		err = tx.QueryRow(ctx,
-			`SELECT type FROM accounts WHERE id=$1 AND branch_id=$2`,
-			order.PaymentAccountID,
-			order.BranchID,
-		).Scan(&acctType)
-		if err != nil {
-			return 0, fmt.Errorf("lookup account type failed: %w", err)
+	// --------------------
+	// Step 4: Payment transactions, one per payment
+	// --------------------
+	// the part of each payment beyond the order total is kept as store credit
+	applied := make([]money.Amount, len(payments))
+	left := appliedAmount
+	for i, pay := range payments {
+		applied[i] = min(pay.Amount, left)
+		left -= applied[i]
+	}
+	transactionIDs, err := postPaymentsTx(ctx, tx, paymentPosting{
+		docType:     models.DOCUMENT_ORDER,
+		docID:       orderID,
+		branchID:    order.BranchID,
+		customerID:  order.CustomerID,
+		date:        order.OrderDate,
+		memoNo:      order.MemoNo,
+		deliveredBy: order.SalespersonID,
+		quantity:    order.DeliveredItems,
+		txType:      models.ADVANCE_PAYMENT,
+		notes:       "Advance payment from customer",
+	}, payments, applied, topSheet)
+	if err != nil {
+		return 0, err
+	}
+	for i, pay := range payments {
+		overpaid := pay.Amount - applied[i]
+		if overpaid <= 0 {
+			continue
 		}
-
-		if acctType == models.ACCOUNT_BANK {
-			topSheet.Bank = order.ReceivedAmount
-		} else {
-			topSheet.Cash = order.ReceivedAmount
+		docType := models.DOCUMENT_ORDER
+		err = postStoreCreditTx(ctx, tx, &models.StoreCreditEntry{
+			BranchID:      order.BranchID,
+			CustomerID:    order.CustomerID,
+			EntryDate:     order.OrderDate,
+			EntryType:     models.STORE_CREDIT_OVERPAYMENT,
+			Amount:        overpaid,
+			AccountID:     &payments[i].AccountID,
+			DocumentType:  &docType,
+			DocumentID:    &orderID,
+			TransactionID: &transactionIDs[i],
+			Notes:         "Paid above the total of order " + order.MemoNo,
+		})
+		if err != nil {
+			return 0, err
 		}
 	}
 
@@ -130,76 +221,32 @@ func (r *OrderRepo) CreateOrder(ctx context.Context, order *models.OrderDB) (int
 	}
 
 	// --------------------
-	// Step 4: Payment transactions
+	// Step 4e: Payment from store credit
 	// --------------------
-	if order.ReceivedAmount > 0 {
-		// lock account row
-		_, err := tx.Exec(ctx,
-			`SELECT id FROM accounts WHERE id=$1 FOR UPDATE`,
-			order.PaymentAccountID,
-		)
-		if err != nil {
-			return 0, fmt.Errorf("lock account failed: %w", err)
-		}
-
-		// 4a: order payment transaction
-		_, err = tx.Exec(ctx, `
-			INSERT INTO order_transactions(
-				order_id, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
-				amount, transaction_type
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-		`,
-			orderID,
-			order.OrderDate,
-			order.PaymentAccountID,
-			order.MemoNo,
-			order.SalespersonID,
-			order.DeliveredItems,
-			order.ReceivedAmount,
-			models.ADVANCE_PAYMENT,
-		)
+	if order.StoreCreditAmount > 0 {
+		err = spendStoreCreditTx(ctx, tx, order.BranchID, order.CustomerID, models.DOCUMENT_ORDER, orderID, order.MemoNo,
+			order.OrderDate, order.SalespersonID, order.StoreCreditAmount)
 		if err != nil {
-			return 0, fmt.Errorf("insert payment transaction failed (4a): %w", err)
+			return 0, err
 		}
+	}
 
-		// 4b: global transaction log
-		_, err = tx.Exec(ctx, `
-			INSERT INTO transactions(
-				transaction_date, memo_no, branch_id,
-				from_entity_id, from_entity_type,
-				to_entity_id, to_entity_type,
-				amount, transaction_type, notes
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-		`,
-			order.OrderDate,
-			models.ORDER_MEMO_PREFIX+"-"+order.MemoNo,
-			order.BranchID,
-			order.CustomerID,
-			models.ENTITY_CUSTOMER,
-			order.PaymentAccountID,
-			models.ENTITY_ACCOUNT,
-			order.ReceivedAmount,
-			models.ADVANCE_PAYMENT,
-			"Advance payment from customer",
-		)
-		if err != nil {
-			return 0, fmt.Errorf("insert transaction failed (4b): %w", err)
-		}
+	// --------------------
+	// Step 4f: Payment from gift vouchers
+	// --------------------
+	err = redeemVouchersTx(ctx, tx, order.BranchID, order.Vouchers, models.DOCUMENT_ORDER, orderID, order.MemoNo,
+		order.OrderDate, order.SalespersonID)
+	if err != nil {
+		return 0, err
+	}
 
-		// 4c: update account balance
-		_, err = tx.Exec(ctx, `
-			UPDATE accounts
-			SET current_balance = current_balance + $1
-			WHERE id = $2
-		`,
-			order.ReceivedAmount,
-			order.PaymentAccountID,
-		)
-		if err != nil {
-			return 0, fmt.Errorf("update account balance failed: %w", err)
-		}
+	// --------------------
+	// Step 4g: Payment with loyalty points
+	// --------------------
+	err = redeemLoyaltyTx(ctx, tx, order.BranchID, order.CustomerID, models.DOCUMENT_ORDER, orderID, order.MemoNo,
+		order.OrderDate, order.SalespersonID, order.LoyaltyPoints, loyaltyAmount)
+	if err != nil {
+		return 0, err
 	}
 
 	// --------------------
@@ -266,12 +313,103 @@ func (r *OrderRepo) UpdateOrder(ctx context.Context, order, oldOrder *models.Ord
 	if len(order.Items) == 0 {
 		return fmt.Errorf("order must contain at least one item")
 	}
+	if err := applyOrderDiscountsTx(ctx, tx, order, oldOrder); err != nil {
+		return err
+	}
+	if err := applyOrderTaxesTx(ctx, tx, order, oldOrder); err != nil {
+		return err
+	}
 	if order.ReceivedAmount < 0 {
 		return fmt.Errorf("received amount cannot be negative")
 	}
+	payments, err := normalizePayments(&order.PaymentAccountID, &order.ReceivedAmount, order.Payments)
+	if err != nil {
+		return err
+	}
 	if order.ReceivedAmount > order.TotalAmount {
 		return fmt.Errorf("received amount cannot exceed total amount")
 	}
+	if len(order.Vouchers) > 0 {
+		return fmt.Errorf("gift vouchers can only be redeemed on an existing order through /vouchers/redeem")
+	}
+	if order.LoyaltyPoints != 0 {
+		return fmt.Errorf("loyalty points can only be redeemed when the order is placed")
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, oldOrder.BranchID, oldOrder.OrderDate, order.OrderDate); err != nil {
+		return err
+	}
+	// the memo number is kept from the sequence
+	order.MemoNo = oldOrder.MemoNo
+	// the edit re-creates the cash advance only; store credit, voucher and points movements would be lost
+	var storeCreditUsed bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM order_transactions WHERE order_id = $1 AND payment_account_id IS NULL)`,
+		oldOrder.ID,
+	).Scan(&storeCreditUsed)
+	if err != nil {
+		return fmt.Errorf("check store credit failed: %w", err)
+	}
+	if storeCreditUsed {
+		return fmt.Errorf("order paid with store credit, a gift voucher or loyalty points cannot be edited; cancel it and place a new order")
+	}
+	// payments received after the order was placed stay with it
+	laterPaid, firstPaidOn, err := laterPaymentsTx(ctx, tx, models.DOCUMENT_ORDER, oldOrder.ID, models.ADVANCE_PAYMENT, oldOrder.MemoNo)
+	if err != nil {
+		return err
+	}
+	if laterPaid != 0 {
+		if order.CustomerID != oldOrder.CustomerID {
+			return fmt.Errorf("the customer of an order with payments received after it was placed cannot be changed")
+		}
+		if order.OrderDate.After(*firstPaidOn) {
+			return fmt.Errorf("order date cannot be after its first later payment on %s", firstPaidOn.Format("2006-01-02"))
+		}
+		order.ReceivedAmount += laterPaid
+		if order.ReceivedAmount > order.TotalAmount {
+			return fmt.Errorf("advance and the %s received later cannot exceed total amount", laterPaid)
+		}
+	}
+	// an installment plan schedules the end of the total; the part before it
+	// must be received already and no installment may fall before the order
+	plan, err := loadInstallments(ctx, tx, oldOrder.ID)
+	if err != nil {
+		return err
+	}
+	if len(plan) > 0 {
+		var planTotal money.Amount
+		for _, in := range plan {
+			planTotal += in.Amount
+		}
+		if outside := order.TotalAmount - planTotal; outside < 0 || outside > order.ReceivedAmount {
+			return fmt.Errorf("the installment plan of %s does not fit a total of %s with %s received; change the advance or the plan first",
+				planTotal, order.TotalAmount, order.ReceivedAmount)
+		}
+		if plan[0].DueDate.Before(order.OrderDate) {
+			return fmt.Errorf("order date cannot be after its first installment due on %s", plan[0].DueDate.Format("2006-01-02"))
+		}
+	}
+	// the credit limit is checked against what the edit adds to the customer's due
+	addedDue := order.TotalAmount - order.ReceivedAmount
+	if order.CustomerID == oldOrder.CustomerID {
+		addedDue -= oldOrder.TotalAmount - oldOrder.ReceivedAmount
+	}
+	override, err := checkCreditLimitTx(ctx, tx, oldOrder.BranchID, order.CustomerID, addedDue, order.CreditOverride)
+	if err != nil {
+		return err
+	}
+	overrideBy, overrideReason := creditOverrideColumns(override)
+
+	// keep the measurements the order was made from unless others are picked
+	// or the order moves to another customer
+	if order.MeasurementProfileID == nil && order.MeasurementVersionID == nil && order.CustomerID == oldOrder.CustomerID {
+		order.MeasurementProfileID, order.MeasurementVersionID = oldOrder.MeasurementProfileID, oldOrder.MeasurementVersionID
+	} else {
+		order.MeasurementProfileID, order.MeasurementVersionID, err = resolveOrderMeasurementTx(ctx, tx,
+			oldOrder.BranchID, order.CustomerID, order.MeasurementProfileID, order.MeasurementVersionID)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Recalculate total items for the new order state
 	order.TotalItems = 0
@@ -288,7 +426,10 @@ func (r *OrderRepo) UpdateOrder(ctx context.Context, order, oldOrder *models.Ord
 			salesperson_id = $4, customer_id = $5,
 			total_products = $6, delivered_products = $7,
 			total_amount = $8, received_amount = $9,
-			notes = $10, updated_at = CURRENT_TIMESTAMP
+			notes = $10, updated_at = CURRENT_TIMESTAMP,
+			measurement_profile_id = $12, measurement_version_id = $13,
+			credit_override_by = COALESCE($14, credit_override_by),
+			credit_override_reason = COALESCE($15, credit_override_reason)
 		WHERE id = $11
 	`,
 		order.MemoNo, order.OrderDate, order.DeliveryDate,
@@ -296,27 +437,26 @@ func (r *OrderRepo) UpdateOrder(ctx context.Context, order, oldOrder *models.Ord
 		order.TotalItems, order.DeliveredItems,
 		order.TotalAmount, order.ReceivedAmount,
 		order.Notes, order.ID,
+		order.MeasurementProfileID, order.MeasurementVersionID,
+		overrideBy, overrideReason,
 	)
 	if err != nil {
 		return fmt.Errorf("update order header failed: %w", err)
 	}
 
 	// --------------------
-	// 3. Replace Order Items
+	// 3. Save Order Items (kept items are updated in place)
 	// --------------------
-	_, err = tx.Exec(ctx, `DELETE FROM order_items WHERE order_id=$1`, order.ID)
+	if err := saveOrderItemsTx(ctx, tx, order); err != nil {
+		return err
+	}
+	err = saveDocumentDiscountsTx(ctx, tx, models.DOCUMENT_ORDER, order.ID, oldOrder.BranchID, order.CustomerID,
+		order.MemoNo, order.OrderDate, &order.DocumentDiscounts)
 	if err != nil {
-		return fmt.Errorf("delete old items failed: %w", err)
+		return err
 	}
-
-	for _, item := range order.Items {
-		_, err := tx.Exec(ctx, `
-			INSERT INTO order_items(order_id, product_id, quantity, subtotal)
-			VALUES ($1,$2,$3,$4)
-		`, order.ID, item.ProductID, item.Quantity, item.Subtotal)
-		if err != nil {
-			return fmt.Errorf("insert new item failed: %w", err)
-		}
+	if err := saveDocumentTaxesTx(ctx, tx, models.DOCUMENT_ORDER, order.ID, oldOrder.BranchID, order.OrderDate, &order.DocumentTax); err != nil {
+		return err
 	}
 
 	// =========================================================================
@@ -325,51 +465,47 @@ func (r *OrderRepo) UpdateOrder(ctx context.Context, order, oldOrder *models.Ord
 	// =========================================================================
 
 	// --------------------
-	// 4. Handle Top Sheet (Daily Summary)
+	// 4. Handle Top Sheet (Daily Summary) and Payments
 	// --------------------
 
-	// 4a. Revert Old (Subtract from OLD Date)
+	// 4a. Revert Old (Subtract from OLD Date, take back the old advance)
 	oldSheet := &models.TopSheetDB{
 		SheetDate:  oldOrder.OrderDate,
 		BranchID:   oldOrder.BranchID,
 		OrderCount: -oldOrder.TotalItems, // Negative to subtract
 	}
-	// Determine old account type for Top Sheet
-	if oldOrder.ReceivedAmount > 0 && len(oldOrder.OrderTransactions) > 0 {
-		var oldAcctType string
-		// Try to get account from old transaction, fallback to order struct
-		acctID := oldOrder.OrderTransactions[0].PaymentAccountID
-
-		err = tx.QueryRow(ctx, `SELECT type FROM accounts WHERE id=$1`, acctID).Scan(&oldAcctType)
-		if err == nil {
-			if oldAcctType == models.ACCOUNT_BANK {
-				oldSheet.Bank = -oldOrder.ReceivedAmount
-			} else {
-				oldSheet.Cash = -oldOrder.ReceivedAmount
-			}
-		}
+	if err := revertPaymentsTx(ctx, tx, models.DOCUMENT_ORDER, order.ID, models.ADVANCE_PAYMENT, oldOrder.MemoNo, oldSheet); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM transactions WHERE memo_no=$1 AND branch_id=$2 AND transaction_type=$3`,
+		models.ORDER_MEMO_PREFIX+"-"+oldOrder.MemoNo, oldOrder.BranchID, models.ADVANCE_PAYMENT)
+	if err != nil {
+		return fmt.Errorf("delete old global tx failed: %w", err)
 	}
 	if err := SaveTopSheetTx(tx, ctx, oldSheet); err != nil {
 		return fmt.Errorf("revert top sheet failed: %w", err)
 	}
 
-	// 4b. Apply New (Add to NEW Date)
+	// 4b. Apply New (Add to NEW Date, post the new advance)
 	newSheet := &models.TopSheetDB{
 		SheetDate:  order.OrderDate,
 		BranchID:   order.BranchID,
 		OrderCount: order.TotalItems,
 	}
-	var newAcctType string // Needed later for transaction logs too
-	if order.ReceivedAmount > 0 {
-		err = tx.QueryRow(ctx, `SELECT type FROM accounts WHERE id=$1`, order.PaymentAccountID).Scan(&newAcctType)
-		if err != nil {
-			return fmt.Errorf("lookup new account type failed: %w", err)
-		}
-		if newAcctType == models.ACCOUNT_BANK {
-			newSheet.Bank = order.ReceivedAmount
-		} else {
-			newSheet.Cash = order.ReceivedAmount
-		}
+	_, err = postPaymentsTx(ctx, tx, paymentPosting{
+		docType:     models.DOCUMENT_ORDER,
+		docID:       order.ID,
+		branchID:    order.BranchID,
+		customerID:  order.CustomerID,
+		date:        order.OrderDate,
+		memoNo:      order.MemoNo,
+		deliveredBy: order.SalespersonID,
+		quantity:    order.DeliveredItems,
+		txType:      models.ADVANCE_PAYMENT,
+		notes:       "Advance payment (Updated)",
+	}, payments, nil, newSheet)
+	if err != nil {
+		return err
 	}
 	if err := SaveTopSheetTx(tx, ctx, newSheet); err != nil {
 		return fmt.Errorf("apply top sheet failed: %w", err)
@@ -438,288 +574,133 @@ func (r *OrderRepo) UpdateOrder(ctx context.Context, order, oldOrder *models.Ord
 	}
 
 	// --------------------
-	// 7. Handle Financials (Payments)
+	// 7. Loyalty points of the order as it is now
 	// --------------------
+	if err := syncLoyaltyTx(ctx, tx, models.DOCUMENT_ORDER, oldOrder.ID, order.OrderDate); err != nil {
+		return err
+	}
 
-	// 7a. Revert Old Payment (If existed)
-	if oldOrder.ReceivedAmount > 0 && len(oldOrder.OrderTransactions) > 0 {
-		oldAcctID := oldOrder.OrderTransactions[0].PaymentAccountID
+	return tx.Commit(ctx)
+}
 
-		// Refund the money from the Old Account
-		_, err = tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance - $1 WHERE id = $2`,
-			oldOrder.ReceivedAmount, oldAcctID)
-		if err != nil {
-			return fmt.Errorf("revert old account balance failed: %w", err)
-		}
+// CancelOrder cancels an order that has nothing delivered yet. The
+// cancellation is booked on cancelDate: the salesperson's sale is reversed,
+// the unpaid part comes off the customer's due and whatever the customer paid
+// is kept for them as store credit.
+func (r *OrderRepo) CancelOrder(ctx context.Context, branchID, orderID int64, cancelDate time.Time, reason string) (*models.StoreCreditEntry, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
 
-		// Delete Old Logs
-		_, err = tx.Exec(ctx, `DELETE FROM order_transactions WHERE order_id=$1 AND transaction_type=$2`,
-			order.ID, models.ADVANCE_PAYMENT)
-		if err != nil {
-			return fmt.Errorf("delete old order tx failed: %w", err)
-		}
+	// --------------------
+	// 1. Basic Validations
+	// --------------------
+	var order models.OrderDB
+	err = tx.QueryRow(ctx, `
+		SELECT id, memo_no, order_date, customer_id, salesperson_id, status,
+		       total_products, delivered_products, total_amount, received_amount
+		FROM orders
+		WHERE id = $1 AND branch_id = $2
+		FOR UPDATE
+	`, orderID, branchID).Scan(
+		&order.ID, &order.MemoNo, &order.OrderDate, &order.CustomerID, &order.SalespersonID, &order.Status,
+		&order.TotalItems, &order.DeliveredItems, &order.TotalAmount, &order.ReceivedAmount,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no order with id %d in this branch", ErrOrderNotFound, orderID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock order failed: %w", err)
+	}
+	if order.Status == models.ORDER_CANCELLED {
+		return nil, fmt.Errorf("%w: order %s is already cancelled", ErrOrderNotCancellable, order.MemoNo)
+	}
+	if order.DeliveredItems > 0 {
+		return nil, fmt.Errorf("%w: order %s has delivered items", ErrOrderNotCancellable, order.MemoNo)
+	}
+	if cancelDate.Before(order.OrderDate) {
+		return nil, fmt.Errorf("%w: cancel date cannot be before the order date", ErrOrderNotCancellable)
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, branchID, cancelDate); err != nil {
+		return nil, err
+	}
 
-		oldMemoStr := models.ORDER_MEMO_PREFIX + "-" + oldOrder.MemoNo
-		_, err = tx.Exec(ctx, `DELETE FROM transactions WHERE memo_no=$1 AND branch_id=$2 AND transaction_type=$3`,
-			oldMemoStr, oldOrder.BranchID, models.ADVANCE_PAYMENT)
-		if err != nil {
-			return fmt.Errorf("delete old global tx failed: %w", err)
-		}
+	// --------------------
+	// 2. Update Order Header
+	// --------------------
+	_, err = tx.Exec(ctx, `
+		UPDATE orders SET
+			status = $1,
+			cancelled_at = $2,
+			notes = CASE WHEN $3 = '' THEN notes ELSE concat_ws(E'\n', notes, 'Cancelled: ' || $3) END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, models.ORDER_CANCELLED, cancelDate, reason, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("update order header failed: %w", err)
+	}
+	if err := releaseCouponTx(ctx, tx, models.DOCUMENT_ORDER, order.ID); err != nil {
+		return nil, err
 	}
 
-	// 7b. Apply New Payment (If > 0)
-	if order.ReceivedAmount > 0 {
-		// Add money to New Account
-		_, err = tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance + $1 WHERE id = $2`,
-			order.ReceivedAmount, order.PaymentAccountID)
-		if err != nil {
-			return fmt.Errorf("update new account balance failed: %w", err)
-		}
+	// --------------------
+	// 3. Top sheet and salesperson progress on the cancel date
+	// --------------------
+	err = SaveTopSheetTx(tx, ctx, &models.TopSheetDB{
+		SheetDate: cancelDate,
+		BranchID:  branchID,
+		Cancelled: order.TotalItems,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("save top sheet failed: %w", err)
+	}
 
-		// Insert New Logs
-		_, err = tx.Exec(ctx, `
-			INSERT INTO order_transactions(
-				order_id, transaction_date, payment_account_id, memo_no, 
-				delivered_by, quantity_delivered, amount, transaction_type
-			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-		`,
-			order.ID, order.OrderDate, order.PaymentAccountID, order.MemoNo,
-			order.SalespersonID, order.DeliveredItems, order.ReceivedAmount, models.ADVANCE_PAYMENT,
-		)
-		if err != nil {
-			return fmt.Errorf("insert new order tx failed: %w", err)
-		}
+	_, err = UpdateEmployeeProgressReportTx(tx, ctx, &models.EmployeeProgressDB{
+		SheetDate:  cancelDate,
+		BranchID:   branchID,
+		EmployeeID: order.SalespersonID,
+		OrderCount: -order.TotalItems,
+		SaleAmount: -order.TotalAmount,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("revert salesperson progress failed: %w", err)
+	}
 
-		_, err = tx.Exec(ctx, `
-			INSERT INTO transactions(
-				transaction_date, memo_no, branch_id,
-				from_entity_id, from_entity_type,
-				to_entity_id, to_entity_type,
-				amount, transaction_type, notes
-			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-		`,
-			order.OrderDate, models.ORDER_MEMO_PREFIX+"-"+order.MemoNo, order.BranchID,
-			order.CustomerID, models.ENTITY_CUSTOMER,
-			order.PaymentAccountID, models.ENTITY_ACCOUNT,
-			order.ReceivedAmount, models.ADVANCE_PAYMENT, "Advance payment (Updated)",
-		)
+	// --------------------
+	// 4. Customer due and store credit
+	// --------------------
+	if due := order.TotalAmount - order.ReceivedAmount; due != 0 {
+		_, err = tx.Exec(ctx, `UPDATE customers SET due_amount = due_amount - $1 WHERE id = $2`, due, order.CustomerID)
 		if err != nil {
-			return fmt.Errorf("insert new global tx failed: %w", err)
+			return nil, fmt.Errorf("update customer due failed: %w", err)
 		}
 	}
 
-	return tx.Commit(ctx)
-}
-
-// CancelOrder revert all the records of an order
-func (r *OrderRepo) CancelOrder(ctx context.Context, oldOrder *models.OrderDB) error {
-	tx, err := r.db.Begin(ctx)
+	// points redeemed on the order are given back as points, the rest of what
+	// was paid as store credit
+	paidWithPoints, err := restoreLoyaltyTx(ctx, tx, branchID, order.CustomerID, models.DOCUMENT_ORDER, order.ID, order.MemoNo, cancelDate)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	var entry *models.StoreCreditEntry
+	if credit := order.ReceivedAmount - paidWithPoints; credit > 0 {
+		entry, err = creditFromDocumentTx(ctx, tx, branchID, order.CustomerID, models.DOCUMENT_ORDER, order.ID, order.MemoNo,
+			cancelDate, credit, models.STORE_CREDIT_CANCELLATION, "Paid on cancelled order "+order.MemoNo)
+		if err != nil {
+			return nil, err
+		}
 	}
-	defer tx.Rollback(ctx)
 
-	// // --------------------
-	// // 1. Basic Validations
-	// // --------------------
-	// if (oldOrder.Status != models.ORDER_PENDING) || (oldOrder.Status != models.ORDER_PARTIAL_DELIVERY) {
-	// 	return fmt.Errorf("only pending orders can be modified")
-	// }
-
-	// // --------------------
-	// // 2. Delete Order relate record (orders, order_items, order_transactions)
-	// // --------------------
-	// _, err = tx.Exec(ctx, `DELETE FROM order_items WHERE id=$1`, oldOrder.ID)
-	// if err != nil {
-	// 	return fmt.Errorf("delete order header failed: %w", err)
-	// }
-
-	// // --------------------
-	// // 4. Handle Top Sheet (Daily Summary)
-	// // --------------------
-
-	
-	// // 4a. Revert Old (Subtract from OLD Date)
-	// oldSheet := &models.TopSheetDB{
-	// 	SheetDate:  oldOrder.OrderDate,
-	// 	BranchID:   oldOrder.BranchID,
-	// 	OrderCount: -oldOrder.TotalItems, // Negative to subtract
-	// }
-	// // Determine old account type for Top Sheet
-	// if oldOrder.ReceivedAmount > 0 && len(oldOrder.OrderTransactions) > 0 {
-	// 	var oldAcctType string
-	// 	// Try to get account from old transaction, fallback to order struct
-	// 	acctID := oldOrder.OrderTransactions[0].PaymentAccountID
-
-	// 	err = tx.QueryRow(ctx, `SELECT type FROM accounts WHERE id=$1`, acctID).Scan(&oldAcctType)
-	// 	if err == nil {
-	// 		if oldAcctType == models.ACCOUNT_BANK {
-	// 			oldSheet.Bank = -oldOrder.ReceivedAmount
-	// 		} else {
-	// 			oldSheet.Cash = -oldOrder.ReceivedAmount
-	// 		}
-	// 	}
-	// }
-	// if err := SaveTopSheetTx(tx, ctx, oldSheet); err != nil {
-	// 	return fmt.Errorf("revert top sheet failed: %w", err)
-	// }
-
-	// // 4b. Apply New (Add to NEW Date)
-	// newSheet := &models.TopSheetDB{
-	// 	SheetDate:  order.OrderDate,
-	// 	BranchID:   order.BranchID,
-	// 	OrderCount: order.TotalItems,
-	// }
-	// var newAcctType string // Needed later for transaction logs too
-	// if order.ReceivedAmount > 0 {
-	// 	err = tx.QueryRow(ctx, `SELECT type FROM accounts WHERE id=$1`, order.PaymentAccountID).Scan(&newAcctType)
-	// 	if err != nil {
-	// 		return fmt.Errorf("lookup new account type failed: %w", err)
-	// 	}
-	// 	if newAcctType == models.ACCOUNT_BANK {
-	// 		newSheet.Bank = order.ReceivedAmount
-	// 	} else {
-	// 		newSheet.Cash = order.ReceivedAmount
-	// 	}
-	// }
-	// if err := SaveTopSheetTx(tx, ctx, newSheet); err != nil {
-	// 	return fmt.Errorf("apply top sheet failed: %w", err)
-	// }
-
-	// // --------------------
-	// // 5. Handle Salesperson Progress
-	// // --------------------
-
-	// // 5a. Revert Old Salesperson
-	// // We subtract the old stats from the OLD salesperson ID
-	// oldProgress := &models.SalespersonProgress{
-	// 	Date:       oldOrder.OrderDate,
-	// 	BranchID:   oldOrder.BranchID,
-	// 	EmployeeID: oldOrder.SalespersonID, // OLD ID
-	// 	OrderCount: -oldOrder.TotalItems,
-	// 	SaleAmount: -oldOrder.TotalAmount,
-	// }
-	// if err := UpdateSalespersonProgressReportTx(tx, ctx, oldProgress); err != nil {
-	// 	return fmt.Errorf("revert old salesperson progress failed: %w", err)
-	// }
-
-	// // 5b. Apply New Salesperson
-	// // We add the new stats to the NEW salesperson ID
-	// newProgress := &models.SalespersonProgress{
-	// 	Date:       order.OrderDate,
-	// 	BranchID:   order.BranchID,
-	// 	EmployeeID: order.SalespersonID, // NEW ID
-	// 	OrderCount: order.TotalItems,
-	// 	SaleAmount: order.TotalAmount,
-	// }
-	// if err := UpdateSalespersonProgressReportTx(tx, ctx, newProgress); err != nil {
-	// 	return fmt.Errorf("apply new salesperson progress failed: %w", err)
-	// }
-
-	// // --------------------
-	// // 6. Handle Customer Due
-	// // --------------------
-
-	// // 6a. Revert Old Customer Due
-	// // Remove the *Old Due* amount from the *Old Customer*
-	// oldDue := oldOrder.TotalAmount - oldOrder.ReceivedAmount
-	// if oldDue != 0 {
-	// 	_, err = tx.Exec(ctx, `
-	// 		UPDATE customers 
-	// 		SET due_amount = due_amount - $1 
-	// 		WHERE id = $2
-	// 	`, oldDue, oldOrder.CustomerID) // OLD Customer ID
-	// 	if err != nil {
-	// 		return fmt.Errorf("revert old customer due failed: %w", err)
-	// 	}
-	// }
-
-	// // 6b. Apply New Customer Due
-	// // Add the *New Due* amount to the *New Customer*
-	// newDue := order.TotalAmount - order.ReceivedAmount
-	// if newDue != 0 {
-	// 	_, err = tx.Exec(ctx, `
-	// 		UPDATE customers 
-	// 		SET due_amount = due_amount + $1 
-	// 		WHERE id = $2
-	// 	`, newDue, order.CustomerID) // NEW Customer ID
-	// 	if err != nil {
-	// 		return fmt.Errorf("apply new customer due failed: %w", err)
-	// 	}
-	// }
-
-	// // --------------------
-	// // 7. Handle Financials (Payments)
-	// // --------------------
-
-	// // 7a. Revert Old Payment (If existed)
-	// if oldOrder.ReceivedAmount > 0 && len(oldOrder.OrderTransactions) > 0 {
-	// 	oldAcctID := oldOrder.OrderTransactions[0].PaymentAccountID
-
-	// 	// Refund the money from the Old Account
-	// 	_, err = tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance - $1 WHERE id = $2`,
-	// 		oldOrder.ReceivedAmount, oldAcctID)
-	// 	if err != nil {
-	// 		return fmt.Errorf("revert old account balance failed: %w", err)
-	// 	}
-
-	// 	// Delete Old Logs
-	// 	_, err = tx.Exec(ctx, `DELETE FROM order_transactions WHERE order_id=$1 AND transaction_type=$2`,
-	// 		order.ID, models.ADVANCE_PAYMENT)
-	// 	if err != nil {
-	// 		return fmt.Errorf("delete old order tx failed: %w", err)
-	// 	}
-
-	// 	oldMemoStr := models.ORDER_MEMO_PREFIX + "-" + oldOrder.MemoNo
-	// 	_, err = tx.Exec(ctx, `DELETE FROM transactions WHERE memo_no=$1 AND branch_id=$2 AND transaction_type=$3`,
-	// 		oldMemoStr, oldOrder.BranchID, models.ADVANCE_PAYMENT)
-	// 	if err != nil {
-	// 		return fmt.Errorf("delete old global tx failed: %w", err)
-	// 	}
-	// }
-
-	// // 7b. Apply New Payment (If > 0)
-	// if order.ReceivedAmount > 0 {
-	// 	// Add money to New Account
-	// 	_, err = tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance + $1 WHERE id = $2`,
-	// 		order.ReceivedAmount, order.PaymentAccountID)
-	// 	if err != nil {
-	// 		return fmt.Errorf("update new account balance failed: %w", err)
-	// 	}
-
-	// 	// Insert New Logs
-	// 	_, err = tx.Exec(ctx, `
-	// 		INSERT INTO order_transactions(
-	// 			order_id, transaction_date, payment_account_id, memo_no, 
-	// 			delivered_by, quantity_delivered, amount, transaction_type
-	// 		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-	// 	`,
-	// 		order.ID, order.OrderDate, order.PaymentAccountID, order.MemoNo,
-	// 		order.SalespersonID, order.DeliveredItems, order.ReceivedAmount, models.ADVANCE_PAYMENT,
-	// 	)
-	// 	if err != nil {
-	// 		return fmt.Errorf("insert new order tx failed: %w", err)
-	// 	}
-
-	// 	_, err = tx.Exec(ctx, `
-	// 		INSERT INTO transactions(
-	// 			transaction_date, memo_no, branch_id,
-	// 			from_entity_id, from_entity_type,
-	// 			to_entity_id, to_entity_type,
-	// 			amount, transaction_type, notes
-	// 		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-	// 	`,
-	// 		order.OrderDate, models.ORDER_MEMO_PREFIX+"-"+order.MemoNo, order.BranchID,
-	// 		order.CustomerID, models.ENTITY_CUSTOMER,
-	// 		order.PaymentAccountID, models.ENTITY_ACCOUNT,
-	// 		order.ReceivedAmount, models.ADVANCE_PAYMENT, "Advance payment (Updated)",
-	// 	)
-	// 	if err != nil {
-	// 		return fmt.Errorf("insert new global tx failed: %w", err)
-	// 	}
-	// }
+	// --------------------
+	// 5. Take back the points the order earned
+	// --------------------
+	if err := syncLoyaltyTx(ctx, tx, models.DOCUMENT_ORDER, order.ID, cancelDate); err != nil {
+		return nil, err
+	}
 
-	return tx.Commit(ctx)
+	return entry, tx.Commit(ctx)
 }
 
 // OrderDelivery record an order delivery, payment transaction,
@@ -734,6 +715,14 @@ func (r *OrderRepo) OrderDelivery(ctx context.Context, orderTx models.OrderTrans
 	// --------------------
 	// 1.  Basic validations
 	// --------------------
+	payments, err := normalizePayments(&orderTx.PaymentAccountID, &orderTx.Amount, orderTx.Payments)
+	if err != nil {
+		return fmt.Errorf("ERROR_1: %w", err)
+	}
+	if len(payments) == 0 {
+		// nothing paid: the delivery is still recorded against the account given
+		payments = []models.Payment{{AccountID: orderTx.PaymentAccountID}}
+	}
 	currentStatus := models.ORDER_DELIVERY
 	dueAmount := orderInfo.TotalAmount - orderInfo.ReceivedAmount - orderTx.Amount
 	if dueAmount < 0 {
@@ -744,9 +733,12 @@ func (r *OrderRepo) OrderDelivery(ctx context.Context, orderTx models.OrderTrans
 	if remainingItems < 0 {
 		return fmt.Errorf("ERROR_2: delivery quantity cannot exceed remaining quantity")
 	}
+	if err := EnsurePeriodOpenTx(ctx, tx, orderInfo.BranchID, orderTx.TransactionDate); err != nil {
+		return err
+	}
 
 	// update current status
-	if dueAmount > float64(0) || remainingItems > 0 {
+	if dueAmount > 0 || remainingItems > 0 {
 		currentStatus = models.ORDER_PARTIAL_DELIVERY
 	}
 
@@ -776,106 +768,32 @@ func (r *OrderRepo) OrderDelivery(ctx context.Context, orderTx models.OrderTrans
 		Delivery:  orderTx.QuantityDelivered, // total items ordered
 	}
 
-	var acctType string
-	if orderTx.Amount > 0 {
-		err = tx.QueryRow(ctx,
-			`SELECT type FROM accounts WHERE id=$1 AND branch_id=$2`,
-			orderTx.PaymentAccountID,
-			orderInfo.BranchID,
-		).Scan(&acctType)
-		if err != nil {
-			return fmt.Errorf("ERROR_4: lookup account type failed: %w", err)
-		}
-
-		if acctType == models.ACCOUNT_BANK {
-			topSheet.Bank = orderTx.Amount
-		} else {
-			topSheet.Cash = orderTx.Amount
-		}
-	}
-
-	if err := SaveTopSheetTx(tx, ctx, topSheet); err != nil {
-		return fmt.Errorf("ERROR_5: save top sheet failed: %w", err)
-	}
-
 	// --------------------
-	// Step 4: Order Payment transactions
+	// Step 4: Order payment transactions, one per payment
 	// --------------------
-	// lock account row
-	_, err = tx.Exec(ctx,
-		`SELECT id FROM accounts WHERE id=$1 FOR UPDATE`,
-		orderTx.PaymentAccountID,
-	)
+	_, err = postPaymentsTx(ctx, tx, paymentPosting{
+		docType:     models.DOCUMENT_ORDER,
+		docID:       *orderTx.OrderID,
+		branchID:    orderInfo.BranchID,
+		customerID:  orderInfo.CustomerID,
+		date:        orderTx.TransactionDate,
+		memoNo:      orderTx.MemoNo,
+		deliveredBy: orderInfo.SalespersonID,
+		quantity:    orderTx.QuantityDelivered,
+		txType:      models.PAYMENT,
+		notes:       "Payment received upon delivery",
+	}, payments, nil, topSheet)
 	if err != nil {
-		return fmt.Errorf("ERROR_6: lock account failed: %w", err)
+		return fmt.Errorf("ERROR_4: %w", err)
 	}
 
-	// 4a: order payment transaction
-	_, err = tx.Exec(ctx, `
-			INSERT INTO order_transactions(
-				order_id, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
-				amount, transaction_type
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-		`,
-		orderTx.OrderID,
-		orderTx.TransactionDate,
-		orderTx.PaymentAccountID,
-		orderTx.MemoNo,
-		orderInfo.SalespersonID,
-		orderTx.QuantityDelivered,
-		orderTx.Amount,
-		models.PAYMENT,
-	)
-	if err != nil {
-		return fmt.Errorf("ERROR_7: insert payment transaction failed (4a): %w", err)
+	if err := SaveTopSheetTx(tx, ctx, topSheet); err != nil {
+		return fmt.Errorf("ERROR_5: save top sheet failed: %w", err)
 	}
 
-	// --------------------
-	// Step 5: Global Payment transactions
-	// --------------------
 	if orderTx.Amount > 0 {
-
-		// 5a: global transaction log
-		_, err = tx.Exec(ctx, `
-			INSERT INTO transactions(
-				transaction_date, memo_no, branch_id,
-				from_entity_id, from_entity_type,
-				to_entity_id, to_entity_type,
-				amount, transaction_type, notes
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-		`,
-			orderTx.TransactionDate,
-			models.ORDER_MEMO_PREFIX+"-"+orderTx.MemoNo,
-			orderInfo.BranchID,
-			orderInfo.CustomerID,
-			models.ENTITY_CUSTOMER,
-			orderTx.PaymentAccountID,
-			models.ENTITY_ACCOUNT,
-			orderTx.Amount,
-			models.PAYMENT,
-			"Payment received upon delivery",
-		)
-		if err != nil {
-			return fmt.Errorf("ERROR_8: insert transaction failed (4b): %w", err)
-		}
-
-		// 5b: update account balance
-		_, err = tx.Exec(ctx, `
-			UPDATE accounts
-			SET current_balance = current_balance + $1
-			WHERE id = $2
-		`,
-			orderTx.Amount,
-			orderTx.PaymentAccountID,
-		)
-		if err != nil {
-			return fmt.Errorf("ERROR_9: update account balance failed: %w", err)
-		}
-
 		// --------------------
-		// Step 4d: Update customer due
+		// Step 5: Update customer due
 		// --------------------
 
 		// lock customer row
@@ -900,6 +818,13 @@ func (r *OrderRepo) OrderDelivery(ctx context.Context, orderTx models.OrderTrans
 		}
 	}
 
+	// --------------------
+	// Step 6: Loyalty points once the order is delivered
+	// --------------------
+	if err := syncLoyaltyTx(ctx, tx, models.DOCUMENT_ORDER, *orderTx.OrderID, orderTx.TransactionDate); err != nil {
+		return err
+	}
+
 	return tx.Commit(ctx)
 }
 
@@ -988,7 +913,20 @@ func (r *OrderRepo) GetOrders(
             o.customer_id, c.name AS customer_name, c.mobile AS customer_mobile,
             o.total_products, o.delivered_products,
             o.total_amount, o.received_amount,
-            o.status, o.notes, o.created_at, o.updated_at
+            o.status, o.notes, o.created_at, o.updated_at,
+            (
+                SELECT COUNT(*)
+                FROM (
+                    SELECT i.due_date,
+                        SUM(i.amount) OVER (ORDER BY i.installment_no) AS upto,
+                        SUM(i.amount) OVER () AS plan_total
+                    FROM order_installments i
+                    WHERE i.order_id = o.id
+                ) p
+                WHERE o.status <> 'cancelled'
+                  AND p.due_date < CURRENT_DATE
+                  AND p.upto > o.received_amount - (o.total_amount - p.plan_total)
+            ) AS overdue_installments
         %s
         %s
         ORDER BY o.created_at DESC
@@ -1019,6 +957,7 @@ func (r *OrderRepo) GetOrders(
 			&o.TotalItems, &o.DeliveredItems,
 			&o.TotalAmount, &o.ReceivedAmount,
 			&o.Status, &o.Notes, &o.CreatedAt, &o.UpdatedAt,
+			&o.OverdueInstallments,
 		)
 		if err != nil {
 			return nil, 0, err
@@ -1054,6 +993,7 @@ func (r *OrderRepo) GetOrderDetailsByID(
 			o.customer_id,
 			c.name AS customer_name,
 			c.mobile AS customer_mobile,
+			c.tax_id AS customer_tax_id,
 			o.total_products,
 			o.delivered_products,
 			o.total_amount,
@@ -1061,7 +1001,9 @@ func (r *OrderRepo) GetOrderDetailsByID(
 			o.status,
 			o.notes,
 			o.created_at,
-			o.updated_at
+			o.updated_at,
+			o.measurement_profile_id,
+			o.measurement_version_id
 		FROM orders o
 		JOIN customers c ON c.id = o.customer_id
 		JOIN employees e ON e.id = o.salesperson_id
@@ -1078,14 +1020,17 @@ func (r *OrderRepo) GetOrderDetailsByID(
 		&order.CustomerID,
 		&order.Customer.Name,
 		&order.Customer.Mobile,
+		&order.Customer.TaxID,
 		&order.TotalItems,
 		&order.DeliveredItems,
-		&order.TotalAmount,    // float64
-		&order.ReceivedAmount, // float64
+		&order.TotalAmount,
+		&order.ReceivedAmount,
 		&order.Status,
 		&order.Notes,
 		&order.CreatedAt,
 		&order.UpdatedAt,
+		&order.MeasurementProfileID,
+		&order.MeasurementVersionID,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -1096,20 +1041,56 @@ func (r *OrderRepo) GetOrderDetailsByID(
 
 	order.Customer.ID = order.CustomerID
 	order.Salesperson.ID = order.SalespersonID
+	if err := loadDocumentDiscounts(ctx, r.db, models.DOCUMENT_ORDER, order.ID, &order.DocumentDiscounts); err != nil {
+		return nil, err
+	}
+	if err := loadDocumentTaxes(ctx, r.db, models.DOCUMENT_ORDER, order.ID, &order.DocumentTax); err != nil {
+		return nil, err
+	}
+
+	// installment plan, with what is paid on each
+	if order.Installments, err = loadInstallments(ctx, r.db, order.ID); err != nil {
+		return nil, err
+	}
+	if order.Status != models.ORDER_CANCELLED {
+		settleInstallments(order.Installments, order.TotalAmount, order.ReceivedAmount, today())
+		for _, in := range order.Installments {
+			if in.Overdue {
+				order.OverdueInstallments++
+			}
+		}
+	}
+
+	// measurements the order was made from
+	if order.MeasurementVersionID != nil {
+		order.Measurement, err = getMeasurementVersion(ctx, r.db, *order.MeasurementVersionID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// ------------------------------------------------
 	// 2. Fetch order items + products
 	// ------------------------------------------------
 	itemRows, err := r.db.Query(ctx, `
 		SELECT
+			oi.id,
 			oi.product_id,
 			p.product_name,
 			oi.quantity,
-			oi.subtotal
+			oi.subtotal,
+			oi.discount_type,
+			oi.discount_value,
+			oi.discount_amount,
+			oi.measurement_profile_id,
+			oi.measurement_version_id,
+			oi.measurements,
+			oi.style_options,
+			oi.tailor_notes
 		FROM order_items oi
 		JOIN products p ON p.id = oi.product_id
 		WHERE oi.order_id = $1
-		ORDER BY p.product_name
+		ORDER BY p.product_name, oi.id
 	`, orderID)
 	if err != nil {
 		return nil, fmt.Errorf("fetch order items failed: %w", err)
@@ -1117,17 +1098,36 @@ func (r *OrderRepo) GetOrderDetailsByID(
 	defer itemRows.Close()
 
 	for itemRows.Next() {
-		var it models.OrderItemDB
+		var (
+			it            models.OrderItemDB
+			discountType  *string
+			discountValue *money.Amount
+		)
 		if err := itemRows.Scan(
+			&it.ID,
 			&it.ProductID,
 			&it.ProductName,
 			&it.Quantity,
-			&it.Subtotal, // float64
+			&it.Subtotal,
+			&discountType,
+			&discountValue,
+			&it.DiscountAmount,
+			&it.MeasurementProfileID,
+			&it.MeasurementVersionID,
+			&it.Measurements,
+			&it.StyleOptions,
+			&it.TailorNotes,
 		); err != nil {
 			return nil, err
 		}
+		it.OrderID = orderID
+		it.Discount = itemDiscount(discountType, discountValue)
 		order.Items = append(order.Items, it)
 	}
+	itemRows.Close()
+	if err := r.loadOrderItemPhotos(ctx, orderID, order.Items); err != nil {
+		return nil, err
+	}
 
 	// ------------------------------------------------
 	// 3. Fetch order transactions (FIXED)
@@ -1143,9 +1143,13 @@ func (r *OrderRepo) GetOrderDetailsByID(
 			t.quantity_delivered,
 			t.amount,
 			t.transaction_type,
+			t.reference,
+			COALESCE(v.code, '') AS voucher_code,
+			COALESCE(t.loyalty_points, 0) AS loyalty_points,
 			t.created_at
 		FROM order_transactions t
 		LEFT JOIN accounts a ON(a.id=t.payment_account_id)
+		LEFT JOIN gift_vouchers v ON(v.id=t.voucher_id)
 		WHERE order_id = $1
 		ORDER BY created_at ASC
 	`, orderID)
@@ -1166,6 +1170,9 @@ func (r *OrderRepo) GetOrderDetailsByID(
 			&t.QuantityDelivered,
 			&t.Amount,
 			&t.TransactionType,
+			&t.Reference,
+			&t.VoucherCode,
+			&t.LoyaltyPoints,
 			&t.CreatedAt,
 		); err != nil {
 			return nil, err
@@ -1173,5 +1180,9 @@ func (r *OrderRepo) GetOrderDetailsByID(
 		order.OrderTransactions = append(order.OrderTransactions, t)
 	}
 
+	if order.PointsEarned, err = documentPointsEarned(ctx, r.db, models.DOCUMENT_ORDER, orderID); err != nil {
+		return nil, err
+	}
+
 	return &order, nil
 }
@@ -0,0 +1,209 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// ============================== Order Items ==============================
+
+// cleanStyleOptions trims the style options and drops the empty extra ones
+func cleanStyleOptions(s models.StyleOptions) models.StyleOptions {
+	s.SleeveType = strings.TrimSpace(s.SleeveType)
+	s.Embroidery = strings.TrimSpace(s.Embroidery)
+	s.Stones = strings.TrimSpace(s.Stones)
+	s.FabricCode = strings.TrimSpace(s.FabricCode)
+	extra := make(map[string]string, len(s.Extra))
+	for k, v := range s.Extra {
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if k != "" && v != "" {
+			extra[k] = v
+		}
+	}
+	s.Extra = nil
+	if len(extra) > 0 {
+		s.Extra = extra
+	}
+	return s
+}
+
+// itemMeasurementsTx fills in the measurements an order item is made from.
+// The item's own profile or version is used when given, else the order's.
+// The measurements of that version are copied onto the item, with the ones
+// sent on the item taking precedence.
+func itemMeasurementsTx(ctx context.Context, tx pgx.Tx, order *models.OrderDB, item *models.OrderItemDB) error {
+	profileID, versionID := order.MeasurementProfileID, order.MeasurementVersionID
+	if item.MeasurementProfileID != nil || item.MeasurementVersionID != nil {
+		var err error
+		profileID, versionID, err = resolveOrderMeasurementTx(ctx, tx,
+			order.BranchID, order.CustomerID, item.MeasurementProfileID, item.MeasurementVersionID)
+		if err != nil {
+			return err
+		}
+	}
+	item.MeasurementProfileID, item.MeasurementVersionID = profileID, versionID
+
+	measurements := make(map[string]string)
+	if versionID != nil {
+		v, err := getMeasurementVersion(ctx, tx, *versionID)
+		if err != nil {
+			return err
+		}
+		for k, val := range v.Measurements {
+			measurements[k] = val
+		}
+	}
+	for k, val := range item.Measurements {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" {
+			continue
+		}
+		if val = strings.TrimSpace(val); val == "" {
+			delete(measurements, k)
+			continue
+		}
+		measurements[k] = val
+	}
+	item.Measurements = measurements
+	return nil
+}
+
+// saveOrderItemsTx writes the items of an order. Items sent with an id are
+// updated in place so their photos stay; the order's other items are removed
+// and the rest are inserted.
+func saveOrderItemsTx(ctx context.Context, tx pgx.Tx, order *models.OrderDB) error {
+	keep := make([]int64, 0, len(order.Items))
+	for _, item := range order.Items {
+		if item.ID != 0 {
+			keep = append(keep, item.ID)
+		}
+	}
+	_, err := tx.Exec(ctx, `DELETE FROM order_items WHERE order_id = $1 AND NOT (id = ANY($2))`, order.ID, keep)
+	if err != nil {
+		return fmt.Errorf("delete old items failed: %w", err)
+	}
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		if err := itemMeasurementsTx(ctx, tx, order, item); err != nil {
+			return err
+		}
+		item.StyleOptions = cleanStyleOptions(item.StyleOptions)
+		item.TailorNotes = strings.TrimSpace(item.TailorNotes)
+
+		discountType, discountValue := discountColumns(item.Discount)
+
+		if item.ID == 0 {
+			err = tx.QueryRow(ctx, `
+				INSERT INTO order_items(order_id, product_id, quantity, subtotal,
+					measurement_profile_id, measurement_version_id, measurements, style_options, tailor_notes,
+					discount_type, discount_value, discount_amount)
+				VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+				RETURNING id
+			`, order.ID, item.ProductID, item.Quantity, item.Subtotal,
+				item.MeasurementProfileID, item.MeasurementVersionID, item.Measurements, item.StyleOptions, item.TailorNotes,
+				discountType, discountValue, item.DiscountAmount,
+			).Scan(&item.ID)
+			if err != nil {
+				return fmt.Errorf("insert order item failed: %w", err)
+			}
+			continue
+		}
+
+		tag, err := tx.Exec(ctx, `
+			UPDATE order_items
+			SET product_id = $3, quantity = $4, subtotal = $5,
+				measurement_profile_id = $6, measurement_version_id = $7,
+				measurements = $8, style_options = $9, tailor_notes = $10,
+				discount_type = $11, discount_value = $12, discount_amount = $13
+			WHERE id = $1 AND order_id = $2
+		`, item.ID, order.ID, item.ProductID, item.Quantity, item.Subtotal,
+			item.MeasurementProfileID, item.MeasurementVersionID, item.Measurements, item.StyleOptions, item.TailorNotes,
+			discountType, discountValue, item.DiscountAmount)
+		if err != nil {
+			return fmt.Errorf("update order item failed: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("order item with id %d is not part of this order", item.ID)
+		}
+	}
+	return nil
+}
+
+// loadOrderItemPhotos attaches the image attachments of each item of an order
+func (r *OrderRepo) loadOrderItemPhotos(ctx context.Context, orderID int64, items []models.OrderItemDB) error {
+	byItem := make(map[int64]*models.OrderItemDB, len(items))
+	for i := range items {
+		items[i].Photos = []models.Attachment{}
+		byItem[items[i].ID] = &items[i]
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE entity_type = $1
+		  AND entity_id IN (SELECT id FROM order_items WHERE order_id = $2)
+		  AND content_type LIKE 'image/%'
+		ORDER BY id
+	`, models.ATTACHMENT_ORDER_ITEM, orderID)
+	if err != nil {
+		return fmt.Errorf("fetch order item photos failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return err
+		}
+		if it, ok := byItem[a.EntityID]; ok {
+			it.Photos = append(it.Photos, *a)
+		}
+	}
+	return rows.Err()
+}
+
+// GetOrdersDue returns the orders of a branch still to be delivered with a
+// delivery date from start to end (inclusive), with their items, earliest
+// delivery first
+func (r *OrderRepo) GetOrdersDue(ctx context.Context, branchID int64, start, end time.Time) ([]*models.OrderDB, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id
+		FROM orders
+		WHERE branch_id = $1
+		  AND status IN ($2, $3)
+		  AND delivery_date BETWEEN $4 AND $5
+		ORDER BY delivery_date, memo_no
+	`, branchID, models.ORDER_PENDING, models.ORDER_PARTIAL_DELIVERY, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("fetch due orders failed: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan due order failed: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("fetch due orders failed: %w", err)
+	}
+
+	orders := make([]*models.OrderDB, 0, len(ids))
+	for _, id := range ids {
+		order, err := r.GetOrderDetailsByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
@@ -0,0 +1,240 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// normalizePayments returns the payments received on an order, delivery or
+// sale. Without a payments array the single account and amount make the only
+// payment; with one, the amount becomes their sum and the account the first
+// one's, so the document still shows where the money went.
+func normalizePayments(accountID *int64, amount *money.Amount, payments []models.Payment) ([]models.Payment, error) {
+	if len(payments) == 0 {
+		if *amount <= 0 {
+			return nil, nil
+		}
+		return []models.Payment{{AccountID: *accountID, Amount: *amount}}, nil
+	}
+
+	var total money.Amount
+	for i := range payments {
+		p := &payments[i]
+		p.Reference = strings.TrimSpace(p.Reference)
+		if p.AccountID == 0 {
+			return nil, errors.New("every payment needs an account")
+		}
+		if p.Amount <= 0 {
+			return nil, errors.New("every payment must be more than zero")
+		}
+		if len(p.Reference) > 100 {
+			return nil, errors.New("payment reference must be at most 100 characters")
+		}
+		total += p.Amount
+	}
+	*accountID, *amount = payments[0].AccountID, total
+	return payments, nil
+}
+
+// paymentPosting is where the payments of an order or sale are recorded
+type paymentPosting struct {
+	docType     string // models.DOCUMENT_ORDER or models.DOCUMENT_SALE
+	docID       int64
+	branchID    int64
+	customerID  int64
+	date        time.Time
+	memoNo      string // of the order, sale or delivery
+	deliveredBy int64
+	quantity    int64 // items handed over, recorded with the first payment
+	txType      string
+	notes       string
+	txMemoNo    string // of the rows in transactions; default the memo with the document prefix
+}
+
+// documentTransactionsTable is the table that holds the payments of an order or sale
+func documentTransactionsTable(docType string) (table, column string) {
+	if docType == models.DOCUMENT_SALE {
+		return "sale_transactions", "sale_id"
+	}
+	return "order_transactions", "order_id"
+}
+
+// postPaymentsTx records each payment on its own: a row in the order or sale
+// transactions with the part applied to the document, a row in transactions
+// with the whole amount, the balance of its account and the cash or bank of
+// sheet. applied may be nil when every payment goes to the document in full.
+// A payment of zero only records the document row. It returns the ids of the
+// transactions rows, 0 for payments of zero.
+func postPaymentsTx(ctx context.Context, tx pgx.Tx, p paymentPosting, payments []models.Payment, applied []money.Amount, sheet *models.TopSheetDB) ([]int64, error) {
+	table, column := documentTransactionsTable(p.docType)
+	txMemoNo := p.txMemoNo
+	if txMemoNo == "" {
+		prefix := models.ORDER_MEMO_PREFIX
+		if p.docType == models.DOCUMENT_SALE {
+			prefix = models.SALE_MEMO_PREFIX
+		}
+		txMemoNo = prefix + "-" + p.memoNo
+	}
+
+	ids := make([]int64, len(payments))
+	for i, pay := range payments {
+		docAmount := pay.Amount
+		if applied != nil {
+			docAmount = applied[i]
+		}
+		quantity := int64(0)
+		if i == 0 {
+			quantity = p.quantity
+		}
+
+		if pay.Amount > 0 {
+			// lock the account and book the money in its bucket
+			var acctType string
+			err := tx.QueryRow(ctx,
+				`SELECT type FROM accounts WHERE id=$1 AND branch_id=$2 FOR UPDATE`,
+				pay.AccountID, p.branchID,
+			).Scan(&acctType)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("account %d not found in this branch", pay.AccountID)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("lookup account type failed: %w", err)
+			}
+			if acctType == models.ACCOUNT_BANK {
+				sheet.Bank += pay.Amount
+			} else {
+				sheet.Cash += pay.Amount
+			}
+		}
+
+		_, err := tx.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %s(
+				%s, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
+				amount, transaction_type, reference
+			)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		`, table, column),
+			p.docID, p.date, pay.AccountID, p.memoNo, p.deliveredBy, quantity,
+			docAmount, p.txType, pay.Reference,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("insert %s payment failed: %w", p.docType, err)
+		}
+		if pay.Amount == 0 {
+			continue
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO transactions(
+				transaction_date, memo_no, branch_id,
+				from_entity_id, from_entity_type,
+				to_entity_id, to_entity_type,
+				amount, transaction_type, notes, reference
+			)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+			RETURNING transaction_id
+		`,
+			p.date, txMemoNo, p.branchID,
+			p.customerID, models.ENTITY_CUSTOMER,
+			pay.AccountID, models.ENTITY_ACCOUNT,
+			pay.Amount, p.txType, p.notes, pay.Reference,
+		).Scan(&ids[i])
+		if err != nil {
+			return nil, fmt.Errorf("insert transaction failed: %w", err)
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE accounts SET current_balance = current_balance + $1 WHERE id = $2`,
+			pay.Amount, pay.AccountID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("update account balance failed: %w", err)
+		}
+	}
+	return ids, nil
+}
+
+// revertPaymentsTx takes back the payments of one type recorded on an order
+// or sale under its own memo: their accounts are debited, their amounts come
+// off the cash or bank of sheet and their rows are deleted. Payments received
+// later under other memos are kept. The rows in transactions are left to the
+// caller, who knows their memo.
+func revertPaymentsTx(ctx context.Context, tx pgx.Tx, docType string, docID int64, txType, memoNo string, sheet *models.TopSheetDB) error {
+	table, column := documentTransactionsTable(docType)
+	rows, err := tx.Query(ctx, fmt.Sprintf(`
+		SELECT t.payment_account_id, a.type, SUM(t.amount)
+		FROM %s t
+		JOIN accounts a ON a.id = t.payment_account_id
+		WHERE t.%s = $1 AND t.transaction_type = $2 AND t.memo_no = $3
+		GROUP BY t.payment_account_id, a.type
+	`, table, column), docID, txType, memoNo)
+	if err != nil {
+		return fmt.Errorf("load %s payments failed: %w", docType, err)
+	}
+	type paid struct {
+		accountID int64
+		amount    money.Amount
+	}
+	var accounts []paid
+	for rows.Next() {
+		var (
+			p        paid
+			acctType string
+		)
+		if err := rows.Scan(&p.accountID, &acctType, &p.amount); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan %s payment failed: %w", docType, err)
+		}
+		if acctType == models.ACCOUNT_BANK {
+			sheet.Bank -= p.amount
+		} else {
+			sheet.Cash -= p.amount
+		}
+		accounts = append(accounts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s payment rows failed: %w", docType, err)
+	}
+
+	for _, p := range accounts {
+		_, err := tx.Exec(ctx,
+			`UPDATE accounts SET current_balance = current_balance - $1 WHERE id = $2`,
+			p.amount, p.accountID,
+		)
+		if err != nil {
+			return fmt.Errorf("revert account balance failed: %w", err)
+		}
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND transaction_type = $2 AND memo_no = $3`, table, column),
+		docID, txType, memoNo)
+	if err != nil {
+		return fmt.Errorf("delete %s payments failed: %w", docType, err)
+	}
+	return nil
+}
+
+// laterPaymentsTx returns how much was received on an order or sale after it
+// was booked, i.e. every payment except its own txType rows under memoNo, and
+// the date of the first of them
+func laterPaymentsTx(ctx context.Context, tx pgx.Tx, docType string, docID int64, txType, memoNo string) (money.Amount, *time.Time, error) {
+	table, column := documentTransactionsTable(docType)
+	var paid money.Amount
+	var firstPaidOn *time.Time
+	err := tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT COALESCE(SUM(amount), 0), MIN(transaction_date)
+		FROM %s
+		WHERE %s = $1 AND amount <> 0 AND NOT (transaction_type = $2 AND memo_no = $3)
+	`, table, column), docID, txType, memoNo).Scan(&paid, &firstPaidOn)
+	if err != nil {
+		return 0, nil, fmt.Errorf("load later %s payments failed: %w", docType, err)
+	}
+	return paid, firstPaidOn, nil
+}
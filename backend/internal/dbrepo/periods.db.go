@@ -0,0 +1,379 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// ErrPeriodClosed is returned by every mutation whose document date falls in a closed month
+var ErrPeriodClosed = models.ErrPeriodClosed
+
+type PeriodRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewPeriodRepo(db *pgxpool.Pool) *PeriodRepo {
+	return &PeriodRepo{db: db}
+}
+
+// periodMonth returns the first day of the month of d
+func periodMonth(d time.Time) time.Time {
+	return time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// periodLockKey is the second advisory lock key of a month, e.g. 202501
+func periodLockKey(month time.Time) int32 {
+	return int32(month.Year()*100 + int(month.Month()))
+}
+
+// EnsurePeriodOpenTx rejects the mutation with ErrPeriodClosed when any of the given
+// document dates falls in a closed month of the branch. Zero dates are skipped.
+//
+// It takes a shared advisory lock on each month so a concurrent ClosePeriod waits
+// until the mutation has committed or rolled back.
+func EnsurePeriodOpenTx(ctx context.Context, tx pgx.Tx, branchID int64, dates ...time.Time) error {
+	checked := make(map[time.Time]bool)
+	for _, d := range dates {
+		if d.IsZero() {
+			continue
+		}
+		month := periodMonth(d)
+		if checked[month] {
+			continue
+		}
+		checked[month] = true
+
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock_shared($1::int, $2::int)`, int32(branchID), periodLockKey(month)); err != nil {
+			return fmt.Errorf("lock accounting period failed: %w", err)
+		}
+		var closed bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM accounting_periods
+				WHERE branch_id = $1 AND period_month = $2 AND status = 'closed'
+			)
+		`, branchID, month).Scan(&closed)
+		if err != nil {
+			return fmt.Errorf("check accounting period failed: %w", err)
+		}
+		if closed {
+			return fmt.Errorf("%w: %s is closed for this branch; post the correction as an adjustment in an open period",
+				ErrPeriodClosed, month.Format("January 2006"))
+		}
+	}
+	return nil
+}
+
+// ClosePeriod closes a month of the branch. Waits for in-flight mutations of that month.
+func (r *PeriodRepo) ClosePeriod(ctx context.Context, branchID int64, month time.Time, employeeID int64, employeeName, reason string) (*models.AccountingPeriod, error) {
+	return r.setPeriodStatus(ctx, branchID, month, models.PERIOD_CLOSED, employeeID, employeeName, reason)
+}
+
+// ReopenPeriod re-opens a closed month of the branch. A reason is required for the audit trail.
+func (r *PeriodRepo) ReopenPeriod(ctx context.Context, branchID int64, month time.Time, employeeID int64, employeeName, reason string) (*models.AccountingPeriod, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, errors.New("a reason is required to re-open a period")
+	}
+	return r.setPeriodStatus(ctx, branchID, month, models.PERIOD_OPEN, employeeID, employeeName, reason)
+}
+
+func (r *PeriodRepo) setPeriodStatus(ctx context.Context, branchID int64, month time.Time, status string, employeeID int64, employeeName, reason string) (*models.AccountingPeriod, error) {
+	month = periodMonth(month)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// --------------------
+	// 1. Exclusive month lock (waits for EnsurePeriodOpenTx holders)
+	// --------------------
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1::int, $2::int)`, int32(branchID), periodLockKey(month)); err != nil {
+		return nil, fmt.Errorf("lock accounting period failed: %w", err)
+	}
+
+	var current string
+	err = tx.QueryRow(ctx, `SELECT status FROM accounting_periods WHERE branch_id = $1 AND period_month = $2 FOR UPDATE`,
+		branchID, month).Scan(&current)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("load accounting period failed: %w", err)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		current = models.PERIOD_OPEN
+	}
+	if current == status {
+		return nil, fmt.Errorf("%s is already %s for this branch", month.Format("January 2006"), status)
+	}
+
+	// --------------------
+	// 2. Upsert the period
+	// --------------------
+	var byID *int64
+	if employeeID > 0 {
+		byID = &employeeID
+	}
+	p := &models.AccountingPeriod{}
+	query := `
+		INSERT INTO accounting_periods (branch_id, period_month, status, closed_by, closed_at)
+		VALUES ($1, $2, 'closed', $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (branch_id, period_month) DO UPDATE SET
+			status = 'closed', closed_by = $3, closed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		RETURNING id, branch_id, period_month, status, closed_by, closed_at, reopened_by, reopened_at, created_at, updated_at
+	`
+	action := models.PERIOD_ACTION_CLOSE
+	if status == models.PERIOD_OPEN {
+		query = `
+			UPDATE accounting_periods SET
+				status = 'open', reopened_by = $3, reopened_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE branch_id = $1 AND period_month = $2
+			RETURNING id, branch_id, period_month, status, closed_by, closed_at, reopened_by, reopened_at, created_at, updated_at
+		`
+		action = models.PERIOD_ACTION_REOPEN
+	}
+	err = tx.QueryRow(ctx, query, branchID, month, byID).Scan(
+		&p.ID, &p.BranchID, &p.PeriodMonth, &p.Status,
+		&p.ClosedBy, &p.ClosedAt, &p.ReopenedBy, &p.ReopenedAt,
+		&p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("save accounting period failed: %w", err)
+	}
+
+	// --------------------
+	// 3. Audit
+	// --------------------
+	_, err = tx.Exec(ctx, `
+		INSERT INTO accounting_period_audit (period_id, branch_id, period_month, action, employee_id, employee_name, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, p.ID, branchID, month, action, byID, employeeName, strings.TrimSpace(reason))
+	if err != nil {
+		return nil, fmt.Errorf("insert period audit failed: %w", err)
+	}
+
+	return p, tx.Commit(ctx)
+}
+
+// ListPeriods returns every month of the branch that has been closed at least once, newest first
+func (r *PeriodRepo) ListPeriods(ctx context.Context, branchID int64) ([]*models.AccountingPeriod, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, branch_id, period_month, status, closed_by, closed_at, reopened_by, reopened_at, created_at, updated_at
+		FROM accounting_periods
+		WHERE branch_id = $1
+		ORDER BY period_month DESC
+	`, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("list accounting periods failed: %w", err)
+	}
+	defer rows.Close()
+
+	periods := []*models.AccountingPeriod{}
+	for rows.Next() {
+		p := &models.AccountingPeriod{}
+		if err := rows.Scan(
+			&p.ID, &p.BranchID, &p.PeriodMonth, &p.Status,
+			&p.ClosedBy, &p.ClosedAt, &p.ReopenedBy, &p.ReopenedAt,
+			&p.CreatedAt, &p.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan accounting period failed: %w", err)
+		}
+		periods = append(periods, p)
+	}
+	return periods, rows.Err()
+}
+
+// GetPeriodAudit returns the close / re-open history of the branch, newest first
+func (r *PeriodRepo) GetPeriodAudit(ctx context.Context, branchID int64) ([]*models.AccountingPeriodAudit, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, period_id, branch_id, period_month, action, employee_id, employee_name, reason, created_at
+		FROM accounting_period_audit
+		WHERE branch_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("list period audit failed: %w", err)
+	}
+	defer rows.Close()
+
+	audit := []*models.AccountingPeriodAudit{}
+	for rows.Next() {
+		a := &models.AccountingPeriodAudit{}
+		if err := rows.Scan(&a.ID, &a.PeriodID, &a.BranchID, &a.PeriodMonth, &a.Action,
+			&a.EmployeeID, &a.EmployeeName, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan period audit failed: %w", err)
+		}
+		audit = append(audit, a)
+	}
+	return audit, rows.Err()
+}
+
+// PostAdjustment books a correction as an Adjustment transaction dated in an open period.
+// Account sides move the account balance, customer sides move the customer due, and
+// money paid to (or returned by) suppliers and employees is booked as expense.
+func (r *PeriodRepo) PostAdjustment(ctx context.Context, adj *models.PeriodAdjustment) (*models.Transaction, error) {
+	for _, t := range []string{adj.FromType, adj.ToType} {
+		switch t {
+		case models.ENTITY_ACCOUNT, models.ENTITY_CUSTOMER, models.ENTITY_SUPPLIER, models.ENTITY_EMPLOYEE:
+		default:
+			return nil, fmt.Errorf("invalid entity type %q", t)
+		}
+	}
+	if adj.FromType != models.ENTITY_ACCOUNT && adj.ToType != models.ENTITY_ACCOUNT {
+		return nil, errors.New("one side of an adjustment must be an account")
+	}
+	if adj.FromType == adj.ToType && adj.FromID == adj.ToID {
+		return nil, errors.New("from and to must differ")
+	}
+	if adj.Amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	if strings.TrimSpace(adj.Reference) == "" {
+		return nil, errors.New("reference to the corrected document is required")
+	}
+	if adj.EmployeeID == 0 {
+		return nil, errors.New("the employee posting the adjustment is required")
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := EnsurePeriodOpenTx(ctx, tx, adj.BranchID, adj.AdjustmentDate); err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// 1. Transaction
+	// --------------------
+	notes := "Adjustment for " + strings.TrimSpace(adj.Reference)
+	if strings.TrimSpace(adj.Notes) != "" {
+		notes += ": " + strings.TrimSpace(adj.Notes)
+	}
+	t := &models.Transaction{
+		TransactionDate: adj.AdjustmentDate,
+		BranchID:        adj.BranchID,
+		FromID:          adj.FromID,
+		FromType:        adj.FromType,
+		ToID:            adj.ToID,
+		ToType:          adj.ToType,
+		Amount:          adj.Amount,
+		TransactionType: models.ADJUSTMENT,
+		Notes:           notes,
+	}
+	id, err := CreateTransactionTx(ctx, tx, t)
+	if err != nil {
+		return nil, err
+	}
+	t.TransactionID = fmt.Sprint(id)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO period_adjustments
+			(branch_id, transaction_id, adjustment_date, reference, employee_id, employee_name)
+		VALUES ($1,$2,$3,$4,$5,$6)
+	`, adj.BranchID, id, adj.AdjustmentDate, strings.TrimSpace(adj.Reference), adj.EmployeeID, adj.EmployeeName)
+	if err != nil {
+		return nil, fmt.Errorf("insert period adjustment failed: %w", err)
+	}
+
+	// --------------------
+	// 2. Balances
+	// --------------------
+	sheet := &models.TopSheetDB{SheetDate: adj.AdjustmentDate, BranchID: adj.BranchID}
+	sides := []struct {
+		entityType string
+		entityID   int64
+		sign       int64 // +1 receives the money, -1 pays it
+	}{
+		{adj.FromType, adj.FromID, -1},
+		{adj.ToType, adj.ToID, 1},
+	}
+	var accountType string
+	for _, side := range sides {
+		amount := adj.Amount.Mul(side.sign)
+		switch side.entityType {
+		case models.ENTITY_ACCOUNT:
+			err := tx.QueryRow(ctx, `
+				UPDATE accounts SET current_balance = current_balance + $1, updated_at = CURRENT_TIMESTAMP
+				WHERE id = $2 AND branch_id = $3
+				RETURNING type
+			`, amount, side.entityID, adj.BranchID).Scan(&accountType)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, errors.New("account not found for this branch")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("update account balance failed: %w", err)
+			}
+		case models.ENTITY_CUSTOMER:
+			// money from the customer settles due, money to the customer is owed back by them
+			tag, err := tx.Exec(ctx, `UPDATE customers SET due_amount = due_amount + $1 WHERE id = $2 AND branch_id = $3`,
+				amount, side.entityID, adj.BranchID)
+			if err != nil {
+				return nil, fmt.Errorf("update customer due failed: %w", err)
+			}
+			if tag.RowsAffected() == 0 {
+				return nil, errors.New("customer not found for this branch")
+			}
+		case models.ENTITY_SUPPLIER, models.ENTITY_EMPLOYEE:
+			sheet.Expense += amount
+		}
+	}
+
+	// customer money received into (or refunded from) an account
+	if adj.FromType == models.ENTITY_CUSTOMER || adj.ToType == models.ENTITY_CUSTOMER {
+		received := adj.Amount
+		if adj.ToType == models.ENTITY_CUSTOMER {
+			received = -received
+		}
+		if accountType == models.ACCOUNT_BANK {
+			sheet.Bank += received
+		} else {
+			sheet.Cash += received
+		}
+	}
+	if sheet.Expense != 0 || sheet.Cash != 0 || sheet.Bank != 0 {
+		if err := SaveTopSheetTx(tx, ctx, sheet); err != nil {
+			return nil, fmt.Errorf("update top sheet failed: %w", err)
+		}
+	}
+
+	return t, tx.Commit(ctx)
+}
+
+// ListAdjustments returns the adjustments posted in the branch with who posted them, newest first
+func (r *PeriodRepo) ListAdjustments(ctx context.Context, branchID int64) ([]*models.PeriodAdjustmentRecord, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT a.id, a.branch_id, a.transaction_id, COALESCE(t.memo_no, ''), a.adjustment_date, a.reference,
+		       COALESCE(t.from_entity_type, ''), t.from_entity_id, COALESCE(t.to_entity_type, ''), t.to_entity_id,
+		       t.amount, COALESCE(t.notes, ''),
+		       a.employee_id, a.employee_name, a.created_at
+		FROM period_adjustments a
+		JOIN transactions t ON t.transaction_id = a.transaction_id
+		WHERE a.branch_id = $1
+		ORDER BY a.created_at DESC, a.id DESC
+	`, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("list period adjustments failed: %w", err)
+	}
+	defer rows.Close()
+
+	adjustments := []*models.PeriodAdjustmentRecord{}
+	for rows.Next() {
+		a := &models.PeriodAdjustmentRecord{}
+		if err := rows.Scan(&a.ID, &a.BranchID, &a.TransactionID, &a.MemoNo, &a.AdjustmentDate, &a.Reference,
+			&a.FromType, &a.FromID, &a.ToType, &a.ToID, &a.Amount, &a.Notes,
+			&a.EmployeeID, &a.EmployeeName, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan period adjustment failed: %w", err)
+		}
+		adjustments = append(adjustments, a)
+	}
+	return adjustments, rows.Err()
+}
@@ -0,0 +1,164 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// A job taken by a client that does not report back within printJobTimeout
+// is handed out again, up to printJobAttempts times in all
+const (
+	printJobTimeout  = "2 minutes"
+	printJobAttempts = 5
+)
+
+// ============================== Print Job Repository ==============================
+type PrintJobRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewPrintJobRepo(db *pgxpool.Pool) *PrintJobRepo {
+	return &PrintJobRepo{db: db}
+}
+
+const printJobColumns = `
+	id, branch_id, printer, document_type, document_id, kind, memo_no, status,
+	attempts, error, created_by, created_at, claimed_at, finished_at`
+
+func scanPrintJob(row pgx.Row, dest ...any) (*models.PrintJob, error) {
+	j := &models.PrintJob{}
+	err := row.Scan(append([]any{&j.ID, &j.BranchID, &j.Printer, &j.DocumentType, &j.DocumentID, &j.Kind, &j.MemoNo, &j.Status,
+		&j.Attempts, &j.Error, &j.CreatedBy, &j.CreatedAt, &j.ClaimedAt, &j.FinishedAt}, dest...)...)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// CreateJob queues a receipt for the branch's printer
+func (p *PrintJobRepo) CreateJob(ctx context.Context, job *models.PrintJob) (*models.PrintJob, error) {
+	created, err := scanPrintJob(p.db.QueryRow(ctx, `
+		INSERT INTO print_jobs (branch_id, printer, document_type, document_id, kind, memo_no, payload, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+printJobColumns,
+		job.BranchID, strings.TrimSpace(job.Printer), job.DocumentType, job.DocumentID, job.Kind, job.MemoNo, job.Payload, job.CreatedBy))
+	if err != nil {
+		return nil, fmt.Errorf("insert print job failed: %w", err)
+	}
+	return created, nil
+}
+
+// ClaimNext hands the oldest waiting job of the branch to a client, with its
+// payload. Jobs for another printer are left; jobs another client took but
+// never reported on are handed out again. It returns nil when none is waiting.
+func (p *PrintJobRepo) ClaimNext(ctx context.Context, branchID int64, printer string) (*models.PrintJob, error) {
+	var payload []byte
+	job, err := scanPrintJob(p.db.QueryRow(ctx, `
+		UPDATE print_jobs
+		SET status = 'printing', attempts = attempts + 1, claimed_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM print_jobs
+			WHERE branch_id = $1
+			  AND (printer = '' OR printer = $2)
+			  AND (status = 'queued'
+			       OR (status = 'printing' AND claimed_at < CURRENT_TIMESTAMP - $3::interval AND attempts < $4))
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+printJobColumns+`, payload`,
+		branchID, strings.TrimSpace(printer), printJobTimeout, printJobAttempts), &payload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim print job failed: %w", err)
+	}
+	job.Payload = payload
+	return job, nil
+}
+
+// MarkDone records that the receipt came out of the printer
+func (p *PrintJobRepo) MarkDone(ctx context.Context, branchID, jobID int64) error {
+	tag, err := p.db.Exec(ctx, `
+		UPDATE print_jobs SET status = 'done', error = '', finished_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND branch_id = $2 AND status = 'printing'
+	`, jobID, branchID)
+	if err != nil {
+		return fmt.Errorf("update print job failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("print job %d is not being printed in this branch", jobID)
+	}
+	return nil
+}
+
+// MarkFailed records a failed print. The job is queued again until it has
+// been tried printJobAttempts times, then it is left failed.
+func (p *PrintJobRepo) MarkFailed(ctx context.Context, branchID, jobID int64, reason string) (*models.PrintJob, error) {
+	job, err := scanPrintJob(p.db.QueryRow(ctx, `
+		UPDATE print_jobs
+		SET status = CASE WHEN attempts >= $3 THEN 'failed' ELSE 'queued' END,
+			error = $4,
+			claimed_at = NULL,
+			finished_at = CASE WHEN attempts >= $3 THEN CURRENT_TIMESTAMP END
+		WHERE id = $1 AND branch_id = $2 AND status = 'printing'
+		RETURNING `+printJobColumns,
+		jobID, branchID, printJobAttempts, strings.TrimSpace(reason)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("print job %d is not being printed in this branch", jobID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update print job failed: %w", err)
+	}
+	return job, nil
+}
+
+// Retry queues a failed job again with a fresh count of attempts
+func (p *PrintJobRepo) Retry(ctx context.Context, branchID, jobID int64) (*models.PrintJob, error) {
+	job, err := scanPrintJob(p.db.QueryRow(ctx, `
+		UPDATE print_jobs
+		SET status = 'queued', attempts = 0, claimed_at = NULL, finished_at = NULL
+		WHERE id = $1 AND branch_id = $2 AND status = 'failed'
+		RETURNING `+printJobColumns,
+		jobID, branchID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("print job %d has not failed in this branch", jobID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update print job failed: %w", err)
+	}
+	return job, nil
+}
+
+// ListJobs returns the latest jobs of the branch, newest first, optionally
+// only those with status
+func (p *PrintJobRepo) ListJobs(ctx context.Context, branchID int64, status string, limit int) ([]*models.PrintJob, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT `+printJobColumns+`
+		FROM print_jobs
+		WHERE branch_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, branchID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("fetch print jobs failed: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*models.PrintJob{}
+	for rows.Next() {
+		j, err := scanPrintJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan print job failed: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
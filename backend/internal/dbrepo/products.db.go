@@ -9,7 +9,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
-	"github.com/projuktisheba/erp-mini-api/internal/utils"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
 )
 
 type ProductRepo struct {
@@ -27,7 +27,7 @@ func NewProductRepo(db *pgxpool.Pool) *ProductRepo {
 func (s *ProductRepo) GetProducts(ctx context.Context, branchID int64) ([]*models.Product, error) {
 	query := `
         SELECT 
-            id, product_name, quantity, created_at, updated_at
+            id, product_name, quantity, unit_cost, tax_category, created_at, updated_at
         FROM products
         WHERE branch_id = $1
         ORDER BY id;
@@ -41,7 +41,7 @@ func (s *ProductRepo) GetProducts(ctx context.Context, branchID int64) ([]*model
 	var products []*models.Product
 	for rows.Next() {
 		var p models.Product
-		if err := rows.Scan(&p.ID, &p.ProductName, &p.CurrentStockLevel, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.ProductName, &p.CurrentStockLevel, &p.UnitCost, &p.TaxCategory, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("error scanning product: %w", err)
 		}
 		products = append(products, &p)
@@ -55,7 +55,7 @@ func (s *ProductRepo) GetProducts(ctx context.Context, branchID int64) ([]*model
 // ============================== ADD PRODUCTS TO STOCK ==============================
 // RestockProducts increments stock quantities for given products and logs the operation.
 // (V2)
-func (s *ProductRepo) RestockProducts(ctx context.Context, date time.Time, memoNo string, branchID int64, products []models.Product) (string, error) {
+func (s *ProductRepo) RestockProducts(ctx context.Context, date time.Time, branchID int64, products []models.Product) (string, error) {
 	// Begin transaction
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
@@ -63,19 +63,24 @@ func (s *ProductRepo) RestockProducts(ctx context.Context, date time.Time, memoN
 	}
 	defer tx.Rollback(ctx)
 
-	// Generate next memo number if not provided
-	if memoNo == "" {
-		memoNo = utils.GenerateMemoNo()
+	if err := EnsurePeriodOpenTx(ctx, tx, branchID, date); err != nil {
+		return "", err
+	}
+
+	// Generate next memo number
+	memoNo, err := NextMemoNoTx(ctx, tx, branchID, models.MEMO_RESTOCK, date)
+	if err != nil {
+		return "", err
 	}
 
 	// Update stock and insert restock record
 	for _, item := range products {
-		// Update product stock
+		// Update product stock (and the unit cost when the restock carries one)
 		_, err := tx.Exec(ctx, `
 			UPDATE products
-			SET quantity = quantity + $1, updated_at = CURRENT_TIMESTAMP
+			SET quantity = quantity + $1, unit_cost = COALESCE($3, unit_cost), updated_at = CURRENT_TIMESTAMP
 			WHERE id = $2;
-		`, item.Quantity, item.ID)
+		`, item.Quantity, item.ID, item.UnitCost)
 		if err != nil {
 			return "", fmt.Errorf("update stock for product %d: %w", item.ID, err)
 		}
@@ -111,7 +116,14 @@ func (s *ProductRepo) DeleteStockProducts(ctx context.Context, stockID, branchID
 
 	//Load old data
 	var productID, productQuantity int64 
-	err = tx.QueryRow(ctx, `SELECT product_id, quantity FROM product_stock_registry WHERE id=$1 AND branch_id=$2`, stockID, branchID).Scan(&productID, &productQuantity) 
+	var stockDate time.Time
+	err = tx.QueryRow(ctx, `SELECT product_id, quantity, stock_date FROM product_stock_registry WHERE id=$1 AND branch_id=$2`, stockID, branchID).Scan(&productID, &productQuantity, &stockDate) 
+	if err != nil {
+		return fmt.Errorf("load stock record: %w", err)
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, branchID, stockDate); err != nil {
+		return err
+	}
 
 	// Update stock and insert restock record
 	_, err = tx.Exec(ctx, `
@@ -272,15 +284,46 @@ func (r *ProductRepo) SaleProducts(ctx context.Context, sale *models.SaleDB) (in
 	if len(sale.Items) == 0 {
 		return 0, fmt.Errorf("sale must contain at least one item")
 	}
-	if sale.ReceivedAmount < 0 {
+	if err := applySaleDiscountsTx(ctx, tx, sale, nil); err != nil {
+		return 0, err
+	}
+	if err := applySaleTaxesTx(ctx, tx, sale, nil); err != nil {
+		return 0, err
+	}
+	if sale.ReceivedAmount < 0 || sale.StoreCreditAmount < 0 {
 		return 0, fmt.Errorf("received amount cannot be negative")
 	}
-	if sale.ReceivedAmount > sale.TotalAmount {
+	payments, err := normalizePayments(&sale.PaymentAccountID, &sale.ReceivedAmount, sale.Payments)
+	if err != nil {
+		return 0, err
+	}
+	voucherAmount, err := voucherTotal(sale.Vouchers)
+	if err != nil {
+		return 0, err
+	}
+	loyaltyAmount, err := loyaltyPaymentTx(ctx, tx, sale.BranchID, sale.CustomerID, sale.LoyaltyPoints, sale.SaleDate)
+	if err != nil {
+		return 0, err
+	}
+	if sale.ReceivedAmount+sale.StoreCreditAmount+voucherAmount+loyaltyAmount > sale.TotalAmount {
 		return 0, fmt.Errorf("received amount cannot exceed total amount")
 	}
+	if err := EnsurePeriodOpenTx(ctx, tx, sale.BranchID, sale.SaleDate); err != nil {
+		return 0, err
+	}
+	// ReceivedAmount is paid into the account, the rest of received_amount from
+	// store credit, gift vouchers and loyalty points
+	sale.ReceivedAmount += sale.StoreCreditAmount + voucherAmount + loyaltyAmount
+
+	override, err := checkCreditLimitTx(ctx, tx, sale.BranchID, sale.CustomerID, sale.TotalAmount-sale.ReceivedAmount, sale.CreditOverride)
+	if err != nil {
+		return 0, err
+	}
+	overrideBy, overrideReason := creditOverrideColumns(override)
 
-	if sale.MemoNo == "" {
-		sale.MemoNo = utils.GenerateMemoNo()
+	// always the next memo number of the branch; one sent by the client is ignored
+	if sale.MemoNo, err = NextMemoNoTx(ctx, tx, sale.BranchID, models.MEMO_SALE, sale.SaleDate); err != nil {
+		return 0, err
 	}
 	// --------------------
 	// Step 0: Reduce stock  & calculate total items
@@ -306,9 +349,10 @@ func (r *ProductRepo) SaleProducts(ctx context.Context, sale *models.SaleDB) (in
 			branch_id, memo_no, sale_date,
 			salesperson_id, customer_id,
 			total_products, total_amount, received_amount,
-			status, notes, created_at, updated_at
+			status, notes, created_at, updated_at,
+			credit_override_by, credit_override_reason
 		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
 		RETURNING id
 	`,
 		sale.BranchID,
@@ -323,6 +367,8 @@ func (r *ProductRepo) SaleProducts(ctx context.Context, sale *models.SaleDB) (in
 		sale.Notes,
 		sale.CreatedAt,
 		sale.UpdatedAt,
+		overrideBy,
+		overrideReason,
 	).Scan(&saleID)
 	if err != nil {
 		return 0, fmt.Errorf("insert sale failed: %w", err)
@@ -332,19 +378,31 @@ func (r *ProductRepo) SaleProducts(ctx context.Context, sale *models.SaleDB) (in
 	// Step 2: Insert sale items
 	// --------------------
 	for _, item := range sale.Items {
+		discountType, discountValue := discountColumns(item.Discount)
 		_, err := tx.Exec(ctx, `
-			INSERT INTO sale_items(sale_id, product_id, quantity, subtotal)
-			VALUES ($1,$2,$3,$4)
+			INSERT INTO sale_items(sale_id, product_id, quantity, subtotal, discount_type, discount_value, discount_amount)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)
 		`,
 			saleID,
 			item.ProductID,
 			item.Quantity,
 			item.Subtotal,
+			discountType,
+			discountValue,
+			item.DiscountAmount,
 		)
 		if err != nil {
 			return 0, fmt.Errorf("insert sale item failed: %w", err)
 		}
 	}
+	err = saveDocumentDiscountsTx(ctx, tx, models.DOCUMENT_SALE, saleID, sale.BranchID, sale.CustomerID,
+		sale.MemoNo, sale.SaleDate, &sale.DocumentDiscounts)
+	if err != nil {
+		return 0, err
+	}
+	if err := saveDocumentTaxesTx(ctx, tx, models.DOCUMENT_SALE, saleID, sale.BranchID, sale.SaleDate, &sale.DocumentTax); err != nil {
+		return 0, err
+	}
 
 	// --------------------
 	// Step 3: Update top sheet
@@ -356,22 +414,23 @@ func (r *ProductRepo) SaleProducts(ctx context.Context, sale *models.SaleDB) (in
 		ReadyMade:   sale.TotalItems,  // total items
 	}
 
-	var acctType string
-	if sale.ReceivedAmount > 0 {
-		err = tx.QueryRow(ctx,
-			`SELECT type FROM accounts WHERE id=$1 AND branch_id=$2`,
-			sale.PaymentAccountID,
-			sale.BranchID,
-		).Scan(&acctType)
-		if err != nil {
-			return 0, fmt.Errorf("lookup account type failed: %w", err)
-		}
-
-		if acctType == models.ACCOUNT_BANK {
-			topSheet.Bank = sale.ReceivedAmount
-		} else {
-			topSheet.Cash = sale.ReceivedAmount
-		}
+	// --------------------
+	// Step 4: Payment transactions, one per payment
+	// --------------------
+	_, err = postPaymentsTx(ctx, tx, paymentPosting{
+		docType:     models.DOCUMENT_SALE,
+		docID:       saleID,
+		branchID:    sale.BranchID,
+		customerID:  sale.CustomerID,
+		date:        sale.SaleDate,
+		memoNo:      sale.MemoNo,
+		deliveredBy: sale.SalespersonID,
+		quantity:    sale.TotalItems,
+		txType:      models.PAYMENT,
+		notes:       "Received payment on sale",
+	}, payments, nil, topSheet)
+	if err != nil {
+		return 0, err
 	}
 
 	if err := SaveTopSheetTx(tx, ctx, topSheet); err != nil {
@@ -379,76 +438,32 @@ func (r *ProductRepo) SaleProducts(ctx context.Context, sale *models.SaleDB) (in
 	}
 
 	// --------------------
-	// Step 4: Payment transactions
+	// Step 4d: Payment from store credit
 	// --------------------
-	if sale.ReceivedAmount > 0 {
-		// lock account row
-		_, err := tx.Exec(ctx,
-			`SELECT id FROM accounts WHERE id=$1 FOR UPDATE`,
-			sale.PaymentAccountID,
-		)
-		if err != nil {
-			return 0, fmt.Errorf("lock account failed: %w", err)
-		}
-
-		// 4a: sale payment transaction
-		_, err = tx.Exec(ctx, `
-			INSERT INTO sale_transactions(
-				sale_id, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
-				amount, transaction_type
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-		`,
-			saleID,
-			sale.SaleDate,
-			sale.PaymentAccountID,
-			sale.MemoNo,
-			sale.SalespersonID,
-			sale.TotalAmount,
-			sale.ReceivedAmount,
-			models.PAYMENT,
-		)
+	if sale.StoreCreditAmount > 0 {
+		err = spendStoreCreditTx(ctx, tx, sale.BranchID, sale.CustomerID, models.DOCUMENT_SALE, saleID, sale.MemoNo,
+			sale.SaleDate, sale.SalespersonID, sale.StoreCreditAmount)
 		if err != nil {
-			return 0, fmt.Errorf("insert payment transaction failed (4a): %w", err)
+			return 0, err
 		}
+	}
 
-		// 4b: global transaction log
-		_, err = tx.Exec(ctx, `
-			INSERT INTO transactions(
-				transaction_date, memo_no, branch_id,
-				from_entity_id, from_entity_type,
-				to_entity_id, to_entity_type,
-				amount, transaction_type, notes
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-		`,
-			sale.SaleDate,
-			models.SALE_MEMO_PREFIX+"-"+sale.MemoNo,
-			sale.BranchID,
-			sale.CustomerID,
-			models.ENTITY_CUSTOMER,
-			sale.PaymentAccountID,
-			models.ENTITY_ACCOUNT,
-			sale.ReceivedAmount,
-			models.PAYMENT,
-			"Received payment on sale",
-		)
-		if err != nil {
-			return 0, fmt.Errorf("insert transaction failed (4b): %w", err)
-		}
+	// --------------------
+	// Step 4e: Payment from gift vouchers
+	// --------------------
+	err = redeemVouchersTx(ctx, tx, sale.BranchID, sale.Vouchers, models.DOCUMENT_SALE, saleID, sale.MemoNo,
+		sale.SaleDate, sale.SalespersonID)
+	if err != nil {
+		return 0, err
+	}
 
-		// 4c: update account balance
-		_, err = tx.Exec(ctx, `
-			UPDATE accounts
-			SET current_balance = current_balance + $1
-			WHERE id = $2
-		`,
-			sale.ReceivedAmount,
-			sale.PaymentAccountID,
-		)
-		if err != nil {
-			return 0, fmt.Errorf("update account balance failed: %w", err)
-		}
+	// --------------------
+	// Step 4f: Payment with loyalty points
+	// --------------------
+	err = redeemLoyaltyTx(ctx, tx, sale.BranchID, sale.CustomerID, models.DOCUMENT_SALE, saleID, sale.MemoNo,
+		sale.SaleDate, sale.SalespersonID, sale.LoyaltyPoints, loyaltyAmount)
+	if err != nil {
+		return 0, err
 	}
 
 	// --------------------
@@ -492,6 +507,13 @@ func (r *ProductRepo) SaleProducts(ctx context.Context, sale *models.SaleDB) (in
 		return 0, fmt.Errorf("update salesperson progress failed: %w", err)
 	}
 
+	// --------------------
+	// Step 7: Loyalty points
+	// --------------------
+	if err := syncLoyaltyTx(ctx, tx, models.DOCUMENT_SALE, saleID, sale.SaleDate); err != nil {
+		return 0, err
+	}
+
 	return saleID, tx.Commit(ctx)
 }
 
@@ -515,9 +537,69 @@ func (r *ProductRepo) UpdateSale(ctx context.Context, sale, oldSale *models.Sale
 	if len(sale.Items) == 0 {
 		return fmt.Errorf("sale must contain at least one item")
 	}
+	if err := applySaleDiscountsTx(ctx, tx, sale, oldSale); err != nil {
+		return err
+	}
+	if err := applySaleTaxesTx(ctx, tx, sale, oldSale); err != nil {
+		return err
+	}
+	payments, err := normalizePayments(&sale.PaymentAccountID, &sale.ReceivedAmount, sale.Payments)
+	if err != nil {
+		return err
+	}
 	if sale.ReceivedAmount < 0 || sale.ReceivedAmount > sale.TotalAmount {
 		return fmt.Errorf("invalid received amount")
 	}
+	if len(sale.Vouchers) > 0 {
+		return fmt.Errorf("gift vouchers can only be redeemed on an existing sale through /vouchers/redeem")
+	}
+	if sale.LoyaltyPoints != 0 {
+		return fmt.Errorf("loyalty points can only be redeemed when the sale is recorded")
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, oldSale.BranchID, oldSale.SaleDate, sale.SaleDate); err != nil {
+		return err
+	}
+	// the memo number is kept from the sequence
+	sale.MemoNo = oldSale.MemoNo
+	// the edit re-creates the cash payment only; store credit, voucher and points movements would be lost
+	var storeCreditUsed bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM sale_transactions WHERE sale_id = $1 AND payment_account_id IS NULL)`,
+		oldSale.ID,
+	).Scan(&storeCreditUsed)
+	if err != nil {
+		return fmt.Errorf("check store credit failed: %w", err)
+	}
+	if storeCreditUsed {
+		return fmt.Errorf("sale paid with store credit, a gift voucher or loyalty points cannot be edited; return it and record a new sale")
+	}
+	// payments received after the sale stay with it
+	laterPaid, firstPaidOn, err := laterPaymentsTx(ctx, tx, models.DOCUMENT_SALE, oldSale.ID, models.PAYMENT, oldSale.MemoNo)
+	if err != nil {
+		return err
+	}
+	if laterPaid != 0 {
+		if sale.CustomerID != oldSale.CustomerID {
+			return fmt.Errorf("the customer of a sale with payments received after it cannot be changed")
+		}
+		if sale.SaleDate.After(*firstPaidOn) {
+			return fmt.Errorf("sale date cannot be after its first later payment on %s", firstPaidOn.Format("2006-01-02"))
+		}
+		sale.ReceivedAmount += laterPaid
+		if sale.ReceivedAmount > sale.TotalAmount {
+			return fmt.Errorf("received amount and the %s received later cannot exceed total amount", laterPaid)
+		}
+	}
+	// the credit limit is checked against what the edit adds to the customer's due
+	addedDue := sale.TotalAmount - sale.ReceivedAmount
+	if sale.CustomerID == oldSale.CustomerID {
+		addedDue -= oldSale.TotalAmount - oldSale.ReceivedAmount
+	}
+	override, err := checkCreditLimitTx(ctx, tx, oldSale.BranchID, sale.CustomerID, addedDue, sale.CreditOverride)
+	if err != nil {
+		return err
+	}
+	overrideBy, overrideReason := creditOverrideColumns(override)
 
 	// --------------------
 	// 2. Restore OLD stock
@@ -558,13 +640,15 @@ func (r *ProductRepo) UpdateSale(ctx context.Context, sale, oldSale *models.Sale
 			salesperson_id=$3, customer_id=$4,
 			total_products=$5, total_amount=$6,
 			received_amount=$7, notes=$8,
+			credit_override_by=COALESCE($10, credit_override_by),
+			credit_override_reason=COALESCE($11, credit_override_reason),
 			updated_at=CURRENT_TIMESTAMP
 		WHERE id=$9
 	`, sale.MemoNo, sale.SaleDate,
 		sale.SalespersonID, sale.CustomerID,
 		sale.TotalItems, sale.TotalAmount,
 		sale.ReceivedAmount, sale.Notes,
-		sale.ID,
+		sale.ID, overrideBy, overrideReason,
 	)
 	if err != nil {
 		return fmt.Errorf("update sale failed: %w", err)
@@ -579,17 +663,26 @@ func (r *ProductRepo) UpdateSale(ctx context.Context, sale, oldSale *models.Sale
 	}
 
 	for _, item := range sale.Items {
+		discountType, discountValue := discountColumns(item.Discount)
 		_, err = tx.Exec(ctx, `
-			INSERT INTO sale_items(sale_id, product_id, quantity, subtotal)
-			VALUES ($1,$2,$3,$4)
-		`, sale.ID, item.ProductID, item.Quantity, item.Subtotal)
+			INSERT INTO sale_items(sale_id, product_id, quantity, subtotal, discount_type, discount_value, discount_amount)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)
+		`, sale.ID, item.ProductID, item.Quantity, item.Subtotal, discountType, discountValue, item.DiscountAmount)
 		if err != nil {
 			return err
 		}
 	}
+	err = saveDocumentDiscountsTx(ctx, tx, models.DOCUMENT_SALE, sale.ID, oldSale.BranchID, sale.CustomerID,
+		sale.MemoNo, sale.SaleDate, &sale.DocumentDiscounts)
+	if err != nil {
+		return err
+	}
+	if err := saveDocumentTaxesTx(ctx, tx, models.DOCUMENT_SALE, sale.ID, oldSale.BranchID, sale.SaleDate, &sale.DocumentTax); err != nil {
+		return err
+	}
 
 	// --------------------
-	// 6. Top Sheet
+	// 6. Top Sheet & Payments
 	// --------------------
 	oldSheet := &models.TopSheetDB{
 		SheetDate:   oldSale.SaleDate,
@@ -597,22 +690,14 @@ func (r *ProductRepo) UpdateSale(ctx context.Context, sale, oldSale *models.Sale
 		SalesAmount: -oldSale.TotalAmount,
 		ReadyMade:   -oldSale.TotalItems,
 	}
-	var acctType string
-	if oldSale.ReceivedAmount > 0 {
-		err = tx.QueryRow(ctx,
-			`SELECT type FROM accounts WHERE id=$1 AND branch_id=$2`,
-			oldSale.SaleTransactions[0].PaymentAccountID,
-			oldSale.BranchID,
-		).Scan(&acctType)
-		if err != nil {
-			return fmt.Errorf("lookup account type failed: %w", err)
-		}
-
-		if acctType == models.ACCOUNT_BANK {
-			oldSheet.Bank = -oldSale.ReceivedAmount
-		} else {
-			oldSheet.Cash = -oldSale.ReceivedAmount
-		}
+	// take back the payment made with the sale; later ones stay
+	if err := revertPaymentsTx(ctx, tx, models.DOCUMENT_SALE, sale.ID, models.PAYMENT, oldSale.MemoNo, oldSheet); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM transactions WHERE memo_no=$1 AND branch_id=$2 AND transaction_type=$3`,
+		models.SALE_MEMO_PREFIX+"-"+oldSale.MemoNo, oldSale.BranchID, models.PAYMENT)
+	if err != nil {
+		return fmt.Errorf("delete old global tx failed: %w", err)
 	}
 	newSheet := &models.TopSheetDB{
 		SheetDate:   sale.SaleDate,
@@ -621,21 +706,21 @@ func (r *ProductRepo) UpdateSale(ctx context.Context, sale, oldSale *models.Sale
 		ReadyMade:   sale.TotalItems,
 	}
 
-	if sale.ReceivedAmount > 0 {
-		err = tx.QueryRow(ctx,
-			`SELECT type FROM accounts WHERE id=$1 AND branch_id=$2`,
-			sale.PaymentAccountID,
-			sale.BranchID,
-		).Scan(&acctType)
-		if err != nil {
-			return fmt.Errorf("lookup account type failed: %w", err)
-		}
-
-		if acctType == models.ACCOUNT_BANK {
-			newSheet.Bank = sale.ReceivedAmount
-		} else {
-			newSheet.Cash = sale.ReceivedAmount
-		}
+	// post every new payment
+	_, err = postPaymentsTx(ctx, tx, paymentPosting{
+		docType:     models.DOCUMENT_SALE,
+		docID:       sale.ID,
+		branchID:    sale.BranchID,
+		customerID:  sale.CustomerID,
+		date:        sale.SaleDate,
+		memoNo:      sale.MemoNo,
+		deliveredBy: sale.SalespersonID,
+		quantity:    sale.TotalItems,
+		txType:      models.PAYMENT,
+		notes:       "Received payment on sale",
+	}, payments, nil, newSheet)
+	if err != nil {
+		return err
 	}
 	if err := SaveTopSheetTx(tx, ctx, oldSheet); err != nil {
 		return err
@@ -661,70 +746,7 @@ func (r *ProductRepo) UpdateSale(ctx context.Context, sale, oldSale *models.Sale
 	}
 
 	// --------------------
-	// 8. Accounts & Transaction
-	// --------------------
-	if oldSale.ReceivedAmount > 0 {
-		_, err = tx.Exec(ctx,
-			`UPDATE accounts SET current_balance = current_balance - $1 WHERE id=$2`,
-			oldSale.ReceivedAmount, oldSale.PaymentAccountID)
-		if err != nil {
-			return err
-		}
-
-		_, _ = tx.Exec(ctx, `DELETE FROM sale_transactions WHERE sale_id=$1`, sale.ID)
-		_, _ = tx.Exec(ctx, `DELETE FROM transactions WHERE memo_no=$1`,
-			models.SALE_MEMO_PREFIX+"-"+oldSale.MemoNo)
-	}
-
-	if sale.ReceivedAmount > 0 {
-		_, err = tx.Exec(ctx,
-			`UPDATE accounts SET current_balance = current_balance + $1 WHERE id=$2`,
-			sale.ReceivedAmount, sale.PaymentAccountID)
-		if err != nil {
-			return err
-		}
-
-		_, err = tx.Exec(ctx, `
-			INSERT INTO sale_transactions(
-				sale_id, transaction_date, payment_account_id,
-				memo_no, delivered_by, quantity_delivered,
-				amount, transaction_type
-			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-		`,
-			sale.ID, sale.SaleDate, sale.PaymentAccountID,
-			sale.MemoNo, sale.SalespersonID,
-			sale.TotalItems, sale.ReceivedAmount, models.PAYMENT)
-		if err != nil {
-			return err
-		}
-		_, err = tx.Exec(ctx, `
-			INSERT INTO transactions(
-				transaction_date, memo_no, branch_id,
-				from_entity_id, from_entity_type,
-				to_entity_id, to_entity_type,
-				amount, transaction_type, notes
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-		`,
-			sale.SaleDate,
-			models.SALE_MEMO_PREFIX+"-"+sale.MemoNo,
-			sale.BranchID,
-			sale.CustomerID,
-			models.ENTITY_CUSTOMER,
-			sale.PaymentAccountID,
-			models.ENTITY_ACCOUNT,
-			sale.ReceivedAmount,
-			models.PAYMENT,
-			"Received payment on sale",
-		)
-		if err != nil {
-			return fmt.Errorf("insert transaction failed (4b): %w", err)
-		}
-
-	}
-
-	// --------------------
-	// 9. Salesperson progress
+	// 8. Salesperson progress
 	// --------------------
 	oldSalespersonProgress := &models.EmployeeProgressDB{
 		SheetDate:  oldSale.SaleDate,
@@ -747,6 +769,13 @@ func (r *ProductRepo) UpdateSale(ctx context.Context, sale, oldSale *models.Sale
 		return fmt.Errorf("update salesperson progress failed: %w", err)
 	}
 
+	// --------------------
+	// 9. Loyalty points of the sale as it is now
+	// --------------------
+	if err := syncLoyaltyTx(ctx, tx, models.DOCUMENT_SALE, sale.ID, sale.SaleDate); err != nil {
+		return err
+	}
+
 	return tx.Commit(ctx)
 }
 
@@ -777,6 +806,7 @@ func (r *ProductRepo) GetSaleDetailsByID(
 			o.customer_id,
 			c.name AS customer_name,
 			c.mobile AS customer_mobile,
+			c.tax_id AS customer_tax_id,
 			o.total_products,
 			o.total_amount,
 			o.received_amount,
@@ -799,9 +829,10 @@ func (r *ProductRepo) GetSaleDetailsByID(
 		&sale.CustomerID,
 		&sale.Customer.Name,
 		&sale.Customer.Mobile,
+		&sale.Customer.TaxID,
 		&sale.TotalItems,
-		&sale.TotalAmount,    // float64
-		&sale.ReceivedAmount, // float64
+		&sale.TotalAmount,
+		&sale.ReceivedAmount,
 		&sale.Status,
 		&sale.Notes,
 		&sale.CreatedAt,
@@ -816,6 +847,12 @@ func (r *ProductRepo) GetSaleDetailsByID(
 
 	sale.Customer.ID = sale.CustomerID
 	sale.Salesperson.ID = sale.SalespersonID
+	if err := loadDocumentDiscounts(ctx, r.db, models.DOCUMENT_SALE, sale.ID, &sale.DocumentDiscounts); err != nil {
+		return nil, err
+	}
+	if err := loadDocumentTaxes(ctx, r.db, models.DOCUMENT_SALE, sale.ID, &sale.DocumentTax); err != nil {
+		return nil, err
+	}
 
 	// ------------------------------------------------
 	// 2. Fetch sale items + products
@@ -825,7 +862,10 @@ func (r *ProductRepo) GetSaleDetailsByID(
 			oi.product_id,
 			p.product_name,
 			oi.quantity,
-			oi.subtotal
+			oi.subtotal,
+			oi.discount_type,
+			oi.discount_value,
+			oi.discount_amount
 		FROM sale_items oi
 		JOIN products p ON p.id = oi.product_id
 		WHERE oi.sale_id = $1
@@ -837,15 +877,23 @@ func (r *ProductRepo) GetSaleDetailsByID(
 	defer itemRows.Close()
 
 	for itemRows.Next() {
-		var it models.SaleItemDB
+		var (
+			it            models.SaleItemDB
+			discountType  *string
+			discountValue *money.Amount
+		)
 		if err := itemRows.Scan(
 			&it.ProductID,
 			&it.ProductName,
 			&it.Quantity,
-			&it.Subtotal, // float64
+			&it.Subtotal,
+			&discountType,
+			&discountValue,
+			&it.DiscountAmount,
 		); err != nil {
 			return nil, err
 		}
+		it.Discount = itemDiscount(discountType, discountValue)
 		sale.Items = append(sale.Items, it)
 	}
 
@@ -863,9 +911,13 @@ func (r *ProductRepo) GetSaleDetailsByID(
 			t.quantity_delivered,
 			t.amount,
 			t.transaction_type,
+			t.reference,
+			COALESCE(v.code, '') AS voucher_code,
+			COALESCE(t.loyalty_points, 0) AS loyalty_points,
 			t.created_at
 		FROM sale_transactions t
 		LEFT JOIN accounts a ON(a.id=t.payment_account_id)
+		LEFT JOIN gift_vouchers v ON(v.id=t.voucher_id)
 		WHERE sale_id = $1
 		ORDER BY transaction_date DESC, sale_id DESC
 	`, saleID)
@@ -886,6 +938,9 @@ func (r *ProductRepo) GetSaleDetailsByID(
 			&t.QuantityDelivered,
 			&t.Amount,
 			&t.TransactionType,
+			&t.Reference,
+			&t.VoucherCode,
+			&t.LoyaltyPoints,
 			&t.CreatedAt,
 		); err != nil {
 			return nil, err
@@ -893,6 +948,10 @@ func (r *ProductRepo) GetSaleDetailsByID(
 		sale.SaleTransactions = append(sale.SaleTransactions, t)
 	}
 
+	if sale.PointsEarned, err = documentPointsEarned(ctx, r.db, models.DOCUMENT_SALE, saleID); err != nil {
+		return nil, err
+	}
+
 	return &sale, nil
 }
 
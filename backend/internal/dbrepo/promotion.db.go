@@ -0,0 +1,230 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ============================== Promotions & Coupons ==============================
+type PromotionRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewPromotionRepo(db *pgxpool.Pool) *PromotionRepo {
+	return &PromotionRepo{db: db}
+}
+
+// validatePromotion checks a promotion before it is saved
+func validatePromotion(p *models.Promotion) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("promotion name is required")
+	}
+	if err := validateDiscount(&models.Discount{Type: p.DiscountType, Value: p.DiscountValue}); err != nil {
+		return err
+	}
+	if p.DiscountValue == 0 {
+		return errors.New("promotion discount must be more than zero")
+	}
+	if p.StartsOn.IsZero() || p.EndsOn.IsZero() {
+		return errors.New("promotion start and end dates are required")
+	}
+	if p.EndsOn.Before(p.StartsOn) {
+		return errors.New("promotion cannot end before it starts")
+	}
+	return nil
+}
+
+const promotionColumns = `
+	id, branch_id, name, discount_type, discount_value, starts_on, ends_on,
+	requires_coupon, active, created_by, created_at, updated_at`
+
+func scanPromotion(row pgx.Row) (*models.Promotion, error) {
+	var p models.Promotion
+	err := row.Scan(&p.ID, &p.BranchID, &p.Name, &p.DiscountType, &p.DiscountValue, &p.StartsOn, &p.EndsOn,
+		&p.RequiresCoupon, &p.Active, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPromotions returns the promotions that run in a branch, newest first.
+// With activeOn set only the active ones running on that date are returned.
+func (r *PromotionRepo) ListPromotions(ctx context.Context, branchID int64, activeOn *time.Time) ([]*models.Promotion, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+promotionColumns+`
+		FROM promotions
+		WHERE (branch_id IS NULL OR branch_id = $1)
+		  AND ($2::date IS NULL OR (active AND $2::date BETWEEN starts_on AND ends_on))
+		ORDER BY starts_on DESC, id DESC
+	`, branchID, activeOn)
+	if err != nil {
+		return nil, fmt.Errorf("list promotions failed: %w", err)
+	}
+	defer rows.Close()
+
+	promotions := []*models.Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan promotion failed: %w", err)
+		}
+		promotions = append(promotions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("promotion rows failed: %w", err)
+	}
+	return promotions, nil
+}
+
+// GetPromotion returns a promotion that runs in the branch with its coupons
+func (r *PromotionRepo) GetPromotion(ctx context.Context, branchID, promotionID int64) (*models.Promotion, error) {
+	p, err := scanPromotion(r.db.QueryRow(ctx, `
+		SELECT `+promotionColumns+`
+		FROM promotions
+		WHERE id = $1 AND (branch_id IS NULL OR branch_id = $2)
+	`, promotionID, branchID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("promotion with id %d not found", promotionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load promotion failed: %w", err)
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT c.id, c.promotion_id, c.code, c.max_uses, c.max_uses_per_customer,
+		       (SELECT COUNT(*) FROM coupon_redemptions cr WHERE cr.coupon_id = c.id),
+		       c.active, c.created_at
+		FROM coupons c
+		WHERE c.promotion_id = $1
+		ORDER BY c.code
+	`, promotionID)
+	if err != nil {
+		return nil, fmt.Errorf("list coupons failed: %w", err)
+	}
+	defer rows.Close()
+
+	p.Coupons = []*models.Coupon{}
+	for rows.Next() {
+		var c models.Coupon
+		if err := rows.Scan(&c.ID, &c.PromotionID, &c.Code, &c.MaxUses, &c.MaxUsesPerCustomer,
+			&c.UsedCount, &c.Active, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan coupon failed: %w", err)
+		}
+		p.Coupons = append(p.Coupons, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("coupon rows failed: %w", err)
+	}
+	return p, nil
+}
+
+// CreatePromotion saves a new promotion; a nil BranchID runs it in every branch
+func (r *PromotionRepo) CreatePromotion(ctx context.Context, p *models.Promotion) error {
+	if err := validatePromotion(p); err != nil {
+		return err
+	}
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO promotions (branch_id, name, discount_type, discount_value, starts_on, ends_on,
+			requires_coupon, active, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at
+	`, p.BranchID, p.Name, p.DiscountType, p.DiscountValue, p.StartsOn, p.EndsOn,
+		p.RequiresCoupon, p.Active, p.CreatedBy,
+	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert promotion failed: %w", err)
+	}
+	return nil
+}
+
+// UpdatePromotion changes a promotion of the branch. Documents that already
+// got the promotion keep the discount they were given.
+func (r *PromotionRepo) UpdatePromotion(ctx context.Context, branchID int64, p *models.Promotion) error {
+	if err := validatePromotion(p); err != nil {
+		return err
+	}
+	err := r.db.QueryRow(ctx, `
+		UPDATE promotions SET
+			branch_id = $3, name = $4, discount_type = $5, discount_value = $6,
+			starts_on = $7, ends_on = $8, requires_coupon = $9, active = $10,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (branch_id IS NULL OR branch_id = $2)
+		RETURNING created_by, created_at, updated_at
+	`, p.ID, branchID, p.BranchID, p.Name, p.DiscountType, p.DiscountValue,
+		p.StartsOn, p.EndsOn, p.RequiresCoupon, p.Active,
+	).Scan(&p.CreatedBy, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("promotion with id %d not found", p.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("update promotion failed: %w", err)
+	}
+	return nil
+}
+
+// AddCoupon adds a code to a promotion of the branch
+func (r *PromotionRepo) AddCoupon(ctx context.Context, branchID int64, c *models.Coupon) error {
+	c.Code = strings.TrimSpace(c.Code)
+	if c.Code == "" || len(c.Code) > 40 || strings.ContainsAny(c.Code, " \t") {
+		return errors.New("coupon code must be 1 to 40 characters without spaces")
+	}
+	if (c.MaxUses != nil && *c.MaxUses <= 0) || (c.MaxUsesPerCustomer != nil && *c.MaxUsesPerCustomer <= 0) {
+		return errors.New("coupon usage limits must be more than zero")
+	}
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO coupons (promotion_id, code, max_uses, max_uses_per_customer, active)
+		SELECT id, $3, $4, $5, $6
+		FROM promotions
+		WHERE id = $1 AND (branch_id IS NULL OR branch_id = $2)
+		RETURNING id, created_at
+	`, c.PromotionID, branchID, c.Code, c.MaxUses, c.MaxUsesPerCustomer, c.Active).Scan(&c.ID, &c.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("promotion with id %d not found", c.PromotionID)
+	}
+	if err != nil {
+		return fmt.Errorf("insert coupon failed: %w", err)
+	}
+	return nil
+}
+
+// SetCouponActive turns a coupon of a promotion of the branch on or off
+func (r *PromotionRepo) SetCouponActive(ctx context.Context, branchID, couponID int64, active bool) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE coupons c SET active = $3
+		FROM promotions p
+		WHERE c.id = $1 AND p.id = c.promotion_id AND (p.branch_id IS NULL OR p.branch_id = $2)
+	`, couponID, branchID, active)
+	if err != nil {
+		return fmt.Errorf("update coupon failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("coupon with id %d not found", couponID)
+	}
+	return nil
+}
+
+// SetBranchDiscountApproval sets the share of the gross above which discounts
+// given by hand need a manager; nil never asks for one.
+func (r *PromotionRepo) SetBranchDiscountApproval(ctx context.Context, branchID int64, percent *money.Amount) error {
+	if percent != nil && (*percent < 0 || *percent > money.FromInt(100)) {
+		return errors.New("approval percentage must be between 0 and 100")
+	}
+	tag, err := r.db.Exec(ctx, `UPDATE branches SET discount_approval_percent = $1 WHERE id = $2`, percent, branchID)
+	if err != nil {
+		return fmt.Errorf("update discount approval failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("branch %d not found", branchID)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package dbrepo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -9,7 +10,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
-	"github.com/projuktisheba/erp-mini-api/internal/utils"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
 )
 
 type PurchaseRepo struct {
@@ -35,14 +36,27 @@ func (r *PurchaseRepo) CreatePurchase(ctx context.Context, p *models.PurchaseDB)
 			_ = tx.Rollback(ctx)
 		}
 	}()
-	if p.MemoNo == "" {
-		p.MemoNo = utils.GenerateMemoNo()
+	if err := EnsurePeriodOpenTx(ctx, tx, p.BranchID, p.PurchaseDate); err != nil {
+		return err
+	}
+	// always the next memo number of the branch; one sent by the client is ignored
+	if p.MemoNo, err = NextMemoNoTx(ctx, tx, p.BranchID, models.MEMO_PURCHASE, p.PurchaseDate); err != nil {
+		return err
+	}
+	if strings.TrimSpace(p.Category) == "" {
+		p.Category = models.PURCHASE_CATEGORY_MATERIAL
+	}
+	if err := applyPurchaseTaxesTx(ctx, tx, p, nil); err != nil {
+		return err
+	}
+	if err := normalizePurchasePaidAmount(p); err != nil {
+		return err
 	}
 	// Insert purchase
 	query := `
 		INSERT INTO purchase 
-		(memo_no, purchase_date, supplier_id, branch_id, total_amount, notes, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		(memo_no, purchase_date, supplier_id, branch_id, total_amount, paid_amount, category, notes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 		RETURNING id, created_at, updated_at
 	`
 	err = tx.QueryRow(ctx, query,
@@ -51,11 +65,16 @@ func (r *PurchaseRepo) CreatePurchase(ctx context.Context, p *models.PurchaseDB)
 		p.SupplierID,
 		p.BranchID,
 		p.TotalAmount,
+		p.PaidAmount,
+		p.Category,
 		p.Notes,
 	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("insert purchase: %w", err)
 	}
+	if err := saveDocumentTaxesTx(ctx, tx, models.DOCUMENT_PURCHASE, p.ID, p.BranchID, p.PurchaseDate, &p.DocumentTax); err != nil {
+		return err
+	}
 
 	// --- Update TopSheet: increase expense ---
 	topSheet := &models.TopSheetDB{
@@ -71,41 +90,10 @@ func (r *PurchaseRepo) CreatePurchase(ctx context.Context, p *models.PurchaseDB)
 		notes += p.Notes
 	}
 
-	// get the branch accounts id
-	var fromAccountID int64
-	err = tx.QueryRow(ctx, `
-        SELECT id
-        FROM accounts
-		WHERE branch_id = $1 AND type = 'cash'
-		LIMIT 1
-    `, p.BranchID).Scan(&fromAccountID)
-	if err != nil {
+	// record the paid part as a payment to the supplier
+	if err := insertPurchasePaymentTx(ctx, tx, p, *p.PaidAmount); err != nil {
 		return err
 	}
-	//insert transaction
-	_, err = tx.Exec(ctx, `
-			INSERT INTO transactions(
-				transaction_date, memo_no, branch_id,
-				from_entity_id, from_entity_type,
-				to_entity_id, to_entity_type,
-				amount, transaction_type, notes
-			)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-		`,
-		p.PurchaseDate,
-		utils.GetPurchaseMemo(p.ID),
-		p.BranchID,
-		fromAccountID,
-		models.ENTITY_ACCOUNT,
-		p.SupplierID,
-		models.ENTITY_SUPPLIER,
-		p.TotalAmount,
-		models.PAYMENT,
-		"Payment for Material Purchase",
-	)
-	if err != nil {
-		return fmt.Errorf("insert transaction failed (4b): %w", err)
-	}
 
 	// Commit transaction
 	if err := tx.Commit(ctx); err != nil {
@@ -135,7 +123,7 @@ func (r *PurchaseRepo) UpdatePurchase(ctx context.Context, purchaseID int64, new
 	// old purchase info
 	var oldPurchase models.PurchaseDB
 	err = tx.QueryRow(ctx,
-		`SELECT id, memo_no, purchase_date, supplier_id, branch_id, total_amount, notes FROM purchase WHERE id=$1`,
+		`SELECT id, memo_no, purchase_date, supplier_id, branch_id, total_amount, paid_amount, notes FROM purchase WHERE id=$1 FOR UPDATE`,
 		purchaseID).Scan(
 		&oldPurchase.ID,
 		&oldPurchase.MemoNo,
@@ -143,30 +131,77 @@ func (r *PurchaseRepo) UpdatePurchase(ctx context.Context, purchaseID int64, new
 		&oldPurchase.SupplierID,
 		&oldPurchase.BranchID,
 		&oldPurchase.TotalAmount,
+		&oldPurchase.PaidAmount,
 		&oldPurchase.Notes,
 	)
-	// update purchase
+	if err != nil {
+		return fmt.Errorf("load purchase: %w", err)
+	}
+	// payments made to the supplier after the purchase was booked stay as they are
+	laterPaid, firstPaidOn, err := purchasePaymentsTx(ctx, tx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, oldPurchase.BranchID, oldPurchase.PurchaseDate, newPurchase.PurchaseDate); err != nil {
+		return err
+	}
+	if err := loadDocumentTaxes(ctx, tx, models.DOCUMENT_PURCHASE, purchaseID, &oldPurchase.DocumentTax); err != nil {
+		return err
+	}
+	// update purchase; the memo number stays
+	newPurchase.MemoNo = oldPurchase.MemoNo
+	if strings.TrimSpace(newPurchase.Category) == "" {
+		newPurchase.Category = models.PURCHASE_CATEGORY_MATERIAL
+	}
+	if err := applyPurchaseTaxesTx(ctx, tx, newPurchase, &oldPurchase.DocumentTax); err != nil {
+		return err
+	}
+	// a missing paid amount keeps what was paid so far
+	if newPurchase.PaidAmount == nil {
+		newPurchase.PaidAmount = oldPurchase.PaidAmount
+	}
+	if err := normalizePurchasePaidAmount(newPurchase); err != nil {
+		return err
+	}
+	if laterPaid > 0 {
+		if *newPurchase.PaidAmount < laterPaid {
+			return fmt.Errorf("paid amount cannot be less than the %s paid to the supplier after the purchase", laterPaid)
+		}
+		if newPurchase.SupplierID != oldPurchase.SupplierID {
+			return errors.New("the supplier of a purchase with supplier payments cannot be changed")
+		}
+		if newPurchase.PurchaseDate.After(*firstPaidOn) {
+			return fmt.Errorf("purchase date cannot be after its first supplier payment on %s", firstPaidOn.Format("2006-01-02"))
+		}
+	}
 	query := `
 		UPDATE purchase SET
 		memo_no=$1,
 		purchase_date=$2,
 		supplier_id=$3,
 		total_amount=$4,
-		notes=$5,
+		paid_amount=$5,
+		category=$6,
+		notes=$7,
 		updated_at=CURRENT_TIMESTAMP
-		WHERE id=$6
+		WHERE id=$8
 	`
 	_, err = tx.Exec(ctx, query,
 		newPurchase.MemoNo,
 		newPurchase.PurchaseDate,
 		newPurchase.SupplierID,
 		newPurchase.TotalAmount,
+		newPurchase.PaidAmount,
+		newPurchase.Category,
 		newPurchase.Notes,
 		purchaseID,
 	)
 	if err != nil {
 		return fmt.Errorf("insert purchase: %w", err)
 	}
+	if err := saveDocumentTaxesTx(ctx, tx, models.DOCUMENT_PURCHASE, purchaseID, oldPurchase.BranchID, newPurchase.PurchaseDate, &newPurchase.DocumentTax); err != nil {
+		return err
+	}
 
 	// -------------
 	// TopSheet
@@ -193,41 +228,16 @@ func (r *PurchaseRepo) UpdatePurchase(ctx context.Context, purchaseID int64, new
 	// ---------------------
 	// transactions
 	// ---------------------
-	// always paid from cash, not necessary to update the fromAccountId
-	// get the branch accounts id
-	// var fromAccountID int64
-	// err = tx.QueryRow(ctx, `
-    //     SELECT id
-    //     FROM accounts
-	// 	WHERE branch_id = $1 AND type = 'cash'
-	// 	LIMIT 1
-    // `, newPurchase.BranchID).Scan(&fromAccountID)
-	// if err != nil {
-	// 	return err
-	// }
-
-	//update transaction
-	_, err = tx.Exec(ctx, `
-			UPDATE transactions
-				transaction_date=$1,
-				memo_no=$2,
-				to_entity_id=$3,
-				to_entity_type=$4,
-				amount=$5,
-				transaction_type=$6,
-				notes=$7
-			WHERE branch_id=$8 AND memo_no=$9
-		`,
-		newPurchase.PurchaseDate,
-		newPurchase.MemoNo,
-		newPurchase.SupplierID,
-		models.ENTITY_SUPPLIER,
-		newPurchase.TotalAmount,
-		models.PAYMENT,
-		"Payment for Material Purchase",
+	// replace the supplier payment with the new paid amount
+	_, err = tx.Exec(ctx, `DELETE FROM transactions WHERE branch_id=$1 AND memo_no=$2 AND to_entity_type=$3`,
+		oldPurchase.BranchID, oldPurchase.MemoNo, models.ENTITY_SUPPLIER,
 	)
 	if err != nil {
-		return fmt.Errorf("insert transaction failed (4b): %w", err)
+		return fmt.Errorf("delete transaction failed (4b): %w", err)
+	}
+	newPurchase.ID = purchaseID
+	if err := insertPurchasePaymentTx(ctx, tx, newPurchase, *newPurchase.PaidAmount-laterPaid); err != nil {
+		return err
 	}
 
 	// Commit transaction
@@ -239,6 +249,75 @@ func (r *PurchaseRepo) UpdatePurchase(ctx context.Context, purchaseID int64, new
 	return nil
 }
 
+// normalizePurchasePaidAmount treats a missing paid amount as paid in full
+func normalizePurchasePaidAmount(p *models.PurchaseDB) error {
+	if p.PaidAmount == nil {
+		paid := p.TotalAmount
+		p.PaidAmount = &paid
+	}
+	if *p.PaidAmount < 0 || *p.PaidAmount > p.TotalAmount {
+		return errors.New("paid amount must be between 0 and the total amount")
+	}
+	return nil
+}
+
+// purchasePaymentsTx returns how much was paid on a purchase by supplier payments
+// after it was booked, and the date of the first of them
+func purchasePaymentsTx(ctx context.Context, tx pgx.Tx, purchaseID int64) (money.Amount, *time.Time, error) {
+	var paid money.Amount
+	var firstPaidOn *time.Time
+	err := tx.QueryRow(ctx,
+		`SELECT COALESCE(SUM(amount), 0), MIN(payment_date) FROM purchase_payments WHERE purchase_id=$1`,
+		purchaseID).Scan(&paid, &firstPaidOn)
+	if err != nil {
+		return 0, nil, fmt.Errorf("load supplier payments: %w", err)
+	}
+	return paid, firstPaidOn, nil
+}
+
+// insertPurchasePaymentTx records the amount paid when the purchase was booked, under its
+// memo number, as a payment from the branch cash account to the supplier
+func insertPurchasePaymentTx(ctx context.Context, tx pgx.Tx, p *models.PurchaseDB, amount money.Amount) error {
+	if amount == 0 {
+		return nil
+	}
+	// always paid from cash
+	var fromAccountID int64
+	err := tx.QueryRow(ctx, `
+        SELECT id
+        FROM accounts
+		WHERE branch_id = $1 AND type = 'cash'
+		LIMIT 1
+    `, p.BranchID).Scan(&fromAccountID)
+	if err != nil {
+		return fmt.Errorf("load cash account: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+			INSERT INTO transactions(
+				transaction_date, memo_no, branch_id,
+				from_entity_id, from_entity_type,
+				to_entity_id, to_entity_type,
+				amount, transaction_type, notes
+			)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		`,
+		p.PurchaseDate,
+		p.MemoNo,
+		p.BranchID,
+		fromAccountID,
+		models.ENTITY_ACCOUNT,
+		p.SupplierID,
+		models.ENTITY_SUPPLIER,
+		amount,
+		models.PAYMENT,
+		"Payment for Material Purchase",
+	)
+	if err != nil {
+		return fmt.Errorf("insert transaction failed (4b): %w", err)
+	}
+	return nil
+}
+
 // DeletePurchase purchase record, decrement top sheet(expense), delete transactions
 func (r *PurchaseRepo) DeletePurchase(ctx context.Context, purchaseID int64) error {
 	// Begin transaction
@@ -268,12 +347,28 @@ func (r *PurchaseRepo) DeletePurchase(ctx context.Context, purchaseID int64) err
 		&purchase.TotalAmount,
 		&purchase.Notes,
 	)
+	if err != nil {
+		return fmt.Errorf("load purchase: %w", err)
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, purchase.BranchID, purchase.PurchaseDate); err != nil {
+		return err
+	}
+	laterPaid, _, err := purchasePaymentsTx(ctx, tx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if laterPaid > 0 {
+		return fmt.Errorf("the purchase has %s of supplier payments and cannot be deleted", laterPaid)
+	}
 
 	// delete purchase record by id
 	_, err = tx.Exec(ctx, `DELETE FROM purchase WHERE id=$1`, purchaseID)
 	if err != nil {
 		return fmt.Errorf("delete purchase: %w", err)
 	}
+	if err := deleteDocumentTaxesTx(ctx, tx, models.DOCUMENT_PURCHASE, purchaseID); err != nil {
+		return err
+	}
 
 	// revert top sheet data
 	oldTopSheet := &models.TopSheetDB{
@@ -334,12 +429,14 @@ func (r *PurchaseRepo) GetPurchaseReport(ctx context.Context, branchID int64, st
 	totalsQuery := `
         SELECT 
             COUNT(*),
-            COALESCE(SUM(p.total_amount), 0)
+            COALESCE(SUM(p.total_amount), 0),
+            COALESCE(SUM(p.tax_amount), 0)
     ` + baseQuery
 
 	err := r.db.QueryRow(ctx, totalsQuery, args...).Scan(
 		&totalCount,
 		&totals.TotalAmount,
+		&totals.TaxAmount,
 	)
 	if err != nil {
 		return nil, 0, nil, err
@@ -358,7 +455,11 @@ func (r *PurchaseRepo) GetPurchaseReport(ctx context.Context, branchID int64, st
             s.mobile,
             p.branch_id,
             p.total_amount,
-            p.notes
+            p.paid_amount,
+            p.category,
+            p.notes,
+            p.net_amount,
+            p.tax_amount
     ` + baseQuery + fmt.Sprintf(" ORDER BY p.purchase_date DESC, p.id DESC LIMIT $%d OFFSET $%d", argCounter, argCounter+1)
 
 	// Add limit and offset to args
@@ -382,7 +483,11 @@ func (r *PurchaseRepo) GetPurchaseReport(ctx context.Context, branchID int64, st
 			&p.SupplierMobile,
 			&p.BranchID,
 			&p.TotalAmount,
+			&p.PaidAmount,
+			&p.Category,
 			&p.Notes,
+			&p.NetAmount,
+			&p.TaxAmount,
 		)
 		if err != nil {
 			return nil, 0, nil, err
@@ -0,0 +1,820 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/bankstatement"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// matchWindowDays is how far a bank posting date may drift from the book date
+// and still be auto-matched (weekends, cheque clearing).
+const matchWindowDays = 3
+
+type ReconciliationRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewReconciliationRepo(db *pgxpool.Pool) *ReconciliationRepo {
+	return &ReconciliationRepo{db: db}
+}
+
+// accountSideSQL limits transactions to the ones touching account $1
+const accountSideSQL = `((t.to_entity_type = 'accounts' AND t.to_entity_id = $1) OR (t.from_entity_type = 'accounts' AND t.from_entity_id = $1))`
+
+// signedAmountSQL is the transaction amount as seen from account $1 (+ in, - out)
+const signedAmountSQL = `CASE WHEN t.to_entity_type = 'accounts' AND t.to_entity_id = $1 THEN t.amount ELSE -t.amount END`
+
+// ============================== CSV Mappings ==============================
+
+// CreateCSVMapping stores a CSV column mapping for a branch
+func (r *ReconciliationRepo) CreateCSVMapping(ctx context.Context, m *models.BankCSVMapping) error {
+	if m.DateFormat == "" {
+		m.DateFormat = "2006-01-02"
+	}
+	if m.Delimiter == "" {
+		m.Delimiter = ","
+	}
+	if m.DecimalSeparator == "" {
+		m.DecimalSeparator = "."
+	}
+	query := `
+		INSERT INTO bank_csv_mappings
+			(branch_id, account_id, name, date_column, amount_column, debit_column, credit_column,
+			 memo_column, reference_column, date_format, delimiter, decimal_separator, has_header, skip_rows)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
+		RETURNING id, created_at, updated_at
+	`
+	err := r.db.QueryRow(ctx, query,
+		m.BranchID, m.AccountID, m.Name, m.DateColumn, m.AmountColumn, m.DebitColumn, m.CreditColumn,
+		m.MemoColumn, m.ReferenceColumn, m.DateFormat, m.Delimiter, m.DecimalSeparator, m.HasHeader, m.SkipRows,
+	).Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert csv mapping failed: %w", err)
+	}
+	return nil
+}
+
+// GetCSVMappings lists the CSV mappings of a branch
+func (r *ReconciliationRepo) GetCSVMappings(ctx context.Context, branchID int64) ([]*models.BankCSVMapping, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, branch_id, account_id, name, date_column, amount_column, debit_column, credit_column,
+		       memo_column, reference_column, date_format, delimiter, decimal_separator, has_header, skip_rows, created_at, updated_at
+		FROM bank_csv_mappings
+		WHERE branch_id = $1
+		ORDER BY name
+	`, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("query csv mappings failed: %w", err)
+	}
+	defer rows.Close()
+
+	mappings := []*models.BankCSVMapping{}
+	for rows.Next() {
+		var m models.BankCSVMapping
+		if err := rows.Scan(&m.ID, &m.BranchID, &m.AccountID, &m.Name, &m.DateColumn, &m.AmountColumn,
+			&m.DebitColumn, &m.CreditColumn, &m.MemoColumn, &m.ReferenceColumn, &m.DateFormat,
+			&m.Delimiter, &m.DecimalSeparator, &m.HasHeader, &m.SkipRows, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan csv mapping failed: %w", err)
+		}
+		mappings = append(mappings, &m)
+	}
+	return mappings, nil
+}
+
+// GetCSVMappingByID returns a single mapping of the branch
+func (r *ReconciliationRepo) GetCSVMappingByID(ctx context.Context, branchID, id int64) (*models.BankCSVMapping, error) {
+	var m models.BankCSVMapping
+	err := r.db.QueryRow(ctx, `
+		SELECT id, branch_id, account_id, name, date_column, amount_column, debit_column, credit_column,
+		       memo_column, reference_column, date_format, delimiter, decimal_separator, has_header, skip_rows, created_at, updated_at
+		FROM bank_csv_mappings
+		WHERE id = $1 AND branch_id = $2
+	`, id, branchID).Scan(&m.ID, &m.BranchID, &m.AccountID, &m.Name, &m.DateColumn, &m.AmountColumn,
+		&m.DebitColumn, &m.CreditColumn, &m.MemoColumn, &m.ReferenceColumn, &m.DateFormat,
+		&m.Delimiter, &m.DecimalSeparator, &m.HasHeader, &m.SkipRows, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("csv mapping not found")
+		}
+		return nil, fmt.Errorf("query csv mapping failed: %w", err)
+	}
+	return &m, nil
+}
+
+// ============================== Import ==============================
+
+// ImportStatement stores a parsed statement for a branch account and auto-matches its lines.
+// fileHash is the hex sha256 of the uploaded file; a file, or a statement with the same
+// period and closing balance, already imported for the account is rejected.
+func (r *ReconciliationRepo) ImportStatement(ctx context.Context, branchID, accountID int64, format, fileName, fileHash string, st *bankstatement.Statement) (*models.BankStatement, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// --------------------
+	// 1. Validate account
+	// --------------------
+	var accountName string
+	err = tx.QueryRow(ctx, `SELECT name FROM accounts WHERE id = $1 AND branch_id = $2`, accountID, branchID).Scan(&accountName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("account not found for this branch")
+		}
+		return nil, fmt.Errorf("query account failed: %w", err)
+	}
+
+	// --------------------
+	// 2. Reject duplicate imports
+	// --------------------
+	// lock the account so two uploads of the same file cannot both pass the check
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM accounts WHERE id = $1 FOR UPDATE`, accountID); err != nil {
+		return nil, fmt.Errorf("lock account failed: %w", err)
+	}
+	var duplicateID int64
+	err = tx.QueryRow(ctx, `
+		SELECT id FROM bank_statements
+		WHERE account_id = $1
+		  AND ((file_hash <> '' AND file_hash = $2)
+		    OR (closing_balance IS NOT NULL AND closing_balance = $5
+		        AND period_start = $3 AND period_end = $4))
+		ORDER BY id
+		LIMIT 1
+	`, accountID, fileHash, st.PeriodStart, st.PeriodEnd, st.ClosingBalance).Scan(&duplicateID)
+	if err == nil {
+		return nil, fmt.Errorf("this statement was already imported as statement #%d", duplicateID)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("query bank statements failed: %w", err)
+	}
+
+	// --------------------
+	// 3. Insert statement header
+	// --------------------
+	stmt := &models.BankStatement{
+		BranchID:       branchID,
+		AccountID:      accountID,
+		AccountName:    accountName,
+		Format:         format,
+		FileName:       fileName,
+		PeriodStart:    st.PeriodStart,
+		PeriodEnd:      st.PeriodEnd,
+		OpeningBalance: st.OpeningBalance,
+		ClosingBalance: st.ClosingBalance,
+		LineCount:      int64(len(st.Lines)),
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO bank_statements
+			(branch_id, account_id, format, file_name, file_hash, period_start, period_end, opening_balance, closing_balance)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		RETURNING id, created_at
+	`, branchID, accountID, format, fileName, fileHash, st.PeriodStart, st.PeriodEnd, st.OpeningBalance, st.ClosingBalance,
+	).Scan(&stmt.ID, &stmt.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert bank statement failed: %w", err)
+	}
+
+	// --------------------
+	// 4. Insert lines
+	// --------------------
+	batch := &pgx.Batch{}
+	for i, l := range st.Lines {
+		batch.Queue(`
+			INSERT INTO bank_statement_lines (statement_id, account_id, line_no, txn_date, amount, memo, reference)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)
+		`, stmt.ID, accountID, i+1, l.Date, l.Amount, l.Memo, l.Reference)
+	}
+	br := tx.SendBatch(ctx, batch)
+	for range st.Lines {
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return nil, fmt.Errorf("insert bank statement line failed: %w", err)
+		}
+	}
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("insert bank statement lines failed: %w", err)
+	}
+
+	// --------------------
+	// 5. Auto-match
+	// --------------------
+	matched, err := autoMatchTx(ctx, tx, stmt.ID)
+	if err != nil {
+		return nil, err
+	}
+	stmt.MatchedCount = matched
+	stmt.UnmatchedCount = stmt.LineCount - matched
+
+	return stmt, tx.Commit(ctx)
+}
+
+// AutoMatchStatement re-runs auto-matching for the unmatched lines of a statement
+func (r *ReconciliationRepo) AutoMatchStatement(ctx context.Context, branchID, statementID int64) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM bank_statements WHERE id = $1 AND branch_id = $2)`, statementID, branchID).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("query bank statement failed: %w", err)
+	}
+	if !exists {
+		return 0, errors.New("bank statement not found")
+	}
+
+	matched, err := autoMatchTx(ctx, tx, statementID)
+	if err != nil {
+		return 0, err
+	}
+	return matched, tx.Commit(ctx)
+}
+
+// autoMatchTx pairs each unmatched line with a book transaction on the same account,
+// same amount and direction, dated within matchWindowDays. Candidates whose memo number
+// appears in the bank memo or reference win; ties go to the closest date.
+func autoMatchTx(ctx context.Context, tx pgx.Tx, statementID int64) (int64, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id, account_id, txn_date, amount, memo, reference
+		FROM bank_statement_lines
+		WHERE statement_id = $1 AND status = 'unmatched'
+		ORDER BY line_no
+	`, statementID)
+	if err != nil {
+		return 0, fmt.Errorf("query unmatched lines failed: %w", err)
+	}
+	var lines []models.BankStatementLine
+	for rows.Next() {
+		var l models.BankStatementLine
+		if err := rows.Scan(&l.ID, &l.AccountID, &l.TxnDate, &l.Amount, &l.Memo, &l.Reference); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan line failed: %w", err)
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("read lines failed: %w", err)
+	}
+
+	candidateQuery := fmt.Sprintf(`
+		SELECT t.transaction_id
+		FROM transactions t
+		WHERE ((t.to_entity_type = 'accounts' AND t.to_entity_id = $1 AND $2)
+		    OR (t.from_entity_type = 'accounts' AND t.from_entity_id = $1 AND NOT $2))
+		  AND t.amount = $3
+		  AND t.transaction_date BETWEEN $4::date - %[1]d AND $4::date + %[1]d
+		  AND NOT EXISTS (SELECT 1 FROM bank_statement_lines l WHERE l.transaction_id = t.transaction_id)
+		ORDER BY
+		  CASE WHEN t.memo_no <> '' AND ($5 ILIKE '%%' || t.memo_no || '%%' OR $6 ILIKE '%%' || t.memo_no || '%%') THEN 0 ELSE 1 END,
+		  ABS(t.transaction_date - $4::date),
+		  t.transaction_id
+		LIMIT 1
+	`, matchWindowDays)
+
+	var matched int64
+	for _, l := range lines {
+		inflow := l.Amount > 0
+		amount := l.Amount
+		if !inflow {
+			amount = -amount
+		}
+		var transactionID int64
+		err := tx.QueryRow(ctx, candidateQuery, l.AccountID, inflow, amount, l.TxnDate, l.Memo, l.Reference).Scan(&transactionID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("match candidate query failed: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE bank_statement_lines
+			SET status = 'matched', transaction_id = $1, match_method = 'auto', updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, transactionID, l.ID)
+		if err != nil {
+			return 0, fmt.Errorf("update matched line failed: %w", err)
+		}
+		matched++
+	}
+	return matched, nil
+}
+
+// ============================== Statements & Lines ==============================
+
+// ListStatements returns the imported statements of a branch, optionally for one account
+func (r *ReconciliationRepo) ListStatements(ctx context.Context, branchID, accountID int64) ([]*models.BankStatement, error) {
+	query := `
+		SELECT s.id, s.branch_id, s.account_id, a.name, s.format, s.file_name, s.period_start, s.period_end,
+		       s.opening_balance, s.closing_balance,
+		       COUNT(l.id),
+		       COUNT(l.id) FILTER (WHERE l.status IN ('matched', 'created')),
+		       COUNT(l.id) FILTER (WHERE l.status = 'unmatched'),
+		       s.created_at
+		FROM bank_statements s
+		JOIN accounts a ON a.id = s.account_id
+		LEFT JOIN bank_statement_lines l ON l.statement_id = s.id
+		WHERE s.branch_id = $1
+	`
+	args := []any{branchID}
+	if accountID > 0 {
+		query += " AND s.account_id = $2"
+		args = append(args, accountID)
+	}
+	query += " GROUP BY s.id, a.name ORDER BY s.period_end DESC, s.id DESC"
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query bank statements failed: %w", err)
+	}
+	defer rows.Close()
+
+	statements := []*models.BankStatement{}
+	for rows.Next() {
+		var s models.BankStatement
+		if err := rows.Scan(&s.ID, &s.BranchID, &s.AccountID, &s.AccountName, &s.Format, &s.FileName,
+			&s.PeriodStart, &s.PeriodEnd, &s.OpeningBalance, &s.ClosingBalance,
+			&s.LineCount, &s.MatchedCount, &s.UnmatchedCount, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan bank statement failed: %w", err)
+		}
+		statements = append(statements, &s)
+	}
+	return statements, nil
+}
+
+// GetStatementLines returns the lines of a statement, optionally filtered by status
+func (r *ReconciliationRepo) GetStatementLines(ctx context.Context, branchID, statementID int64, status string) ([]*models.BankStatementLine, error) {
+	query := `
+		SELECT l.id, l.statement_id, l.account_id, l.line_no, l.txn_date, l.amount, l.memo, l.reference,
+		       l.status, l.transaction_id, l.match_method
+		FROM bank_statement_lines l
+		JOIN bank_statements s ON s.id = l.statement_id
+		WHERE l.statement_id = $1 AND s.branch_id = $2
+	`
+	args := []any{statementID, branchID}
+	if status != "" {
+		query += " AND l.status = $3"
+		args = append(args, status)
+	}
+	query += " ORDER BY l.line_no"
+
+	return r.queryLines(ctx, query, args...)
+}
+
+func (r *ReconciliationRepo) queryLines(ctx context.Context, query string, args ...any) ([]*models.BankStatementLine, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query statement lines failed: %w", err)
+	}
+	defer rows.Close()
+
+	lines := []*models.BankStatementLine{}
+	for rows.Next() {
+		var l models.BankStatementLine
+		if err := rows.Scan(&l.ID, &l.StatementID, &l.AccountID, &l.LineNo, &l.TxnDate, &l.Amount,
+			&l.Memo, &l.Reference, &l.Status, &l.TransactionID, &l.MatchMethod); err != nil {
+			return nil, fmt.Errorf("scan statement line failed: %w", err)
+		}
+		lines = append(lines, &l)
+	}
+	return lines, nil
+}
+
+// getLineForUpdateTx locks a statement line that belongs to the branch
+func getLineForUpdateTx(ctx context.Context, tx pgx.Tx, branchID, lineID int64) (*models.BankStatementLine, error) {
+	var l models.BankStatementLine
+	err := tx.QueryRow(ctx, `
+		SELECT l.id, l.statement_id, l.account_id, l.line_no, l.txn_date, l.amount, l.memo, l.reference,
+		       l.status, l.transaction_id, l.match_method
+		FROM bank_statement_lines l
+		JOIN bank_statements s ON s.id = l.statement_id
+		WHERE l.id = $1 AND s.branch_id = $2
+		FOR UPDATE OF l
+	`, lineID, branchID).Scan(&l.ID, &l.StatementID, &l.AccountID, &l.LineNo, &l.TxnDate, &l.Amount,
+		&l.Memo, &l.Reference, &l.Status, &l.TransactionID, &l.MatchMethod)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("statement line not found")
+		}
+		return nil, fmt.Errorf("query statement line failed: %w", err)
+	}
+	return &l, nil
+}
+
+// GetMatchCandidates lists unreconciled book transactions with the line's account, direction and
+// amount, within two weeks of the bank date, for manual matching
+func (r *ReconciliationRepo) GetMatchCandidates(ctx context.Context, branchID, lineID int64) ([]*models.Transaction, error) {
+	var (
+		accountID int64
+		txnDate   time.Time
+		amount    money.Amount
+	)
+	err := r.db.QueryRow(ctx, `
+		SELECT l.account_id, l.txn_date, l.amount
+		FROM bank_statement_lines l
+		JOIN bank_statements s ON s.id = l.statement_id
+		WHERE l.id = $1 AND s.branch_id = $2
+	`, lineID, branchID).Scan(&accountID, &txnDate, &amount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("statement line not found")
+		}
+		return nil, fmt.Errorf("query statement line failed: %w", err)
+	}
+
+	inflow := amount > 0
+	if !inflow {
+		amount = -amount
+	}
+	rows, err := r.db.Query(ctx, `
+		SELECT t.transaction_id, t.transaction_date, t.memo_no, t.branch_id,
+		       t.from_entity_id, t.from_entity_type, t.to_entity_id, t.to_entity_type,
+		       t.amount, t.transaction_type, COALESCE(t.notes, ''), t.created_at
+		FROM transactions t
+		WHERE ((t.to_entity_type = 'accounts' AND t.to_entity_id = $1 AND $2)
+		    OR (t.from_entity_type = 'accounts' AND t.from_entity_id = $1 AND NOT $2))
+		  AND t.amount = $3
+		  AND t.transaction_date BETWEEN $4::date - 14 AND $4::date + 14
+		  AND NOT EXISTS (SELECT 1 FROM bank_statement_lines l WHERE l.transaction_id = t.transaction_id)
+		ORDER BY ABS(t.transaction_date - $4::date), t.transaction_id
+	`, accountID, inflow, amount, txnDate)
+	if err != nil {
+		return nil, fmt.Errorf("query match candidates failed: %w", err)
+	}
+	defer rows.Close()
+
+	return scanBookTransactions(rows)
+}
+
+func scanBookTransactions(rows pgx.Rows) ([]*models.Transaction, error) {
+	list := []*models.Transaction{}
+	for rows.Next() {
+		var t models.Transaction
+		if err := rows.Scan(&t.TransactionID, &t.TransactionDate, &t.MemoNo, &t.BranchID,
+			&t.FromID, &t.FromType, &t.ToID, &t.ToType,
+			&t.Amount, &t.TransactionType, &t.Notes, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan transaction failed: %w", err)
+		}
+		list = append(list, &t)
+	}
+	return list, nil
+}
+
+// MatchLine manually reconciles a statement line with a book transaction
+func (r *ReconciliationRepo) MatchLine(ctx context.Context, branchID, lineID, transactionID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	line, err := getLineForUpdateTx(ctx, tx, branchID, lineID)
+	if err != nil {
+		return err
+	}
+	if line.Status != models.BANK_LINE_UNMATCHED {
+		return fmt.Errorf("statement line is already %s", line.Status)
+	}
+
+	// --------------------
+	// Validate transaction: same account, direction and amount
+	// --------------------
+	var signed money.Amount
+	err = tx.QueryRow(ctx, `
+		SELECT `+signedAmountSQL+`
+		FROM transactions t
+		WHERE t.transaction_id = $2 AND `+accountSideSQL,
+		line.AccountID, transactionID).Scan(&signed)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("transaction not found on this bank account")
+		}
+		return fmt.Errorf("query transaction failed: %w", err)
+	}
+	if signed != line.Amount {
+		return fmt.Errorf("amount mismatch: statement line %s, transaction %s", line.Amount, signed)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE bank_statement_lines
+		SET status = 'matched', transaction_id = $1, match_method = 'manual', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, transactionID, lineID)
+	if err != nil {
+		if strings.Contains(err.Error(), "idx_bank_statement_lines_transaction") {
+			return errors.New("transaction is already matched to another statement line")
+		}
+		return fmt.Errorf("update statement line failed: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// UnmatchLine reverts a matched or ignored line to unmatched. Lines whose entry was
+// created from the statement keep their transaction; delete it with an adjustment instead.
+func (r *ReconciliationRepo) UnmatchLine(ctx context.Context, branchID, lineID int64) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE bank_statement_lines l
+		SET status = 'unmatched', transaction_id = NULL, match_method = '', updated_at = CURRENT_TIMESTAMP
+		FROM bank_statements s
+		WHERE s.id = l.statement_id AND l.id = $1 AND s.branch_id = $2 AND l.status IN ('matched', 'ignored')
+	`, lineID, branchID)
+	if err != nil {
+		return fmt.Errorf("unmatch statement line failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("statement line not found or not matched")
+	}
+	return nil
+}
+
+// IgnoreLine marks a line as not needing a book entry (e.g. already booked in another period)
+func (r *ReconciliationRepo) IgnoreLine(ctx context.Context, branchID, lineID int64) error {
+	tag, err := r.db.Exec(ctx, `
+		UPDATE bank_statement_lines l
+		SET status = 'ignored', updated_at = CURRENT_TIMESTAMP
+		FROM bank_statements s
+		WHERE s.id = l.statement_id AND l.id = $1 AND s.branch_id = $2 AND l.status = 'unmatched'
+	`, lineID, branchID)
+	if err != nil {
+		return fmt.Errorf("ignore statement line failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("statement line not found or not unmatched")
+	}
+	return nil
+}
+
+// CreateEntryFromLine books an unmatched statement line (bank charges, interest, transfers, direct
+// customer deposits) as a new transaction against the given counterparty and reconciles the line with it.
+// A customer deposit is received like a payment at the counter: it settles the customer's open orders
+// and sales, oldest first, and the rest becomes store credit.
+func (r *ReconciliationRepo) CreateEntryFromLine(ctx context.Context, branchID, lineID int64, entityType string, entityID int64, transactionType, notes string) (int64, error) {
+	switch entityType {
+	case models.ENTITY_ACCOUNT, models.ENTITY_CUSTOMER, models.ENTITY_SUPPLIER, models.ENTITY_EMPLOYEE:
+	default:
+		return 0, fmt.Errorf("invalid entity type %q", entityType)
+	}
+	if transactionType == "" {
+		transactionType = models.ADJUSTMENT
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	line, err := getLineForUpdateTx(ctx, tx, branchID, lineID)
+	if err != nil {
+		return 0, err
+	}
+	if line.Status != models.BANK_LINE_UNMATCHED {
+		return 0, fmt.Errorf("statement line is already %s", line.Status)
+	}
+	if err := EnsurePeriodOpenTx(ctx, tx, branchID, line.TxnDate); err != nil {
+		return 0, err
+	}
+	if entityType == models.ENTITY_ACCOUNT && entityID == line.AccountID {
+		return 0, errors.New("counter account must differ from the bank account")
+	}
+	if err := ensureEntityInBranchTx(ctx, tx, branchID, entityType, entityID); err != nil {
+		return 0, err
+	}
+
+	if strings.TrimSpace(notes) == "" {
+		notes = "Bank statement: " + line.Memo
+	}
+
+	if entityType == models.ENTITY_CUSTOMER {
+		if line.Amount < 0 {
+			return 0, errors.New("money paid out to a customer must be booked as a refund or store credit withdrawal and matched to the line")
+		}
+		result, err := receivePaymentTx(ctx, tx, &models.CustomerPayment{
+			BranchID:    branchID,
+			CustomerID:  entityID,
+			AccountID:   line.AccountID,
+			PaymentDate: line.TxnDate,
+			Amount:      line.Amount,
+			Notes:       notes,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if err := reconcileCreatedLineTx(ctx, tx, lineID, result.TransactionID); err != nil {
+			return 0, err
+		}
+		return result.TransactionID, tx.Commit(ctx)
+	}
+
+	// --------------------
+	// 1. Insert transaction in the direction of the bank movement
+	// --------------------
+	t := &models.Transaction{
+		TransactionDate: line.TxnDate,
+		BranchID:        branchID,
+		TransactionType: transactionType,
+		Notes:           notes,
+	}
+	amount := line.Amount
+	if amount > 0 {
+		t.FromID, t.FromType = entityID, entityType
+		t.ToID, t.ToType = line.AccountID, models.ENTITY_ACCOUNT
+	} else {
+		amount = -amount
+		t.FromID, t.FromType = line.AccountID, models.ENTITY_ACCOUNT
+		t.ToID, t.ToType = entityID, entityType
+	}
+	t.Amount = amount
+
+	transactionID, err := CreateTransactionTx(ctx, tx, t)
+	if err != nil {
+		return 0, err
+	}
+
+	// --------------------
+	// 2. Update balances
+	// --------------------
+	if _, err := tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance + $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		line.Amount, line.AccountID); err != nil {
+		return 0, fmt.Errorf("update bank account balance failed: %w", err)
+	}
+	if entityType == models.ENTITY_ACCOUNT {
+		tag, err := tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance - $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND branch_id = $3`,
+			line.Amount, entityID, branchID)
+		if err != nil {
+			return 0, fmt.Errorf("update counter account balance failed: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return 0, errors.New("counter account not found for this branch")
+		}
+	}
+
+	// --------------------
+	// 3. Reconcile the line
+	// --------------------
+	if err := reconcileCreatedLineTx(ctx, tx, lineID, transactionID); err != nil {
+		return 0, err
+	}
+
+	return transactionID, tx.Commit(ctx)
+}
+
+// reconcileCreatedLineTx marks a statement line as reconciled with the transaction booked from it
+func reconcileCreatedLineTx(ctx context.Context, tx pgx.Tx, lineID, transactionID int64) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE bank_statement_lines
+		SET status = 'created', transaction_id = $1, match_method = 'manual', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, transactionID, lineID)
+	if err != nil {
+		return fmt.Errorf("update statement line failed: %w", err)
+	}
+	return nil
+}
+
+// ensureEntityInBranchTx checks that the customer, supplier or employee a statement line is
+// booked against belongs to the branch. Counter accounts are checked when their balance is updated.
+func ensureEntityInBranchTx(ctx context.Context, tx pgx.Tx, branchID int64, entityType string, entityID int64) error {
+	switch entityType {
+	case models.ENTITY_CUSTOMER, models.ENTITY_SUPPLIER, models.ENTITY_EMPLOYEE:
+	default:
+		return nil
+	}
+	// the entity type is the name of its table
+	var found bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM `+entityType+` WHERE id = $1 AND branch_id = $2)`,
+		entityID, branchID).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("look up %s failed: %w", entityType, err)
+	}
+	if !found {
+		return fmt.Errorf("%s with id %d not found in this branch", strings.TrimSuffix(entityType, "s"), entityID)
+	}
+	return nil
+}
+
+// ============================== Report ==============================
+
+// GetReconciliationReport compares the book movements of a bank account with the imported
+// statement lines for a period, and lists what is still unreconciled on either side.
+// Book balances are summed from the account's transactions, as not every payment out of an account
+// updates accounts.current_balance.
+func (r *ReconciliationRepo) GetReconciliationReport(ctx context.Context, branchID, accountID int64, startDate, endDate time.Time) (*models.BankReconciliationReport, error) {
+	report := &models.BankReconciliationReport{
+		AccountID: accountID,
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	// --------------------
+	// 1. Book side
+	// --------------------
+	err := r.db.QueryRow(ctx, `SELECT name FROM accounts WHERE id = $1 AND branch_id = $2`,
+		accountID, branchID).Scan(&report.AccountName)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("account not found for this branch")
+		}
+		return nil, fmt.Errorf("query account failed: %w", err)
+	}
+
+	err = r.db.QueryRow(ctx, `
+		SELECT
+			COALESCE(SUM(`+signedAmountSQL+`) FILTER (WHERE t.transaction_date <= $3), 0),
+			COALESCE(SUM(t.amount) FILTER (WHERE t.transaction_date BETWEEN $2 AND $3 AND t.to_entity_type = 'accounts' AND t.to_entity_id = $1), 0),
+			COALESCE(SUM(t.amount) FILTER (WHERE t.transaction_date BETWEEN $2 AND $3 AND t.from_entity_type = 'accounts' AND t.from_entity_id = $1), 0)
+		FROM transactions t
+		WHERE `+accountSideSQL,
+		accountID, startDate, endDate).Scan(&report.BookClosingBalance, &report.BookInflow, &report.BookOutflow)
+	if err != nil {
+		return nil, fmt.Errorf("query book movements failed: %w", err)
+	}
+	report.BookOpeningBalance = report.BookClosingBalance - report.BookInflow + report.BookOutflow
+
+	// --------------------
+	// 2. Statement side
+	// --------------------
+	err = r.db.QueryRow(ctx, `
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE amount > 0), 0),
+			COALESCE(-SUM(amount) FILTER (WHERE amount < 0), 0),
+			COUNT(*) FILTER (WHERE status IN ('matched', 'created')),
+			COALESCE(SUM(ABS(amount)) FILTER (WHERE status IN ('matched', 'created')), 0),
+			COALESCE(SUM(amount) FILTER (WHERE status = 'unmatched'), 0)
+		FROM bank_statement_lines
+		WHERE account_id = $1 AND txn_date BETWEEN $2 AND $3
+	`, accountID, startDate, endDate).Scan(&report.StatementInflow, &report.StatementOutflow,
+		&report.MatchedCount, &report.MatchedAmount, &report.UnmatchedLineSum)
+	if err != nil {
+		return nil, fmt.Errorf("query statement movements failed: %w", err)
+	}
+
+	// closing balance of the latest statement ending inside the period
+	err = r.db.QueryRow(ctx, `
+		SELECT closing_balance
+		FROM bank_statements
+		WHERE account_id = $1 AND period_end BETWEEN $2 AND $3 AND closing_balance IS NOT NULL
+		ORDER BY period_end DESC, id DESC
+		LIMIT 1
+	`, accountID, startDate, endDate).Scan(&report.StatementClosingBalance)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("query statement closing balance failed: %w", err)
+	}
+	if report.StatementClosingBalance != nil {
+		diff := *report.StatementClosingBalance - report.BookClosingBalance
+		report.Difference = &diff
+	}
+
+	// --------------------
+	// 3. Unreconciled items
+	// --------------------
+	report.UnmatchedLines, err = r.queryLines(ctx, `
+		SELECT l.id, l.statement_id, l.account_id, l.line_no, l.txn_date, l.amount, l.memo, l.reference,
+		       l.status, l.transaction_id, l.match_method
+		FROM bank_statement_lines l
+		WHERE l.account_id = $1 AND l.txn_date BETWEEN $2 AND $3 AND l.status = 'unmatched'
+		ORDER BY l.txn_date, l.id
+	`, accountID, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT t.transaction_id, t.transaction_date, t.memo_no, t.branch_id,
+		       t.from_entity_id, t.from_entity_type, t.to_entity_id, t.to_entity_type,
+		       t.amount, t.transaction_type, COALESCE(t.notes, ''), t.created_at
+		FROM transactions t
+		WHERE `+accountSideSQL+`
+		  AND t.transaction_date BETWEEN $2 AND $3
+		  AND NOT EXISTS (SELECT 1 FROM bank_statement_lines l WHERE l.transaction_id = t.transaction_id)
+		ORDER BY t.transaction_date, t.transaction_id
+	`, accountID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("query unmatched transactions failed: %w", err)
+	}
+	defer rows.Close()
+	report.UnmatchedTransactions, err = scanBookTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range report.UnmatchedTransactions {
+		if t.ToType == models.ENTITY_ACCOUNT && t.ToID == accountID {
+			report.UnmatchedBookSum += t.Amount
+		} else {
+			report.UnmatchedBookSum -= t.Amount
+		}
+	}
+
+	return report, nil
+}
@@ -6,28 +6,52 @@ import (
 
 // DBRepository contains all individual repositories
 type DBRepository struct {
-	EmployeeRepo    *EmployeeRepo
-	CustomerRepo    *CustomerRepo
-	OrderRepo       *OrderRepo
-	TransactionRepo *TransactionRepo
-	AccountRepo     *AccountRepo
-	ProductRepo     *ProductRepo
-	ReportRepo      *ReportRepo
-	SupplierRepo    *SupplierRepo
-	PurchaseRepo    *PurchaseRepo
+	EmployeeRepo       *EmployeeRepo
+	CustomerRepo       *CustomerRepo
+	OrderRepo          *OrderRepo
+	TransactionRepo    *TransactionRepo
+	AccountRepo        *AccountRepo
+	ProductRepo        *ProductRepo
+	ReportRepo         *ReportRepo
+	SupplierRepo       *SupplierRepo
+	PurchaseRepo       *PurchaseRepo
+	ReconciliationRepo *ReconciliationRepo
+	AggregateRepo      *AggregateRepo
+	PeriodRepo         *PeriodRepo
+	MeasurementRepo    *MeasurementRepo
+	AttachmentRepo     *AttachmentRepo
+	InvoiceRepo        *InvoiceRepo
+	PrintJobRepo       *PrintJobRepo
+	MemoRepo           *MemoRepo
+	PromotionRepo      *PromotionRepo
+	TaxRepo            *TaxRepo
+	VoucherRepo        *VoucherRepo
+	LoyaltyRepo        *LoyaltyRepo
 }
 
 // NewDBRepository initializes all repositories with a shared connection pool
 func NewDBRepository(db *pgxpool.Pool) *DBRepository {
 	return &DBRepository{
-		EmployeeRepo:    NewEmployeeRepo(db),
-		CustomerRepo:    NewCustomerRepo(db),
-		OrderRepo:       NewOrderRepo(db),
-		TransactionRepo: NewTransactionRepo(db),
-		AccountRepo:     NewAccountRepo(db),
-		ProductRepo:     NewProductRepo(db),
-		ReportRepo:      NewReportRepo(db),
-		SupplierRepo:    NewSupplierRepo(db),
-		PurchaseRepo:    NewPurchaseRepo(db),
+		EmployeeRepo:       NewEmployeeRepo(db),
+		CustomerRepo:       NewCustomerRepo(db),
+		OrderRepo:          NewOrderRepo(db),
+		TransactionRepo:    NewTransactionRepo(db),
+		AccountRepo:        NewAccountRepo(db),
+		ProductRepo:        NewProductRepo(db),
+		ReportRepo:         NewReportRepo(db),
+		SupplierRepo:       NewSupplierRepo(db),
+		PurchaseRepo:       NewPurchaseRepo(db),
+		ReconciliationRepo: NewReconciliationRepo(db),
+		AggregateRepo:      NewAggregateRepo(db),
+		PeriodRepo:         NewPeriodRepo(db),
+		MeasurementRepo:    NewMeasurementRepo(db),
+		AttachmentRepo:     NewAttachmentRepo(db),
+		InvoiceRepo:        NewInvoiceRepo(db),
+		PrintJobRepo:       NewPrintJobRepo(db),
+		MemoRepo:           NewMemoRepo(db),
+		PromotionRepo:      NewPromotionRepo(db),
+		TaxRepo:            NewTaxRepo(db),
+		VoucherRepo:        NewVoucherRepo(db),
+		LoyaltyRepo:        NewLoyaltyRepo(db),
 	}
 }
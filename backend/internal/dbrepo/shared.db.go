@@ -30,7 +30,7 @@ func SaveTopSheet(db *pgxpool.Pool, ctx context.Context, ts *models.TopSheetDB)
 	`
 	_, err := db.Exec(ctx, query,
 		ts.SheetDate, ts.BranchID, ts.Expense, ts.Cash, ts.Bank,
-		ts.OrderCount, ts.Delivery, ts.Cancelled, ts.ReadyMade,
+		ts.OrderCount, ts.Delivery, ts.Cancelled, ts.ReadyMade, ts.SalesAmount,
 	)
 	return err
 }
@@ -0,0 +1,486 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ErrInsufficientStoreCredit is returned when a customer spends or withdraws
+// more store credit than they hold.
+var ErrInsufficientStoreCredit = errors.New("insufficient store credit")
+
+// Store credit is a liability kept per customer. Money only enters it through
+// a transaction that already involves the customer (a top-up or an
+// overpayment) or by moving money the customer paid on an order or sale. The
+// movements inside the customer's balance (spend, refund, cancellation) are
+// logged in transactions between the document and the store credit, so they
+// never count twice on the customer statement.
+
+// postStoreCreditTx moves the customer's store credit by e.Amount and records
+// the ledger entry; e.Balance is set to the balance after the move.
+func postStoreCreditTx(ctx context.Context, tx pgx.Tx, e *models.StoreCreditEntry) error {
+	err := tx.QueryRow(ctx, `
+		UPDATE customers SET store_credit = store_credit + $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND branch_id = $3 AND store_credit + $1 >= 0
+		RETURNING store_credit
+	`, e.Amount, e.CustomerID, e.BranchID).Scan(&e.Balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var held money.Amount
+		err = tx.QueryRow(ctx, `SELECT store_credit FROM customers WHERE id = $1 AND branch_id = $2`,
+			e.CustomerID, e.BranchID).Scan(&held)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("customer with id %d not found in this branch", e.CustomerID)
+		}
+		if err != nil {
+			return fmt.Errorf("load store credit failed: %w", err)
+		}
+		return fmt.Errorf("%w: customer holds %s, %s requested", ErrInsufficientStoreCredit, held, -e.Amount)
+	}
+	if err != nil {
+		return fmt.Errorf("update store credit failed: %w", err)
+	}
+
+	if e.MemoNo == "" {
+		if e.MemoNo, err = NextMemoNoTx(ctx, tx, e.BranchID, models.MEMO_STORE_CREDIT, e.EntryDate); err != nil {
+			return err
+		}
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO store_credit_ledger(
+			branch_id, customer_id, entry_date, entry_type, amount,
+			account_id, document_type, document_id, transaction_id, memo_no, notes
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+		RETURNING id, created_at
+	`,
+		e.BranchID, e.CustomerID, e.EntryDate, e.EntryType, e.Amount,
+		e.AccountID, e.DocumentType, e.DocumentID, e.TransactionID, e.MemoNo, e.Notes,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert store credit entry failed: %w", err)
+	}
+	return nil
+}
+
+// documentEntity maps an order or sale to its transactions entity type
+func documentEntity(docType string) string {
+	if docType == models.DOCUMENT_SALE {
+		return models.ENTITY_SALE
+	}
+	return models.ENTITY_ORDER
+}
+
+// insertDocumentPaymentTx adds a payment or refund row to order_transactions or
+// sale_transactions. accountID 0 marks money moved from or to store credit.
+func insertDocumentPaymentTx(ctx context.Context, tx pgx.Tx, docType string, docID int64, date time.Time, accountID int64, memoNo string, deliveredBy int64, amount money.Amount, txType string) error {
+	table, column := "order_transactions", "order_id"
+	if docType == models.DOCUMENT_SALE {
+		table, column = "sale_transactions", "sale_id"
+	}
+	var account *int64
+	if accountID != 0 {
+		account = &accountID
+	}
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s(
+			%s, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
+			amount, transaction_type
+		)
+		VALUES ($1,$2,$3,$4,$5,0,$6,$7)
+	`, table, column), docID, date, account, memoNo, deliveredBy, amount, txType)
+	if err != nil {
+		return fmt.Errorf("insert %s %s row failed: %w", docType, txType, err)
+	}
+	return nil
+}
+
+// spendStoreCreditTx pays amount of an order or sale from the customer's store
+// credit. The caller adds amount to the document's received_amount.
+func spendStoreCreditTx(ctx context.Context, tx pgx.Tx, branchID, customerID int64, docType string, docID int64, docMemo string, date time.Time, deliveredBy int64, amount money.Amount) error {
+	memoNo, err := NextMemoNoTx(ctx, tx, branchID, models.MEMO_STORE_CREDIT, date)
+	if err != nil {
+		return err
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: date,
+		MemoNo:          memoNo,
+		BranchID:        branchID,
+		FromID:          customerID,
+		FromType:        models.ENTITY_STORE_CREDIT,
+		ToID:            docID,
+		ToType:          documentEntity(docType),
+		Amount:          amount,
+		TransactionType: models.PAYMENT,
+		Notes:           fmt.Sprintf("Store credit applied to %s %s", docType, docMemo),
+	})
+	if err != nil {
+		return err
+	}
+	if err := insertDocumentPaymentTx(ctx, tx, docType, docID, date, 0, memoNo, deliveredBy, amount, models.PAYMENT); err != nil {
+		return err
+	}
+	return postStoreCreditTx(ctx, tx, &models.StoreCreditEntry{
+		BranchID:      branchID,
+		CustomerID:    customerID,
+		EntryDate:     date,
+		EntryType:     models.STORE_CREDIT_SPEND,
+		Amount:        -amount,
+		DocumentType:  &docType,
+		DocumentID:    &docID,
+		TransactionID: &transactionID,
+		MemoNo:        memoNo,
+		Notes:         fmt.Sprintf("Paid %s %s", docType, docMemo),
+	})
+}
+
+// creditFromDocumentTx moves money the customer paid on an order or sale into
+// their store credit (refund or cancellation). The caller adjusts the document.
+func creditFromDocumentTx(ctx context.Context, tx pgx.Tx, branchID, customerID int64, docType string, docID int64, docMemo string, date time.Time, amount money.Amount, entryType, notes string) (*models.StoreCreditEntry, error) {
+	memoNo, err := NextMemoNoTx(ctx, tx, branchID, models.MEMO_REFUND, date)
+	if err != nil {
+		return nil, err
+	}
+	if notes == "" {
+		notes = fmt.Sprintf("Credit from %s %s", docType, docMemo)
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: date,
+		MemoNo:          memoNo,
+		BranchID:        branchID,
+		FromID:          docID,
+		FromType:        documentEntity(docType),
+		ToID:            customerID,
+		ToType:          models.ENTITY_STORE_CREDIT,
+		Amount:          amount,
+		TransactionType: models.REFUND,
+		Notes:           notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entry := &models.StoreCreditEntry{
+		BranchID:      branchID,
+		CustomerID:    customerID,
+		EntryDate:     date,
+		EntryType:     entryType,
+		Amount:        amount,
+		DocumentType:  &docType,
+		DocumentID:    &docID,
+		TransactionID: &transactionID,
+		MemoNo:        memoNo,
+		Notes:         notes,
+	}
+	return entry, postStoreCreditTx(ctx, tx, entry)
+}
+
+// accountTopSheet returns the top sheet delta of money moving in (positive) or
+// out of an account, split by the account type
+func accountTopSheet(ctx context.Context, tx pgx.Tx, branchID, accountID int64, date time.Time, amount money.Amount) (*models.TopSheetDB, error) {
+	var acctType string
+	err := tx.QueryRow(ctx,
+		`SELECT type FROM accounts WHERE id = $1 AND branch_id = $2 FOR UPDATE`,
+		accountID, branchID,
+	).Scan(&acctType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("account with id %d not found in this branch", accountID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock account failed: %w", err)
+	}
+	sheet := &models.TopSheetDB{SheetDate: date, BranchID: branchID}
+	if acctType == models.ACCOUNT_BANK {
+		sheet.Bank = amount
+	} else {
+		sheet.Cash = amount
+	}
+	return sheet, nil
+}
+
+// TopUpStoreCredit receives money from a customer into an account and holds it
+// as store credit.
+func (s *CustomerRepo) TopUpStoreCredit(ctx context.Context, req *models.StoreCreditRequest) (*models.StoreCreditEntry, error) {
+	if req.Amount <= 0 {
+		return nil, errors.New("amount must be greater than zero")
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := EnsurePeriodOpenTx(ctx, tx, req.BranchID, req.EntryDate); err != nil {
+		return nil, err
+	}
+	sheet, err := accountTopSheet(ctx, tx, req.BranchID, req.AccountID, req.EntryDate, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	memoNo, err := NextMemoNoTx(ctx, tx, req.BranchID, models.MEMO_STORE_CREDIT, req.EntryDate)
+	if err != nil {
+		return nil, err
+	}
+	notes := req.Notes
+	if notes == "" {
+		notes = "Store credit top-up"
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: req.EntryDate,
+		MemoNo:          memoNo,
+		BranchID:        req.BranchID,
+		FromID:          req.CustomerID,
+		FromType:        models.ENTITY_CUSTOMER,
+		ToID:            req.AccountID,
+		ToType:          models.ENTITY_ACCOUNT,
+		Amount:          req.Amount,
+		TransactionType: models.ADVANCE_PAYMENT,
+		Notes:           notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance + $1 WHERE id = $2`, req.Amount, req.AccountID); err != nil {
+		return nil, fmt.Errorf("update account balance failed: %w", err)
+	}
+	if err := SaveTopSheetTx(tx, ctx, sheet); err != nil {
+		return nil, fmt.Errorf("save top sheet failed: %w", err)
+	}
+
+	entry := &models.StoreCreditEntry{
+		BranchID:      req.BranchID,
+		CustomerID:    req.CustomerID,
+		EntryDate:     req.EntryDate,
+		EntryType:     models.STORE_CREDIT_TOPUP,
+		Amount:        req.Amount,
+		AccountID:     &req.AccountID,
+		TransactionID: &transactionID,
+		MemoNo:        memoNo,
+		Notes:         notes,
+	}
+	if err := postStoreCreditTx(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	return entry, tx.Commit(ctx)
+}
+
+// WithdrawStoreCredit pays store credit back to the customer from an account.
+func (s *CustomerRepo) WithdrawStoreCredit(ctx context.Context, req *models.StoreCreditRequest) (*models.StoreCreditEntry, error) {
+	if req.Amount <= 0 {
+		return nil, errors.New("amount must be greater than zero")
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := EnsurePeriodOpenTx(ctx, tx, req.BranchID, req.EntryDate); err != nil {
+		return nil, err
+	}
+	sheet, err := accountTopSheet(ctx, tx, req.BranchID, req.AccountID, req.EntryDate, -req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	memoNo, err := NextMemoNoTx(ctx, tx, req.BranchID, models.MEMO_REFUND, req.EntryDate)
+	if err != nil {
+		return nil, err
+	}
+	notes := req.Notes
+	if notes == "" {
+		notes = "Store credit paid out"
+	}
+	entry := &models.StoreCreditEntry{
+		BranchID:   req.BranchID,
+		CustomerID: req.CustomerID,
+		EntryDate:  req.EntryDate,
+		EntryType:  models.STORE_CREDIT_WITHDRAWAL,
+		Amount:     -req.Amount,
+		AccountID:  &req.AccountID,
+		MemoNo:     memoNo,
+		Notes:      notes,
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: req.EntryDate,
+		MemoNo:          memoNo,
+		BranchID:        req.BranchID,
+		FromID:          req.AccountID,
+		FromType:        models.ENTITY_ACCOUNT,
+		ToID:            req.CustomerID,
+		ToType:          models.ENTITY_CUSTOMER,
+		Amount:          req.Amount,
+		TransactionType: models.REFUND,
+		Notes:           notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entry.TransactionID = &transactionID
+	if err := postStoreCreditTx(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance - $1 WHERE id = $2`, req.Amount, req.AccountID); err != nil {
+		return nil, fmt.Errorf("update account balance failed: %w", err)
+	}
+	if err := SaveTopSheetTx(tx, ctx, sheet); err != nil {
+		return nil, fmt.Errorf("save top sheet failed: %w", err)
+	}
+	return entry, tx.Commit(ctx)
+}
+
+// RefundToStoreCredit hands money the customer paid on an order or sale back
+// as store credit instead of cash. The document becomes due again by amount.
+func (s *CustomerRepo) RefundToStoreCredit(ctx context.Context, req *models.StoreCreditRequest) (*models.StoreCreditEntry, error) {
+	if req.Amount <= 0 {
+		return nil, errors.New("amount must be greater than zero")
+	}
+	if req.DocumentType != models.DOCUMENT_ORDER && req.DocumentType != models.DOCUMENT_SALE {
+		return nil, errors.New("document_type must be order or sale")
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := EnsurePeriodOpenTx(ctx, tx, req.BranchID, req.EntryDate); err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// 1. Lock the document
+	// --------------------
+	table := "orders"
+	if req.DocumentType == models.DOCUMENT_SALE {
+		table = "sales"
+	}
+	var (
+		memoNo        string
+		status        string
+		salespersonID int64
+		received      money.Amount
+	)
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT memo_no, status, salesperson_id, received_amount
+		FROM %s
+		WHERE id = $1 AND branch_id = $2 AND customer_id = $3
+		FOR UPDATE
+	`, table), req.DocumentID, req.BranchID, req.CustomerID).Scan(&memoNo, &status, &salespersonID, &received)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%s %d not found for this customer", req.DocumentType, req.DocumentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock %s failed: %w", req.DocumentType, err)
+	}
+	if status == models.ORDER_CANCELLED || status == models.SALE_RETURNED {
+		return nil, fmt.Errorf("%s %s is %s", req.DocumentType, memoNo, status)
+	}
+	// what was paid with loyalty points is not money to hand back
+	_, paidWithPoints, err := loyaltyPaidTx(ctx, tx, req.DocumentType, req.DocumentID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Amount > received-paidWithPoints {
+		return nil, fmt.Errorf("refund cannot exceed the %s paid in money on %s %s", received-paidWithPoints, req.DocumentType, memoNo)
+	}
+
+	// --------------------
+	// 2. Reduce what was received on the document
+	// --------------------
+	if req.DocumentType == models.DOCUMENT_ORDER {
+		_, err = tx.Exec(ctx, `
+			UPDATE orders SET
+				received_amount = received_amount - $1,
+				status = CASE WHEN status = $2 THEN $3 ELSE status END,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4
+		`, req.Amount, models.ORDER_DELIVERY, models.ORDER_PARTIAL_DELIVERY, req.DocumentID)
+	} else {
+		_, err = tx.Exec(ctx, `
+			UPDATE sales SET received_amount = received_amount - $1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, req.Amount, req.DocumentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update %s failed: %w", req.DocumentType, err)
+	}
+
+	entry, err := creditFromDocumentTx(ctx, tx, req.BranchID, req.CustomerID, req.DocumentType, req.DocumentID, memoNo,
+		req.EntryDate, req.Amount, models.STORE_CREDIT_REFUND, req.Notes)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertDocumentPaymentTx(ctx, tx, req.DocumentType, req.DocumentID, req.EntryDate, 0, entry.MemoNo, salespersonID, req.Amount, models.REFUND); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE customers SET due_amount = due_amount + $1 WHERE id = $2`, req.Amount, req.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("update customer due failed: %w", err)
+	}
+	// the refunded money no longer earns points
+	if err := syncLoyaltyTx(ctx, tx, req.DocumentType, req.DocumentID, req.EntryDate); err != nil {
+		return nil, err
+	}
+	return entry, tx.Commit(ctx)
+}
+
+// GetStoreCredit lists a customer's store credit movements between start and
+// end (inclusive) with running balances.
+func (s *CustomerRepo) GetStoreCredit(ctx context.Context, branchID, customerID int64, start, end time.Time) (*models.StoreCreditHistory, error) {
+	h := &models.StoreCreditHistory{
+		CustomerID: customerID,
+		StartDate:  start,
+		EndDate:    end,
+		Entries:    []*models.StoreCreditEntry{},
+	}
+	err := s.db.QueryRow(ctx, `
+		SELECT c.store_credit,
+		       COALESCE((SELECT SUM(l.amount) FROM store_credit_ledger l
+		                 WHERE l.customer_id = c.id AND l.entry_date < $3), 0)
+		FROM customers c
+		WHERE c.id = $1 AND c.branch_id = $2
+	`, customerID, branchID, start).Scan(&h.Balance, &h.OpeningBalance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("customer with id %d not found in this branch", customerID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load store credit failed: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, branch_id, customer_id, entry_date, entry_type, amount,
+		       account_id, document_type, document_id, transaction_id, memo_no, COALESCE(notes, ''), created_at
+		FROM store_credit_ledger
+		WHERE customer_id = $1 AND entry_date BETWEEN $2 AND $3
+		ORDER BY entry_date, id
+	`, customerID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("load store credit entries failed: %w", err)
+	}
+	defer rows.Close()
+
+	balance := h.OpeningBalance
+	for rows.Next() {
+		e := &models.StoreCreditEntry{}
+		err := rows.Scan(&e.ID, &e.BranchID, &e.CustomerID, &e.EntryDate, &e.EntryType, &e.Amount,
+			&e.AccountID, &e.DocumentType, &e.DocumentID, &e.TransactionID, &e.MemoNo, &e.Notes, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan store credit entry failed: %w", err)
+		}
+		balance += e.Amount
+		e.Balance = balance
+		h.Entries = append(h.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("store credit rows failed: %w", err)
+	}
+	h.ClosingBalance = balance
+	return h, nil
+}
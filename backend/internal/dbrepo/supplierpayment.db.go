@@ -0,0 +1,223 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// PaySupplier records money paid to a supplier out of a cash or bank account
+// on the payment date and settles it against the supplier's open purchases.
+func (r *PurchaseRepo) PaySupplier(ctx context.Context, payment *models.SupplierPayment) (*models.SupplierPaymentResult, error) {
+	if payment.Amount <= 0 {
+		return nil, errors.New("payment amount must be greater than zero")
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := EnsurePeriodOpenTx(ctx, tx, payment.BranchID, payment.PaymentDate); err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// 1. Lock supplier, account and purchases
+	// --------------------
+	var supplierID int64
+	err = tx.QueryRow(ctx,
+		`SELECT id FROM suppliers WHERE id = $1 AND branch_id = $2 FOR UPDATE`,
+		payment.SupplierID, payment.BranchID,
+	).Scan(&supplierID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("supplier with id %d not found in this branch", payment.SupplierID)
+		}
+		return nil, fmt.Errorf("lock supplier failed: %w", err)
+	}
+
+	var accountID int64
+	err = tx.QueryRow(ctx,
+		`SELECT id FROM accounts WHERE id = $1 AND branch_id = $2`,
+		payment.AccountID, payment.BranchID,
+	).Scan(&accountID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("account with id %d not found in this branch", payment.AccountID)
+		}
+		return nil, fmt.Errorf("load account failed: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		SELECT id FROM purchase WHERE supplier_id = $1 AND branch_id = $2 FOR UPDATE
+	`, payment.SupplierID, payment.BranchID)
+	if err != nil {
+		return nil, fmt.Errorf("lock purchases failed: %w", err)
+	}
+
+	// --------------------
+	// 2. Allocate across open purchases
+	// --------------------
+	open, err := getOpenPurchases(ctx, tx, payment.BranchID, payment.SupplierID, payment.PaymentDate)
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := allocateSupplierPayment(payment, open)
+	if err != nil {
+		return nil, err
+	}
+
+	memoNo, err := NextMemoNoTx(ctx, tx, payment.BranchID, models.MEMO_SUPPLIER_PAYMENT, payment.PaymentDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// like the payment booked with a purchase, this is a movement from the
+	// account to the supplier; the expense was booked with the purchase
+	notes := payment.Notes
+	if notes == "" {
+		notes = "Payment to supplier"
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: payment.PaymentDate,
+		MemoNo:          memoNo,
+		BranchID:        payment.BranchID,
+		FromID:          payment.AccountID,
+		FromType:        models.ENTITY_ACCOUNT,
+		ToID:            payment.SupplierID,
+		ToType:          models.ENTITY_SUPPLIER,
+		Amount:          payment.Amount,
+		TransactionType: models.PAYMENT,
+		Notes:           notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var owed money.Amount
+	for _, p := range open {
+		owed += p.DueAmount
+	}
+	for _, a := range allocations {
+		_, err = tx.Exec(ctx, `
+			UPDATE purchase SET paid_amount = paid_amount + $1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, a.Amount, a.PurchaseID)
+		if err != nil {
+			return nil, fmt.Errorf("update purchase %d failed: %w", a.PurchaseID, err)
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO purchase_payments
+				(purchase_id, supplier_id, branch_id, transaction_id, payment_date, memo_no, amount)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)
+		`, a.PurchaseID, payment.SupplierID, payment.BranchID, transactionID, payment.PaymentDate, memoNo, a.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("insert purchase payment failed: %w", err)
+		}
+	}
+
+	result := &models.SupplierPaymentResult{
+		MemoNo:           memoNo,
+		TransactionID:    transactionID,
+		SupplierID:       payment.SupplierID,
+		Amount:           payment.Amount,
+		Allocations:      allocations,
+		RemainingPayable: owed - payment.Amount,
+	}
+	return result, tx.Commit(ctx)
+}
+
+// GetOpenPurchases lists the purchases of a supplier that are not fully paid,
+// oldest first.
+func (r *PurchaseRepo) GetOpenPurchases(ctx context.Context, branchID, supplierID int64) ([]*models.OpenPurchase, error) {
+	return getOpenPurchases(ctx, r.db, branchID, supplierID, today())
+}
+
+// getOpenPurchases loads the open purchases of a supplier booked on or before
+// the given date, oldest first
+func getOpenPurchases(ctx context.Context, q queryer, branchID, supplierID int64, asOf time.Time) ([]*models.OpenPurchase, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, memo_no, purchase_date, total_amount, paid_amount
+		FROM purchase
+		WHERE supplier_id = $1 AND branch_id = $2
+		  AND purchase_date <= $3::date
+		  AND total_amount - paid_amount > 0
+		ORDER BY purchase_date, id
+	`, supplierID, branchID, asOf)
+	if err != nil {
+		return nil, fmt.Errorf("load open purchases failed: %w", err)
+	}
+	defer rows.Close()
+
+	list := []*models.OpenPurchase{}
+	for rows.Next() {
+		p := &models.OpenPurchase{}
+		if err := rows.Scan(&p.PurchaseID, &p.MemoNo, &p.PurchaseDate, &p.TotalAmount, &p.PaidAmount); err != nil {
+			return nil, fmt.Errorf("scan open purchase failed: %w", err)
+		}
+		p.DueAmount = p.TotalAmount - p.PaidAmount
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// allocateSupplierPayment validates explicit allocations, or spreads the
+// payment over the open purchases (oldest first) when none are given. All of
+// the payment must be applied, as money is not kept on account with suppliers.
+func allocateSupplierPayment(payment *models.SupplierPayment, open []*models.OpenPurchase) ([]*models.PurchaseAllocation, error) {
+	var owed money.Amount
+	for _, p := range open {
+		owed += p.DueAmount
+	}
+	if payment.Amount > owed {
+		return nil, fmt.Errorf("payment amount %s exceeds the %s owed to the supplier", payment.Amount, owed)
+	}
+
+	if len(payment.Allocations) > 0 {
+		byKey := make(map[string]dueDocument, len(open))
+		memoNos := make(map[int64]string, len(open))
+		for _, p := range open {
+			byKey[openDocumentKey(models.DOCUMENT_PURCHASE, p.PurchaseID)] = dueDocument{memoNo: p.MemoNo, due: p.DueAmount}
+			memoNos[p.PurchaseID] = p.MemoNo
+		}
+		lines := make([]allocationLine, len(payment.Allocations))
+		for i, a := range payment.Allocations {
+			lines[i] = allocationLine{
+				key:    openDocumentKey(models.DOCUMENT_PURCHASE, a.PurchaseID),
+				ref:    fmt.Sprintf("purchase %d", a.PurchaseID),
+				amount: a.Amount,
+			}
+		}
+		total, err := checkAllocations(lines, byKey, "supplier")
+		if err != nil {
+			return nil, err
+		}
+		if total != payment.Amount {
+			return nil, fmt.Errorf("allocations total %s does not match payment amount %s", total, payment.Amount)
+		}
+		for _, a := range payment.Allocations {
+			a.MemoNo = memoNos[a.PurchaseID]
+		}
+		return payment.Allocations, nil
+	}
+
+	dues := make([]money.Amount, len(open))
+	for i, p := range open {
+		dues[i] = p.DueAmount
+	}
+	var allocations []*models.PurchaseAllocation
+	for i, amount := range spreadOldestFirst(payment.Amount, dues) {
+		allocations = append(allocations, &models.PurchaseAllocation{
+			PurchaseID: open[i].PurchaseID,
+			MemoNo:     open[i].MemoNo,
+			Amount:     amount,
+		})
+	}
+	return allocations, nil
+}
@@ -0,0 +1,73 @@
+package dbrepo
+
+import (
+	"testing"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// purchases owing 300.00 and 200.00, oldest first
+func openPurchases() []*models.OpenPurchase {
+	return []*models.OpenPurchase{
+		{PurchaseID: 1, MemoNo: "PU-1", TotalAmount: 50000, PaidAmount: 20000, DueAmount: 30000},
+		{PurchaseID: 2, MemoNo: "PU-2", TotalAmount: 20000, DueAmount: 20000},
+	}
+}
+
+func TestAllocateSupplierPaymentSettlesAllOwed(t *testing.T) {
+	got, err := allocateSupplierPayment(&models.SupplierPayment{Amount: 50000}, openPurchases())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Amount != 30000 || got[1].Amount != 20000 {
+		t.Fatalf("allocations = %+v, want both purchases settled", got)
+	}
+	if got[0].MemoNo != "PU-1" || got[1].MemoNo != "PU-2" {
+		t.Errorf("memo numbers = %s, %s, want PU-1, PU-2", got[0].MemoNo, got[1].MemoNo)
+	}
+}
+
+// money is not kept on account with suppliers, so nothing may be left over
+func TestAllocateSupplierPaymentNotMoreThanOwed(t *testing.T) {
+	if _, err := allocateSupplierPayment(&models.SupplierPayment{Amount: 50001}, openPurchases()); err == nil {
+		t.Error("expected an error for a payment above what is owed")
+	}
+	if _, err := allocateSupplierPayment(&models.SupplierPayment{Amount: 100}, nil); err == nil {
+		t.Error("expected an error for a supplier with nothing owed")
+	}
+}
+
+func TestAllocateSupplierPaymentExplicitMustMatch(t *testing.T) {
+	allocations := func() []*models.PurchaseAllocation {
+		return []*models.PurchaseAllocation{{PurchaseID: 2, Amount: 20000}, {PurchaseID: 1, Amount: 5000}}
+	}
+
+	// the payment must be applied in full, unlike a customer payment whose
+	// rest becomes store credit
+	for _, amount := range []money.Amount{24999, 25001} {
+		payment := &models.SupplierPayment{Amount: amount, Allocations: allocations()}
+		if _, err := allocateSupplierPayment(payment, openPurchases()); err == nil {
+			t.Errorf("payment of %s with allocations of 250.00: expected an error", amount)
+		}
+	}
+
+	payment := &models.SupplierPayment{Amount: 25000, Allocations: allocations()}
+	got, err := allocateSupplierPayment(payment, openPurchases())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].MemoNo != "PU-2" || got[1].MemoNo != "PU-1" {
+		t.Errorf("memo numbers not filled in: %+v, %+v", *got[0], *got[1])
+	}
+}
+
+func TestAllocateSupplierPaymentOtherSuppliersPurchase(t *testing.T) {
+	payment := &models.SupplierPayment{
+		Amount:      10000,
+		Allocations: []*models.PurchaseAllocation{{PurchaseID: 7, Amount: 10000}},
+	}
+	if _, err := allocateSupplierPayment(payment, openPurchases()); err == nil {
+		t.Error("expected an error for a purchase that is not open for this supplier")
+	}
+}
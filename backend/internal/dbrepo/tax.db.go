@@ -0,0 +1,524 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ============================== Tax Rates ==============================
+type TaxRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewTaxRepo(db *pgxpool.Pool) *TaxRepo {
+	return &TaxRepo{db: db}
+}
+
+// validateTaxRate checks a tax rate before it is saved
+func validateTaxRate(t *models.TaxRate) error {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Category = strings.TrimSpace(t.Category)
+	if t.Name == "" {
+		return errors.New("tax name is required")
+	}
+	if t.Category == "" {
+		return errors.New("tax category is required")
+	}
+	if t.AppliesTo != models.TAX_ON_SALES && t.AppliesTo != models.TAX_ON_PURCHASES {
+		return fmt.Errorf("tax must apply to %q or %q", models.TAX_ON_SALES, models.TAX_ON_PURCHASES)
+	}
+	if t.Rate < 0 || t.Rate > money.FromInt(100) {
+		return errors.New("tax rate must be between 0 and 100")
+	}
+	if t.StartsOn.IsZero() {
+		return errors.New("tax start date is required")
+	}
+	if t.EndsOn != nil && t.EndsOn.Before(t.StartsOn) {
+		return errors.New("tax rate cannot end before it starts")
+	}
+	return nil
+}
+
+const taxRateColumns = `
+	id, branch_id, applies_to, category, name, rate, starts_on, ends_on, active, created_at, updated_at`
+
+func scanTaxRate(row pgx.Row) (*models.TaxRate, error) {
+	var t models.TaxRate
+	err := row.Scan(&t.ID, &t.BranchID, &t.AppliesTo, &t.Category, &t.Name, &t.Rate,
+		&t.StartsOn, &t.EndsOn, &t.Active, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTaxRates returns the tax rates that apply in a branch, by category and name.
+// With activeOn set only the active ones in force on that date are returned.
+func (r *TaxRepo) ListTaxRates(ctx context.Context, branchID int64, activeOn *time.Time) ([]*models.TaxRate, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+taxRateColumns+`
+		FROM tax_rates
+		WHERE (branch_id IS NULL OR branch_id = $1)
+		  AND ($2::date IS NULL OR (active AND starts_on <= $2::date AND (ends_on IS NULL OR ends_on >= $2::date)))
+		ORDER BY applies_to, category, name, starts_on DESC, id
+	`, branchID, activeOn)
+	if err != nil {
+		return nil, fmt.Errorf("list tax rates failed: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []*models.TaxRate{}
+	for rows.Next() {
+		t, err := scanTaxRate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan tax rate failed: %w", err)
+		}
+		rates = append(rates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("tax rate rows failed: %w", err)
+	}
+	return rates, nil
+}
+
+// CreateTaxRate saves a new tax rate; a nil BranchID applies it in every branch
+func (r *TaxRepo) CreateTaxRate(ctx context.Context, t *models.TaxRate) error {
+	if err := validateTaxRate(t); err != nil {
+		return err
+	}
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO tax_rates (branch_id, applies_to, category, name, rate, starts_on, ends_on, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`, t.BranchID, t.AppliesTo, t.Category, t.Name, t.Rate, t.StartsOn, t.EndsOn, t.Active,
+	).Scan(&t.ID, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("insert tax rate failed: %w", err)
+	}
+	return nil
+}
+
+// UpdateTaxRate changes a tax rate that applies in the branch. Documents
+// already taxed keep the tax they were charged; to change a rate from a date
+// on, end the old one and add a new one.
+func (r *TaxRepo) UpdateTaxRate(ctx context.Context, branchID int64, t *models.TaxRate) error {
+	if err := validateTaxRate(t); err != nil {
+		return err
+	}
+	err := r.db.QueryRow(ctx, `
+		UPDATE tax_rates SET
+			branch_id = $3, applies_to = $4, category = $5, name = $6, rate = $7,
+			starts_on = $8, ends_on = $9, active = $10, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (branch_id IS NULL OR branch_id = $2)
+		RETURNING created_at, updated_at
+	`, t.ID, branchID, t.BranchID, t.AppliesTo, t.Category, t.Name, t.Rate,
+		t.StartsOn, t.EndsOn, t.Active,
+	).Scan(&t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("tax rate with id %d not found", t.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("update tax rate failed: %w", err)
+	}
+	return nil
+}
+
+// SetBranchTaxSettings sets the tax id of a branch and whether its prices include tax
+func (r *TaxRepo) SetBranchTaxSettings(ctx context.Context, branchID int64, s *models.TaxSettings) error {
+	s.TaxID = strings.TrimSpace(s.TaxID)
+	tag, err := r.db.Exec(ctx, `UPDATE branches SET tax_id = $1, prices_include_tax = $2 WHERE id = $3`,
+		s.TaxID, s.PricesIncludeTax, branchID)
+	if err != nil {
+		return fmt.Errorf("update tax settings failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("branch %d not found", branchID)
+	}
+	return nil
+}
+
+// SetProductTaxCategory puts a product of the branch in a tax category
+func (r *TaxRepo) SetProductTaxCategory(ctx context.Context, branchID, productID int64, category string) error {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return errors.New("tax category is required")
+	}
+	tag, err := r.db.Exec(ctx, `UPDATE products SET tax_category = $1 WHERE id = $2 AND branch_id = $3`,
+		category, productID, branchID)
+	if err != nil {
+		return fmt.Errorf("update product tax category failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("product with id %d not found", productID)
+	}
+	return nil
+}
+
+// ============================== Document Taxes ==============================
+
+// taxedLine is the part of a document in one tax category
+type taxedLine struct {
+	category string
+	amount   money.Amount
+}
+
+// taxRatesTx returns the rates in force in a branch on a date, by category.
+// Of the rates of the same name and category, the one of the branch wins
+// over the one of all branches.
+func taxRatesTx(ctx context.Context, tx pgx.Tx, branchID int64, appliesTo string, date time.Time) (map[string][]models.TaxRate, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT ON (category, name) id, category, name, rate
+		FROM tax_rates
+		WHERE applies_to = $1
+		  AND active
+		  AND (branch_id IS NULL OR branch_id = $2)
+		  AND starts_on <= $3::date AND (ends_on IS NULL OR ends_on >= $3::date)
+		ORDER BY category, name, branch_id NULLS LAST, starts_on DESC
+	`, appliesTo, branchID, date)
+	if err != nil {
+		return nil, fmt.Errorf("load tax rates failed: %w", err)
+	}
+	defer rows.Close()
+
+	rates := map[string][]models.TaxRate{}
+	for rows.Next() {
+		var t models.TaxRate
+		if err := rows.Scan(&t.ID, &t.Category, &t.Name, &t.Rate); err != nil {
+			return nil, fmt.Errorf("scan tax rate failed: %w", err)
+		}
+		rates[t.Category] = append(rates[t.Category], t)
+	}
+	return rates, rows.Err()
+}
+
+// applyTaxesTx works out the tax of a document of a branch from the parts of
+// it in each tax category and returns its total with tax. total is the
+// amount after discounts; it is shared out over the categories in proportion
+// to the lines, so discounts on the whole document lower the tax of every
+// line. Without lines (or with lines of no value) the whole total is taxed
+// in the standard category. On an edit, old holds the tax of the document
+// before it: its choice of prices with or without tax stays unless another
+// is given.
+func applyTaxesTx(ctx context.Context, tx pgx.Tx, appliesTo string, branchID int64, date time.Time, t *models.DocumentTax, lines []taxedLine, total money.Amount, old *models.DocumentTax) (money.Amount, error) {
+	if t.PricesIncludeTax == nil && old != nil {
+		t.PricesIncludeTax = old.PricesIncludeTax
+	}
+	if t.PricesIncludeTax == nil {
+		var inclusive bool
+		err := tx.QueryRow(ctx, `SELECT prices_include_tax FROM branches WHERE id = $1`, branchID).Scan(&inclusive)
+		if err != nil {
+			return 0, fmt.Errorf("load branch tax setting failed: %w", err)
+		}
+		t.PricesIncludeTax = &inclusive
+	}
+	inclusive := *t.PricesIncludeTax
+
+	rates, err := taxRatesTx(ctx, tx, branchID, appliesTo, date)
+	if err != nil {
+		return 0, err
+	}
+
+	// --------------------
+	// 1. Share the total out over the categories
+	// --------------------
+	var sum money.Amount
+	byCategory := map[string]money.Amount{}
+	for _, l := range lines {
+		if l.amount <= 0 {
+			continue
+		}
+		category := l.category
+		if category == "" {
+			category = models.TAX_CATEGORY_STANDARD
+		}
+		byCategory[category] += l.amount
+		sum += l.amount
+	}
+	if sum == 0 {
+		byCategory = map[string]money.Amount{models.TAX_CATEGORY_STANDARD: total}
+		sum = total
+	}
+	categories := make([]string, 0, len(byCategory))
+	for c := range byCategory {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+
+	// --------------------
+	// 2. Tax each category at its rates
+	// --------------------
+	t.Taxes = []models.TaxLine{}
+	t.TaxAmount = 0
+	var shared money.Amount
+	for i, c := range categories {
+		base := total - shared // the last category takes what rounding left
+		if i < len(categories)-1 && sum != 0 {
+			base = total.MulFrac(byCategory[c].Cents(), sum.Cents())
+		}
+		shared += base
+		if base <= 0 || len(rates[c]) == 0 {
+			continue
+		}
+
+		var combined int64
+		for _, rate := range rates[c] {
+			combined += rate.Rate.Cents()
+		}
+		lines := make([]models.TaxLine, len(rates[c]))
+		var categoryTax money.Amount
+		for j, rate := range rates[c] {
+			tax := base.MulFrac(rate.Rate.Cents(), 100*100)
+			if inclusive {
+				// the price holds the base and all of its taxes
+				tax = base.MulFrac(rate.Rate.Cents(), 100*100+combined)
+			}
+			categoryTax += tax
+			lines[j] = models.TaxLine{TaxRateID: rate.ID, Name: rate.Name, Category: c, Rate: rate.Rate, TaxAmount: tax}
+		}
+		for j := range lines {
+			lines[j].TaxableAmount = base
+			if inclusive {
+				lines[j].TaxableAmount = base - categoryTax
+			}
+		}
+		t.Taxes = append(t.Taxes, lines...)
+		t.TaxAmount += categoryTax
+	}
+
+	if inclusive {
+		t.NetAmount = total - t.TaxAmount
+		return total, nil
+	}
+	t.NetAmount = total
+	return total + t.TaxAmount, nil
+}
+
+// productTaxCategoriesTx returns the tax category of each of the products
+func productTaxCategoriesTx(ctx context.Context, tx pgx.Tx, productIDs []int64) (map[int64]string, error) {
+	rows, err := tx.Query(ctx, `SELECT id, tax_category FROM products WHERE id = ANY($1)`, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("load product tax categories failed: %w", err)
+	}
+	defer rows.Close()
+
+	categories := map[int64]string{}
+	for rows.Next() {
+		var (
+			id       int64
+			category string
+		)
+		if err := rows.Scan(&id, &category); err != nil {
+			return nil, fmt.Errorf("scan product tax category failed: %w", err)
+		}
+		categories[id] = category
+	}
+	return categories, rows.Err()
+}
+
+// applyOrderTaxesTx works out the tax of an order after its discounts and
+// sets its total; oldOrder is the order being edited, if any
+func applyOrderTaxesTx(ctx context.Context, tx pgx.Tx, order, oldOrder *models.OrderDB) error {
+	productIDs := make([]int64, len(order.Items))
+	for i, item := range order.Items {
+		productIDs[i] = item.ProductID
+	}
+	categories, err := productTaxCategoriesTx(ctx, tx, productIDs)
+	if err != nil {
+		return err
+	}
+	lines := make([]taxedLine, len(order.Items))
+	for i, item := range order.Items {
+		lines[i] = taxedLine{category: categories[item.ProductID], amount: item.Subtotal - item.DiscountAmount}
+	}
+	branchID, old := order.BranchID, (*models.DocumentTax)(nil)
+	if oldOrder != nil {
+		branchID, old = oldOrder.BranchID, &oldOrder.DocumentTax
+	}
+	total, err := applyTaxesTx(ctx, tx, models.TAX_ON_SALES, branchID, order.OrderDate, &order.DocumentTax, lines, order.TotalAmount, old)
+	if err != nil {
+		return err
+	}
+	order.TotalAmount = total
+	return nil
+}
+
+// applySaleTaxesTx works out the tax of a sale after its discounts and sets
+// its total; oldSale is the sale being edited, if any
+func applySaleTaxesTx(ctx context.Context, tx pgx.Tx, sale, oldSale *models.SaleDB) error {
+	productIDs := make([]int64, len(sale.Items))
+	for i, item := range sale.Items {
+		productIDs[i] = item.ProductID
+	}
+	categories, err := productTaxCategoriesTx(ctx, tx, productIDs)
+	if err != nil {
+		return err
+	}
+	lines := make([]taxedLine, len(sale.Items))
+	for i, item := range sale.Items {
+		lines[i] = taxedLine{category: categories[item.ProductID], amount: item.Subtotal - item.DiscountAmount}
+	}
+	branchID, old := sale.BranchID, (*models.DocumentTax)(nil)
+	if oldSale != nil {
+		branchID, old = oldSale.BranchID, &oldSale.DocumentTax
+	}
+	total, err := applyTaxesTx(ctx, tx, models.TAX_ON_SALES, branchID, sale.SaleDate, &sale.DocumentTax, lines, sale.TotalAmount, old)
+	if err != nil {
+		return err
+	}
+	sale.TotalAmount = total
+	return nil
+}
+
+// applyPurchaseTaxesTx works out the tax paid on a purchase, taxed by its
+// category, and sets its total; old is the tax of the purchase being edited, if any
+func applyPurchaseTaxesTx(ctx context.Context, tx pgx.Tx, p *models.PurchaseDB, old *models.DocumentTax) error {
+	lines := []taxedLine{{category: p.Category, amount: p.TotalAmount}}
+	total, err := applyTaxesTx(ctx, tx, models.TAX_ON_PURCHASES, p.BranchID, p.PurchaseDate, &p.DocumentTax, lines, p.TotalAmount, old)
+	if err != nil {
+		return err
+	}
+	p.TotalAmount = total
+	return nil
+}
+
+// documentTable is the table an order, sale or purchase is kept in
+func documentTable(docType string) string {
+	switch docType {
+	case models.DOCUMENT_SALE:
+		return "sales"
+	case models.DOCUMENT_PURCHASE:
+		return "purchase"
+	}
+	return "orders"
+}
+
+// saveDocumentTaxesTx writes the tax of an order, sale or purchase and
+// replaces its tax lines
+func saveDocumentTaxesTx(ctx context.Context, tx pgx.Tx, docType string, docID, branchID int64, date time.Time, t *models.DocumentTax) error {
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		UPDATE %s SET prices_include_tax = $2, net_amount = $3, tax_amount = $4
+		WHERE id = $1
+	`, documentTable(docType)), docID, *t.PricesIncludeTax, t.NetAmount, t.TaxAmount)
+	if err != nil {
+		return fmt.Errorf("save %s tax failed: %w", docType, err)
+	}
+	if err := deleteDocumentTaxesTx(ctx, tx, docType, docID); err != nil {
+		return err
+	}
+	for _, l := range t.Taxes {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO document_taxes (document_type, document_id, branch_id, document_date,
+				tax_rate_id, name, category, rate, taxable_amount, tax_amount)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, docType, docID, branchID, date, l.TaxRateID, l.Name, l.Category, l.Rate, l.TaxableAmount, l.TaxAmount)
+		if err != nil {
+			return fmt.Errorf("insert %s tax line failed: %w", docType, err)
+		}
+	}
+	return nil
+}
+
+// deleteDocumentTaxesTx removes the tax lines of a document
+func deleteDocumentTaxesTx(ctx context.Context, tx pgx.Tx, docType string, docID int64) error {
+	_, err := tx.Exec(ctx, `DELETE FROM document_taxes WHERE document_type = $1 AND document_id = $2`, docType, docID)
+	if err != nil {
+		return fmt.Errorf("delete %s tax lines failed: %w", docType, err)
+	}
+	return nil
+}
+
+// loadDocumentTaxes reads the tax recorded with an order, sale or purchase
+func loadDocumentTaxes(ctx context.Context, q interface {
+	rowQueryer
+	queryer
+}, docType string, docID int64, t *models.DocumentTax) error {
+	var inclusive bool
+	err := q.QueryRow(ctx, fmt.Sprintf(`SELECT prices_include_tax, net_amount, tax_amount FROM %s WHERE id = $1`,
+		documentTable(docType)), docID).Scan(&inclusive, &t.NetAmount, &t.TaxAmount)
+	if err != nil {
+		return fmt.Errorf("load %s tax failed: %w", docType, err)
+	}
+	t.PricesIncludeTax = &inclusive
+
+	rows, err := q.Query(ctx, `
+		SELECT COALESCE(tax_rate_id, 0), name, category, rate, taxable_amount, tax_amount
+		FROM document_taxes
+		WHERE document_type = $1 AND document_id = $2
+		ORDER BY category, name
+	`, docType, docID)
+	if err != nil {
+		return fmt.Errorf("load %s tax lines failed: %w", docType, err)
+	}
+	defer rows.Close()
+
+	t.Taxes = []models.TaxLine{}
+	for rows.Next() {
+		var l models.TaxLine
+		if err := rows.Scan(&l.TaxRateID, &l.Name, &l.Category, &l.Rate, &l.TaxableAmount, &l.TaxAmount); err != nil {
+			return fmt.Errorf("scan %s tax line failed: %w", docType, err)
+		}
+		t.Taxes = append(t.Taxes, l)
+	}
+	return rows.Err()
+}
+
+// GetTaxSummary sets the tax charged on the sales and orders of a branch made
+// in a period against the tax paid on its purchases, by tax and rate.
+// Cancelled and returned documents are left out.
+func (r *ReportRepo) GetTaxSummary(ctx context.Context, branchID int64, startDate, endDate time.Time) (*models.TaxSummary, error) {
+	summary := &models.TaxSummary{
+		BranchID:  branchID,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Output:    []*models.TaxSummaryLine{},
+		Input:     []*models.TaxSummaryLine{},
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT dt.document_type = 'purchase', dt.name, dt.rate,
+		       COUNT(DISTINCT (dt.document_type, dt.document_id)),
+		       SUM(dt.taxable_amount), SUM(dt.tax_amount)
+		FROM document_taxes dt
+		LEFT JOIN orders o ON dt.document_type = 'order' AND o.id = dt.document_id
+		LEFT JOIN sales s ON dt.document_type = 'sale' AND s.id = dt.document_id
+		WHERE dt.branch_id = $1
+		  AND dt.document_date BETWEEN $2::date AND $3::date
+		  AND COALESCE(o.status, s.status, '') NOT IN ('cancelled', 'returned')
+		GROUP BY 1, dt.name, dt.rate
+		ORDER BY 1, dt.name, dt.rate
+	`, branchID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("tax summary query failed: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			input bool
+			l     models.TaxSummaryLine
+		)
+		if err := rows.Scan(&input, &l.Name, &l.Rate, &l.Documents, &l.TaxableAmount, &l.TaxAmount); err != nil {
+			return nil, fmt.Errorf("scan tax summary failed: %w", err)
+		}
+		if input {
+			summary.Input = append(summary.Input, &l)
+			summary.InputTax += l.TaxAmount
+		} else {
+			summary.Output = append(summary.Output, &l)
+			summary.OutputTax += l.TaxAmount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("tax summary rows failed: %w", err)
+	}
+	summary.NetPayable = summary.OutputTax - summary.InputTax
+	return summary, nil
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/projuktisheba/erp-mini-api/internal/models"
-	"github.com/projuktisheba/erp-mini-api/internal/utils"
 )
 
 type TransactionRepo struct {
@@ -21,42 +20,32 @@ func NewTransactionRepo(db *pgxpool.Pool) *TransactionRepo {
 
 // CreateTransaction inserts a new transaction
 func (r *TransactionRepo) CreateTransaction(ctx context.Context, t *models.Transaction) (int64, error) {
-	// generate memo_no if empty
-	if t.MemoNo == "" {
-		t.MemoNo = utils.GenerateMemoNo()
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction failed: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	var transactionID int64
-	query := `
-		INSERT INTO transactions
-			(transaction_date, memo_no, branch_id, from_entity_id, from_entity_type, to_entity_id, to_entity_type, amount, transaction_type, notes, created_at, updated_at)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,CURRENT_TIMESTAMP,CURRENT_TIMESTAMP)
-		RETURNING transaction_id
-	`
-	err := r.db.QueryRow(ctx, query,
-		t.TransactionDate,
-		t.MemoNo,
-		t.BranchID,
-		t.FromID,
-		t.FromType,
-		t.ToID,
-		t.ToType,
-		t.Amount,
-		t.TransactionType,
-		t.Notes,
-	).Scan(&transactionID)
+	if err := EnsurePeriodOpenTx(ctx, tx, t.BranchID, t.TransactionDate); err != nil {
+		return 0, err
+	}
 
+	transactionID, err := CreateTransactionTx(ctx, tx, t)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create transaction: %w", err)
 	}
 
-	return transactionID, nil
+	return transactionID, tx.Commit(ctx)
 }
 
 // CreateTransactionTx inserts a transaction within an existing tx
 func CreateTransactionTx(ctx context.Context, tx pgx.Tx, t *models.Transaction) (int64, error) {
 	if t.MemoNo == "" {
-		t.MemoNo = utils.GenerateMemoNo()
+		memoNo, err := NextMemoNoTx(ctx, tx, t.BranchID, models.MEMO_TRANSFER, t.TransactionDate)
+		if err != nil {
+			return 0, err
+		}
+		t.MemoNo = memoNo
 	}
 
 	var transactionID int64
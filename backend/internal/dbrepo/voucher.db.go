@@ -0,0 +1,509 @@
+package dbrepo
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ErrInsufficientVoucher is returned when more is asked of a voucher than is
+// left on it.
+var ErrInsufficientVoucher = errors.New("insufficient voucher balance")
+
+// Gift vouchers are a liability like store credit, but they belong to
+// whoever holds the code rather than to a customer and are good in every
+// branch. Each movement is booked in the branch it happens in, so a branch
+// that redeems vouchers sold elsewhere shows a negative voucher liability
+// which the consolidated figures settle.
+
+type VoucherRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewVoucherRepo(db *pgxpool.Pool) *VoucherRepo {
+	return &VoucherRepo{db: db}
+}
+
+// voucherCodeAlphabet leaves out letters and digits that are easily mistaken
+// for each other on a printed card
+const voucherCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newVoucherCode returns a random code like GV-7KQM-X2RD
+func newVoucherCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate voucher code failed: %w", err)
+	}
+	for i := range b {
+		b[i] = voucherCodeAlphabet[int(b[i])%len(voucherCodeAlphabet)]
+	}
+	return "GV-" + string(b[:4]) + "-" + string(b[4:]), nil
+}
+
+// normalizeVoucherCode is the code as stored: trimmed and upper case
+func normalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// voucherStatus tells whether a voucher can still be used on date
+func voucherStatus(v *models.GiftVoucher, date time.Time) string {
+	switch {
+	case v.Balance == 0:
+		return models.VOUCHER_REDEEMED
+	case date.After(v.ExpiresOn):
+		return models.VOUCHER_EXPIRED
+	default:
+		return models.VOUCHER_ACTIVE
+	}
+}
+
+// postVoucherEntryTx records a movement of a voucher
+func postVoucherEntryTx(ctx context.Context, tx pgx.Tx, e *models.VoucherEntry) error {
+	err := tx.QueryRow(ctx, `
+		INSERT INTO voucher_ledger(
+			voucher_id, branch_id, entry_date, entry_type, amount,
+			account_id, document_type, document_id, transaction_id, memo_no, notes
+		)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+		RETURNING id, created_at
+	`,
+		e.VoucherID, e.BranchID, e.EntryDate, e.EntryType, e.Amount,
+		e.AccountID, e.DocumentType, e.DocumentID, e.TransactionID, e.MemoNo, e.Notes,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert voucher entry failed: %w", err)
+	}
+	return nil
+}
+
+// redeemVoucherTx pays amount of an order or sale with the voucher of code.
+// The caller adds amount to the document's received_amount.
+func redeemVoucherTx(ctx context.Context, tx pgx.Tx, branchID int64, code, docType string, docID int64, docMemo string, date time.Time, deliveredBy int64, amount money.Amount) (*models.VoucherEntry, error) {
+	code = normalizeVoucherCode(code)
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount paid with voucher %s must be greater than zero", code)
+	}
+
+	v := &models.GiftVoucher{Code: code}
+	err := tx.QueryRow(ctx, `
+		SELECT id, balance, expires_on FROM gift_vouchers WHERE code = $1 FOR UPDATE
+	`, code).Scan(&v.ID, &v.Balance, &v.ExpiresOn)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("voucher %s not found", code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock voucher failed: %w", err)
+	}
+	if voucherStatus(v, date) == models.VOUCHER_EXPIRED {
+		return nil, fmt.Errorf("voucher %s expired on %s", code, v.ExpiresOn.Format("2006-01-02"))
+	}
+	if amount > v.Balance {
+		return nil, fmt.Errorf("%w: voucher %s has %s left, %s requested", ErrInsufficientVoucher, code, v.Balance, amount)
+	}
+
+	memoNo, err := NextMemoNoTx(ctx, tx, branchID, models.MEMO_VOUCHER, date)
+	if err != nil {
+		return nil, err
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: date,
+		MemoNo:          memoNo,
+		BranchID:        branchID,
+		FromID:          v.ID,
+		FromType:        models.ENTITY_VOUCHER,
+		ToID:            docID,
+		ToType:          documentEntity(docType),
+		Amount:          amount,
+		TransactionType: models.PAYMENT,
+		Notes:           fmt.Sprintf("Gift voucher %s applied to %s %s", code, docType, docMemo),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	table, column := documentTransactionsTable(docType)
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s(
+			%s, transaction_date, payment_account_id, memo_no, delivered_by, quantity_delivered,
+			amount, transaction_type, voucher_id
+		)
+		VALUES ($1,$2,NULL,$3,$4,0,$5,$6,$7)
+	`, table, column), docID, date, memoNo, deliveredBy, amount, models.PAYMENT, v.ID)
+	if err != nil {
+		return nil, fmt.Errorf("insert %s voucher payment failed: %w", docType, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE gift_vouchers SET balance = balance - $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+	`, amount, v.ID)
+	if err != nil {
+		return nil, fmt.Errorf("update voucher balance failed: %w", err)
+	}
+
+	entry := &models.VoucherEntry{
+		VoucherID:     v.ID,
+		Code:          code,
+		BranchID:      branchID,
+		EntryDate:     date,
+		EntryType:     models.VOUCHER_REDEEM,
+		Amount:        -amount,
+		DocumentType:  &docType,
+		DocumentID:    &docID,
+		TransactionID: &transactionID,
+		MemoNo:        memoNo,
+		Notes:         fmt.Sprintf("Paid %s %s", docType, docMemo),
+		Balance:       v.Balance - amount,
+	}
+	return entry, postVoucherEntryTx(ctx, tx, entry)
+}
+
+// redeemVouchersTx pays a new order or sale with each of its vouchers
+func redeemVouchersTx(ctx context.Context, tx pgx.Tx, branchID int64, vouchers []models.VoucherRedemption, docType string, docID int64, docMemo string, date time.Time, deliveredBy int64) error {
+	for _, v := range vouchers {
+		if _, err := redeemVoucherTx(ctx, tx, branchID, v.Code, docType, docID, docMemo, date, deliveredBy, v.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// voucherTotal adds up what the vouchers pay; each must pay something and be
+// used once
+func voucherTotal(vouchers []models.VoucherRedemption) (money.Amount, error) {
+	var total money.Amount
+	seen := make(map[string]bool)
+	for _, v := range vouchers {
+		code := normalizeVoucherCode(v.Code)
+		if code == "" {
+			return 0, errors.New("voucher code is required")
+		}
+		if seen[code] {
+			return 0, fmt.Errorf("voucher %s is used more than once", code)
+		}
+		seen[code] = true
+		if v.Amount <= 0 {
+			return 0, fmt.Errorf("amount paid with voucher %s must be greater than zero", code)
+		}
+		total += v.Amount
+	}
+	return total, nil
+}
+
+// SellVoucher receives money into an account for a new voucher and holds it
+// as a liability until the voucher is redeemed.
+func (r *VoucherRepo) SellVoucher(ctx context.Context, req *models.VoucherSaleRequest) (*models.GiftVoucher, error) {
+	if req.FaceValue <= 0 {
+		return nil, errors.New("face value must be greater than zero")
+	}
+	v := &models.GiftVoucher{
+		Code:       normalizeVoucherCode(req.Code),
+		BranchID:   req.BranchID,
+		CustomerID: req.CustomerID,
+		FaceValue:  req.FaceValue,
+		Balance:    req.FaceValue,
+		IssuedOn:   req.SaleDate,
+		ExpiresOn:  req.SaleDate.AddDate(1, 0, 0),
+		Notes:      strings.TrimSpace(req.Notes),
+	}
+	if req.ExpiresOn != nil {
+		v.ExpiresOn = *req.ExpiresOn
+	}
+	if v.ExpiresOn.Before(v.IssuedOn) {
+		return nil, errors.New("a voucher cannot expire before it is sold")
+	}
+	if len(v.Code) > 30 {
+		return nil, errors.New("voucher code must be at most 30 characters")
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := EnsurePeriodOpenTx(ctx, tx, req.BranchID, req.SaleDate); err != nil {
+		return nil, err
+	}
+	sheet, err := accountTopSheet(ctx, tx, req.BranchID, req.AccountID, req.SaleDate, req.FaceValue)
+	if err != nil {
+		return nil, err
+	}
+	if v.MemoNo, err = NextMemoNoTx(ctx, tx, req.BranchID, models.MEMO_VOUCHER, req.SaleDate); err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// 1. The voucher, under a code not in use yet
+	// --------------------
+	for attempt := 0; ; attempt++ {
+		code := v.Code
+		if code == "" {
+			if code, err = newVoucherCode(); err != nil {
+				return nil, err
+			}
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO gift_vouchers(
+				code, branch_id, customer_id, face_value, balance, issued_on, expires_on, memo_no, notes
+			)
+			VALUES ($1,$2,$3,$4,$4,$5,$6,$7,$8)
+			ON CONFLICT (code) DO NOTHING
+			RETURNING id, created_at
+		`, code, v.BranchID, v.CustomerID, v.FaceValue, v.IssuedOn, v.ExpiresOn, v.MemoNo, v.Notes).Scan(&v.ID, &v.CreatedAt)
+		if err == nil {
+			v.Code = code
+			break
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("insert voucher failed: %w", err)
+		}
+		if v.Code != "" {
+			return nil, fmt.Errorf("voucher code %s is already in use", v.Code)
+		}
+		if attempt == 4 {
+			return nil, errors.New("could not find a free voucher code")
+		}
+	}
+
+	// --------------------
+	// 2. The money received
+	// --------------------
+	from, fromType := v.ID, models.ENTITY_VOUCHER
+	if v.CustomerID != nil {
+		from, fromType = *v.CustomerID, models.ENTITY_CUSTOMER
+	}
+	notes := v.Notes
+	if notes == "" {
+		notes = "Gift voucher " + v.Code + " sold"
+	}
+	transactionID, err := CreateTransactionTx(ctx, tx, &models.Transaction{
+		TransactionDate: req.SaleDate,
+		MemoNo:          v.MemoNo,
+		BranchID:        req.BranchID,
+		FromID:          from,
+		FromType:        fromType,
+		ToID:            req.AccountID,
+		ToType:          models.ENTITY_ACCOUNT,
+		Amount:          v.FaceValue,
+		TransactionType: models.ADVANCE_PAYMENT,
+		Notes:           notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE accounts SET current_balance = current_balance + $1 WHERE id = $2`, v.FaceValue, req.AccountID); err != nil {
+		return nil, fmt.Errorf("update account balance failed: %w", err)
+	}
+	if err := SaveTopSheetTx(tx, ctx, sheet); err != nil {
+		return nil, fmt.Errorf("save top sheet failed: %w", err)
+	}
+
+	err = postVoucherEntryTx(ctx, tx, &models.VoucherEntry{
+		VoucherID:     v.ID,
+		BranchID:      req.BranchID,
+		EntryDate:     req.SaleDate,
+		EntryType:     models.VOUCHER_ISSUE,
+		Amount:        v.FaceValue,
+		AccountID:     &req.AccountID,
+		TransactionID: &transactionID,
+		MemoNo:        v.MemoNo,
+		Notes:         notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	v.Status = voucherStatus(v, req.SaleDate)
+	return v, tx.Commit(ctx)
+}
+
+// GetVoucher looks a voucher up by its code, in any branch
+func (r *VoucherRepo) GetVoucher(ctx context.Context, code string) (*models.GiftVoucher, error) {
+	v := &models.GiftVoucher{}
+	err := r.db.QueryRow(ctx, `
+		SELECT v.id, v.code, v.branch_id, b.name, v.customer_id, v.face_value, v.balance,
+		       v.issued_on, v.expires_on, v.memo_no, v.notes, v.created_at
+		FROM gift_vouchers v
+		JOIN branches b ON b.id = v.branch_id
+		WHERE v.code = $1
+	`, normalizeVoucherCode(code)).Scan(&v.ID, &v.Code, &v.BranchID, &v.BranchName, &v.CustomerID, &v.FaceValue, &v.Balance,
+		&v.IssuedOn, &v.ExpiresOn, &v.MemoNo, &v.Notes, &v.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("voucher %s not found", normalizeVoucherCode(code))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load voucher failed: %w", err)
+	}
+	v.Status = voucherStatus(v, today())
+	return v, nil
+}
+
+// RedeemVoucher pays an order or sale of the branch already recorded with a
+// voucher. The document and the customer's due go down by amount.
+func (r *VoucherRepo) RedeemVoucher(ctx context.Context, req *models.VoucherRedeemRequest) (*models.VoucherEntry, error) {
+	if req.DocumentType != models.DOCUMENT_ORDER && req.DocumentType != models.DOCUMENT_SALE {
+		return nil, errors.New("document_type must be order or sale")
+	}
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := EnsurePeriodOpenTx(ctx, tx, req.BranchID, req.EntryDate); err != nil {
+		return nil, err
+	}
+
+	// --------------------
+	// 1. Lock the document
+	// --------------------
+	table := "orders"
+	if req.DocumentType == models.DOCUMENT_SALE {
+		table = "sales"
+	}
+	var (
+		memoNo                    string
+		status                    string
+		customerID, salespersonID int64
+		total, received           money.Amount
+	)
+	err = tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT memo_no, status, customer_id, salesperson_id, total_amount, received_amount
+		FROM %s
+		WHERE id = $1 AND branch_id = $2
+		FOR UPDATE
+	`, table), req.DocumentID, req.BranchID).Scan(&memoNo, &status, &customerID, &salespersonID, &total, &received)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%s %d not found in this branch", req.DocumentType, req.DocumentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock %s failed: %w", req.DocumentType, err)
+	}
+	if status == models.ORDER_CANCELLED || status == models.SALE_RETURNED {
+		return nil, fmt.Errorf("%s %s is %s", req.DocumentType, memoNo, status)
+	}
+	if req.Amount > total-received {
+		return nil, fmt.Errorf("voucher payment cannot exceed the %s due on %s %s", total-received, req.DocumentType, memoNo)
+	}
+
+	// --------------------
+	// 2. Pay it and raise what was received
+	// --------------------
+	entry, err := redeemVoucherTx(ctx, tx, req.BranchID, req.Code, req.DocumentType, req.DocumentID, memoNo,
+		req.EntryDate, salespersonID, req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if req.DocumentType == models.DOCUMENT_ORDER {
+		_, err = tx.Exec(ctx, `
+			UPDATE orders SET
+				received_amount = received_amount + $1,
+				status = CASE
+					WHEN delivered_products >= total_products AND received_amount + $1 >= total_amount THEN $2
+					ELSE status
+				END,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`, req.Amount, models.ORDER_DELIVERY, req.DocumentID)
+	} else {
+		_, err = tx.Exec(ctx, `
+			UPDATE sales SET received_amount = received_amount + $1, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2
+		`, req.Amount, req.DocumentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update %s failed: %w", req.DocumentType, err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE customers SET due_amount = due_amount - $1 WHERE id = $2`, req.Amount, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("update customer due failed: %w", err)
+	}
+	if err := syncLoyaltyTx(ctx, tx, req.DocumentType, req.DocumentID, req.EntryDate); err != nil {
+		return nil, err
+	}
+	return entry, tx.Commit(ctx)
+}
+
+// GetVoucherLedger lists the voucher movements booked in the branch between
+// start and end (inclusive), or those of one voucher in every branch when
+// code is given, with what was left on each voucher after the entry.
+func (r *VoucherRepo) GetVoucherLedger(ctx context.Context, branchID int64, code string, start, end time.Time) (*models.VoucherLedger, error) {
+	code = normalizeVoucherCode(code)
+	l := &models.VoucherLedger{
+		BranchID:  branchID,
+		Code:      code,
+		StartDate: start,
+		EndDate:   end,
+		Entries:   []*models.VoucherEntry{},
+	}
+
+	// one voucher anywhere, or the branch's share of every voucher; the
+	// running balance needs every entry of the vouchers listed
+	filter := "l.branch_id = $1"
+	vouchers := "l.voucher_id IN (SELECT voucher_id FROM voucher_ledger WHERE branch_id = $1)"
+	arg := any(branchID)
+	if code != "" {
+		filter, vouchers, arg = "v.code = $1", "v.code = $1", code
+		l.BranchID = 0
+	}
+
+	err := r.db.QueryRow(ctx, fmt.Sprintf(`
+		SELECT COALESCE(SUM(l.amount), 0)
+		FROM voucher_ledger l
+		JOIN gift_vouchers v ON v.id = l.voucher_id
+		WHERE %s AND l.entry_date < $2
+	`, filter), arg, start).Scan(&l.OpeningBalance)
+	if err != nil {
+		return nil, fmt.Errorf("load voucher opening balance failed: %w", err)
+	}
+
+	rows, err := r.db.Query(ctx, fmt.Sprintf(`
+		SELECT id, voucher_id, code, branch_id, entry_date, entry_type, amount,
+		       account_id, document_type, document_id, transaction_id, memo_no, notes, created_at, balance
+		FROM (
+			SELECT l.*, v.code,
+			       SUM(l.amount) OVER (PARTITION BY l.voucher_id ORDER BY l.entry_date, l.id) AS balance
+			FROM voucher_ledger l
+			JOIN gift_vouchers v ON v.id = l.voucher_id
+			WHERE %s
+		) l
+		WHERE entry_date BETWEEN $2 AND $3
+		ORDER BY entry_date, id
+	`, vouchers), arg, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("load voucher entries failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &models.VoucherEntry{}
+		err := rows.Scan(&e.ID, &e.VoucherID, &e.Code, &e.BranchID, &e.EntryDate, &e.EntryType, &e.Amount,
+			&e.AccountID, &e.DocumentType, &e.DocumentID, &e.TransactionID, &e.MemoNo, &e.Notes, &e.CreatedAt, &e.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("scan voucher entry failed: %w", err)
+		}
+		// the running balance covers every branch; the list only this one's entries
+		if code == "" && e.BranchID != branchID {
+			continue
+		}
+		if e.Amount > 0 {
+			l.Issued += e.Amount
+		} else {
+			l.Redeemed -= e.Amount
+		}
+		l.Entries = append(l.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("voucher entries rows failed: %w", err)
+	}
+	l.ClosingBalance = l.OpeningBalance + l.Issued - l.Redeemed
+	return l, nil
+}
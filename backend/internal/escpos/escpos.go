@@ -0,0 +1,308 @@
+// Package escpos writes receipts for ESC/POS thermal printers. ASCII text is
+// sent as printer text; text the printer cannot show, such as Arabic, is drawn
+// with a TrueType font and sent as a raster image.
+package escpos
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/projuktisheba/erp-mini-api/internal/font"
+)
+
+// Printable widths in dots of common paper rolls at 203 dpi
+const (
+	Paper80 = 576
+	Paper58 = 384
+)
+
+// Text alignment
+const (
+	AlignLeft = iota
+	AlignRight
+	AlignCenter
+)
+
+// Font A, the printer's default, is 12 by 24 dots
+const (
+	charWidth  = 12
+	charHeight = 24
+)
+
+// bandHeight is the most rows sent in one raster command; some printers have
+// small receive buffers
+const bandHeight = 128
+
+// Receipt is an ESC/POS byte stream under construction
+type Receipt struct {
+	buf           bytes.Buffer
+	dots          int
+	regular, bold *font.Font
+
+	align     int
+	emphasis  bool
+	twiceSize bool
+}
+
+// New starts a receipt for paper dots wide. Text the printer cannot show is
+// drawn with regular and bold; when regular is nil it prints as '?'. bold may
+// be nil to use regular.
+func New(dots int, regular, bold *font.Font) *Receipt {
+	if bold == nil {
+		bold = regular
+	}
+	r := &Receipt{dots: dots, regular: regular, bold: bold}
+	r.buf.Write([]byte{0x1b, '@'}) // initialize
+	return r
+}
+
+// Columns returns the characters that fit on a line at the current size
+func (r *Receipt) Columns() int {
+	return r.dots / (charWidth * r.scale())
+}
+
+func (r *Receipt) scale() int {
+	if r.twiceSize {
+		return 2
+	}
+	return 1
+}
+
+// Align sets the alignment of the following lines
+func (r *Receipt) Align(align int) {
+	r.align = align
+	n := byte(0)
+	switch align {
+	case AlignCenter:
+		n = 1
+	case AlignRight:
+		n = 2
+	}
+	r.buf.Write([]byte{0x1b, 'a', n})
+}
+
+// Bold turns emphasized text on or off
+func (r *Receipt) Bold(on bool) {
+	r.emphasis = on
+	r.buf.Write([]byte{0x1b, 'E', flag(on)})
+}
+
+// Large turns double width and height text on or off
+func (r *Receipt) Large(on bool) {
+	r.twiceSize = on
+	n := byte(0)
+	if on {
+		n = 0x11
+	}
+	r.buf.Write([]byte{0x1d, '!', n})
+}
+
+func flag(on bool) byte {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+// native reports whether the printer can show s as text
+func native(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// rasterFont returns the font text is drawn with, nil when there is none
+func (r *Receipt) rasterFont() *font.Font {
+	if r.emphasis {
+		return r.bold
+	}
+	return r.regular
+}
+
+func (r *Receipt) textSize() float64 {
+	return float64(charHeight * r.scale())
+}
+
+// ascii replaces what the printer cannot show with '?'
+func ascii(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c < 0x20 || c > 0x7e {
+			return '?'
+		}
+		return c
+	}, s)
+}
+
+// Text prints s, wrapped to the paper width at word boundaries
+func (r *Receipt) Text(s string) {
+	f := r.rasterFont()
+	if native(s) || f == nil {
+		for _, line := range wrap(ascii(s), r.Columns(), func(s string) int { return len(s) }) {
+			r.buf.WriteString(line)
+			r.buf.WriteByte('\n')
+		}
+		return
+	}
+	size := r.textSize()
+	for _, line := range wrap(s, r.dots, func(s string) int { return f.RenderWidth(s, size) }) {
+		glyphs := f.Render(line, size)
+		canvas := r.canvas(glyphs.Bounds().Dy())
+		x := 0
+		switch r.align {
+		case AlignCenter:
+			x = (r.dots - glyphs.Bounds().Dx()) / 2
+		case AlignRight:
+			x = r.dots - glyphs.Bounds().Dx()
+		}
+		draw.Draw(canvas, glyphs.Bounds().Add(image.Pt(max(0, x), 0)), glyphs, image.Point{}, draw.Src)
+		r.raster(canvas)
+	}
+}
+
+// Row prints left and right at the two ends of one line, cutting left short
+// when both do not fit
+func (r *Receipt) Row(left, right string) {
+	f := r.rasterFont()
+	if (native(left) && native(right)) || f == nil {
+		left, right = ascii(left), ascii(right)
+		cols := r.Columns()
+		room := max(0, cols-len(right)-1)
+		if len(left) > room {
+			left = left[:room]
+		}
+		r.buf.WriteString(left + strings.Repeat(" ", max(1, cols-len(left)-len(right))) + right + "\n")
+		return
+	}
+	size := r.textSize()
+	rightImg := f.Render(right, size)
+	room := r.dots - rightImg.Bounds().Dx() - charWidth
+	for left != "" && f.RenderWidth(left, size) > room {
+		_, n := utf8.DecodeLastRuneInString(left)
+		left = left[:len(left)-n]
+	}
+	leftImg := f.Render(left, size)
+	canvas := r.canvas(max(leftImg.Bounds().Dy(), rightImg.Bounds().Dy()))
+	draw.Draw(canvas, leftImg.Bounds(), leftImg, image.Point{}, draw.Src)
+	draw.Draw(canvas, rightImg.Bounds().Add(image.Pt(r.dots-rightImg.Bounds().Dx(), 0)), rightImg, image.Point{}, draw.Src)
+	r.raster(canvas)
+}
+
+// Rule prints a dashed line across the paper
+func (r *Receipt) Rule() {
+	r.buf.WriteString(strings.Repeat("-", r.Columns()) + "\n")
+}
+
+// Image prints img at the current alignment, no wider than the paper. Pixels
+// darker than mid gray print black.
+func (r *Receipt) Image(img image.Image) {
+	b := img.Bounds()
+	canvas := r.canvas(b.Dy())
+	x := 0
+	switch r.align {
+	case AlignCenter:
+		x = (r.dots - b.Dx()) / 2
+	case AlignRight:
+		x = r.dots - b.Dx()
+	}
+	draw.Draw(canvas, image.Rect(max(0, x), 0, max(0, x)+b.Dx(), b.Dy()), img, b.Min, draw.Src)
+	r.raster(canvas)
+}
+
+// canvas returns a white image as wide as the paper
+func (r *Receipt) canvas(height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, r.dots, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+// raster sends img with GS v 0, in bands of at most bandHeight rows. The
+// alignment is reset while it prints, since img already spans the paper.
+func (r *Receipt) raster(img *image.Gray) {
+	r.buf.Write([]byte{0x1b, 'a', 0})
+	width := (img.Rect.Dx() + 7) / 8
+	for top := 0; top < img.Rect.Dy(); top += bandHeight {
+		rows := min(bandHeight, img.Rect.Dy()-top)
+		r.buf.Write([]byte{0x1d, 'v', '0', 0, byte(width), byte(width >> 8), byte(rows), byte(rows >> 8)})
+		line := make([]byte, width)
+		for y := top; y < top+rows; y++ {
+			clear(line)
+			for x := 0; x < img.Rect.Dx(); x++ {
+				if img.GrayAt(x, y).Y < 0x80 {
+					line[x/8] |= 0x80 >> (x % 8)
+				}
+			}
+			r.buf.Write(line)
+		}
+	}
+	r.Align(r.align)
+}
+
+// QR prints data as a QR code, model 2 with medium error correction, module
+// dots wide per module. It uses the printer's own QR support.
+func (r *Receipt) QR(data string, module int) {
+	n := len(data) + 3
+	r.buf.Write([]byte{0x1d, '(', 'k', 4, 0, '1', 'A', '2', 0})                // model 2
+	r.buf.Write([]byte{0x1d, '(', 'k', 3, 0, '1', 'C', byte(min(16, module))}) // module size
+	r.buf.Write([]byte{0x1d, '(', 'k', 3, 0, '1', 'E', '1'})                   // error correction M
+	r.buf.Write([]byte{0x1d, '(', 'k', byte(n), byte(n >> 8), '1', 'P', '0'})  // store the data
+	r.buf.WriteString(data)
+	r.buf.Write([]byte{0x1d, '(', 'k', 3, 0, '1', 'Q', '0'}) // print it
+	r.buf.WriteByte('\n')
+}
+
+// Feed advances the paper n lines
+func (r *Receipt) Feed(n int) {
+	r.buf.Write([]byte{0x1b, 'd', byte(n)})
+}
+
+// Cut feeds the paper to the cutter and cuts it part way
+func (r *Receipt) Cut() {
+	r.buf.Write([]byte{0x1d, 'V', 66, 0})
+}
+
+// Bytes returns the stream written so far
+func (r *Receipt) Bytes() []byte {
+	return r.buf.Bytes()
+}
+
+// wrap breaks s into lines no wider than width as measured, breaking words
+// that are wider on their own
+func wrap(s string, width int, measure func(string) int) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			next := strings.TrimPrefix(line+" "+word, " ")
+			if measure(next) <= width {
+				line = next
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			line = word
+			for measure(line) > width && utf8.RuneCountInString(line) > 1 {
+				cut := len(line)
+				for cut > 0 && measure(line[:cut]) > width {
+					_, n := utf8.DecodeLastRuneInString(line[:cut])
+					cut -= n
+				}
+				if cut == 0 {
+					_, cut = utf8.DecodeRuneInString(line)
+				}
+				lines = append(lines, line[:cut])
+				line = line[cut:]
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
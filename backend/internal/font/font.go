@@ -0,0 +1,328 @@
+// Package font reads TrueType fonts for the printed documents: glyph lookup,
+// metrics, and the shaping Arabic text needs (joining forms and right-to-left
+// ordering), and subsetting for embedding. Any TrueType file with the needed
+// glyphs works, e.g. DejaVu Sans.
+package font
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// Font is a parsed TrueType font
+type Font struct {
+	data []byte
+
+	name       string
+	unitsPerEm int
+	bbox       [4]int // xMin, yMin, xMax, yMax in font units
+	ascent     int
+	descent    int
+	capHeight  int
+	italic     float64
+
+	numGlyphs int
+	advances  []uint16
+	cmap      map[rune]uint16
+
+	tables map[string][]byte
+	loca   []uint32 // start of each glyph in glyf, plus the end of the last
+}
+
+// Load reads and parses the TrueType file at path
+func Load(path string) (*Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read font failed: %w", err)
+	}
+	f, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+var errFormat = errors.New("not a supported TrueType font")
+
+// Parse parses a TrueType font file
+func Parse(data []byte) (*Font, error) {
+	if len(data) < 12 {
+		return nil, errFormat
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case 0x00010000, 0x74727565: // TrueType outlines ("true" on old Apple fonts)
+	default:
+		return nil, errFormat
+	}
+	tables := make(map[string][]byte)
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < n; i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, errFormat
+		}
+		tag := string(data[rec : rec+4])
+		off := int(binary.BigEndian.Uint32(data[rec+8:]))
+		length := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if off < 0 || length < 0 || off+length > len(data) {
+			return nil, fmt.Errorf("table %s is out of range", tag)
+		}
+		tables[tag] = data[off : off+length]
+	}
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "cmap"} {
+		if tables[tag] == nil {
+			return nil, fmt.Errorf("%w: missing %s table", errFormat, tag)
+		}
+	}
+
+	f := &Font{data: data, tables: tables}
+	head, hhea, maxp := tables["head"], tables["hhea"], tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 {
+		return nil, errFormat
+	}
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	if f.unitsPerEm == 0 {
+		return nil, errFormat
+	}
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	f.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	f.capHeight = f.ascent
+	if os2 := tables["OS/2"]; len(os2) >= 90 && binary.BigEndian.Uint16(os2) >= 2 {
+		f.capHeight = int(int16(binary.BigEndian.Uint16(os2[88:])))
+	}
+	if post := tables["post"]; len(post) >= 8 {
+		f.italic = float64(int32(binary.BigEndian.Uint32(post[4:]))) / 65536
+	}
+	f.numGlyphs = int(binary.BigEndian.Uint16(maxp[4:]))
+
+	// advance widths: the last one repeats for the remaining glyphs
+	hmtx := tables["hmtx"]
+	metrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if metrics == 0 || len(hmtx) < 4*metrics {
+		return nil, fmt.Errorf("%w: bad hmtx table", errFormat)
+	}
+	f.advances = make([]uint16, max(f.numGlyphs, metrics))
+	for i := range f.advances {
+		j := min(i, metrics-1)
+		f.advances[i] = binary.BigEndian.Uint16(hmtx[4*j:])
+	}
+
+	var err error
+	if f.cmap, err = parseCmap(tables["cmap"]); err != nil {
+		return nil, err
+	}
+	if f.loca, err = parseLoca(tables["loca"], len(tables["glyf"]), f.numGlyphs, int16(binary.BigEndian.Uint16(head[50:]))); err != nil {
+		return nil, err
+	}
+	f.name = postScriptName(tables["name"])
+	return f, nil
+}
+
+// parseCmap reads the Unicode character to glyph mapping, preferring the full
+// (format 12) table over the basic plane one (format 4)
+func parseCmap(t []byte) (map[rune]uint16, error) {
+	if len(t) < 4 {
+		return nil, errFormat
+	}
+	var best []byte
+	bestFormat := 0
+	n := int(binary.BigEndian.Uint16(t[2:]))
+	for i := 0; i < n; i++ {
+		rec := 4 + 8*i
+		if rec+8 > len(t) {
+			break
+		}
+		platform := binary.BigEndian.Uint16(t[rec:])
+		encoding := binary.BigEndian.Uint16(t[rec+2:])
+		off := int(binary.BigEndian.Uint32(t[rec+4:]))
+		if off+4 > len(t) {
+			continue
+		}
+		unicode := platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))
+		if !unicode {
+			continue
+		}
+		format := int(binary.BigEndian.Uint16(t[off:]))
+		if (format == 12 || format == 4) && format > bestFormat {
+			best, bestFormat = t[off:], format
+		}
+	}
+
+	m := make(map[rune]uint16)
+	switch bestFormat {
+	case 4:
+		if len(best) < 14 {
+			return nil, errFormat
+		}
+		segs := int(binary.BigEndian.Uint16(best[6:])) / 2
+		ends, starts := 14, 16+2*segs
+		deltas, offsets := starts+2*segs, starts+4*segs
+		if offsets+2*segs > len(best) {
+			return nil, fmt.Errorf("%w: bad cmap", errFormat)
+		}
+		for s := 0; s < segs; s++ {
+			end := int(binary.BigEndian.Uint16(best[ends+2*s:]))
+			start := int(binary.BigEndian.Uint16(best[starts+2*s:]))
+			delta := int(binary.BigEndian.Uint16(best[deltas+2*s:]))
+			rangeOff := int(binary.BigEndian.Uint16(best[offsets+2*s:]))
+			for c := start; c <= end && c != 0xffff; c++ {
+				var g int
+				if rangeOff == 0 {
+					g = (c + delta) & 0xffff
+				} else {
+					at := offsets + 2*s + rangeOff + 2*(c-start)
+					if at+2 > len(best) {
+						continue
+					}
+					if g = int(binary.BigEndian.Uint16(best[at:])); g != 0 {
+						g = (g + delta) & 0xffff
+					}
+				}
+				if g != 0 {
+					m[rune(c)] = uint16(g)
+				}
+			}
+		}
+	case 12:
+		if len(best) < 16 {
+			return nil, errFormat
+		}
+		groups := int(binary.BigEndian.Uint32(best[12:]))
+		if 16+12*groups > len(best) {
+			return nil, fmt.Errorf("%w: bad cmap", errFormat)
+		}
+		for i := 0; i < groups; i++ {
+			g := best[16+12*i:]
+			start := rune(binary.BigEndian.Uint32(g))
+			end := rune(binary.BigEndian.Uint32(g[4:]))
+			glyph := binary.BigEndian.Uint32(g[8:])
+			for c := start; c <= end && c-start < 0x10000; c++ {
+				m[c] = uint16(glyph + uint32(c-start))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: no unicode cmap", errFormat)
+	}
+	return m, nil
+}
+
+// parseLoca reads the glyph offsets; long is the indexToLocFormat of the head table
+func parseLoca(t []byte, glyfLen, numGlyphs int, long int16) ([]uint32, error) {
+	if t == nil || glyfLen == 0 {
+		return nil, fmt.Errorf("%w: no glyf outlines", errFormat)
+	}
+	loca := make([]uint32, numGlyphs+1)
+	for i := range loca {
+		if long == 1 {
+			if 4*i+4 > len(t) {
+				return nil, fmt.Errorf("%w: bad loca table", errFormat)
+			}
+			loca[i] = binary.BigEndian.Uint32(t[4*i:])
+		} else {
+			if 2*i+2 > len(t) {
+				return nil, fmt.Errorf("%w: bad loca table", errFormat)
+			}
+			loca[i] = 2 * uint32(binary.BigEndian.Uint16(t[2*i:]))
+		}
+		if int(loca[i]) > glyfLen || (i > 0 && loca[i] < loca[i-1]) {
+			return nil, fmt.Errorf("%w: bad loca table", errFormat)
+		}
+	}
+	return loca, nil
+}
+
+// glyph returns the outline data of a glyph, empty for blank glyphs
+func (f *Font) glyph(id uint16) []byte {
+	if int(id) >= f.numGlyphs {
+		return nil
+	}
+	return f.tables["glyf"][f.loca[id]:f.loca[id+1]]
+}
+
+// postScriptName returns name id 6 of the name table, or "Embedded"
+func postScriptName(t []byte) string {
+	if len(t) >= 6 {
+		count := int(binary.BigEndian.Uint16(t[2:]))
+		strOff := int(binary.BigEndian.Uint16(t[4:]))
+		for i := 0; i < count; i++ {
+			rec := 6 + 12*i
+			if rec+12 > len(t) {
+				break
+			}
+			platform := binary.BigEndian.Uint16(t[rec:])
+			id := binary.BigEndian.Uint16(t[rec+6:])
+			length := int(binary.BigEndian.Uint16(t[rec+8:]))
+			off := strOff + int(binary.BigEndian.Uint16(t[rec+10:]))
+			if id != 6 || off+length > len(t) {
+				continue
+			}
+			raw := t[off : off+length]
+			var s string
+			if platform == 1 {
+				s = string(raw)
+			} else {
+				u := make([]uint16, len(raw)/2)
+				for j := range u {
+					u[j] = binary.BigEndian.Uint16(raw[2*j:])
+				}
+				s = string(utf16.Decode(u))
+			}
+			if s = cleanName(s); s != "" {
+				return s
+			}
+		}
+	}
+	return "Embedded"
+}
+
+// cleanName keeps the characters allowed in a PDF name
+func cleanName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > ' ' && r < 127 && !strings.ContainsRune("()<>[]{}/%#", r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// Name returns the PostScript name of the font
+func (f *Font) Name() string { return f.name }
+
+// UnitsPerEm returns the size of the em square in font units
+func (f *Font) UnitsPerEm() int { return f.unitsPerEm }
+
+// BBox returns the bounding box of all glyphs (xMin, yMin, xMax, yMax) in font units
+func (f *Font) BBox() [4]int { return f.bbox }
+
+// Ascent, Descent and CapHeight are in font units; Descent is negative
+func (f *Font) Ascent() int    { return f.ascent }
+func (f *Font) Descent() int   { return f.descent }
+func (f *Font) CapHeight() int { return f.capHeight }
+
+// ItalicAngle returns the slant in degrees counter-clockwise from vertical
+func (f *Font) ItalicAngle() float64 { return f.italic }
+
+// GlyphIndex returns the glyph of r, or 0 (the missing glyph) if the font has none
+func (f *Font) GlyphIndex(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// HasGlyph reports whether the font can draw r
+func (f *Font) HasGlyph(r rune) bool {
+	return f.cmap[r] != 0
+}
+
+// Advance returns the advance width of a glyph in font units
+func (f *Font) Advance(glyph uint16) int {
+	if int(glyph) >= len(f.advances) {
+		return 0
+	}
+	return int(f.advances[glyph])
+}
@@ -0,0 +1,298 @@
+package font
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+	"sort"
+)
+
+type point struct{ x, y float64 }
+
+// curveSteps is the number of lines each quadratic curve is drawn with
+const curveSteps = 6
+
+// contours returns the outline of a glyph in font units, curves flattened to
+// lines. Composite glyphs are assembled from their parts.
+func (f *Font) contours(id uint16, depth int) [][]point {
+	g := f.glyph(id)
+	if len(g) < 10 || depth > 8 {
+		return nil
+	}
+	n := int(int16(binary.BigEndian.Uint16(g)))
+	if n < 0 {
+		return f.compositeContours(g, depth)
+	}
+
+	// simple glyph: contour ends, instructions, flags, then x and y deltas
+	p := 10
+	if p+2*n+2 > len(g) {
+		return nil
+	}
+	ends := make([]int, n)
+	for i := range ends {
+		ends[i] = int(binary.BigEndian.Uint16(g[p+2*i:]))
+	}
+	p += 2 * n
+	if n == 0 {
+		return nil
+	}
+	points := ends[n-1] + 1
+	p += 2 + int(binary.BigEndian.Uint16(g[p:]))
+
+	flags := make([]byte, 0, points)
+	for len(flags) < points && p < len(g) {
+		fl := g[p]
+		p++
+		flags = append(flags, fl)
+		if fl&0x08 != 0 && p < len(g) { // repeated
+			for r := int(g[p]); r > 0 && len(flags) < points; r-- {
+				flags = append(flags, fl)
+			}
+			p++
+		}
+	}
+	if len(flags) < points {
+		return nil
+	}
+	coords := func(short, same byte) []int {
+		out := make([]int, points)
+		v := 0
+		for i, fl := range flags {
+			switch {
+			case fl&short != 0:
+				if p >= len(g) {
+					return nil
+				}
+				d := int(g[p])
+				p++
+				if fl&same == 0 {
+					d = -d
+				}
+				v += d
+			case fl&same == 0:
+				if p+2 > len(g) {
+					return nil
+				}
+				v += int(int16(binary.BigEndian.Uint16(g[p:])))
+				p += 2
+			}
+			out[i] = v
+		}
+		return out
+	}
+	xs := coords(0x02, 0x10)
+	ys := coords(0x04, 0x20)
+	if xs == nil || ys == nil {
+		return nil
+	}
+
+	var out [][]point
+	start := 0
+	for _, end := range ends {
+		if end < start || end >= points {
+			break
+		}
+		out = append(out, flatten(xs[start:end+1], ys[start:end+1], flags[start:end+1]))
+		start = end + 1
+	}
+	return out
+}
+
+// compositeContours assembles a glyph from transformed parts
+func (f *Font) compositeContours(g []byte, depth int) [][]point {
+	var out [][]point
+	for p := 10; p+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[p:])
+		part := binary.BigEndian.Uint16(g[p+2:])
+		p += 4
+		var dx, dy float64
+		if flags&0x0001 != 0 { // arguments are words
+			if p+4 > len(g) {
+				break
+			}
+			dx, dy = float64(int16(binary.BigEndian.Uint16(g[p:]))), float64(int16(binary.BigEndian.Uint16(g[p+2:])))
+			p += 4
+		} else {
+			if p+2 > len(g) {
+				break
+			}
+			dx, dy = float64(int8(g[p])), float64(int8(g[p+1]))
+			p += 2
+		}
+		if flags&0x0002 == 0 { // arguments are point numbers; rare, drawn unshifted
+			dx, dy = 0, 0
+		}
+		f2dot14 := func(at int) float64 { return float64(int16(binary.BigEndian.Uint16(g[at:]))) / 16384 }
+		a, b, c, d := 1.0, 0.0, 0.0, 1.0
+		switch {
+		case flags&0x0008 != 0 && p+2 <= len(g):
+			a = f2dot14(p)
+			d = a
+			p += 2
+		case flags&0x0040 != 0 && p+4 <= len(g):
+			a, d = f2dot14(p), f2dot14(p+2)
+			p += 4
+		case flags&0x0080 != 0 && p+8 <= len(g):
+			a, b, c, d = f2dot14(p), f2dot14(p+2), f2dot14(p+4), f2dot14(p+6)
+			p += 8
+		}
+		for _, contour := range f.contours(part, depth+1) {
+			moved := make([]point, len(contour))
+			for i, pt := range contour {
+				moved[i] = point{a*pt.x + c*pt.y + dx, b*pt.x + d*pt.y + dy}
+			}
+			out = append(out, moved)
+		}
+		if flags&0x0020 == 0 { // no more components
+			break
+		}
+	}
+	return out
+}
+
+// flatten turns a contour of on- and off-curve points into a closed polyline.
+// Two off-curve points in a row imply an on-curve point between them.
+func flatten(xs, ys []int, flags []byte) []point {
+	n := len(xs)
+	mid := func(a, b point) point { return point{(a.x + b.x) / 2, (a.y + b.y) / 2} }
+
+	// start on an on-curve point; a contour without one starts between its last and first point
+	seq := make([]point, 0, n+1)
+	on := make([]bool, 0, n+1)
+	first := -1
+	for i := 0; i < n; i++ {
+		if flags[i]&0x01 != 0 {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		seq = append(seq, mid(point{float64(xs[n-1]), float64(ys[n-1])}, point{float64(xs[0]), float64(ys[0])}))
+		on = append(on, true)
+		first = 0
+	}
+	for k := 0; k < n; k++ {
+		i := (first + k) % n
+		seq = append(seq, point{float64(xs[i]), float64(ys[i])})
+		on = append(on, flags[i]&0x01 != 0)
+	}
+
+	out := []point{seq[0]}
+	cur := seq[0]
+	var ctrl *point
+	for k := 1; k <= len(seq); k++ {
+		pt, isOn := seq[0], true // back to the start
+		if k < len(seq) {
+			pt, isOn = seq[k], on[k]
+		}
+		if isOn {
+			if ctrl != nil {
+				out = appendCurve(out, cur, *ctrl, pt)
+				ctrl = nil
+			} else {
+				out = append(out, pt)
+			}
+			cur = pt
+			continue
+		}
+		if ctrl != nil {
+			m := mid(*ctrl, pt)
+			out = appendCurve(out, cur, *ctrl, m)
+			cur = m
+		}
+		c := pt
+		ctrl = &c
+	}
+	return out
+}
+
+func appendCurve(out []point, p0, c, p1 point) []point {
+	for s := 1; s <= curveSteps; s++ {
+		t := float64(s) / curveSteps
+		u := 1 - t
+		out = append(out, point{u*u*p0.x + 2*u*t*c.x + t*t*p1.x, u*u*p0.y + 2*u*t*c.y + t*t*p1.y})
+	}
+	return out
+}
+
+// oversample is the number of samples per pixel along each axis
+const oversample = 4
+
+// Render draws a line of text black on white, size pixels to the em. The
+// image is as wide as the text and as tall as the font's ascent plus descent.
+func (f *Font) Render(s string, size float64) *image.Gray {
+	scale := size / float64(f.unitsPerEm)
+	glyphs := f.Shape(s)
+	advance := 0
+	for _, g := range glyphs {
+		advance += g.Advance
+	}
+	w := max(1, int(math.Ceil(float64(advance)*scale)))
+	h := max(1, int(math.Ceil(float64(f.ascent-f.descent)*scale)))
+	baseline := float64(f.ascent) * scale
+
+	// edges in oversampled pixels, y down
+	type edge struct{ x0, y0, x1, y1 float64 }
+	var edges []edge
+	pen := 0.0
+	for _, g := range glyphs {
+		for _, c := range f.contours(g.ID, 0) {
+			for i := range c {
+				a, b := c[i], c[(i+1)%len(c)]
+				edges = append(edges, edge{
+					(pen + a.x*scale) * oversample, (baseline - a.y*scale) * oversample,
+					(pen + b.x*scale) * oversample, (baseline - b.y*scale) * oversample,
+				})
+			}
+		}
+		pen += float64(g.Advance) * scale
+	}
+
+	// fill each sample row by the non-zero winding rule, summing coverage per pixel
+	cover := make([]int, w*h)
+	type crossing struct {
+		x   float64
+		dir int
+	}
+	var xs []crossing
+	for sy := 0; sy < h*oversample; sy++ {
+		y := float64(sy) + 0.5
+		xs = xs[:0]
+		for _, e := range edges {
+			if e.y0 == e.y1 || (y < e.y0) == (y < e.y1) {
+				continue
+			}
+			dir := 1
+			if e.y1 < e.y0 {
+				dir = -1
+			}
+			xs = append(xs, crossing{e.x0 + (y-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), dir})
+		}
+		sort.Slice(xs, func(i, j int) bool { return xs[i].x < xs[j].x })
+		wind := 0
+		for i := 0; i+1 < len(xs); i++ {
+			wind += xs[i].dir
+			if wind == 0 {
+				continue
+			}
+			from := max(0, int(math.Round(xs[i].x)))
+			to := min(w*oversample, int(math.Round(xs[i+1].x)))
+			row := (sy / oversample) * w
+			for sx := from; sx < to; sx++ {
+				cover[row+sx/oversample]++
+			}
+		}
+	}
+
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i, c := range cover {
+		img.Pix[i] = 255 - uint8(min(255, c*255/(oversample*oversample)))
+	}
+	return img
+}
+
+// RenderWidth returns the width in pixels of s rendered at size
+func (f *Font) RenderWidth(s string, size float64) int {
+	return int(math.Ceil(float64(f.Width(s)) * size / float64(f.unitsPerEm)))
+}
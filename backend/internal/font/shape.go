@@ -0,0 +1,350 @@
+package font
+
+import "unicode"
+
+// Glyph is one glyph of shaped text
+type Glyph struct {
+	ID      uint16
+	Rune    rune // the character drawn, after choosing its joining form
+	Advance int  // in font units
+}
+
+// Shape returns the glyphs of a line of text in the order they are drawn,
+// left to right. Arabic letters take their joined forms and right-to-left
+// runs are reversed. The ordering follows the Unicode bidi algorithm for a
+// single paragraph without explicit embeddings, which covers names, labels
+// and amounts on printed documents.
+func (f *Font) Shape(s string) []Glyph {
+	runes := f.join([]rune(s))
+	order, levels := reorder(runes)
+	glyphs := make([]Glyph, 0, len(order))
+	for i, idx := range order {
+		r := runes[idx]
+		if r >= 0x200b && r <= 0x200f { // zero width and direction marks
+			continue
+		}
+		if levels[i]%2 == 1 {
+			if m, ok := mirrors[r]; ok {
+				r = m
+			}
+		}
+		id := f.GlyphIndex(r)
+		glyphs = append(glyphs, Glyph{ID: id, Rune: r, Advance: f.Advance(id)})
+	}
+	return glyphs
+}
+
+// Width returns the advance width of s in font units
+func (f *Font) Width(s string) int {
+	w := 0
+	for _, g := range f.Shape(s) {
+		w += g.Advance
+	}
+	return w
+}
+
+// arabicForms holds the presentation forms of the Arabic letters: isolated,
+// final, initial and medial. Letters that only join the letter before them
+// have no initial or medial form; hamza joins neither side.
+var arabicForms = map[rune][4]rune{
+	0x0621: {0xfe80, 0, 0, 0},                // hamza
+	0x0622: {0xfe81, 0xfe82, 0, 0},           // alef with madda
+	0x0623: {0xfe83, 0xfe84, 0, 0},           // alef with hamza above
+	0x0624: {0xfe85, 0xfe86, 0, 0},           // waw with hamza
+	0x0625: {0xfe87, 0xfe88, 0, 0},           // alef with hamza below
+	0x0626: {0xfe89, 0xfe8a, 0xfe8b, 0xfe8c}, // yeh with hamza
+	0x0627: {0xfe8d, 0xfe8e, 0, 0},           // alef
+	0x0628: {0xfe8f, 0xfe90, 0xfe91, 0xfe92}, // beh
+	0x0629: {0xfe93, 0xfe94, 0, 0},           // teh marbuta
+	0x062a: {0xfe95, 0xfe96, 0xfe97, 0xfe98}, // teh
+	0x062b: {0xfe99, 0xfe9a, 0xfe9b, 0xfe9c}, // theh
+	0x062c: {0xfe9d, 0xfe9e, 0xfe9f, 0xfea0}, // jeem
+	0x062d: {0xfea1, 0xfea2, 0xfea3, 0xfea4}, // hah
+	0x062e: {0xfea5, 0xfea6, 0xfea7, 0xfea8}, // khah
+	0x062f: {0xfea9, 0xfeaa, 0, 0},           // dal
+	0x0630: {0xfeab, 0xfeac, 0, 0},           // thal
+	0x0631: {0xfead, 0xfeae, 0, 0},           // reh
+	0x0632: {0xfeaf, 0xfeb0, 0, 0},           // zain
+	0x0633: {0xfeb1, 0xfeb2, 0xfeb3, 0xfeb4}, // seen
+	0x0634: {0xfeb5, 0xfeb6, 0xfeb7, 0xfeb8}, // sheen
+	0x0635: {0xfeb9, 0xfeba, 0xfebb, 0xfebc}, // sad
+	0x0636: {0xfebd, 0xfebe, 0xfebf, 0xfec0}, // dad
+	0x0637: {0xfec1, 0xfec2, 0xfec3, 0xfec4}, // tah
+	0x0638: {0xfec5, 0xfec6, 0xfec7, 0xfec8}, // zah
+	0x0639: {0xfec9, 0xfeca, 0xfecb, 0xfecc}, // ain
+	0x063a: {0xfecd, 0xfece, 0xfecf, 0xfed0}, // ghain
+	0x0640: {0x0640, 0x0640, 0x0640, 0x0640}, // tatweel
+	0x0641: {0xfed1, 0xfed2, 0xfed3, 0xfed4}, // feh
+	0x0642: {0xfed5, 0xfed6, 0xfed7, 0xfed8}, // qaf
+	0x0643: {0xfed9, 0xfeda, 0xfedb, 0xfedc}, // kaf
+	0x0644: {0xfedd, 0xfede, 0xfedf, 0xfee0}, // lam
+	0x0645: {0xfee1, 0xfee2, 0xfee3, 0xfee4}, // meem
+	0x0646: {0xfee5, 0xfee6, 0xfee7, 0xfee8}, // noon
+	0x0647: {0xfee9, 0xfeea, 0xfeeb, 0xfeec}, // heh
+	0x0648: {0xfeed, 0xfeee, 0, 0},           // waw
+	0x0649: {0xfeef, 0xfef0, 0, 0},           // alef maksura
+	0x064a: {0xfef1, 0xfef2, 0xfef3, 0xfef4}, // yeh
+	0x067e: {0xfb56, 0xfb57, 0xfb58, 0xfb59}, // peh
+	0x0686: {0xfb7a, 0xfb7b, 0xfb7c, 0xfb7d}, // tcheh
+	0x0698: {0xfb8a, 0xfb8b, 0, 0},           // jeh
+	0x06a9: {0xfb8e, 0xfb8f, 0xfb90, 0xfb91}, // keheh
+	0x06af: {0xfb92, 0xfb93, 0xfb94, 0xfb95}, // gaf
+	0x06cc: {0xfbfc, 0xfbfd, 0xfbfe, 0xfbff}, // farsi yeh
+}
+
+// lamAlef holds the isolated and final ligature of lam followed by an alef
+var lamAlef = map[rune][2]rune{
+	0x0622: {0xfef5, 0xfef6},
+	0x0623: {0xfef7, 0xfef8},
+	0x0625: {0xfef9, 0xfefa},
+	0x0627: {0xfefb, 0xfefc},
+}
+
+func isMark(r rune) bool {
+	return unicode.Is(unicode.Mn, r)
+}
+
+// join replaces Arabic letters by the form that connects them to their
+// neighbours. Forms the font cannot draw are left as the plain letter.
+func (f *Font) join(in []rune) []rune {
+	out := make([]rune, 0, len(in))
+	prevJoins := false // the letter before connects to the next one
+	for i := 0; i < len(in); i++ {
+		r := in[i]
+		forms, ok := arabicForms[r]
+		if !ok {
+			if !isMark(r) && r != 0x200d {
+				prevJoins = false
+			}
+			out = append(out, r)
+			continue
+		}
+		prevJoins = prevJoins && forms[1] != 0
+
+		next := i + 1
+		for next < len(in) && isMark(in[next]) {
+			next++
+		}
+		if r == 0x0644 && next == i+1 && next < len(in) {
+			if lig, ok := lamAlef[in[next]]; ok {
+				form := lig[0]
+				if prevJoins {
+					form = lig[1]
+				}
+				if f.HasGlyph(form) {
+					out = append(out, form)
+					prevJoins = false
+					i = next
+					continue
+				}
+			}
+		}
+
+		nextJoins := false
+		if forms[2] != 0 && next < len(in) {
+			if nf, ok := arabicForms[in[next]]; ok && nf[1] != 0 {
+				nextJoins = true
+			}
+		}
+		form := forms[0]
+		switch {
+		case prevJoins && nextJoins:
+			form = forms[3]
+		case prevJoins:
+			form = forms[1]
+		case nextJoins:
+			form = forms[2]
+		}
+		if !f.HasGlyph(form) {
+			form = r
+		}
+		out = append(out, form)
+		prevJoins = forms[2] != 0
+	}
+	return out
+}
+
+// bidi classes, simplified
+const (
+	classN   = iota // neutral: spaces, punctuation
+	classL          // left-to-right letters
+	classR          // right-to-left letters
+	classEN         // digits
+	classCS         // separators inside numbers
+	classNSM        // combining marks
+)
+
+func bidiClass(r rune) int {
+	switch {
+	case isMark(r):
+		return classNSM
+	case r >= '0' && r <= '9', r >= 0x0660 && r <= 0x0669, r >= 0x06f0 && r <= 0x06f9:
+		return classEN
+	case r == '.' || r == ',' || r == ':' || r == '/' || r == '-' || r == '+':
+		return classCS
+	case unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana):
+		return classR
+	case unicode.IsLetter(r):
+		return classL
+	}
+	return classN
+}
+
+// mirrors swaps paired punctuation drawn inside right-to-left runs
+var mirrors = map[rune]rune{
+	'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{',
+	'<': '>', '>': '<', '«': '»', '»': '«',
+}
+
+// reorder returns the visual order of runes, left to right, and the embedding
+// level of each position (odd levels run right to left)
+func reorder(runes []rune) (order []int, levels []int) {
+	n := len(runes)
+	cls := make([]int, n)
+	for i, r := range runes {
+		cls[i] = bidiClass(r)
+	}
+
+	// paragraph direction: the first strong letter
+	base := 0
+	for _, c := range cls {
+		if c == classL {
+			break
+		}
+		if c == classR {
+			base = 1
+			break
+		}
+	}
+	sos := classL
+	if base == 1 {
+		sos = classR
+	}
+
+	// marks take the class of the character they sit on
+	for i := range cls {
+		if cls[i] == classNSM {
+			if i == 0 {
+				cls[i] = sos
+			} else {
+				cls[i] = cls[i-1]
+			}
+		}
+	}
+	// a separator between two digits is part of the number; others are neutral
+	for i := range cls {
+		if cls[i] == classCS {
+			if i > 0 && i+1 < n && cls[i-1] == classEN && cls[i+1] == classEN {
+				cls[i] = classEN
+			} else {
+				cls[i] = classN
+			}
+		}
+	}
+	// digits after left-to-right text are left-to-right text
+	last := sos
+	for i, c := range cls {
+		switch c {
+		case classL, classR:
+			last = c
+		case classEN:
+			if last == classL {
+				cls[i] = classL
+			}
+		}
+	}
+	// neutrals take the direction of their neighbours when both agree
+	strong := func(c int) int {
+		if c == classEN {
+			return classR
+		}
+		return c
+	}
+	for i := 0; i < n; {
+		if cls[i] != classN {
+			i++
+			continue
+		}
+		j := i
+		for j < n && cls[j] == classN {
+			j++
+		}
+		before, after := sos, sos
+		if i > 0 {
+			before = strong(cls[i-1])
+		}
+		if j < n {
+			after = strong(cls[j])
+		}
+		dir := sos
+		if before == after {
+			dir = before
+		}
+		for k := i; k < j; k++ {
+			cls[k] = dir
+		}
+		i = j
+	}
+
+	levels = make([]int, n)
+	for i, c := range cls {
+		switch {
+		case c == classR:
+			levels[i] = 1
+		case c == classEN:
+			levels[i] = 2
+		case base == 1: // left-to-right text inside a right-to-left line
+			levels[i] = 2
+		}
+	}
+	// trailing spaces stay at the paragraph level
+	for i := n - 1; i >= 0 && unicode.IsSpace(runes[i]); i-- {
+		levels[i] = base
+	}
+
+	// reverse every run at each level from the highest down to 1
+	order = make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	top := 0
+	for _, l := range levels {
+		top = max(top, l)
+	}
+	levels = append([]int(nil), levels...)
+	for lvl := top; lvl >= 1; lvl-- {
+		for i := 0; i < n; {
+			if levels[i] < lvl {
+				i++
+				continue
+			}
+			j := i
+			for j < n && levels[j] >= lvl {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+				levels[a], levels[b] = levels[b], levels[a]
+			}
+			i = j
+		}
+	}
+
+	// reversed runs put marks before their letter; draw them after it
+	for i := 0; i < n; i++ {
+		if levels[i]%2 == 0 || !isMark(runes[order[i]]) {
+			continue
+		}
+		j := i
+		for j < n && isMark(runes[order[j]]) {
+			j++
+		}
+		if j < n {
+			letter := order[j]
+			copy(order[i+1:j+1], order[i:j])
+			order[i] = letter
+		}
+		i = j
+	}
+	return order, levels
+}
@@ -0,0 +1,130 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// tables kept in a subset: what a PDF reader needs to draw glyphs by id
+var subsetTables = []string{"cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "prep"}
+
+// components returns the glyphs a composite glyph is built from
+func (f *Font) components(id uint16) []uint16 {
+	g := f.glyph(id)
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+	var out []uint16
+	for p := 10; p+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[p:])
+		out = append(out, binary.BigEndian.Uint16(g[p+2:]))
+		p += 4
+		if flags&0x0001 != 0 { // arguments are words
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&0x0008 != 0: // one scale
+			p += 2
+		case flags&0x0040 != 0: // x and y scale
+			p += 4
+		case flags&0x0080 != 0: // 2x2 matrix
+			p += 8
+		}
+		if flags&0x0020 == 0 { // no more components
+			break
+		}
+	}
+	return out
+}
+
+// Subset returns a copy of the font file keeping only the outlines of the
+// given glyphs (and the glyphs they are built from). Glyph ids stay the same,
+// so text drawn by glyph id looks as with the full font.
+func (f *Font) Subset(glyphs []uint16) []byte {
+	keep := map[uint16]bool{0: true}
+	queue := append([]uint16(nil), glyphs...)
+	for len(queue) > 0 {
+		id := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if keep[id] || int(id) >= f.numGlyphs {
+			continue
+		}
+		keep[id] = true
+		queue = append(queue, f.components(id)...)
+	}
+
+	var glyf bytes.Buffer
+	loca := make([]byte, 4*(f.numGlyphs+1))
+	for id := 0; id < f.numGlyphs; id++ {
+		binary.BigEndian.PutUint32(loca[4*id:], uint32(glyf.Len()))
+		if keep[uint16(id)] {
+			glyf.Write(f.glyph(uint16(id)))
+			for glyf.Len()%4 != 0 {
+				glyf.WriteByte(0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*f.numGlyphs:], uint32(glyf.Len()))
+
+	head := append([]byte(nil), f.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0)  // checkSumAdjustment, set below
+	binary.BigEndian.PutUint16(head[50:], 1) // long loca offsets
+
+	tables := map[string][]byte{"glyf": glyf.Bytes(), "loca": loca, "head": head}
+	var tags []string
+	for _, tag := range subsetTables {
+		if tables[tag] == nil && f.tables[tag] != nil {
+			tables[tag] = f.tables[tag]
+		}
+		if tables[tag] != nil {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	// table directory, then the tables on 4 byte boundaries
+	n := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, []uint32{0x00010000})
+	binary.Write(&out, binary.BigEndian, []uint16{
+		uint16(n), uint16(16 << entrySelector), uint16(entrySelector), uint16(16*n - 16<<entrySelector),
+	})
+	offset := 12 + 16*n
+	for _, tag := range tags {
+		t := tables[tag]
+		out.WriteString(tag)
+		binary.Write(&out, binary.BigEndian, []uint32{checksum(t), uint32(offset), uint32(len(t))})
+		offset += (len(t) + 3) &^ 3
+	}
+	headAt := 0
+	for _, tag := range tags {
+		if tag == "head" {
+			headAt = out.Len()
+		}
+		out.Write(tables[tag])
+		for out.Len()%4 != 0 {
+			out.WriteByte(0)
+		}
+	}
+	data := out.Bytes()
+	binary.BigEndian.PutUint32(data[headAt+8:], 0xb1b0afba-checksum(data))
+	return data
+}
+
+// checksum is the TrueType table checksum: the sum of its big-endian words
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var w [4]byte
+		copy(w[:], b[i:])
+		sum += binary.BigEndian.Uint32(w[:])
+	}
+	return sum
+}
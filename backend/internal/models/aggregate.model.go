@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// AggregateDiff is one counter whose stored value differs from the value recomputed from source documents.
+// Money fields fill Current and Rebuilt, count fields CurrentCount and RebuiltCount.
+type AggregateDiff struct {
+	Table        string        `json:"table"` // top_sheet | employees_progress
+	SheetDate    time.Time     `json:"sheet_date"`
+	EmployeeID   int64         `json:"employee_id,omitempty"`
+	Field        string        `json:"field"`
+	Current      *money.Amount `json:"current,omitempty"`
+	Rebuilt      *money.Amount `json:"rebuilt,omitempty"`
+	CurrentCount *int64        `json:"current_count,omitempty"`
+	RebuiltCount *int64        `json:"rebuilt_count,omitempty"`
+}
+
+// AggregateRebuildResult summarises a top_sheet / employees_progress rebuild
+type AggregateRebuildResult struct {
+	BranchID             int64            `json:"branch_id"`
+	StartDate            time.Time        `json:"start_date"`
+	EndDate              time.Time        `json:"end_date"`
+	Applied              bool             `json:"applied"`
+	TopSheetRows         int              `json:"top_sheet_rows"`
+	EmployeeProgressRows int              `json:"employee_progress_rows"`
+	Diffs                []*AggregateDiff `json:"diffs"`
+}
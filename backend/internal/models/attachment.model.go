@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Entities an attachment can be linked to
+const (
+	ATTACHMENT_ORDER      = "order"
+	ATTACHMENT_ORDER_ITEM = "order_item"
+	ATTACHMENT_CUSTOMER   = "customer"
+	ATTACHMENT_PURCHASE   = "purchase"
+	ATTACHMENT_EXPENSE    = "expense" // an expense transaction, by transaction_id
+)
+
+// Attachment is an uploaded file (design photo, fabric, receipt) linked to a
+// document or customer. The file itself is fetched through DownloadURL.
+type Attachment struct {
+	ID           int64     `json:"id"`
+	BranchID     int64     `json:"branch_id"`
+	EntityType   string    `json:"entity_type"`
+	EntityID     int64     `json:"entity_id"`
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	Caption      string    `json:"caption"`
+	UploadedBy   *int64    `json:"uploaded_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	DownloadURL  string    `json:"download_url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+
+	StoragePath string  `json:"-"`
+	ThumbPath   *string `json:"-"`
+}
+
+// AttachmentUsage is the space a branch's attachments take against its quota
+type AttachmentUsage struct {
+	BranchID   int64 `json:"branch_id"`
+	Files      int64 `json:"files"`
+	UsedBytes  int64 `json:"used_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"`
+}
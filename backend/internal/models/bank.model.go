@@ -0,0 +1,104 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+const (
+	BANK_FORMAT_CSV     = "csv"
+	BANK_FORMAT_OFX     = "ofx"
+	BANK_FORMAT_CAMT053 = "camt053"
+)
+
+const (
+	BANK_LINE_UNMATCHED = "unmatched"
+	BANK_LINE_MATCHED   = "matched"
+	BANK_LINE_CREATED   = "created"
+	BANK_LINE_IGNORED   = "ignored"
+)
+
+// BankCSVMapping describes how the columns of a bank's CSV export map to statement fields.
+// Columns are referenced by header name, or by 1-based position when HasHeader is false.
+type BankCSVMapping struct {
+	ID              int64  `json:"id"`
+	BranchID        int64  `json:"branch_id"`
+	AccountID       *int64 `json:"account_id,omitempty"`
+	Name            string `json:"name"`
+	DateColumn      string `json:"date_column"`
+	AmountColumn    string `json:"amount_column"`
+	DebitColumn     string `json:"debit_column"`
+	CreditColumn    string `json:"credit_column"`
+	MemoColumn      string `json:"memo_column"`
+	ReferenceColumn string `json:"reference_column"`
+	DateFormat      string `json:"date_format"`
+	Delimiter       string `json:"delimiter"`
+	// DecimalSeparator is "." (1,234.50) or "," (1.234,50); the other one groups thousands
+	DecimalSeparator string    `json:"decimal_separator"`
+	HasHeader        bool      `json:"has_header"`
+	SkipRows         int       `json:"skip_rows"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// BankStatement is the header of an imported statement file
+type BankStatement struct {
+	ID             int64         `json:"id"`
+	BranchID       int64         `json:"branch_id"`
+	AccountID      int64         `json:"account_id"`
+	AccountName    string        `json:"account_name"`
+	Format         string        `json:"format"`
+	FileName       string        `json:"file_name"`
+	PeriodStart    time.Time     `json:"period_start"`
+	PeriodEnd      time.Time     `json:"period_end"`
+	OpeningBalance *money.Amount `json:"opening_balance"`
+	ClosingBalance *money.Amount `json:"closing_balance"`
+	LineCount      int64         `json:"line_count"`
+	MatchedCount   int64         `json:"matched_count"`
+	UnmatchedCount int64         `json:"unmatched_count"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// BankStatementLine is a single movement from a bank statement.
+// Amount is signed: positive for money in, negative for money out.
+type BankStatementLine struct {
+	ID            int64        `json:"id"`
+	StatementID   int64        `json:"statement_id"`
+	AccountID     int64        `json:"account_id"`
+	LineNo        int          `json:"line_no"`
+	TxnDate       time.Time    `json:"txn_date"`
+	Amount        money.Amount `json:"amount"`
+	Memo          string       `json:"memo"`
+	Reference     string       `json:"reference"`
+	Status        string       `json:"status"`
+	TransactionID *int64       `json:"transaction_id"`
+	MatchMethod   string       `json:"match_method"`
+}
+
+// BankReconciliationReport compares the book side of a bank account with its imported statements
+type BankReconciliationReport struct {
+	AccountID   int64     `json:"account_id"`
+	AccountName string    `json:"account_name"`
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
+
+	BookOpeningBalance money.Amount `json:"book_opening_balance"`
+	BookInflow         money.Amount `json:"book_inflow"`
+	BookOutflow        money.Amount `json:"book_outflow"`
+	BookClosingBalance money.Amount `json:"book_closing_balance"`
+
+	StatementInflow         money.Amount  `json:"statement_inflow"`
+	StatementOutflow        money.Amount  `json:"statement_outflow"`
+	StatementClosingBalance *money.Amount `json:"statement_closing_balance"`
+
+	MatchedCount     int64        `json:"matched_count"`
+	MatchedAmount    money.Amount `json:"matched_amount"`
+	UnmatchedLineSum money.Amount `json:"unmatched_line_sum"`
+	UnmatchedBookSum money.Amount `json:"unmatched_book_sum"`
+	// Difference is statement closing minus book closing; zero when reconciled
+	Difference *money.Amount `json:"difference"`
+
+	UnmatchedLines        []*BankStatementLine `json:"unmatched_lines"`
+	UnmatchedTransactions []*Transaction       `json:"unmatched_transactions"`
+}
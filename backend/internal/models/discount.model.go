@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// Kinds of discount
+const (
+	DISCOUNT_PERCENT = "percent" // Value is a percentage, e.g. 12.5 for 12.5%
+	DISCOUNT_FIXED   = "fixed"   // Value is an amount off
+)
+
+// Discount is a reduction of a price, either a percentage of it or a fixed amount
+type Discount struct {
+	Type  string       `json:"type"`
+	Value money.Amount `json:"value"`
+}
+
+// DiscountApproval is a manager's approval of discounts above the branch threshold
+type DiscountApproval struct {
+	ApprovedBy int64  `json:"approved_by"` // set from the signed-in user
+	Reason     string `json:"reason"`
+}
+
+// DocumentDiscounts are the discounts of an order or sale. Line discounts are
+// given on the items; the document discount and then the promotion apply to
+// what is left after them. Without any discount the total amount is taken as
+// sent; with one it is worked out from the item subtotals.
+type DocumentDiscounts struct {
+	GrossAmount money.Amount `json:"gross_amount"` // the items before any discount
+
+	Discount    *Discount `json:"discount,omitempty"`     // given by staff on the whole document
+	PromotionID *int64    `json:"promotion_id,omitempty"` // taken from the coupon when one is used
+	CouponCode  string    `json:"coupon_code,omitempty"`
+	CouponID    *int64    `json:"coupon_id,omitempty"`
+
+	LineDiscount      money.Amount `json:"line_discount"`
+	DocumentDiscount  money.Amount `json:"document_discount"`
+	PromotionDiscount money.Amount `json:"promotion_discount"`
+	DiscountAmount    money.Amount `json:"discount_amount"` // all discounts together
+
+	// required when the discounts given by hand go over the branch threshold
+	DiscountApproval *DiscountApproval `json:"discount_approval,omitempty"`
+}
+
+// Promotion is a named discount that runs between two dates, in one branch or all of them
+type Promotion struct {
+	ID             int64        `json:"id"`
+	BranchID       *int64       `json:"branch_id"` // nil runs in every branch
+	Name           string       `json:"name"`
+	DiscountType   string       `json:"discount_type"`
+	DiscountValue  money.Amount `json:"discount_value"`
+	StartsOn       time.Time    `json:"starts_on"`
+	EndsOn         time.Time    `json:"ends_on"`
+	RequiresCoupon bool         `json:"requires_coupon"` // only given against one of its coupon codes
+	Active         bool         `json:"active"`
+	CreatedBy      *int64       `json:"created_by,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	Coupons        []*Coupon    `json:"coupons,omitempty"`
+}
+
+// Coupon is a code that gives the discount of its promotion; nil limits are unlimited
+type Coupon struct {
+	ID                 int64     `json:"id"`
+	PromotionID        int64     `json:"promotion_id"`
+	Code               string    `json:"code"`
+	MaxUses            *int      `json:"max_uses"`
+	MaxUsesPerCustomer *int      `json:"max_uses_per_customer"`
+	UsedCount          int       `json:"used_count"`
+	Active             bool      `json:"active"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// DiscountTotals are the gross, discount and net amounts of a set of documents
+type DiscountTotals struct {
+	Documents         int64        `json:"documents"`
+	GrossAmount       money.Amount `json:"gross_amount"`
+	LineDiscount      money.Amount `json:"line_discount"`
+	DocumentDiscount  money.Amount `json:"document_discount"`
+	PromotionDiscount money.Amount `json:"promotion_discount"`
+	DiscountAmount    money.Amount `json:"discount_amount"`
+	NetAmount         money.Amount `json:"net_amount"`
+}
+
+// PromotionUsage is what one promotion gave away in a period
+type PromotionUsage struct {
+	PromotionID    int64        `json:"promotion_id"`
+	Name           string       `json:"name"`
+	Documents      int64        `json:"documents"`
+	CouponUses     int64        `json:"coupon_uses"`
+	DiscountAmount money.Amount `json:"discount_amount"`
+}
+
+// DiscountReport shows gross, discount and net sales of a branch for a period,
+// for ready-made sales and orders by the date they were made
+type DiscountReport struct {
+	BranchID   int64             `json:"branch_id"`
+	StartDate  time.Time         `json:"start_date"`
+	EndDate    time.Time         `json:"end_date"`
+	Sales      DiscountTotals    `json:"sales"`
+	Orders     DiscountTotals    `json:"orders"`
+	Total      DiscountTotals    `json:"total"`
+	Approved   int64             `json:"approved"` // documents with a manager's discount approval
+	Promotions []*PromotionUsage `json:"promotions"`
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ExpenseLine is the total of one expense category
+type ExpenseLine struct {
+	Category string       `json:"category"`
+	Amount   money.Amount `json:"amount"`
+}
+
+// ProfitAndLossPeriod is an accrual-basis income statement for one period
+type ProfitAndLossPeriod struct {
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+
+	// Revenue
+	SalesRevenue money.Amount `json:"sales_revenue"` // ready-made sales by sale date
+	OrderRevenue money.Amount `json:"order_revenue"` // order value recognised as items are delivered
+	GrossSales   money.Amount `json:"gross_sales"`   // revenue before discounts
+	Discounts    money.Amount `json:"discounts"`     // given on the revenue
+	TotalRevenue money.Amount `json:"total_revenue"` // net sales
+
+	// Cost of goods
+	MaterialCost  money.Amount `json:"material_cost"`  // purchases in the material category
+	StockCost     money.Amount `json:"stock_cost"`     // sold ready-made units x product unit cost
+	UncostedUnits int64        `json:"uncosted_units"` // sold units whose product has no unit cost
+	CostOfGoods   money.Amount `json:"cost_of_goods"`
+	GrossProfit   money.Amount `json:"gross_profit"`
+
+	// Operating expenses
+	Expenses      []*ExpenseLine `json:"expenses"`
+	TotalExpenses money.Amount   `json:"total_expenses"`
+	Salaries      money.Amount   `json:"salaries"` // salaries and advances paid to employees
+
+	NetProfit money.Amount `json:"net_profit"`
+}
+
+// ProfitAndLoss compares a period with the one of equal length right before it.
+// BranchID 0 is the consolidated statement of all branches.
+type ProfitAndLoss struct {
+	BranchID           int64                `json:"branch_id"`
+	BranchName         string               `json:"branch_name"`
+	Current            *ProfitAndLossPeriod `json:"current"`
+	Previous           *ProfitAndLossPeriod `json:"previous"`
+	RevenueChange      money.Amount         `json:"revenue_change"`
+	NetProfitChange    money.Amount         `json:"net_profit_change"`
+	NetProfitChangePct *float64             `json:"net_profit_change_pct"` // nil when the previous net profit is zero
+	Branches           []*ProfitAndLoss     `json:"branches,omitempty"`    // per-branch breakdown of a consolidated statement
+}
+
+// AccountBalance is the balance of one cash or bank account on a date
+type AccountBalance struct {
+	AccountID   int64        `json:"account_id"`
+	AccountName string       `json:"account_name"`
+	AccountType string       `json:"account_type"`
+	Balance     money.Amount `json:"balance"`
+}
+
+// BalanceSheet is the financial position of a branch at the end of a date.
+// BranchID 0 is the consolidated balance sheet of all branches.
+type BalanceSheet struct {
+	BranchID   int64     `json:"branch_id"`
+	BranchName string    `json:"branch_name"`
+	AsOf       time.Time `json:"as_of"`
+
+	// Assets
+	Cash          money.Amount      `json:"cash"` // cash, mobile wallet and other non-bank accounts
+	Bank          money.Amount      `json:"bank"`
+	Receivables   money.Amount      `json:"receivables"` // delivered but unpaid orders and unpaid sales
+	Inventory     money.Amount      `json:"inventory"`   // ready-made stock at product unit cost
+	UncostedUnits int64             `json:"uncosted_units"`
+	TotalAssets   money.Amount      `json:"total_assets"`
+	Accounts      []*AccountBalance `json:"accounts"`
+
+	// Liabilities
+	SupplierPayables money.Amount `json:"supplier_payables"`
+	CustomerAdvances money.Amount `json:"customer_advances"` // money received for items not yet delivered
+	StoreCredit      money.Amount `json:"store_credit"`      // money held for customers as store credit
+	GiftVouchers     money.Amount `json:"gift_vouchers"`     // vouchers sold less vouchers redeemed
+	SalariesPayable  money.Amount `json:"salaries_payable"`  // salary earned this month and not yet paid
+	TaxPayable       money.Amount `json:"tax_payable"`       // tax charged less tax paid on purchases
+	TotalLiabilities money.Amount `json:"total_liabilities"`
+
+	// Equity
+	CurrentYearProfit money.Amount `json:"current_year_profit"`
+	OwnerEquity       money.Amount `json:"owner_equity"` // capital and retained earnings of earlier years
+	TotalEquity       money.Amount `json:"total_equity"`
+
+	Branches []*BalanceSheet `json:"branches,omitempty"` // per-branch breakdown of a consolidated balance sheet
+}
+
+// TrialBalanceLine is one ledger balance on the debit or credit side
+type TrialBalanceLine struct {
+	Account string       `json:"account"`
+	Type    string       `json:"type"` // asset | liability | equity | revenue | expense
+	Debit   money.Amount `json:"debit"`
+	Credit  money.Amount `json:"credit"`
+}
+
+// TrialBalance lists the ledger balances at the end of a date; income and
+// expenses run from the start of the calendar year
+type TrialBalance struct {
+	BranchID    int64               `json:"branch_id"`
+	BranchName  string              `json:"branch_name"`
+	AsOf        time.Time           `json:"as_of"`
+	YearStart   time.Time           `json:"year_start"`
+	Lines       []*TrialBalanceLine `json:"lines"`
+	TotalDebit  money.Amount        `json:"total_debit"`
+	TotalCredit money.Amount        `json:"total_credit"`
+}
+
+const (
+	AGING_CURRENT = "current"
+	AGING_1_30    = "1-30"
+	AGING_31_60   = "31-60"
+	AGING_61_90   = "61-90"
+	AGING_OVER_90 = "90+"
+)
+
+// AgingBuckets splits outstanding amounts by days past due
+type AgingBuckets struct {
+	Current    money.Amount `json:"current"`
+	Days1To30  money.Amount `json:"days_1_30"`
+	Days31To60 money.Amount `json:"days_31_60"`
+	Days61To90 money.Amount `json:"days_61_90"`
+	Over90     money.Amount `json:"over_90"`
+	Total      money.Amount `json:"total"`
+}
+
+// AgingDocument is an unpaid order or sale. Orders fall due on their delivery
+// date (order date when none is set), sales on the sale date.
+type AgingDocument struct {
+	DocumentType    string       `json:"document_type"` // order | sale
+	DocumentID      int64        `json:"document_id"`
+	MemoNo          string       `json:"memo_no"`
+	DocumentDate    time.Time    `json:"document_date"`
+	DueDate         time.Time    `json:"due_date"`
+	Status          string       `json:"status"`
+	SalespersonID   int64        `json:"salesperson_id"`
+	SalespersonName string       `json:"salesperson_name"`
+	TotalAmount     money.Amount `json:"total_amount"`
+	ReceivedAmount  money.Amount `json:"received_amount"`
+	DueAmount       money.Amount `json:"due_amount"`
+	DaysOverdue     int          `json:"days_overdue"`
+	Bucket          string       `json:"bucket"`
+}
+
+// CustomerAging is the outstanding balance of one customer by age
+type CustomerAging struct {
+	CustomerID     int64            `json:"customer_id"`
+	CustomerName   string           `json:"customer_name"`
+	CustomerMobile string           `json:"customer_mobile"`
+	Buckets        AgingBuckets     `json:"buckets"`
+	OldestDueDate  time.Time        `json:"oldest_due_date"`
+	Documents      []*AgingDocument `json:"documents,omitempty"` // only with the drill-down
+}
+
+// ReceivablesAging is the aged receivables of a branch at the end of a date
+type ReceivablesAging struct {
+	BranchID      int64            `json:"branch_id"`
+	BranchName    string           `json:"branch_name"`
+	AsOf          time.Time        `json:"as_of"`
+	SalespersonID int64            `json:"salesperson_id,omitempty"`
+	Totals        AgingBuckets     `json:"totals"`
+	Customers     []*CustomerAging `json:"customers"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+const (
+	INSTALLMENT_PAID    = "paid"
+	INSTALLMENT_PARTIAL = "partial"
+	INSTALLMENT_DUE     = "due"
+	INSTALLMENT_OVERDUE = "overdue"
+)
+
+// Installment is one payment due on an order. PaidAmount and Status follow
+// from what the order has received: installments are settled in order.
+type Installment struct {
+	ID            int64        `json:"id"`
+	OrderID       int64        `json:"order_id"`
+	InstallmentNo int          `json:"installment_no"`
+	DueDate       time.Time    `json:"due_date"`
+	Amount        money.Amount `json:"amount"`
+	PaidAmount    money.Amount `json:"paid_amount"`
+	DueAmount     money.Amount `json:"due_amount"`
+	Status        string       `json:"status"` // paid | partial | due | overdue
+	Overdue       bool         `json:"overdue"`
+	Notes         string       `json:"notes,omitempty"`
+}
+
+// InstallmentPlanRequest schedules what is still due on an order, either as
+// listed installments or as Count equal ones every IntervalMonths months from
+// FirstDueDate.
+type InstallmentPlanRequest struct {
+	Installments []struct {
+		DueDate string       `json:"due_date"`
+		Amount  money.Amount `json:"amount"`
+		Notes   string       `json:"notes"`
+	} `json:"installments"`
+	Count          int    `json:"count"`
+	FirstDueDate   string `json:"first_due_date"`
+	IntervalMonths int    `json:"interval_months"` // default 1
+}
+
+// InstallmentPayment is money received on an order between its creation and
+// delivery, split over one or more accounts
+type InstallmentPayment struct {
+	OrderID     int64     `json:"-"`
+	BranchID    int64     `json:"-"`
+	PaymentDate time.Time `json:"payment_date"`
+	Payments    []Payment `json:"payments"`
+	Notes       string    `json:"notes"`
+}
+
+// InstallmentPaymentResult tells what is left on the order after a payment
+type InstallmentPaymentResult struct {
+	MemoNo       string        `json:"memo_no"`
+	OrderID      int64         `json:"order_id"`
+	Amount       money.Amount  `json:"amount"`
+	RemainingDue money.Amount  `json:"remaining_due"`
+	Installments []Installment `json:"installments"`
+}
+
+// UpcomingInstallment is a line of the upcoming installments report
+type UpcomingInstallment struct {
+	Installment
+	MemoNo         string `json:"memo_no"`
+	CustomerID     int64  `json:"customer_id"`
+	CustomerName   string `json:"customer_name"`
+	CustomerMobile string `json:"customer_mobile"`
+	DaysOverdue    int    `json:"days_overdue,omitempty"`
+}
+
+// UpcomingInstallments lists what customers owe on installment plans up to EndDate
+type UpcomingInstallments struct {
+	BranchID     int64                  `json:"branch_id"`
+	AsOf         time.Time              `json:"as_of"`
+	EndDate      time.Time              `json:"end_date"`
+	Installments []*UpcomingInstallment `json:"installments"`
+	OverdueCount int                    `json:"overdue_count"`
+	OverdueTotal money.Amount           `json:"overdue_total"`
+	UpcomingDue  money.Amount           `json:"upcoming_due"`
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// Printable documents handed to the customer
+const (
+	INVOICE_ORDER    = "order"    // booking of a tailoring order
+	INVOICE_DELIVERY = "delivery" // items of an order handed over, with what was paid
+	INVOICE_SALE     = "sale"
+	INVOICE_REFUND   = "refund" // money paid on an order or sale handed back
+)
+
+// Invoice languages
+const (
+	INVOICE_ENGLISH = "en"
+	INVOICE_ARABIC  = "ar"
+)
+
+// Branch holds the details a branch prints on its documents
+type Branch struct {
+	ID             int64  `json:"id"`
+	Name           string `json:"name"`
+	Slogan         string `json:"slogan"`
+	Mobile         string `json:"mobile"`
+	Telephone      string `json:"telephone"`
+	Email          string `json:"email"`
+	Website        string `json:"website"`
+	Address        string `json:"address"`
+	City           string `json:"city"`
+	Country        string `json:"country"`
+	LogoLink       string `json:"logo_link"`
+	TaxID          string `json:"tax_id"`
+	InvoiceTerms   string `json:"invoice_terms"`    // printed under English invoices
+	InvoiceTermsAr string `json:"invoice_terms_ar"` // printed under Arabic invoices
+}
+
+// Invoice is an order, delivery, sale or refund as printed for the customer.
+// Total, Paid and Due are those of the order or sale when printed. With tax
+// on it, it prints as a tax invoice with the tax ids of the branch and customer.
+type Invoice struct {
+	Kind           string     `json:"kind"`
+	Branch         Branch     `json:"branch"`
+	MemoNo         string     `json:"memo_no"`   // of the order or sale
+	Reference      string     `json:"reference"` // memo of the delivery or refund
+	Date           time.Time  `json:"date"`
+	DeliveryDate   *time.Time `json:"delivery_date,omitempty"`
+	Status         string     `json:"status"`
+	CustomerName   string     `json:"customer_name"`
+	CustomerMobile string     `json:"customer_mobile"`
+	CustomerTaxID  string     `json:"customer_tax_id"` // printed as the buyer's on tax invoices
+	Salesperson    string     `json:"salesperson"`
+	Notes          string     `json:"notes"`
+
+	Items    []InvoiceItem    `json:"items"`
+	Subtotal money.Amount     `json:"subtotal"` // the items before discounts
+	Discount money.Amount     `json:"discount"` // line, document and promotion discounts together
+	Net      money.Amount     `json:"net"`      // the total before tax
+	Taxes    []TaxLine        `json:"taxes"`
+	Tax      money.Amount     `json:"tax"`
+	Total    money.Amount     `json:"total"`
+	Paid     money.Amount     `json:"paid"`
+	Due      money.Amount     `json:"due"`
+	Payments []InvoicePayment `json:"payments"`
+
+	// loyalty points of the customer
+	PointsEarned  int64 `json:"points_earned"`  // on the order or sale, less any taken back
+	PointsBalance int64 `json:"points_balance"` // when printed
+
+	// the delivery or refund printed
+	Amount    money.Amount `json:"amount"`    // received with the delivery, or refunded
+	Quantity  int64        `json:"quantity"`  // items handed over with the delivery
+	Delivered int64        `json:"delivered"` // items handed over up to and including it
+	Remaining int64        `json:"remaining"` // items still to deliver after it
+}
+
+type InvoiceItem struct {
+	Name     string       `json:"name"`
+	Quantity int          `json:"quantity"`
+	Amount   money.Amount `json:"amount"`
+}
+
+// InvoicePayment is money received on the document; refunds are negative.
+// Account is empty for money moved from or to store credit.
+type InvoicePayment struct {
+	Date      time.Time    `json:"date"`
+	MemoNo    string       `json:"memo_no"`
+	Account   string       `json:"account"`
+	Reference string       `json:"reference,omitempty"` // cheque, card slip or transfer number
+	Voucher   string       `json:"voucher,omitempty"`   // gift voucher code when paid with one
+	Points    int64        `json:"points,omitempty"`    // loyalty points when paid with them
+	Amount    money.Amount `json:"amount"`
+}
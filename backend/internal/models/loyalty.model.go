@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+const (
+	LOYALTY_EARN    = "earn"    // points for money paid on a sale or delivered order
+	LOYALTY_REDEEM  = "redeem"  // points used to pay an order or sale
+	LOYALTY_REVERSE = "reverse" // points earned taken back after a refund, return or cancellation
+	LOYALTY_RESTORE = "restore" // points redeemed on a cancelled order given back
+	LOYALTY_EXPIRE  = "expire"  // points not used before they expired
+)
+
+// LoyaltyRule is how points are earned and what they are worth in the
+// branches it applies in, from StartsOn until a later rule takes its place
+type LoyaltyRule struct {
+	ID              int64        `json:"id"`
+	BranchID        *int64       `json:"branch_id"` // nil applies in every branch
+	Name            string       `json:"name"`
+	AmountPerPoint  money.Amount `json:"amount_per_point"` // paid amount that earns one point
+	PointValue      money.Amount `json:"point_value"`      // worth of one point when redeemed
+	ExpiryMonths    int          `json:"expiry_months"`
+	MinRedeemPoints int64        `json:"min_redeem_points"`
+	StartsOn        time.Time    `json:"starts_on"`
+	Active          bool         `json:"active"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+// LoyaltyEntry is one movement of a customer's points. Points are positive
+// when earned or given back and negative when used, taken back or expired.
+type LoyaltyEntry struct {
+	ID            int64        `json:"id"`
+	CustomerID    int64        `json:"customer_id"`
+	BranchID      int64        `json:"branch_id"`
+	EntryDate     time.Time    `json:"entry_date"`
+	EntryType     string       `json:"entry_type"`
+	Points        int64        `json:"points"`
+	Amount        money.Amount `json:"amount,omitempty"` // paid with the points when redeemed
+	Remaining     int64        `json:"remaining"`        // not used yet of points earned or given back
+	ExpiresOn     *time.Time   `json:"expires_on,omitempty"`
+	DocumentType  *string      `json:"document_type,omitempty"` // order | sale
+	DocumentID    *int64       `json:"document_id,omitempty"`
+	TransactionID *int64       `json:"transaction_id,omitempty"`
+	MemoNo        string       `json:"memo_no"`
+	Notes         string       `json:"notes"`
+	Balance       int64        `json:"balance"` // running balance after the entry
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// LoyaltyHistory is a customer's points movements for a date range
+type LoyaltyHistory struct {
+	CustomerID     int64           `json:"customer_id"`
+	StartDate      time.Time       `json:"start_date"`
+	EndDate        time.Time       `json:"end_date"`
+	OpeningBalance int64           `json:"opening_balance"`
+	Entries        []*LoyaltyEntry `json:"entries"`
+	ClosingBalance int64           `json:"closing_balance"`
+	Balance        int64           `json:"balance"`       // points the customer can redeem today
+	PointValue     money.Amount    `json:"point_value"`   // worth of one point in the branch today, 0 without a rule
+	ExpiringSoon   int64           `json:"expiring_soon"` // of the balance, expiring in the next 30 days
+}
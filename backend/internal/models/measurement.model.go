@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// MeasurementField is one measurement taken for a garment type
+type MeasurementField struct {
+	Key      string `json:"key"` // e.g. "sleeve_length"; the key in the measurements map
+	Label    string `json:"label"`
+	Unit     string `json:"unit,omitempty"` // e.g. "inch"
+	Required bool   `json:"required"`
+}
+
+// StandardMeasurementFields are the measurements kept on the customer record.
+// Profiles without a garment type use them.
+var StandardMeasurementFields = []MeasurementField{
+	{Key: "length", Label: "Length"},
+	{Key: "shoulder", Label: "Shoulder"},
+	{Key: "bust", Label: "Bust"},
+	{Key: "waist", Label: "Waist"},
+	{Key: "hip", Label: "Hip"},
+	{Key: "arm_hole", Label: "Arm hole"},
+	{Key: "sleeve_length", Label: "Sleeve length"},
+	{Key: "sleeve_width", Label: "Sleeve width"},
+	{Key: "round_width", Label: "Round width"},
+}
+
+// GarmentType is a kind of garment and the measurements it needs
+type GarmentType struct {
+	ID        int64              `json:"id"`
+	BranchID  int64              `json:"branch_id"`
+	Name      string             `json:"name"`
+	Fields    []MeasurementField `json:"fields"`
+	Status    bool               `json:"status"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// MeasurementProfile is a named set of measurements of a customer, e.g. one
+// per family member. Measurements holds the current version.
+type MeasurementProfile struct {
+	ID              int64              `json:"id"`
+	BranchID        int64              `json:"branch_id"`
+	CustomerID      int64              `json:"customer_id"`
+	Name            string             `json:"name"`
+	GarmentTypeID   *int64             `json:"garment_type_id"` // nil: standard measurements
+	GarmentTypeName string             `json:"garment_type_name,omitempty"`
+	IsDefault       bool               `json:"is_default"` // mirrored on the customer record
+	Status          bool               `json:"status"`
+	Notes           string             `json:"notes"`
+	CurrentVersion  int                `json:"current_version"`
+	Fields          []MeasurementField `json:"fields"`
+	Measurements    map[string]string  `json:"measurements"`
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+}
+
+// MeasurementVersion is the measurements of a profile as recorded at one time
+type MeasurementVersion struct {
+	ID           int64             `json:"id"`
+	ProfileID    int64             `json:"profile_id"`
+	ProfileName  string            `json:"profile_name,omitempty"`
+	Version      int               `json:"version"`
+	Measurements map[string]string `json:"measurements"`
+	Notes        string            `json:"notes"`
+	CreatedBy    *int64            `json:"created_by"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// MeasurementProfileRequest creates a profile or records new measurements on it
+type MeasurementProfileRequest struct {
+	BranchID      int64             `json:"-"`
+	CustomerID    int64             `json:"customer_id"`
+	Name          string            `json:"name"`
+	GarmentTypeID *int64            `json:"garment_type_id"`
+	IsDefault     bool              `json:"is_default"`
+	Notes         string            `json:"notes"`
+	Measurements  map[string]string `json:"measurements"`
+	CreatedBy     *int64            `json:"-"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Documents numbered from a memo sequence
+const (
+	MEMO_ORDER        = "order"
+	MEMO_SALE         = "sale"
+	MEMO_PURCHASE     = "purchase"
+	MEMO_SALARY       = "salary"
+	MEMO_REFUND       = "refund"   // money handed back, to the customer or their store credit
+	MEMO_TRANSFER     = "transfer" // any other movement of money
+	MEMO_PAYMENT      = "payment"  // a customer paying off their due
+	MEMO_STORE_CREDIT = "store_credit"
+	MEMO_RESTOCK      = "restock"
+	MEMO_VOUCHER      = "voucher" // a gift voucher sold
+	MEMO_LOYALTY      = "loyalty" // loyalty points redeemed
+
+	MEMO_SUPPLIER_PAYMENT = "supplier_payment" // a purchase paid off after it was booked
+)
+
+// MemoDocumentCodes are the codes of each document type in default prefixes
+var MemoDocumentCodes = map[string]string{
+	MEMO_ORDER:        ORDER_MEMO_PREFIX,
+	MEMO_SALE:         SALE_MEMO_PREFIX,
+	MEMO_PURCHASE:     PURCHASE_MEMO_PREFIX,
+	MEMO_SALARY:       SALARY_MEMO_PREFIX,
+	MEMO_REFUND:       "RF",
+	MEMO_TRANSFER:     "TR",
+	MEMO_PAYMENT:      CUSTOMER_PAYMENT_PREFIX,
+	MEMO_STORE_CREDIT: STORE_CREDIT_MEMO_PREFIX,
+	MEMO_RESTOCK:      "RS",
+	MEMO_VOUCHER:      "GV",
+	MEMO_LOYALTY:      "LP",
+
+	MEMO_SUPPLIER_PAYMENT: "SP",
+}
+
+// MemoSequence is how a branch numbers one type of document: Prefix, the year
+// of the document when Yearly, then the number padded to Padding digits, e.g.
+// DIVA-OR-2026-000123. Yearly numbering restarts every year.
+type MemoSequence struct {
+	BranchID     int64     `json:"branch_id"`
+	DocumentType string    `json:"document_type"`
+	Prefix       string    `json:"prefix"`
+	Padding      int       `json:"padding"`
+	Yearly       bool      `json:"yearly"`
+	LastValue    int64     `json:"last_value"` // of the current year when yearly
+	NextMemoNo   string    `json:"next_memo_no"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
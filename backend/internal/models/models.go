@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
 )
 
 const (
@@ -21,18 +23,25 @@ const (
 	SALARY_MEMO_PREFIX         = "SY"
 	ADVANCE_SALARY_MEMO_PREFIX = "ADV"
 	PURCHASE_MEMO_PREFIX       = "PR"
+	CUSTOMER_PAYMENT_PREFIX    = "RP"
+	STORE_CREDIT_MEMO_PREFIX   = "SC"
 )
 const (
 	ACCOUNT_BANK = "bank"
 	ACCOUNT_CASH = "cash"
 )
 const (
-	ENTITY_ACCOUNT     = "accounts"
-	ENTITY_SUPPLIER    = "suppliers"
-	ENTITY_CUSTOMER    = "customers"
-	ENTITY_EMPLOYEE    = "employees"
-	ENTITY_SALESPERSON = "salespersons"
-	ENTITY_WORKER      = "workers"
+	ENTITY_ACCOUNT      = "accounts"
+	ENTITY_SUPPLIER     = "suppliers"
+	ENTITY_CUSTOMER     = "customers"
+	ENTITY_EMPLOYEE     = "employees"
+	ENTITY_SALESPERSON  = "salespersons"
+	ENTITY_WORKER       = "workers"
+	ENTITY_ORDER        = "orders"
+	ENTITY_SALE         = "sales"
+	ENTITY_STORE_CREDIT = "store_credit"   // a customer's store credit, by customer id
+	ENTITY_VOUCHER      = "gift_vouchers"  // a gift voucher, by voucher id
+	ENTITY_LOYALTY      = "loyalty_points" // a customer's loyalty points, by customer id
 )
 const (
 	ORDER_PENDING          = "pending"
@@ -40,6 +49,10 @@ const (
 	ORDER_DELIVERY         = "delivered"
 	ORDER_CANCELLED        = "cancelled"
 )
+const (
+	PURCHASE_CATEGORY_MATERIAL = "material" // tailoring material, reported as cost of goods
+	PURCHASE_CATEGORY_STOCK    = "stock"    // ready-made stock, expensed through unit cost when sold
+)
 const (
 	SALE_DELIVERY = "delivered"
 	SALE_RETURNED = "returned"
@@ -81,31 +94,64 @@ type DBConfig struct {
 }
 
 type Config struct {
-	Port int64
-	Env  string
-	JWT  JWTConfig
-	DB   DBConfig
+	Port    int64
+	Env     string
+	JWT     JWTConfig
+	DB      DBConfig
+	Storage StorageConfig
+	Print   PrintConfig
+	Money   MoneyConfig
+}
+
+// MoneyConfig sets how amounts are written in JSON replies: "number" (the
+// default, e.g. 12.50) or "string" (e.g. "12.50") for clients that read
+// numbers as floating point. Requests may use either form.
+type MoneyConfig struct {
+	JSON string
+}
+
+// PrintConfig holds the TrueType fonts printed documents use. They must cover
+// Latin and Arabic (e.g. DejaVu Sans); without them common system locations
+// are tried, and Arabic documents cannot be printed if none is found.
+type PrintConfig struct {
+	Font     string
+	BoldFont string
+}
+
+// StorageConfig selects where uploaded files are kept
+type StorageConfig struct {
+	Backend   string // "local" (default) or "s3"
+	LocalRoot string // directory of the local store, ./data by default
+	URLSecret string // signs the local store's download links
+
+	S3Endpoint       string // e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000 for MinIO
+	S3PublicEndpoint string // endpoint put into signed links when clients reach the service elsewhere
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3PathStyle      bool // needed by MinIO
 }
 
 // Employee model
 type Employee struct {
-	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	Role         string    `json:"role"`   // chairman, manager, salesperson, worker
-	Status       string    `json:"status"` // active, inactive
-	Mobile       string    `json:"mobile"`
-	MobileAlt    string    `json:"mobile_alt"`
-	Email        string    `json:"email,omitempty"`
-	Password     string    `json:"password"` // hashed password
-	PassportNo   string    `json:"passport_no,omitempty"`
-	JoiningDate  time.Time `json:"joining_date"`
-	Address      string    `json:"address,omitempty"`
-	BaseSalary   float64   `json:"base_salary"`
-	OvertimeRate float64   `json:"overtime_rate"`
-	AvatarLink   string    `json:"avatar_link"`
-	BranchID     int64     `json:"branch_id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int64        `json:"id"`
+	Name         string       `json:"name"`
+	Role         string       `json:"role"`   // chairman, manager, salesperson, worker
+	Status       string       `json:"status"` // active, inactive
+	Mobile       string       `json:"mobile"`
+	MobileAlt    string       `json:"mobile_alt"`
+	Email        string       `json:"email,omitempty"`
+	Password     string       `json:"password"` // hashed password
+	PassportNo   string       `json:"passport_no,omitempty"`
+	JoiningDate  time.Time    `json:"joining_date"`
+	Address      string       `json:"address,omitempty"`
+	BaseSalary   money.Amount `json:"base_salary"`
+	OvertimeRate money.Amount `json:"overtime_rate"`
+	AvatarLink   string       `json:"avatar_link"`
+	BranchID     int64        `json:"branch_id"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
 }
 
 // EmployeeNameID is a lightweight struct for fetching only customer's ID and Name.
@@ -127,44 +173,61 @@ type Supplier struct {
 
 // PurchaseDB represents the purchase table
 type PurchaseDB struct {
-	ID             int64     `json:"id"`
-	MemoNo         string    `json:"memo_no"`
-	PurchaseDate   time.Time `json:"purchase_date"`
-	SupplierID     int64     `json:"supplier_id"`
-	SupplierName   string    `json:"supplier_name"`
-	SupplierMobile string    `json:"supplier_mobile"`
-	BranchID       int64     `json:"branch_id"`
-	TotalAmount    float64   `json:"total_amount"`
-	Notes          string    `json:"notes"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             int64         `json:"id"`
+	MemoNo         string        `json:"memo_no"`
+	PurchaseDate   time.Time     `json:"purchase_date"`
+	SupplierID     int64         `json:"supplier_id"`
+	SupplierName   string        `json:"supplier_name"`
+	SupplierMobile string        `json:"supplier_mobile"`
+	BranchID       int64         `json:"branch_id"`
+	TotalAmount    money.Amount  `json:"total_amount"`
+	PaidAmount     *money.Amount `json:"paid_amount"` // paid when booked plus later supplier payments; nil on input = paid in full (kept as is on update)
+	Category       string        `json:"category"`
+	Notes          string        `json:"notes"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+
+	DocumentTax
 }
 
 // PurchaseReportTotals represents the aggregate data
 type PurchaseReportTotals struct {
-	TotalAmount float64 `json:"total_amount"`
+	TotalAmount money.Amount `json:"total_amount"`
+	TaxAmount   money.Amount `json:"tax_amount"`
 }
 type Customer struct {
-	ID        int64   `json:"id"`
-	Name      string  `json:"name"`
-	Mobile    string  `json:"mobile"`
-	Address   string  `json:"address"`
-	TaxID     *string `json:"tax_id,omitempty"`
-	DueAmount float64 `json:"due_amount"`
-	Status    bool    `json:"status"`
-	BranchID  int64   `json:"branch_id"`
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	Mobile    string       `json:"mobile"`
+	Address   string       `json:"address"`
+	TaxID     *string      `json:"tax_id,omitempty"`
+	DueAmount money.Amount `json:"due_amount"`
+	Status    bool         `json:"status"`
+	BranchID  int64        `json:"branch_id"`
 	//Measurement
-	Length       string    `json:"length,omitempty"`
-	Shoulder     string    `json:"shoulder,omitempty"`
-	Bust         string    `json:"bust,omitempty"`
-	Waist        string    `json:"waist,omitempty"`
-	Hip          string    `json:"hip,omitempty"`
-	ArmHole      string    `json:"arm_hole,omitempty"`
-	SleeveLength string    `json:"sleeve_length,omitempty"`
-	SleeveWidth  string    `json:"sleeve_width,omitempty"`
-	RoundWidth   string    `json:"round_width,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	Length       string `json:"length,omitempty"`
+	Shoulder     string `json:"shoulder,omitempty"`
+	Bust         string `json:"bust,omitempty"`
+	Waist        string `json:"waist,omitempty"`
+	Hip          string `json:"hip,omitempty"`
+	ArmHole      string `json:"arm_hole,omitempty"`
+	SleeveLength string `json:"sleeve_length,omitempty"`
+	SleeveWidth  string `json:"sleeve_width,omitempty"`
+	RoundWidth   string `json:"round_width,omitempty"`
+	//Credit
+	CreditLimit          *money.Amount `json:"credit_limit"`           // own limit, nil uses the branch default
+	EffectiveCreditLimit *money.Amount `json:"effective_credit_limit"` // nil means no limit
+	RemainingCredit      *money.Amount `json:"remaining_credit"`       // nil means no limit
+	StoreCredit          money.Amount  `json:"store_credit"`           // money held for the customer
+	LoyaltyPoints        int64         `json:"loyalty_points"`         // points the customer can redeem today
+	CreatedAt            time.Time     `json:"created_at"`
+	UpdatedAt            time.Time     `json:"updated_at"`
+}
+
+// CreditOverride is a manager's approval of an order or sale above the customer's credit limit
+type CreditOverride struct {
+	ApprovedBy int64  `json:"approved_by"` // set from the signed-in user
+	Reason     string `json:"reason"`
 }
 
 // CustomerNameID is a lightweight struct for fetching only customer's ID and Name.
@@ -175,13 +238,15 @@ type CustomerNameID struct {
 }
 
 type Product struct {
-	ID                int64     `json:"id"`
-	ProductName       string    `json:"product_name"`
-	Quantity          int64     `json:"quantity"`
-	TotalPrices       int64     `json:"total_price"`
-	CurrentStockLevel int64     `json:"current_stock_level"`
-	CreatedAt         time.Time `json:"created_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
+	ID                int64         `json:"id"`
+	ProductName       string        `json:"product_name"`
+	Quantity          int64         `json:"quantity"`
+	TotalPrices       money.Amount  `json:"total_price"`
+	CurrentStockLevel int64         `json:"current_stock_level"`
+	UnitCost          *money.Amount `json:"unit_cost,omitempty"` // nil = cost unknown
+	TaxCategory       string        `json:"tax_category"`
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         time.Time     `json:"updated_at"`
 }
 
 // ProductStockRegistry represents a record from product_stock_registry
@@ -199,13 +264,13 @@ type ProductStockRegistry struct {
 }
 
 type Account struct {
-	ID             int64     `json:"id"`
-	Name           string    `json:"name"`
-	Type           string    `json:"type"`
-	CurrentBalance float64   `json:"current_balance"`
-	BranchID       int64     `json:"branch_id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             int64        `json:"id"`
+	Name           string       `json:"name"`
+	Type           string       `json:"type"`
+	CurrentBalance money.Amount `json:"current_balance"`
+	BranchID       int64        `json:"branch_id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
 }
 type AccountNameID struct {
 	ID   int64  `json:"id"`
@@ -213,20 +278,20 @@ type AccountNameID struct {
 }
 
 type Transaction struct {
-	TransactionID   string    `json:"transaction_id"` // optional unique identifier if needed
-	TransactionDate time.Time `json:"transaction_date"`
-	MemoNo          string    `json:"memo_no"`
-	BranchID        int64     `json:"branch_id"`
-	FromID          int64     `json:"from_id"`
-	FromAccountName string    `json:"from_account_name"`
-	FromType        string    `json:"from_type"` // customers, employees, accounts, etc.
-	ToID            int64     `json:"to_id"`
-	ToAccountName   string    `json:"to_account_name"`
-	ToType          string    `json:"to_type"` // customers, employees, accounts, etc.
-	Amount          float64   `json:"amount"`
-	TransactionType string    `json:"transaction_type"` // payment, refund, adjustment, salary
-	CreatedAt       time.Time `json:"created_at"`
-	Notes           string    `json:"notes,omitempty"`
+	TransactionID   string       `json:"transaction_id"` // optional unique identifier if needed
+	TransactionDate time.Time    `json:"transaction_date"`
+	MemoNo          string       `json:"memo_no"`
+	BranchID        int64        `json:"branch_id"`
+	FromID          int64        `json:"from_id"`
+	FromAccountName string       `json:"from_account_name"`
+	FromType        string       `json:"from_type"` // customers, employees, accounts, etc.
+	ToID            int64        `json:"to_id"`
+	ToAccountName   string       `json:"to_account_name"`
+	ToType          string       `json:"to_type"` // customers, employees, accounts, etc.
+	Amount          money.Amount `json:"amount"`
+	TransactionType string       `json:"transaction_type"` // payment, refund, adjustment, salary
+	CreatedAt       time.Time    `json:"created_at"`
+	Notes           string       `json:"notes,omitempty"`
 }
 
 // Reports
@@ -237,64 +302,64 @@ type OrderOverview struct {
 	CompletedOrders int64 `json:"completed_orders"`
 	CancelledOrders int64 `json:"cancelled_orders"`
 
-	TotalOrdersAmount     int64 `json:"total_orders_amount"`
-	PendingOrdersAmount   int64 `json:"pending_orders_amount"`
-	CheckoutOrdersAmount  int64 `json:"checkout_orders_amount"`
-	CompletedOrdersAmount int64 `json:"completed_orders_amount"`
-	CancelledOrdersAmount int64 `json:"cancelled_orders_amount"`
+	TotalOrdersAmount     money.Amount `json:"total_orders_amount"`
+	PendingOrdersAmount   money.Amount `json:"pending_orders_amount"`
+	CheckoutOrdersAmount  money.Amount `json:"checkout_orders_amount"`
+	CompletedOrdersAmount money.Amount `json:"completed_orders_amount"`
+	CancelledOrdersAmount money.Amount `json:"cancelled_orders_amount"`
 }
 
 type SalesPersonProgressReportDB struct {
-	SalesPersonID   int64   `json:"sales_person_id"`
-	SalesPersonName string  `json:"sales_person_name"`
-	Mobile          string  `json:"mobile"`
-	Email           string  `json:"email"`
-	BaseSalary      float64 `json:"base_salary"`
-	SheetDate       string  `json:"sheet_date"`
-	ProductName     string  `json:"product_name"`
-	OrderCount      int64   `json:"order_count"`
-	ItemCount       int64   `json:"item_count"`
-	Sale            float64 `json:"sale"`
-	SaleReturn      float64 `json:"sale_return"`
+	SalesPersonID   int64        `json:"sales_person_id"`
+	SalesPersonName string       `json:"sales_person_name"`
+	Mobile          string       `json:"mobile"`
+	Email           string       `json:"email"`
+	BaseSalary      money.Amount `json:"base_salary"`
+	SheetDate       string       `json:"sheet_date"`
+	ProductName     string       `json:"product_name"`
+	OrderCount      int64        `json:"order_count"`
+	ItemCount       int64        `json:"item_count"`
+	Sale            money.Amount `json:"sale"`
+	SaleReturn      money.Amount `json:"sale_return"`
 }
 
 type WorkerProgressReportDB struct {
-	ID                   int64   `json:"id"`
-	WorkerID             int64   `json:"worker_id"`
-	WorkerName           string  `json:"worker_name"`
-	Mobile               string  `json:"mobile"`
-	Email                string  `json:"email"`
-	BaseSalary           float64 `json:"base_salary"`
-	SheetDate            string  `json:"sheet_date"`
-	TotalAdvancePayment  float64 `json:"total_advance_payment"`
-	TotalProductionUnits float64 `json:"total_production_units"`
-	TotalOvertimeHours   float64 `json:"total_overtime_hours"`
+	ID                   int64        `json:"id"`
+	WorkerID             int64        `json:"worker_id"`
+	WorkerName           string       `json:"worker_name"`
+	Mobile               string       `json:"mobile"`
+	Email                string       `json:"email"`
+	BaseSalary           money.Amount `json:"base_salary"`
+	SheetDate            string       `json:"sheet_date"`
+	TotalAdvancePayment  money.Amount `json:"total_advance_payment"`
+	TotalProductionUnits float64      `json:"total_production_units"`
+	TotalOvertimeHours   float64      `json:"total_overtime_hours"`
 }
 
 type TopSheet struct {
-	ID          int64     `json:"id"`
-	Date        time.Time `json:"date"`
-	BranchID    int64     `json:"branch_id"`
-	TotalAmount float64   `json:"total_amount"`
-	Expense     float64   `json:"expense"`
-	Cash        float64   `json:"cash"`
-	Bank        float64   `json:"bank"`
-	Balance     float64   `json:"balance"`
-	OrderCount  int64     `json:"order_count"`
-	Pending     int64     `json:"pending"`
-	Delivery    int64     `json:"delivery"`
-	Checkout    int64     `json:"checkout"`
-	Cancelled   int64     `json:"cancelled"`
-	ReadyMade   int64     `json:"ready_made"`
+	ID          int64        `json:"id"`
+	Date        time.Time    `json:"date"`
+	BranchID    int64        `json:"branch_id"`
+	TotalAmount money.Amount `json:"total_amount"`
+	Expense     money.Amount `json:"expense"`
+	Cash        money.Amount `json:"cash"`
+	Bank        money.Amount `json:"bank"`
+	Balance     money.Amount `json:"balance"`
+	OrderCount  int64        `json:"order_count"`
+	Pending     int64        `json:"pending"`
+	Delivery    int64        `json:"delivery"`
+	Checkout    int64        `json:"checkout"`
+	Cancelled   int64        `json:"cancelled"`
+	ReadyMade   int64        `json:"ready_made"`
 }
 
 type BranchReportTotals struct {
-	Expense  float64 `json:"expense"`
-	Cash     float64 `json:"cash"`
-	Bank     float64 `json:"bank"`
-	Balance  float64 `json:"balance"`
-	Orders   int     `json:"orders"`
-	Delivery int     `json:"delivery"`
+	Expense  money.Amount `json:"expense"`
+	Cash     money.Amount `json:"cash"`
+	Bank     money.Amount `json:"bank"`
+	Balance  money.Amount `json:"balance"`
+	Orders   int          `json:"orders"`
+	Delivery int          `json:"delivery"`
 }
 
 // Define a struct to hold the aggregate totals for Stock Report
@@ -303,53 +368,53 @@ type StockReportTotals struct {
 }
 
 type SalesPersonProgressTotals struct {
-	TotalSale       float64 `json:"sale"`
-	TotalSaleReturn float64 `json:"sale_return"`
-	TotalOrders     int64   `json:"order_count"`
+	TotalSale       money.Amount `json:"sale"`
+	TotalSaleReturn money.Amount `json:"sale_return"`
+	TotalOrders     int64        `json:"order_count"`
 }
 
 // Employee progress struct
 type EmployeeProgressDB struct {
-	ID               int64     `json:"id"`
-	SheetDate        time.Time `json:"sheet_date"`
-	BranchID         int64     `json:"branch_id"`
-	EmployeeID       int64     `json:"employee_id"`
-	SaleAmount       float64   `json:"sale_amount"`
-	SaleReturnAmount float64   `json:"sale_return_amount"`
-	OrderCount       int64     `json:"order_count"`
-	ProductionUnits  int64     `json:"production_units"`
-	OvertimeHours    float64   `json:"overtime_hours"`
-	AdvancePayment   float64   `json:"advance_payment"`
-	Salary           float64   `json:"salary"`
-	PaymentAccountID int64     `json:"payment_account_id"`
+	ID               int64        `json:"id"`
+	SheetDate        time.Time    `json:"sheet_date"`
+	BranchID         int64        `json:"branch_id"`
+	EmployeeID       int64        `json:"employee_id"`
+	SaleAmount       money.Amount `json:"sale_amount"`
+	SaleReturnAmount money.Amount `json:"sale_return_amount"`
+	OrderCount       int64        `json:"order_count"`
+	ProductionUnits  int64        `json:"production_units"`
+	OvertimeHours    float64      `json:"overtime_hours"`
+	AdvancePayment   money.Amount `json:"advance_payment"`
+	Salary           money.Amount `json:"salary"`
+	PaymentAccountID int64        `json:"payment_account_id"`
 }
 
 type SalaryLogDB struct {
-	ID            int64     `json:"id"`
-	EmployeeName  string    `json:"employee_name"`
-	SheetDate     time.Time `json:"sheet_date"`
-	Amount        float64   `json:"amount"`
-	AdvanceAmount float64   `json:"advance_amount"`
-	Note          string    `json:"note"` // Populated manually or via DB if column exists
+	ID            int64        `json:"id"`
+	EmployeeName  string       `json:"employee_name"`
+	SheetDate     time.Time    `json:"sheet_date"`
+	Amount        money.Amount `json:"amount"`
+	AdvanceAmount money.Amount `json:"advance_amount"`
+	Note          string       `json:"note"` // Populated manually or via DB if column exists
 }
 
 type WorkerLogDB struct {
-	ID              int64     `json:"id"`
-	EmployeeName    string    `json:"employee_name"`
-	SheetDate       time.Time `json:"sheet_date"`
-	ProductionUnits int64     `json:"production_units"`
-	OvertimeHours   float64   `json:"overtime_hours"`
-	AdvancePayment  float64   `json:"advance_payment"`
+	ID              int64        `json:"id"`
+	EmployeeName    string       `json:"employee_name"`
+	SheetDate       time.Time    `json:"sheet_date"`
+	ProductionUnits int64        `json:"production_units"`
+	OvertimeHours   float64      `json:"overtime_hours"`
+	AdvancePayment  money.Amount `json:"advance_payment"`
 }
 
 type SalaryRecord struct {
-	ID             int64     `json:"id"`
-	BranchID       int64     `json:"branch_id"`
-	EmployeeID     int64     `json:"employee_id"`
-	EmployeeName   string    `json:"employee_name"`
-	EmployeeMobile string    `json:"employee_mobile"`
-	Role           string    `json:"role"`
-	BaseSalary     float64   `json:"base_salary"`
-	TotalSalary    float64   `json:"total_salary"`
-	SheetDate      time.Time `json:"sheet_date"`
+	ID             int64        `json:"id"`
+	BranchID       int64        `json:"branch_id"`
+	EmployeeID     int64        `json:"employee_id"`
+	EmployeeName   string       `json:"employee_name"`
+	EmployeeMobile string       `json:"employee_mobile"`
+	Role           string       `json:"role"`
+	BaseSalary     money.Amount `json:"base_salary"`
+	TotalSalary    money.Amount `json:"total_salary"`
+	SheetDate      time.Time    `json:"sheet_date"`
 }
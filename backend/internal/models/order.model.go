@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
 
 // DB structs
 type OrderDB struct {
@@ -16,13 +20,42 @@ type OrderDB struct {
 	// products
 	TotalItems       int64   `json:"total_items"`
 	DeliveredItems   int64   `json:"delivered_items"`
-	TotalAmount      float64 `json:"total_amount"`
+	TotalAmount      money.Amount `json:"total_amount"`
 	PaymentAccountID int64   `json:"payment_account_id"`
-	ReceivedAmount   float64 `json:"received_amount"`
+	ReceivedAmount   money.Amount `json:"received_amount"`
+
+	// the money received split over several accounts; when given, it takes the
+	// place of payment_account_id and received_amount
+	Payments []Payment `json:"payments,omitempty"`
+
+	// part of the total paid from the customer's store credit (not included in received_amount on input)
+	StoreCreditAmount money.Amount `json:"store_credit_amount,omitempty"`
+
+	// parts of the total paid with gift vouchers (not included in received_amount on input)
+	Vouchers []VoucherRedemption `json:"vouchers,omitempty"`
+
+	// loyalty points redeemed for part of the total (their worth is not included in received_amount on input)
+	LoyaltyPoints int64 `json:"loyalty_points,omitempty"`
+	// points earned on it, less any taken back
+	PointsEarned int64 `json:"points_earned"`
 
 	Status string  `json:"status"`
 	Notes  *string `json:"notes,omitempty"`
 
+	CreditOverride *CreditOverride `json:"credit_override,omitempty"` // required when the order takes the customer over the credit limit
+
+	// schedule the balance is paid on, and how many of its installments are overdue
+	Installments        []Installment `json:"installments,omitempty"`
+	OverdueInstallments int64         `json:"overdue_installments"`
+
+	DocumentDiscounts
+	DocumentTax
+
+	// measurements the order is made from; without them the customer's default profile is used
+	MeasurementProfileID *int64              `json:"measurement_profile_id,omitempty"`
+	MeasurementVersionID *int64              `json:"measurement_version_id,omitempty"`
+	Measurement          *MeasurementVersion `json:"measurement,omitempty"`
+
 	CreatedAt         time.Time            `json:"created_at"`
 	UpdatedAt         time.Time            `json:"updated_at"`
 	Items             []OrderItemDB        `json:"items"`
@@ -38,7 +71,28 @@ type OrderItemDB struct {
 	ProductName string `json:"product_name"`
 
 	Quantity int     `json:"quantity"`
-	Subtotal float64 `json:"subtotal"`
+	Subtotal money.Amount `json:"subtotal"` // before the line discount
+
+	Discount       *Discount    `json:"discount,omitempty"`
+	DiscountAmount money.Amount `json:"discount_amount"`
+
+	// what the tailor works from; without a profile or version the order's measurements are used,
+	// and measurements sent with the item override the ones of the profile
+	MeasurementProfileID *int64            `json:"measurement_profile_id,omitempty"`
+	MeasurementVersionID *int64            `json:"measurement_version_id,omitempty"`
+	Measurements         map[string]string `json:"measurements"`
+	StyleOptions         StyleOptions      `json:"style_options"`
+	TailorNotes          string            `json:"tailor_notes"`
+	Photos               []Attachment      `json:"photos"` // image attachments of the item
+}
+
+// StyleOptions are the design choices of an order item
+type StyleOptions struct {
+	SleeveType string            `json:"sleeve_type,omitempty"`
+	Embroidery string            `json:"embroidery,omitempty"`
+	Stones     string            `json:"stones,omitempty"`
+	FabricCode string            `json:"fabric_code,omitempty"`
+	Extra      map[string]string `json:"extra,omitempty"` // any other option, by name
 }
 
 type OrderTransactionDB struct {
@@ -50,8 +104,15 @@ type OrderTransactionDB struct {
 	PaymentAccountName string    `json:"payment_account_name"`
 	DeliveredBy       *string   `json:"delivered_by,omitempty"`
 	QuantityDelivered int64     `json:"quantity_delivered"`
-	Amount            float64   `json:"amount"`
+	Amount            money.Amount   `json:"amount"`
+	Reference         string    `json:"reference,omitempty"`
+	VoucherCode       string    `json:"voucher_code,omitempty"` // paid with this gift voucher
+	LoyaltyPoints     int64     `json:"loyalty_points,omitempty"` // paid with this many loyalty points
 	TransactionType   string    `json:"transaction_type"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
+
+	// on a delivery, the money received split over several accounts; when
+	// given, it takes the place of payment_account_id and amount
+	Payments []Payment `json:"payments,omitempty"`
 }
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+const (
+	DOCUMENT_ORDER    = "order"
+	DOCUMENT_SALE     = "sale"
+	DOCUMENT_PURCHASE = "purchase"
+)
+
+// Payment is one part of the money received on an order, delivery or sale,
+// paid into one account. Reference is the card slip, transfer or cheque number.
+type Payment struct {
+	AccountID int64        `json:"account_id"`
+	Amount    money.Amount `json:"amount"`
+	Reference string       `json:"reference,omitempty"`
+}
+
+// OpenDocument is an order or sale of a customer that is not fully paid
+type OpenDocument struct {
+	DocumentType   string       `json:"document_type"` // order | sale
+	DocumentID     int64        `json:"document_id"`
+	MemoNo         string       `json:"memo_no"`
+	DocumentDate   time.Time    `json:"document_date"`
+	Status         string       `json:"status"`
+	TotalAmount    money.Amount `json:"total_amount"`
+	ReceivedAmount money.Amount `json:"received_amount"`
+	DueAmount      money.Amount `json:"due_amount"`
+}
+
+// PaymentAllocation is the part of a customer payment applied to one order or sale
+type PaymentAllocation struct {
+	DocumentType string       `json:"document_type"` // order | sale
+	DocumentID   int64        `json:"document_id"`
+	MemoNo       string       `json:"memo_no"`
+	Amount       money.Amount `json:"amount"`
+}
+
+// CustomerPayment is money received from a customer against outstanding dues.
+// Without allocations the payment settles the oldest open documents first; any
+// amount left over is kept as store credit.
+type CustomerPayment struct {
+	BranchID    int64                `json:"-"`
+	CustomerID  int64                `json:"customer_id"`
+	AccountID   int64                `json:"account_id"`
+	PaymentDate time.Time            `json:"payment_date"`
+	Amount      money.Amount         `json:"amount"`
+	Notes       string               `json:"notes"`
+	Allocations []*PaymentAllocation `json:"allocations,omitempty"`
+}
+
+// CustomerPaymentResult tells how a received payment was applied
+type CustomerPaymentResult struct {
+	MemoNo        string               `json:"memo_no"`
+	TransactionID int64                `json:"transaction_id"`
+	CustomerID    int64                `json:"customer_id"`
+	Amount        money.Amount         `json:"amount"`
+	Allocations   []*PaymentAllocation `json:"allocations"`
+	RemainingDue  money.Amount         `json:"remaining_due"`
+	StoreCredit   money.Amount         `json:"store_credit"` // unallocated amount kept as store credit
+}
+
+// OpenPurchase is a purchase that is not fully paid to its supplier
+type OpenPurchase struct {
+	PurchaseID   int64        `json:"purchase_id"`
+	MemoNo       string       `json:"memo_no"`
+	PurchaseDate time.Time    `json:"purchase_date"`
+	TotalAmount  money.Amount `json:"total_amount"`
+	PaidAmount   money.Amount `json:"paid_amount"`
+	DueAmount    money.Amount `json:"due_amount"`
+}
+
+// PurchaseAllocation is the part of a supplier payment applied to one purchase
+type PurchaseAllocation struct {
+	PurchaseID int64        `json:"purchase_id"`
+	MemoNo     string       `json:"memo_no"`
+	Amount     money.Amount `json:"amount"`
+}
+
+// SupplierPayment is money paid to a supplier against purchases booked unpaid
+// or part paid. Without allocations the payment settles the oldest open
+// purchases first; it cannot exceed what is owed.
+type SupplierPayment struct {
+	BranchID    int64                 `json:"-"`
+	SupplierID  int64                 `json:"supplier_id"`
+	AccountID   int64                 `json:"account_id"`
+	PaymentDate time.Time             `json:"payment_date"`
+	Amount      money.Amount          `json:"amount"`
+	Notes       string                `json:"notes"`
+	Allocations []*PurchaseAllocation `json:"allocations,omitempty"`
+}
+
+// SupplierPaymentResult tells how a supplier payment was applied
+type SupplierPaymentResult struct {
+	MemoNo           string                `json:"memo_no"`
+	TransactionID    int64                 `json:"transaction_id"`
+	SupplierID       int64                 `json:"supplier_id"`
+	Amount           money.Amount          `json:"amount"`
+	Allocations      []*PurchaseAllocation `json:"allocations"`
+	RemainingPayable money.Amount          `json:"remaining_payable"`
+}
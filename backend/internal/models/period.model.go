@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// ErrPeriodClosed is returned by every mutation whose document date falls in a
+// closed month; handlers answer it with 409 Conflict
+var ErrPeriodClosed = errors.New("accounting period is closed")
+
+const (
+	PERIOD_OPEN   = "open"
+	PERIOD_CLOSED = "closed"
+)
+const (
+	PERIOD_ACTION_CLOSE  = "close"
+	PERIOD_ACTION_REOPEN = "reopen"
+)
+
+// AccountingPeriod is a branch month that has been closed at least once
+type AccountingPeriod struct {
+	ID          int64      `json:"id"`
+	BranchID    int64      `json:"branch_id"`
+	PeriodMonth time.Time  `json:"period_month"` // first day of the month
+	Status      string     `json:"status"`
+	ClosedBy    *int64     `json:"closed_by"`
+	ClosedAt    *time.Time `json:"closed_at"`
+	ReopenedBy  *int64     `json:"reopened_by"`
+	ReopenedAt  *time.Time `json:"reopened_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// AccountingPeriodAudit records one close or re-open of a period
+type AccountingPeriodAudit struct {
+	ID           int64     `json:"id"`
+	PeriodID     int64     `json:"period_id"`
+	BranchID     int64     `json:"branch_id"`
+	PeriodMonth  time.Time `json:"period_month"`
+	Action       string    `json:"action"`
+	EmployeeID   *int64    `json:"employee_id"`
+	EmployeeName string    `json:"employee_name"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PeriodAdjustment corrects a document of a closed period with an entry dated in an open one
+type PeriodAdjustment struct {
+	BranchID       int64        `json:"branch_id"`
+	AdjustmentDate time.Time    `json:"adjustment_date"`
+	Reference      string       `json:"reference"` // memo no of the corrected document
+	FromType       string       `json:"from_type"`
+	FromID         int64        `json:"from_id"`
+	ToType         string       `json:"to_type"`
+	ToID           int64        `json:"to_id"`
+	Amount         money.Amount `json:"amount"`
+	Notes          string       `json:"notes"`
+
+	// set from the signed-in employee, not the request
+	EmployeeID   int64  `json:"-"`
+	EmployeeName string `json:"-"`
+}
+
+// PeriodAdjustmentRecord is a posted adjustment with who posted it
+type PeriodAdjustmentRecord struct {
+	ID             int64        `json:"id"`
+	BranchID       int64        `json:"branch_id"`
+	TransactionID  int64        `json:"transaction_id"`
+	MemoNo         string       `json:"memo_no"`
+	AdjustmentDate time.Time    `json:"adjustment_date"`
+	Reference      string       `json:"reference"`
+	FromType       string       `json:"from_type"`
+	FromID         int64        `json:"from_id"`
+	ToType         string       `json:"to_type"`
+	ToID           int64        `json:"to_id"`
+	Amount         money.Amount `json:"amount"`
+	Notes          string       `json:"notes"`
+	EmployeeID     int64        `json:"employee_id"`
+	EmployeeName   string       `json:"employee_name"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Print job statuses
+const (
+	PRINT_JOB_QUEUED   = "queued"
+	PRINT_JOB_PRINTING = "printing" // handed to a POS client, not yet confirmed
+	PRINT_JOB_DONE     = "done"
+	PRINT_JOB_FAILED   = "failed" // gave up after repeated failures; may be retried
+)
+
+// Documents a receipt is printed from
+const (
+	PRINT_DOCUMENT_ORDER = "order"
+	PRINT_DOCUMENT_SALE  = "sale"
+)
+
+// PrintJob is a thermal receipt queued for a branch's printer. Payload holds
+// the ESC/POS commands and is only sent to the client that takes the job.
+type PrintJob struct {
+	ID           int64      `json:"id"`
+	BranchID     int64      `json:"branch_id"`
+	Printer      string     `json:"printer"`
+	DocumentType string     `json:"document_type"`
+	DocumentID   int64      `json:"document_id"`
+	Kind         string     `json:"kind"`
+	MemoNo       string     `json:"memo_no"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	Error        string     `json:"error"`
+	CreatedBy    *int64     `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ClaimedAt    *time.Time `json:"claimed_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	Payload      []byte     `json:"payload,omitempty"` // base64 in JSON
+}
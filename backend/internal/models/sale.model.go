@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
 
 type Sale struct {
 	SaleDate           time.Time  `json:"sale_date"`
@@ -10,9 +14,9 @@ type Sale struct {
 	SalespersonName    string     `json:"salesperson_name"`
 	CustomerID         int64      `json:"customer_id"`
 	CustomerName       string     `json:"customer_name"`
-	TotalPayableAmount float64    `json:"total_payable_amount"`
-	PaidAmount         float64    `json:"paid_amount"`
-	DueAmount          float64    `json:"due_amount"`
+	TotalPayableAmount money.Amount    `json:"total_payable_amount"`
+	PaidAmount         money.Amount    `json:"paid_amount"`
+	DueAmount          money.Amount    `json:"due_amount"`
 	PaymentAccountID   int64      `json:"payment_account_id"`
 	PaymentAccountName string     `json:"payment_account_name"`
 	Notes              string     `json:"notes"`
@@ -31,13 +35,33 @@ type SaleDB struct {
 
 	// products
 	TotalItems       int64   `json:"total_items"`
-	TotalAmount      float64 `json:"total_amount"`
+	TotalAmount      money.Amount `json:"total_amount"`
 	PaymentAccountID int64   `json:"payment_account_id"`
-	ReceivedAmount   float64 `json:"received_amount"`
+	ReceivedAmount   money.Amount `json:"received_amount"`
+
+	// the money received split over several accounts; when given, it takes the
+	// place of payment_account_id and received_amount
+	Payments []Payment `json:"payments,omitempty"`
+
+	// part of the total paid from the customer's store credit (not included in received_amount on input)
+	StoreCreditAmount money.Amount `json:"store_credit_amount,omitempty"`
+
+	// parts of the total paid with gift vouchers (not included in received_amount on input)
+	Vouchers []VoucherRedemption `json:"vouchers,omitempty"`
+
+	// loyalty points redeemed for part of the total (their worth is not included in received_amount on input)
+	LoyaltyPoints int64 `json:"loyalty_points,omitempty"`
+	// points earned on it, less any taken back
+	PointsEarned int64 `json:"points_earned"`
 
 	Status string  `json:"status"`
 	Notes  *string `json:"notes,omitempty"`
 
+	CreditOverride *CreditOverride `json:"credit_override,omitempty"` // required when the sale takes the customer over the credit limit
+
+	DocumentDiscounts
+	DocumentTax
+
 	CreatedAt         time.Time            `json:"created_at"`
 	UpdatedAt         time.Time            `json:"updated_at"`
 	Items             []SaleItemDB        `json:"items"`
@@ -53,7 +77,10 @@ type SaleItemDB struct {
 	ProductName string `json:"product_name"`
 
 	Quantity int     `json:"quantity"`
-	Subtotal float64 `json:"subtotal"`
+	Subtotal money.Amount `json:"subtotal"` // before the line discount
+
+	Discount       *Discount    `json:"discount,omitempty"`
+	DiscountAmount money.Amount `json:"discount_amount"`
 }
 
 type SaleTransactionDB struct {
@@ -65,7 +92,10 @@ type SaleTransactionDB struct {
 	PaymentAccountName string    `json:"payment_account_name"`
 	DeliveredBy       *string   `json:"delivered_by,omitempty"`
 	QuantityDelivered int64     `json:"quantity_delivered"`
-	Amount            float64   `json:"amount"`
+	Amount            money.Amount   `json:"amount"`
+	Reference         string    `json:"reference,omitempty"`
+	VoucherCode       string    `json:"voucher_code,omitempty"` // paid with this gift voucher
+	LoyaltyPoints     int64     `json:"loyalty_points,omitempty"` // paid with this many loyalty points
 	TransactionType   string    `json:"transaction_type"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+const (
+	STATEMENT_ORDER      = "order"
+	STATEMENT_SALE       = "sale"
+	STATEMENT_PAYMENT    = "payment"
+	STATEMENT_REFUND     = "refund"
+	STATEMENT_ADJUSTMENT = "adjustment"
+)
+
+// StatementLine is one entry of a customer statement. Debits increase what
+// the customer owes, credits reduce it.
+type StatementLine struct {
+	Date        time.Time    `json:"date"`
+	Type        string       `json:"type"` // order | sale | payment | refund | adjustment
+	Reference   string       `json:"reference"`
+	Description string       `json:"description"`
+	Debit       money.Amount `json:"debit"`
+	Credit      money.Amount `json:"credit"`
+	Balance     money.Amount `json:"balance"`
+}
+
+// CustomerStatement is the statement of account of a customer for a date range
+type CustomerStatement struct {
+	Customer       *Customer           `json:"customer"` // carries the measurement summary
+	BranchName     string              `json:"branch_name"`
+	StartDate      time.Time           `json:"start_date"`
+	EndDate        time.Time           `json:"end_date"`
+	OpeningBalance money.Amount        `json:"opening_balance"`
+	Lines          []*StatementLine    `json:"lines"`
+	TotalDebit     money.Amount        `json:"total_debit"`
+	TotalCredit    money.Amount        `json:"total_credit"`
+	ClosingBalance money.Amount        `json:"closing_balance"`
+	StoreCredit    *StoreCreditHistory `json:"store_credit"` // money held for the customer; already netted in the balances above
+	GeneratedAt    time.Time           `json:"generated_at"`
+}
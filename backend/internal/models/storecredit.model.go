@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+const (
+	STORE_CREDIT_TOPUP        = "topup"        // money paid in ahead of any order
+	STORE_CREDIT_OVERPAYMENT  = "overpayment"  // payment above what the customer owed
+	STORE_CREDIT_REFUND       = "refund"       // money paid on an order or sale handed back as credit
+	STORE_CREDIT_CANCELLATION = "cancellation" // money paid on a cancelled order
+	STORE_CREDIT_SPEND        = "spend"        // credit used to pay an order or sale
+	STORE_CREDIT_WITHDRAWAL   = "withdrawal"   // credit paid out in cash
+)
+
+// StoreCreditEntry is one movement of a customer's store credit. Amount is
+// positive when credit is added and negative when it is used.
+type StoreCreditEntry struct {
+	ID            int64        `json:"id"`
+	BranchID      int64        `json:"branch_id"`
+	CustomerID    int64        `json:"customer_id"`
+	EntryDate     time.Time    `json:"entry_date"`
+	EntryType     string       `json:"entry_type"`
+	Amount        money.Amount `json:"amount"`
+	AccountID     *int64       `json:"account_id,omitempty"`
+	DocumentType  *string      `json:"document_type,omitempty"` // order | sale
+	DocumentID    *int64       `json:"document_id,omitempty"`
+	TransactionID *int64       `json:"transaction_id,omitempty"`
+	MemoNo        string       `json:"memo_no"`
+	Notes         string       `json:"notes"`
+	Balance       money.Amount `json:"balance"` // running balance after the entry
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// StoreCreditRequest tops up, pays out or refunds into a customer's store credit.
+// Top-ups and withdrawals need an account, refunds need the order or sale.
+type StoreCreditRequest struct {
+	BranchID     int64        `json:"-"`
+	CustomerID   int64        `json:"customer_id"`
+	AccountID    int64        `json:"account_id"`
+	DocumentType string       `json:"document_type"` // order | sale
+	DocumentID   int64        `json:"document_id"`
+	Amount       money.Amount `json:"amount"`
+	EntryDate    time.Time    `json:"entry_date"`
+	Notes        string       `json:"notes"`
+}
+
+// StoreCreditHistory is a customer's store credit movements for a date range
+type StoreCreditHistory struct {
+	CustomerID     int64               `json:"customer_id"`
+	StartDate      time.Time           `json:"start_date"`
+	EndDate        time.Time           `json:"end_date"`
+	OpeningBalance money.Amount        `json:"opening_balance"`
+	Entries        []*StoreCreditEntry `json:"entries"`
+	ClosingBalance money.Amount        `json:"closing_balance"`
+	Balance        money.Amount        `json:"balance"` // current balance
+}
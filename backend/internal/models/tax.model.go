@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+// What a tax rate applies to
+const (
+	TAX_ON_SALES     = "sales"     // orders and sales: tax charged to customers
+	TAX_ON_PURCHASES = "purchases" // purchases: tax paid to suppliers
+)
+
+// TAX_CATEGORY_STANDARD is the tax category of products not given another
+const TAX_CATEGORY_STANDARD = "standard"
+
+// TaxRate is a named tax charged on a product category (or, for purchases, a
+// purchase category) between two dates, in one branch or all of them. A rate
+// set for a branch takes the place of the rate of the same name and category
+// set for all branches.
+type TaxRate struct {
+	ID        int64        `json:"id"`
+	BranchID  *int64       `json:"branch_id"` // nil applies in every branch
+	AppliesTo string       `json:"applies_to"`
+	Category  string       `json:"category"`
+	Name      string       `json:"name"`
+	Rate      money.Amount `json:"rate"` // percentage, e.g. 5 for 5%
+	StartsOn  time.Time    `json:"starts_on"`
+	EndsOn    *time.Time   `json:"ends_on,omitempty"` // nil: until further notice
+	Active    bool         `json:"active"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// TaxLine is a tax charged on a document: the part of it in one tax category at one rate
+type TaxLine struct {
+	TaxRateID     int64        `json:"tax_rate_id"`
+	Name          string       `json:"name"`
+	Category      string       `json:"category"`
+	Rate          money.Amount `json:"rate"`
+	TaxableAmount money.Amount `json:"taxable_amount"` // before the tax
+	TaxAmount     money.Amount `json:"tax_amount"`
+}
+
+// DocumentTax is the tax of an order, sale or purchase. It is worked out on
+// what is left after discounts; with prices that include tax the total stays
+// as it is and the tax is taken out of it, otherwise the tax is added to it.
+type DocumentTax struct {
+	PricesIncludeTax *bool        `json:"prices_include_tax,omitempty"` // nil on input takes the branch setting
+	NetAmount        money.Amount `json:"net_amount"`                   // the total before tax
+	TaxAmount        money.Amount `json:"tax_amount"`
+	Taxes            []TaxLine    `json:"taxes"`
+}
+
+// TaxSettings are the tax details of a branch
+type TaxSettings struct {
+	TaxID            string `json:"tax_id"`             // printed as the seller's on tax invoices
+	PricesIncludeTax bool   `json:"prices_include_tax"` // default for new documents
+}
+
+// TaxSummaryLine is what was charged or paid under one tax at one rate
+type TaxSummaryLine struct {
+	Name          string       `json:"name"`
+	Rate          money.Amount `json:"rate"`
+	Documents     int64        `json:"documents"`
+	TaxableAmount money.Amount `json:"taxable_amount"`
+	TaxAmount     money.Amount `json:"tax_amount"`
+}
+
+// TaxSummary sets the tax charged on the sales and orders of a branch in a
+// period against the tax paid on its purchases
+type TaxSummary struct {
+	BranchID  int64     `json:"branch_id"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+
+	Output     []*TaxSummaryLine `json:"output"` // charged on sales and orders
+	Input      []*TaxSummaryLine `json:"input"`  // paid on purchases
+	OutputTax  money.Amount      `json:"output_tax"`
+	InputTax   money.Amount      `json:"input_tax"`
+	NetPayable money.Amount      `json:"net_payable"` // negative when more was paid than charged
+}
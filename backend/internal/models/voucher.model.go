@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+)
+
+const (
+	VOUCHER_ISSUE  = "issue"  // voucher sold
+	VOUCHER_REDEEM = "redeem" // voucher used to pay an order or sale
+
+	VOUCHER_ACTIVE   = "active"
+	VOUCHER_REDEEMED = "redeemed" // nothing left on it
+	VOUCHER_EXPIRED  = "expired"
+)
+
+// GiftVoucher is a voucher sold in one branch and good in every branch until
+// ExpiresOn. Balance is what is left of the face value.
+type GiftVoucher struct {
+	ID         int64        `json:"id"`
+	Code       string       `json:"code"`
+	BranchID   int64        `json:"branch_id"` // issuing branch
+	BranchName string       `json:"branch_name,omitempty"`
+	CustomerID *int64       `json:"customer_id,omitempty"`
+	FaceValue  money.Amount `json:"face_value"`
+	Balance    money.Amount `json:"balance"`
+	IssuedOn   time.Time    `json:"issued_on"`
+	ExpiresOn  time.Time    `json:"expires_on"`
+	Status     string       `json:"status"` // active | redeemed | expired
+	MemoNo     string       `json:"memo_no"`
+	Notes      string       `json:"notes"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// VoucherSaleRequest sells a voucher; without a code one is generated and
+// without an expiry it is good for a year
+type VoucherSaleRequest struct {
+	BranchID   int64        `json:"-"`
+	Code       string       `json:"code"`
+	FaceValue  money.Amount `json:"face_value"`
+	ExpiresOn  *time.Time   `json:"expires_on"`
+	AccountID  int64        `json:"account_id"`
+	CustomerID *int64       `json:"customer_id"`
+	SaleDate   time.Time    `json:"sale_date"`
+	Notes      string       `json:"notes"`
+}
+
+// VoucherRedemption pays part of an order or sale with a voucher
+type VoucherRedemption struct {
+	Code   string       `json:"code"`
+	Amount money.Amount `json:"amount"`
+}
+
+// VoucherRedeemRequest pays an order or sale already recorded with a voucher
+type VoucherRedeemRequest struct {
+	BranchID     int64        `json:"-"`
+	Code         string       `json:"code"`
+	DocumentType string       `json:"document_type"` // order | sale
+	DocumentID   int64        `json:"document_id"`
+	Amount       money.Amount `json:"amount"`
+	EntryDate    time.Time    `json:"entry_date"`
+}
+
+// VoucherEntry is one movement of a voucher
+type VoucherEntry struct {
+	ID            int64        `json:"id"`
+	VoucherID     int64        `json:"voucher_id"`
+	Code          string       `json:"code"`
+	BranchID      int64        `json:"branch_id"`
+	EntryDate     time.Time    `json:"entry_date"`
+	EntryType     string       `json:"entry_type"`
+	Amount        money.Amount `json:"amount"`
+	AccountID     *int64       `json:"account_id,omitempty"`
+	DocumentType  *string      `json:"document_type,omitempty"`
+	DocumentID    *int64       `json:"document_id,omitempty"`
+	TransactionID *int64       `json:"transaction_id,omitempty"`
+	MemoNo        string       `json:"memo_no"`
+	Notes         string       `json:"notes"`
+	Balance       money.Amount `json:"balance"` // left on the voucher after the entry
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// VoucherLedger is the voucher movements of a branch, or of one voucher, in a
+// date range
+type VoucherLedger struct {
+	BranchID       int64           `json:"branch_id"`
+	Code           string          `json:"code,omitempty"`
+	StartDate      time.Time       `json:"start_date"`
+	EndDate        time.Time       `json:"end_date"`
+	OpeningBalance money.Amount    `json:"opening_balance"`
+	Issued         money.Amount    `json:"issued"`
+	Redeemed       money.Amount    `json:"redeemed"`
+	ClosingBalance money.Amount    `json:"closing_balance"`
+	Entries        []*VoucherEntry `json:"entries"`
+}
@@ -0,0 +1,291 @@
+// Package money holds amounts of Qatari riyals as a whole number of dirhams
+// (1/100 riyal), matching the NUMERIC(12,2) columns they are stored in.
+//
+// Amounts add, subtract and compare exactly with the usual operators. Any
+// result with more than two decimals (a share, a rate, a float from outside)
+// is rounded to the dirham half away from zero, the way the database rounds
+// NUMERIC values.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Amount is a sum of money in dirhams
+type Amount int64
+
+// Zero is no money
+const Zero Amount = 0
+
+// Decimals is the number of decimals an amount is kept and written with
+const Decimals = 2
+
+const scale = 100
+
+// FromCents returns the amount of n dirhams
+func FromCents(n int64) Amount {
+	return Amount(n)
+}
+
+// FromInt returns the amount of n riyals
+func FromInt(n int64) Amount {
+	return Amount(n * scale)
+}
+
+// FromFloat rounds f riyals to the dirham, reading f as the decimal it
+// prints as so that 1.005 rounds up
+func FromFloat(f float64) Amount {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	v, err := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Amount(math.Round(f * scale))
+	}
+	return v
+}
+
+// Parse reads an amount such as "1250", "-12.5", "0.125" or "1.2e3"; digits
+// past the second decimal are rounded
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("money: empty amount")
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.Contains(s, "/") {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+	return fromRat(r)
+}
+
+// fromRat rounds r riyals to the dirham
+func fromRat(r *big.Rat) (Amount, error) {
+	r = new(big.Rat).Mul(r, big.NewRat(scale, 1))
+	return roundQuo(r.Num(), r.Denom())
+}
+
+// roundQuo returns num/den rounded half away from zero
+func roundQuo(num, den *big.Int) (Amount, error) {
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	if m.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(new(big.Int).Abs(den)) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign()*den.Sign())))
+	}
+	if !q.IsInt64() {
+		return 0, errors.New("money: amount out of range")
+	}
+	return Amount(q.Int64()), nil
+}
+
+// Cents returns the amount in dirhams
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// Float64 returns the amount in riyals, for display and ratios only
+func (a Amount) Float64() float64 {
+	return float64(a) / scale
+}
+
+// IsZero reports whether a is no money
+func (a Amount) IsZero() bool {
+	return a == 0
+}
+
+// Abs returns a without its sign
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Mul returns a times the whole number n, e.g. a unit price times a quantity
+func (a Amount) Mul(n int64) Amount {
+	return a * Amount(n)
+}
+
+// MulFrac returns a times num/den rounded to the dirham, e.g. a.MulFrac(5, 100)
+// for 5% of a
+func (a Amount) MulFrac(num, den int64) Amount {
+	if den == 0 {
+		panic("money: division by zero")
+	}
+	n := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(num))
+	q, err := roundQuo(n, big.NewInt(den))
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// Split divides a into n parts that differ by at most a dirham and add up to
+// a exactly; the larger parts come first
+func (a Amount) Split(n int) []Amount {
+	if n <= 0 {
+		return nil
+	}
+	parts := make([]Amount, n)
+	each, rest := a/Amount(n), a%Amount(n)
+	for i := range parts {
+		parts[i] = each
+		switch {
+		case rest > 0:
+			parts[i]++
+			rest--
+		case rest < 0:
+			parts[i]--
+			rest++
+		}
+	}
+	return parts
+}
+
+// Min returns the smaller of a and b
+func Min(a, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of a and b
+func Max(a, b Amount) Amount {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// String writes a with two decimals, e.g. "-1250.50"
+func (a Amount) String() string {
+	sign := ""
+	n := int64(a)
+	if n < 0 {
+		sign = "-"
+	}
+	u := uint64(n)
+	if n < 0 {
+		u = uint64(-n)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, u/scale, u%scale)
+}
+
+// ---------------------------------------------------------------------------
+// JSON
+// ---------------------------------------------------------------------------
+
+var jsonStrings atomic.Bool
+
+// SetJSONStrings selects how amounts are written to JSON: as strings such as
+// "12.50" when on, or as numbers such as 12.50 (the default). Both forms are
+// read either way.
+func SetJSONStrings(on bool) {
+	jsonStrings.Store(on)
+}
+
+// MarshalJSON writes a as a number or a string; see SetJSONStrings
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if jsonStrings.Load() {
+		return []byte(`"` + a.String() + `"`), nil
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a number or a string such as "12.50"; null leaves a
+// unchanged
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	} else if len(s) > 0 && s[0] == '"' {
+		return fmt.Errorf("money: invalid amount %s", data)
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// PostgreSQL (pgx)
+// ---------------------------------------------------------------------------
+
+// ScanNumeric reads a NUMERIC value, rounding it to the dirham
+func (a *Amount) ScanNumeric(n pgtype.Numeric) error {
+	if !n.Valid {
+		return errors.New("money: cannot scan NULL into money.Amount")
+	}
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return errors.New("money: cannot scan NaN or infinity into money.Amount")
+	}
+	num := new(big.Int).Set(n.Int)
+	den := big.NewInt(1)
+	exp := int64(n.Exp) + Decimals
+	if exp >= 0 {
+		num.Mul(num, new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil))
+	} else {
+		den.Exp(big.NewInt(10), big.NewInt(-exp), nil)
+	}
+	v, err := roundQuo(num, den)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// ScanFloat64 reads a double precision value, rounding it to the dirham
+func (a *Amount) ScanFloat64(f pgtype.Float8) error {
+	if !f.Valid {
+		return errors.New("money: cannot scan NULL into money.Amount")
+	}
+	*a = FromFloat(f.Float64)
+	return nil
+}
+
+// ScanInt64 reads an integer as whole riyals
+func (a *Amount) ScanInt64(n pgtype.Int8) error {
+	if !n.Valid {
+		return errors.New("money: cannot scan NULL into money.Amount")
+	}
+	*a = FromInt(n.Int64)
+	return nil
+}
+
+// NumericValue writes a as a NUMERIC with two decimals
+func (a Amount) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(a)), Exp: -Decimals, Valid: true}, nil
+}
+
+// Float64Value writes a for a double precision parameter
+func (a Amount) Float64Value() (pgtype.Float8, error) {
+	return pgtype.Float8{Float64: a.Float64(), Valid: true}, nil
+}
+
+// Int64Value writes a for an integer parameter, which can only take whole
+// riyals
+func (a Amount) Int64Value() (pgtype.Int8, error) {
+	if a%scale != 0 {
+		return pgtype.Int8{}, fmt.Errorf("money: %s is not a whole amount", a)
+	}
+	return pgtype.Int8{Int64: int64(a / scale), Valid: true}, nil
+}
+
+// TextValue writes a for a text parameter
+func (a Amount) TextValue() (pgtype.Text, error) {
+	return pgtype.Text{String: a.String(), Valid: true}, nil
+}
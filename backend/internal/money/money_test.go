@@ -0,0 +1,261 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{"1250", 125000, false},
+		{"-12.5", -1250, false},
+		{" 7 ", 700, false},
+		{"0.125", 13, false},
+		{"-0.125", -13, false},
+		{"0.124", 12, false},
+		{"1.005", 101, false},
+		{"1.2e3", 120000, false},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"1/2", 0, true},
+		{"1e30", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Amount
+	}{
+		{1.005, 101},
+		{0.1 + 0.2, 30},
+		{-2.675, -268},
+		{12, 1200},
+		{math.NaN(), 0},
+		{math.Inf(1), 0},
+	}
+	for _, tt := range tests {
+		if got := FromFloat(tt.in); got != tt.want {
+			t.Errorf("FromFloat(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0.00"},
+		{-5, "-0.05"},
+		{125050, "1250.50"},
+		{-125050, "-1250.50"},
+		{FromInt(3), "3.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestMulFrac(t *testing.T) {
+	tests := []struct {
+		a        Amount
+		num, den int64
+		want     Amount
+	}{
+		{1000, 5, 100, 50},
+		{333, 1, 2, 167},
+		{-333, 1, 2, -167},
+		{100, 1, 3, 33},
+		{200, 2, 3, 133},
+		{100, -1, 2, -50},
+		{0, 7, 9, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.a.MulFrac(tt.num, tt.den); got != tt.want {
+			t.Errorf("Amount(%d).MulFrac(%d, %d) = %d, want %d", int64(tt.a), tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		n    int
+		want []Amount
+	}{
+		{100, 3, []Amount{34, 33, 33}},
+		{-100, 3, []Amount{-34, -33, -33}},
+		{101, 2, []Amount{51, 50}},
+		{90, 3, []Amount{30, 30, 30}},
+		{1, 3, []Amount{1, 0, 0}},
+		{0, 2, []Amount{0, 0}},
+	}
+	for _, tt := range tests {
+		got := tt.a.Split(tt.n)
+		if len(got) != len(tt.want) {
+			t.Fatalf("Amount(%d).Split(%d) = %v, want %v", int64(tt.a), tt.n, got, tt.want)
+		}
+		var sum Amount
+		for i := range got {
+			sum += got[i]
+			if got[i] != tt.want[i] {
+				t.Errorf("Amount(%d).Split(%d) = %v, want %v", int64(tt.a), tt.n, got, tt.want)
+				break
+			}
+		}
+		if sum != tt.a {
+			t.Errorf("Amount(%d).Split(%d) adds up to %d", int64(tt.a), tt.n, sum)
+		}
+	}
+	if got := Amount(100).Split(0); got != nil {
+		t.Errorf("Split(0) = %v, want nil", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type doc struct {
+		Total Amount  `json:"total"`
+		Paid  *Amount `json:"paid"`
+	}
+	defer SetJSONStrings(false)
+
+	tests := []struct {
+		strings bool
+		want    string
+	}{
+		{false, `{"total":1250.50,"paid":-0.05}`},
+		{true, `{"total":"1250.50","paid":"-0.05"}`},
+	}
+	for _, tt := range tests {
+		SetJSONStrings(tt.strings)
+		paid := Amount(-5)
+		data, err := json.Marshal(doc{Total: 125050, Paid: &paid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("Marshal with strings=%v = %s, want %s", tt.strings, data, tt.want)
+		}
+		// both forms are read back whatever is written
+		var back doc
+		if err := json.Unmarshal(data, &back); err != nil {
+			t.Fatal(err)
+		}
+		if back.Total != 125050 || back.Paid == nil || *back.Paid != -5 {
+			t.Errorf("round trip of %s = %+v", data, back)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{`12.5`, 1250, false},
+		{`"12.50"`, 1250, false},
+		{`0.125`, 13, false},
+		{`null`, 99, false}, // left unchanged
+		{`"abc"`, 0, true},
+		{`"12`, 0, true},
+		{`""`, 0, true},
+		{`true`, 0, true},
+	}
+	for _, tt := range tests {
+		a := Amount(99)
+		err := a.UnmarshalJSON([]byte(tt.in))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("UnmarshalJSON(%s) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && a != tt.want {
+			t.Errorf("UnmarshalJSON(%s) = %d, want %d", tt.in, a, tt.want)
+		}
+	}
+}
+
+func TestScanNumeric(t *testing.T) {
+	tests := []struct {
+		in      pgtype.Numeric
+		want    Amount
+		wantErr bool
+	}{
+		{pgtype.Numeric{Int: big.NewInt(125050), Exp: -2, Valid: true}, 125050, false},
+		{pgtype.Numeric{Int: big.NewInt(12345), Exp: -3, Valid: true}, 1235, false},
+		{pgtype.Numeric{Int: big.NewInt(-12345), Exp: -3, Valid: true}, -1235, false},
+		{pgtype.Numeric{Int: big.NewInt(5), Exp: 1, Valid: true}, 5000, false},
+		{pgtype.Numeric{}, 0, true},
+		{pgtype.Numeric{NaN: true, Valid: true}, 0, true},
+		{pgtype.Numeric{InfinityModifier: pgtype.Infinity, Valid: true}, 0, true},
+		{pgtype.Numeric{Int: big.NewInt(1), Exp: 30, Valid: true}, 0, true},
+	}
+	for _, tt := range tests {
+		var a Amount
+		err := a.ScanNumeric(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ScanNumeric(%+v) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if a != tt.want {
+			t.Errorf("ScanNumeric(%+v) = %d, want %d", tt.in, a, tt.want)
+		}
+	}
+
+	// what is written reads back the same
+	n, err := Amount(-125050).NumericValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Amount
+	if err := back.ScanNumeric(n); err != nil || back != -125050 {
+		t.Errorf("NumericValue round trip = %d, %v", back, err)
+	}
+}
+
+func TestScanOthers(t *testing.T) {
+	var a Amount
+	if err := a.ScanFloat64(pgtype.Float8{}); err == nil {
+		t.Error("ScanFloat64(NULL): expected an error")
+	}
+	if err := a.ScanFloat64(pgtype.Float8{Float64: 2.675, Valid: true}); err != nil || a != 268 {
+		t.Errorf("ScanFloat64(2.675) = %d, %v", a, err)
+	}
+	if err := a.ScanInt64(pgtype.Int8{}); err == nil {
+		t.Error("ScanInt64(NULL): expected an error")
+	}
+	if err := a.ScanInt64(pgtype.Int8{Int64: 3, Valid: true}); err != nil || a != 300 {
+		t.Errorf("ScanInt64(3) = %d, %v", a, err)
+	}
+
+	if _, err := Amount(150).Int64Value(); err == nil {
+		t.Error("Int64Value(1.50): expected an error")
+	}
+	if v, err := Amount(300).Int64Value(); err != nil || v.Int64 != 3 {
+		t.Errorf("Int64Value(3.00) = %d, %v", v.Int64, err)
+	}
+	if v, _ := Amount(-5).TextValue(); v.String != "-0.05" {
+		t.Errorf("TextValue(-0.05) = %q", v.String)
+	}
+}
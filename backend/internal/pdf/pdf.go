@@ -0,0 +1,473 @@
+// Package pdf writes simple single-column PDF documents: text in the built-in
+// Helvetica fonts or an embedded TrueType font, lines, filled boxes and raster
+// images. It has just what the printed statements, invoices and job sheets need.
+//
+// Coordinates are in points (1/72 inch) measured from the top-left corner of
+// the page, y growing downward.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/projuktisheba/erp-mini-api/internal/font"
+)
+
+// Page sizes in points
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Text alignment relative to the x position
+const (
+	AlignLeft = iota
+	AlignRight
+	AlignCenter
+)
+
+type page struct {
+	content bytes.Buffer
+	images  []int // indexes into Document.images
+}
+
+type image struct {
+	width, height int
+	gray          bool
+	data          []byte // zlib compressed samples
+}
+
+// embedded is a TrueType font written into the document
+type embedded struct {
+	font *font.Font
+	used map[uint16]rune // glyphs drawn, with the character each stands for
+}
+
+// Document is a PDF under construction
+type Document struct {
+	width, height float64
+	pages         []*page
+	images        []*image
+	fonts         []*embedded
+
+	// regular and bold text font when TrueType fonts are in use; nil for Helvetica
+	regular, boldFont *embedded
+
+	bold     bool
+	fontSize float64
+}
+
+// New starts an empty A4 portrait document
+func New() *Document {
+	return &Document{width: A4Width, height: A4Height, fontSize: 10}
+}
+
+// Width and Height return the page size
+func (d *Document) Width() float64  { return d.width }
+func (d *Document) Height() float64 { return d.height }
+
+// AddPage starts a new page; drawing calls go to the last page
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &page{})
+}
+
+// PageCount returns the number of pages added so far
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+func (d *Document) current() *page {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// SetFont selects regular or bold Helvetica at the given size
+func (d *Document) SetFont(bold bool, size float64) {
+	d.bold = bold
+	d.fontSize = size
+}
+
+// UseFonts draws all text with the given TrueType fonts instead of Helvetica,
+// which is needed for text outside Latin-1 such as Arabic. bold may be nil to
+// use the regular font for bold text as well.
+func (d *Document) UseFonts(regular, bold *font.Font) {
+	d.fonts = nil
+	d.regular, d.boldFont = nil, nil
+	if regular == nil {
+		return
+	}
+	d.regular = &embedded{font: regular, used: make(map[uint16]rune)}
+	d.fonts = append(d.fonts, d.regular)
+	d.boldFont = d.regular
+	if bold != nil && bold != regular {
+		d.boldFont = &embedded{font: bold, used: make(map[uint16]rune)}
+		d.fonts = append(d.fonts, d.boldFont)
+	}
+}
+
+// textFont returns the TrueType font of the current style, or nil for Helvetica
+func (d *Document) textFont() *embedded {
+	if d.bold {
+		return d.boldFont
+	}
+	return d.regular
+}
+
+// FontSize returns the current font size
+func (d *Document) FontSize() float64 {
+	return d.fontSize
+}
+
+// TextWidth measures s in the current font
+func (d *Document) TextWidth(s string) float64 {
+	if f := d.textFont(); f != nil {
+		return float64(f.font.Width(s)) * d.fontSize / float64(f.font.UnitsPerEm())
+	}
+	widths := &helvetica
+	if d.bold {
+		widths = &helveticaBold
+	}
+	var units int
+	for _, b := range encode(s) {
+		if b >= 32 && b < 127 {
+			units += widths[b-32]
+		} else {
+			units += 556
+		}
+	}
+	return float64(units) * d.fontSize / 1000
+}
+
+// Text draws s with its baseline at y, aligned on x. With TrueType fonts,
+// right-to-left text is shaped and reordered for display.
+func (d *Document) Text(x, y float64, s string, align int) {
+	if f := d.textFont(); f != nil {
+		d.trueTypeText(f, x, y, s, align)
+		return
+	}
+	switch align {
+	case AlignRight:
+		x -= d.TextWidth(s)
+	case AlignCenter:
+		x -= d.TextWidth(s) / 2
+	}
+	font := "F1"
+	if d.bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&d.current().content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		font, d.fontSize, x, d.height-y, escape(encode(s)))
+}
+
+func (d *Document) trueTypeText(f *embedded, x, y float64, s string, align int) {
+	glyphs := f.font.Shape(s)
+	var units int
+	var hex strings.Builder
+	for _, g := range glyphs {
+		units += g.Advance
+		f.used[g.ID] = g.Rune
+		fmt.Fprintf(&hex, "%04X", g.ID)
+	}
+	width := float64(units) * d.fontSize / float64(f.font.UnitsPerEm())
+	switch align {
+	case AlignRight:
+		x -= width
+	case AlignCenter:
+		x -= width / 2
+	}
+	fmt.Fprintf(&d.current().content, "BT /F%d %.2f Tf %.2f %.2f Td <%s> Tj ET\n",
+		d.fontIndex(f), d.fontSize, x, d.height-y, hex.String())
+}
+
+// fontIndex returns the resource number of an embedded font (F3, F4, ...)
+func (d *Document) fontIndex(f *embedded) int {
+	for i, e := range d.fonts {
+		if e == f {
+			return 3 + i
+		}
+	}
+	return 1
+}
+
+// Fit shortens s with an ellipsis so it is no wider than width
+func (d *Document) Fit(s string, width float64) string {
+	if d.TextWidth(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 && d.TextWidth(string(r)+"...") > width {
+		r = r[:len(r)-1]
+	}
+	return string(r) + "..."
+}
+
+// Wrap splits s into lines no wider than width, breaking on spaces
+func (d *Document) Wrap(s string, width float64) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			next := word
+			if line != "" {
+				next = line + " " + word
+			}
+			if line != "" && d.TextWidth(next) > width {
+				lines = append(lines, line)
+				next = word
+			}
+			line = next
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Line draws a line of the given width in points
+func (d *Document) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&d.current().content, "%.2f w %.2f %.2f m %.2f %.2f l S\n",
+		width, x1, d.height-y1, x2, d.height-y2)
+}
+
+// Rect draws a box; gray is the fill level (0 black, 1 white) or negative for an outline
+func (d *Document) Rect(x, y, w, h, gray float64) {
+	if gray < 0 {
+		fmt.Fprintf(&d.current().content, "0.5 w %.2f %.2f %.2f %.2f re S\n", x, d.height-y-h, w, h)
+		return
+	}
+	fmt.Fprintf(&d.current().content, "q %.2f g %.2f %.2f %.2f %.2f re f Q\n", gray, x, d.height-y-h, w, h)
+}
+
+// Image draws an 8-bit raster scaled into the box at x, y. pixels holds one
+// byte per pixel for gray images or three (RGB) otherwise, row by row.
+func (d *Document) Image(x, y, w, h float64, width, height int, gray bool, pixels []byte) error {
+	channels := 3
+	if gray {
+		channels = 1
+	}
+	if width <= 0 || height <= 0 || len(pixels) != width*height*channels {
+		return fmt.Errorf("pdf: image data does not match %dx%d", width, height)
+	}
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(pixels); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	d.images = append(d.images, &image{width: width, height: height, gray: gray, data: buf.Bytes()})
+	idx := len(d.images) - 1
+
+	p := d.current()
+	p.images = append(p.images, idx)
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, x, d.height-y-h, idx)
+	return nil
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo renders the document to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	// object numbers: 1 catalog, 2 page tree, 3-4 fonts, then images, then the
+	// objects of each embedded font, then a page and its content per page
+	const firstImage = 5
+	firstFont := firstImage + len(d.images)
+	firstPage := firstFont + fontObjects*len(d.fonts)
+
+	var out bytes.Buffer
+	offsets := []int{0}
+	obj := func(body string, stream []byte) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\n", len(offsets)-1, body)
+		if stream != nil {
+			out.WriteString("stream\n")
+			out.Write(stream)
+			out.WriteString("\nendstream\n")
+		}
+		out.WriteString("endobj\n")
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)), nil)
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>", nil)
+
+	for _, img := range d.images {
+		space := "/DeviceRGB"
+		if img.gray {
+			space = "/DeviceGray"
+		}
+		obj(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+			img.width, img.height, space, len(img.data)), img.data)
+	}
+
+	for i, f := range d.fonts {
+		if err := writeFont(obj, f, firstFont+fontObjects*i); err != nil {
+			return 0, err
+		}
+	}
+	fontResources := "/F1 3 0 R /F2 4 0 R"
+	for i := range d.fonts {
+		fontResources += fmt.Sprintf(" /F%d %d 0 R", 3+i, firstFont+fontObjects*i)
+	}
+
+	for i, p := range d.pages {
+		var xobjects strings.Builder
+		for _, idx := range p.images {
+			fmt.Fprintf(&xobjects, "/Im%d %d 0 R ", idx, firstImage+idx)
+		}
+		resources := "/Font << " + fontResources + " >>"
+		if xobjects.Len() > 0 {
+			resources += " /XObject << " + xobjects.String() + ">>"
+		}
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << %s >> /Contents %d 0 R >>",
+			d.width, d.height, resources, firstPage+2*i+1), nil)
+
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(p.content.Bytes()); err != nil {
+			return 0, err
+		}
+		if err := zw.Close(); err != nil {
+			return 0, err
+		}
+		obj(fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>", content.Len()), content.Bytes())
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, off := range offsets[1:] {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets), xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+// fontObjects is the number of objects written per embedded font
+const fontObjects = 5
+
+// writeFont writes an embedded font as a Type0 font with Identity-H encoding,
+// so text is drawn by glyph id; first is the number of its first object
+func writeFont(obj func(body string, stream []byte), e *embedded, first int) error {
+	f := e.font
+	scale := func(v int) int { return v * 1000 / f.UnitsPerEm() }
+
+	glyphs := make([]int, 0, len(e.used))
+	ids := make([]uint16, 0, len(e.used))
+	for g := range e.used {
+		glyphs = append(glyphs, int(g))
+		ids = append(ids, g)
+	}
+	sort.Ints(glyphs)
+	data := f.Subset(ids)
+
+	// subset fonts are named with a tag made from their glyphs
+	tag := crc32.ChecksumIEEE([]byte(fmt.Sprint(glyphs)))
+	var prefix [6]byte
+	for i := range prefix {
+		prefix[i] = 'A' + byte(tag%26)
+		tag /= 26
+	}
+	name := string(prefix[:]) + "+" + f.Name()
+	var widths strings.Builder
+	for _, g := range glyphs {
+		fmt.Fprintf(&widths, "%d [%d] ", g, scale(f.Advance(uint16(g))))
+	}
+
+	var file bytes.Buffer
+	zw := zlib.NewWriter(&file)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	// character codes for copying and searching text
+	var cmap bytes.Buffer
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for start := 0; start < len(glyphs); start += 100 {
+		chunk := glyphs[start:min(start+100, len(glyphs))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+		for _, g := range chunk {
+			fmt.Fprintf(&cmap, "<%04X> <", g)
+			for _, u := range utf16.Encode([]rune{e.used[uint16(g)]}) {
+				fmt.Fprintf(&cmap, "%04X", u)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+
+	bbox := f.BBox()
+	obj(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, first+1, first+4), nil)
+	obj(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW %d /W [%s] >>",
+		name, first+2, scale(f.Advance(0)), widths.String()), nil)
+	obj(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle %.2f /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, scale(bbox[0]), scale(bbox[1]), scale(bbox[2]), scale(bbox[3]), f.ItalicAngle(),
+		scale(f.Ascent()), scale(f.Descent()), scale(f.CapHeight()), first+3), nil)
+	obj(fmt.Sprintf("<< /Length %d /Length1 %d /Filter /FlateDecode >>", file.Len(), len(data)), file.Bytes())
+	obj(fmt.Sprintf("<< /Length %d >>", cmap.Len()), cmap.Bytes())
+	return nil
+}
+
+// encode maps s to WinAnsi bytes; characters outside Latin-1 become '?'
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 128 && r >= 32:
+			b = append(b, byte(r))
+		case r >= 160 && r < 256:
+			b = append(b, byte(r))
+		case r == '\t':
+			b = append(b, ' ')
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == '\\' || c == '(' || c == ')' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,73 @@
+package printing
+
+import (
+	"fmt"
+
+	"github.com/projuktisheba/erp-mini-api/internal/pdf"
+)
+
+// code128Patterns are the bar and space widths of each Code 128 symbol value,
+// starting with a bar; the last is the stop pattern
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128Stop   = 106
+)
+
+// code128 encodes s in code set B and returns the widths, in modules, of its
+// bars and spaces in turn, starting with a bar
+func code128(s string) ([]int, error) {
+	values := []int{code128StartB}
+	sum := code128StartB
+	for i := 0; i < len(s); i++ {
+		if s[i] < 32 || s[i] > 127 {
+			return nil, fmt.Errorf("cannot encode %q as a barcode", s)
+		}
+		v := int(s[i]) - 32
+		values = append(values, v)
+		sum += (i + 1) * v
+	}
+	values = append(values, sum%103, code128Stop)
+
+	var widths []int
+	for _, v := range values {
+		for _, c := range code128Patterns[v] {
+			widths = append(widths, int(c-'0'))
+		}
+	}
+	return widths, nil
+}
+
+// barcodeWidth returns the width in modules of bars and spaces from code128
+func barcodeWidth(widths []int) int {
+	n := 0
+	for _, w := range widths {
+		n += w
+	}
+	return n
+}
+
+// drawBarcode draws the bars from code128 at x, y, module points per module
+// and h points high. A quiet zone of ten modules must be left clear on either
+// side.
+func drawBarcode(doc *pdf.Document, x, y, module, h float64, widths []int) {
+	for i, w := range widths {
+		if i%2 == 0 {
+			doc.Rect(x, y, float64(w)*module, h, 0)
+		}
+		x += float64(w) * module
+	}
+}
@@ -0,0 +1,69 @@
+package printing
+
+import (
+	"os"
+
+	"github.com/projuktisheba/erp-mini-api/internal/font"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/pdf"
+)
+
+// Fonts are the TrueType fonts documents are printed with. Documents fall
+// back to Helvetica without them, which cannot show Arabic.
+type Fonts struct {
+	Regular *font.Font
+	Bold    *font.Font // nil to use Regular
+}
+
+// fontCandidates are tried, regular and bold, when no font is configured.
+// DejaVu Sans covers Latin and Arabic and ships with most Linux systems.
+var fontCandidates = [][2]string{
+	{"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf", "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf"},
+	{"/usr/share/fonts/dejavu/DejaVuSans.ttf", "/usr/share/fonts/dejavu/DejaVuSans-Bold.ttf"},
+	{"/usr/share/fonts/TTF/DejaVuSans.ttf", "/usr/share/fonts/TTF/DejaVuSans-Bold.ttf"},
+	{"/usr/share/fonts/dejavu-sans-fonts/DejaVuSans.ttf", "/usr/share/fonts/dejavu-sans-fonts/DejaVuSans-Bold.ttf"},
+}
+
+// LoadFonts loads the configured fonts, or the first candidate found when
+// none is configured. It returns nil without error when no font is available.
+func LoadFonts(cfg models.PrintConfig) (*Fonts, error) {
+	regular, bold := cfg.Font, cfg.BoldFont
+	if regular == "" {
+		for _, c := range fontCandidates {
+			if _, err := os.Stat(c[0]); err == nil {
+				regular = c[0]
+				if _, err := os.Stat(c[1]); err == nil && bold == "" {
+					bold = c[1]
+				}
+				break
+			}
+		}
+	}
+	if regular == "" {
+		return nil, nil
+	}
+
+	f := &Fonts{}
+	var err error
+	if f.Regular, err = font.Load(regular); err != nil {
+		return nil, err
+	}
+	if bold != "" {
+		if f.Bold, err = font.Load(bold); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Arabic reports whether the fonts can print Arabic
+func (f *Fonts) Arabic() bool {
+	return f != nil && f.Regular.HasGlyph('ع') && f.Regular.HasGlyph(0xfecb) // ain and its initial form
+}
+
+// use draws the text of doc with the fonts, if any
+func (f *Fonts) use(doc *pdf.Document) {
+	if f != nil {
+		doc.UseFonts(f.Regular, f.Bold)
+	}
+}
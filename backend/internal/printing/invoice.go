@@ -0,0 +1,470 @@
+package printing
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/money"
+	"github.com/projuktisheba/erp-mini-api/internal/pdf"
+)
+
+// ErrNoArabicFont is returned for Arabic documents when no font with Arabic glyphs is loaded
+var ErrNoArabicFont = errors.New("arabic documents need a font with arabic glyphs; set PRINT_FONT (e.g. DejaVuSans.ttf)")
+
+// logoSize is the box the branch logo is fitted into
+const logoSize = 64.0
+
+// invoiceLabels is the fixed text of an invoice in one language
+type invoiceLabels struct {
+	orderTitle, deliveryTitle, saleTitle, refundTitle string
+
+	memoNo, reference, date, deliveryDate, status      string
+	billTo, mobile, salesperson                        string
+	item, qty, amount, total, paid, due                string
+	subtotal, discount, net, taxTitle, taxID           string
+	payments, account, storeCredit, giftVoucher        string
+	loyaltyPoints, pointsEarned, pointsBalance         string
+	thisDelivery, deliveredNow, deliveredSoFar, remain string
+	received, refunded, refundedTo                     string
+	notes, terms, thanks, page, tel                    string
+
+	statuses map[string]string
+}
+
+var invoiceText = map[string]*invoiceLabels{
+	models.INVOICE_ENGLISH: {
+		orderTitle: "ORDER INVOICE", deliveryTitle: "DELIVERY NOTE", saleTitle: "INVOICE", refundTitle: "REFUND RECEIPT",
+		memoNo: "Memo No", reference: "Reference", date: "Date", deliveryDate: "Delivery date", status: "Status",
+		billTo: "Bill to", mobile: "Mobile", salesperson: "Salesperson",
+		item: "Item", qty: "Qty", amount: "Amount", total: "Total", paid: "Paid", due: "Due",
+		subtotal: "Subtotal", discount: "Discount", net: "Amount before tax", taxTitle: "TAX INVOICE", taxID: "Tax ID",
+		payments: "Payments", account: "Account", storeCredit: "Store credit", giftVoucher: "Gift voucher",
+		loyaltyPoints: "Loyalty points", pointsEarned: "Points earned", pointsBalance: "Points balance",
+		thisDelivery: "This delivery", deliveredNow: "Items delivered", deliveredSoFar: "Delivered so far", remain: "Items remaining",
+		received: "Received", refunded: "Amount refunded", refundedTo: "Refunded to",
+		notes: "Notes", terms: "Terms & conditions", thanks: "Thank you for your business", page: "Page", tel: "Tel",
+		statuses: map[string]string{
+			models.ORDER_PENDING: "Pending", models.ORDER_PARTIAL_DELIVERY: "Partly delivered",
+			models.ORDER_DELIVERY: "Delivered", models.ORDER_CANCELLED: "Cancelled", models.SALE_RETURNED: "Returned",
+		},
+	},
+	models.INVOICE_ARABIC: {
+		orderTitle: "فاتورة طلب", deliveryTitle: "إشعار تسليم", saleTitle: "فاتورة", refundTitle: "إيصال استرداد",
+		memoNo: "رقم المذكرة", reference: "المرجع", date: "التاريخ", deliveryDate: "تاريخ التسليم", status: "الحالة",
+		billTo: "العميل", mobile: "الجوال", salesperson: "البائع",
+		item: "الصنف", qty: "الكمية", amount: "المبلغ", total: "الإجمالي", paid: "المدفوع", due: "المتبقي",
+		subtotal: "المجموع الفرعي", discount: "الخصم", net: "المبلغ قبل الضريبة", taxTitle: "فاتورة ضريبية", taxID: "الرقم الضريبي",
+		payments: "المدفوعات", account: "الحساب", storeCredit: "رصيد المتجر", giftVoucher: "قسيمة هدية",
+		loyaltyPoints: "نقاط الولاء", pointsEarned: "النقاط المكتسبة", pointsBalance: "رصيد النقاط",
+		thisDelivery: "هذا التسليم", deliveredNow: "القطع المسلمة", deliveredSoFar: "إجمالي المسلم", remain: "القطع المتبقية",
+		received: "المستلم", refunded: "المبلغ المسترد", refundedTo: "طريقة الاسترداد",
+		notes: "ملاحظات", terms: "الشروط والأحكام", thanks: "شكرا لتعاملكم معنا", page: "صفحة", tel: "هاتف",
+		statuses: map[string]string{
+			models.ORDER_PENDING: "قيد التنفيذ", models.ORDER_PARTIAL_DELIVERY: "تسليم جزئي",
+			models.ORDER_DELIVERY: "تم التسليم", models.ORDER_CANCELLED: "ملغي", models.SALE_RETURNED: "مرتجع",
+		},
+	},
+}
+
+// mirrored draws on a page laid out left to right, flipping x positions and
+// alignment for right-to-left documents, so one layout serves both languages
+type mirrored struct {
+	doc *pdf.Document
+	rtl bool
+}
+
+func (m mirrored) x(x, w float64) float64 {
+	if m.rtl {
+		return m.doc.Width() - x - w
+	}
+	return x
+}
+
+func (m mirrored) text(x, y float64, s string, align int) {
+	if m.rtl {
+		x = m.doc.Width() - x
+		switch align {
+		case pdf.AlignLeft:
+			align = pdf.AlignRight
+		case pdf.AlignRight:
+			align = pdf.AlignLeft
+		}
+	}
+	m.doc.Text(x, y, s, align)
+}
+
+func (m mirrored) rect(x, y, w, h, gray float64) {
+	m.doc.Rect(m.x(x, w), y, w, h, gray)
+}
+
+// drawLogo fits img into a logoSize box at x, y, keeping its proportions
+func drawLogo(m mirrored, x, y float64, img image.Image) error {
+	w, h, pixels := rgbPixels(img, 2*int(logoSize))
+	dw, dh := logoSize, logoSize
+	if w >= h {
+		dh = logoSize * float64(h) / float64(w)
+	} else {
+		dw = logoSize * float64(w) / float64(h)
+	}
+	return m.doc.Image(m.x(x, dw), y, dw, dh, w, h, false, pixels)
+}
+
+// documentTitle is the heading of an invoice; orders and sales with tax on
+// them print as tax invoices
+func documentTitle(t *invoiceLabels, inv *models.Invoice) string {
+	switch inv.Kind {
+	case models.INVOICE_DELIVERY:
+		return t.deliveryTitle
+	case models.INVOICE_REFUND:
+		return t.refundTitle
+	}
+	if inv.Tax != 0 {
+		return t.taxTitle
+	}
+	if inv.Kind == models.INVOICE_ORDER {
+		return t.orderTitle
+	}
+	return t.saleTitle
+}
+
+// taxRows lists the taxes of an invoice by name and rate, with the tax
+// charged under each; the same tax on several categories prints once
+func taxRows(taxes []models.TaxLine) [][2]string {
+	var rows [][2]string
+	index := map[string]int{}
+	amounts := []money.Amount{}
+	for _, l := range taxes {
+		label := fmt.Sprintf("%s %s%%", l.Name, l.Rate)
+		i, ok := index[label]
+		if !ok {
+			i = len(rows)
+			index[label] = i
+			rows = append(rows, [2]string{label, ""})
+			amounts = append(amounts, 0)
+		}
+		amounts[i] += l.TaxAmount
+	}
+	for i := range rows {
+		rows[i][1] = amounts[i].String()
+	}
+	return rows
+}
+
+// InvoicePDF renders an order invoice, delivery note, sale invoice or refund
+// receipt on A4 in English or Arabic. logo may be nil.
+func InvoicePDF(inv *models.Invoice, lang string, fonts *Fonts, logo image.Image) ([]byte, error) {
+	t, ok := invoiceText[lang]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q, use %s or %s", lang, models.INVOICE_ENGLISH, models.INVOICE_ARABIC)
+	}
+	if lang == models.INVOICE_ARABIC && !fonts.Arabic() {
+		return nil, ErrNoArabicFont
+	}
+
+	doc := pdf.New()
+	fonts.use(doc)
+	m := mirrored{doc: doc, rtl: lang == models.INVOICE_ARABIC}
+	right := doc.Width() - margin
+	width := right - margin
+
+	title := documentTitle(t, inv)
+
+	y := 0.0
+	newPage := func() {
+		doc.AddPage()
+		y = margin + 10
+		doc.SetFont(false, 8)
+		m.text(margin, doc.Height()-20, inv.Branch.Name+" - "+inv.MemoNo, pdf.AlignLeft)
+		m.text(right, doc.Height()-20, fmt.Sprintf("%s %d", t.page, doc.PageCount()), pdf.AlignRight)
+	}
+	// ensure starts a new page unless h points fit above the bottom margin
+	ensure := func(h float64) {
+		if y+h > doc.Height()-margin-10 {
+			newPage()
+		}
+	}
+	newPage()
+
+	// --------------------
+	// Branch letterhead and document title
+	// --------------------
+	x := margin
+	if logo != nil {
+		if err := drawLogo(m, margin, y-10, logo); err == nil {
+			x += logoSize + 12
+		}
+	}
+	top := y
+	doc.SetFont(true, 15)
+	m.text(x, y+4, doc.Fit(inv.Branch.Name, right-200-x), pdf.AlignLeft)
+	y += 18
+	doc.SetFont(false, 8.5)
+	var contact []string
+	if inv.Branch.Slogan != "" {
+		contact = append(contact, inv.Branch.Slogan)
+	}
+	address := inv.Branch.Address
+	for _, part := range []string{inv.Branch.City, inv.Branch.Country} {
+		if part != "" {
+			address = strings.TrimPrefix(address+", "+part, ", ")
+		}
+	}
+	if address != "" {
+		contact = append(contact, address)
+	}
+	var phones []string
+	for _, p := range []string{inv.Branch.Mobile, inv.Branch.Telephone} {
+		if p != "" {
+			phones = append(phones, p)
+		}
+	}
+	if len(phones) > 0 {
+		contact = append(contact, t.tel+": "+strings.Join(phones, " / "))
+	}
+	if inv.Branch.Email != "" || inv.Branch.Website != "" {
+		contact = append(contact, strings.TrimSpace(inv.Branch.Email+"  "+inv.Branch.Website))
+	}
+	if inv.Branch.TaxID != "" {
+		contact = append(contact, t.taxID+": "+inv.Branch.TaxID)
+	}
+	for _, line := range contact {
+		m.text(x, y, doc.Fit(line, right-200-x), pdf.AlignLeft)
+		y += 11
+	}
+
+	// title and document numbers on the trailing side
+	ty := top + 4
+	doc.SetFont(true, 16)
+	m.text(right, ty, title, pdf.AlignRight)
+	ty += 18
+	doc.SetFont(false, 9)
+	meta := [][2]string{{t.memoNo, inv.MemoNo}}
+	if inv.Reference != "" {
+		meta = append(meta, [2]string{t.reference, inv.Reference})
+	}
+	meta = append(meta, [2]string{t.date, inv.Date.Format(dateLayout)})
+	if inv.DeliveryDate != nil && inv.Kind == models.INVOICE_ORDER {
+		meta = append(meta, [2]string{t.deliveryDate, inv.DeliveryDate.Format(dateLayout)})
+	}
+	if s, ok := t.statuses[inv.Status]; ok {
+		meta = append(meta, [2]string{t.status, s})
+	}
+	for _, kv := range meta {
+		doc.SetFont(false, 9)
+		m.text(right-90, ty, kv[0], pdf.AlignRight)
+		doc.SetFont(true, 9)
+		m.text(right, ty, kv[1], pdf.AlignRight)
+		ty += 12
+	}
+	y = max(y, ty, top+logoSize) + 8
+	doc.Line(margin, y, right, y, 0.8)
+	y += 18
+
+	// --------------------
+	// Customer
+	// --------------------
+	doc.SetFont(true, 9)
+	m.text(margin, y, t.billTo, pdf.AlignLeft)
+	m.text(right-180, y, t.salesperson, pdf.AlignLeft)
+	y += 13
+	doc.SetFont(false, 10)
+	m.text(margin, y, doc.Fit(inv.CustomerName, width-200), pdf.AlignLeft)
+	m.text(right-180, y, doc.Fit(inv.Salesperson, 180), pdf.AlignLeft)
+	y += 12
+	if inv.CustomerMobile != "" {
+		doc.SetFont(false, 9)
+		m.text(margin, y, t.mobile+": "+inv.CustomerMobile, pdf.AlignLeft)
+		y += 12
+	}
+	if inv.CustomerTaxID != "" {
+		doc.SetFont(false, 9)
+		m.text(margin, y, t.taxID+": "+inv.CustomerTaxID, pdf.AlignLeft)
+		y += 12
+	}
+	y += 12
+
+	// --------------------
+	// Items
+	// --------------------
+	colNo, colItem, colQty, colAmount := margin+4, margin+26, right-110, right-4
+	itemHeader := func() {
+		doc.SetFont(true, 9)
+		m.rect(margin, y-12, width, 17, 0.9)
+		m.text(colNo, y, "#", pdf.AlignLeft)
+		m.text(colItem, y, t.item, pdf.AlignLeft)
+		m.text(colQty, y, t.qty, pdf.AlignRight)
+		m.text(colAmount, y, t.amount, pdf.AlignRight)
+		y += 18
+	}
+	itemHeader()
+	for i, it := range inv.Items {
+		if y > doc.Height()-margin-30 {
+			newPage()
+			itemHeader()
+		}
+		doc.SetFont(false, 9.5)
+		m.text(colNo, y, fmt.Sprint(i+1), pdf.AlignLeft)
+		m.text(colItem, y, doc.Fit(it.Name, colQty-60-colItem), pdf.AlignLeft)
+		m.text(colQty, y, fmt.Sprint(it.Quantity), pdf.AlignRight)
+		m.text(colAmount, y, it.Amount.String(), pdf.AlignRight)
+		doc.Line(margin, y+5, right, y+5, 0.2)
+		y += 17
+	}
+	y += 4
+
+	// --------------------
+	// Totals
+	// --------------------
+	var totals [][2]string
+	if inv.Discount != 0 {
+		totals = append(totals, [2]string{t.subtotal, inv.Subtotal.String()}, [2]string{t.discount, (-inv.Discount).String()})
+	}
+	if inv.Tax != 0 {
+		totals = append(totals, [2]string{t.net, inv.Net.String()})
+		totals = append(totals, taxRows(inv.Taxes)...)
+	}
+	totals = append(totals, [2]string{t.total, inv.Total.String()}, [2]string{t.paid, inv.Paid.String()}, [2]string{t.due, inv.Due.String()})
+	ensure(15*float64(len(totals)) + 45)
+	for i, kv := range totals {
+		doc.SetFont(i == len(totals)-1, 10)
+		m.text(right-110, y, kv[0], pdf.AlignRight)
+		m.text(colAmount, y, kv[1], pdf.AlignRight)
+		y += 15
+	}
+	if inv.PointsEarned != 0 || inv.PointsBalance != 0 {
+		ensure(40)
+		doc.SetFont(false, 9)
+		for _, kv := range [][2]string{{t.pointsEarned, fmt.Sprint(inv.PointsEarned)}, {t.pointsBalance, fmt.Sprint(inv.PointsBalance)}} {
+			m.text(right-110, y, kv[0], pdf.AlignRight)
+			m.text(colAmount, y, kv[1], pdf.AlignRight)
+			y += 13
+		}
+	}
+	y += 8
+
+	// --------------------
+	// The delivery or refund printed
+	// --------------------
+	var summary [][2]string
+	switch inv.Kind {
+	case models.INVOICE_DELIVERY:
+		summary = [][2]string{
+			{t.deliveredNow, fmt.Sprint(inv.Quantity)},
+			{t.deliveredSoFar, fmt.Sprint(inv.Delivered)},
+			{t.remain, fmt.Sprint(inv.Remaining)},
+			{t.received, inv.Amount.String()},
+		}
+	case models.INVOICE_REFUND:
+		to := t.storeCredit
+		for _, p := range inv.Payments {
+			if p.MemoNo == inv.Reference && p.Account != "" {
+				to = p.Account
+			}
+		}
+		summary = [][2]string{{t.refunded, inv.Amount.String()}, {t.refundedTo, to}}
+	}
+	if len(summary) > 0 {
+		h := 22 + 14*float64(len(summary))
+		ensure(h + 10)
+		m.rect(margin, y-12, width/2, h, -1)
+		doc.SetFont(true, 9.5)
+		heading := t.thisDelivery
+		if inv.Kind == models.INVOICE_REFUND {
+			heading = t.refundTitle
+		}
+		m.text(margin+8, y+2, heading, pdf.AlignLeft)
+		y += 17
+		for _, kv := range summary {
+			doc.SetFont(false, 9.5)
+			m.text(margin+8, y, kv[0], pdf.AlignLeft)
+			doc.SetFont(true, 9.5)
+			m.text(margin+width/2-8, y, kv[1], pdf.AlignRight)
+			y += 14
+		}
+		y += 16
+	}
+
+	// --------------------
+	// Payments
+	// --------------------
+	if len(inv.Payments) > 0 {
+		ensure(50)
+		doc.SetFont(true, 10)
+		m.text(margin, y, t.payments, pdf.AlignLeft)
+		y += 15
+		colDate, colMemo, colAccount := margin+4, margin+80, margin+200
+		payHeader := func() {
+			doc.SetFont(true, 8.5)
+			m.rect(margin, y-11, width, 15, 0.9)
+			m.text(colDate, y, t.date, pdf.AlignLeft)
+			m.text(colMemo, y, t.reference, pdf.AlignLeft)
+			m.text(colAccount, y, t.account, pdf.AlignLeft)
+			m.text(colAmount, y, t.amount, pdf.AlignRight)
+			y += 15
+		}
+		payHeader()
+		for _, p := range inv.Payments {
+			if y > doc.Height()-margin-30 {
+				newPage()
+				payHeader()
+			}
+			account := p.Account
+			switch {
+			case account == "" && p.Voucher != "":
+				account = t.giftVoucher + " " + p.Voucher
+			case account == "" && p.Points != 0:
+				account = fmt.Sprintf("%s (%d)", t.loyaltyPoints, p.Points)
+			case account == "":
+				account = t.storeCredit
+			}
+			if p.Reference != "" {
+				account += " (" + p.Reference + ")"
+			}
+			doc.SetFont(false, 8.5)
+			m.text(colDate, y, p.Date.Format(dateLayout), pdf.AlignLeft)
+			m.text(colMemo, y, doc.Fit(p.MemoNo, colAccount-colMemo-6), pdf.AlignLeft)
+			m.text(colAccount, y, doc.Fit(account, colAmount-80-colAccount), pdf.AlignLeft)
+			m.text(colAmount, y, p.Amount.String(), pdf.AlignRight)
+			y += 13
+		}
+		y += 12
+	}
+
+	// --------------------
+	// Notes, terms and thanks
+	// --------------------
+	paragraph := func(heading, body string) {
+		if strings.TrimSpace(body) == "" {
+			return
+		}
+		doc.SetFont(false, 8.5)
+		lines := doc.Wrap(body, width)
+		ensure(16 + 11*float64(min(len(lines), 3)))
+		doc.SetFont(true, 9)
+		m.text(margin, y, heading, pdf.AlignLeft)
+		y += 13
+		doc.SetFont(false, 8.5)
+		for _, line := range lines {
+			ensure(11)
+			m.text(margin, y, line, pdf.AlignLeft)
+			y += 11
+		}
+		y += 10
+	}
+	paragraph(t.notes, inv.Notes)
+	terms := inv.Branch.InvoiceTerms
+	if m.rtl {
+		terms = inv.Branch.InvoiceTermsAr
+	}
+	paragraph(t.terms, terms)
+
+	ensure(20)
+	y += 6
+	doc.SetFont(true, 10)
+	doc.Text(doc.Width()/2, y, t.thanks, pdf.AlignCenter)
+
+	return doc.Bytes()
+}
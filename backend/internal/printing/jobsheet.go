@@ -0,0 +1,152 @@
+package printing
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/pdf"
+)
+
+// JobTag is the text of the barcode on an item's job sheet
+func JobTag(itemID int64) string {
+	return fmt.Sprintf("JOB-%d", itemID)
+}
+
+// firstName masks a customer's name to the first word, so the cutting room
+// sees no more of the customer than it needs
+func firstName(name string) string {
+	if f := strings.Fields(name); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// JobSheetsPDF renders the sheets the cutting room works from, one page per
+// order item: the customer's first name, memo number, delivery date,
+// measurements, style and notes, and a barcode tag of the item (see JobTag).
+// Pages follow the order of orders and their items. fonts may be nil.
+func JobSheetsPDF(orders []*models.OrderDB, fonts *Fonts) ([]byte, error) {
+	doc := pdf.New()
+	fonts.use(doc)
+	right := doc.Width() - margin
+	width := right - margin
+	printed := time.Now().Format("2006-01-02 15:04")
+
+	for _, order := range orders {
+		for i, it := range order.Items {
+			doc.AddPage()
+			y := margin + 10
+
+			// --------------------
+			// Title, memo and tag
+			// --------------------
+			doc.SetFont(true, 18)
+			doc.Text(margin, y+6, "JOB SHEET", pdf.AlignLeft)
+			doc.SetFont(false, 10)
+			doc.Text(margin, y+24, fmt.Sprintf("Item %d of %d", i+1, len(order.Items)), pdf.AlignLeft)
+
+			tag := JobTag(it.ID)
+			const module, barHeight = 1.1, 42.0
+			bars, err := code128(tag)
+			if err != nil {
+				return nil, err
+			}
+			barWidth := float64(barcodeWidth(bars)) * module
+			drawBarcode(doc, right-barWidth, y-8, module, barHeight, bars)
+			doc.SetFont(false, 9)
+			doc.Text(right-barWidth/2, y+barHeight+2, tag, pdf.AlignCenter)
+			y += barHeight + 16
+			doc.Line(margin, y, right, y, 1)
+			y += 24
+
+			// --------------------
+			// Order
+			// --------------------
+			field := func(x float64, label, value string) {
+				doc.SetFont(false, 9)
+				doc.Text(x, y, label, pdf.AlignLeft)
+				doc.SetFont(true, 14)
+				doc.Text(x, y+17, doc.Fit(value, width/3-10), pdf.AlignLeft)
+			}
+			delivery := "-"
+			if !order.DeliveryDate.IsZero() {
+				delivery = order.DeliveryDate.Format("Mon, 02 Jan 2006")
+			}
+			field(margin, "Memo No", order.MemoNo)
+			field(margin+width/3, "Customer", firstName(order.Customer.Name))
+			field(margin+2*width/3, "Delivery date", delivery)
+			y += 40
+
+			doc.Rect(margin, y-13, width, 20, 0.9)
+			doc.SetFont(true, 12)
+			doc.Text(margin+6, y+2, doc.Fit(it.ProductName, width-100), pdf.AlignLeft)
+			doc.Text(right-6, y+2, fmt.Sprintf("Qty %d", it.Quantity), pdf.AlignRight)
+			y += 30
+
+			// --------------------
+			// Measurements, two columns
+			// --------------------
+			heading := func(title string) {
+				doc.SetFont(true, 11)
+				doc.Text(margin, y, title, pdf.AlignLeft)
+				doc.Line(margin, y+4, right, y+4, 0.4)
+				y += 20
+			}
+			heading("Measurements")
+			lines := itemMeasurements(it.Measurements)
+			if len(lines) == 0 {
+				doc.SetFont(false, 10)
+				doc.Text(margin, y, "No measurements recorded", pdf.AlignLeft)
+				y += 16
+			}
+			rows := (len(lines) + 1) / 2
+			for n, line := range lines {
+				x, row := margin, n
+				if n >= rows {
+					x, row = margin+width/2, n-rows
+				}
+				label, value, _ := strings.Cut(line, ": ")
+				doc.SetFont(false, 11)
+				doc.Text(x, y+float64(row)*18, label, pdf.AlignLeft)
+				doc.SetFont(true, 11)
+				doc.Text(x+width/2-20, y+float64(row)*18, value, pdf.AlignRight)
+			}
+			y += float64(rows)*18 + 14
+
+			// --------------------
+			// Style and notes
+			// --------------------
+			paragraph := func(title string, lines []string) {
+				if len(lines) == 0 || y > doc.Height()-margin-60 {
+					return
+				}
+				heading(title)
+				doc.SetFont(false, 11)
+				for _, line := range doc.Wrap(strings.Join(lines, "\n"), width) {
+					if y > doc.Height()-margin-30 {
+						break
+					}
+					doc.Text(margin, y, line, pdf.AlignLeft)
+					y += 15
+				}
+				y += 10
+			}
+			paragraph("Style", styleSummary(it.StyleOptions))
+			if notes := strings.TrimSpace(it.TailorNotes); notes != "" {
+				paragraph("Notes", []string{notes})
+			}
+
+			doc.SetFont(false, 8)
+			doc.Text(margin, doc.Height()-20, "Printed "+printed, pdf.AlignLeft)
+			doc.Text(right, doc.Height()-20, "Memo "+order.MemoNo+" - "+tag, pdf.AlignRight)
+		}
+	}
+	if doc.PageCount() == 0 {
+		doc.AddPage()
+		doc.SetFont(false, 11)
+		doc.Text(margin, margin+10, "No jobs to print", pdf.AlignLeft)
+	}
+	return doc.Bytes()
+}
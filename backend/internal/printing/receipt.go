@@ -0,0 +1,209 @@
+package printing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/projuktisheba/erp-mini-api/internal/escpos"
+	"github.com/projuktisheba/erp-mini-api/internal/font"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// Paper widths receipts are printed on, in millimetres
+const (
+	Receipt80mm = 80
+	Receipt58mm = 58
+)
+
+// ReceiptESCPOS renders an order, delivery, sale or refund receipt as ESC/POS
+// commands for a thermal printer paper millimetres wide. Arabic text is sent
+// as raster images drawn with fonts. The memo number is printed as a QR code.
+func ReceiptESCPOS(inv *models.Invoice, lang string, fonts *Fonts, paper int) ([]byte, error) {
+	t, ok := invoiceText[lang]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q, use %s or %s", lang, models.INVOICE_ENGLISH, models.INVOICE_ARABIC)
+	}
+	if lang == models.INVOICE_ARABIC && !fonts.Arabic() {
+		return nil, ErrNoArabicFont
+	}
+	dots := escpos.Paper80
+	switch paper {
+	case Receipt80mm:
+	case Receipt58mm:
+		dots = escpos.Paper58
+	default:
+		return nil, fmt.Errorf("unsupported paper width %d, use %d or %d", paper, Receipt80mm, Receipt58mm)
+	}
+
+	var regular, bold *font.Font
+	if fonts != nil {
+		regular, bold = fonts.Regular, fonts.Bold
+	}
+	p := escpos.New(dots, regular, bold)
+	rtl := lang == models.INVOICE_ARABIC
+	start := escpos.AlignLeft
+	if rtl {
+		start = escpos.AlignRight
+	}
+	// row prints a label and its value, the label on the reading side
+	row := func(label, value string) {
+		if rtl {
+			p.Row(value, label)
+			return
+		}
+		p.Row(label, value)
+	}
+
+	title := documentTitle(t, inv)
+
+	// --------------------
+	// Branch header and title
+	// --------------------
+	p.Align(escpos.AlignCenter)
+	p.Bold(true)
+	p.Large(true)
+	p.Text(inv.Branch.Name)
+	p.Large(false)
+	p.Bold(false)
+	if inv.Branch.Slogan != "" {
+		p.Text(inv.Branch.Slogan)
+	}
+	address := inv.Branch.Address
+	for _, part := range []string{inv.Branch.City, inv.Branch.Country} {
+		if part != "" {
+			address = strings.TrimPrefix(address+", "+part, ", ")
+		}
+	}
+	if address != "" {
+		p.Text(address)
+	}
+	var phones []string
+	for _, ph := range []string{inv.Branch.Mobile, inv.Branch.Telephone} {
+		if ph != "" {
+			phones = append(phones, ph)
+		}
+	}
+	if len(phones) > 0 {
+		p.Text(t.tel + ": " + strings.Join(phones, " / "))
+	}
+	if inv.Branch.TaxID != "" {
+		p.Text(t.taxID + ": " + inv.Branch.TaxID)
+	}
+	p.Rule()
+	p.Bold(true)
+	p.Text(title)
+	p.Bold(false)
+
+	p.Align(start)
+	row(t.memoNo, inv.MemoNo)
+	if inv.Reference != "" {
+		row(t.reference, inv.Reference)
+	}
+	row(t.date, inv.Date.Format(dateLayout))
+	if inv.DeliveryDate != nil && inv.Kind == models.INVOICE_ORDER {
+		row(t.deliveryDate, inv.DeliveryDate.Format(dateLayout))
+	}
+	if s, ok := t.statuses[inv.Status]; ok {
+		row(t.status, s)
+	}
+	row(t.billTo, inv.CustomerName)
+	if inv.CustomerMobile != "" {
+		row(t.mobile, inv.CustomerMobile)
+	}
+	if inv.CustomerTaxID != "" {
+		row(t.taxID, inv.CustomerTaxID)
+	}
+	if inv.Salesperson != "" {
+		row(t.salesperson, inv.Salesperson)
+	}
+	p.Rule()
+
+	// --------------------
+	// Items and totals
+	// --------------------
+	p.Bold(true)
+	row(t.item, t.amount)
+	p.Bold(false)
+	for i, it := range inv.Items {
+		p.Text(fmt.Sprintf("%d. %s", i+1, it.Name))
+		row(fmt.Sprintf("   %s: %d", t.qty, it.Quantity), it.Amount.String())
+	}
+	p.Rule()
+	if inv.Discount != 0 {
+		row(t.subtotal, inv.Subtotal.String())
+		row(t.discount, (-inv.Discount).String())
+	}
+	if inv.Tax != 0 {
+		row(t.net, inv.Net.String())
+		for _, kv := range taxRows(inv.Taxes) {
+			row(kv[0], kv[1])
+		}
+	}
+	row(t.total, inv.Total.String())
+	row(t.paid, inv.Paid.String())
+	p.Bold(true)
+	row(t.due, inv.Due.String())
+	p.Bold(false)
+	if inv.PointsEarned != 0 || inv.PointsBalance != 0 {
+		row(t.pointsEarned, fmt.Sprint(inv.PointsEarned))
+		row(t.pointsBalance, fmt.Sprint(inv.PointsBalance))
+	}
+
+	// --------------------
+	// The delivery or refund printed
+	// --------------------
+	switch inv.Kind {
+	case models.INVOICE_DELIVERY:
+		p.Rule()
+		p.Bold(true)
+		p.Text(t.thisDelivery)
+		p.Bold(false)
+		row(t.deliveredNow, fmt.Sprint(inv.Quantity))
+		row(t.deliveredSoFar, fmt.Sprint(inv.Delivered))
+		row(t.remain, fmt.Sprint(inv.Remaining))
+		row(t.received, inv.Amount.String())
+	case models.INVOICE_REFUND:
+		to := t.storeCredit
+		for _, pay := range inv.Payments {
+			if pay.MemoNo == inv.Reference && pay.Account != "" {
+				to = pay.Account
+			}
+		}
+		p.Rule()
+		row(t.refunded, inv.Amount.String())
+		row(t.refundedTo, to)
+	}
+
+	// --------------------
+	// Notes and terms
+	// --------------------
+	terms := inv.Branch.InvoiceTerms
+	if rtl {
+		terms = inv.Branch.InvoiceTermsAr
+	}
+	for _, para := range [][2]string{{t.notes, inv.Notes}, {t.terms, terms}} {
+		if strings.TrimSpace(para[1]) == "" {
+			continue
+		}
+		p.Rule()
+		p.Bold(true)
+		p.Text(para[0])
+		p.Bold(false)
+		p.Text(para[1])
+	}
+
+	// --------------------
+	// Memo number as a QR code, and thanks
+	// --------------------
+	p.Feed(1)
+	p.Align(escpos.AlignCenter)
+	p.QR(inv.MemoNo, 6)
+	p.Text(inv.MemoNo)
+	p.Feed(1)
+	p.Bold(true)
+	p.Text(t.thanks)
+	p.Bold(false)
+	p.Feed(3)
+	p.Cut()
+	return p.Bytes(), nil
+}
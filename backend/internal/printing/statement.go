@@ -0,0 +1,220 @@
+// Package printing lays out the documents handed to customers and staff
+// (statements, invoices, job sheets) as PDF or CSV.
+package printing
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/pdf"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	margin     = 40.0
+)
+
+// measurementSummary lists the customer's recorded measurements as "Label: value"
+func measurementSummary(c *models.Customer) []string {
+	fields := []struct{ label, value string }{
+		{"Length", c.Length},
+		{"Shoulder", c.Shoulder},
+		{"Bust", c.Bust},
+		{"Waist", c.Waist},
+		{"Hip", c.Hip},
+		{"Arm hole", c.ArmHole},
+		{"Sleeve length", c.SleeveLength},
+		{"Sleeve width", c.SleeveWidth},
+		{"Round width", c.RoundWidth},
+	}
+	var out []string
+	for _, f := range fields {
+		if v := strings.TrimSpace(f.value); v != "" {
+			out = append(out, f.label+": "+v)
+		}
+	}
+	return out
+}
+
+// WriteCustomerStatementCSV writes the statement as CSV, one row per line
+// between the opening and closing balance rows.
+func WriteCustomerStatementCSV(w io.Writer, st *models.CustomerStatement) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{
+		{"Customer", st.Customer.Name, "Mobile", st.Customer.Mobile},
+		{"Period", st.StartDate.Format(dateLayout), st.EndDate.Format(dateLayout)},
+		{"Measurements", strings.Join(measurementSummary(st.Customer), "; ")},
+		{},
+		{"Date", "Type", "Reference", "Description", "Debit", "Credit", "Balance"},
+		{st.StartDate.Format(dateLayout), "", "", "Opening balance", "", "", st.OpeningBalance.String()},
+	}
+	for _, l := range st.Lines {
+		records = append(records, []string{
+			l.Date.Format(dateLayout), l.Type, l.Reference, l.Description,
+			l.Debit.String(), l.Credit.String(), l.Balance.String(),
+		})
+	}
+	records = append(records,
+		[]string{st.EndDate.Format(dateLayout), "", "", "Closing balance", st.TotalDebit.String(), st.TotalCredit.String(), st.ClosingBalance.String()},
+	)
+	if sc := st.StoreCredit; sc != nil && (len(sc.Entries) > 0 || sc.ClosingBalance != 0) {
+		records = append(records,
+			[]string{},
+			[]string{"Store credit"},
+			[]string{"Date", "Type", "Reference", "Description", "Amount", "", "Balance"},
+			[]string{st.StartDate.Format(dateLayout), "", "", "Opening balance", "", "", sc.OpeningBalance.String()},
+		)
+		for _, e := range sc.Entries {
+			records = append(records, []string{
+				e.EntryDate.Format(dateLayout), e.EntryType, e.MemoNo, e.Notes, e.Amount.String(), "", e.Balance.String(),
+			})
+		}
+		records = append(records,
+			[]string{st.EndDate.Format(dateLayout), "", "", "Closing balance", "", "", sc.ClosingBalance.String()},
+		)
+	}
+	if err := cw.WriteAll(records); err != nil {
+		return fmt.Errorf("write statement csv failed: %w", err)
+	}
+	return nil
+}
+
+// CustomerStatementPDF renders the statement on A4 pages
+func CustomerStatementPDF(st *models.CustomerStatement) ([]byte, error) {
+	doc := pdf.New()
+	right := doc.Width() - margin
+
+	// columns: date, type, reference, description, debit, credit, balance (right edges for amounts)
+	colDate, colType, colRef, colDesc := margin, margin+62, margin+122, margin+200
+	colDebit, colCredit, colBalance := right-140, right-70, right
+	descWidth := colDebit - 60 - colDesc
+
+	y := 0.0
+	header := func() {
+		doc.SetFont(true, 8.5)
+		doc.Rect(margin, y-11, right-margin, 15, 0.9)
+		doc.Text(colDate+2, y, "Date", pdf.AlignLeft)
+		doc.Text(colType, y, "Type", pdf.AlignLeft)
+		doc.Text(colRef, y, "Reference", pdf.AlignLeft)
+		doc.Text(colDesc, y, "Description", pdf.AlignLeft)
+		doc.Text(colDebit-2, y, "Debit", pdf.AlignRight)
+		doc.Text(colCredit-2, y, "Credit", pdf.AlignRight)
+		doc.Text(colBalance-2, y, "Balance", pdf.AlignRight)
+		y += 16
+		doc.SetFont(false, 8.5)
+	}
+	newPage := func() {
+		doc.AddPage()
+		y = margin + 10
+		doc.SetFont(false, 8)
+		doc.Text(right, doc.Height()-20, fmt.Sprintf("Page %d", doc.PageCount()), pdf.AlignRight)
+	}
+	row := func(date, kind, ref, desc, debit, credit, balance string) {
+		if y > doc.Height()-margin-20 {
+			newPage()
+			header()
+		}
+		doc.Text(colDate+2, y, date, pdf.AlignLeft)
+		doc.Text(colType, y, kind, pdf.AlignLeft)
+		doc.Text(colRef, y, doc.Fit(ref, colDesc-colRef-4), pdf.AlignLeft)
+		doc.Text(colDesc, y, doc.Fit(desc, descWidth), pdf.AlignLeft)
+		doc.Text(colDebit-2, y, debit, pdf.AlignRight)
+		doc.Text(colCredit-2, y, credit, pdf.AlignRight)
+		doc.Text(colBalance-2, y, balance, pdf.AlignRight)
+		y += 13
+	}
+
+	newPage()
+
+	// --------------------
+	// Title and customer
+	// --------------------
+	doc.SetFont(true, 16)
+	doc.Text(margin, y, "Statement of Account", pdf.AlignLeft)
+	doc.SetFont(false, 9)
+	doc.Text(right, y, st.BranchName, pdf.AlignRight)
+	y += 22
+
+	doc.SetFont(true, 10)
+	doc.Text(margin, y, st.Customer.Name, pdf.AlignLeft)
+	doc.SetFont(false, 9)
+	doc.Text(right, y, "Period: "+st.StartDate.Format(dateLayout)+" to "+st.EndDate.Format(dateLayout), pdf.AlignRight)
+	y += 13
+	doc.Text(margin, y, "Mobile: "+st.Customer.Mobile, pdf.AlignLeft)
+	doc.Text(right, y, "Generated: "+st.GeneratedAt.Format("2006-01-02 15:04"), pdf.AlignRight)
+	y += 13
+	if st.Customer.Address != "" {
+		doc.Text(margin, y, doc.Fit("Address: "+st.Customer.Address, right-margin), pdf.AlignLeft)
+		y += 13
+	}
+
+	// --------------------
+	// Measurement summary
+	// --------------------
+	if m := measurementSummary(st.Customer); len(m) > 0 {
+		y += 4
+		doc.SetFont(true, 9)
+		doc.Text(margin, y, "Measurements", pdf.AlignLeft)
+		y += 12
+		doc.SetFont(false, 8.5)
+		for _, line := range doc.Wrap(strings.Join(m, "   "), right-margin) {
+			doc.Text(margin, y, line, pdf.AlignLeft)
+			y += 11
+		}
+	}
+	y += 12
+
+	// --------------------
+	// Lines
+	// --------------------
+	header()
+	row(st.StartDate.Format(dateLayout), "", "", "Opening balance", "", "", st.OpeningBalance.String())
+	for _, l := range st.Lines {
+		debit, credit := "", ""
+		if l.Debit != 0 {
+			debit = l.Debit.String()
+		}
+		if l.Credit != 0 {
+			credit = l.Credit.String()
+		}
+		row(l.Date.Format(dateLayout), l.Type, l.Reference, l.Description, debit, credit, l.Balance.String())
+	}
+	doc.Line(margin, y-9, right, y-9, 0.5)
+	doc.SetFont(true, 8.5)
+	row(st.EndDate.Format(dateLayout), "", "", "Closing balance", st.TotalDebit.String(), st.TotalCredit.String(), st.ClosingBalance.String())
+
+	// --------------------
+	// Store credit
+	// --------------------
+	if sc := st.StoreCredit; sc != nil && (len(sc.Entries) > 0 || sc.ClosingBalance != 0) {
+		if y > doc.Height()-margin-80 {
+			newPage()
+		} else {
+			y += 20
+		}
+		doc.SetFont(true, 10)
+		doc.Text(margin, y, "Store credit", pdf.AlignLeft)
+		doc.SetFont(false, 8)
+		doc.Text(right, y, "Already included in the balance above", pdf.AlignRight)
+		y += 14
+		header()
+		row(st.StartDate.Format(dateLayout), "", "", "Opening balance", "", "", sc.OpeningBalance.String())
+		for _, e := range sc.Entries {
+			added, used := "", ""
+			if e.Amount > 0 {
+				added = e.Amount.String()
+			} else {
+				used = (-e.Amount).String()
+			}
+			row(e.EntryDate.Format(dateLayout), e.EntryType, e.MemoNo, e.Notes, used, added, e.Balance.String())
+		}
+		doc.Line(margin, y-9, right, y-9, 0.5)
+		doc.SetFont(true, 8.5)
+		row(st.EndDate.Format(dateLayout), "", "", "Closing balance", "", "", sc.ClosingBalance.String())
+	}
+
+	return doc.Bytes()
+}
@@ -0,0 +1,269 @@
+package printing
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg" // decode reference photos
+	_ "image/png"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/projuktisheba/erp-mini-api/internal/attachment"
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+	"github.com/projuktisheba/erp-mini-api/internal/pdf"
+)
+
+// photoSize is the box each reference photo is fitted into on the work ticket
+const photoSize = 120.0
+
+// measurementLabel returns the label of a measurement key, e.g. "sleeve_length" -> "Sleeve length"
+func measurementLabel(key string) string {
+	for _, f := range models.StandardMeasurementFields {
+		if f.Key == key {
+			return f.Label
+		}
+	}
+	label := strings.ReplaceAll(key, "_", " ")
+	if label == "" {
+		return label
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+// itemMeasurements lists the measurements of an item as "Label: value",
+// standard measurements first in their usual order
+func itemMeasurements(m map[string]string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, f := range models.StandardMeasurementFields {
+		if v := m[f.Key]; v != "" {
+			out = append(out, f.Label+": "+v)
+			seen[f.Key] = true
+		}
+	}
+	var rest []string
+	for k := range m {
+		if !seen[k] && m[k] != "" {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	for _, k := range rest {
+		out = append(out, measurementLabel(k)+": "+m[k])
+	}
+	return out
+}
+
+// styleSummary lists the style options of an item as "Label: value"
+func styleSummary(s models.StyleOptions) []string {
+	fields := []struct{ label, value string }{
+		{"Sleeve", s.SleeveType},
+		{"Embroidery", s.Embroidery},
+		{"Stones", s.Stones},
+		{"Fabric", s.FabricCode},
+	}
+	var out []string
+	for _, f := range fields {
+		if f.value != "" {
+			out = append(out, f.label+": "+f.value)
+		}
+	}
+	extra := make([]string, 0, len(s.Extra))
+	for k := range s.Extra {
+		extra = append(extra, k)
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		out = append(out, k+": "+s.Extra[k])
+	}
+	return out
+}
+
+// rgbPixels scales img down so its longer side is at most maxSide pixels and
+// returns its RGB samples row by row
+func rgbPixels(img image.Image, maxSide int) (int, int, []byte) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			w, h = maxSide, max(1, h*maxSide/w)
+		} else {
+			w, h = max(1, w*maxSide/h), maxSide
+		}
+	}
+	pixels := make([]byte, 0, w*h*3)
+	for y := 0; y < h; y++ {
+		sy := b.Min.Y + y*b.Dy()/h
+		for x := 0; x < w; x++ {
+			sx := b.Min.X + x*b.Dx()/w
+			r, g, bl, _ := img.At(sx, sy).RGBA()
+			pixels = append(pixels, byte(r>>8), byte(g>>8), byte(bl>>8))
+		}
+	}
+	return w, h, pixels
+}
+
+// drawPhoto fits the image read from rc into a box of size x size at x, y,
+// keeping its proportions. Images larger than attachment.MaxThumbPixels are not decoded.
+func drawPhoto(doc *pdf.Document, x, y, size float64, rc io.ReadCloser) error {
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, attachment.MaxSize+1))
+	if err != nil {
+		return fmt.Errorf("read photo failed: %w", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decode photo failed: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > attachment.MaxThumbPixels {
+		return fmt.Errorf("photo of %dx%d pixels is too large to print", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decode photo failed: %w", err)
+	}
+	w, h, pixels := rgbPixels(img, 2*int(size))
+	dw, dh := size, size
+	if w >= h {
+		dh = size * float64(h) / float64(w)
+	} else {
+		dw = size * float64(w) / float64(h)
+	}
+	return doc.Image(x+(size-dw)/2, y+(size-dh)/2, dw, dh, w, h, false, pixels)
+}
+
+// OrderWorkTicketPDF renders the ticket the tailors work from: per item the
+// measurements, style options, notes and reference photos. open reads a
+// photo; photos that cannot be read are listed by caption instead.
+func OrderWorkTicketPDF(order *models.OrderDB, open func(photo models.Attachment) (io.ReadCloser, error)) ([]byte, error) {
+	doc := pdf.New()
+	right := doc.Width() - margin
+	width := right - margin
+
+	y := 0.0
+	newPage := func() {
+		doc.AddPage()
+		y = margin + 10
+		doc.SetFont(false, 8)
+		doc.Text(margin, doc.Height()-20, "Memo "+order.MemoNo, pdf.AlignLeft)
+		doc.Text(right, doc.Height()-20, fmt.Sprintf("Page %d", doc.PageCount()), pdf.AlignRight)
+	}
+	// need starts a new page when fewer than h points are left
+	need := func(h float64) {
+		if y+h > doc.Height()-margin {
+			newPage()
+		}
+	}
+	block := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		need(24)
+		doc.SetFont(true, 9)
+		doc.Text(margin, y, title, pdf.AlignLeft)
+		y += 12
+		doc.SetFont(false, 9)
+		for _, line := range doc.Wrap(strings.Join(lines, "   "), width) {
+			need(12)
+			doc.Text(margin, y, line, pdf.AlignLeft)
+			y += 12
+		}
+		y += 4
+	}
+
+	newPage()
+
+	// --------------------
+	// Title and order
+	// --------------------
+	doc.SetFont(true, 16)
+	doc.Text(margin, y, "Work Ticket", pdf.AlignLeft)
+	doc.SetFont(true, 12)
+	doc.Text(right, y, "Memo "+order.MemoNo, pdf.AlignRight)
+	y += 22
+
+	doc.SetFont(false, 9)
+	doc.Text(margin, y, "Customer: "+order.Customer.Name, pdf.AlignLeft)
+	doc.Text(right, y, "Order date: "+order.OrderDate.Format(dateLayout), pdf.AlignRight)
+	y += 13
+	if order.Salesperson.Name != "" {
+		doc.Text(margin, y, "Salesperson: "+order.Salesperson.Name, pdf.AlignLeft)
+	}
+	if !order.DeliveryDate.IsZero() {
+		doc.SetFont(true, 9)
+		doc.Text(right, y, "Delivery date: "+order.DeliveryDate.Format(dateLayout), pdf.AlignRight)
+		doc.SetFont(false, 9)
+	}
+	y += 13
+	if order.Notes != nil && strings.TrimSpace(*order.Notes) != "" {
+		for _, line := range doc.Wrap("Order notes: "+strings.TrimSpace(*order.Notes), width) {
+			doc.Text(margin, y, line, pdf.AlignLeft)
+			y += 12
+		}
+	}
+	y += 8
+
+	// --------------------
+	// Items
+	// --------------------
+	for i, it := range order.Items {
+		need(60)
+		doc.Rect(margin, y-12, width, 17, 0.9)
+		doc.SetFont(true, 10)
+		doc.Text(margin+4, y, fmt.Sprintf("%d. %s", i+1, it.ProductName), pdf.AlignLeft)
+		doc.Text(right-4, y, fmt.Sprintf("Qty %d", it.Quantity), pdf.AlignRight)
+		y += 18
+
+		block("Measurements", itemMeasurements(it.Measurements))
+		block("Style", styleSummary(it.StyleOptions))
+		if it.TailorNotes != "" {
+			block("Notes", []string{it.TailorNotes})
+		}
+
+		// reference photos, in rows across the page
+		var missing []string
+		x := margin
+		drawn := false
+		for _, ph := range it.Photos {
+			rc, err := open(ph)
+			if err == nil {
+				if x+photoSize > right {
+					x = margin
+					y += photoSize + 22
+				}
+				if y+photoSize+22 > doc.Height()-margin {
+					newPage()
+					x = margin
+				}
+				err = drawPhoto(doc, x, y, photoSize, rc)
+			}
+			if err != nil {
+				missing = append(missing, ph.Caption)
+				continue
+			}
+			drawn = true
+			doc.Rect(x, y, photoSize, photoSize, -1)
+			if ph.Caption != "" {
+				doc.SetFont(false, 7.5)
+				doc.Text(x, y+photoSize+10, doc.Fit(ph.Caption, photoSize), pdf.AlignLeft)
+			}
+			x += photoSize + 10
+		}
+		if drawn {
+			y += photoSize + 22
+		}
+		if len(missing) > 0 {
+			for j, c := range missing {
+				if c == "" {
+					missing[j] = "(no caption)"
+				}
+			}
+			block("Photos not available", missing)
+		}
+		y += 8
+	}
+
+	return doc.Bytes()
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+const (
+	amzDateLayout  = "20060102T150405Z"
+	emptyHash      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" // sha256 of ""
+	unsignedBody   = "UNSIGNED-PAYLOAD"
+	maxPresignTime = 7 * 24 * time.Hour // longest expiry S3 accepts
+)
+
+// S3 keeps files in a bucket of an S3-compatible service. Requests are signed
+// with AWS Signature Version 4, which MinIO accepts as well.
+type S3 struct {
+	endpoint  *url.URL // where the API talks to the service
+	public    *url.URL // host put into signed URLs for clients
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool // http://host/bucket/key instead of http://bucket.host/key
+	client    *http.Client
+}
+
+// NewS3 opens the bucket described by cfg
+func NewS3(cfg models.StorageConfig) (*S3, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" || cfg.S3AccessKey == "" || cfg.S3SecretKey == "" {
+		return nil, errors.New("s3 storage needs an endpoint, bucket, access key and secret key")
+	}
+	endpoint, err := url.Parse(cfg.S3Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.S3Endpoint)
+	}
+	public := endpoint
+	if cfg.S3PublicEndpoint != "" {
+		public, err = url.Parse(cfg.S3PublicEndpoint)
+		if err != nil || public.Host == "" {
+			return nil, fmt.Errorf("invalid s3 public endpoint %q", cfg.S3PublicEndpoint)
+		}
+	}
+	region := cfg.S3Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3{
+		endpoint:  endpoint,
+		public:    public,
+		region:    region,
+		bucket:    cfg.S3Bucket,
+		accessKey: cfg.S3AccessKey,
+		secretKey: cfg.S3SecretKey,
+		pathStyle: cfg.S3PathStyle,
+		client:    &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+// objectURL returns the URL of a key on base
+func (s *S3) objectURL(base *url.URL, key string) *url.URL {
+	u := *base
+	if s.pathStyle {
+		u.Path = strings.TrimSuffix(base.Path, "/") + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + base.Host
+		u.Path = strings.TrimSuffix(base.Path, "/") + "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = ""
+	return &u
+}
+
+// uriEncode escapes s as SigV4 wants: everything but unreserved characters,
+// keeping "/" when encodeSlash is false
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalQuery sorts and escapes query parameters
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// signature computes the SigV4 signature of a canonical request and returns it
+// with the credential scope
+func (s *S3) signature(t time.Time, method string, u *url.URL, query url.Values, headers map[string]string, payloadHash string) (sig, scope, signedHeaders string) {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		canonicalQuery(query),
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	day := t.Format("20060102")
+	scope = day + "/" + s.region + "/s3/aws4_request"
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format(amzDateLayout),
+		scope,
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign)), scope, signedHeaders
+}
+
+// do sends a signed request for key
+func (s *S3) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	u := s.objectURL(s.endpoint, key)
+	t := time.Now().UTC()
+	payloadHash := emptyHash
+	if body != nil {
+		payloadHash = sha256Hex(body)
+	}
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-date":           t.Format(amzDateLayout),
+		"x-amz-content-sha256": payloadHash,
+	}
+	if contentType != "" {
+		headers["content-type"] = contentType
+	}
+	sig, scope, signed := s.signature(t, method, u, nil, headers, payloadHash)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range headers {
+		if k != "host" {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+sig)
+	return s.client.Do(req)
+}
+
+// responseError reads the error an S3 service sent back
+func responseError(op string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s failed: %s: %s", op, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if data == nil {
+		data = []byte{}
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return fmt.Errorf("s3 put failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("put", resp)
+	}
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (*Object, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("s3 get failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError("get", resp)
+	}
+	obj := &Object{ReadCloser: resp.Body, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		obj.ModTime = t
+	}
+	return obj, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return fmt.Errorf("s3 delete failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// S3 answers 204 whether or not the key existed
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError("delete", resp)
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET URL on the public endpoint
+func (s *S3) SignedURL(key string, ttl time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if ttl <= 0 || ttl > maxPresignTime {
+		return "", fmt.Errorf("signed url expiry must be between 1s and %s", maxPresignTime)
+	}
+	u := s.objectURL(s.public, key)
+	t := time.Now().UTC()
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.accessKey+"/"+t.Format("20060102")+"/"+s.region+"/s3/aws4_request")
+	q.Set("X-Amz-Date", t.Format(amzDateLayout))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	sig, _, _ := s.signature(t, http.MethodGet, u, q, map[string]string{"host": u.Host}, unsignedBody)
+
+	u.RawQuery = canonicalQuery(q) + "&X-Amz-Signature=" + sig
+	return u.String(), nil
+}
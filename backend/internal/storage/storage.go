@@ -0,0 +1,65 @@
+// Package storage keeps uploaded files on the local disk or in an
+// S3-compatible bucket (AWS S3, MinIO). Files are addressed by keys such as
+// "attachments/branch_1/order_5/9f2c….jpg", always with forward slashes.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// ErrNotFound is returned when no file is stored under a key
+var ErrNotFound = errors.New("file not found")
+
+// Object is an open stored file
+type Object struct {
+	io.ReadCloser
+	Size        int64 // -1 when unknown
+	ModTime     time.Time
+	ContentType string
+}
+
+// Store is where uploaded files are kept
+type Store interface {
+	// Put stores data under key, replacing any file already there
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open reads the file under key; the caller closes it
+	Open(ctx context.Context, key string) (*Object, error)
+	// Delete removes the file under key; a missing file is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads the file without other
+	// credentials until ttl has passed
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// New opens the store selected by cfg.Backend ("local" when empty, or "s3")
+func New(cfg models.StorageConfig) (Store, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocal(cfg.LocalRoot, cfg.URLSecret)
+	case "s3":
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// CleanKey normalizes a key and rejects keys that are empty or try to leave
+// the store's root
+func CleanKey(key string) (string, error) {
+	if strings.Contains(key, "..") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	clean := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if clean == "" {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return clean, nil
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
+)
+
+// consistent context key used everywhere
+type contextKey string
+
+const userContextKey = contextKey("user")
+
+// ContextWithUser attaches the authenticated user to the context
+func ContextWithUser(ctx context.Context, user *models.JWT) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the user attached by the AuthUser middleware
+func UserFromContext(ctx context.Context) (*models.JWT, bool) {
+	u, ok := ctx.Value(userContextKey).(*models.JWT)
+	if !ok || u == nil {
+		return nil, false
+	}
+	return u, true
+}
@@ -0,0 +1,30 @@
+package utils
+
+type Role string
+
+const (
+	RoleChairman Role = "chairman"
+	RoleAdmin    Role = "admin"
+	RoleManager  Role = "manager"
+	RoleEmployee Role = "employee"
+)
+
+// HasAccess tells whether a user with userRole may do what needs required
+func HasAccess(userRole, required Role) bool {
+	// chairman (owner) can do everything
+	if userRole == RoleChairman {
+		return true
+	}
+	switch required {
+	case RoleChairman:
+		return false
+	case RoleAdmin:
+		return userRole == RoleAdmin
+	case RoleManager:
+		return userRole == RoleAdmin || userRole == RoleManager
+	case RoleEmployee:
+		return false
+	default:
+		return false
+	}
+}
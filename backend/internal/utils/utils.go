@@ -3,13 +3,13 @@ package utils
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/projuktisheba/erp-mini-api/internal/models"
 )
 
 // readJSON read json from request body into data. It accepts a sinle JSON of 1MB max size value in the body
@@ -54,6 +54,10 @@ func WriteJSON(w http.ResponseWriter, status int, data any, headers ...http.Head
 
 // badRequest sends a JSON response with the status http.StatusBadRequest, describing the error
 func BadRequest(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrPeriodClosed) {
+		Conflict(w, err)
+		return
+	}
 	var payload struct {
 		Error   bool   `json:"error"`
 		Message string `json:"message"`
@@ -85,8 +89,28 @@ func NotFound(w http.ResponseWriter, message string) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
-// ServerError sends a 500 JSON response with a standard structure.
+// Conflict sends a 409 JSON response for a request that clashes with the state
+// of the data, e.g. a change dated in a closed accounting period.
+func Conflict(w http.ResponseWriter, err error) {
+	resp := struct {
+		Error   bool   `json:"error"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{
+		Error:   true,
+		Status:  "conflict",
+		Message: err.Error(),
+	}
+	_ = WriteJSON(w, http.StatusConflict, resp)
+}
+
+// ServerError sends a 500 JSON response with a standard structure. Errors the
+// client can act on, such as a closed accounting period, get their own status.
 func ServerError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrPeriodClosed) {
+		Conflict(w, err)
+		return
+	}
 	message := "Internal server error"
 	if err != nil && err.Error() != "" {
 		message = err.Error()
@@ -126,25 +150,6 @@ func GetBranchID(r *http.Request) int64 {
 	return branchID
 }
 
-// GenerateMemoNo generates a memo number like "MMDD-4CHAR"
-func GenerateMemoNo() string {
-	// create a new rand with its own seed
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-	// MMDD part
-	datePart := time.Now().Format("0102")
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	// 4 random alphanumeric characters
-	randomPart := make([]byte, 4)
-	for i := range randomPart {
-		randomPart[i] = charset[r.Intn(len(charset))]
-	}
-
-	return fmt.Sprintf("%s%s", datePart, string(randomPart))
-}
-
-
-
 // IsUniqueViolation checks if an error contains a unique constraint violation
 // for the specified database constraint name.
 func IsUniqueViolation(err error, constraintName string) bool {
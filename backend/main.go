@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/projuktisheba/erp-mini-api/api"
 )
@@ -10,8 +11,18 @@ import (
 // startup is called at application startup
 func main() {
 	ctx := context.Background()
+
+	// Maintenance subcommands, e.g. `erp-mini-api rebuild-aggregates -branch 1 -from 2025-01-01 -to 2025-01-31`
+	if len(os.Args) > 1 {
+		if err := api.RunCLI(ctx, os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Start backend server
 	if err := api.RunServer(ctx); err != nil {
 		fmt.Printf("Failed to start backend server: %v\n", err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,33 @@
+-- =========================================================
+-- ATTACHMENTS
+-- =========================================================
+-- Depends on: branches, employees, order_item_details.sql
+
+-- Space each branch may use for attachments
+ALTER TABLE branches ADD COLUMN attachment_quota_mb INTEGER NOT NULL DEFAULT 1024 CHECK (attachment_quota_mb >= 0);
+
+-- =========================
+-- Table: attachments
+-- =========================
+-- A file linked to an order, order item, customer, purchase or expense.
+-- entity_id is orders.id, order_items.id, customers.id, purchase.id or, for
+-- expenses, transactions.transaction_id.
+-- storage_path and thumb_path are relative to the data directory.
+CREATE TABLE attachments (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id),
+    entity_type VARCHAR(20) NOT NULL
+        CHECK (entity_type IN ('order', 'order_item', 'customer', 'purchase', 'expense')),
+    entity_id BIGINT NOT NULL,
+    file_name TEXT NOT NULL DEFAULT '',     -- name of the uploaded file
+    content_type VARCHAR(100) NOT NULL,     -- sniffed from the content
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    storage_path TEXT NOT NULL UNIQUE,
+    thumb_path TEXT,                        -- JPEG preview, NULL when the type has none
+    caption TEXT NOT NULL DEFAULT '',
+    uploaded_by BIGINT REFERENCES employees(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_attachments_entity ON attachments(entity_type, entity_id);
+CREATE INDEX idx_attachments_branch ON attachments(branch_id);
@@ -0,0 +1,15 @@
+-- =========================================================
+-- BALANCE SHEET & TRIAL BALANCE
+-- =========================================================
+-- Depends on: purchase (profit_and_loss.sql)
+
+-- =========================
+-- Table: purchase
+-- =========================
+-- Amount paid to the supplier when the purchase was booked; the rest is a
+-- supplier payable. Existing purchases were always paid in full.
+ALTER TABLE purchase ADD COLUMN IF NOT EXISTS paid_amount NUMERIC(12,2);
+UPDATE purchase SET paid_amount = total_amount WHERE paid_amount IS NULL;
+ALTER TABLE purchase ALTER COLUMN paid_amount SET NOT NULL;
+ALTER TABLE purchase ALTER COLUMN paid_amount SET DEFAULT 0;
+ALTER TABLE purchase ADD CONSTRAINT purchase_paid_amount_check CHECK (paid_amount >= 0 AND paid_amount <= total_amount);
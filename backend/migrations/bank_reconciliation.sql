@@ -0,0 +1,84 @@
+-- =========================================================
+-- BANK STATEMENT IMPORT & RECONCILIATION
+-- =========================================================
+-- Depends on: branches, accounts, transactions
+
+-- =========================
+-- Table: bank_csv_mappings
+-- =========================
+-- Column mappings for CSV statements. A column is referenced by its header
+-- name (when has_header is true) or by its 1-based position.
+CREATE TABLE bank_csv_mappings (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    account_id BIGINT REFERENCES accounts(id) ON DELETE CASCADE, -- NULL = usable for any account of the branch
+    name VARCHAR(100) NOT NULL,
+
+    date_column VARCHAR(100) NOT NULL,
+    amount_column VARCHAR(100) NOT NULL DEFAULT '', -- signed amount; leave empty when debit/credit columns are used
+    debit_column VARCHAR(100) NOT NULL DEFAULT '',
+    credit_column VARCHAR(100) NOT NULL DEFAULT '',
+    memo_column VARCHAR(100) NOT NULL DEFAULT '',
+    reference_column VARCHAR(100) NOT NULL DEFAULT '',
+
+    date_format VARCHAR(50) NOT NULL DEFAULT '2006-01-02', -- Go layout
+    delimiter VARCHAR(1) NOT NULL DEFAULT ',',
+    decimal_separator VARCHAR(1) NOT NULL DEFAULT '.' CHECK (decimal_separator IN ('.', ',')), -- ',' reads 1.234,50
+    has_header BOOLEAN NOT NULL DEFAULT TRUE,
+    skip_rows INT NOT NULL DEFAULT 0,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(branch_id, name)
+);
+
+-- =========================
+-- Table: bank_statements
+-- =========================
+CREATE TABLE bank_statements (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    account_id BIGINT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    format VARCHAR(20) NOT NULL CHECK (format IN ('csv', 'ofx', 'camt053')),
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    file_hash VARCHAR(64) NOT NULL DEFAULT '', -- sha256 of the uploaded file, hex
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    opening_balance NUMERIC(12,2),
+    closing_balance NUMERIC(12,2),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_bank_statements_account ON bank_statements(account_id, period_end);
+-- the same file cannot be imported twice for an account
+CREATE UNIQUE INDEX idx_bank_statements_file_hash ON bank_statements(account_id, file_hash)
+    WHERE file_hash <> '';
+
+-- =========================
+-- Table: bank_statement_lines
+-- =========================
+-- amount is signed: positive = money into the account, negative = money out.
+CREATE TABLE bank_statement_lines (
+    id BIGSERIAL PRIMARY KEY,
+    statement_id BIGINT NOT NULL REFERENCES bank_statements(id) ON DELETE CASCADE,
+    account_id BIGINT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    line_no INT NOT NULL,
+    txn_date DATE NOT NULL,
+    amount NUMERIC(12,2) NOT NULL,
+    memo TEXT NOT NULL DEFAULT '',
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'unmatched'
+        CHECK (status IN ('unmatched', 'matched', 'created', 'ignored')),
+    transaction_id BIGINT REFERENCES transactions(transaction_id) ON DELETE SET NULL,
+    match_method VARCHAR(20) NOT NULL DEFAULT '' CHECK (match_method IN ('', 'auto', 'manual')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(statement_id, line_no)
+);
+
+CREATE INDEX idx_bank_statement_lines_account_date ON bank_statement_lines(account_id, txn_date);
+CREATE INDEX idx_bank_statement_lines_status ON bank_statement_lines(status);
+-- a book transaction can be reconciled against one statement line only
+CREATE UNIQUE INDEX idx_bank_statement_lines_transaction ON bank_statement_lines(transaction_id)
+    WHERE transaction_id IS NOT NULL;
@@ -0,0 +1,19 @@
+-- =========================================================
+-- CUSTOMER CREDIT LIMITS
+-- =========================================================
+-- Depends on: branches, customers, employees, orders, sales
+
+-- Branch default applied to customers without their own limit (NULL: no limit)
+ALTER TABLE branches ADD COLUMN default_credit_limit NUMERIC(12,2) CHECK (default_credit_limit >= 0);
+
+-- Per-customer limit on the total due (NULL: use the branch default)
+ALTER TABLE customers ADD COLUMN credit_limit NUMERIC(12,2) CHECK (credit_limit >= 0);
+
+-- Manager approval of an order or sale that goes over the customer's limit
+ALTER TABLE orders
+    ADD COLUMN credit_override_by BIGINT REFERENCES employees(id),
+    ADD COLUMN credit_override_reason TEXT;
+
+ALTER TABLE sales
+    ADD COLUMN credit_override_by BIGINT REFERENCES employees(id),
+    ADD COLUMN credit_override_reason TEXT;
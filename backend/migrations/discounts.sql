@@ -0,0 +1,101 @@
+-- =========================================================
+-- DISCOUNTS, PROMOTIONS AND COUPON CODES
+-- =========================================================
+-- Depends on: branches, customers, employees, orders, order_items, sales, sale_items
+
+-- Named promotions; NULL branch_id runs the promotion in every branch
+CREATE TABLE IF NOT EXISTS promotions (
+    id              BIGSERIAL PRIMARY KEY,
+    branch_id       BIGINT REFERENCES branches(id),
+    name            VARCHAR(100) NOT NULL,
+    discount_type   VARCHAR(10) NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+    discount_value  NUMERIC(12,2) NOT NULL CHECK (discount_value > 0),
+    starts_on       DATE NOT NULL,
+    ends_on         DATE NOT NULL,
+    requires_coupon BOOLEAN NOT NULL DEFAULT FALSE, -- only given against one of its coupon codes
+    active          BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by      BIGINT REFERENCES employees(id),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_on >= starts_on),
+    CHECK (discount_type <> 'percent' OR discount_value <= 100)
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotions_dates ON promotions(starts_on, ends_on);
+
+-- Codes that give the discount of their promotion; NULL limits are unlimited
+CREATE TABLE IF NOT EXISTS coupons (
+    id                    BIGSERIAL PRIMARY KEY,
+    promotion_id          BIGINT NOT NULL REFERENCES promotions(id),
+    code                  VARCHAR(40) NOT NULL,
+    max_uses              INT CHECK (max_uses > 0),
+    max_uses_per_customer INT CHECK (max_uses_per_customer > 0),
+    active                BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- codes are matched without regard to case
+CREATE UNIQUE INDEX IF NOT EXISTS coupons_code_key ON coupons(UPPER(code));
+
+-- One row per order or sale a coupon was used on; cancelling the order frees the use
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id              BIGSERIAL PRIMARY KEY,
+    coupon_id       BIGINT NOT NULL REFERENCES coupons(id),
+    branch_id       BIGINT NOT NULL REFERENCES branches(id),
+    customer_id     BIGINT NOT NULL REFERENCES customers(id),
+    document_type   VARCHAR(10) NOT NULL CHECK (document_type IN ('order', 'sale')),
+    document_id     BIGINT NOT NULL,
+    memo_no         VARCHAR(50) NOT NULL,
+    discount_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    redeemed_on     DATE NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (document_type, document_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_coupon ON coupon_redemptions(coupon_id, customer_id);
+
+-- Discounts given by hand above this share of the gross need a manager (NULL: never)
+ALTER TABLE branches ADD COLUMN discount_approval_percent NUMERIC(5,2)
+    CHECK (discount_approval_percent BETWEEN 0 AND 100);
+
+-- Line discounts; subtotal stays the price before the discount
+ALTER TABLE order_items
+    ADD COLUMN discount_type VARCHAR(10) CHECK (discount_type IN ('percent', 'fixed')),
+    ADD COLUMN discount_value NUMERIC(12,2),
+    ADD COLUMN discount_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+ALTER TABLE sale_items
+    ADD COLUMN discount_type VARCHAR(10) CHECK (discount_type IN ('percent', 'fixed')),
+    ADD COLUMN discount_value NUMERIC(12,2),
+    ADD COLUMN discount_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+-- Document discounts; total_amount is gross_amount less discount_amount
+ALTER TABLE orders
+    ADD COLUMN gross_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN discount_type VARCHAR(10) CHECK (discount_type IN ('percent', 'fixed')),
+    ADD COLUMN discount_value NUMERIC(12,2),
+    ADD COLUMN line_discount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN document_discount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN promotion_id BIGINT REFERENCES promotions(id),
+    ADD COLUMN promotion_discount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN coupon_id BIGINT REFERENCES coupons(id),
+    ADD COLUMN discount_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN discount_approved_by BIGINT REFERENCES employees(id),
+    ADD COLUMN discount_approval_reason TEXT;
+
+ALTER TABLE sales
+    ADD COLUMN gross_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN discount_type VARCHAR(10) CHECK (discount_type IN ('percent', 'fixed')),
+    ADD COLUMN discount_value NUMERIC(12,2),
+    ADD COLUMN line_discount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN document_discount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN promotion_id BIGINT REFERENCES promotions(id),
+    ADD COLUMN promotion_discount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN coupon_id BIGINT REFERENCES coupons(id),
+    ADD COLUMN discount_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN discount_approved_by BIGINT REFERENCES employees(id),
+    ADD COLUMN discount_approval_reason TEXT;
+
+-- Documents recorded before discounts existed were sold at their total
+UPDATE orders SET gross_amount = total_amount;
+UPDATE sales SET gross_amount = total_amount;
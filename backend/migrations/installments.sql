@@ -0,0 +1,21 @@
+-- =========================================================
+-- INSTALLMENT PLANS
+-- =========================================================
+-- Depends on: orders, branches
+
+-- The schedule the balance of an order is paid on. Installments are settled
+-- in order by what the order has received beyond the part outside the plan
+-- (the advance), so every payment counts whichever way it was recorded.
+CREATE TABLE IF NOT EXISTS order_installments (
+    id             BIGSERIAL PRIMARY KEY,
+    order_id       BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    branch_id      BIGINT NOT NULL REFERENCES branches(id),
+    installment_no INT NOT NULL,
+    due_date       DATE NOT NULL,
+    amount         NUMERIC(12,2) NOT NULL CHECK (amount > 0),
+    notes          TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (order_id, installment_no)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_installments_branch_due ON order_installments(branch_id, due_date);
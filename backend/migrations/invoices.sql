@@ -0,0 +1,9 @@
+-- =========================================================
+-- PRINTED INVOICES
+-- =========================================================
+-- Depends on: branches
+
+-- Terms printed at the foot of a branch's invoices, per language
+ALTER TABLE branches
+    ADD COLUMN invoice_terms TEXT NOT NULL DEFAULT '',
+    ADD COLUMN invoice_terms_ar TEXT NOT NULL DEFAULT '';
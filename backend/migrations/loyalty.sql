@@ -0,0 +1,70 @@
+-- =========================================================
+-- CUSTOMER LOYALTY POINTS
+-- =========================================================
+-- Depends on: branches, customers, transactions, order_transactions,
+-- sale_transactions, memo_sequences
+
+-- Points redeemed on orders and sales are numbered from their own memo sequence
+ALTER TABLE memo_sequences DROP CONSTRAINT IF EXISTS memo_sequences_document_type_check;
+ALTER TABLE memo_sequences ADD CONSTRAINT memo_sequences_document_type_check
+    CHECK (document_type IN ('order', 'sale', 'purchase', 'salary', 'refund', 'transfer',
+                             'payment', 'store_credit', 'restock', 'voucher', 'loyalty'));
+
+-- Points the customer holds; negative when points taken back after a return
+-- had already been spent
+ALTER TABLE customers ADD COLUMN loyalty_points BIGINT NOT NULL DEFAULT 0;
+
+-- =========================
+-- Table: loyalty_rules
+-- =========================
+-- How points are earned and what they are worth. NULL branch_id applies in
+-- every branch and a branch rule takes its place; a document is rewarded
+-- under the rule in force on its date.
+CREATE TABLE IF NOT EXISTS loyalty_rules (
+    id                BIGSERIAL PRIMARY KEY,
+    branch_id         BIGINT REFERENCES branches(id),
+    name              VARCHAR(50) NOT NULL,
+    amount_per_point  NUMERIC(12,2) NOT NULL CHECK (amount_per_point > 0), -- paid amount that earns one point
+    point_value       NUMERIC(12,2) NOT NULL CHECK (point_value > 0),      -- worth of one point when redeemed
+    expiry_months     INT NOT NULL CHECK (expiry_months > 0),
+    min_redeem_points BIGINT NOT NULL DEFAULT 0 CHECK (min_redeem_points >= 0),
+    starts_on         DATE NOT NULL,
+    active            BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_rules_lookup ON loyalty_rules(branch_id, starts_on);
+
+-- =========================
+-- Table: loyalty_ledger
+-- =========================
+-- Every movement of a customer's points: positive when earned or given back,
+-- negative when redeemed, taken back or expired. Earned and given back points
+-- keep what is left of them in remaining until expires_on; points are used
+-- oldest first.
+CREATE TABLE IF NOT EXISTS loyalty_ledger (
+    id             BIGSERIAL PRIMARY KEY,
+    customer_id    BIGINT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    branch_id      BIGINT NOT NULL REFERENCES branches(id),
+    entry_date     DATE NOT NULL,
+    entry_type     VARCHAR(10) NOT NULL
+        CHECK (entry_type IN ('earn', 'redeem', 'reverse', 'restore', 'expire')),
+    points         BIGINT NOT NULL CHECK (points <> 0),
+    amount         NUMERIC(12,2) NOT NULL DEFAULT 0, -- paid with the points when redeemed
+    remaining      BIGINT NOT NULL DEFAULT 0 CHECK (remaining >= 0),
+    expires_on     DATE,
+    document_type  VARCHAR(10) CHECK (document_type IN ('order', 'sale')),
+    document_id    BIGINT,
+    transaction_id BIGINT REFERENCES transactions(transaction_id) ON DELETE SET NULL,
+    memo_no        VARCHAR(50) NOT NULL DEFAULT '',
+    notes          TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_customer_date ON loyalty_ledger(customer_id, entry_date);
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_document ON loyalty_ledger(document_type, document_id);
+
+-- Order and sale payments made with points; like store credit they have no account
+ALTER TABLE order_transactions ADD COLUMN loyalty_points BIGINT;
+ALTER TABLE sale_transactions ADD COLUMN loyalty_points BIGINT;
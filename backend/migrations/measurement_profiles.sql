@@ -0,0 +1,96 @@
+-- =========================================================
+-- MEASUREMENT PROFILES AND HISTORY
+-- =========================================================
+-- Depends on: branches, customers, employees, orders
+
+-- =========================
+-- Table: garment_types
+-- =========================
+-- The measurements taken for a kind of garment, e.g. abaya or jalabiya.
+-- fields: [{"key": "length", "label": "Length", "unit": "inch", "required": true}, ...]
+CREATE TABLE garment_types (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    fields JSONB NOT NULL DEFAULT '[]',
+    status BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (branch_id, name)
+);
+
+-- =========================
+-- Table: measurement_profiles
+-- =========================
+-- A named set of measurements of a customer ("Self", "Daughter - Mariam").
+-- Without a garment type the profile uses the standard customer measurements.
+-- Profiles are deactivated, never deleted, since orders point at their versions.
+CREATE TABLE measurement_profiles (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    customer_id BIGINT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    garment_type_id BIGINT REFERENCES garment_types(id),
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    status BOOLEAN NOT NULL DEFAULT TRUE,
+    notes TEXT NOT NULL DEFAULT '',
+    current_version INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (customer_id, name)
+);
+
+-- one default profile per customer; it mirrors the measurement columns of customers
+CREATE UNIQUE INDEX uq_measurement_profiles_default ON measurement_profiles (customer_id) WHERE is_default;
+
+-- =========================
+-- Table: measurement_versions
+-- =========================
+-- Every change of a profile's measurements is a new version; versions are never updated.
+CREATE TABLE measurement_versions (
+    id BIGSERIAL PRIMARY KEY,
+    profile_id BIGINT NOT NULL REFERENCES measurement_profiles(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    measurements JSONB NOT NULL DEFAULT '{}',
+    notes TEXT NOT NULL DEFAULT '',
+    created_by BIGINT REFERENCES employees(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (profile_id, version)
+);
+
+-- The exact measurements an order was made from
+ALTER TABLE orders
+    ADD COLUMN measurement_profile_id BIGINT REFERENCES measurement_profiles(id),
+    ADD COLUMN measurement_version_id BIGINT REFERENCES measurement_versions(id);
+
+-- =========================
+-- Backfill: the customer measurement columns become each customer's default profile
+-- =========================
+INSERT INTO measurement_profiles (branch_id, customer_id, name, is_default, current_version)
+SELECT branch_id, id, 'Default', TRUE, 1
+FROM customers
+WHERE concat(length, shoulder, bust, waist, hip, arm_hole, sleeve_length, sleeve_width, round_width) <> '';
+
+INSERT INTO measurement_versions (profile_id, version, measurements, notes)
+SELECT p.id, 1,
+       jsonb_strip_nulls(jsonb_build_object(
+           'length', NULLIF(c.length, ''),
+           'shoulder', NULLIF(c.shoulder, ''),
+           'bust', NULLIF(c.bust, ''),
+           'waist', NULLIF(c.waist, ''),
+           'hip', NULLIF(c.hip, ''),
+           'arm_hole', NULLIF(c.arm_hole, ''),
+           'sleeve_length', NULLIF(c.sleeve_length, ''),
+           'sleeve_width', NULLIF(c.sleeve_width, ''),
+           'round_width', NULLIF(c.round_width, '')
+       )),
+       'Imported from the customer record'
+FROM measurement_profiles p
+JOIN customers c ON c.id = p.customer_id;
+
+-- existing orders were made from the only measurements the customer had
+UPDATE orders o
+SET measurement_profile_id = p.id, measurement_version_id = v.id
+FROM measurement_profiles p
+JOIN measurement_versions v ON v.profile_id = p.id AND v.version = 1
+WHERE p.customer_id = o.customer_id AND p.is_default;
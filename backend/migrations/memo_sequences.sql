@@ -0,0 +1,76 @@
+-- =========================================================
+-- SEQUENTIAL MEMO NUMBERS
+-- =========================================================
+-- Depends on: branches, transactions, purchase, employees_progress
+
+-- =========================
+-- Table: memo_sequences
+-- =========================
+-- How a branch numbers each type of document, e.g. DIVA-OR-2026-000123:
+-- prefix, the year of the document when yearly (numbering restarts each
+-- year), then the number padded to padding digits.
+CREATE TABLE memo_sequences (
+    branch_id BIGINT NOT NULL REFERENCES branches(id),
+    document_type VARCHAR(20) NOT NULL
+        CHECK (document_type IN ('order', 'sale', 'purchase', 'salary', 'refund', 'transfer',
+                                 'payment', 'store_credit', 'restock')),
+    prefix VARCHAR(30) NOT NULL,
+    padding INTEGER NOT NULL DEFAULT 6 CHECK (padding BETWEEN 1 AND 12),
+    yearly BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (branch_id, document_type)
+);
+
+-- =========================
+-- Table: memo_counters
+-- =========================
+-- Last number given out per sequence and year (0 for sequences that are not
+-- yearly). A number is taken by incrementing the row inside the transaction
+-- that saves the document, so a rolled back document leaves no gap.
+CREATE TABLE memo_counters (
+    branch_id BIGINT NOT NULL REFERENCES branches(id),
+    document_type VARCHAR(20) NOT NULL,
+    year INTEGER NOT NULL,
+    last_value BIGINT NOT NULL DEFAULT 0 CHECK (last_value >= 0),
+    PRIMARY KEY (branch_id, document_type, year)
+);
+
+-- Every branch starts with its first word as the prefix, e.g. DIVA-OR
+INSERT INTO memo_sequences (branch_id, document_type, prefix)
+SELECT b.id, t.document_type, upper(split_part(btrim(b.name), ' ', 1)) || '-' || t.code
+FROM branches b
+CROSS JOIN (VALUES
+    ('order', 'OR'), ('sale', 'SL'), ('purchase', 'PR'), ('salary', 'SY'), ('refund', 'RF'),
+    ('transfer', 'TR'), ('payment', 'RP'), ('store_credit', 'SC'), ('restock', 'RS')
+) AS t(document_type, code);
+
+-- Purchase payments were recorded under PR-{purchase id}; they now carry the
+-- memo number of the purchase
+UPDATE transactions t
+SET memo_no = p.memo_no
+FROM purchase p
+WHERE t.branch_id = p.branch_id
+  AND t.memo_no = 'PR-' || p.id
+  AND t.to_entity_type = 'suppliers';
+
+-- Salary payments were recorded under SY-{employees_progress id}; the memo
+-- number is now kept with the salary
+ALTER TABLE employees_progress ADD COLUMN salary_memo_no VARCHAR(100);
+
+UPDATE employees_progress ep
+SET salary_memo_no = 'SY-' || ep.id
+WHERE EXISTS (
+    SELECT 1 FROM transactions t
+    WHERE t.branch_id = ep.branch_id AND t.memo_no = 'SY-' || ep.id
+);
+
+-- Advance payments likewise were recorded under ADV-{employees_progress id}
+-- and now draw from the salary sequence
+ALTER TABLE employees_progress ADD COLUMN advance_memo_no VARCHAR(100);
+
+UPDATE employees_progress ep
+SET advance_memo_no = 'ADV-' || ep.id
+WHERE EXISTS (
+    SELECT 1 FROM transactions t
+    WHERE t.branch_id = ep.branch_id AND t.memo_no = 'ADV-' || ep.id
+);
@@ -0,0 +1,26 @@
+-- =========================================================
+-- ORDER ITEM MEASUREMENTS, STYLE OPTIONS AND NOTES
+-- =========================================================
+-- Depends on: order_items, measurement_profiles, measurement_versions
+
+-- The same product may now be ordered twice, e.g. one abaya per daughter
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_order_id_product_id_key;
+
+-- measurements: copy of the measurements the item is cut from; it does not
+--   change when the customer's profile does
+-- style_options: {"sleeve_type": "...", "embroidery": "...", "stones": "...", "fabric_code": "...", "extra": {...}}
+ALTER TABLE order_items
+    ADD COLUMN measurement_profile_id BIGINT REFERENCES measurement_profiles(id),
+    ADD COLUMN measurement_version_id BIGINT REFERENCES measurement_versions(id),
+    ADD COLUMN measurements JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN style_options JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN tailor_notes TEXT NOT NULL DEFAULT '';
+
+-- Backfill: existing items take the measurements their order was made from
+UPDATE order_items oi
+SET measurement_profile_id = o.measurement_profile_id,
+    measurement_version_id = o.measurement_version_id,
+    measurements = v.measurements
+FROM orders o
+JOIN measurement_versions v ON v.id = o.measurement_version_id
+WHERE o.id = oi.order_id;
@@ -0,0 +1,60 @@
+-- =========================================================
+-- ACCOUNTING PERIOD LOCKING
+-- =========================================================
+-- Depends on: branches, employees
+
+-- =========================
+-- Table: accounting_periods
+-- =========================
+-- One row per branch and month that has ever been closed. A month without a
+-- row is open. Re-opening keeps the row with status 'open'.
+CREATE TABLE accounting_periods (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    period_month DATE NOT NULL, -- first day of the month
+    status VARCHAR(10) NOT NULL DEFAULT 'closed' CHECK (status IN ('open', 'closed')),
+    closed_by BIGINT REFERENCES employees(id),
+    closed_at TIMESTAMPTZ,
+    reopened_by BIGINT REFERENCES employees(id),
+    reopened_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT accounting_periods_month_check CHECK (EXTRACT(DAY FROM period_month) = 1),
+    UNIQUE (branch_id, period_month)
+);
+
+-- =========================
+-- Table: accounting_period_audit
+-- =========================
+-- Every close and re-open, with who did it and why
+CREATE TABLE accounting_period_audit (
+    id BIGSERIAL PRIMARY KEY,
+    period_id BIGINT NOT NULL REFERENCES accounting_periods(id) ON DELETE CASCADE,
+    branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    period_month DATE NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('close', 'reopen')),
+    employee_id BIGINT REFERENCES employees(id),
+    employee_name VARCHAR(255) NOT NULL DEFAULT '',
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_accounting_period_audit_branch ON accounting_period_audit(branch_id, created_at);
+
+-- =========================
+-- Table: period_adjustments
+-- =========================
+-- Every adjustment posted for a closed period, with who posted it
+CREATE TABLE period_adjustments (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    transaction_id BIGINT NOT NULL REFERENCES transactions(transaction_id),
+    adjustment_date DATE NOT NULL,
+    reference VARCHAR(100) NOT NULL, -- memo no of the corrected document
+    employee_id BIGINT NOT NULL REFERENCES employees(id),
+    employee_name VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_period_adjustments_branch ON period_adjustments(branch_id, adjustment_date);
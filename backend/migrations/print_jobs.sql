@@ -0,0 +1,32 @@
+-- =========================================================
+-- RECEIPT PRINT QUEUE
+-- =========================================================
+-- Depends on: branches, employees
+
+-- =========================
+-- Table: print_jobs
+-- =========================
+-- An ESC/POS receipt waiting for a branch's thermal printer. The POS client
+-- polls for queued jobs, sends the payload to its local printer and reports
+-- back. printer names the printer a job is meant for; '' lets any take it.
+-- document_id is orders.id or sales.id.
+CREATE TABLE print_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id),
+    printer VARCHAR(50) NOT NULL DEFAULT '',
+    document_type VARCHAR(10) NOT NULL CHECK (document_type IN ('order', 'sale')),
+    document_id BIGINT NOT NULL,
+    kind VARCHAR(20) NOT NULL,             -- order, delivery, sale or refund
+    memo_no VARCHAR(100) NOT NULL DEFAULT '',
+    payload BYTEA NOT NULL,                -- ESC/POS commands
+    status VARCHAR(20) NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'printing', 'done', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',        -- last failure reported by the client
+    created_by BIGINT REFERENCES employees(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    claimed_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_print_jobs_queue ON print_jobs(branch_id, status, id);
@@ -0,0 +1,22 @@
+-- =========================================================
+-- PROFIT & LOSS
+-- =========================================================
+-- Depends on: products, purchase
+
+-- =========================
+-- Table: products
+-- =========================
+-- Latest known cost of one unit, set on restock. NULL = cost unknown,
+-- such units are left out of cost of goods sold.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS unit_cost NUMERIC(12,2);
+
+-- =========================
+-- Table: purchase
+-- =========================
+-- Expense category of a purchase:
+--   material -> fabric and trims for tailoring orders (cost of goods sold)
+--   stock    -> ready-made stock (inventory; expensed through products.unit_cost when sold)
+--   anything else (rent, utilities, transport, ...) -> operating expense
+ALTER TABLE purchase ADD COLUMN IF NOT EXISTS category VARCHAR(50) NOT NULL DEFAULT 'material';
+
+CREATE INDEX IF NOT EXISTS idx_purchase_branch_category_date ON purchase(branch_id, category, purchase_date);
@@ -0,0 +1,10 @@
+-- =========================================================
+-- SPLIT PAYMENTS
+-- =========================================================
+-- Depends on: order_transactions, sale_transactions, transactions
+
+-- An order, delivery or sale paid into several accounts gets one row per
+-- account; reference is the card slip, transfer or cheque number
+ALTER TABLE order_transactions ADD COLUMN reference VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE sale_transactions ADD COLUMN reference VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN reference VARCHAR(100) NOT NULL DEFAULT '';
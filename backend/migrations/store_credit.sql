@@ -0,0 +1,37 @@
+-- =========================================================
+-- CUSTOMER STORE CREDIT
+-- =========================================================
+-- Depends on: branches, customers, accounts, transactions, orders
+
+-- Money held for the customer (top-ups, overpayments, refunds, cancelled orders)
+ALTER TABLE customers ADD COLUMN store_credit NUMERIC(12,2) NOT NULL DEFAULT 0 CHECK (store_credit >= 0);
+
+-- Day the order was cancelled; cancellations are booked on this date
+ALTER TABLE orders ADD COLUMN cancelled_at DATE;
+
+-- =========================
+-- Table: store_credit_ledger
+-- =========================
+-- Every movement of a customer's store credit. amount is positive when money
+-- is added to the credit and negative when it is spent or paid out.
+CREATE TABLE store_credit_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    customer_id BIGINT NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    entry_date DATE NOT NULL DEFAULT CURRENT_DATE,
+    entry_type VARCHAR(20) NOT NULL
+        CHECK (entry_type IN ('topup', 'overpayment', 'refund', 'cancellation', 'spend', 'withdrawal')),
+    amount NUMERIC(12,2) NOT NULL CHECK (amount <> 0),
+    -- cash or bank account for top-ups, overpayments and withdrawals
+    account_id BIGINT REFERENCES accounts(id),
+    -- order or sale the credit came from or was spent on
+    document_type VARCHAR(10) CHECK (document_type IN ('order', 'sale')),
+    document_id BIGINT,
+    transaction_id BIGINT REFERENCES transactions(transaction_id) ON DELETE SET NULL,
+    memo_no VARCHAR(50) NOT NULL DEFAULT '',
+    notes TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_store_credit_customer_date ON store_credit_ledger (customer_id, entry_date);
+CREATE INDEX idx_store_credit_branch_date ON store_credit_ledger (branch_id, entry_date);
@@ -0,0 +1,31 @@
+-- =========================================================
+-- SUPPLIER PAYMENTS
+-- =========================================================
+-- Depends on: purchase (balance_sheet.sql), suppliers, transactions, memo_sequences
+
+-- Payments made after a purchase was booked are numbered from their own memo sequence
+ALTER TABLE memo_sequences DROP CONSTRAINT IF EXISTS memo_sequences_document_type_check;
+ALTER TABLE memo_sequences ADD CONSTRAINT memo_sequences_document_type_check
+    CHECK (document_type IN ('order', 'sale', 'purchase', 'salary', 'refund', 'transfer',
+                             'payment', 'store_credit', 'restock', 'voucher', 'loyalty',
+                             'supplier_payment'));
+
+-- =========================
+-- Table: purchase_payments
+-- =========================
+-- The part of a supplier payment applied to one purchase. purchase.paid_amount
+-- is the amount paid when the purchase was booked plus these rows.
+CREATE TABLE IF NOT EXISTS purchase_payments (
+    id             BIGSERIAL PRIMARY KEY,
+    purchase_id    BIGINT NOT NULL REFERENCES purchase(id),
+    supplier_id    BIGINT NOT NULL REFERENCES suppliers(id),
+    branch_id      BIGINT NOT NULL REFERENCES branches(id),
+    transaction_id BIGINT NOT NULL REFERENCES transactions(transaction_id),
+    payment_date   DATE NOT NULL,
+    memo_no        VARCHAR(50) NOT NULL,
+    amount         NUMERIC(12,2) NOT NULL CHECK (amount > 0),
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_payments_purchase ON purchase_payments(purchase_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_payments_supplier ON purchase_payments(supplier_id, payment_date);
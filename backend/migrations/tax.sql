@@ -0,0 +1,71 @@
+-- =========================================================
+-- TAX RATES, TAX LINES AND TAX INVOICES
+-- =========================================================
+-- Depends on: branches, products, orders, sales, purchase
+
+-- Tax details of a branch; prices_include_tax is the default of its documents
+ALTER TABLE branches
+    ADD COLUMN tax_id VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN prices_include_tax BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Products are taxed by category
+ALTER TABLE products ADD COLUMN tax_category VARCHAR(50) NOT NULL DEFAULT 'standard';
+
+-- Named tax rates by category; NULL branch_id applies in every branch and a
+-- branch rate of the same name and category takes its place. Purchase rates
+-- are looked up by the purchase category.
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id         BIGSERIAL PRIMARY KEY,
+    branch_id  BIGINT REFERENCES branches(id),
+    applies_to VARCHAR(10) NOT NULL CHECK (applies_to IN ('sales', 'purchases')),
+    category   VARCHAR(50) NOT NULL,
+    name       VARCHAR(50) NOT NULL,
+    rate       NUMERIC(5,2) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+    starts_on  DATE NOT NULL,
+    ends_on    DATE, -- NULL: until further notice
+    active     BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_on IS NULL OR ends_on >= starts_on)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tax_rates_lookup ON tax_rates(applies_to, category, starts_on);
+
+-- The taxes of each order, sale and purchase, rewritten whenever it changes
+CREATE TABLE IF NOT EXISTS document_taxes (
+    id             BIGSERIAL PRIMARY KEY,
+    document_type  VARCHAR(10) NOT NULL CHECK (document_type IN ('order', 'sale', 'purchase')),
+    document_id    BIGINT NOT NULL,
+    branch_id      BIGINT NOT NULL REFERENCES branches(id),
+    document_date  DATE NOT NULL,
+    tax_rate_id    BIGINT REFERENCES tax_rates(id),
+    name           VARCHAR(50) NOT NULL,
+    category       VARCHAR(50) NOT NULL,
+    rate           NUMERIC(5,2) NOT NULL,
+    taxable_amount NUMERIC(12,2) NOT NULL,
+    tax_amount     NUMERIC(12,2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_taxes_document ON document_taxes(document_type, document_id);
+CREATE INDEX IF NOT EXISTS idx_document_taxes_branch_date ON document_taxes(branch_id, document_date);
+
+-- Tax totals; net_amount is total_amount less tax_amount
+ALTER TABLE orders
+    ADD COLUMN prices_include_tax BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN net_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN tax_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+ALTER TABLE sales
+    ADD COLUMN prices_include_tax BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN net_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN tax_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+ALTER TABLE purchase
+    ADD COLUMN prices_include_tax BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN net_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+    ADD COLUMN tax_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+-- Documents recorded before tax existed were untaxed
+UPDATE orders SET net_amount = total_amount;
+UPDATE sales SET net_amount = total_amount;
+UPDATE purchase SET net_amount = total_amount;
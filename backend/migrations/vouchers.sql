@@ -0,0 +1,62 @@
+-- =========================================================
+-- GIFT VOUCHERS
+-- =========================================================
+-- Depends on: branches, customers, accounts, transactions, order_transactions,
+-- sale_transactions, memo_sequences
+
+-- Vouchers are numbered from their own memo sequence
+ALTER TABLE memo_sequences DROP CONSTRAINT IF EXISTS memo_sequences_document_type_check;
+ALTER TABLE memo_sequences ADD CONSTRAINT memo_sequences_document_type_check
+    CHECK (document_type IN ('order', 'sale', 'purchase', 'salary', 'refund', 'transfer',
+                             'payment', 'store_credit', 'restock', 'voucher'));
+
+-- =========================
+-- Table: gift_vouchers
+-- =========================
+-- A voucher is sold in one branch and can be redeemed in any branch until it
+-- expires; balance is what is left of the face value.
+CREATE TABLE IF NOT EXISTS gift_vouchers (
+    id          BIGSERIAL PRIMARY KEY,
+    code        VARCHAR(30) NOT NULL UNIQUE,
+    branch_id   BIGINT NOT NULL REFERENCES branches(id),
+    customer_id BIGINT REFERENCES customers(id), -- who bought it, when known
+    face_value  NUMERIC(12,2) NOT NULL CHECK (face_value > 0),
+    balance     NUMERIC(12,2) NOT NULL CHECK (balance >= 0),
+    issued_on   DATE NOT NULL,
+    expires_on  DATE NOT NULL,
+    memo_no     VARCHAR(50) NOT NULL DEFAULT '',
+    notes       TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (balance <= face_value),
+    CHECK (expires_on >= issued_on)
+);
+
+-- =========================
+-- Table: voucher_ledger
+-- =========================
+-- Every movement of a voucher, in the branch it happened in: positive when
+-- the voucher is sold, negative when it pays an order or sale. The sum per
+-- branch is what the branch owes voucher holders.
+CREATE TABLE IF NOT EXISTS voucher_ledger (
+    id             BIGSERIAL PRIMARY KEY,
+    voucher_id     BIGINT NOT NULL REFERENCES gift_vouchers(id),
+    branch_id      BIGINT NOT NULL REFERENCES branches(id),
+    entry_date     DATE NOT NULL,
+    entry_type     VARCHAR(10) NOT NULL CHECK (entry_type IN ('issue', 'redeem')),
+    amount         NUMERIC(12,2) NOT NULL CHECK (amount <> 0),
+    account_id     BIGINT REFERENCES accounts(id), -- where the money of a sold voucher went
+    document_type  VARCHAR(10) CHECK (document_type IN ('order', 'sale')),
+    document_id    BIGINT,
+    transaction_id BIGINT REFERENCES transactions(transaction_id) ON DELETE SET NULL,
+    memo_no        VARCHAR(50) NOT NULL DEFAULT '',
+    notes          TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_voucher_ledger_voucher ON voucher_ledger(voucher_id);
+CREATE INDEX IF NOT EXISTS idx_voucher_ledger_branch_date ON voucher_ledger(branch_id, entry_date);
+
+-- Order and sale payments made with a voucher; like store credit they have no account
+ALTER TABLE order_transactions ADD COLUMN voucher_id BIGINT REFERENCES gift_vouchers(id);
+ALTER TABLE sale_transactions ADD COLUMN voucher_id BIGINT REFERENCES gift_vouchers(id);